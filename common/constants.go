@@ -33,6 +33,9 @@ var DefaultCollapseSidebar = false // default value of collapse sidebar
 var SessionSecret = uuid.New().String()
 var CryptoSecret = uuid.New().String()
 
+// SecretEncryptionKey 敏感数据静态加密的主密钥，为空时不加密
+var SecretEncryptionKey = ""
+
 var OptionMap map[string]string
 var OptionMapRWMutex sync.RWMutex
 
@@ -177,6 +180,18 @@ const (
 	TokenStatusExhausted = 4
 )
 
+const (
+	OrganizationStatusEnabled  = 1 // don't use 0, 0 is the default value!
+	OrganizationStatusDisabled = 2 // also don't use 0
+)
+
+// 组织成员角色，站点管理员拥有所有组织的 owner 权限
+const (
+	OrgRoleMember = 1
+	OrgRoleAdmin  = 10
+	OrgRoleOwner  = 100
+)
+
 const (
 	RedemptionCodeStatusEnabled  = 1 // don't use 0, 0 is the default value!
 	RedemptionCodeStatusDisabled = 2 // also don't use 0
@@ -190,6 +205,13 @@ const (
 	ChannelStatusAutoDisabled     = 3
 )
 
+// 多密钥渠道的密钥选择策略
+const (
+	ChannelMultiKeyModeRoundRobin = "round_robin"
+	ChannelMultiKeyModeRandom     = "random"
+	ChannelMultiKeyModeLeastUsed  = "least_used"
+)
+
 const (
 	ChannelTypeUnknown        = 0
 	ChannelTypeOpenAI         = 1
@@ -236,6 +258,9 @@ const (
 	ChannelTypeBaiduV2        = 46
 	ChannelTypeXinference     = 47
 	ChannelTypeXai            = 48
+	ChannelTypeKling          = 49
+	ChannelTypeRunway         = 50
+	ChannelTypeLuma           = 51
 	ChannelTypeDummy          // this one is only for count, do not add any channel after this
 
 )
@@ -290,4 +315,7 @@ var ChannelBaseURLs = []string{
 	"https://qianfan.baidubce.com",              //46
 	"",                                          //47
 	"https://api.x.ai",                          //48
+	"https://api.klingai.com",                   //49
+	"https://api.dev.runwayml.com",              //50
+	"https://api.lumalabs.ai",                   //51
 }
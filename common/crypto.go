@@ -1,10 +1,18 @@
 package common
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
+	"strings"
 )
 
 func GenerateHMACWithKey(key []byte, data string) string {
@@ -29,3 +37,151 @@ func ValidatePasswordAndHash(password string, hash string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptWithKey 使用 32 字节的密钥进行 AES-GCM 加密，返回 base64 编码的密文
+func EncryptWithKey(plaintext string, key []byte) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(plaintext), nil)), nil
+}
+
+// DecryptWithKey 解密 EncryptWithKey 生成的密文
+func DecryptWithKey(ciphertext string, key []byte) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("invalid ciphertext")
+	}
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("failed to decrypt, wrong passphrase or corrupted data")
+	}
+	return string(plaintext), nil
+}
+
+// EncryptWithSecret 使用 secret 的 SHA-256 作为密钥进行 AES-GCM 加密，secret 必须是高熵的随机密钥，
+// 用户输入的口令应使用 PassphraseKdf 派生密钥
+func EncryptWithSecret(plaintext string, secret string) (string, error) {
+	key := sha256.Sum256([]byte(secret))
+	return EncryptWithKey(plaintext, key[:])
+}
+
+// DecryptWithSecret 解密 EncryptWithSecret 生成的密文
+func DecryptWithSecret(ciphertext string, secret string) (string, error) {
+	key := sha256.Sum256([]byte(secret))
+	return DecryptWithKey(ciphertext, key[:])
+}
+
+const PassphraseKdfArgon2id = "argon2id"
+
+// PassphraseKdf 由口令派生加密密钥的参数，盐值随机生成，与密文一起保存
+type PassphraseKdf struct {
+	Algorithm string `json:"algorithm" yaml:"algorithm"`
+	Salt      string `json:"salt" yaml:"salt"`
+	Time      uint32 `json:"time" yaml:"time"`
+	Memory    uint32 `json:"memory" yaml:"memory"` // 单位 KiB
+	Threads   uint8  `json:"threads" yaml:"threads"`
+}
+
+// NewPassphraseKdf 使用 argon2id 推荐参数（3 次迭代、64 MiB 内存）和随机盐值
+func NewPassphraseKdf() (*PassphraseKdf, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return &PassphraseKdf{
+		Algorithm: PassphraseKdfArgon2id,
+		Salt:      base64.StdEncoding.EncodeToString(salt),
+		Time:      3,
+		Memory:    64 * 1024,
+		Threads:   4,
+	}, nil
+}
+
+// DeriveKey 由口令派生 32 字节的密钥，参数来自外部文档，限制上限避免耗尽内存
+func (kdf *PassphraseKdf) DeriveKey(passphrase string) ([]byte, error) {
+	if kdf.Algorithm != PassphraseKdfArgon2id {
+		return nil, fmt.Errorf("unsupported key derivation algorithm %s", kdf.Algorithm)
+	}
+	salt, err := base64.StdEncoding.DecodeString(kdf.Salt)
+	if err != nil || len(salt) < 16 {
+		return nil, errors.New("invalid key derivation salt")
+	}
+	if kdf.Time < 1 || kdf.Time > 10 || kdf.Memory < 8*1024 || kdf.Memory > 1024*1024 || kdf.Threads < 1 || kdf.Threads > 16 {
+		return nil, errors.New("invalid key derivation parameters")
+	}
+	return argon2.IDKey([]byte(passphrase), salt, kdf.Time, kdf.Memory, kdf.Threads, 32), nil
+}
+
+// 信封加密格式：enc:v1:<主密钥标识>:<主密钥加密的数据密钥>:<数据密钥加密的密文>
+const envelopePrefix = "enc:v1:"
+
+// SecretKeyId 返回主密钥的标识，用于识别密文由哪个主密钥加密
+func SecretKeyId(masterKey string) string {
+	sum := sha256.Sum256([]byte("key-id:" + masterKey))
+	return hex.EncodeToString(sum[:4])
+}
+
+// IsEnvelopeEncrypted 判断值是否为 EnvelopeEncrypt 生成的密文
+func IsEnvelopeEncrypted(value string) bool {
+	return strings.HasPrefix(value, envelopePrefix)
+}
+
+// EnvelopeKeyId 返回密文的主密钥标识
+func EnvelopeKeyId(value string) string {
+	keyId, _, _ := strings.Cut(strings.TrimPrefix(value, envelopePrefix), ":")
+	return keyId
+}
+
+// EnvelopeEncrypt 使用随机数据密钥加密明文，数据密钥再由主密钥加密，与密文一起保存
+func EnvelopeEncrypt(plaintext string, masterKey string) (string, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	wrappedKey, err := EncryptWithSecret(string(dataKey), masterKey)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := EncryptWithSecret(plaintext, string(dataKey))
+	if err != nil {
+		return "", err
+	}
+	return envelopePrefix + SecretKeyId(masterKey) + ":" + wrappedKey + ":" + ciphertext, nil
+}
+
+// EnvelopeDecrypt 解密 EnvelopeEncrypt 生成的密文
+func EnvelopeDecrypt(value string, masterKey string) (string, error) {
+	parts := strings.Split(strings.TrimPrefix(value, envelopePrefix), ":")
+	if !IsEnvelopeEncrypted(value) || len(parts) != 3 {
+		return "", errors.New("invalid encrypted secret")
+	}
+	if parts[0] != SecretKeyId(masterKey) {
+		return "", fmt.Errorf("secret was encrypted with another master key (id %s)", parts[0])
+	}
+	dataKey, err := DecryptWithSecret(parts[1], masterKey)
+	if err != nil {
+		return "", err
+	}
+	return DecryptWithSecret(parts[2], dataKey)
+}
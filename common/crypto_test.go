@@ -0,0 +1,128 @@
+package common
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestEncryptWithKey(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	otherKey := bytes.Repeat([]byte{2}, 32)
+	ciphertext, err := EncryptWithKey("sk-secret", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := EncryptWithKey("sk-secret", key)
+	if ciphertext == again {
+		t.Error("nonce reused between encryptions")
+	}
+	data, _ := base64.StdEncoding.DecodeString(ciphertext)
+	data[len(data)-1] ^= 1
+	tampered := base64.StdEncoding.EncodeToString(data)
+
+	tests := []struct {
+		name       string
+		ciphertext string
+		key        []byte
+		want       string
+		wantErr    bool
+	}{
+		{"round trip", ciphertext, key, "sk-secret", false},
+		{"wrong key", ciphertext, otherKey, "", true},
+		{"tampered ciphertext", tampered, key, "", true},
+		{"truncated ciphertext", base64.StdEncoding.EncodeToString([]byte("short")), key, "", true},
+		{"not base64", "%%%", key, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecryptWithKey(tt.ciphertext, tt.key)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("DecryptWithKey() = %q, %v, want %q, error %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPassphraseKdf(t *testing.T) {
+	kdf, err := NewPassphraseKdf()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 测试中降低内存开销
+	kdf.Memory = 8 * 1024
+	key, err := kdf.DeriveKey("passphrase")
+	if err != nil || len(key) != 32 {
+		t.Fatalf("DeriveKey() = %x, %v", key, err)
+	}
+	same, _ := kdf.DeriveKey("passphrase")
+	if !bytes.Equal(key, same) {
+		t.Error("same passphrase and salt derived different keys")
+	}
+	other, _ := kdf.DeriveKey("passphrase2")
+	if bytes.Equal(key, other) {
+		t.Error("different passphrases derived the same key")
+	}
+	otherSalt, _ := NewPassphraseKdf()
+	otherSalt.Memory = kdf.Memory
+	if salted, _ := otherSalt.DeriveKey("passphrase"); bytes.Equal(key, salted) {
+		t.Error("different salts derived the same key")
+	}
+
+	tests := []struct {
+		name   string
+		modify func(kdf *PassphraseKdf)
+	}{
+		{"unknown algorithm", func(kdf *PassphraseKdf) { kdf.Algorithm = "sha256" }},
+		{"short salt", func(kdf *PassphraseKdf) { kdf.Salt = base64.StdEncoding.EncodeToString([]byte("salt")) }},
+		{"invalid salt", func(kdf *PassphraseKdf) { kdf.Salt = "%%%" }},
+		{"too much memory", func(kdf *PassphraseKdf) { kdf.Memory = 4 * 1024 * 1024 }},
+		{"too many iterations", func(kdf *PassphraseKdf) { kdf.Time = 100 }},
+		{"no threads", func(kdf *PassphraseKdf) { kdf.Threads = 0 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invalid := *kdf
+			tt.modify(&invalid)
+			if _, err := invalid.DeriveKey("passphrase"); err == nil {
+				t.Error("invalid parameters accepted")
+			}
+		})
+	}
+}
+
+func TestEnvelopeEncrypt(t *testing.T) {
+	masterKey := "master-key"
+	ciphertext, err := EnvelopeEncrypt("sk-channel", masterKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEnvelopeEncrypted(ciphertext) || strings.Contains(ciphertext, "sk-channel") {
+		t.Fatalf("unexpected ciphertext %q", ciphertext)
+	}
+	if EnvelopeKeyId(ciphertext) != SecretKeyId(masterKey) {
+		t.Errorf("key id = %s, want %s", EnvelopeKeyId(ciphertext), SecretKeyId(masterKey))
+	}
+
+	tests := []struct {
+		name       string
+		ciphertext string
+		masterKey  string
+		want       string
+		wantErr    bool
+	}{
+		{"round trip", ciphertext, masterKey, "sk-channel", false},
+		{"other master key", ciphertext, "other-key", "", true},
+		{"plain value", "sk-channel", masterKey, "", true},
+		{"missing part", ciphertext[:strings.LastIndex(ciphertext, ":")], masterKey, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := EnvelopeDecrypt(tt.ciphertext, tt.masterKey)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("EnvelopeDecrypt() = %q, %v, want %q, error %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -15,6 +16,13 @@ var (
 	PrintVersion = flag.Bool("version", false, "print version and exit")
 	PrintHelp    = flag.Bool("help", false, "print help and exit")
 	LogDir       = flag.String("log-dir", "./logs", "specify the log directory")
+
+	ExportConfig  = flag.String("export-config", "", "export gateway configuration to the file (.yaml or .json) and exit")
+	ImportConfig  = flag.String("import-config", "", "import gateway configuration from the file and exit")
+	ConfigDryRun  = flag.Bool("dry-run", false, "preview the changes of --import-config without applying them")
+	ConfigSecrets = flag.String("config-secrets", "redacted", "how --export-config writes secrets: plain, redacted or encrypted (passphrase from CONFIG_PASSPHRASE)")
+
+	RotateSecretKey = flag.Bool("rotate-secret-key", false, "re-encrypt stored secrets from SECRET_ENCRYPTION_OLD_KEY to SECRET_ENCRYPTION_KEY and exit")
 )
 
 func printHelp() {
@@ -22,6 +30,9 @@ func printHelp() {
 	fmt.Println("Copyright (C) 2023 JustSong. All rights reserved.")
 	fmt.Println("GitHub: https://github.com/songquanpeng/one-api")
 	fmt.Println("Usage: one-api [--port <port>] [--log-dir <log directory>] [--version] [--help]")
+	fmt.Println("       one-api --export-config <file> [--config-secrets plain|redacted|encrypted]")
+	fmt.Println("       one-api --import-config <file> [--dry-run]")
+	fmt.Println("       one-api --rotate-secret-key")
 }
 
 func LoadEnv() {
@@ -55,8 +66,12 @@ func LoadEnv() {
 	if os.Getenv("SQLITE_PATH") != "" {
 		SQLitePath = os.Getenv("SQLITE_PATH")
 	}
+	key, err := LoadSecretKey("SECRET_ENCRYPTION_KEY")
+	if err != nil {
+		log.Fatal(err)
+	}
+	SecretEncryptionKey = key
 	if *LogDir != "" {
-		var err error
 		*LogDir, err = filepath.Abs(*LogDir)
 		if err != nil {
 			log.Fatal(err)
@@ -96,3 +111,18 @@ func LoadEnv() {
 	GlobalWebRateLimitNum = GetEnvOrDefault("GLOBAL_WEB_RATE_LIMIT", 60)
 	GlobalWebRateLimitDuration = int64(GetEnvOrDefault("GLOBAL_WEB_RATE_LIMIT_DURATION", 180))
 }
+
+// LoadSecretKey 从环境变量 name 或 name_FILE 指定的文件读取密钥
+func LoadSecretKey(name string) (string, error) {
+	if key := os.Getenv(name); key != "" {
+		return key, nil
+	}
+	if file := os.Getenv(name + "_FILE"); file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s_FILE: %w", name, err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	return "", nil
+}
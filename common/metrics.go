@@ -0,0 +1,58 @@
+package common
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricsNamespace = "new_api"
+
+var (
+	RelayRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "relay_requests_total",
+		Help:      "Total number of relay attempts to upstream channels.",
+	}, []string{"model", "channel", "group", "status"})
+
+	RelayRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "relay_request_duration_seconds",
+		Help:      "Latency of relay attempts to upstream channels.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20, 30, 60, 120, 300},
+	}, []string{"model", "channel", "group", "status"})
+
+	RelayFirstResponseDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "relay_first_response_seconds",
+		Help:      "Time to first token of streamed relay responses.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2, 3, 5, 10, 20, 30},
+	}, []string{"model", "channel", "group"})
+
+	RelayRetriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "relay_retries_total",
+		Help:      "Total number of channel retries of relay requests.",
+	}, []string{"model", "group"})
+
+	ChannelAutoDisabledTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "channel_auto_disabled_total",
+		Help:      "Total number of channels or channel keys disabled automatically.",
+	}, []string{"channel", "scope"})
+
+	RelayInFlightStreams = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "relay_in_flight_streams",
+		Help:      "Number of streamed relay responses currently being written.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(
+		RelayRequestsTotal,
+		RelayRequestDuration,
+		RelayFirstResponseDuration,
+		RelayRetriesTotal,
+		ChannelAutoDisabledTotal,
+		RelayInFlightStreams,
+	)
+}
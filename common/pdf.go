@@ -0,0 +1,174 @@
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// PDF A4 页面尺寸，单位为点
+const (
+	PDFPageWidth  = 595.0
+	PDFPageHeight = 842.0
+)
+
+// PDFDocument 只包含文本和线条的简单 PDF 文档。Latin-1 文本使用内置的 Helvetica 字体，
+// 包含中日韩等其他字符的文本使用 PDF 规范预定义的 STSong-Light 字体，由阅读器提供字形，无需嵌入字体文件。
+// 基本多文种平面以外的字符（如 emoji）输出为 "?"
+type PDFDocument struct {
+	pages []*bytes.Buffer
+}
+
+func NewPDFDocument() *PDFDocument {
+	return &PDFDocument{}
+}
+
+// AddPage 新增一页，之后的内容写入该页
+func (d *PDFDocument) AddPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+}
+
+func (d *PDFDocument) current() *bytes.Buffer {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+	return d.pages[len(d.pages)-1]
+}
+
+// isPDFLatin1 文本是否可以使用 Helvetica 字体输出
+func isPDFLatin1(text string) bool {
+	for _, r := range text {
+		if r > 0xff {
+			return false
+		}
+	}
+	return true
+}
+
+func pdfEscape(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n' || r == '\r' || r == '\t':
+			b.WriteByte(' ')
+		case r < 0x20 || r > 0xff:
+			b.WriteByte('?')
+		default:
+			// Latin-1 字符按 WinAnsiEncoding 以八进制转义输出
+			if r > 0x7e {
+				b.WriteString(fmt.Sprintf("\\%03o", r))
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	return b.String()
+}
+
+// pdfHexUCS2 将文本编码为 UniGB-UCS2-H 使用的 UCS-2 大端十六进制字符串
+func pdfHexUCS2(text string) string {
+	var b strings.Builder
+	b.WriteByte('<')
+	for _, r := range text {
+		switch {
+		case r == '\n' || r == '\r' || r == '\t':
+			r = ' '
+		case r < 0x20 || r > 0xffff:
+			r = '?'
+		}
+		fmt.Fprintf(&b, "%04X", r)
+	}
+	b.WriteByte('>')
+	return b.String()
+}
+
+// Text 在 (x, y) 处写入文本，坐标原点为页面左上角。中文等字体没有粗体，bold 只对 Latin-1 文本生效
+func (d *PDFDocument) Text(x, y, size float64, bold bool, text string) {
+	if !isPDFLatin1(text) {
+		fmt.Fprintf(d.current(), "BT /F3 %.1f Tf %.2f %.2f Td %s Tj ET\n", size, x, PDFPageHeight-y, pdfHexUCS2(text))
+		return
+	}
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(d.current(), "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, PDFPageHeight-y, pdfEscape(text))
+}
+
+// TextRight 写入右对齐的文本，宽度按平均字宽估算
+func (d *PDFDocument) TextRight(right, y, size float64, bold bool, text string) {
+	d.Text(right-PDFTextWidth(text, size), y, size, bold, text)
+}
+
+// PDFTextWidth 估算文本宽度，Latin-1 字符按 Helvetica 平均字宽，其他字符按全角计算
+func PDFTextWidth(text string, size float64) float64 {
+	width := 0.0
+	for _, r := range text {
+		if r > 0xff {
+			width += size
+		} else {
+			width += size * 0.52
+		}
+	}
+	return width
+}
+
+// PDFTruncate 截断超出宽度的文本并以 "..." 结尾
+func PDFTruncate(text string, size float64, maxWidth float64) string {
+	if PDFTextWidth(text, size) <= maxWidth {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 && PDFTextWidth(string(runes)+"...", size) > maxWidth {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "..."
+}
+
+// Line 画一条细线
+func (d *PDFDocument) Line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(d.current(), "0.5 w %.2f %.2f m %.2f %.2f l S\n", x1, PDFPageHeight-y1, x2, PDFPageHeight-y2)
+}
+
+// Bytes 生成 PDF 文件内容
+func (d *PDFDocument) Bytes() []byte {
+	d.current()
+	var out bytes.Buffer
+	var offsets []int
+	writeObject := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	out.WriteString("%PDF-1.4\n")
+	// 对象编号：1 目录，2 页面树，3、4 字体，5 至 7 中文字体及其字体描述，之后每页依次为页面和内容流
+	pageCount := len(d.pages)
+	kids := make([]string, pageCount)
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 8+i*2)
+	}
+	writeObject("<< /Type /Catalog /Pages 2 0 R >>")
+	writeObject(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), pageCount))
+	writeObject("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	writeObject("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	writeObject("<< /Type /Font /Subtype /Type0 /BaseFont /STSong-Light /Encoding /UniGB-UCS2-H /DescendantFonts [6 0 R] >>")
+	// CID 1 至 95 为半角 ASCII 字形，其余按全角宽度
+	writeObject("<< /Type /Font /Subtype /CIDFontType0 /BaseFont /STSong-Light " +
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (GB1) /Supplement 2 >> /FontDescriptor 7 0 R /DW 1000 /W [1 95 500] >>")
+	writeObject("<< /Type /FontDescriptor /FontName /STSong-Light /Flags 6 /FontBBox [-25 -254 1000 880] " +
+		"/ItalicAngle 0 /Ascent 880 /Descent -120 /CapHeight 880 /StemV 93 >>")
+	for i, page := range d.pages {
+		writeObject(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R /F2 4 0 R /F3 5 0 R >> >> /Contents %d 0 R >>",
+			PDFPageWidth, PDFPageHeight, 9+i*2))
+		writeObject(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", page.Len(), page.String()))
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
@@ -0,0 +1,86 @@
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPDFText(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		bold bool
+		want string
+	}{
+		{"latin", "Total (USD)", false, `/F1 9.0 Tf 10.00 832.00 Td (Total \(USD\)) Tj`},
+		{"latin bold", "Café", true, `/F2 9.0 Tf 10.00 832.00 Td (Caf\351) Tj`},
+		{"chinese", "账单 A1", false, `/F3 9.0 Tf 10.00 832.00 Td <8D265355002000410031> Tj`},
+		{"chinese ignores bold", "中文", true, `/F3 9.0 Tf 10.00 832.00 Td <4E2D6587> Tj`},
+		{"outside bmp", "好😀", false, `/F3 9.0 Tf 10.00 832.00 Td <597D003F> Tj`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewPDFDocument()
+			d.Text(10, 10, 9, tt.bold, tt.text)
+			if got := d.current().String(); !strings.Contains(got, tt.want) {
+				t.Errorf("content = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPDFTruncate(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		maxWidth float64
+		want     string
+	}{
+		{"fits", "gpt-4o", 100, "gpt-4o"},
+		{"latin", "abcdefghijklmnopqrstuvwxyz", 10*0.52*10 + 0.01, "abcdefg..."},
+		{"full width", "一二三四五六七八九十", 10*4 + 10*0.52*3 + 0.01, "一二三四..."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := PDFTruncate(tt.text, 10, tt.maxWidth)
+			if got != tt.want {
+				t.Errorf("PDFTruncate = %q, want %q", got, tt.want)
+			}
+			if PDFTextWidth(got, 10) > tt.maxWidth+0.001 {
+				t.Errorf("width %.2f exceeds %.2f", PDFTextWidth(got, 10), tt.maxWidth)
+			}
+		})
+	}
+}
+
+func TestPDFBytesXref(t *testing.T) {
+	d := NewPDFDocument()
+	d.Text(50, 50, 12, true, "STATEMENT")
+	d.AddPage()
+	d.Text(50, 50, 9, false, "组织：测试")
+	data := d.Bytes()
+	if !bytes.Contains(data, []byte("/BaseFont /STSong-Light /Encoding /UniGB-UCS2-H")) {
+		t.Fatal("CJK font missing")
+	}
+	match := regexp.MustCompile(`xref\n0 (\d+)\n`).FindSubmatchIndex(data)
+	if match == nil {
+		t.Fatal("xref missing")
+	}
+	count, _ := strconv.Atoi(string(data[match[2]:match[3]]))
+	// 目录、页面树、2 个 Helvetica 字体、3 个中文字体对象和每页 2 个对象，另有 0 号空闲对象
+	if count != 1+7+2*2 {
+		t.Fatalf("xref size = %d", count)
+	}
+	entries := strings.Split(string(data[match[1]:]), "\n")[1:count]
+	for i, entry := range entries {
+		offset, _ := strconv.Atoi(entry[:10])
+		prefix := fmt.Sprintf("%d 0 obj", i+1)
+		if !bytes.HasPrefix(data[offset:], []byte(prefix)) {
+			t.Errorf("object %d offset %d points to %q", i+1, offset, data[offset:offset+10])
+		}
+	}
+}
@@ -1,21 +1,32 @@
 package common
 
 import (
+	"math"
 	"sync"
 	"time"
 )
 
 type InMemoryRateLimiter struct {
 	store              map[string]*[]int64
+	buckets            map[string]*tokenBucket
+	concurrency        map[string]int
 	mutex              sync.Mutex
 	expirationDuration time.Duration
 }
 
+// tokenBucket 令牌桶，tokens 可以为负数，表示预估用量不足后补扣的部分
+type tokenBucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
 func (l *InMemoryRateLimiter) Init(expirationDuration time.Duration) {
 	if l.store == nil {
 		l.mutex.Lock()
 		if l.store == nil {
 			l.store = make(map[string]*[]int64)
+			l.buckets = make(map[string]*tokenBucket)
+			l.concurrency = make(map[string]int)
 			l.expirationDuration = expirationDuration
 			if expirationDuration > 0 {
 				go l.clearExpiredItems()
@@ -37,6 +48,11 @@ func (l *InMemoryRateLimiter) clearExpiredItems() {
 				delete(l.store, key)
 			}
 		}
+		for key, bucket := range l.buckets {
+			if time.Since(bucket.updatedAt) > l.expirationDuration {
+				delete(l.buckets, key)
+			}
+		}
 		l.mutex.Unlock()
 	}
 }
@@ -68,3 +84,48 @@ func (l *InMemoryRateLimiter) Request(key string, maxRequestNum int, duration in
 	}
 	return true
 }
+
+// TakeTokens 从令牌桶中扣除 n 个令牌，令牌桶容量为 capacity，每个 window 补满一次；
+// 桶中至少有一个令牌时才允许请求，force 为 true 时无论余量都扣除（n 为负数时返还令牌），
+// 返回是否允许以及扣除后的余量
+func (l *InMemoryRateLimiter) TakeTokens(key string, capacity int64, window time.Duration, n int64, force bool) (bool, float64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := time.Now()
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(capacity), updatedAt: now}
+		l.buckets[key] = bucket
+	}
+	rate := float64(capacity) / window.Seconds()
+	bucket.tokens = math.Min(float64(capacity), bucket.tokens+now.Sub(bucket.updatedAt).Seconds()*rate)
+	bucket.updatedAt = now
+	if !force && bucket.tokens < 1 {
+		return false, bucket.tokens
+	}
+	// 返还的令牌不超过容量
+	bucket.tokens = math.Min(float64(capacity), bucket.tokens-float64(n))
+	return true, bucket.tokens
+}
+
+// Acquire 占用一个并发名额，超过 max 时返回 false
+func (l *InMemoryRateLimiter) Acquire(key string, max int) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.concurrency[key] >= max {
+		return false
+	}
+	l.concurrency[key]++
+	return true
+}
+
+// Release 释放 Acquire 占用的并发名额
+func (l *InMemoryRateLimiter) Release(key string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.concurrency[key] <= 1 {
+		delete(l.concurrency, key)
+		return
+	}
+	l.concurrency[key]--
+}
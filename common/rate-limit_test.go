@@ -0,0 +1,70 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInMemoryRateLimiterTakeTokens(t *testing.T) {
+	var l InMemoryRateLimiter
+	l.Init(0)
+	type take struct {
+		n         int64
+		force     bool
+		allowed   bool
+		remaining float64
+	}
+	tests := []struct {
+		name  string
+		takes []take
+	}{
+		{"drains to empty", []take{{1, false, true, 2}, {1, false, true, 1}, {1, false, true, 0}, {1, false, false, 0}}},
+		{"allowed with one token left even if n is larger", []take{{2, false, true, 1}, {5, false, true, -4}, {1, false, false, -4}}},
+		{"refund with negative n", []take{{3, false, true, 0}, {-2, true, true, 2}, {1, false, true, 1}}},
+		{"refill is capped at capacity", []take{{-10, true, true, 3}}},
+		{"force charges an empty bucket", []take{{3, false, true, 0}, {2, true, true, -2}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 窗口足够长，测试期间补充的令牌可以忽略
+			for i, tk := range tt.takes {
+				allowed, remaining := l.TakeTokens(tt.name, 3, time.Hour*1000, tk.n, tk.force)
+				if allowed != tk.allowed || remaining < tk.remaining-0.01 || remaining > tk.remaining+0.01 {
+					t.Errorf("take %d = (%v, %.3f), want (%v, %.3f)", i, allowed, remaining, tk.allowed, tk.remaining)
+				}
+			}
+		})
+	}
+}
+
+func TestInMemoryRateLimiterRefill(t *testing.T) {
+	var l InMemoryRateLimiter
+	l.Init(0)
+	l.TakeTokens("k", 10, time.Second, 10, false)
+	l.buckets["k"].updatedAt = l.buckets["k"].updatedAt.Add(-500 * time.Millisecond)
+	allowed, remaining := l.TakeTokens("k", 10, time.Second, 1, false)
+	if !allowed || remaining < 3.9 || remaining > 4.2 {
+		t.Errorf("after half window = (%v, %.3f), want about 4", allowed, remaining)
+	}
+}
+
+func TestInMemoryRateLimiterConcurrency(t *testing.T) {
+	var l InMemoryRateLimiter
+	l.Init(0)
+	if !l.Acquire("k", 2) || !l.Acquire("k", 2) {
+		t.Fatal("acquire within limit failed")
+	}
+	if l.Acquire("k", 2) {
+		t.Fatal("acquire over limit succeeded")
+	}
+	l.Release("k")
+	if !l.Acquire("k", 2) {
+		t.Fatal("acquire after release failed")
+	}
+	l.Release("k")
+	l.Release("k")
+	l.Release("k")
+	if _, ok := l.concurrency["k"]; ok {
+		t.Error("released key not removed")
+	}
+}
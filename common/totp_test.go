@@ -0,0 +1,32 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidateTOTP(t *testing.T) {
+	// RFC 6238 附录 B 的 SHA1 测试密钥 "12345678901234567890"
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	tests := []struct {
+		name   string
+		code   string
+		now    int64
+		step   int64
+		wantOk bool
+	}{
+		{"current step", "287082", 59, 1, true},
+		{"previous step within skew", "287082", 59 + 30, 1, true},
+		{"outside skew", "287082", 59 + 90, 0, false},
+		{"wrong code", "287083", 59, 0, false},
+		{"wrong length", "28708", 59, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := ValidateTOTP(secret, tt.code, time.Unix(tt.now, 0))
+			if ok != tt.wantOk || step != tt.step {
+				t.Errorf("ValidateTOTP = (%d, %v), want (%d, %v)", step, ok, tt.step, tt.wantOk)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package common
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const TracerName = "one-api"
+
+// InitTracing 根据环境变量初始化 OTLP 链路追踪，OTEL_ENABLED 未开启时使用空实现。
+// 导出地址、采样率等使用 OpenTelemetry 标准环境变量配置，例如
+// OTEL_EXPORTER_OTLP_ENDPOINT=http://localhost:4318、OTEL_TRACES_SAMPLER=parentbased_traceidratio
+func InitTracing() func() {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if !GetEnvOrDefaultBool("OTEL_ENABLED", false) {
+		return func() {}
+	}
+	ctx := context.Background()
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		SysError("failed to create OTLP trace exporter: " + err.Error())
+		return func() {}
+	}
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName("new-api"), semconv.ServiceVersion(Version)),
+		resource.WithFromEnv(),
+		resource.WithHost(),
+	)
+	if err != nil {
+		SysError("failed to create trace resource: " + err.Error())
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	SysLog("OpenTelemetry tracing enabled")
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := provider.Shutdown(ctx); err != nil {
+			SysError("failed to shutdown tracer provider: " + err.Error())
+		}
+	}
+}
+
+// StartSpan 在 ctx 下创建子 span
+func StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(TracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// EndSpan 结束 span，err 不为空时标记为错误
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -7,4 +7,12 @@ const (
 	ContextKeyUserStatus       = "user_status"
 	ContextKeyUserEmail        = "user_email"
 	ContextKeyUserGroup        = "user_group"
+	// ContextKeyBatchId 批处理执行器发起的请求，写入 request context
+	ContextKeyBatchId = "batch_id"
+	// ContextKeyFallbackPath 发生模型降级时依次尝试过的模型，最后一个为实际使用的模型
+	ContextKeyFallbackPath = "fallback_path"
+	// ContextKeyNoChannelMessage 分发时原始模型没有可用渠道但配置了降级链，由 relay 在尝试降级模型前作为原始模型的错误返回
+	ContextKeyNoChannelMessage = "no_channel_message"
+	// ContextKeyConsumedTokens 本次请求实际消耗的 token 数，记录消费日志时写入，用于校正 TPM 限流
+	ContextKeyConsumedTokens = "consumed_tokens"
 )
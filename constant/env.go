@@ -16,6 +16,11 @@ var GeminiVisionMaxImageNum int
 var NotifyLimitCount int
 var NotificationLimitDurationMinute int
 var GenerateDefaultToken bool
+var MaxUploadFileMB int
+var BatchConcurrency int
+var MetricsToken string
+var TaskTimeoutMinutes int
+var FakePaymentSecret string
 
 //var GeminiModelMap = map[string]string{
 //	"gemini-1.0-pro": "v1",
@@ -36,6 +41,16 @@ func InitEnv() {
 	NotificationLimitDurationMinute = common.GetEnvOrDefault("NOTIFICATION_LIMIT_DURATION_MINUTE", 10)
 	// GenerateDefaultToken 是否生成初始令牌，默认关闭。
 	GenerateDefaultToken = common.GetEnvOrDefaultBool("GENERATE_DEFAULT_TOKEN", false)
+	// MaxUploadFileMB 通过 /v1/files 上传文件的大小上限
+	MaxUploadFileMB = common.GetEnvOrDefault("MAX_UPLOAD_FILE_MB", 100)
+	// BatchConcurrency 网关批处理执行器单个批次的并发请求数
+	BatchConcurrency = common.GetEnvOrDefault("BATCH_CONCURRENCY", 4)
+	// MetricsToken 访问 /metrics 的 Bearer 密钥，未设置时只允许管理员访问
+	MetricsToken = common.GetEnvOrDefaultString("METRICS_TOKEN", "")
+	// TaskTimeoutMinutes 异步任务提交后超过该时间仍未完成则判定失败并退还额度
+	TaskTimeoutMinutes = common.GetEnvOrDefault("TASK_TIMEOUT_MINUTES", 1440)
+	// FakePaymentSecret 设置后启用本地模拟支付渠道，仅用于开发和测试
+	FakePaymentSecret = common.GetEnvOrDefaultString("FAKE_PAYMENT_SECRET", "")
 
 	//modelVersionMapStr := strings.TrimSpace(os.Getenv("GEMINI_MODEL_MAP"))
 	//if modelVersionMapStr == "" {
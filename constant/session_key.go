@@ -0,0 +1,9 @@
+package constant
+
+// 登录会话中保存的两步验证状态
+const (
+	// SessionKeyPendingTwoFactorUserId 密码或第三方登录成功、等待两步验证的用户
+	SessionKeyPendingTwoFactorUserId = "pending_2fa_user_id"
+	// SessionKeyTwoFactorVerifiedAt 最近一次完成两步验证的时间戳，敏感操作据此判断是否需要重新验证
+	SessionKeyTwoFactorVerifiedAt = "2fa_verified_at"
+)
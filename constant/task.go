@@ -5,6 +5,10 @@ type TaskPlatform string
 const (
 	TaskPlatformSuno       TaskPlatform = "suno"
 	TaskPlatformMidjourney              = "mj"
+	TaskPlatformBatch                   = "batch"
+	TaskPlatformKling                   = "kling"
+	TaskPlatformRunway                  = "runway"
+	TaskPlatformLuma                    = "luma"
 )
 
 const (
@@ -12,6 +16,12 @@ const (
 	SunoActionLyrics = "LYRICS"
 )
 
+// 视频生成任务类型，根据请求是否带有首帧图片区分
+const (
+	VideoActionText2Video  = "TEXT2VIDEO"
+	VideoActionImage2Video = "IMAGE2VIDEO"
+)
+
 var SunoModel2Action = map[string]string{
 	"suno_music":  SunoActionMusic,
 	"suno_lyrics": SunoActionLyrics,
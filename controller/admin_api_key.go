@@ -0,0 +1,226 @@
+package controller
+
+import (
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetAdminApiKeys(c *gin.Context) {
+	keys, err := model.GetUserAdminApiKeys(c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    keys,
+	})
+}
+
+func GetAdminApiKeyScopes(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    model.AdminApiKeyScopes,
+	})
+}
+
+func AddAdminApiKey(c *gin.Context) {
+	apiKey := model.AdminApiKey{}
+	err := c.ShouldBindJSON(&apiKey)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if apiKey.Name == "" || len(apiKey.Name) > 64 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "密钥名称不能为空且不能超过 64 个字符",
+		})
+		return
+	}
+	scopes, err := model.ValidateAdminApiKeyScopes(apiKey.Scopes)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	allowIps, err := model.ValidateAdminApiKeyAllowIps(apiKey.AllowIps)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	key, err := common.GenerateKey()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "生成密钥失败",
+		})
+		common.SysError("failed to generate admin api key: " + err.Error())
+		return
+	}
+	expiredTime := apiKey.ExpiredTime
+	if expiredTime == 0 {
+		expiredTime = -1
+	}
+	key = model.AdminApiKeyPrefix + key
+	cleanKey := model.AdminApiKey{
+		UserId:       c.GetInt("id"),
+		Name:         apiKey.Name,
+		Key:          model.HashAdminApiKey(key),
+		MaskedKey:    model.MaskAdminApiKey(key),
+		Scopes:       scopes,
+		Status:       common.TokenStatusEnabled,
+		ExpiredTime:  expiredTime,
+		AllowIps:     allowIps,
+		CreatedTime:  common.GetTimestamp(),
+		AccessedTime: common.GetTimestamp(),
+	}
+	err = cleanKey.Insert()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	// 完整密钥只在创建时返回一次
+	cleanKey.MaskedKey = key
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    cleanKey,
+	})
+}
+
+func UpdateAdminApiKey(c *gin.Context) {
+	apiKey := model.AdminApiKey{}
+	err := c.ShouldBindJSON(&apiKey)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	cleanKey, err := model.GetAdminApiKeyByIds(apiKey.Id, c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	scopes, err := model.ValidateAdminApiKeyScopes(apiKey.Scopes)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if apiKey.Name == "" || len(apiKey.Name) > 64 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "密钥名称不能为空且不能超过 64 个字符",
+		})
+		return
+	}
+	cleanKey.Name = apiKey.Name
+	cleanKey.Scopes = scopes
+	cleanKey.Status = apiKey.Status
+	cleanKey.ExpiredTime = apiKey.ExpiredTime
+	if cleanKey.ExpiredTime == 0 {
+		cleanKey.ExpiredTime = -1
+	}
+	cleanKey.AllowIps, err = model.ValidateAdminApiKeyAllowIps(apiKey.AllowIps)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	err = cleanKey.Update()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    cleanKey,
+	})
+}
+
+func DeleteAdminApiKey(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	err := model.DeleteAdminApiKeyById(id, c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+func GetAdminApiKeyLogs(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if _, err := model.GetAdminApiKeyByIds(id, c.GetInt("id")); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	p, _ := strconv.Atoi(c.Query("p"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	if p < 1 {
+		p = 1
+	}
+	if pageSize <= 0 || pageSize > 100 {
+		pageSize = common.ItemsPerPage
+	}
+	logs, total, err := model.GetAdminApiKeyLogs(id, (p-1)*pageSize, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"items":     logs,
+			"total":     total,
+			"page":      p,
+			"page_size": pageSize,
+		},
+	})
+}
@@ -0,0 +1,219 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/dto"
+	"one-api/model"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	batchCompletionWindow = "24h"
+	// batchCancelledReason 写入 Task.FailReason，作为取消批处理的标记，由执行器在下一轮检查时处理
+	batchCancelledReason = "cancelled"
+)
+
+var supportedBatchEndpoints = map[string]bool{
+	"/v1/chat/completions": true,
+	"/v1/completions":      true,
+	"/v1/embeddings":       true,
+	"/v1/responses":        true,
+}
+
+// batchTaskData 存储在 Task.Data 中的批处理状态
+type batchTaskData struct {
+	dto.Batch
+	ClientIp string `json:"client_ip"`
+}
+
+func getBatchTaskData(task *model.Task) (*batchTaskData, error) {
+	data := &batchTaskData{}
+	if err := common.DecodeJson(task.Data, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// batchView 返回给用户的批处理对象
+func batchView(task *model.Task) (dto.Batch, error) {
+	data, err := getBatchTaskData(task)
+	if err != nil {
+		return dto.Batch{}, err
+	}
+	batch := data.Batch
+	if task.FailReason == batchCancelledReason && !isBatchFinished(batch.Status) {
+		batch.Status = dto.BatchStatusCancelling
+	}
+	return batch, nil
+}
+
+func isBatchFinished(status string) bool {
+	switch status {
+	case dto.BatchStatusCompleted, dto.BatchStatusFailed, dto.BatchStatusExpired, dto.BatchStatusCancelled:
+		return true
+	}
+	return false
+}
+
+func CreateBatch(c *gin.Context) {
+	var request dto.BatchRequest
+	if err := common.UnmarshalBodyReusable(c, &request); err != nil {
+		openAIErrorJSON(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if !supportedBatchEndpoints[request.Endpoint] {
+		openAIErrorJSON(c, http.StatusBadRequest, "invalid_endpoint", fmt.Sprintf("unsupported endpoint: %s", request.Endpoint))
+		return
+	}
+	if request.CompletionWindow != batchCompletionWindow {
+		openAIErrorJSON(c, http.StatusBadRequest, "invalid_completion_window", "completion_window must be 24h")
+		return
+	}
+	userId := c.GetInt("id")
+	tokenId := c.GetInt("token_id")
+	file, err := model.GetUserFileById(request.InputFileID, userId, tokenId)
+	if err != nil {
+		openAIErrorJSON(c, http.StatusBadRequest, "invalid_input_file", fmt.Sprintf("No such File object: %s", request.InputFileID))
+		return
+	}
+	if file.Purpose != dto.FilePurposeBatch {
+		openAIErrorJSON(c, http.StatusBadRequest, "invalid_input_file", "input file purpose must be batch")
+		return
+	}
+
+	now := time.Now()
+	data := &batchTaskData{
+		Batch: dto.Batch{
+			ID:               "batch_" + common.GetUUID(),
+			Object:           "batch",
+			Endpoint:         request.Endpoint,
+			InputFileID:      request.InputFileID,
+			CompletionWindow: request.CompletionWindow,
+			Status:           dto.BatchStatusValidating,
+			CreatedAt:        now.Unix(),
+			ExpiresAt:        common.GetPointer(now.Add(24 * time.Hour).Unix()),
+			Metadata:         request.Metadata,
+		},
+		ClientIp: c.ClientIP(),
+	}
+	task := &model.Task{
+		TaskID:     data.ID,
+		Platform:   constant.TaskPlatformBatch,
+		UserId:     userId,
+		TokenId:    tokenId,
+		Action:     request.Endpoint,
+		Status:     model.TaskStatusNotStart,
+		SubmitTime: now.Unix(),
+		Progress:   "0%",
+		Properties: model.Properties{Input: request.InputFileID},
+	}
+	task.SetData(data)
+	if err := task.Insert(); err != nil {
+		common.LogError(c, "failed to create batch: "+err.Error())
+		openAIErrorJSON(c, http.StatusInternalServerError, "create_batch_failed", "failed to create batch")
+		return
+	}
+	c.JSON(http.StatusOK, data.Batch)
+}
+
+func RetrieveBatch(c *gin.Context) {
+	task, exist, err := model.GetTokenTaskByTaskId(constant.TaskPlatformBatch, c.GetInt("id"), c.GetInt("token_id"), c.Param("id"))
+	if err != nil {
+		openAIErrorJSON(c, http.StatusInternalServerError, "get_batch_failed", err.Error())
+		return
+	}
+	if !exist {
+		openAIErrorJSON(c, http.StatusNotFound, "batch_not_found", fmt.Sprintf("No such Batch object: %s", c.Param("id")))
+		return
+	}
+	batch, err := batchView(task)
+	if err != nil {
+		openAIErrorJSON(c, http.StatusInternalServerError, "get_batch_failed", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, batch)
+}
+
+func ListBatches(c *gin.Context) {
+	userId := c.GetInt("id")
+	tokenId := c.GetInt("token_id")
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	var afterId int64
+	if after := c.Query("after"); after != "" {
+		task, exist, err := model.GetTokenTaskByTaskId(constant.TaskPlatformBatch, userId, tokenId, after)
+		if err != nil || !exist {
+			openAIErrorJSON(c, http.StatusBadRequest, "invalid_after", fmt.Sprintf("No such Batch object: %s", after))
+			return
+		}
+		afterId = task.ID
+	}
+	// 多取一条用于判断是否还有更多数据
+	tasks, err := model.GetTokenTasks(constant.TaskPlatformBatch, userId, tokenId, afterId, limit+1)
+	if err != nil {
+		openAIErrorJSON(c, http.StatusInternalServerError, "list_batches_failed", err.Error())
+		return
+	}
+	list := dto.BatchList{
+		Object: "list",
+		Data:   make([]dto.Batch, 0, len(tasks)),
+	}
+	if len(tasks) > limit {
+		list.HasMore = true
+		tasks = tasks[:limit]
+	}
+	for _, task := range tasks {
+		batch, err := batchView(task)
+		if err != nil {
+			continue
+		}
+		list.Data = append(list.Data, batch)
+	}
+	if len(list.Data) > 0 {
+		list.FirstID = list.Data[0].ID
+		list.LastID = list.Data[len(list.Data)-1].ID
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func CancelBatch(c *gin.Context) {
+	task, exist, err := model.GetTokenTaskByTaskId(constant.TaskPlatformBatch, c.GetInt("id"), c.GetInt("token_id"), c.Param("id"))
+	if err != nil {
+		openAIErrorJSON(c, http.StatusInternalServerError, "get_batch_failed", err.Error())
+		return
+	}
+	if !exist {
+		openAIErrorJSON(c, http.StatusNotFound, "batch_not_found", fmt.Sprintf("No such Batch object: %s", c.Param("id")))
+		return
+	}
+	batch, err := batchView(task)
+	if err != nil {
+		openAIErrorJSON(c, http.StatusInternalServerError, "get_batch_failed", err.Error())
+		return
+	}
+	if isBatchFinished(batch.Status) {
+		openAIErrorJSON(c, http.StatusConflict, "batch_not_cancellable", fmt.Sprintf("Cannot cancel a batch with status %s", batch.Status))
+		return
+	}
+	if batch.Status != dto.BatchStatusCancelling {
+		// 只写入取消标记，批处理状态由执行器统一更新，避免与执行器的进度写入互相覆盖
+		err = model.TaskBulkUpdateByID([]int64{task.ID}, map[string]any{
+			"fail_reason": batchCancelledReason,
+		})
+		if err != nil {
+			openAIErrorJSON(c, http.StatusInternalServerError, "cancel_batch_failed", err.Error())
+			return
+		}
+		batch.Status = dto.BatchStatusCancelling
+		batch.CancellingAt = common.GetPointer(common.GetTimestamp())
+	}
+	c.JSON(http.StatusOK, batch)
+}
@@ -0,0 +1,488 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/dto"
+	"one-api/model"
+	"one-api/service"
+	"sync"
+	"time"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// batchRelayHandler 网关自身的 HTTP 处理器，批处理的每一行都通过它走完整的中继流程（鉴权、计费、日志）
+var batchRelayHandler http.Handler
+
+// runningBatches 正在当前节点执行的批处理，key 为 Task.ID
+var runningBatches sync.Map
+
+const batchCheckpointInterval = 10 * time.Second
+
+func SetBatchRelayHandler(handler http.Handler) {
+	batchRelayHandler = handler
+}
+
+// UpdateBatchTaskAll 由任务轮询调用，为尚未在本节点执行的批处理启动执行器。
+// 执行器重启后跳过 BatchResult 中已有结果的行继续执行
+func UpdateBatchTaskAll(ctx context.Context, taskM map[string]*model.Task) error {
+	if batchRelayHandler == nil {
+		return nil
+	}
+	for _, task := range taskM {
+		if _, running := runningBatches.LoadOrStore(task.ID, true); running {
+			continue
+		}
+		task := task
+		gopool.Go(func() {
+			defer runningBatches.Delete(task.ID)
+			executor, err := newBatchExecutor(task)
+			if err != nil {
+				common.LogError(ctx, fmt.Sprintf("batch %s init failed: %s", task.TaskID, err.Error()))
+				return
+			}
+			executor.run(ctx)
+		})
+	}
+	return nil
+}
+
+type batchExecutor struct {
+	task       *model.Task
+	data       *batchTaskData
+	token      *model.Token
+	outputFile *model.File
+	errorFile  *model.File
+}
+
+func newBatchExecutor(task *model.Task) (*batchExecutor, error) {
+	data, err := getBatchTaskData(task)
+	if err != nil {
+		return nil, err
+	}
+	return &batchExecutor{
+		task: task,
+		data: data,
+	}, nil
+}
+
+func (e *batchExecutor) run(ctx context.Context) {
+	token, err := model.GetTokenById(e.task.TokenId)
+	if err != nil {
+		e.fail("token_not_found", "the token that created this batch no longer exists")
+		return
+	}
+	e.token = token
+
+	inputFile, err := model.GetUserFileContentById(e.data.InputFileID, e.task.UserId, e.task.TokenId)
+	if err != nil {
+		e.fail("input_file_not_found", fmt.Sprintf("No such File object: %s", e.data.InputFileID))
+		return
+	}
+	lines, batchErrors := parseBatchInput(inputFile.Content, e.data.Endpoint)
+	if len(batchErrors) > 0 {
+		e.data.Errors = &dto.BatchErrors{Object: "list", Data: batchErrors}
+		e.finish(dto.BatchStatusFailed)
+		return
+	}
+
+	if e.data.Status == dto.BatchStatusValidating {
+		if err := e.start(len(lines)); err != nil {
+			common.LogError(ctx, fmt.Sprintf("batch %s start failed: %s", e.task.TaskID, err.Error()))
+			return
+		}
+	} else if err := e.resume(); err != nil {
+		common.LogError(ctx, fmt.Sprintf("batch %s resume failed: %s", e.task.TaskID, err.Error()))
+		return
+	}
+
+	pending, err := e.pendingLines(len(lines))
+	if err != nil {
+		common.LogError(ctx, fmt.Sprintf("batch %s load results failed: %s", e.task.TaskID, err.Error()))
+		return
+	}
+
+	concurrency := constant.BatchConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	lastCheckpoint := time.Now()
+	for len(pending) > 0 {
+		if e.isCancelled() {
+			e.finish(dto.BatchStatusCancelled)
+			return
+		}
+		if e.data.ExpiresAt != nil && time.Now().Unix() > *e.data.ExpiresAt {
+			results := make([]dto.BatchOutputLine, len(pending))
+			for i, lineIndex := range pending {
+				results[i] = dto.BatchOutputLine{
+					ID:       "batch_req_" + common.GetUUID(),
+					CustomID: lines[lineIndex].CustomID,
+					Error:    &dto.BatchError{Code: "batch_expired", Message: "This request could not be executed before the completion window expired."},
+				}
+			}
+			if err := e.saveResults(pending, results); err != nil {
+				common.LogError(ctx, fmt.Sprintf("batch %s save results failed: %s", e.task.TaskID, err.Error()))
+				return
+			}
+			e.finish(dto.BatchStatusExpired)
+			return
+		}
+
+		chunk := pending[:min(concurrency, len(pending))]
+		results := make([]dto.BatchOutputLine, len(chunk))
+		var wg sync.WaitGroup
+		for i, lineIndex := range chunk {
+			wg.Add(1)
+			i, lineIndex := i, lineIndex
+			gopool.Go(func() {
+				defer wg.Done()
+				results[i] = e.execute(ctx, lines[lineIndex])
+			})
+		}
+		wg.Wait()
+		// 保存失败时退出，下一轮任务轮询会重新启动执行器并重试这些行
+		if err := e.saveResults(chunk, results); err != nil {
+			common.LogError(ctx, fmt.Sprintf("batch %s save results failed: %s", e.task.TaskID, err.Error()))
+			return
+		}
+		pending = pending[len(chunk):]
+
+		if time.Since(lastCheckpoint) > batchCheckpointInterval {
+			if err := e.checkpoint(); err != nil {
+				common.LogError(ctx, fmt.Sprintf("batch %s checkpoint failed: %s", e.task.TaskID, err.Error()))
+			}
+			lastCheckpoint = time.Now()
+		}
+	}
+	e.finish(dto.BatchStatusCompleted)
+}
+
+// parseBatchInput 解析并校验输入文件，返回所有请求行或校验错误
+func parseBatchInput(content []byte, endpoint string) ([]dto.BatchInputLine, []dto.BatchError) {
+	lines := make([]dto.BatchInputLine, 0)
+	batchErrors := make([]dto.BatchError, 0)
+	customIds := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 64*1024), len(content)+1)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		lineErr := func(code string, message string) {
+			batchErrors = append(batchErrors, dto.BatchError{Code: code, Message: message, Line: common.GetPointer(lineNum)})
+		}
+		var line dto.BatchInputLine
+		if err := common.DecodeJson(raw, &line); err != nil {
+			lineErr("invalid_json_line", "This line is not parseable as valid JSON.")
+			continue
+		}
+		if line.CustomID == "" {
+			lineErr("missing_required_parameter", "Missing required parameter: custom_id.")
+			continue
+		}
+		if customIds[line.CustomID] {
+			lineErr("duplicate_custom_id", fmt.Sprintf("The custom_id %s is duplicated.", line.CustomID))
+			continue
+		}
+		customIds[line.CustomID] = true
+		if line.Method != http.MethodPost {
+			lineErr("invalid_method", "Only POST method is supported.")
+			continue
+		}
+		if line.URL != endpoint {
+			lineErr("mismatched_endpoint", fmt.Sprintf("The URL %s does not match the batch endpoint %s.", line.URL, endpoint))
+			continue
+		}
+		if len(line.Body) == 0 {
+			lineErr("missing_required_parameter", "Missing required parameter: body.")
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		batchErrors = append(batchErrors, dto.BatchError{Code: "invalid_file", Message: err.Error()})
+	}
+	if len(lines) == 0 && len(batchErrors) == 0 {
+		batchErrors = append(batchErrors, dto.BatchError{Code: "empty_file", Message: "The input file is empty."})
+	}
+	return lines, batchErrors
+}
+
+// start 批处理校验通过，创建输出文件和错误文件并进入执行状态
+func (e *batchExecutor) start(total int) error {
+	now := common.GetTimestamp()
+	e.outputFile = e.newResultFile("batch_output.jsonl")
+	if err := e.outputFile.Insert(); err != nil {
+		return err
+	}
+	e.errorFile = e.newResultFile("batch_errors.jsonl")
+	if err := e.errorFile.Insert(); err != nil {
+		return err
+	}
+	e.data.Status = dto.BatchStatusInProgress
+	e.data.InProgressAt = &now
+	e.data.OutputFileID = &e.outputFile.FileId
+	e.data.ErrorFileID = &e.errorFile.FileId
+	e.data.RequestCounts = dto.BatchRequestCounts{Total: total}
+	e.task.SetData(e.data)
+	return model.TaskBulkUpdateByID([]int64{e.task.ID}, map[string]any{
+		"status":     model.TaskStatusInProgress,
+		"start_time": now,
+		"data":       e.task.Data,
+	})
+}
+
+// resume 从上次保存的进度继续执行
+func (e *batchExecutor) resume() error {
+	if e.data.OutputFileID == nil || e.data.ErrorFileID == nil {
+		return fmt.Errorf("result files missing")
+	}
+	var err error
+	e.outputFile, err = model.GetUserFileContentById(*e.data.OutputFileID, e.task.UserId, e.task.TokenId)
+	if err != nil {
+		return err
+	}
+	e.errorFile, err = model.GetUserFileContentById(*e.data.ErrorFileID, e.task.UserId, e.task.TokenId)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// pendingLines 返回尚未完成的行号，并按已保存的结果恢复完成和失败计数
+func (e *batchExecutor) pendingLines(total int) ([]int, error) {
+	saved, err := model.GetBatchResultStates(e.task.ID)
+	if err != nil {
+		return nil, err
+	}
+	done := make(map[int]bool, len(saved))
+	e.data.RequestCounts = dto.BatchRequestCounts{Total: total}
+	for _, result := range saved {
+		done[result.Line] = true
+		if result.IsError {
+			e.data.RequestCounts.Failed++
+		} else {
+			e.data.RequestCounts.Completed++
+		}
+	}
+	pending := make([]int, 0, total-len(done))
+	for i := 0; i < total; i++ {
+		if !done[i] {
+			pending = append(pending, i)
+		}
+	}
+	return pending, nil
+}
+
+func (e *batchExecutor) newResultFile(filename string) *model.File {
+	return &model.File{
+		FileId:    "file-" + common.GetUUID(),
+		UserId:    e.task.UserId,
+		TokenId:   e.task.TokenId,
+		Purpose:   dto.FilePurposeBatchOutput,
+		Filename:  filename,
+		Status:    dto.FileStatusUploaded,
+		CreatedAt: common.GetTimestamp(),
+	}
+}
+
+func (e *batchExecutor) isCancelled() bool {
+	task, err := model.GetTaskById(e.task.ID)
+	if err != nil {
+		return false
+	}
+	return task.FailReason == batchCancelledReason
+}
+
+// execute 通过网关自身的路由执行一行请求，计费和日志与普通请求一致
+func (e *batchExecutor) execute(ctx context.Context, line dto.BatchInputLine) dto.BatchOutputLine {
+	result := dto.BatchOutputLine{
+		ID:       "batch_req_" + common.GetUUID(),
+		CustomID: line.CustomID,
+	}
+	body := make(map[string]any)
+	if err := common.DecodeJson(line.Body, &body); err != nil {
+		result.Error = &dto.BatchError{Code: "invalid_body", Message: err.Error()}
+		return result
+	}
+	// 批处理不支持流式响应
+	delete(body, "stream")
+	delete(body, "stream_options")
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		result.Error = &dto.BatchError{Code: "invalid_body", Message: err.Error()}
+		return result
+	}
+
+	reqCtx := context.WithValue(ctx, constant.ContextKeyBatchId, e.data.ID)
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, line.URL, bytes.NewReader(jsonData))
+	if err != nil {
+		result.Error = &dto.BatchError{Code: "invalid_request", Message: err.Error()}
+		return result
+	}
+	req.RemoteAddr = net.JoinHostPort(e.data.ClientIp, "0")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer sk-"+e.token.Key)
+
+	recorder := httptest.NewRecorder()
+	batchRelayHandler.ServeHTTP(recorder, req)
+
+	respBody := recorder.Body.Bytes()
+	if !json.Valid(respBody) {
+		respBody, _ = json.Marshal(string(respBody))
+	}
+	result.Response = &dto.BatchOutputResponse{
+		StatusCode: recorder.Code,
+		RequestID:  recorder.Header().Get(common.RequestIdKey),
+		Body:       respBody,
+	}
+	return result
+}
+
+// saveResults 按行追加保存执行结果，已保存的行在断点续跑时不会重复执行
+func (e *batchExecutor) saveResults(lineIndexes []int, results []dto.BatchOutputLine) error {
+	batchResults := make([]*model.BatchResult, 0, len(results))
+	completed, failed := 0, 0
+	for i, result := range results {
+		data, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		isError := result.Error != nil || result.Response == nil || result.Response.StatusCode != http.StatusOK
+		if isError {
+			failed++
+		} else {
+			completed++
+		}
+		batchResults = append(batchResults, &model.BatchResult{
+			TaskId:  e.task.ID,
+			Line:    lineIndexes[i],
+			IsError: isError,
+			Content: data,
+		})
+	}
+	if err := model.InsertBatchResults(batchResults); err != nil {
+		return err
+	}
+	e.data.RequestCounts.Completed += completed
+	e.data.RequestCounts.Failed += failed
+	return nil
+}
+
+func (e *batchExecutor) progress() string {
+	if e.data.RequestCounts.Total == 0 {
+		return "0%"
+	}
+	progress := (e.data.RequestCounts.Completed + e.data.RequestCounts.Failed) * 100 / e.data.RequestCounts.Total
+	if progress > 99 {
+		progress = 99
+	}
+	return fmt.Sprintf("%d%%", progress)
+}
+
+// checkpoint 保存执行进度，结果已在每轮执行后按行保存
+func (e *batchExecutor) checkpoint() error {
+	e.task.SetData(e.data)
+	return model.TaskBulkUpdateByID([]int64{e.task.ID}, map[string]any{
+		"progress": e.progress(),
+		"data":     e.task.Data,
+	})
+}
+
+func (e *batchExecutor) fail(code string, message string) {
+	e.data.Errors = &dto.BatchErrors{
+		Object: "list",
+		Data:   []dto.BatchError{{Code: code, Message: message}},
+	}
+	e.finish(dto.BatchStatusFailed)
+}
+
+// finish 按行号合并已保存的结果写入输出文件和错误文件，空的结果文件会被删除
+func (e *batchExecutor) finish(status string) {
+	now := common.GetTimestamp()
+	e.data.FinalizingAt = &now
+	var output, errors bytes.Buffer
+	results, err := model.GetBatchResults(e.task.ID)
+	if err != nil {
+		common.SysError(fmt.Sprintf("batch %s load results failed: %s", e.task.TaskID, err.Error()))
+		return
+	}
+	for _, result := range results {
+		buffer := &output
+		if result.IsError {
+			buffer = &errors
+		}
+		buffer.Write(result.Content)
+		buffer.WriteByte('\n')
+	}
+	if e.outputFile != nil {
+		e.outputFile.Status = dto.FileStatusProcessed
+		if output.Len() > 0 {
+			_ = e.outputFile.UpdateContent(output.Bytes())
+		} else {
+			_, _ = model.DeleteUserFileById(e.outputFile.FileId, e.task.UserId, e.task.TokenId)
+			e.data.OutputFileID = nil
+		}
+	}
+	if e.errorFile != nil {
+		e.errorFile.Status = dto.FileStatusProcessed
+		if errors.Len() > 0 {
+			_ = e.errorFile.UpdateContent(errors.Bytes())
+		} else {
+			_, _ = model.DeleteUserFileById(e.errorFile.FileId, e.task.UserId, e.task.TokenId)
+			e.data.ErrorFileID = nil
+		}
+	}
+
+	e.data.Status = status
+	taskStatus := model.TaskStatus(model.TaskStatusFailure)
+	switch status {
+	case dto.BatchStatusCompleted:
+		e.data.CompletedAt = &now
+		taskStatus = model.TaskStatusSuccess
+	case dto.BatchStatusFailed:
+		e.data.FailedAt = &now
+	case dto.BatchStatusExpired:
+		e.data.ExpiredAt = &now
+	case dto.BatchStatusCancelled:
+		e.data.CancellingAt = &now
+		e.data.CancelledAt = &now
+	}
+	e.task.SetData(e.data)
+	updates := map[string]any{
+		"status":      taskStatus,
+		"progress":    "100%",
+		"finish_time": now,
+		"data":        e.task.Data,
+	}
+	if status == dto.BatchStatusFailed || status == dto.BatchStatusExpired {
+		updates["fail_reason"] = status
+	}
+	if err := model.TaskBulkUpdateByID([]int64{e.task.ID}, updates); err != nil {
+		common.SysError(fmt.Sprintf("batch %s finish failed: %s", e.task.TaskID, err.Error()))
+		return
+	}
+	if err := model.DeleteBatchResults(e.task.ID); err != nil {
+		common.SysError(fmt.Sprintf("batch %s delete results failed: %s", e.task.TaskID, err.Error()))
+	}
+	e.task.Status = taskStatus
+	e.task.Progress = "100%"
+	e.task.FinishTime = now
+	if status == dto.BatchStatusFailed || status == dto.BatchStatusExpired {
+		e.task.FailReason = status
+	}
+	service.NotifyTaskFinished(e.task)
+}
@@ -0,0 +1,305 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/dto"
+	"one-api/model"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func batchInputLine(customId string) string {
+	return `{"custom_id":"` + customId + `","method":"POST","url":"/v1/chat/completions","body":{"model":"gpt-4o","stream":true}}`
+}
+
+func TestParseBatchInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		lines   int
+		codes   []string
+	}{
+		{"valid lines skip blanks", batchInputLine("a") + "\n\n" + batchInputLine("b") + "\n", 2, nil},
+		{"empty file", "\n \n", 0, []string{"empty_file"}},
+		{"invalid json", batchInputLine("a") + "\n{", 1, []string{"invalid_json_line"}},
+		{"missing custom_id", `{"method":"POST","url":"/v1/chat/completions","body":{}}`, 0, []string{"missing_required_parameter"}},
+		{"duplicate custom_id", batchInputLine("a") + "\n" + batchInputLine("a"), 1, []string{"duplicate_custom_id"}},
+		{"invalid method", `{"custom_id":"a","method":"GET","url":"/v1/chat/completions","body":{}}`, 0, []string{"invalid_method"}},
+		{"mismatched endpoint", `{"custom_id":"a","method":"POST","url":"/v1/embeddings","body":{}}`, 0, []string{"mismatched_endpoint"}},
+		{"missing body", `{"custom_id":"a","method":"POST","url":"/v1/chat/completions"}`, 0, []string{"missing_required_parameter"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, batchErrors := parseBatchInput([]byte(tt.content), "/v1/chat/completions")
+			if len(lines) != tt.lines {
+				t.Errorf("lines = %d, want %d", len(lines), tt.lines)
+			}
+			if len(batchErrors) != len(tt.codes) {
+				t.Fatalf("errors = %+v, want %v", batchErrors, tt.codes)
+			}
+			for i, code := range tt.codes {
+				if batchErrors[i].Code != code {
+					t.Errorf("error %d code = %s, want %s", i, batchErrors[i].Code, code)
+				}
+			}
+		})
+	}
+	// 错误中的行号为文件中的实际行号，空行也计算在内
+	_, batchErrors := parseBatchInput([]byte(batchInputLine("a")+"\n\n{"), "/v1/chat/completions")
+	if len(batchErrors) != 1 || batchErrors[0].Line == nil || *batchErrors[0].Line != 3 {
+		t.Errorf("errors = %+v, want line 3", batchErrors)
+	}
+}
+
+func newFileRouter() *gin.Engine {
+	router := gin.New()
+	group := router.Group("/v1/files", func(c *gin.Context) {
+		c.Set("id", 1)
+		c.Set("token_id", 1)
+		c.Next()
+	})
+	group.POST("", UploadFile)
+	group.GET("", ListFiles)
+	group.GET("/:id", RetrieveFile)
+	group.GET("/:id/content", RetrieveFileContent)
+	group.DELETE("/:id", DeleteFile)
+	return router
+}
+
+func uploadTestFile(router *gin.Engine, purpose string, content string) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	_ = writer.WriteField("purpose", purpose)
+	part, _ := writer.CreateFormFile("file", "input.jsonl")
+	_, _ = part.Write([]byte(content))
+	_ = writer.Close()
+	req := httptest.NewRequest(http.MethodPost, "/v1/files", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func doFileRequest(router *gin.Engine, method string, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	return w
+}
+
+func TestFilesAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB(t, &model.File{})
+	oldMaxUpload := constant.MaxUploadFileMB
+	constant.MaxUploadFileMB = 1
+	t.Cleanup(func() { constant.MaxUploadFileMB = oldMaxUpload })
+	router := newFileRouter()
+
+	if w := uploadTestFile(router, "unknown", "{}"); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid purpose status = %d", w.Code)
+	}
+	if w := uploadTestFile(router, dto.FilePurposeBatch, "{}\nnot json"); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid jsonl status = %d", w.Code)
+	}
+	content := batchInputLine("a") + "\n"
+	w := uploadTestFile(router, dto.FilePurposeBatch, content)
+	if w.Code != http.StatusOK {
+		t.Fatalf("upload status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var uploaded dto.OpenAIFile
+	if err := json.Unmarshal(w.Body.Bytes(), &uploaded); err != nil {
+		t.Fatal(err)
+	}
+	if uploaded.Bytes != int64(len(content)) || uploaded.Purpose != dto.FilePurposeBatch || uploaded.Filename != "input.jsonl" {
+		t.Errorf("uploaded file = %+v", uploaded)
+	}
+
+	// 其他令牌上传的文件不可见
+	if err := db.Create(&model.File{FileId: "file-other", UserId: 1, TokenId: 2, Purpose: dto.FilePurposeBatch}).Error; err != nil {
+		t.Fatal(err)
+	}
+	var list dto.OpenAIFileList
+	_ = json.Unmarshal(doFileRequest(router, http.MethodGet, "/v1/files?purpose=batch").Body.Bytes(), &list)
+	if len(list.Data) != 1 || list.Data[0].ID != uploaded.ID {
+		t.Errorf("list = %+v", list)
+	}
+	if w := doFileRequest(router, http.MethodGet, "/v1/files/file-other"); w.Code != http.StatusNotFound {
+		t.Errorf("other token's file status = %d", w.Code)
+	}
+	if w := doFileRequest(router, http.MethodGet, "/v1/files/"+uploaded.ID+"/content"); w.Body.String() != content {
+		t.Errorf("content = %q", w.Body.String())
+	}
+	if w := doFileRequest(router, http.MethodDelete, "/v1/files/"+uploaded.ID); w.Code != http.StatusOK {
+		t.Errorf("delete status = %d", w.Code)
+	}
+	if w := doFileRequest(router, http.MethodDelete, "/v1/files/"+uploaded.ID); w.Code != http.StatusNotFound {
+		t.Errorf("second delete status = %d", w.Code)
+	}
+}
+
+// setupBatchExecutorTest 创建令牌、输入文件和批处理任务，handler 替换网关的中继处理器
+func setupBatchExecutorTest(t *testing.T, lineCount int, handler http.HandlerFunc) *model.Task {
+	t.Helper()
+	setupTestDB(t, &model.Token{}, &model.Task{}, &model.File{}, &model.BatchResult{})
+	oldHandler, oldConcurrency := batchRelayHandler, constant.BatchConcurrency
+	batchRelayHandler, constant.BatchConcurrency = handler, 1
+	t.Cleanup(func() { batchRelayHandler, constant.BatchConcurrency = oldHandler, oldConcurrency })
+
+	token := &model.Token{UserId: 1, Key: "batchkey", Name: "batch", Status: common.TokenStatusEnabled}
+	if err := token.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	lines := make([]string, 0, lineCount)
+	for i := 0; i < lineCount; i++ {
+		lines = append(lines, batchInputLine(string(rune('a'+i))))
+	}
+	input := &model.File{FileId: "file-input", UserId: 1, TokenId: token.Id, Purpose: dto.FilePurposeBatch,
+		Content: []byte(strings.Join(lines, "\n"))}
+	if err := input.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	data := &batchTaskData{
+		Batch: dto.Batch{ID: "batch_test", Endpoint: "/v1/chat/completions", InputFileID: input.FileId,
+			Status: dto.BatchStatusValidating, ExpiresAt: common.GetPointer(time.Now().Add(time.Hour).Unix())},
+		ClientIp: "::1",
+	}
+	task := &model.Task{TaskID: data.ID, Platform: constant.TaskPlatformBatch, UserId: 1, TokenId: token.Id, Status: model.TaskStatusNotStart}
+	task.SetData(data)
+	if err := task.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	return task
+}
+
+func runBatchExecutor(t *testing.T, task *model.Task) (*model.Task, *batchTaskData) {
+	t.Helper()
+	executor, err := newBatchExecutor(task)
+	if err != nil {
+		t.Fatal(err)
+	}
+	executor.run(context.Background())
+	stored, err := model.GetTaskById(task.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := getBatchTaskData(stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stored, data
+}
+
+func batchOutputCustomIds(t *testing.T, task *model.Task, fileId *string) []string {
+	t.Helper()
+	if fileId == nil {
+		return nil
+	}
+	file, err := model.GetUserFileContentById(*fileId, task.UserId, task.TokenId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	customIds := make([]string, 0)
+	for _, line := range strings.Split(strings.TrimSpace(string(file.Content)), "\n") {
+		var output dto.BatchOutputLine
+		if err := json.Unmarshal([]byte(line), &output); err != nil {
+			t.Fatal(err)
+		}
+		customIds = append(customIds, output.CustomID)
+	}
+	return customIds
+}
+
+func TestBatchExecutorCancel(t *testing.T) {
+	var task *model.Task
+	var mu sync.Mutex
+	requests := 0
+	task = setupBatchExecutorTest(t, 3, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		if r.RemoteAddr != "[::1]:0" {
+			t.Errorf("remote addr = %s", r.RemoteAddr)
+		}
+		// 第一行执行时用户取消批处理
+		_ = model.TaskBulkUpdateByID([]int64{task.ID}, map[string]any{"fail_reason": batchCancelledReason})
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1"}`))
+	})
+	stored, data := runBatchExecutor(t, task)
+	if requests != 1 {
+		t.Errorf("requests = %d, want 1", requests)
+	}
+	if data.Status != dto.BatchStatusCancelled || stored.Status != model.TaskStatusFailure || data.CancelledAt == nil {
+		t.Errorf("status = %s, task status = %s", data.Status, stored.Status)
+	}
+	if data.RequestCounts.Total != 3 || data.RequestCounts.Completed != 1 {
+		t.Errorf("request counts = %+v", data.RequestCounts)
+	}
+	if got := batchOutputCustomIds(t, stored, data.OutputFileID); len(got) != 1 || got[0] != "a" {
+		t.Errorf("output = %v", got)
+	}
+	if data.ErrorFileID != nil {
+		t.Error("empty error file not deleted")
+	}
+	if results, _ := model.GetBatchResults(task.ID); len(results) != 0 {
+		t.Errorf("results not deleted: %d", len(results))
+	}
+}
+
+func TestBatchExecutorResumeSkipsCompletedLines(t *testing.T) {
+	var mu sync.Mutex
+	requested := make([]string, 0)
+	task := setupBatchExecutorTest(t, 3, func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if _, ok := body["stream"]; ok {
+			t.Error("stream not removed from batch request")
+		}
+		mu.Lock()
+		requested = append(requested, r.Header.Get("Authorization"))
+		mu.Unlock()
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":{"message":"bad"}}`))
+	})
+	// 模拟执行到一半后重启：已开始执行且第二行已有结果
+	executor, err := newBatchExecutor(task)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := executor.start(3); err != nil {
+		t.Fatal(err)
+	}
+	saved, _ := json.Marshal(dto.BatchOutputLine{ID: "batch_req_saved", CustomID: "b",
+		Response: &dto.BatchOutputResponse{StatusCode: http.StatusOK, Body: json.RawMessage(`{}`)}})
+	if err := model.InsertBatchResults([]*model.BatchResult{{TaskId: task.ID, Line: 1, Content: saved}}); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, data := runBatchExecutor(t, task)
+	if len(requested) != 2 || requested[0] != "Bearer sk-batchkey" {
+		t.Errorf("requests = %v, want 2", requested)
+	}
+	if data.Status != dto.BatchStatusCompleted || stored.Status != model.TaskStatusSuccess {
+		t.Errorf("status = %s, task status = %s", data.Status, stored.Status)
+	}
+	if data.RequestCounts.Completed != 1 || data.RequestCounts.Failed != 2 {
+		t.Errorf("request counts = %+v", data.RequestCounts)
+	}
+	if got := batchOutputCustomIds(t, stored, data.OutputFileID); len(got) != 1 || got[0] != "b" {
+		t.Errorf("output = %v", got)
+	}
+	// 错误文件按输入文件的行号排序
+	if got := batchOutputCustomIds(t, stored, data.ErrorFileID); strings.Join(got, ",") != "a,c" {
+		t.Errorf("errors = %v", got)
+	}
+}
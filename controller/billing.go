@@ -19,6 +19,13 @@ func GetSubscription(c *gin.Context) {
 		expiredTime = token.ExpiredTime
 		remainQuota = token.RemainQuota
 		usedQuota = token.UsedQuota
+	} else if orgId := c.GetInt("token_org_id"); orgId != 0 {
+		var org *model.Organization
+		org, err = model.GetOrganizationById(orgId)
+		if err == nil {
+			remainQuota = org.Quota
+			usedQuota = org.UsedQuota
+		}
 	} else {
 		userId := c.GetInt("id")
 		remainQuota, err = model.GetUserQuota(userId, false)
@@ -0,0 +1,257 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+	"one-api/service"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 分页查询每页的最大条数
+const maxPageSize = 100
+
+func getPageQuery(c *gin.Context) (int, int) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	if p < 1 {
+		p = 1
+	}
+	if pageSize <= 0 {
+		pageSize = common.ItemsPerPage
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+	return p, pageSize
+}
+
+func listBillingStatements(c *gin.Context, userId int) {
+	p, pageSize := getPageQuery(c)
+	statements, total, err := model.GetBillingStatements(userId, c.Query("period"), c.Query("payment_status"), (p-1)*pageSize, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": map[string]any{
+			"items":     statements,
+			"total":     total,
+			"page":      p,
+			"page_size": pageSize,
+		},
+	})
+}
+
+// getBillingStatement 查询账单，userId 不为 0 时只能查询该用户的账单
+func getBillingStatement(c *gin.Context, userId int) *model.BillingStatement {
+	id, _ := strconv.Atoi(c.Param("id"))
+	statement, err := model.GetBillingStatementById(id)
+	if err != nil || (userId != 0 && statement.UserId != userId) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "账单不存在",
+		})
+		return nil
+	}
+	return statement
+}
+
+func downloadBillingStatement(c *gin.Context, statement *model.BillingStatement) {
+	switch c.DefaultQuery("format", "pdf") {
+	case "pdf":
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.pdf", statement.InvoiceNo))
+		c.Data(http.StatusOK, "application/pdf", service.RenderBillingStatementPDF(statement))
+	case "csv":
+		data, err := service.RenderBillingStatementCSV(statement)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.csv", statement.InvoiceNo))
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", data)
+	default:
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "不支持的格式，可选 pdf 或 csv",
+		})
+	}
+}
+
+func GetSelfBillingStatements(c *gin.Context) {
+	listBillingStatements(c, c.GetInt("id"))
+}
+
+func GetSelfBillingStatement(c *gin.Context) {
+	statement := getBillingStatement(c, c.GetInt("id"))
+	if statement == nil {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"statement": statement,
+			"detail":    statement.GetDetail(),
+		},
+	})
+}
+
+// DownloadSelfBillingStatement 下载账单，format 可选 pdf 或 csv
+func DownloadSelfBillingStatement(c *gin.Context) {
+	if statement := getBillingStatement(c, c.GetInt("id")); statement != nil {
+		downloadBillingStatement(c, statement)
+	}
+}
+
+func GetAllBillingStatements(c *gin.Context) {
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	listBillingStatements(c, userId)
+}
+
+func DownloadBillingStatement(c *gin.Context) {
+	if statement := getBillingStatement(c, 0); statement != nil {
+		downloadBillingStatement(c, statement)
+	}
+}
+
+type generateBillingStatementRequest struct {
+	Period string `json:"period"`
+	// UserId 为 0 时为账期内所有有额度变动的用户生成
+	UserId int  `json:"user_id"`
+	Force  bool `json:"force"`
+}
+
+// GenerateBillingStatements 手动生成或重新生成账单
+func GenerateBillingStatements(c *gin.Context) {
+	var req generateBillingStatementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	if req.UserId != 0 {
+		statement, err := model.GenerateBillingStatement(req.UserId, req.Period, req.Force)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "",
+			"data":    statement,
+		})
+		return
+	}
+	count, err := model.GenerateBillingStatements(req.Period)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    count,
+	})
+}
+
+type payBillingStatementRequest struct {
+	// CreditQuota 按应付金额为用户恢复额度，线下收款时使用；用户已在线充值补足欠款时不应开启
+	CreditQuota bool `json:"credit_quota"`
+}
+
+// PayBillingStatement 将后付费账单标记为已付款，并重新检查账户的暂停状态
+func PayBillingStatement(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var req payBillingStatementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	statement, err := model.PayBillingStatement(id, req.CreditQuota)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	model.SetAuditAction(c, "pay")
+	model.SetAuditDiff(c, statement.Id, gin.H{"payment_status": model.BillingStatementPaymentUnpaid},
+		gin.H{"payment_status": statement.PaymentStatus, "credit_quota": req.CreditQuota})
+	service.CheckCreditAccount(statement.UserId, true)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    statement,
+	})
+}
+
+func GetSelfTopUps(c *gin.Context) {
+	p, pageSize := getPageQuery(c)
+	topUps, total, err := model.GetUserTopUps(c.GetInt("id"), (p-1)*pageSize, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": map[string]any{
+			"items":     topUps,
+			"total":     total,
+			"page":      p,
+			"page_size": pageSize,
+		},
+	})
+}
+
+// DownloadSelfTopUpReceipt 下载已支付的在线充值订单收据
+func DownloadSelfTopUpReceipt(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	userId := c.GetInt("id")
+	topUp := model.GetTopUpById(id)
+	if topUp == nil || topUp.UserId != userId ||
+		(topUp.Status != model.TopUpStatusSuccess && topUp.Status != model.TopUpStatusRefunded) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "订单不存在或未支付",
+		})
+		return
+	}
+	user, err := model.GetUserById(userId, false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=receipt-%s.pdf", topUp.TradeNo))
+	c.Data(http.StatusOK, "application/pdf", service.RenderTopUpReceiptPDF(topUp, user))
+}
@@ -0,0 +1,34 @@
+package controller
+
+import (
+	"net/http/httptest"
+	"one-api/common"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetPageQuery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		query    string
+		p        int
+		pageSize int
+	}{
+		{"", 1, common.ItemsPerPage},
+		{"?p=3&page_size=20", 3, 20},
+		{"?p=-1&page_size=-5", 1, common.ItemsPerPage},
+		{"?page_size=100", 1, maxPageSize},
+		{"?page_size=100000000", 1, maxPageSize},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("GET", "/api/billing/statement"+tt.query, nil)
+			p, pageSize := getPageQuery(c)
+			if p != tt.p || pageSize != tt.pageSize {
+				t.Errorf("getPageQuery = (%d, %d), want (%d, %d)", p, pageSize, tt.p, tt.pageSize)
+			}
+		})
+	}
+}
@@ -29,16 +29,19 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func testChannel(channel *model.Channel, testModel string) (err error, openAIErrorWithStatusCode *dto.OpenAIErrorWithStatusCode) {
+func testChannel(channel *model.Channel, testModel string) (err error, openAIErrorWithStatusCode *dto.OpenAIErrorWithStatusCode, usingKey string) {
 	tik := time.Now()
 	if channel.Type == common.ChannelTypeMidjourney {
-		return errors.New("midjourney channel test is not supported"), nil
+		return errors.New("midjourney channel test is not supported"), nil, usingKey
 	}
 	if channel.Type == common.ChannelTypeMidjourneyPlus {
-		return errors.New("midjourney plus channel test is not supported!!!"), nil
+		return errors.New("midjourney plus channel test is not supported!!!"), nil, usingKey
 	}
 	if channel.Type == common.ChannelTypeSunoAPI {
-		return errors.New("suno channel test is not supported"), nil
+		return errors.New("suno channel test is not supported"), nil, usingKey
+	}
+	if channel.Type == common.ChannelTypeKling || channel.Type == common.ChannelTypeRunway || channel.Type == common.ChannelTypeLuma {
+		return errors.New("video channel test is not supported"), nil, usingKey
 	}
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
@@ -75,11 +78,10 @@ func testChannel(channel *model.Channel, testModel string) (err error, openAIErr
 
 	cache, err := model.GetUserCache(1)
 	if err != nil {
-		return err, nil
+		return err, nil, usingKey
 	}
 	cache.WriteContext(c)
 
-	c.Request.Header.Set("Authorization", "Bearer "+channel.Key)
 	c.Request.Header.Set("Content-Type", "application/json")
 	c.Set("channel", channel.Type)
 	c.Set("base_url", channel.GetBaseURL())
@@ -87,19 +89,20 @@ func testChannel(channel *model.Channel, testModel string) (err error, openAIErr
 	c.Set("group", group)
 
 	middleware.SetupContextForSelectedChannel(c, channel, testModel)
+	usingKey = c.GetString("channel_key")
 
 	info := relaycommon.GenRelayInfo(c)
 
 	err = helper.ModelMappedHelper(c, info)
 	if err != nil {
-		return err, nil
+		return err, nil, usingKey
 	}
 	testModel = info.UpstreamModelName
 
 	apiType, _ := constant.ChannelType2APIType(channel.Type)
 	adaptor := relay.GetAdaptor(apiType)
 	if adaptor == nil {
-		return fmt.Errorf("invalid api type: %d, adaptor is nil", apiType), nil
+		return fmt.Errorf("invalid api type: %d, adaptor is nil", apiType), nil, usingKey
 	}
 
 	request := buildTestRequest(testModel)
@@ -107,45 +110,45 @@ func testChannel(channel *model.Channel, testModel string) (err error, openAIErr
 
 	priceData, err := helper.ModelPriceHelper(c, info, 0, int(request.MaxTokens))
 	if err != nil {
-		return err, nil
+		return err, nil, usingKey
 	}
 
 	adaptor.Init(info)
 
 	convertedRequest, err := adaptor.ConvertOpenAIRequest(c, info, request)
 	if err != nil {
-		return err, nil
+		return err, nil, usingKey
 	}
 	jsonData, err := json.Marshal(convertedRequest)
 	if err != nil {
-		return err, nil
+		return err, nil, usingKey
 	}
 	requestBody := bytes.NewBuffer(jsonData)
 	c.Request.Body = io.NopCloser(requestBody)
 	resp, err := adaptor.DoRequest(c, info, requestBody)
 	if err != nil {
-		return err, nil
+		return err, nil, usingKey
 	}
 	var httpResp *http.Response
 	if resp != nil {
 		httpResp = resp.(*http.Response)
 		if httpResp.StatusCode != http.StatusOK {
 			err := service.RelayErrorHandler(httpResp, true)
-			return fmt.Errorf("status code %d: %s", httpResp.StatusCode, err.Error.Message), err
+			return fmt.Errorf("status code %d: %s", httpResp.StatusCode, err.Error.Message), err, usingKey
 		}
 	}
 	usageA, respErr := adaptor.DoResponse(c, httpResp, info)
 	if respErr != nil {
-		return fmt.Errorf("%s", respErr.Error.Message), respErr
+		return fmt.Errorf("%s", respErr.Error.Message), respErr, usingKey
 	}
 	if usageA == nil {
-		return errors.New("usage is nil"), nil
+		return errors.New("usage is nil"), nil, usingKey
 	}
 	usage := usageA.(*dto.Usage)
 	result := w.Result()
 	respBody, err := io.ReadAll(result.Body)
 	if err != nil {
-		return err, nil
+		return err, nil, usingKey
 	}
 	info.PromptTokens = usage.PromptTokens
 
@@ -167,7 +170,7 @@ func testChannel(channel *model.Channel, testModel string) (err error, openAIErr
 	model.RecordConsumeLog(c, 1, channel.Id, usage.PromptTokens, usage.CompletionTokens, info.OriginModelName, "模型测试",
 		quota, "模型测试", 0, quota, int(consumedTime), false, info.Group, other)
 	common.SysLog(fmt.Sprintf("testing channel #%d, response: \n%s", channel.Id, string(respBody)))
-	return nil, nil
+	return nil, nil, usingKey
 }
 
 func buildTestRequest(model string) *dto.GeneralOpenAIRequest {
@@ -226,7 +229,7 @@ func TestChannel(c *gin.Context) {
 	}
 	testModel := c.Query("model")
 	tik := time.Now()
-	err, _ = testChannel(channel, testModel)
+	err, _, _ = testChannel(channel, testModel)
 	tok := time.Now()
 	milliseconds := tok.Sub(tik).Milliseconds()
 	go channel.UpdateResponseTime(milliseconds)
@@ -271,7 +274,7 @@ func testAllChannels(notify bool) error {
 		for _, channel := range channels {
 			isChannelEnabled := channel.Status == common.ChannelStatusEnabled
 			tik := time.Now()
-			err, openaiWithStatusErr := testChannel(channel, "")
+			err, openaiWithStatusErr, usingKey := testChannel(channel, "")
 			tok := time.Now()
 			milliseconds := tok.Sub(tik).Milliseconds()
 
@@ -291,12 +294,12 @@ func testAllChannels(notify bool) error {
 
 			// disable channel
 			if isChannelEnabled && shouldBanChannel && channel.GetAutoBan() {
-				service.DisableChannel(channel.Id, channel.Name, err.Error())
+				service.DisableChannel(channel.Id, channel.Name, usingKey, err.Error())
 			}
 
 			// enable channel
 			if !isChannelEnabled && service.ShouldEnableChannel(err, openaiWithStatusErr, channel.Status) {
-				service.EnableChannel(channel.Id, channel.Name)
+				service.EnableChannel(channel.Id, channel.Name, usingKey)
 			}
 
 			channel.UpdateResponseTime(milliseconds)
@@ -80,6 +80,7 @@ func GetAllChannels(c *gin.Context) {
 		}
 		channelData = channels
 	}
+	fillChannelHealth(channelData)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -122,7 +123,7 @@ func FetchUpstreamModels(c *gin.Context) {
 	if channel.Type == common.ChannelTypeGemini {
 		url = fmt.Sprintf("%s/v1beta/openai/models", baseURL)
 	}
-	body, err := GetResponseBody("GET", url, channel, GetAuthHeader(channel.Key))
+	body, err := GetResponseBody("GET", url, channel, GetAuthHeader(channel.GetNextKey()))
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -207,6 +208,7 @@ func SearchChannels(c *gin.Context) {
 		}
 		channelData = channels
 	}
+	fillChannelHealth(channelData)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -232,6 +234,11 @@ func GetChannel(c *gin.Context) {
 		})
 		return
 	}
+	// 只读的管理 API 密钥不能获取渠道密钥
+	if apiKey, ok := c.Get("admin_api_key"); ok && !apiKey.(*model.AdminApiKey).HasScope(model.AdminScopeChannelWrite) {
+		channel.Key = ""
+	}
+	fillChannelHealth([]*model.Channel{channel})
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -250,8 +257,19 @@ func AddChannel(c *gin.Context) {
 		})
 		return
 	}
+	if !model.IsValidMultiKeyMode(channel.GetMultiKeyMode()) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的多密钥模式",
+		})
+		return
+	}
 	channel.CreatedTime = common.GetTimestamp()
 	keys := strings.Split(channel.Key, "\n")
+	if channel.IsMultiKey() {
+		// 多密钥渠道所有密钥保存在同一个渠道中
+		keys = []string{channel.Key}
+	}
 	if channel.Type == common.ChannelTypeVertexAi {
 		if channel.Other == "" {
 			c.JSON(http.StatusOK, gin.H{
@@ -311,8 +329,16 @@ func AddChannel(c *gin.Context) {
 
 func DeleteChannel(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
+	originChannel, err := model.GetChannelById(id, true)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	channel := model.Channel{Id: id}
-	err := channel.Delete()
+	err = channel.Delete()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -320,6 +346,7 @@ func DeleteChannel(c *gin.Context) {
 		})
 		return
 	}
+	model.SetAuditDiff(c, id, originChannel, nil)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -477,6 +504,13 @@ func UpdateChannel(c *gin.Context) {
 		})
 		return
 	}
+	if !model.IsValidMultiKeyMode(channel.GetMultiKeyMode()) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的多密钥模式",
+		})
+		return
+	}
 	if channel.Type == common.ChannelTypeVertexAi {
 		if channel.Other == "" {
 			c.JSON(http.StatusOK, gin.H{
@@ -498,6 +532,14 @@ func UpdateChannel(c *gin.Context) {
 			}
 		}
 	}
+	originChannel, err := model.GetChannelById(channel.Id, true)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	err = channel.Update()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -506,6 +548,15 @@ func UpdateChannel(c *gin.Context) {
 		})
 		return
 	}
+	// 只对比请求中提交的字段，未提交的字段保持不变
+	var request map[string]json.RawMessage
+	requestBody, _ := common.GetRequestBody(c)
+	_ = json.Unmarshal(requestBody, &request)
+	fields := make([]string, 0, len(request))
+	for field := range request {
+		fields = append(fields, field)
+	}
+	model.SetAuditPartialDiff(c, channel.Id, originChannel, channel, fields)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -620,3 +671,110 @@ func BatchSetChannelTag(c *gin.Context) {
 	})
 	return
 }
+
+func GetChannelKeys(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	channel, err := model.GetChannelById(id, true)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"multi_key_mode": channel.GetMultiKeyMode(),
+			"keys":           channel.GetKeyInfos(),
+		},
+	})
+}
+
+type ChannelKeyStatusRequest struct {
+	Index  int  `json:"index"`
+	Enable bool `json:"enable"`
+}
+
+// UpdateChannelKeyStatus 手动启用或禁用多密钥渠道中的单个密钥
+func UpdateChannelKeyStatus(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	request := ChannelKeyStatusRequest{}
+	err = c.ShouldBindJSON(&request)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "参数错误",
+		})
+		return
+	}
+	channel, err := model.GetChannelById(id, true)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	keys := channel.GetKeys()
+	if !channel.IsMultiKey() || request.Index < 0 || request.Index >= len(keys) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "密钥不存在",
+		})
+		return
+	}
+	status := common.ChannelStatusManuallyDisabled
+	if request.Enable {
+		status = common.ChannelStatusEnabled
+	}
+	_, allDisabled := model.UpdateChannelKeyStatus(id, keys[request.Index], status, "手动禁用")
+	if allDisabled {
+		model.UpdateChannelStatusById(id, common.ChannelStatusManuallyDisabled, "所有密钥均已被禁用")
+	} else if request.Enable && channel.Status == common.ChannelStatusAutoDisabled {
+		model.UpdateChannelStatusById(id, common.ChannelStatusEnabled, "")
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+func fillChannelHealth(channels []*model.Channel) {
+	for _, channel := range channels {
+		health := model.GetChannelHealth(channel.Id)
+		channel.Health = &health
+	}
+}
+
+// ResetChannelHealth 清除渠道在本节点上的健康度统计，立即关闭熔断
+func ResetChannelHealth(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	model.ResetChannelHealth(id)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"one-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 加密导出和导入的密码通过请求头传递，避免出现在访问日志中
+const configPassphraseHeader = "X-Config-Passphrase"
+
+func ExportConfig(c *gin.Context) {
+	format := c.DefaultQuery("format", "yaml")
+	secretMode := c.DefaultQuery("secrets", model.ConfigSecretModeRedacted)
+	document, err := model.ExportConfigDocument(secretMode, c.GetHeader(configPassphraseHeader))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	data, err := model.MarshalConfigDocument(document, format)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	contentType := "application/yaml"
+	if format == "json" {
+		contentType = "application/json"
+	} else {
+		format = "yaml"
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=new-api-config-%d.%s", document.ExportedAt, format))
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// ImportConfig 导入 YAML 或 JSON 配置文档，dry_run=true 时只返回变更预览
+func ImportConfig(c *gin.Context) {
+	data, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	document, err := model.UnmarshalConfigDocument(data)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	changes, err := model.PlanConfigImport(document, c.GetHeader(configPassphraseHeader))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	dryRun := c.Query("dry_run") == "true"
+	if dryRun {
+		model.SetAuditAction(c, "dry_run")
+	} else {
+		err = model.ApplyConfigChanges(changes)
+	}
+	setConfigImportAuditDiff(c, changes)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"dry_run": dryRun,
+			"changes": changes,
+		},
+	})
+}
+
+// setConfigImportAuditDiff 将导入的各项变更合并记录到审计日志，渠道字段以 channel.<名称>.<字段> 表示
+func setConfigImportAuditDiff(c *gin.Context, changes []*model.ConfigChange) {
+	before := make(map[string]any)
+	after := make(map[string]any)
+	for _, change := range changes {
+		for field, fieldChange := range change.Diff {
+			if change.Type == model.ConfigChangeTypeChannel {
+				field = fmt.Sprintf("channel.%s.%s", change.Key, field)
+			}
+			before[field] = fieldChange.Before
+			after[field] = fieldChange.After
+		}
+	}
+	model.SetAuditDiff(c, "config", before, after)
+}
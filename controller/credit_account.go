@@ -0,0 +1,182 @@
+package controller
+
+import (
+	"net/http"
+	"one-api/model"
+	"one-api/service"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetSelfCreditAccount 查询当前用户的计费方式、余额和可用额度
+func GetSelfCreditAccount(c *gin.Context) {
+	userId := c.GetInt("id")
+	account, err := model.GetCreditAccount(userId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	quota, err := model.GetUserQuota(userId, false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	available, _ := service.GetAvailableQuota(userId, 0)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"account":         account,
+			"quota":           quota,
+			"available_quota": available,
+		},
+	})
+}
+
+func GetCreditAccounts(c *gin.Context) {
+	p, pageSize := getPageQuery(c)
+	accounts, total, err := model.GetCreditAccounts(c.Query("billing_mode"), (p-1)*pageSize, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": map[string]any{
+			"items":     accounts,
+			"total":     total,
+			"page":      p,
+			"page_size": pageSize,
+		},
+	})
+}
+
+func GetCreditAccount(c *gin.Context) {
+	userId, _ := strconv.Atoi(c.Param("user_id"))
+	account, err := model.GetCreditAccount(userId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    account,
+	})
+}
+
+type updateCreditAccountRequest struct {
+	BillingMode     string `json:"billing_mode"`
+	CreditLimit     int    `json:"credit_limit"`
+	PaymentTermDays int    `json:"payment_term_days"`
+}
+
+// UpdateCreditAccount 设置用户的计费方式和授信额度，保存后按新的授信额度重新检查暂停状态
+func UpdateCreditAccount(c *gin.Context) {
+	userId, _ := strconv.Atoi(c.Param("user_id"))
+	var req updateCreditAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	if _, err := model.GetUserById(userId, false); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "用户不存在",
+		})
+		return
+	}
+	before, err := model.GetCreditAccount(userId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	err = model.SaveCreditAccount(&model.CreditAccount{
+		UserId:          userId,
+		BillingMode:     req.BillingMode,
+		CreditLimit:     req.CreditLimit,
+		PaymentTermDays: req.PaymentTermDays,
+	})
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	service.CheckCreditAccount(userId, true)
+	account, err := model.GetCreditAccount(userId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	model.SetAuditDiff(c, userId,
+		gin.H{"billing_mode": before.BillingMode, "credit_limit": before.CreditLimit, "payment_term_days": before.PaymentTermDays},
+		gin.H{"billing_mode": account.BillingMode, "credit_limit": account.CreditLimit, "payment_term_days": account.PaymentTermDays})
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    account,
+	})
+}
+
+// SuspendCreditAccount 手动暂停账户，需要管理员手动恢复
+func SuspendCreditAccount(c *gin.Context) {
+	userId, _ := strconv.Atoi(c.Param("user_id"))
+	if err := model.SuspendCreditAccount(userId); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	model.SetAuditAction(c, "suspend")
+	model.SetAuditDiff(c, userId, gin.H{"suspended": false}, gin.H{"suspended": true})
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// ResumeCreditAccount 恢复账户，仍超出授信额度或有逾期账单时会再次被自动暂停
+func ResumeCreditAccount(c *gin.Context) {
+	userId, _ := strconv.Atoi(c.Param("user_id"))
+	account, _, err := model.ResumeCreditAccount(userId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	model.SetAuditAction(c, "resume")
+	model.SetAuditDiff(c, userId, gin.H{"suspended": true}, gin.H{"suspended": account.Suspended})
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    account,
+	})
+}
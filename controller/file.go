@@ -0,0 +1,174 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/dto"
+	"one-api/model"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var supportedFilePurposes = map[string]bool{
+	dto.FilePurposeBatch: true,
+	"assistants":         true,
+	"fine-tune":          true,
+	"vision":             true,
+	"user_data":          true,
+	"evals":              true,
+}
+
+func openAIErrorJSON(c *gin.Context, statusCode int, code string, message string) {
+	c.JSON(statusCode, gin.H{
+		"error": dto.OpenAIError{
+			Message: message,
+			Type:    "invalid_request_error",
+			Code:    code,
+		},
+	})
+}
+
+func UploadFile(c *gin.Context) {
+	maxBytes := int64(constant.MaxUploadFileMB) << 20
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes+(1<<20))
+	purpose := c.PostForm("purpose")
+	if !supportedFilePurposes[purpose] {
+		openAIErrorJSON(c, http.StatusBadRequest, "invalid_purpose", fmt.Sprintf("invalid purpose: %s", purpose))
+		return
+	}
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		openAIErrorJSON(c, http.StatusBadRequest, "invalid_file", "file is required")
+		return
+	}
+	if fileHeader.Size > maxBytes {
+		openAIErrorJSON(c, http.StatusRequestEntityTooLarge, "file_too_large", fmt.Sprintf("file size exceeds the limit of %d MB", constant.MaxUploadFileMB))
+		return
+	}
+	f, err := fileHeader.Open()
+	if err != nil {
+		openAIErrorJSON(c, http.StatusBadRequest, "invalid_file", err.Error())
+		return
+	}
+	defer f.Close()
+	content, err := io.ReadAll(f)
+	if err != nil {
+		openAIErrorJSON(c, http.StatusBadRequest, "invalid_file", err.Error())
+		return
+	}
+	if purpose == dto.FilePurposeBatch {
+		if err := validateJsonlContent(content); err != nil {
+			openAIErrorJSON(c, http.StatusBadRequest, "invalid_file_format", err.Error())
+			return
+		}
+	}
+	file := &model.File{
+		FileId:    "file-" + common.GetUUID(),
+		UserId:    c.GetInt("id"),
+		TokenId:   c.GetInt("token_id"),
+		Purpose:   purpose,
+		Filename:  fileHeader.Filename,
+		Bytes:     int64(len(content)),
+		Status:    dto.FileStatusProcessed,
+		CreatedAt: common.GetTimestamp(),
+		Content:   content,
+	}
+	if err := file.Insert(); err != nil {
+		common.LogError(c, "failed to save file: "+err.Error())
+		openAIErrorJSON(c, http.StatusInternalServerError, "save_file_failed", "failed to save file")
+		return
+	}
+	c.JSON(http.StatusOK, file.ToOpenAIFile())
+}
+
+// validateJsonlContent 校验批处理输入文件每一个非空行都是合法的 JSON
+func validateJsonlContent(content []byte) error {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 64*1024), len(content)+1)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var v map[string]any
+		if err := common.DecodeJson(line, &v); err != nil {
+			return fmt.Errorf("line %d is not a valid JSON object", lineNum)
+		}
+	}
+	return scanner.Err()
+}
+
+func ListFiles(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 || limit > 10000 {
+		limit = 10000
+	}
+	files, err := model.GetUserFiles(c.GetInt("id"), c.GetInt("token_id"), c.Query("purpose"), limit)
+	if err != nil {
+		openAIErrorJSON(c, http.StatusInternalServerError, "list_files_failed", err.Error())
+		return
+	}
+	data := make([]dto.OpenAIFile, 0, len(files))
+	for _, file := range files {
+		data = append(data, file.ToOpenAIFile())
+	}
+	c.JSON(http.StatusOK, dto.OpenAIFileList{
+		Object: "list",
+		Data:   data,
+	})
+}
+
+func RetrieveFile(c *gin.Context) {
+	file, err := model.GetUserFileById(c.Param("id"), c.GetInt("id"), c.GetInt("token_id"))
+	if err != nil {
+		fileNotFound(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, file.ToOpenAIFile())
+}
+
+func RetrieveFileContent(c *gin.Context) {
+	file, err := model.GetUserFileContentById(c.Param("id"), c.GetInt("id"), c.GetInt("token_id"))
+	if err != nil {
+		fileNotFound(c, err)
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file.Filename))
+	c.Data(http.StatusOK, "application/octet-stream", file.Content)
+}
+
+func DeleteFile(c *gin.Context) {
+	fileId := c.Param("id")
+	deleted, err := model.DeleteUserFileById(fileId, c.GetInt("id"), c.GetInt("token_id"))
+	if err != nil {
+		openAIErrorJSON(c, http.StatusInternalServerError, "delete_file_failed", err.Error())
+		return
+	}
+	if deleted == 0 {
+		fileNotFound(c, gorm.ErrRecordNotFound)
+		return
+	}
+	c.JSON(http.StatusOK, dto.OpenAIFileDeleteResponse{
+		ID:      fileId,
+		Object:  "file",
+		Deleted: true,
+	})
+}
+
+func fileNotFound(c *gin.Context, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		openAIErrorJSON(c, http.StatusNotFound, "file_not_found", fmt.Sprintf("No such File object: %s", c.Param("id")))
+		return
+	}
+	openAIErrorJSON(c, http.StatusInternalServerError, "get_file_failed", err.Error())
+}
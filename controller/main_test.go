@@ -0,0 +1,31 @@
+package controller
+
+import (
+	"one-api/common"
+	"one-api/model"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// setupTestDB 使用内存 sqlite 替换 model.DB 和 model.LOG_DB 并迁移 models，测试期间关闭 Redis 和批量更新，结束后恢复
+func setupTestDB(t *testing.T, models ...any) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 内存数据库的每个连接是独立的数据库，只能使用一个连接
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err = db.AutoMigrate(models...); err != nil {
+		t.Fatal(err)
+	}
+	oldDB, oldLogDB, oldRedis, oldBatch := model.DB, model.LOG_DB, common.RedisEnabled, common.BatchUpdateEnabled
+	model.DB, model.LOG_DB, common.RedisEnabled, common.BatchUpdateEnabled = db, db, false, false
+	t.Cleanup(func() {
+		model.DB, model.LOG_DB, common.RedisEnabled, common.BatchUpdateEnabled = oldDB, oldLogDB, oldRedis, oldBatch
+	})
+	return db
+}
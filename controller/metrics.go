@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"one-api/common"
+	"one-api/constant"
+	"one-api/model"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	channelBalanceDesc = prometheus.NewDesc("new_api_channel_balance",
+		"Last known balance of channels in USD.", []string{"channel", "name", "type"}, nil)
+	batchUpdatePendingDesc = prometheus.NewDesc("new_api_batch_update_pending",
+		"Number of records waiting for the batch updater to write to the database.", []string{"type"}, nil)
+	batchUnfinishedDesc = prometheus.NewDesc("new_api_batch_unfinished",
+		"Number of unfinished batches.", nil, nil)
+	batchRunningDesc = prometheus.NewDesc("new_api_batch_running",
+		"Number of batches being executed on this node.", nil, nil)
+)
+
+// metricsCollector 在采集时读取渠道余额、批量更新队列长度和批处理数量
+type metricsCollector struct{}
+
+func (metricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- channelBalanceDesc
+	ch <- batchUpdatePendingDesc
+	ch <- batchUnfinishedDesc
+	ch <- batchRunningDesc
+}
+
+func (metricsCollector) Collect(ch chan<- prometheus.Metric) {
+	channels, err := model.GetAllChannels(0, 0, true, false)
+	if err != nil {
+		common.SysError("failed to collect channel metrics: " + err.Error())
+	}
+	for _, channel := range channels {
+		ch <- prometheus.MustNewConstMetric(channelBalanceDesc, prometheus.GaugeValue, channel.Balance,
+			strconv.Itoa(channel.Id), channel.Name, strconv.Itoa(channel.Type))
+	}
+	for i, count := range model.GetBatchUpdatePendingCounts() {
+		ch <- prometheus.MustNewConstMetric(batchUpdatePendingDesc, prometheus.GaugeValue, float64(count), model.BatchUpdateTypeNames[i])
+	}
+	unfinished, err := model.CountUnfinishedTasks(constant.TaskPlatformBatch)
+	if err != nil {
+		common.SysError("failed to collect batch metrics: " + err.Error())
+	}
+	ch <- prometheus.MustNewConstMetric(batchUnfinishedDesc, prometheus.GaugeValue, float64(unfinished))
+	running := 0
+	runningBatches.Range(func(key, value any) bool {
+		running++
+		return true
+	})
+	ch <- prometheus.MustNewConstMetric(batchRunningDesc, prometheus.GaugeValue, float64(running))
+}
+
+func init() {
+	prometheus.MustRegister(metricsCollector{})
+}
+
+var metricsHandler = promhttp.Handler()
+
+func Metrics(c *gin.Context) {
+	metricsHandler.ServeHTTP(c.Writer, c.Request)
+}
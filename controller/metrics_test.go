@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/model"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func scrapeMetrics(t *testing.T) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	Metrics(c)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	return w.Body.String()
+}
+
+func TestMetricsCollector(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	if len(model.BatchUpdateTypeNames) != model.BatchUpdateTypeCount {
+		t.Fatalf("batch update type names = %v, want %d names", model.BatchUpdateTypeNames, model.BatchUpdateTypeCount)
+	}
+	db := setupTestDB(t, &model.Channel{}, &model.Task{})
+	if err := db.Create(&model.Channel{Id: 1, Name: "main", Type: common.ChannelTypeOpenAI, Key: "sk", Balance: 12.5}).Error; err != nil {
+		t.Fatal(err)
+	}
+	for i, progress := range []string{"50%", "100%"} {
+		task := &model.Task{TaskID: fmt.Sprintf("batch_%d", i), Platform: constant.TaskPlatformBatch, Progress: progress}
+		if err := task.Insert(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runningBatches.Store(int64(100), true)
+	t.Cleanup(func() { runningBatches.Delete(int64(100)) })
+
+	// 批量更新开启时额度变化先进入队列，同一用户的变化合并为一条，队列长度按类型上报
+	common.BatchUpdateEnabled = true
+	for _, userId := range []int{9001, 9002, 9001} {
+		if err := model.IncreaseUserQuota(userId, 10, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pending := model.GetBatchUpdatePendingCounts()[model.BatchUpdateTypeUserQuota]
+	if pending < 2 {
+		t.Errorf("pending user quota records = %d, want at least 2", pending)
+	}
+
+	body := scrapeMetrics(t)
+	wantLines := []string{
+		`new_api_channel_balance{channel="1",name="main",type="1"} 12.5`,
+		fmt.Sprintf(`new_api_batch_update_pending{type="user_quota"} %d`, pending),
+		`new_api_batch_update_pending{type="org_quota"} 0`,
+		`new_api_batch_unfinished 1`,
+		`new_api_batch_running 1`,
+	}
+	for _, line := range wantLines {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("metrics missing %q", line)
+		}
+	}
+	if strings.Contains(body, "new_api_batch_queue_depth") {
+		t.Error("old batch queue depth gauge still exported")
+	}
+}
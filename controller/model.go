@@ -125,6 +125,10 @@ func init() {
 	}
 	channelId2Models = make(map[int][]string)
 	for i := 1; i <= common.ChannelTypeDummy; i++ {
+		if platform := relay.GetTaskPlatform(i); platform != "" {
+			channelId2Models[i] = relay.GetTaskAdaptor(platform).GetModelList()
+			continue
+		}
 		apiType, success := relayconstant.ChannelType2APIType(i)
 		if !success || apiType == relayconstant.APITypeAIProxyLibrary {
 			continue
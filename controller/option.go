@@ -7,7 +7,6 @@ import (
 	"one-api/model"
 	"one-api/setting"
 	"one-api/setting/system_setting"
-	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -16,7 +15,7 @@ func GetOptions(c *gin.Context) {
 	var options []*model.Option
 	common.OptionMapRWMutex.Lock()
 	for k, v := range common.OptionMap {
-		if strings.HasSuffix(k, "Token") || strings.HasSuffix(k, "Secret") || strings.HasSuffix(k, "Key") {
+		if model.IsSensitiveField(k) {
 			continue
 		}
 		options = append(options, &model.Option{
@@ -112,6 +111,9 @@ func UpdateOption(c *gin.Context) {
 		}
 
 	}
+	common.OptionMapRWMutex.RLock()
+	oldValue := common.OptionMap[option.Key]
+	common.OptionMapRWMutex.RUnlock()
 	err = model.UpdateOption(option.Key, option.Value)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -120,6 +122,8 @@ func UpdateOption(c *gin.Context) {
 		})
 		return
 	}
+	before, after := model.OptionAuditValues(option.Key, oldValue, option.Value)
+	model.SetAuditDiff(c, option.Key, before, after)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"one-api/common"
+	"one-api/model"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetOptionsHidesSecrets(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	common.OptionMapRWMutex.Lock()
+	oldOptionMap := common.OptionMap
+	common.OptionMap = map[string]string{
+		"stripe.secret_key":     "sk_live_x",
+		"stripe.webhook_secret": "whsec_x",
+		"SMTPToken":             "smtp",
+		"GitHubClientSecret":    "gh",
+		"EpayKey":               "epay",
+		"two_factor.password":   "pw",
+		"stripe.currency":       "usd",
+		"SystemName":            "New API",
+	}
+	common.OptionMapRWMutex.Unlock()
+	t.Cleanup(func() {
+		common.OptionMapRWMutex.Lock()
+		common.OptionMap = oldOptionMap
+		common.OptionMapRWMutex.Unlock()
+	})
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	GetOptions(c)
+	var resp struct {
+		Data []*model.Option `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]bool)
+	for _, option := range resp.Data {
+		got[option.Key] = true
+	}
+	if len(got) != 2 || !got["stripe.currency"] || !got["SystemName"] {
+		t.Errorf("returned options = %v", got)
+	}
+}
@@ -0,0 +1,397 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetAllOrganizations(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	if p < 1 {
+		p = 1
+	}
+	if pageSize < 1 {
+		pageSize = common.ItemsPerPage
+	}
+	orgs, total, err := model.GetAllOrganizations((p-1)*pageSize, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"items":     orgs,
+			"total":     total,
+			"page":      p,
+			"page_size": pageSize,
+		},
+	})
+}
+
+func GetUserOrganizations(c *gin.Context) {
+	orgs, err := model.GetUserOrganizations(c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    orgs,
+	})
+}
+
+func GetOrganization(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	org, err := model.GetOrganizationById(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": model.UserOrganization{
+			Organization: *org,
+			Role:         c.GetInt("org_role"),
+		},
+	})
+}
+
+func validateOrganization(org *model.Organization) error {
+	if org.Name == "" {
+		return errors.New("组织名称不能为空")
+	}
+	if len(org.Name) > 64 {
+		return errors.New("组织名称过长")
+	}
+	if org.Quota < 0 {
+		return errors.New("组织额度不能为负数")
+	}
+	return nil
+}
+
+func AddOrganization(c *gin.Context) {
+	org := model.Organization{}
+	err := c.ShouldBindJSON(&org)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err = validateOrganization(&org); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if _, err = model.GetUserById(org.OwnerId, false); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "组织所有者不存在",
+		})
+		return
+	}
+	cleanOrg := model.Organization{
+		Name:        org.Name,
+		Description: org.Description,
+		Status:      common.OrganizationStatusEnabled,
+		Quota:       org.Quota,
+		OwnerId:     org.OwnerId,
+	}
+	err = cleanOrg.Insert()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    cleanOrg,
+	})
+}
+
+func UpdateOrganization(c *gin.Context) {
+	org := model.Organization{}
+	err := c.ShouldBindJSON(&org)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err = validateOrganization(&org); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	cleanOrg, err := model.GetOrganizationById(org.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	originOrg := *cleanOrg
+	cleanOrg.Name = org.Name
+	cleanOrg.Description = org.Description
+	cleanOrg.Status = org.Status
+	cleanOrg.Quota = org.Quota
+	err = cleanOrg.Update()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	model.SetAuditDiff(c, cleanOrg.Id, originOrg, cleanOrg)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    cleanOrg,
+	})
+}
+
+func DeleteOrganization(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	org, err := model.GetOrganizationById(id)
+	if err == nil {
+		err = org.Delete()
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	model.SetAuditDiff(c, id, org, nil)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+func GetOrganizationMembers(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	members, err := model.GetOrganizationMembers(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    members,
+	})
+}
+
+type organizationMemberRequest struct {
+	UserId   int    `json:"user_id"`
+	Username string `json:"username"`
+	Role     int    `json:"role"`
+}
+
+// checkOrgMemberRole 只能授予或管理低于自身的角色，因此组织管理员管理成员，所有者管理管理员
+func checkOrgMemberRole(c *gin.Context, role int) error {
+	if role != common.OrgRoleMember && role != common.OrgRoleAdmin {
+		return errors.New("无效的组织角色")
+	}
+	if role >= c.GetInt("org_role") {
+		return errors.New("无权进行此操作，组织权限不足")
+	}
+	return nil
+}
+
+func checkOrgMemberManageable(c *gin.Context, orgId int, userId int) error {
+	role, err := model.GetOrgMemberRole(orgId, userId)
+	if err != nil {
+		return errors.New("该用户不是组织成员")
+	}
+	if role >= c.GetInt("org_role") {
+		return errors.New("无权进行此操作，组织权限不足")
+	}
+	return nil
+}
+
+func AddOrganizationMember(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	req := organizationMemberRequest{}
+	err := c.ShouldBindJSON(&req)
+	if err == nil {
+		if req.Role == 0 {
+			req.Role = common.OrgRoleMember
+		}
+		err = checkOrgMemberRole(c, req.Role)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	userId, err := model.GetUserIdByUsername(req.Username)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "用户不存在",
+		})
+		return
+	}
+	err = model.AddOrganizationMember(id, userId, req.Role)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+func UpdateOrganizationMember(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	req := organizationMemberRequest{}
+	err := c.ShouldBindJSON(&req)
+	if err == nil {
+		err = checkOrgMemberRole(c, req.Role)
+	}
+	if err == nil {
+		err = checkOrgMemberManageable(c, id, req.UserId)
+	}
+	if err == nil {
+		err = model.UpdateOrganizationMemberRole(id, req.UserId, req.Role)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+func RemoveOrganizationMember(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	userId, _ := strconv.Atoi(c.Param("user_id"))
+	err := checkOrgMemberManageable(c, id, userId)
+	if err == nil {
+		err = model.RemoveOrganizationMember(id, userId)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+func GetOrganizationLogs(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	p, _ := strconv.Atoi(c.Query("p"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+	if p < 1 {
+		p = 1
+	}
+	if pageSize <= 0 {
+		pageSize = common.ItemsPerPage
+	}
+	if pageSize > 100 {
+		pageSize = 100
+	}
+	logType, _ := strconv.Atoi(c.Query("type"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	username := c.Query("username")
+	tokenName := c.Query("token_name")
+	modelName := c.Query("model_name")
+	logs, total, err := model.GetOrgLogs(id, logType, startTimestamp, endTimestamp, modelName, username, tokenName, (p-1)*pageSize, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": map[string]any{
+			"items":     logs,
+			"total":     total,
+			"page":      p,
+			"page_size": pageSize,
+		},
+	})
+}
+
+func GetOrganizationQuotaDates(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	// 判断时间跨度是否超过 1 个月
+	if endTimestamp-startTimestamp > 2592000 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "时间跨度不能超过 1 个月",
+		})
+		return
+	}
+	dates, err := model.GetQuotaDataByOrgId(id, startTimestamp, endTimestamp)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    dates,
+	})
+}
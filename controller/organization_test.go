@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"net/http/httptest"
+	"one-api/common"
+	"one-api/model"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newOrgRoleContext(role int) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Set("org_role", role)
+	return c
+}
+
+func TestCheckOrgMemberRole(t *testing.T) {
+	tests := []struct {
+		name    string
+		actor   int
+		role    int
+		allowed bool
+	}{
+		{"owner grants admin", common.OrgRoleOwner, common.OrgRoleAdmin, true},
+		{"owner grants member", common.OrgRoleOwner, common.OrgRoleMember, true},
+		{"owner cannot grant owner", common.OrgRoleOwner, common.OrgRoleOwner, false},
+		{"admin grants member", common.OrgRoleAdmin, common.OrgRoleMember, true},
+		{"admin cannot grant admin", common.OrgRoleAdmin, common.OrgRoleAdmin, false},
+		{"member cannot grant member", common.OrgRoleMember, common.OrgRoleMember, false},
+		{"invalid role", common.OrgRoleOwner, 5, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkOrgMemberRole(newOrgRoleContext(tt.actor), tt.role)
+			if (err == nil) != tt.allowed {
+				t.Errorf("err = %v, want allowed %v", err, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestCheckOrgMemberManageable(t *testing.T) {
+	setupTestDB(t, &model.Organization{}, &model.OrganizationMember{})
+	org := &model.Organization{Name: "org", Status: common.OrganizationStatusEnabled, OwnerId: 1}
+	if err := org.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	if err := model.AddOrganizationMember(org.Id, 2, common.OrgRoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	if err := model.AddOrganizationMember(org.Id, 3, common.OrgRoleMember); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		actor   int
+		target  int
+		allowed bool
+	}{
+		{"owner manages admin", common.OrgRoleOwner, 2, true},
+		{"owner manages member", common.OrgRoleOwner, 3, true},
+		{"owner cannot manage owner", common.OrgRoleOwner, 1, false},
+		{"admin manages member", common.OrgRoleAdmin, 3, true},
+		{"admin cannot manage admin", common.OrgRoleAdmin, 2, false},
+		{"admin cannot manage owner", common.OrgRoleAdmin, 1, false},
+		{"member cannot manage member", common.OrgRoleMember, 3, false},
+		{"not a member", common.OrgRoleOwner, 4, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkOrgMemberManageable(newOrgRoleContext(tt.actor), org.Id, tt.target)
+			if (err == nil) != tt.allowed {
+				t.Errorf("err = %v, want allowed %v", err, tt.allowed)
+			}
+		})
+	}
+}
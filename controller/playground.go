@@ -32,6 +32,12 @@ func Playground(c *gin.Context) {
 		return
 	}
 
+	// playground 不经过令牌鉴权，需要单独检查后付费账户是否已暂停
+	if err := model.CheckCreditAccount(c.GetInt("id")); err != nil {
+		openaiErr = service.OpenAIErrorWrapperLocal(err, "account_suspended", http.StatusForbidden)
+		return
+	}
+
 	playgroundRequest := &dto.PlayGroundRequest{}
 	err := common.UnmarshalBodyReusable(c, playgroundRequest)
 	if err != nil {
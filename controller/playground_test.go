@@ -0,0 +1,43 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"one-api/model"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPlaygroundRejectsSuspendedAccount(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB(t, &model.CreditAccount{})
+	db.Create(&model.CreditAccount{UserId: 1, BillingMode: model.BillingModePostpaid, CreditLimit: 1000,
+		Suspended: true, SuspendReason: model.CreditSuspendReasonLimitExceeded})
+	db.Create(&model.CreditAccount{UserId: 2, BillingMode: model.BillingModePostpaid, CreditLimit: 1000})
+
+	tests := []struct {
+		name   string
+		userId int
+		status int
+		code   string
+	}{
+		{"suspended", 1, http.StatusForbidden, "account_suspended"},
+		// 未暂停的账户继续处理请求，因缺少模型在下一步被拒绝
+		{"active", 2, http.StatusBadRequest, "model_required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/pg/chat/completions", strings.NewReader(`{"messages":[]}`))
+			c.Request.Header.Set("Content-Type", "application/json")
+			c.Set("id", tt.userId)
+			Playground(c)
+			if w.Code != tt.status || !strings.Contains(w.Body.String(), tt.code) {
+				t.Errorf("status = %d, body = %s", w.Code, w.Body.String())
+			}
+		})
+	}
+}
@@ -41,6 +41,7 @@ func GetPricing(c *gin.Context) {
 
 func ResetModelRatio(c *gin.Context) {
 	defaultStr := operation_setting.DefaultModelRatio2JSONString()
+	oldStr := operation_setting.ModelRatio2JSONString()
 	err := model.UpdateOption("ModelRatio", defaultStr)
 	if err != nil {
 		c.JSON(200, gin.H{
@@ -57,6 +58,8 @@ func ResetModelRatio(c *gin.Context) {
 		})
 		return
 	}
+	before, after := model.OptionAuditValues("ModelRatio", oldStr, defaultStr)
+	model.SetAuditDiff(c, "ModelRatio", before, after)
 	c.JSON(200, gin.H{
 		"success": true,
 		"message": "重置模型倍率成功",
@@ -126,6 +126,13 @@ func AddRedemption(c *gin.Context) {
 		})
 		return
 	}
+	if redemption.MaxUses < 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "可兑换次数不能为负数",
+		})
+		return
+	}
 	var keys []string
 	for i := 0; i < redemption.Count; i++ {
 		key := common.GetUUID()
@@ -135,6 +142,8 @@ func AddRedemption(c *gin.Context) {
 			Key:         key,
 			CreatedTime: common.GetTimestamp(),
 			Quota:       redemption.Quota,
+			MaxUses:     redemption.MaxUses,
+			ExpiredTime: redemption.ExpiredTime,
 		}
 		err = cleanRedemption.Insert()
 		if err != nil {
@@ -157,7 +166,15 @@ func AddRedemption(c *gin.Context) {
 
 func DeleteRedemption(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
-	err := model.DeleteRedemptionById(id)
+	originRedemption, err := model.GetRedemptionById(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	err = model.DeleteRedemptionById(id)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -165,6 +182,7 @@ func DeleteRedemption(c *gin.Context) {
 		})
 		return
 	}
+	model.SetAuditDiff(c, id, originRedemption, nil)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -191,6 +209,7 @@ func UpdateRedemption(c *gin.Context) {
 		})
 		return
 	}
+	originRedemption := *cleanRedemption
 	if statusOnly != "" {
 		cleanRedemption.Status = redemption.Status
 	} else {
@@ -206,6 +225,7 @@ func UpdateRedemption(c *gin.Context) {
 		})
 		return
 	}
+	model.SetAuditDiff(c, cleanRedemption.Id, originRedemption, cleanRedemption)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -0,0 +1,322 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 单次最多生成的兑换码个数
+const maxRedemptionCampaignCodes = 1000
+
+type redemptionCampaignRequest struct {
+	model.RedemptionCampaign
+	// Count 生成的兑换码个数
+	Count int `json:"count"`
+	// MaxUses 每个兑换码可兑换的次数，默认为 1
+	MaxUses int `json:"max_uses"`
+	// CodeExpiredTime 兑换码的过期时间，0 表示跟随活动
+	CodeExpiredTime int64 `json:"code_expired_time"`
+}
+
+func validateCampaignCodes(c *gin.Context, req *redemptionCampaignRequest) bool {
+	if req.MaxUses == 0 {
+		req.MaxUses = 1
+	}
+	message := ""
+	switch {
+	case req.Count <= 0:
+		message = "兑换码个数必须大于0"
+	case req.Count > maxRedemptionCampaignCodes:
+		message = fmt.Sprintf("一次兑换码批量生成的个数不能大于 %d", maxRedemptionCampaignCodes)
+	case req.MaxUses < 0:
+		message = "可兑换次数不能为负数"
+	}
+	if message != "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": message,
+		})
+		return false
+	}
+	return true
+}
+
+func GetRedemptionCampaigns(c *gin.Context) {
+	p, pageSize := getPageQuery(c)
+	campaigns, total, err := model.GetRedemptionCampaigns(c.Query("keyword"), (p-1)*pageSize, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"items":     campaigns,
+			"total":     total,
+			"page":      p,
+			"page_size": pageSize,
+		},
+	})
+}
+
+// GetRedemptionCampaign 查询活动及其统计
+func GetRedemptionCampaign(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	campaign, err := model.GetRedemptionCampaignById(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "活动不存在",
+		})
+		return
+	}
+	stats, err := model.GetRedemptionCampaignStats(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"campaign": campaign,
+			"stats":    stats,
+		},
+	})
+}
+
+// AddRedemptionCampaign 创建活动并生成兑换码，返回生成的兑换码
+func AddRedemptionCampaign(c *gin.Context) {
+	var req redemptionCampaignRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	campaign := req.RedemptionCampaign
+	campaign.Id = 0
+	campaign.Status = common.RedemptionCodeStatusEnabled
+	campaign.CreatedBy = c.GetInt("id")
+	if campaign.RewardType == "" {
+		campaign.RewardType = model.RedemptionRewardQuota
+	}
+	if err := campaign.Validate(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if !validateCampaignCodes(c, &req) {
+		return
+	}
+	keys, err := model.CreateRedemptionCampaign(&campaign, req.Count, req.MaxUses, req.CodeExpiredTime)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	model.SetAuditDiff(c, campaign.Id, nil, campaign)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"campaign": campaign,
+			"keys":     keys,
+		},
+	})
+}
+
+// AddRedemptionCampaignCodes 为活动追加兑换码
+func AddRedemptionCampaignCodes(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var req redemptionCampaignRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if !validateCampaignCodes(c, &req) {
+		return
+	}
+	keys, err := model.AddRedemptionCampaignCodes(id, req.Count, req.MaxUses, req.CodeExpiredTime, c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	model.SetAuditAction(c, "add_codes")
+	model.SetAuditDiff(c, id, nil, gin.H{"count": len(keys), "max_uses": req.MaxUses, "expired_time": req.CodeExpiredTime})
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    keys,
+	})
+}
+
+// UpdateRedemptionCampaign 更新活动，status 为 2 时活动下的兑换码均不可兑换
+func UpdateRedemptionCampaign(c *gin.Context) {
+	var req model.RedemptionCampaign
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	campaign, err := model.GetRedemptionCampaignById(req.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "活动不存在",
+		})
+		return
+	}
+	origin := *campaign
+	campaign.Name = req.Name
+	campaign.Description = req.Description
+	campaign.RewardType = req.RewardType
+	campaign.Quota = req.Quota
+	campaign.GrantGroup = req.GrantGroup
+	campaign.SourceGroup = req.SourceGroup
+	campaign.TokenValidDays = req.TokenValidDays
+	campaign.PerUserLimit = req.PerUserLimit
+	campaign.ExpiredTime = req.ExpiredTime
+	if req.Status != 0 {
+		campaign.Status = req.Status
+	}
+	if err = campaign.Validate(); err == nil {
+		err = campaign.Update()
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	model.SetAuditDiff(c, campaign.Id, origin, campaign)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    campaign,
+	})
+}
+
+// GetRedemptionCampaignCodes 查询活动下的兑换码，unused=true 时只返回未使用的
+func GetRedemptionCampaignCodes(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	p, pageSize := getPageQuery(c)
+	codes, total, err := model.GetRedemptionCampaignCodes(id, c.Query("unused") == "true", (p-1)*pageSize, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"items":     codes,
+			"total":     total,
+			"page":      p,
+			"page_size": pageSize,
+		},
+	})
+}
+
+func GetRedemptionCampaignRecords(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	p, pageSize := getPageQuery(c)
+	records, total, err := model.GetRedemptionCampaignRecords(id, (p-1)*pageSize, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"items":     records,
+			"total":     total,
+			"page":      p,
+			"page_size": pageSize,
+		},
+	})
+}
+
+// ExportRedemptionCampaignCodes 导出活动下未使用的兑换码为 CSV
+func ExportRedemptionCampaignCodes(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	campaign, err := model.GetRedemptionCampaignById(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "活动不存在",
+		})
+		return
+	}
+	codes, _, err := model.GetRedemptionCampaignCodes(id, true, 0, 0)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	formatTime := func(timestamp int64) string {
+		if timestamp == 0 {
+			return ""
+		}
+		return time.Unix(timestamp, 0).Format("2006-01-02 15:04:05")
+	}
+	var buf bytes.Buffer
+	buf.WriteString("\xEF\xBB\xBF")
+	w := csv.NewWriter(&buf)
+	rows := [][]string{{"id", "key", "campaign", "max_uses", "expired_time", "created_time"}}
+	for _, code := range codes {
+		codeExpiredTime := code.ExpiredTime
+		if codeExpiredTime == 0 {
+			codeExpiredTime = campaign.ExpiredTime
+		}
+		rows = append(rows, []string{strconv.Itoa(code.Id), code.Key, campaign.Name, strconv.Itoa(code.MaxUses),
+			formatTime(codeExpiredTime), formatTime(code.CreatedTime)})
+	}
+	if err = w.WriteAll(rows); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=campaign-%d-unused-codes.csv", campaign.Id))
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+}
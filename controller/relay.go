@@ -6,10 +6,12 @@ import (
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
 	"io"
 	"log"
 	"net/http"
 	"one-api/common"
+	constant2 "one-api/constant"
 	"one-api/dto"
 	"one-api/middleware"
 	"one-api/model"
@@ -18,7 +20,9 @@ import (
 	relayconstant "one-api/relay/constant"
 	"one-api/relay/helper"
 	"one-api/service"
+	"strconv"
 	"strings"
+	"time"
 )
 
 func relayHandler(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusCode {
@@ -26,6 +30,8 @@ func relayHandler(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusCode
 	switch relayMode {
 	case relayconstant.RelayModeImagesGenerations:
 		err = relay.ImageHelper(c)
+	case relayconstant.RelayModeImagesEdits, relayconstant.RelayModeImagesVariations:
+		err = relay.ImageEditHelper(c)
 	case relayconstant.RelayModeAudioSpeech:
 		fallthrough
 	case relayconstant.RelayModeAudioTranslation:
@@ -36,6 +42,8 @@ func relayHandler(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusCode
 		err = relay.RerankHelper(c, relayMode)
 	case relayconstant.RelayModeEmbeddings:
 		err = relay.EmbeddingHelper(c)
+	case relayconstant.RelayModeResponses:
+		err = relay.ResponsesHelper(c)
 	default:
 		err = relay.TextHelper(c)
 	}
@@ -49,28 +57,46 @@ func Relay(c *gin.Context) {
 	originalModel := c.GetString("original_model")
 	var openaiErr *dto.OpenAIErrorWithStatusCode
 
-	for i := 0; i <= common.RetryTimes; i++ {
-		channel, err := getChannel(c, group, originalModel, i)
-		if err != nil {
-			common.LogError(c, err.Error())
-			openaiErr = service.OpenAIErrorWrapperLocal(err, "get_channel_failed", http.StatusInternalServerError)
-			break
+	models := append([]string{originalModel}, middleware.GetFallbackModels(c, originalModel)...)
+	if err := relay.ModerateRequest(c, relayMode); err != nil {
+		openaiErr = service.OpenAIErrorWrapperLocal(err, "content_moderation_blocked", http.StatusBadRequest)
+		openaiErr.Error.Message = common.MessageWithRequestId(openaiErr.Error.Message, requestId)
+		c.JSON(openaiErr.StatusCode, gin.H{
+			"error": openaiErr.Error,
+		})
+		return
+	}
+	for m, modelName := range models {
+		if m > 0 {
+			addFallbackModel(c, models[m-1], modelName)
 		}
+		for i := 0; i <= common.RetryTimes; i++ {
+			channel, err := getRelayChannel(c, group, modelName, m, i)
+			if err != nil {
+				common.LogError(c, err.Error())
+				openaiErr = service.OpenAIErrorWrapperLocal(err, "get_channel_failed", http.StatusInternalServerError)
+				break
+			}
 
-		openaiErr = relayRequest(c, relayMode, channel)
+			openaiErr = relayRequest(c, relayMode, channel)
 
-		if openaiErr == nil {
-			return // 成功处理请求，直接返回
-		}
+			if openaiErr == nil {
+				return // 成功处理请求，直接返回
+			}
 
-		go processChannelError(c, channel.Id, channel.Type, channel.Name, channel.GetAutoBan(), openaiErr)
+			go processChannelError(c, channel.Id, channel.Type, channel.Name, c.GetString("channel_key"), channel.GetAutoBan(), openaiErr)
 
-		if !shouldRetry(c, openaiErr, common.RetryTimes-i) {
+			if !shouldRetry(c, openaiErr, common.RetryTimes-i) {
+				break
+			}
+		}
+		if !shouldFallback(c, openaiErr) {
 			break
 		}
 	}
 	useChannel := c.GetStringSlice("use_channel")
 	if len(useChannel) > 1 {
+		common.RelayRetriesTotal.WithLabelValues(originalModel, group).Add(float64(len(useChannel) - 1))
 		retryLogStr := fmt.Sprintf("重试：%s", strings.Trim(strings.Join(strings.Fields(fmt.Sprint(useChannel)), "->"), "[]"))
 		common.LogInfo(c, retryLogStr)
 	}
@@ -113,28 +139,38 @@ func WssRelay(c *gin.Context) {
 	originalModel := c.GetString("original_model")
 	var openaiErr *dto.OpenAIErrorWithStatusCode
 
-	for i := 0; i <= common.RetryTimes; i++ {
-		channel, err := getChannel(c, group, originalModel, i)
-		if err != nil {
-			common.LogError(c, err.Error())
-			openaiErr = service.OpenAIErrorWrapperLocal(err, "get_channel_failed", http.StatusInternalServerError)
-			break
+	models := append([]string{originalModel}, middleware.GetFallbackModels(c, originalModel)...)
+	for m, modelName := range models {
+		if m > 0 {
+			addFallbackModel(c, models[m-1], modelName)
 		}
+		for i := 0; i <= common.RetryTimes; i++ {
+			channel, err := getRelayChannel(c, group, modelName, m, i)
+			if err != nil {
+				common.LogError(c, err.Error())
+				openaiErr = service.OpenAIErrorWrapperLocal(err, "get_channel_failed", http.StatusInternalServerError)
+				break
+			}
 
-		openaiErr = wssRequest(c, ws, relayMode, channel)
+			openaiErr = wssRequest(c, ws, relayMode, channel)
 
-		if openaiErr == nil {
-			return // 成功处理请求，直接返回
-		}
+			if openaiErr == nil {
+				return // 成功处理请求，直接返回
+			}
 
-		go processChannelError(c, channel.Id, channel.Type, channel.Name, channel.GetAutoBan(), openaiErr)
+			go processChannelError(c, channel.Id, channel.Type, channel.Name, c.GetString("channel_key"), channel.GetAutoBan(), openaiErr)
 
-		if !shouldRetry(c, openaiErr, common.RetryTimes-i) {
+			if !shouldRetry(c, openaiErr, common.RetryTimes-i) {
+				break
+			}
+		}
+		if !shouldFallback(c, openaiErr) {
 			break
 		}
 	}
 	useChannel := c.GetStringSlice("use_channel")
 	if len(useChannel) > 1 {
+		common.RelayRetriesTotal.WithLabelValues(originalModel, group).Add(float64(len(useChannel) - 1))
 		retryLogStr := fmt.Sprintf("重试：%s", strings.Trim(strings.Join(strings.Fields(fmt.Sprint(useChannel)), "->"), "[]"))
 		common.LogInfo(c, retryLogStr)
 	}
@@ -155,30 +191,51 @@ func RelayClaude(c *gin.Context) {
 	originalModel := c.GetString("original_model")
 	var claudeErr *dto.ClaudeErrorWithStatusCode
 
-	for i := 0; i <= common.RetryTimes; i++ {
-		channel, err := getChannel(c, group, originalModel, i)
-		if err != nil {
-			common.LogError(c, err.Error())
-			claudeErr = service.ClaudeErrorWrapperLocal(err, "get_channel_failed", http.StatusInternalServerError)
-			break
+	models := append([]string{originalModel}, middleware.GetFallbackModels(c, originalModel)...)
+	if err := relay.ModerateClaudeRequest(c); err != nil {
+		claudeErr = service.ClaudeErrorWrapperLocal(err, "content_moderation_blocked", http.StatusBadRequest)
+		claudeErr.Error.Message = common.MessageWithRequestId(claudeErr.Error.Message, requestId)
+		c.JSON(claudeErr.StatusCode, gin.H{
+			"type":  "error",
+			"error": claudeErr.Error,
+		})
+		return
+	}
+	for m, modelName := range models {
+		if m > 0 {
+			addFallbackModel(c, models[m-1], modelName)
 		}
+		var openaiErr *dto.OpenAIErrorWithStatusCode
+		for i := 0; i <= common.RetryTimes; i++ {
+			channel, err := getRelayChannel(c, group, modelName, m, i)
+			if err != nil {
+				common.LogError(c, err.Error())
+				claudeErr = service.ClaudeErrorWrapperLocal(err, "get_channel_failed", http.StatusInternalServerError)
+				openaiErr = service.OpenAIErrorWrapperLocal(err, "get_channel_failed", http.StatusInternalServerError)
+				break
+			}
 
-		claudeErr = claudeRequest(c, channel)
+			claudeErr = claudeRequest(c, channel)
 
-		if claudeErr == nil {
-			return // 成功处理请求，直接返回
-		}
+			if claudeErr == nil {
+				return // 成功处理请求，直接返回
+			}
 
-		openaiErr := service.ClaudeErrorToOpenAIError(claudeErr)
+			openaiErr = service.ClaudeErrorToOpenAIError(claudeErr)
 
-		go processChannelError(c, channel.Id, channel.Type, channel.Name, channel.GetAutoBan(), openaiErr)
+			go processChannelError(c, channel.Id, channel.Type, channel.Name, c.GetString("channel_key"), channel.GetAutoBan(), openaiErr)
 
-		if !shouldRetry(c, openaiErr, common.RetryTimes-i) {
+			if !shouldRetry(c, openaiErr, common.RetryTimes-i) {
+				break
+			}
+		}
+		if !shouldFallback(c, openaiErr) {
 			break
 		}
 	}
 	useChannel := c.GetStringSlice("use_channel")
 	if len(useChannel) > 1 {
+		common.RelayRetriesTotal.WithLabelValues(originalModel, group).Add(float64(len(useChannel) - 1))
 		retryLogStr := fmt.Sprintf("重试：%s", strings.Trim(strings.Join(strings.Fields(fmt.Sprint(useChannel)), "->"), "[]"))
 		common.LogInfo(c, retryLogStr)
 	}
@@ -192,11 +249,106 @@ func RelayClaude(c *gin.Context) {
 	}
 }
 
+// RelayGemini 处理 Gemini 原生格式请求，/v1beta/models/{model}:generateContent
+func RelayGemini(c *gin.Context) {
+	requestId := c.GetString(common.RequestIdKey)
+	group := c.GetString("group")
+	originalModel := c.GetString("original_model")
+
+	_, action, _ := strings.Cut(c.Param("model"), ":")
+	if action != relay.GeminiActionGenerateContent && action != relay.GeminiActionStreamGenerateContent {
+		openaiErr := service.OpenAIErrorWrapperLocal(fmt.Errorf("unsupported method: %s", action), "unsupported_method", http.StatusNotFound)
+		abortWithGeminiError(c, openaiErr, requestId)
+		return
+	}
+
+	var openaiErr *dto.OpenAIErrorWithStatusCode
+	models := append([]string{originalModel}, middleware.GetFallbackModels(c, originalModel)...)
+	if err := relay.ModerateGeminiRequest(c); err != nil {
+		abortWithGeminiError(c, service.OpenAIErrorWrapperLocal(err, "content_moderation_blocked", http.StatusBadRequest), requestId)
+		return
+	}
+	for m, modelName := range models {
+		if m > 0 {
+			addFallbackModel(c, models[m-1], modelName)
+		}
+		for i := 0; i <= common.RetryTimes; i++ {
+			channel, err := getRelayChannel(c, group, modelName, m, i)
+			if err != nil {
+				common.LogError(c, err.Error())
+				openaiErr = service.OpenAIErrorWrapperLocal(err, "get_channel_failed", http.StatusInternalServerError)
+				break
+			}
+
+			openaiErr = geminiRequest(c, channel)
+
+			if openaiErr == nil {
+				return // 成功处理请求，直接返回
+			}
+
+			go processChannelError(c, channel.Id, channel.Type, channel.Name, c.GetString("channel_key"), channel.GetAutoBan(), openaiErr)
+
+			if !shouldRetry(c, openaiErr, common.RetryTimes-i) {
+				break
+			}
+		}
+		if !shouldFallback(c, openaiErr) {
+			break
+		}
+	}
+	useChannel := c.GetStringSlice("use_channel")
+	if len(useChannel) > 1 {
+		common.RelayRetriesTotal.WithLabelValues(originalModel, group).Add(float64(len(useChannel) - 1))
+		retryLogStr := fmt.Sprintf("重试：%s", strings.Trim(strings.Join(strings.Fields(fmt.Sprint(useChannel)), "->"), "[]"))
+		common.LogInfo(c, retryLogStr)
+	}
+
+	if openaiErr != nil {
+		abortWithGeminiError(c, openaiErr, requestId)
+	}
+}
+
+// abortWithGeminiError 按 Gemini 格式返回错误
+func abortWithGeminiError(c *gin.Context, openaiErr *dto.OpenAIErrorWithStatusCode, requestId string) {
+	status := "INTERNAL"
+	switch openaiErr.StatusCode {
+	case http.StatusBadRequest:
+		status = "INVALID_ARGUMENT"
+	case http.StatusUnauthorized:
+		status = "UNAUTHENTICATED"
+	case http.StatusForbidden:
+		status = "PERMISSION_DENIED"
+	case http.StatusNotFound:
+		status = "NOT_FOUND"
+	case http.StatusTooManyRequests:
+		status = "RESOURCE_EXHAUSTED"
+	case http.StatusServiceUnavailable:
+		status = "UNAVAILABLE"
+	}
+	c.JSON(openaiErr.StatusCode, gin.H{
+		"error": gin.H{
+			"code":    openaiErr.StatusCode,
+			"message": common.MessageWithRequestId(openaiErr.Error.Message, requestId),
+			"status":  status,
+		},
+	})
+}
+
 func relayRequest(c *gin.Context, relayMode int, channel *model.Channel) *dto.OpenAIErrorWithStatusCode {
 	addUsedChannel(c, channel.Id)
 	requestBody, _ := common.GetRequestBody(c)
 	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
-	return relayHandler(c, relayMode)
+	endSpan := startAttemptSpan(c, channel.Id)
+	writer := newChannelHealthWriter(c)
+	openaiErr := relayHandler(c, relayMode)
+	if openaiErr != nil {
+		writer.record(channel.Id, openaiErr.StatusCode, openaiErr.LocalError)
+		endSpan(openaiErr.StatusCode, errors.New(openaiErr.Error.Message))
+	} else {
+		writer.record(channel.Id, http.StatusOK, false)
+		endSpan(http.StatusOK, nil)
+	}
+	return openaiErr
 }
 
 func wssRequest(c *gin.Context, ws *websocket.Conn, relayMode int, channel *model.Channel) *dto.OpenAIErrorWithStatusCode {
@@ -210,7 +362,118 @@ func claudeRequest(c *gin.Context, channel *model.Channel) *dto.ClaudeErrorWithS
 	addUsedChannel(c, channel.Id)
 	requestBody, _ := common.GetRequestBody(c)
 	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
-	return relay.ClaudeHelper(c)
+	endSpan := startAttemptSpan(c, channel.Id)
+	writer := newChannelHealthWriter(c)
+	claudeErr := relay.ClaudeHelper(c)
+	if claudeErr != nil {
+		writer.record(channel.Id, claudeErr.StatusCode, claudeErr.LocalError)
+		endSpan(claudeErr.StatusCode, errors.New(claudeErr.Error.Message))
+	} else {
+		writer.record(channel.Id, http.StatusOK, false)
+		endSpan(http.StatusOK, nil)
+	}
+	return claudeErr
+}
+
+func geminiRequest(c *gin.Context, channel *model.Channel) *dto.OpenAIErrorWithStatusCode {
+	addUsedChannel(c, channel.Id)
+	requestBody, _ := common.GetRequestBody(c)
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+	endSpan := startAttemptSpan(c, channel.Id)
+	writer := newChannelHealthWriter(c)
+	openaiErr := relay.GeminiHelper(c)
+	if openaiErr != nil {
+		writer.record(channel.Id, openaiErr.StatusCode, openaiErr.LocalError)
+		endSpan(openaiErr.StatusCode, errors.New(openaiErr.Error.Message))
+	} else {
+		writer.record(channel.Id, http.StatusOK, false)
+		endSpan(http.StatusOK, nil)
+	}
+	return openaiErr
+}
+
+// channelHealthWriter 记录第一次向客户端写出数据的时间，作为渠道的首字时间
+type channelHealthWriter struct {
+	gin.ResponseWriter
+	c          *gin.Context
+	startTime  time.Time
+	firstWrite time.Time
+	streaming  bool
+}
+
+func newChannelHealthWriter(c *gin.Context) *channelHealthWriter {
+	writer := &channelHealthWriter{
+		ResponseWriter: c.Writer,
+		c:              c,
+		startTime:      time.Now(),
+	}
+	c.Writer = writer
+	return writer
+}
+
+func (w *channelHealthWriter) Write(data []byte) (int, error) {
+	w.markFirstWrite()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *channelHealthWriter) WriteString(s string) (int, error) {
+	w.markFirstWrite()
+	return w.ResponseWriter.WriteString(s)
+}
+
+// markFirstWrite 记录首字时间，流式响应计入进行中的流数量
+func (w *channelHealthWriter) markFirstWrite() {
+	if !w.firstWrite.IsZero() {
+		return
+	}
+	w.firstWrite = time.Now()
+	if strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+		w.streaming = true
+		common.RelayInFlightStreams.Inc()
+	}
+}
+
+// record 恢复原始 writer 并记录本次请求结果，本地错误不计入渠道健康度；
+// 上游 5xx、429 和超时计为失败，其余上游响应计为成功
+func (w *channelHealthWriter) record(channelId int, statusCode int, localError bool) {
+	w.c.Writer = w.ResponseWriter
+	if w.streaming {
+		common.RelayInFlightStreams.Dec()
+	}
+	// 命中响应缓存时没有请求上游，不计入渠道健康度和请求指标
+	if w.c.GetBool("response_cache_hit") {
+		return
+	}
+	labels := []string{w.c.GetString("original_model"), strconv.Itoa(channelId), w.c.GetString("group"), strconv.Itoa(statusCode)}
+	common.RelayRequestsTotal.WithLabelValues(labels...).Inc()
+	common.RelayRequestDuration.WithLabelValues(labels...).Observe(time.Since(w.startTime).Seconds())
+	if localError {
+		return
+	}
+	success := statusCode < http.StatusInternalServerError &&
+		statusCode != http.StatusTooManyRequests &&
+		statusCode != http.StatusRequestTimeout
+	var frt time.Duration
+	if !w.firstWrite.IsZero() {
+		frt = w.firstWrite.Sub(w.startTime)
+	}
+	model.RecordChannelResult(channelId, success, frt, time.Since(w.startTime))
+}
+
+// startAttemptSpan 为一次渠道尝试创建 span 并挂到请求 context 上，返回的函数结束 span 并恢复 context
+func startAttemptSpan(c *gin.Context, channelId int) func(statusCode int, err error) {
+	parent := c.Request.Context()
+	ctx, span := common.StartSpan(parent, "relay.attempt",
+		attribute.Int("channel.id", channelId),
+		attribute.String("model", c.GetString("original_model")),
+		attribute.Int("attempt", len(c.GetStringSlice("use_channel"))),
+	)
+	c.Request = c.Request.WithContext(ctx)
+	return func(statusCode int, err error) {
+		c.Request = c.Request.WithContext(parent)
+		span.SetAttributes(attribute.Int("http.response.status_code", statusCode))
+		common.EndSpan(span, err)
+	}
 }
 
 func addUsedChannel(c *gin.Context, channelId int) {
@@ -221,6 +484,10 @@ func addUsedChannel(c *gin.Context, channelId int) {
 
 func getChannel(c *gin.Context, group, originalModel string, retryCount int) (*model.Channel, error) {
 	if retryCount == 0 {
+		// 分发时原始模型没有可用渠道，返回 get_channel_failed 以便降级到其他模型
+		if message := c.GetString(constant2.ContextKeyNoChannelMessage); message != "" {
+			return nil, errors.New(message)
+		}
 		autoBan := c.GetBool("auto_ban")
 		autoBanInt := 1
 		if !autoBan {
@@ -241,6 +508,44 @@ func getChannel(c *gin.Context, group, originalModel string, retryCount int) (*m
 	return channel, nil
 }
 
+// getRelayChannel 获取第 modelIndex 个模型的第 retryCount 次尝试使用的渠道，原始模型沿用分发时选择的渠道
+func getRelayChannel(c *gin.Context, group, modelName string, modelIndex int, retryCount int) (*model.Channel, error) {
+	if modelIndex == 0 {
+		return getChannel(c, group, modelName, retryCount)
+	}
+	channel, err := model.CacheGetRandomSatisfiedChannel(group, modelName, retryCount)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("获取降级模型 %s 的渠道失败: %s", modelName, err.Error()))
+	}
+	if channel == nil {
+		return nil, errors.New(fmt.Sprintf("获取降级模型 %s 的渠道失败: channel not found", modelName))
+	}
+	middleware.SetupContextForSelectedChannel(c, channel, modelName)
+	return channel, nil
+}
+
+// addFallbackModel 记录降级路径，写入消费日志
+func addFallbackModel(c *gin.Context, from string, to string) {
+	common.LogInfo(c, fmt.Sprintf("模型 %s 的渠道均不可用，降级到模型 %s", from, to))
+	fallbackPath := c.GetStringSlice(constant2.ContextKeyFallbackPath)
+	if len(fallbackPath) == 0 {
+		fallbackPath = append(fallbackPath, from)
+	}
+	fallbackPath = append(fallbackPath, to)
+	c.Set(constant2.ContextKeyFallbackPath, fallbackPath)
+}
+
+// shouldFallback 当前模型的渠道全部失败后是否继续尝试降级链上的下一个模型
+func shouldFallback(c *gin.Context, openaiErr *dto.OpenAIErrorWithStatusCode) bool {
+	if openaiErr == nil {
+		return false
+	}
+	if openaiErr.Error.Code == "get_channel_failed" {
+		return true
+	}
+	return shouldRetry(c, openaiErr, 1)
+}
+
 func shouldRetry(c *gin.Context, openaiErr *dto.OpenAIErrorWithStatusCode, retryTimes int) bool {
 	if openaiErr == nil {
 		return false
@@ -284,12 +589,12 @@ func shouldRetry(c *gin.Context, openaiErr *dto.OpenAIErrorWithStatusCode, retry
 	return true
 }
 
-func processChannelError(c *gin.Context, channelId int, channelType int, channelName string, autoBan bool, err *dto.OpenAIErrorWithStatusCode) {
+func processChannelError(c *gin.Context, channelId int, channelType int, channelName string, channelKey string, autoBan bool, err *dto.OpenAIErrorWithStatusCode) {
 	// 不要使用context获取渠道信息，异步处理时可能会出现渠道信息不一致的情况
 	// do not use context to get channel info, there may be inconsistent channel info when processing asynchronously
 	common.LogError(c, fmt.Sprintf("relay error (channel #%d, status code: %d): %s", channelId, err.StatusCode, err.Error.Message))
 	if service.ShouldDisableChannel(channelType, err) && autoBan {
-		service.DisableChannel(channelId, channelName, err.Error.Message)
+		service.DisableChannel(channelId, channelName, channelKey, err.Error.Message)
 	}
 }
 
@@ -306,7 +611,11 @@ func RelayMidjourney(c *gin.Context) {
 	case relayconstant.RelayModeSwapFace:
 		err = relay.RelaySwapFace(c)
 	default:
-		err = relay.RelayMidjourneySubmit(c, relayMode)
+		if moderationErr := relay.ModerateRequest(c, relayMode); moderationErr != nil {
+			err = service.MidjourneyErrorWrapper(constant2.MjRequestError, moderationErr.Error())
+		} else {
+			err = relay.RelayMidjourneySubmit(c, relayMode)
+		}
 	}
 	//err = relayMidjourneySubmit(c, relayMode)
 	log.Println(err)
@@ -357,6 +666,11 @@ func RelayTask(c *gin.Context) {
 	group := c.GetString("group")
 	originalModel := c.GetString("original_model")
 	c.Set("use_channel", []string{fmt.Sprintf("%d", channelId)})
+	if err := relay.ModerateRequest(c, relayMode); err != nil {
+		taskErr := service.TaskErrorWrapperLocal(err, "content_moderation_blocked", http.StatusBadRequest)
+		c.JSON(taskErr.StatusCode, taskErr)
+		return
+	}
 	taskErr := taskRelayHandler(c, relayMode)
 	if taskErr == nil {
 		retryTimes = 0
@@ -380,6 +694,7 @@ func RelayTask(c *gin.Context) {
 	}
 	useChannel := c.GetStringSlice("use_channel")
 	if len(useChannel) > 1 {
+		common.RelayRetriesTotal.WithLabelValues(originalModel, group).Add(float64(len(useChannel) - 1))
 		retryLogStr := fmt.Sprintf("重试：%s", strings.Trim(strings.Join(strings.Fields(fmt.Sprint(useChannel)), "->"), "[]"))
 		common.LogInfo(c, retryLogStr)
 	}
@@ -394,7 +709,7 @@ func RelayTask(c *gin.Context) {
 func taskRelayHandler(c *gin.Context, relayMode int) *dto.TaskError {
 	var err *dto.TaskError
 	switch relayMode {
-	case relayconstant.RelayModeSunoFetch, relayconstant.RelayModeSunoFetchByID:
+	case relayconstant.RelayModeSunoFetch, relayconstant.RelayModeSunoFetchByID, relayconstant.RelayModeVideoFetchByID:
 		err = relay.RelayTaskFetch(c, relayMode)
 	default:
 		err = relay.RelayTaskSubmit(c, relayMode)
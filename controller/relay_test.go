@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/dto"
+	"one-api/model"
+	"one-api/service"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestShouldFallback(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	upstreamErr := func(statusCode int) *dto.OpenAIErrorWithStatusCode {
+		return service.OpenAIErrorWrapper(errors.New("upstream error"), "upstream_error", statusCode)
+	}
+	tests := []struct {
+		name        string
+		err         *dto.OpenAIErrorWithStatusCode
+		channelType int
+		specific    bool
+		want        bool
+	}{
+		{"success", nil, 0, false, false},
+		{"no channel", service.OpenAIErrorWrapperLocal(errors.New("channel not found"), "get_channel_failed", http.StatusInternalServerError), 0, false, true},
+		{"upstream 500", upstreamErr(http.StatusInternalServerError), 0, false, true},
+		{"upstream 429", upstreamErr(http.StatusTooManyRequests), 0, false, true},
+		{"upstream timeout", upstreamErr(http.StatusGatewayTimeout), 0, false, false},
+		{"bad request", upstreamErr(http.StatusBadRequest), common.ChannelTypeOpenAI, false, false},
+		{"local error", service.OpenAIErrorWrapperLocal(errors.New("quota"), "insufficient_user_quota", http.StatusForbidden), 0, false, false},
+		{"specific channel", upstreamErr(http.StatusInternalServerError), 0, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Set("channel_type", tt.channelType)
+			if tt.specific {
+				c.Set("specific_channel_id", "1")
+			}
+			if got := shouldFallback(c, tt.err); got != tt.want {
+				t.Errorf("shouldFallback() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetRelayChannelNoChannelMessage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB(t, &model.Channel{}, &model.Ability{})
+	oldMemoryCache := common.MemoryCacheEnabled
+	common.MemoryCacheEnabled = false
+	t.Cleanup(func() { common.MemoryCacheEnabled = oldMemoryCache })
+	channel := &model.Channel{Id: 1, Name: "mini", Key: "sk-test", Status: common.ChannelStatusEnabled, Models: "gpt-4o-mini", Group: "default"}
+	if err := db.Create(channel).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := channel.AddAbilities(); err != nil {
+		t.Fatal(err)
+	}
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	c.Set(constant.ContextKeyNoChannelMessage, "当前分组 default 下对于模型 gpt-4o 无可用渠道")
+	// 分发时原始模型没有渠道，第一次尝试直接失败并允许降级
+	if _, err := getRelayChannel(c, "default", "gpt-4o", 0, 0); err == nil {
+		t.Fatal("expected error for the original model")
+	} else if openaiErr := service.OpenAIErrorWrapperLocal(err, "get_channel_failed", http.StatusInternalServerError); !shouldFallback(c, openaiErr) {
+		t.Error("expected fallback after no channel for the original model")
+	}
+	got, err := getRelayChannel(c, "default", "gpt-4o-mini", 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Id != 1 || c.GetString("original_model") != "gpt-4o-mini" {
+		t.Errorf("channel = %d, original_model = %q", got.Id, c.GetString("original_model"))
+	}
+}
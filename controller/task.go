@@ -1,8 +1,8 @@
 package controller
 
 import (
+	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
@@ -14,7 +14,8 @@ import (
 	"one-api/dto"
 	"one-api/model"
 	"one-api/relay"
-	"sort"
+	relaychannel "one-api/relay/channel"
+	"one-api/service"
 	"strconv"
 	"time"
 )
@@ -72,124 +73,233 @@ func UpdateTaskByPlatform(platform constant.TaskPlatform, taskChannelM map[int][
 	switch platform {
 	case constant.TaskPlatformMidjourney:
 		//_ = UpdateMidjourneyTaskAll(context.Background(), tasks)
-	case constant.TaskPlatformSuno:
-		_ = UpdateSunoTaskAll(context.Background(), taskChannelM, taskM)
+	case constant.TaskPlatformBatch:
+		_ = UpdateBatchTaskAll(context.Background(), taskM)
 	default:
-		common.SysLog("未知平台")
+		if relay.GetTaskAdaptor(platform) == nil {
+			common.SysLog("未知平台")
+			return
+		}
+		_ = UpdateAsyncTaskAll(context.Background(), platform, taskChannelM, taskM)
+	}
+}
+
+const (
+	taskPollInterval   = 15 * time.Second
+	taskPollMaxBackoff = 10 * time.Minute
+)
+
+// taskPollState 查询失败的任务按指数退避延后下次查询，轮询只在主节点的单个协程中运行
+type taskPollState struct {
+	failures   int
+	nextPollAt time.Time
+}
+
+var taskPollStates = make(map[int64]*taskPollState)
+
+func shouldPollTask(task *model.Task, now time.Time) bool {
+	state, ok := taskPollStates[task.ID]
+	return !ok || !now.Before(state.nextPollAt)
+}
+
+func backoffTaskPoll(task *model.Task, now time.Time) {
+	state, ok := taskPollStates[task.ID]
+	if !ok {
+		state = &taskPollState{}
+		taskPollStates[task.ID] = state
+	}
+	state.failures++
+	delay := taskPollMaxBackoff
+	if state.failures < 10 {
+		delay = min(taskPollInterval<<state.failures, taskPollMaxBackoff)
 	}
+	state.nextPollAt = now.Add(delay)
 }
 
-func UpdateSunoTaskAll(ctx context.Context, taskChannelM map[int][]string, taskM map[string]*model.Task) error {
+// UpdateAsyncTaskAll 通过平台适配器查询各渠道未完成的任务，支持批量查询的平台按渠道一次查询
+func UpdateAsyncTaskAll(ctx context.Context, platform constant.TaskPlatform, taskChannelM map[int][]string, taskM map[string]*model.Task) error {
 	for channelId, taskIds := range taskChannelM {
-		err := updateSunoTaskAll(ctx, channelId, taskIds, taskM)
+		err := updateAsyncTaskAll(ctx, platform, channelId, taskIds, taskM)
 		if err != nil {
-			common.LogError(ctx, fmt.Sprintf("渠道 #%d 更新异步任务失败: %d", channelId, err.Error()))
+			common.LogError(ctx, fmt.Sprintf("渠道 #%d 更新异步任务失败: %s", channelId, err.Error()))
 		}
 	}
 	return nil
 }
 
-func updateSunoTaskAll(ctx context.Context, channelId int, taskIds []string, taskM map[string]*model.Task) error {
+func updateAsyncTaskAll(ctx context.Context, platform constant.TaskPlatform, channelId int, taskIds []string, taskM map[string]*model.Task) error {
 	common.LogInfo(ctx, fmt.Sprintf("渠道 #%d 未完成的任务有: %d", channelId, len(taskIds)))
-	if len(taskIds) == 0 {
+	now := time.Now()
+	dueTaskIds := make([]string, 0, len(taskIds))
+	for _, taskId := range taskIds {
+		task := taskM[taskId]
+		if constant.TaskTimeoutMinutes > 0 && task.SubmitTime > 0 &&
+			now.Unix()-task.SubmitTime > int64(constant.TaskTimeoutMinutes)*60 {
+			settleTaskFailure(ctx, task, "任务超时")
+			continue
+		}
+		if shouldPollTask(task, now) {
+			dueTaskIds = append(dueTaskIds, taskId)
+		}
+	}
+	if len(dueTaskIds) == 0 {
 		return nil
 	}
 	channel, err := model.CacheGetChannel(channelId)
 	if err != nil {
 		common.SysLog(fmt.Sprintf("CacheGetChannel: %v", err))
-		err = model.TaskBulkUpdate(taskIds, map[string]any{
-			"fail_reason": fmt.Sprintf("获取渠道信息失败，请联系管理员，渠道ID：%d", channelId),
-			"status":      "FAILURE",
-			"progress":    "100%",
-		})
-		if err != nil {
-			common.SysError(fmt.Sprintf("UpdateMidjourneyTask error2: %v", err))
+		for _, taskId := range dueTaskIds {
+			settleTaskFailure(ctx, taskM[taskId], fmt.Sprintf("获取渠道信息失败，请联系管理员，渠道ID：%d", channelId))
 		}
 		return err
 	}
-	adaptor := relay.GetTaskAdaptor(constant.TaskPlatformSuno)
+	adaptor := relay.GetTaskAdaptor(platform)
 	if adaptor == nil {
 		return errors.New("adaptor not found")
 	}
-	resp, err := adaptor.FetchTask(*channel.BaseURL, channel.Key, map[string]any{
-		"ids": taskIds,
-	})
-	if err != nil {
-		common.SysError(fmt.Sprintf("Get Task Do req error: %v", err))
-		return err
+
+	// 任务只能用提交时的密钥查询，多密钥渠道按密钥分批
+	if batchFetcher, ok := adaptor.(relaychannel.TaskBatchFetcher); ok {
+		keyTaskIds := make(map[int][]string)
+		for _, taskId := range dueTaskIds {
+			keyIndex := taskM[taskId].KeyIndex
+			keyTaskIds[keyIndex] = append(keyTaskIds[keyIndex], taskId)
+		}
+		var fetchErr error
+		for keyIndex, taskIds := range keyTaskIds {
+			resp, err := batchFetcher.FetchTasks(channel.GetBaseURL(), channel.GetKeyByIndex(keyIndex), taskIds)
+			taskInfos, err := parseTaskFetchResponse(adaptor, resp, err)
+			if err != nil {
+				for _, taskId := range taskIds {
+					backoffTaskPoll(taskM[taskId], now)
+				}
+				fetchErr = err
+				continue
+			}
+			for _, taskInfo := range taskInfos {
+				if task, ok := taskM[taskInfo.TaskID]; ok {
+					updateTaskByInfo(ctx, task, taskInfo)
+				}
+			}
+		}
+		return fetchErr
 	}
-	if resp.StatusCode != http.StatusOK {
-		common.LogError(ctx, fmt.Sprintf("Get Task status code: %d", resp.StatusCode))
-		return errors.New(fmt.Sprintf("Get Task status code: %d", resp.StatusCode))
+
+	for _, taskId := range dueTaskIds {
+		task := taskM[taskId]
+		resp, err := adaptor.FetchTask(channel.GetBaseURL(), channel.GetKeyByIndex(task.KeyIndex), map[string]any{
+			"task_id": task.TaskID,
+			"action":  task.Action,
+		})
+		taskInfos, err := parseTaskFetchResponse(adaptor, resp, err)
+		if err != nil {
+			common.LogError(ctx, fmt.Sprintf("fetch task %s failed: %s", task.TaskID, err.Error()))
+			backoffTaskPoll(task, now)
+			continue
+		}
+		for _, taskInfo := range taskInfos {
+			if taskInfo.TaskID == task.TaskID {
+				updateTaskByInfo(ctx, task, taskInfo)
+			}
+		}
+	}
+	return nil
+}
+
+func parseTaskFetchResponse(adaptor relaychannel.TaskAdaptor, resp *http.Response, err error) ([]*dto.TaskInfo, error) {
+	if err != nil {
+		return nil, err
 	}
 	defer resp.Body.Close()
 	responseBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		common.SysError(fmt.Sprintf("Get Task parse body error: %v", err))
-		return err
+		return nil, err
 	}
-	var responseItems dto.TaskResponse[[]dto.SunoDataResponse]
-	err = json.Unmarshal(responseBody, &responseItems)
-	if err != nil {
-		common.LogError(ctx, fmt.Sprintf("Get Task parse body error2: %v, body: %s", err, string(responseBody)))
-		return err
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch task status code: %d, body: %s", resp.StatusCode, string(responseBody))
 	}
-	if !responseItems.IsSuccess() {
-		common.SysLog(fmt.Sprintf("渠道 #%d 未完成的任务有: %d, 成功获取到任务数: %d", channelId, len(taskIds), string(responseBody)))
-		return err
+	return adaptor.ParseTaskResult(responseBody)
+}
+
+func updateTaskByInfo(ctx context.Context, task *model.Task, taskInfo *dto.TaskInfo) {
+	delete(taskPollStates, task.ID)
+	if !checkTaskNeedUpdate(task, taskInfo) {
+		return
 	}
 
-	for _, responseItem := range responseItems.Data {
-		task := taskM[responseItem.TaskID]
-		if !checkTaskNeedUpdate(task, responseItem) {
-			continue
-		}
+	task.Status = lo.If(model.TaskStatus(taskInfo.Status) != "", model.TaskStatus(taskInfo.Status)).Else(task.Status)
+	task.FailReason = lo.If(taskInfo.FailReason != "", taskInfo.FailReason).Else(task.FailReason)
+	task.SubmitTime = lo.If(taskInfo.SubmitTime != 0, taskInfo.SubmitTime).Else(task.SubmitTime)
+	task.StartTime = lo.If(taskInfo.StartTime != 0, taskInfo.StartTime).Else(task.StartTime)
+	task.FinishTime = lo.If(taskInfo.FinishTime != 0, taskInfo.FinishTime).Else(task.FinishTime)
+	task.Progress = lo.If(taskInfo.Progress != "", taskInfo.Progress).Else(task.Progress)
+	if len(taskInfo.Data) > 0 {
+		task.Data = taskInfo.Data
+	}
+	if task.Status == model.TaskStatusFailure {
+		settleTaskFailure(ctx, task, task.FailReason)
+		return
+	}
+	if task.Status == model.TaskStatusSuccess {
+		task.Progress = "100%"
+	}
 
-		task.Status = lo.If(model.TaskStatus(responseItem.Status) != "", model.TaskStatus(responseItem.Status)).Else(task.Status)
-		task.FailReason = lo.If(responseItem.FailReason != "", responseItem.FailReason).Else(task.FailReason)
-		task.SubmitTime = lo.If(responseItem.SubmitTime != 0, responseItem.SubmitTime).Else(task.SubmitTime)
-		task.StartTime = lo.If(responseItem.StartTime != 0, responseItem.StartTime).Else(task.StartTime)
-		task.FinishTime = lo.If(responseItem.FinishTime != 0, responseItem.FinishTime).Else(task.FinishTime)
-		if responseItem.FailReason != "" || task.Status == model.TaskStatusFailure {
-			common.LogInfo(ctx, task.TaskID+" 构建失败，"+task.FailReason)
-			task.Progress = "100%"
-			//err = model.CacheUpdateUserQuota(task.UserId) ?
-			if err != nil {
-				common.LogError(ctx, "error update user quota cache: "+err.Error())
-			} else {
-				quota := task.Quota
-				if quota != 0 {
-					err = model.IncreaseUserQuota(task.UserId, quota, false)
-					if err != nil {
-						common.LogError(ctx, "fail to increase user quota: "+err.Error())
-					}
-					logContent := fmt.Sprintf("异步任务执行失败 %s，补偿 %s", task.TaskID, common.LogQuota(quota))
-					model.RecordLog(task.UserId, model.LogTypeSystem, logContent)
-				}
-			}
-		}
-		if responseItem.Status == model.TaskStatusSuccess {
-			task.Progress = "100%"
-		}
-		task.Data = responseItem.Data
+	err := task.Update()
+	if err != nil {
+		common.SysError("UpdateTask task error: " + err.Error())
+		return
+	}
+	service.NotifyTaskFinished(task)
+}
 
-		err = task.Update()
-		if err != nil {
-			common.SysError("UpdateMidjourneyTask task error: " + err.Error())
+// settleTaskFailure 将任务标记为失败并退还预扣的额度
+func settleTaskFailure(ctx context.Context, task *model.Task, reason string) {
+	common.LogInfo(ctx, task.TaskID+" 构建失败，"+reason)
+	delete(taskPollStates, task.ID)
+	task.Status = model.TaskStatusFailure
+	task.Progress = "100%"
+	task.FailReason = reason
+	if task.FinishTime == 0 {
+		task.FinishTime = time.Now().Unix()
+	}
+	err := task.Update()
+	if err != nil {
+		common.SysError("UpdateTask task error: " + err.Error())
+		return
+	}
+	service.NotifyTaskFinished(task)
+	quota := task.Quota
+	if quota == 0 {
+		return
+	}
+	orgId := 0
+	token, err := model.GetTokenById(task.TokenId)
+	if err == nil {
+		orgId = token.OrgId
+		err = model.IncreaseTokenQuota(token.Id, token.Key, quota)
+		if token.HasBudget() {
+			model.RecordTokenBudgetUsage(token.Id, -quota)
 		}
 	}
-	return nil
+	if err != nil {
+		common.LogError(ctx, "fail to increase token quota: "+err.Error())
+	}
+	err = model.IncreaseBillingQuota(task.UserId, orgId, quota)
+	if err != nil {
+		common.LogError(ctx, "fail to increase user quota: "+err.Error())
+	}
+	logContent := fmt.Sprintf("异步任务执行失败 %s，补偿 %s", task.TaskID, common.LogQuota(quota))
+	model.RecordLog(task.UserId, model.LogTypeSystem, logContent)
 }
 
-func checkTaskNeedUpdate(oldTask *model.Task, newTask dto.SunoDataResponse) bool {
-
-	if oldTask.SubmitTime != newTask.SubmitTime {
+func checkTaskNeedUpdate(oldTask *model.Task, newTask *dto.TaskInfo) bool {
+	if newTask.SubmitTime != 0 && oldTask.SubmitTime != newTask.SubmitTime {
 		return true
 	}
-	if oldTask.StartTime != newTask.StartTime {
+	if newTask.StartTime != 0 && oldTask.StartTime != newTask.StartTime {
 		return true
 	}
-	if oldTask.FinishTime != newTask.FinishTime {
+	if newTask.FinishTime != 0 && oldTask.FinishTime != newTask.FinishTime {
 		return true
 	}
 	if string(oldTask.Status) != newTask.Status {
@@ -198,28 +308,13 @@ func checkTaskNeedUpdate(oldTask *model.Task, newTask dto.SunoDataResponse) bool
 	if oldTask.FailReason != newTask.FailReason {
 		return true
 	}
-	if oldTask.FinishTime != newTask.FinishTime {
+	if newTask.Progress != "" && oldTask.Progress != newTask.Progress {
 		return true
 	}
-
 	if (oldTask.Status == model.TaskStatusFailure || oldTask.Status == model.TaskStatusSuccess) && oldTask.Progress != "100%" {
 		return true
 	}
-
-	oldData, _ := json.Marshal(oldTask.Data)
-	newData, _ := json.Marshal(newTask.Data)
-
-	sort.Slice(oldData, func(i, j int) bool {
-		return oldData[i] < oldData[j]
-	})
-	sort.Slice(newData, func(i, j int) bool {
-		return newData[i] < newData[j]
-	})
-
-	if string(oldData) != string(newData) {
-		return true
-	}
-	return false
+	return len(newTask.Data) > 0 && !bytes.Equal(oldTask.Data, newTask.Data)
 }
 
 func GetAllTask(c *gin.Context) {
@@ -251,6 +346,27 @@ func GetAllTask(c *gin.Context) {
 	})
 }
 
+// GetUserTaskCallbacks 查看当前用户任务回调的投递记录
+func GetUserTaskCallbacks(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	callbacks, err := model.GetUserTaskCallbacks(c.GetInt("id"), c.Query("task_id"), p*common.ItemsPerPage, common.ItemsPerPage)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"success": true,
+		"message": "",
+		"data":    callbacks,
+	})
+}
+
 func GetUserTask(c *gin.Context) {
 	p, _ := strconv.Atoi(c.Query("p"))
 	if p < 0 {
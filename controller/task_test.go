@@ -0,0 +1,164 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/model"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func setupTaskTestDB(t *testing.T) {
+	t.Helper()
+	setupTestDB(t, &model.User{}, &model.Token{}, &model.Channel{}, &model.Task{}, &model.Log{})
+	t.Cleanup(func() { taskPollStates = make(map[int64]*taskPollState) })
+}
+
+func TestBackoffTaskPoll(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		failures int
+		delay    time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{5, 8 * time.Minute},
+		{6, taskPollMaxBackoff},
+		{20, taskPollMaxBackoff},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("failures=%d", tt.failures), func(t *testing.T) {
+			taskPollStates = make(map[int64]*taskPollState)
+			task := &model.Task{ID: 1}
+			if !shouldPollTask(task, now) {
+				t.Fatal("new task should be polled")
+			}
+			for i := 0; i < tt.failures; i++ {
+				backoffTaskPoll(task, now)
+			}
+			if got := taskPollStates[task.ID].nextPollAt.Sub(now); got != tt.delay {
+				t.Errorf("delay = %v, want %v", got, tt.delay)
+			}
+			if shouldPollTask(task, now.Add(tt.delay-time.Second)) {
+				t.Error("task polled before backoff elapsed")
+			}
+			if !shouldPollTask(task, now.Add(tt.delay)) {
+				t.Error("task not polled after backoff elapsed")
+			}
+		})
+	}
+	taskPollStates = make(map[int64]*taskPollState)
+}
+
+func TestUpdateAsyncTaskAllUsesSubmitKey(t *testing.T) {
+	setupTaskTestDB(t)
+	var mu sync.Mutex
+	authByTask := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		taskId := strings.TrimPrefix(r.URL.Path, "/v1/tasks/")
+		mu.Lock()
+		authByTask[taskId] = r.Header.Get("Authorization")
+		mu.Unlock()
+		_, _ = fmt.Fprintf(w, `{"id":%q,"status":"RUNNING","progress":0.5}`, taskId)
+	}))
+	defer server.Close()
+
+	mode := common.ChannelMultiKeyModeRoundRobin
+	baseUrl := server.URL
+	channel := &model.Channel{Type: common.ChannelTypeRunway, Key: "k0\nk1\nk2", MultiKeyMode: &mode, BaseURL: &baseUrl, Status: common.ChannelStatusEnabled}
+	if err := model.DB.Create(channel).Error; err != nil {
+		t.Fatal(err)
+	}
+	taskM := make(map[string]*model.Task)
+	var taskIds []string
+	for i, keyIndex := range []int{2, 0, 1} {
+		task := &model.Task{
+			TaskID:     fmt.Sprintf("task-%d", i),
+			Platform:   constant.TaskPlatformRunway,
+			ChannelId:  channel.Id,
+			KeyIndex:   keyIndex,
+			Status:     model.TaskStatusSubmitted,
+			SubmitTime: time.Now().Unix(),
+		}
+		if err := model.DB.Create(task).Error; err != nil {
+			t.Fatal(err)
+		}
+		taskM[task.TaskID] = task
+		taskIds = append(taskIds, task.TaskID)
+	}
+
+	if err := updateAsyncTaskAll(context.Background(), constant.TaskPlatformRunway, channel.Id, taskIds, taskM); err != nil {
+		t.Fatal(err)
+	}
+	for _, taskId := range taskIds {
+		task := taskM[taskId]
+		want := fmt.Sprintf("Bearer k%d", task.KeyIndex)
+		if got := authByTask[taskId]; got != want {
+			t.Errorf("%s polled with %q, want %q", taskId, got, want)
+		}
+		if task.Status != model.TaskStatusInProgress || task.Progress != "50%" {
+			t.Errorf("%s status = %s %s, want IN_PROGRESS 50%%", taskId, task.Status, task.Progress)
+		}
+	}
+}
+
+func TestSettleTaskFailure(t *testing.T) {
+	setupTaskTestDB(t)
+	user := &model.User{Username: "task-user", Password: "password", Quota: 100}
+	if err := model.DB.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	token := &model.Token{UserId: user.Id, Key: "task-token", Name: "t", RemainQuota: 50}
+	if err := model.DB.Create(token).Error; err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		quota     int
+		userQuota int
+		remain    int
+	}{
+		{"refund pre-consumed quota", 30, 130, 80},
+		{"free task refunds nothing", 0, 130, 80},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task := &model.Task{
+				TaskID:    fmt.Sprintf("failed-%d", i),
+				UserId:    user.Id,
+				TokenId:   token.Id,
+				Quota:     tt.quota,
+				Status:    model.TaskStatusInProgress,
+				Platform:  constant.TaskPlatformRunway,
+				ChannelId: 1,
+			}
+			if err := model.DB.Create(task).Error; err != nil {
+				t.Fatal(err)
+			}
+			settleTaskFailure(context.Background(), task, "upstream failed")
+
+			var saved model.Task
+			model.DB.First(&saved, task.ID)
+			if saved.Status != model.TaskStatusFailure || saved.FailReason != "upstream failed" || saved.FinishTime == 0 {
+				t.Errorf("task = %s %q finish=%d", saved.Status, saved.FailReason, saved.FinishTime)
+			}
+			var savedUser model.User
+			model.DB.First(&savedUser, user.Id)
+			if savedUser.Quota != tt.userQuota {
+				t.Errorf("user quota = %d, want %d", savedUser.Quota, tt.userQuota)
+			}
+			var savedToken model.Token
+			model.DB.First(&savedToken, token.Id)
+			if savedToken.RemainQuota != tt.remain {
+				t.Errorf("token remain = %d, want %d", savedToken.RemainQuota, tt.remain)
+			}
+		})
+	}
+}
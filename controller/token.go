@@ -1,10 +1,13 @@
 package controller
 
 import (
+	"encoding/json"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"one-api/common"
 	"one-api/model"
+	"one-api/service"
 	"strconv"
 )
 
@@ -31,7 +34,7 @@ func GetAllTokens(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
-		"data":    tokens,
+		"data":    withTokenBudgetUsages(tokens),
 	})
 	return
 }
@@ -51,7 +54,7 @@ func SearchTokens(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
-		"data":    tokens,
+		"data":    withTokenBudgetUsages(tokens),
 	})
 	return
 }
@@ -77,7 +80,7 @@ func GetToken(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
-		"data":    token,
+		"data":    withTokenBudgetUsage(token),
 	})
 	return
 }
@@ -123,6 +126,36 @@ func AddToken(c *gin.Context) {
 		})
 		return
 	}
+	if err := service.ValidateCallbackUrl(token.CallbackUrl); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if token.DailyBudget < 0 || token.WeeklyBudget < 0 || token.MonthlyBudget < 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "令牌预算不能为负数",
+		})
+		return
+	}
+	if err := validateTokenModelFallbacks(token.ModelFallbacks); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if token.OrgId != 0 {
+		if _, err := model.GetOrgMemberRole(token.OrgId, c.GetInt("id")); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "不是该组织成员，无法创建组织令牌",
+			})
+			return
+		}
+	}
 	key, err := common.GenerateKey()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -144,7 +177,14 @@ func AddToken(c *gin.Context) {
 		ModelLimitsEnabled: token.ModelLimitsEnabled,
 		ModelLimits:        token.ModelLimits,
 		AllowIps:           token.AllowIps,
+		ModelFallbacks:     token.ModelFallbacks,
+		ResponseCache:      token.ResponseCache,
 		Group:              token.Group,
+		CallbackUrl:        token.CallbackUrl,
+		DailyBudget:        token.DailyBudget,
+		WeeklyBudget:       token.WeeklyBudget,
+		MonthlyBudget:      token.MonthlyBudget,
+		OrgId:              token.OrgId,
 	}
 	err = cleanToken.Insert()
 	if err != nil {
@@ -198,6 +238,27 @@ func UpdateToken(c *gin.Context) {
 		})
 		return
 	}
+	if err := service.ValidateCallbackUrl(token.CallbackUrl); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if token.DailyBudget < 0 || token.WeeklyBudget < 0 || token.MonthlyBudget < 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "令牌预算不能为负数",
+		})
+		return
+	}
+	if err := validateTokenModelFallbacks(token.ModelFallbacks); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	cleanToken, err := model.GetTokenByIds(token.Id, userId)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -233,7 +294,13 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.ModelLimitsEnabled = token.ModelLimitsEnabled
 		cleanToken.ModelLimits = token.ModelLimits
 		cleanToken.AllowIps = token.AllowIps
+		cleanToken.ModelFallbacks = token.ModelFallbacks
+		cleanToken.ResponseCache = token.ResponseCache
 		cleanToken.Group = token.Group
+		cleanToken.CallbackUrl = token.CallbackUrl
+		cleanToken.DailyBudget = token.DailyBudget
+		cleanToken.WeeklyBudget = token.WeeklyBudget
+		cleanToken.MonthlyBudget = token.MonthlyBudget
 	}
 	err = cleanToken.Update()
 	if err != nil {
@@ -250,3 +317,41 @@ func UpdateToken(c *gin.Context) {
 	})
 	return
 }
+
+// tokenWithBudgetUsage 令牌信息附带当前预算周期的使用情况和重置时间
+type tokenWithBudgetUsage struct {
+	*model.Token
+	BudgetUsage []model.TokenBudgetStatus `json:"budget_usage,omitempty"`
+}
+
+func withTokenBudgetUsage(token *model.Token) tokenWithBudgetUsage {
+	result := tokenWithBudgetUsage{Token: token}
+	if token.HasBudget() {
+		usage, err := model.GetTokenBudgetStatus(token)
+		if err != nil {
+			common.SysError("failed to get token budget status: " + err.Error())
+		}
+		result.BudgetUsage = usage
+	}
+	return result
+}
+
+func withTokenBudgetUsages(tokens []*model.Token) []tokenWithBudgetUsage {
+	result := make([]tokenWithBudgetUsage, 0, len(tokens))
+	for _, token := range tokens {
+		result = append(result, withTokenBudgetUsage(token))
+	}
+	return result
+}
+
+// validateTokenModelFallbacks 校验令牌降级链格式，例如 {"gpt-4o": ["claude-3-5-sonnet", "gpt-4o-mini"]}
+func validateTokenModelFallbacks(modelFallbacks *string) error {
+	if modelFallbacks == nil || *modelFallbacks == "" {
+		return nil
+	}
+	fallbacks := make(map[string][]string)
+	if err := json.Unmarshal([]byte(*modelFallbacks), &fallbacks); err != nil {
+		return errors.New("模型降级链格式错误：" + err.Error())
+	}
+	return nil
+}
@@ -2,48 +2,42 @@ package controller
 
 import (
 	"fmt"
+	"io"
 	"log"
-	"net/url"
+	"net/http"
 	"one-api/common"
 	"one-api/model"
 	"one-api/service"
 	"one-api/setting"
 	"strconv"
-	"sync"
 	"time"
 
-	"github.com/Calcium-Ion/go-epay/epay"
 	"github.com/gin-gonic/gin"
-	"github.com/samber/lo"
 	"github.com/shopspring/decimal"
 )
 
-type EpayRequest struct {
+type PaymentRequest struct {
 	Amount        int64  `json:"amount"`
 	PaymentMethod string `json:"payment_method"`
 	TopUpCode     string `json:"top_up_code"`
+	// Provider 支付渠道，默认为易支付
+	Provider string `json:"provider"`
 }
 
 type AmountRequest struct {
 	Amount    int64  `json:"amount"`
 	TopUpCode string `json:"top_up_code"`
+	Provider  string `json:"provider"`
 }
 
-func GetEpayClient() *epay.Client {
-	if setting.PayAddress == "" || setting.EpayId == "" || setting.EpayKey == "" {
-		return nil
+func getPaymentProviderName(provider string) string {
+	if provider == "" {
+		return service.PaymentProviderEpay
 	}
-	withUrl, err := epay.NewClient(&epay.Config{
-		PartnerID: setting.EpayId,
-		Key:       setting.EpayKey,
-	}, setting.PayAddress)
-	if err != nil {
-		return nil
-	}
-	return withUrl
+	return provider
 }
 
-func getPayMoney(amount int64, group string) float64 {
+func getPayMoney(amount int64, group string, price float64) float64 {
 	dAmount := decimal.NewFromInt(amount)
 
 	if !common.DisplayInCurrencyEnabled {
@@ -57,7 +51,7 @@ func getPayMoney(amount int64, group string) float64 {
 	}
 
 	dTopupGroupRatio := decimal.NewFromFloat(topupGroupRatio)
-	dPrice := decimal.NewFromFloat(setting.Price)
+	dPrice := decimal.NewFromFloat(price)
 
 	payMoney := dAmount.Mul(dPrice).Mul(dTopupGroupRatio)
 
@@ -74,8 +68,9 @@ func getMinTopup() int64 {
 	return int64(minTopup)
 }
 
-func RequestEpay(c *gin.Context) {
-	var req EpayRequest
+// RequestPayment 创建在线充值订单并返回支付跳转信息
+func RequestPayment(c *gin.Context) {
+	var req PaymentRequest
 	err := c.ShouldBindJSON(&req)
 	if err != nil {
 		c.JSON(200, gin.H{"message": "error", "data": "参数错误"})
@@ -85,6 +80,12 @@ func RequestEpay(c *gin.Context) {
 		c.JSON(200, gin.H{"message": "error", "data": fmt.Sprintf("充值数量不能小于 %d", getMinTopup())})
 		return
 	}
+	providerName := getPaymentProviderName(req.Provider)
+	provider, err := service.GetPaymentProvider(providerName)
+	if err != nil {
+		c.JSON(200, gin.H{"message": "error", "data": err.Error()})
+		return
+	}
 
 	id := c.GetInt("id")
 	group, err := model.GetUserGroup(id, true)
@@ -92,39 +93,24 @@ func RequestEpay(c *gin.Context) {
 		c.JSON(200, gin.H{"message": "error", "data": "获取用户分组失败"})
 		return
 	}
-	payMoney := getPayMoney(req.Amount, group)
+	payMoney := getPayMoney(req.Amount, group, provider.UnitPrice())
 	if payMoney < 0.01 {
 		c.JSON(200, gin.H{"message": "error", "data": "充值金额过低"})
 		return
 	}
-	payType := "wxpay"
-	if req.PaymentMethod == "zfb" {
-		payType = "alipay"
-	}
-	if req.PaymentMethod == "wx" {
-		req.PaymentMethod = "wxpay"
-		payType = "wxpay"
-	}
 	callBackAddress := service.GetCallbackAddress()
-	returnUrl, _ := url.Parse(setting.ServerAddress + "/log")
-	notifyUrl, _ := url.Parse(callBackAddress + "/api/user/epay/notify")
 	tradeNo := fmt.Sprintf("%s%d", common.GetRandomString(6), time.Now().Unix())
 	tradeNo = fmt.Sprintf("USR%dNO%s", id, tradeNo)
-	client := GetEpayClient()
-	if client == nil {
-		c.JSON(200, gin.H{"message": "error", "data": "当前管理员未配置支付信息"})
-		return
-	}
-	uri, params, err := client.Purchase(&epay.PurchaseArgs{
-		Type:           payType,
-		ServiceTradeNo: tradeNo,
-		Name:           fmt.Sprintf("TUC%d", req.Amount),
-		Money:          strconv.FormatFloat(payMoney, 'f', 2, 64),
-		Device:         epay.PC,
-		NotifyUrl:      notifyUrl,
-		ReturnUrl:      returnUrl,
+	checkout, err := provider.CreateCheckout(&service.PaymentOrder{
+		TradeNo:       tradeNo,
+		Title:         fmt.Sprintf("TUC%d", req.Amount),
+		Money:         payMoney,
+		PaymentMethod: req.PaymentMethod,
+		NotifyUrl:     callBackAddress + "/api/payment/" + providerName + "/webhook",
+		ReturnUrl:     setting.ServerAddress + "/log",
 	})
 	if err != nil {
+		common.SysError(fmt.Sprintf("failed to create %s checkout: %s", providerName, err.Error()))
 		c.JSON(200, gin.H{"message": "error", "data": "拉起支付失败"})
 		return
 	}
@@ -135,109 +121,69 @@ func RequestEpay(c *gin.Context) {
 		amount = dAmount.Div(dQuotaPerUnit).IntPart()
 	}
 	topUp := &model.TopUp{
-		UserId:     id,
-		Amount:     amount,
-		Money:      payMoney,
-		TradeNo:    tradeNo,
-		CreateTime: time.Now().Unix(),
-		Status:     "pending",
+		UserId:          id,
+		Amount:          amount,
+		Money:           payMoney,
+		TradeNo:         tradeNo,
+		CreateTime:      time.Now().Unix(),
+		Status:          model.TopUpStatusPending,
+		Provider:        providerName,
+		Currency:        provider.Currency(),
+		ProviderTradeNo: checkout.ProviderTradeNo,
 	}
 	err = topUp.Insert()
 	if err != nil {
 		c.JSON(200, gin.H{"message": "error", "data": "创建订单失败"})
 		return
 	}
-	c.JSON(200, gin.H{"message": "success", "data": params, "url": uri})
+	c.JSON(200, gin.H{"message": "success", "data": checkout.Params, "url": checkout.Url})
 }
 
-// tradeNo lock
-var orderLocks sync.Map
-var createLock sync.Mutex
-
-// LockOrder 尝试对给定订单号加锁
-func LockOrder(tradeNo string) {
-	lock, ok := orderLocks.Load(tradeNo)
-	if !ok {
-		createLock.Lock()
-		defer createLock.Unlock()
-		lock, ok = orderLocks.Load(tradeNo)
-		if !ok {
-			lock = new(sync.Mutex)
-			orderLocks.Store(tradeNo, lock)
-		}
-	}
-	lock.(*sync.Mutex).Lock()
+// EpayNotify 兼容旧版本订单使用的易支付回调地址
+func EpayNotify(c *gin.Context) {
+	handlePaymentWebhook(c, service.PaymentProviderEpay)
 }
 
-// UnlockOrder 释放给定订单号的锁
-func UnlockOrder(tradeNo string) {
-	lock, ok := orderLocks.Load(tradeNo)
-	if ok {
-		lock.(*sync.Mutex).Unlock()
-	}
+func PaymentWebhook(c *gin.Context) {
+	handlePaymentWebhook(c, c.Param("provider"))
 }
 
-func EpayNotify(c *gin.Context) {
-	params := lo.Reduce(lo.Keys(c.Request.URL.Query()), func(r map[string]string, t string, i int) map[string]string {
-		r[t] = c.Request.URL.Query().Get(t)
-		return r
-	}, map[string]string{})
-	client := GetEpayClient()
-	if client == nil {
-		log.Println("易支付回调失败 未找到配置信息")
-		_, err := c.Writer.Write([]byte("fail"))
-		if err != nil {
-			log.Println("易支付回调写入失败")
-			return
-		}
+func handlePaymentWebhook(c *gin.Context, providerName string) {
+	provider, err := service.GetPaymentProvider(providerName)
+	if err != nil {
+		log.Printf("支付回调失败 %s: %s", providerName, err.Error())
+		c.String(http.StatusNotFound, "fail")
+		return
+	}
+	respond := func(ok bool) {
+		status, body := provider.WebhookResponse(ok)
+		c.String(status, body)
 	}
-	verifyInfo, err := client.Verify(params)
-	if err == nil && verifyInfo.VerifyStatus {
-		_, err := c.Writer.Write([]byte("success"))
-		if err != nil {
-			log.Println("易支付回调写入失败")
-		}
-	} else {
-		_, err := c.Writer.Write([]byte("fail"))
-		if err != nil {
-			log.Println("易支付回调写入失败")
-		}
-		log.Println("易支付回调签名验证失败")
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		respond(false)
 		return
 	}
-
-	if verifyInfo.TradeStatus == epay.StatusTradeSuccess {
-		log.Println(verifyInfo)
-		LockOrder(verifyInfo.ServiceTradeNo)
-		defer UnlockOrder(verifyInfo.ServiceTradeNo)
-		topUp := model.GetTopUpByTradeNo(verifyInfo.ServiceTradeNo)
-		if topUp == nil {
-			log.Printf("易支付回调未找到订单: %v", verifyInfo)
-			return
-		}
-		if topUp.Status == "pending" {
-			topUp.Status = "success"
-			err := topUp.Update()
-			if err != nil {
-				log.Printf("易支付回调更新订单失败: %v", topUp)
-				return
-			}
-			//user, _ := model.GetUserById(topUp.UserId, false)
-			//user.Quota += topUp.Amount * 500000
-			dAmount := decimal.NewFromInt(int64(topUp.Amount))
-			dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
-			quotaToAdd := int(dAmount.Mul(dQuotaPerUnit).IntPart())
-			err = model.IncreaseUserQuota(topUp.UserId, quotaToAdd, true)
-			if err != nil {
-				log.Printf("易支付回调更新用户失败: %v", topUp)
-				return
-			}
-			log.Printf("易支付回调更新用户成功 %v", topUp)
-			model.RecordLog(topUp.UserId, model.LogTypeTopup, fmt.Sprintf("使用在线充值成功，充值金额: %v，支付金额：%f", common.LogQuota(quotaToAdd), topUp.Money))
-		}
-	} else {
-		log.Printf("易支付异常回调: %v", verifyInfo)
+	event, err := provider.VerifyWebhook(c.Request, body)
+	if err != nil {
+		log.Printf("支付回调验证失败 %s: %s", providerName, err.Error())
+		respond(false)
+		return
+	}
+	if event == nil {
+		respond(true)
+		return
+	}
+	topUp, changed, err := service.HandlePaymentEvent(providerName, event)
+	if err != nil {
+		log.Printf("支付回调处理失败 %s: %v %s", providerName, event, err.Error())
+		respond(false)
+		return
+	}
+	if changed {
+		log.Printf("支付回调更新订单成功 %s: %s -> %s", providerName, topUp.TradeNo, topUp.Status)
 	}
+	respond(true)
 }
 
 func RequestAmount(c *gin.Context) {
@@ -252,16 +198,66 @@ func RequestAmount(c *gin.Context) {
 		c.JSON(200, gin.H{"message": "error", "data": fmt.Sprintf("充值数量不能小于 %d", getMinTopup())})
 		return
 	}
+	provider, err := service.GetPaymentProvider(getPaymentProviderName(req.Provider))
+	if err != nil {
+		c.JSON(200, gin.H{"message": "error", "data": err.Error()})
+		return
+	}
 	id := c.GetInt("id")
 	group, err := model.GetUserGroup(id, true)
 	if err != nil {
 		c.JSON(200, gin.H{"message": "error", "data": "获取用户分组失败"})
 		return
 	}
-	payMoney := getPayMoney(req.Amount, group)
+	payMoney := getPayMoney(req.Amount, group, provider.UnitPrice())
 	if payMoney <= 0.01 {
 		c.JSON(200, gin.H{"message": "error", "data": "充值金额过低"})
 		return
 	}
-	c.JSON(200, gin.H{"message": "success", "data": strconv.FormatFloat(payMoney, 'f', 2, 64)})
+	c.JSON(200, gin.H{"message": "success", "data": strconv.FormatFloat(payMoney, 'f', 2, 64), "currency": provider.Currency()})
+}
+
+// RefundTopUp 管理员对已支付的在线充值订单全额退款，并扣除对应额度
+func RefundTopUp(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	topUp := model.GetTopUpById(id)
+	if topUp == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "订单不存在",
+		})
+		return
+	}
+	refunded, err := service.RefundTopUp(topUp)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	model.SetAuditAction(c, "refund")
+	model.SetAuditDiff(c, strconv.Itoa(topUp.Id), gin.H{"status": topUp.Status}, gin.H{"status": refunded.Status})
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    refunded,
+	})
+}
+
+func GetTopUpEvents(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	events, err := model.GetTopUpEvents(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    events,
+	})
 }
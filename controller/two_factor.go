@@ -0,0 +1,283 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/model"
+	"one-api/setting/system_setting"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+type twoFactorRequest struct {
+	Code string `json:"code"`
+}
+
+func bindTwoFactorCode(c *gin.Context) (string, error) {
+	var req twoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		return "", errors.New("请输入验证码")
+	}
+	return req.Code, nil
+}
+
+// verifyUserTwoFactor 校验当前用户的验证码或恢复码
+func verifyUserTwoFactor(c *gin.Context) (*model.TwoFactor, error) {
+	code, err := bindTwoFactorCode(c)
+	if err != nil {
+		return nil, err
+	}
+	twoFactor, err := model.GetTwoFactorByUserId(c.GetInt("id"))
+	if err != nil || !twoFactor.Enabled {
+		return nil, errors.New("未启用两步验证")
+	}
+	if !twoFactor.Verify(code) {
+		return nil, errors.New("验证码错误")
+	}
+	return twoFactor, nil
+}
+
+func markTwoFactorVerified(c *gin.Context) error {
+	session := sessions.Default(c)
+	session.Set(constant.SessionKeyTwoFactorVerifiedAt, common.GetTimestamp())
+	return session.Save()
+}
+
+func isTwoFactorRequired(role int) bool {
+	return system_setting.GetTwoFactorSetting().RequireForAdmin && role >= common.RoleAdminUser
+}
+
+// LoginTwoFactor 密码或第三方登录后提交两步验证码完成登录
+func LoginTwoFactor(c *gin.Context) {
+	session := sessions.Default(c)
+	userId, ok := session.Get(constant.SessionKeyPendingTwoFactorUserId).(int)
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "登录状态已过期，请重新登录",
+		})
+		return
+	}
+	code, err := bindTwoFactorCode(c)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	twoFactor, err := model.GetTwoFactorByUserId(userId)
+	if err != nil || !twoFactor.Enabled {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "验证码错误",
+		})
+		return
+	}
+	// 失败次数按用户记录在服务端，清除 cookie 无法绕过锁定
+	if !twoFactor.Verify(code) {
+		message := "验证码错误"
+		if seconds := twoFactor.LockedSeconds(); seconds > 0 {
+			message = fmt.Sprintf("验证失败次数过多，请 %d 分钟后再试", (seconds+59)/60)
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": message,
+		})
+		return
+	}
+	user, err := model.GetUserById(userId, false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if user.Status != common.UserStatusEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "用户已被封禁",
+		})
+		return
+	}
+	completeLogin(user, c, true)
+}
+
+func GetTwoFactorStatus(c *gin.Context) {
+	data := gin.H{
+		"enabled":                  false,
+		"recovery_codes_remaining": 0,
+		"required":                 isTwoFactorRequired(c.GetInt("role")),
+	}
+	if twoFactor, err := model.GetTwoFactorByUserId(c.GetInt("id")); err == nil && twoFactor.Enabled {
+		data["enabled"] = true
+		data["recovery_codes_remaining"] = twoFactor.RecoveryCodesRemaining()
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    data,
+	})
+}
+
+// SetupTwoFactor 生成 TOTP 密钥，用户在验证器应用中添加后调用 EnableTwoFactor 启用
+func SetupTwoFactor(c *gin.Context) {
+	twoFactor, err := model.SetupTwoFactor(c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"secret": twoFactor.Secret,
+			"uri":    common.TOTPAuthURL(common.SystemName, c.GetString("username"), twoFactor.Secret),
+		},
+	})
+}
+
+// EnableTwoFactor 校验验证器应用生成的验证码后启用两步验证，并返回一次性恢复码
+func EnableTwoFactor(c *gin.Context) {
+	code, err := bindTwoFactorCode(c)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	twoFactor, err := model.GetTwoFactorByUserId(c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "请先生成两步验证密钥",
+		})
+		return
+	}
+	if twoFactor.Enabled {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "两步验证已启用",
+		})
+		return
+	}
+	if !twoFactor.Verify(code) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "验证码错误",
+		})
+		return
+	}
+	if err = twoFactor.Enable(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	codes, err := twoFactor.GenerateRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	_ = markTwoFactorVerified(c)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"recovery_codes": codes,
+		},
+	})
+}
+
+func DisableTwoFactor(c *gin.Context) {
+	if isTwoFactorRequired(c.GetInt("role")) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "管理员账户必须启用两步验证",
+		})
+		return
+	}
+	if _, err := verifyUserTwoFactor(c); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err := model.DisableTwoFactor(c.GetInt("id")); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	session := sessions.Default(c)
+	session.Delete(constant.SessionKeyTwoFactorVerifiedAt)
+	_ = session.Save()
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// RegenerateTwoFactorRecoveryCodes 重新生成恢复码，旧的恢复码全部失效
+func RegenerateTwoFactorRecoveryCodes(c *gin.Context) {
+	twoFactor, err := verifyUserTwoFactor(c)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	codes, err := twoFactor.GenerateRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"recovery_codes": codes,
+		},
+	})
+}
+
+// VerifyTwoFactor 执行敏感操作前重新进行两步验证
+func VerifyTwoFactor(c *gin.Context) {
+	if _, err := verifyUserTwoFactor(c); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err := markTwoFactorVerified(c); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无法保存会话信息，请重试",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
@@ -11,7 +11,8 @@ func GetAllQuotaDates(c *gin.Context) {
 	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
 	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
 	username := c.Query("username")
-	dates, err := model.GetAllQuotaDates(startTimestamp, endTimestamp, username)
+	orgId, _ := strconv.Atoi(c.Query("org_id"))
+	dates, err := model.GetAllQuotaDates(startTimestamp, endTimestamp, username, orgId)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
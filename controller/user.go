@@ -11,6 +11,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"one-api/constant"
 
@@ -65,8 +66,38 @@ func Login(c *gin.Context) {
 }
 
 // setup session & cookies and then return user info
+// 启用了两步验证的用户只记录待验证状态，由 LoginTwoFactor 完成登录
 func setupLogin(user *model.User, c *gin.Context) {
 	session := sessions.Default(c)
+	if model.IsTwoFactorEnabled(user.Id) {
+		session.Clear()
+		session.Set(constant.SessionKeyPendingTwoFactorUserId, user.Id)
+		if err := session.Save(); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"message": "无法保存会话信息，请重试",
+				"success": false,
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message": "请输入两步验证码",
+			"success": true,
+			"data": gin.H{
+				"require_2fa": true,
+			},
+		})
+		return
+	}
+	completeLogin(user, c, false)
+}
+
+// completeLogin 写入登录会话，twoFactorVerified 表示本次登录已完成两步验证
+func completeLogin(user *model.User, c *gin.Context, twoFactorVerified bool) {
+	session := sessions.Default(c)
+	session.Delete(constant.SessionKeyPendingTwoFactorUserId)
+	if twoFactorVerified {
+		session.Set(constant.SessionKeyTwoFactorVerifiedAt, common.GetTimestamp())
+	}
 	session.Set("id", user.Id)
 	session.Set("username", user.Username)
 	session.Set("role", user.Role)
@@ -348,6 +379,14 @@ func GenerateAccessToken(c *gin.Context) {
 		})
 		return
 	}
+	// access token 不经过两步验证，要求启用两步验证的管理员需先启用才能生成
+	if isTwoFactorRequired(user.Role) && !model.IsTwoFactorEnabled(user.Id) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "管理员账户需要先启用两步验证",
+		})
+		return
+	}
 	// get rand int 28-32
 	randI := common.GetRandomInt(4)
 	key, err := common.GenerateRandomKey(29 + randI)
@@ -517,7 +556,7 @@ func UpdateUser(c *gin.Context) {
 		})
 		return
 	}
-	originUser, err := model.GetUserById(updatedUser.Id, false)
+	originUser, err := model.GetUserById(updatedUser.Id, true)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -554,6 +593,9 @@ func UpdateUser(c *gin.Context) {
 	if originUser.Quota != updatedUser.Quota {
 		model.RecordLog(originUser.Id, model.LogTypeManage, fmt.Sprintf("管理员将用户额度从 %s修改为 %s", common.LogQuota(originUser.Quota), common.LogQuota(updatedUser.Quota)))
 	}
+	if newUser, err := model.GetUserById(updatedUser.Id, true); err == nil {
+		model.SetAuditDiff(c, updatedUser.Id, originUser, newUser)
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -641,6 +683,7 @@ func DeleteUser(c *gin.Context) {
 		})
 		return
 	}
+	model.SetAuditDiff(c, id, originUser, nil)
 }
 
 func DeleteSelf(c *gin.Context) {
@@ -757,6 +800,8 @@ func ManageUser(c *gin.Context) {
 		})
 		return
 	}
+	originUser := user
+	model.SetAuditAction(c, req.Action)
 	switch req.Action {
 	case "disable":
 		user.Status = common.UserStatusDisabled
@@ -816,6 +861,15 @@ func ManageUser(c *gin.Context) {
 			return
 		}
 		user.Role = common.RoleCommonUser
+	case "reset_2fa":
+		// 用户丢失验证器和恢复码时由管理员重置
+		if err := model.DisableTwoFactor(user.Id); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
 	}
 
 	if err := user.Update(false); err != nil {
@@ -825,6 +879,7 @@ func ManageUser(c *gin.Context) {
 		})
 		return
 	}
+	model.SetAuditDiff(c, user.Id, originUser, user)
 	clearUser := model.User{
 		Role:   user.Role,
 		Status: user.Status,
@@ -896,7 +951,7 @@ func TopUp(c *gin.Context) {
 		return
 	}
 	id := c.GetInt("id")
-	quota, err := model.Redeem(req.Key, id)
+	record, err := model.Redeem(req.Key, id)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -904,10 +959,19 @@ func TopUp(c *gin.Context) {
 		})
 		return
 	}
+	// data 保持为增加的额度，其他奖励通过 message 和 reward 说明
+	message := ""
+	switch record.RewardType {
+	case model.RedemptionRewardGroup:
+		message = fmt.Sprintf("已升级到分组 %s", record.GrantGroup)
+	case model.RedemptionRewardToken:
+		message = fmt.Sprintf("已获得限时令牌，有效期至 %s", time.Unix(record.ExpiredTime, 0).Format("2006-01-02 15:04:05"))
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"message": "",
-		"data":    quota,
+		"message": message,
+		"data":    record.Quota,
+		"reward":  record,
 	})
 	return
 }
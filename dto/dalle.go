@@ -1,5 +1,7 @@
 package dto
 
+import "mime/multipart"
+
 type ImageRequest struct {
 	Model          string `json:"model"`
 	Prompt         string `json:"prompt" binding:"required"`
@@ -11,6 +13,20 @@ type ImageRequest struct {
 	User           string `json:"user,omitempty"`
 }
 
+// ImageEditRequest /v1/images/edits 和 /v1/images/variations 的 multipart 请求，变体请求没有 prompt 和 mask
+type ImageEditRequest struct {
+	Model          string
+	Prompt         string
+	N              int
+	Size           string
+	Quality        string
+	ResponseFormat string
+	User           string
+	// Images 上传的图片，gpt-image-1 支持通过 image[] 上传多张
+	Images []*multipart.FileHeader
+	Mask   *multipart.FileHeader
+}
+
 type ImageResponse struct {
 	Data    []ImageData `json:"data"`
 	Created int64       `json:"created"`
@@ -0,0 +1,244 @@
+package dto
+
+import (
+	"encoding/json"
+)
+
+// OpenAIResponsesRequest https://platform.openai.com/docs/api-reference/responses/create
+type OpenAIResponsesRequest struct {
+	Model              string           `json:"model"`
+	Input              json.RawMessage  `json:"input,omitempty"`
+	Include            json.RawMessage  `json:"include,omitempty"`
+	Instructions       string           `json:"instructions,omitempty"`
+	MaxOutputTokens    uint             `json:"max_output_tokens,omitempty"`
+	Metadata           json.RawMessage  `json:"metadata,omitempty"`
+	ParallelToolCalls  *bool            `json:"parallel_tool_calls,omitempty"`
+	PreviousResponseID string           `json:"previous_response_id,omitempty"`
+	Reasoning          *ResponsesReason `json:"reasoning,omitempty"`
+	Store              *bool            `json:"store,omitempty"`
+	Stream             bool             `json:"stream,omitempty"`
+	Temperature        *float64         `json:"temperature,omitempty"`
+	Text               json.RawMessage  `json:"text,omitempty"`
+	ToolChoice         json.RawMessage  `json:"tool_choice,omitempty"`
+	Tools              json.RawMessage  `json:"tools,omitempty"`
+	TopP               *float64         `json:"top_p,omitempty"`
+	Truncation         string           `json:"truncation,omitempty"`
+	User               string           `json:"user,omitempty"`
+}
+
+type ResponsesReason struct {
+	Effort  string `json:"effort,omitempty"`
+	Summary string `json:"summary,omitempty"`
+}
+
+// ResponsesInputItem 输入项，可以是消息、函数调用或函数调用结果
+type ResponsesInputItem struct {
+	Type      string          `json:"type,omitempty"`
+	Role      string          `json:"role,omitempty"`
+	Content   json.RawMessage `json:"content,omitempty"`
+	CallId    string          `json:"call_id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Arguments string          `json:"arguments,omitempty"`
+	Output    string          `json:"output,omitempty"`
+}
+
+type ResponsesInputContent struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	ImageUrl string `json:"image_url,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	FileId   string `json:"file_id,omitempty"`
+	FileData string `json:"file_data,omitempty"`
+	Filename string `json:"filename,omitempty"`
+}
+
+type ResponsesTool struct {
+	Type        string `json:"type"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	Parameters  any    `json:"parameters,omitempty"`
+	Strict      any    `json:"strict,omitempty"`
+}
+
+// IsStringInput input 可以是字符串或者输入项数组
+func (r *OpenAIResponsesRequest) IsStringInput() bool {
+	var s string
+	return json.Unmarshal(r.Input, &s) == nil
+}
+
+func (r *OpenAIResponsesRequest) GetStringInput() string {
+	var s string
+	_ = json.Unmarshal(r.Input, &s)
+	return s
+}
+
+func (r *OpenAIResponsesRequest) ParseInput() []ResponsesInputItem {
+	var items []ResponsesInputItem
+	_ = json.Unmarshal(r.Input, &items)
+	return items
+}
+
+func (r *OpenAIResponsesRequest) ParseTools() []ResponsesTool {
+	var tools []ResponsesTool
+	_ = json.Unmarshal(r.Tools, &tools)
+	return tools
+}
+
+func (i *ResponsesInputItem) IsStringContent() bool {
+	var s string
+	return json.Unmarshal(i.Content, &s) == nil
+}
+
+func (i *ResponsesInputItem) GetStringContent() string {
+	var s string
+	_ = json.Unmarshal(i.Content, &s)
+	return s
+}
+
+func (i *ResponsesInputItem) ParseContent() []ResponsesInputContent {
+	var contents []ResponsesInputContent
+	_ = json.Unmarshal(i.Content, &contents)
+	return contents
+}
+
+const (
+	ResponsesOutputTypeMessage      = "message"
+	ResponsesOutputTypeFunctionCall = "function_call"
+	ResponsesOutputTypeReasoning    = "reasoning"
+
+	ResponsesContentTypeOutputText = "output_text"
+	ResponsesContentTypeInputText  = "input_text"
+	ResponsesContentTypeInputImage = "input_image"
+	ResponsesContentTypeInputFile  = "input_file"
+	ResponsesContentTypeSummary    = "summary_text"
+
+	ResponsesStatusInProgress = "in_progress"
+	ResponsesStatusCompleted  = "completed"
+	ResponsesStatusIncomplete = "incomplete"
+)
+
+type OpenAIResponsesResponse struct {
+	ID                 string                      `json:"id"`
+	Object             string                      `json:"object"`
+	CreatedAt          int64                       `json:"created_at"`
+	Status             string                      `json:"status"`
+	Error              *OpenAIError                `json:"error"`
+	IncompleteDetails  *ResponsesIncompleteDetails `json:"incomplete_details"`
+	Instructions       string                      `json:"instructions,omitempty"`
+	MaxOutputTokens    uint                        `json:"max_output_tokens,omitempty"`
+	Model              string                      `json:"model"`
+	Output             []ResponsesOutput           `json:"output"`
+	ParallelToolCalls  bool                        `json:"parallel_tool_calls"`
+	PreviousResponseID string                      `json:"previous_response_id,omitempty"`
+	Reasoning          *ResponsesReason            `json:"reasoning,omitempty"`
+	Temperature        *float64                    `json:"temperature,omitempty"`
+	ToolChoice         json.RawMessage             `json:"tool_choice,omitempty"`
+	Tools              json.RawMessage             `json:"tools,omitempty"`
+	TopP               *float64                    `json:"top_p,omitempty"`
+	Usage              *ResponsesUsage             `json:"usage"`
+	User               string                      `json:"user,omitempty"`
+	Metadata           json.RawMessage             `json:"metadata,omitempty"`
+}
+
+type ResponsesIncompleteDetails struct {
+	Reason string `json:"reason"`
+}
+
+type ResponsesOutput struct {
+	Type      string                   `json:"type"`
+	ID        string                   `json:"id"`
+	Status    string                   `json:"status,omitempty"`
+	Role      string                   `json:"role,omitempty"`
+	Content   []ResponsesOutputContent `json:"content,omitempty"`
+	Summary   []ResponsesOutputContent `json:"summary,omitempty"`
+	CallId    string                   `json:"call_id,omitempty"`
+	Name      string                   `json:"name,omitempty"`
+	Arguments string                   `json:"arguments,omitempty"`
+}
+
+type ResponsesOutputContent struct {
+	Type        string `json:"type"`
+	Text        string `json:"text"`
+	Annotations []any  `json:"annotations,omitempty"`
+}
+
+type ResponsesUsage struct {
+	InputTokens         int                           `json:"input_tokens"`
+	OutputTokens        int                           `json:"output_tokens"`
+	TotalTokens         int                           `json:"total_tokens"`
+	InputTokensDetails  *ResponsesInputTokensDetails  `json:"input_tokens_details,omitempty"`
+	OutputTokensDetails *ResponsesOutputTokensDetails `json:"output_tokens_details,omitempty"`
+}
+
+type ResponsesInputTokensDetails struct {
+	CachedTokens int `json:"cached_tokens"`
+}
+
+type ResponsesOutputTokensDetails struct {
+	ReasoningTokens int `json:"reasoning_tokens"`
+}
+
+// ToUsage 转换为内部通用的 Usage
+func (u *ResponsesUsage) ToUsage() *Usage {
+	usage := &Usage{
+		PromptTokens:     u.InputTokens,
+		CompletionTokens: u.OutputTokens,
+		TotalTokens:      u.TotalTokens,
+	}
+	if u.InputTokensDetails != nil {
+		usage.PromptTokensDetails.CachedTokens = u.InputTokensDetails.CachedTokens
+	}
+	if u.OutputTokensDetails != nil {
+		usage.CompletionTokenDetails.ReasoningTokens = u.OutputTokensDetails.ReasoningTokens
+	}
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	return usage
+}
+
+func NewResponsesUsage(usage *Usage) *ResponsesUsage {
+	return &ResponsesUsage{
+		InputTokens:  usage.PromptTokens,
+		OutputTokens: usage.CompletionTokens,
+		TotalTokens:  usage.PromptTokens + usage.CompletionTokens,
+		InputTokensDetails: &ResponsesInputTokensDetails{
+			CachedTokens: usage.PromptTokensDetails.CachedTokens,
+		},
+		OutputTokensDetails: &ResponsesOutputTokensDetails{
+			ReasoningTokens: usage.CompletionTokenDetails.ReasoningTokens,
+		},
+	}
+}
+
+const (
+	ResponsesEventCreated               = "response.created"
+	ResponsesEventInProgress            = "response.in_progress"
+	ResponsesEventCompleted             = "response.completed"
+	ResponsesEventIncomplete            = "response.incomplete"
+	ResponsesEventFailed                = "response.failed"
+	ResponsesEventOutputItemAdded       = "response.output_item.added"
+	ResponsesEventOutputItemDone        = "response.output_item.done"
+	ResponsesEventContentPartAdded      = "response.content_part.added"
+	ResponsesEventContentPartDone       = "response.content_part.done"
+	ResponsesEventOutputTextDelta       = "response.output_text.delta"
+	ResponsesEventOutputTextDone        = "response.output_text.done"
+	ResponsesEventFunctionArgsDelta     = "response.function_call_arguments.delta"
+	ResponsesEventFunctionArgsDone      = "response.function_call_arguments.done"
+	ResponsesEventReasoningSummaryDelta = "response.reasoning_summary_text.delta"
+	ResponsesEventReasoningSummaryDone  = "response.reasoning_summary_text.done"
+)
+
+type ResponsesStreamResponse struct {
+	Type         string                   `json:"type"`
+	Response     *OpenAIResponsesResponse `json:"response,omitempty"`
+	OutputIndex  *int                     `json:"output_index,omitempty"`
+	ContentIndex *int                     `json:"content_index,omitempty"`
+	SummaryIndex *int                     `json:"summary_index,omitempty"`
+	ItemID       string                   `json:"item_id,omitempty"`
+	Item         *ResponsesOutput         `json:"item,omitempty"`
+	Part         *ResponsesOutputContent  `json:"part,omitempty"`
+	Delta        string                   `json:"delta,omitempty"`
+	Text         string                   `json:"text,omitempty"`
+	Arguments    string                   `json:"arguments,omitempty"`
+}
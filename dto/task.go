@@ -1,5 +1,7 @@
 package dto
 
+import "encoding/json"
+
 type TaskError struct {
 	Code       string `json:"code"`
 	Message    string `json:"message"`
@@ -8,3 +10,15 @@ type TaskError struct {
 	LocalError bool   `json:"-"`
 	Error      error  `json:"-"`
 }
+
+// TaskInfo 轮询上游得到的任务状态，Status 取值与 model.TaskStatus 一致
+type TaskInfo struct {
+	TaskID     string
+	Status     string
+	Progress   string
+	FailReason string
+	SubmitTime int64
+	StartTime  int64
+	FinishTime int64
+	Data       json.RawMessage
+}
@@ -0,0 +1,37 @@
+package dto
+
+// VideoGenerationRequest /v1/video/generations 统一的视频生成请求，由各平台适配器转换为上游格式
+type VideoGenerationRequest struct {
+	Model          string `json:"model"`
+	Prompt         string `json:"prompt"`
+	NegativePrompt string `json:"negative_prompt,omitempty"`
+	// Image 首帧图片，URL 或 base64，传入时为图生视频
+	Image string `json:"image,omitempty"`
+	// Duration 视频时长，单位秒
+	Duration    int    `json:"duration,omitempty"`
+	AspectRatio string `json:"aspect_ratio,omitempty"`
+	Resolution  string `json:"resolution,omitempty"`
+	Seed        *int   `json:"seed,omitempty"`
+	// Metadata 平台特有参数，原样合并到上游请求体
+	Metadata map[string]any `json:"metadata,omitempty"`
+}
+
+// VideoTaskResponse 视频生成任务的提交和查询响应
+type VideoTaskResponse struct {
+	TaskID     string `json:"task_id"`
+	Object     string `json:"object"`
+	Action     string `json:"action,omitempty"`
+	Status     string `json:"status"`
+	Progress   string `json:"progress,omitempty"`
+	Url        string `json:"url,omitempty"`
+	FailReason string `json:"fail_reason,omitempty"`
+	SubmitTime int64  `json:"submit_time,omitempty"`
+	FinishTime int64  `json:"finish_time,omitempty"`
+}
+
+// VideoTaskData 视频任务完成后保存在 Task.Data 中的结果
+type VideoTaskData struct {
+	Url      string   `json:"url"`
+	Urls     []string `json:"urls,omitempty"`
+	CoverUrl string   `json:"cover_url,omitempty"`
+}
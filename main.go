@@ -2,6 +2,7 @@ package main
 
 import (
 	"embed"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
@@ -14,7 +15,9 @@ import (
 	"one-api/service"
 	"one-api/setting/operation_setting"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/bytedance/gopkg/util/gopool"
 	"github.com/gin-contrib/sessions"
@@ -77,9 +80,35 @@ func main() {
 	operation_setting.InitModelSettings()
 	// Initialize constants
 	constant.InitEnv()
+	// Initialize tracing
+	shutdownTracing := common.InitTracing()
+	defer shutdownTracing()
 	// Initialize options
 	model.InitOptionMap()
 
+	if *common.RotateSecretKey {
+		if err := rotateSecretKey(); err != nil {
+			common.FatalLog("failed to rotate secret key: " + err.Error())
+		}
+		return
+	}
+	if common.SecretEncryptionKey != "" && common.IsMasterNode {
+		count, err := model.MigrateSecretsIfNeeded()
+		if err != nil {
+			common.FatalLog("failed to encrypt secrets: " + err.Error())
+		}
+		if count > 0 {
+			common.SysLog(fmt.Sprintf("encrypted %d stored secrets", count))
+		}
+	}
+
+	if *common.ExportConfig != "" || *common.ImportConfig != "" {
+		if err := runConfigCommand(); err != nil {
+			common.FatalLog(err.Error())
+		}
+		return
+	}
+
 	if common.RedisEnabled {
 		// for compatibility with old versions
 		common.MemoryCacheEnabled = true
@@ -97,6 +126,13 @@ func main() {
 	// 数据看板
 	go model.UpdateQuotaData()
 
+	if common.IsMasterNode {
+		go model.CleanExpiredAuditLogs()
+		go model.AutoGenerateBillingStatements()
+		go service.AutoCheckCreditAccounts()
+		go model.ReclaimExpiredRedemptionTokens()
+	}
+
 	if os.Getenv("CHANNEL_UPDATE_FREQUENCY") != "" {
 		frequency, err := strconv.Atoi(os.Getenv("CHANNEL_UPDATE_FREQUENCY"))
 		if err != nil {
@@ -118,6 +154,9 @@ func main() {
 		gopool.Go(func() {
 			controller.UpdateTaskBulk()
 		})
+		gopool.Go(func() {
+			service.RetryTaskCallbacks()
+		})
 	}
 	if os.Getenv("BATCH_UPDATE_ENABLED") == "true" {
 		common.BatchUpdateEnabled = true
@@ -149,6 +188,7 @@ func main() {
 	// This will cause SSE not to work!!!
 	//server.Use(gzip.Gzip(gzip.DefaultCompression))
 	server.Use(middleware.RequestId())
+	server.Use(middleware.Tracing())
 	middleware.SetUpLogger(server)
 	// Initialize session store
 	store := cookie.NewStore([]byte(common.SessionSecret))
@@ -162,6 +202,7 @@ func main() {
 	server.Use(sessions.Sessions("session", store))
 
 	router.SetRouter(server, buildFS, indexPage)
+	controller.SetBatchRelayHandler(server)
 	var port = os.Getenv("PORT")
 	if port == "" {
 		port = strconv.Itoa(*common.Port)
@@ -171,3 +212,62 @@ func main() {
 		common.FatalLog("failed to start HTTP server: " + err.Error())
 	}
 }
+
+// runConfigCommand 处理 --export-config 和 --import-config 命令行参数
+func runConfigCommand() error {
+	passphrase := os.Getenv("CONFIG_PASSPHRASE")
+	if *common.ExportConfig != "" {
+		document, err := model.ExportConfigDocument(*common.ConfigSecrets, passphrase)
+		if err != nil {
+			return err
+		}
+		data, err := model.MarshalConfigDocument(document, strings.TrimPrefix(filepath.Ext(*common.ExportConfig), "."))
+		if err != nil {
+			return err
+		}
+		if err = os.WriteFile(*common.ExportConfig, data, 0600); err != nil {
+			return err
+		}
+		common.SysLog(fmt.Sprintf("exported %d options and %d channels to %s", len(document.Options), len(document.Channels), *common.ExportConfig))
+		return nil
+	}
+	data, err := os.ReadFile(*common.ImportConfig)
+	if err != nil {
+		return err
+	}
+	document, err := model.UnmarshalConfigDocument(data)
+	if err != nil {
+		return err
+	}
+	changes, err := model.PlanConfigImport(document, passphrase)
+	if err != nil {
+		return err
+	}
+	for _, change := range changes {
+		diff, _ := json.Marshal(change.Diff)
+		fmt.Printf("%s %s %s: %s\n", change.Action, change.Type, change.Key, diff)
+	}
+	if *common.ConfigDryRun {
+		common.SysLog(fmt.Sprintf("dry run, %d changes not applied", len(changes)))
+		return nil
+	}
+	if err = model.ApplyConfigChanges(changes); err != nil {
+		return err
+	}
+	common.SysLog(fmt.Sprintf("imported configuration from %s, %d changes applied", *common.ImportConfig, len(changes)))
+	return nil
+}
+
+// rotateSecretKey 将旧主密钥加密的数据使用新主密钥重新加密
+func rotateSecretKey() error {
+	oldKey, err := common.LoadSecretKey("SECRET_ENCRYPTION_OLD_KEY")
+	if err != nil {
+		return err
+	}
+	count, err := model.MigrateSecrets(oldKey)
+	if err != nil {
+		return err
+	}
+	common.SysLog(fmt.Sprintf("re-encrypted %d stored secrets with the new master key", count))
+	return nil
+}
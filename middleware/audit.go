@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 审计只需要解析响应中的 success 字段，不保存完整响应
+const auditResponseCaptureLimit = 4096
+
+type auditResponseWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *auditResponseWriter) Write(data []byte) (int, error) {
+	if w.body.Len() < auditResponseCaptureLimit {
+		w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *auditResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func auditActionByMethod(method string) string {
+	switch method {
+	case http.MethodPost:
+		return model.AuditActionCreate
+	case http.MethodDelete:
+		return model.AuditActionDelete
+	default:
+		return model.AuditActionUpdate
+	}
+}
+
+// Audit 记录管理接口的变更操作，需放在鉴权中间件之后，GET 请求不记录。
+// 接口未通过 model.SetAuditDiff 提供变更前后状态时，以请求参数作为变更内容
+func Audit(targetType string) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodGet {
+			c.Next()
+			return
+		}
+		audit(c, targetType, "")
+	}
+}
+
+// AuditOperation 记录测试渠道、更新余额等有副作用的操作，GET 请求同样记录，action 为操作类型
+func AuditOperation(targetType string, action string) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		audit(c, targetType, action)
+	}
+}
+
+func audit(c *gin.Context, targetType string, action string) {
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil {
+		common.LogError(c, "failed to read request body for audit: "+err.Error())
+	}
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+	writer := &auditResponseWriter{ResponseWriter: c.Writer}
+	c.Writer = writer
+
+	c.Next()
+
+	c.Writer = writer.ResponseWriter
+	targetId, diff, ok := model.GetAuditDiff(c)
+	if !ok {
+		var params map[string]any
+		_ = json.Unmarshal(requestBody, &params)
+		if params == nil && c.Request.Method == http.MethodGet {
+			params = make(map[string]any)
+			for key := range c.Request.URL.Query() {
+				params[key] = c.Query(key)
+			}
+		}
+		diff = model.ComputeAuditDiff(nil, params)
+		targetId = c.Param("id")
+		if targetId == "" && params["id"] != nil {
+			targetId = fmt.Sprintf("%v", params["id"])
+		}
+	}
+	if overrideAction := model.GetAuditAction(c); overrideAction != "" {
+		action = overrideAction
+	}
+	if action == "" {
+		action = auditActionByMethod(c.Request.Method)
+	}
+	success := writer.Status() < http.StatusBadRequest
+	var response struct {
+		Success *bool `json:"success"`
+	}
+	if json.Unmarshal(writer.body.Bytes(), &response) == nil && response.Success != nil {
+		success = *response.Success
+	}
+	model.RecordAuditLog(c, &model.AuditLog{
+		TargetType: targetType,
+		TargetId:   targetId,
+		Action:     action,
+		Success:    success,
+	}, diff)
+}
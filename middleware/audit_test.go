@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"one-api/model"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func setupAuditTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	return setupTestDB(t, &model.AuditLog{})
+}
+
+func TestAudit(t *testing.T) {
+	type channel struct {
+		Id     int    `json:"id"`
+		Name   string `json:"name"`
+		Key    string `json:"key"`
+		Weight int    `json:"weight"`
+	}
+	before := channel{Id: 1, Name: "old", Key: "sk-old", Weight: 1}
+	after := channel{Id: 1, Name: "new", Key: "sk-new", Weight: 2}
+
+	tests := []struct {
+		name       string
+		middleware gin.HandlerFunc
+		method     string
+		path       string
+		body       string
+		handler    gin.HandlerFunc
+		recorded   bool
+		action     string
+		diff       map[string]model.AuditFieldChange
+	}{
+		{
+			name:       "read is not audited",
+			middleware: Audit("channel"),
+			method:     http.MethodGet,
+			path:       "/channel/1",
+			recorded:   false,
+		},
+		{
+			name:       "side effecting get is audited",
+			middleware: AuditOperation("channel", "test"),
+			method:     http.MethodGet,
+			path:       "/channel/test/1?model=gpt-4o",
+			recorded:   true,
+			action:     "test",
+			diff:       map[string]model.AuditFieldChange{"model": {After: "gpt-4o"}},
+		},
+		{
+			name:       "request key is redacted",
+			middleware: AuditOperation("channel", "fetch_models"),
+			method:     http.MethodPost,
+			path:       "/channel/fetch_models",
+			body:       `{"base_url":"https://example.com","key":"sk-secret"}`,
+			recorded:   true,
+			action:     "fetch_models",
+			diff: map[string]model.AuditFieldChange{
+				"base_url": {After: "https://example.com"},
+				"key":      {After: "***"},
+			},
+		},
+		{
+			name:       "partial update only records submitted fields",
+			middleware: Audit("channel"),
+			method:     http.MethodPut,
+			path:       "/channel",
+			body:       `{"id":1,"name":"new","key":"sk-new"}`,
+			handler: func(c *gin.Context) {
+				model.SetAuditPartialDiff(c, 1, before, after, []string{"id", "name", "key"})
+			},
+			recorded: true,
+			action:   model.AuditActionUpdate,
+			diff: map[string]model.AuditFieldChange{
+				"name": {Before: "old", After: "new"},
+				"key":  {Before: "***", After: "***"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupAuditTestDB(t)
+			handler := tt.handler
+			if handler == nil {
+				handler = func(c *gin.Context) {}
+			}
+			router := gin.New()
+			router.Handle(tt.method, strings.Split(tt.path, "?")[0], tt.middleware, func(c *gin.Context) {
+				handler(c)
+				c.JSON(http.StatusOK, gin.H{"success": true})
+			})
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+
+			var logs []model.AuditLog
+			db.Find(&logs)
+			if !tt.recorded {
+				if len(logs) != 0 {
+					t.Fatalf("unexpected audit logs: %+v", logs)
+				}
+				return
+			}
+			if len(logs) != 1 {
+				t.Fatalf("got %d audit logs, want 1", len(logs))
+			}
+			if logs[0].Action != tt.action || !logs[0].Success {
+				t.Errorf("action = %s success = %v, want %s", logs[0].Action, logs[0].Success, tt.action)
+			}
+			var diff map[string]model.AuditFieldChange
+			_ = json.Unmarshal([]byte(logs[0].Diff), &diff)
+			if len(diff) != len(tt.diff) {
+				t.Fatalf("diff = %v, want %v", diff, tt.diff)
+			}
+			for key, want := range tt.diff {
+				if got := diff[key]; got.Before != want.Before || got.After != want.After {
+					t.Errorf("diff[%s] = %v, want %v", key, got, want)
+				}
+			}
+		})
+	}
+}
@@ -1,11 +1,14 @@
 package middleware
 
 import (
+	"crypto/subtle"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"one-api/common"
+	"one-api/constant"
 	"one-api/model"
+	"one-api/setting/system_setting"
 	"strconv"
 	"strings"
 )
@@ -21,7 +24,8 @@ func validUserInfo(username string, role int) bool {
 	return true
 }
 
-func authHelper(c *gin.Context, minRole int) {
+// authHelper 校验登录用户的站点角色，minOrgRole 大于 0 时还要求用户在路径参数 id 指定的组织中拥有该角色
+func authHelper(c *gin.Context, minRole int, minOrgRole int) {
 	session := sessions.Default(c)
 	username := session.Get("username")
 	role := session.Get("role")
@@ -116,6 +120,28 @@ func authHelper(c *gin.Context, minRole int) {
 		c.Abort()
 		return
 	}
+	// 管理接口要求管理员已启用两步验证，仍可访问个人接口完成启用。access token 同样受此限制
+	if minRole >= common.RoleAdminUser && isAdminTwoFactorMissing(role.(int), id.(int)) {
+		abortAdminTwoFactorMissing(c)
+		return
+	}
+	if minOrgRole > 0 {
+		orgRole := common.OrgRoleOwner
+		// 站点管理员可以管理所有组织
+		if role.(int) < common.RoleAdminUser {
+			orgId, _ := strconv.Atoi(c.Param("id"))
+			orgRole, err = model.GetOrgMemberRole(orgId, id.(int))
+			if err != nil || orgRole < minOrgRole {
+				c.JSON(http.StatusOK, gin.H{
+					"success": false,
+					"message": "无权进行此操作，组织权限不足",
+				})
+				c.Abort()
+				return
+			}
+		}
+		c.Set("org_role", orgRole)
+	}
 	c.Set("username", username)
 	c.Set("role", role)
 	c.Set("id", id)
@@ -124,6 +150,103 @@ func authHelper(c *gin.Context, minRole int) {
 	c.Next()
 }
 
+// isAdminTwoFactorMissing 要求管理员启用两步验证但该管理员尚未启用
+func isAdminTwoFactorMissing(role int, userId int) bool {
+	return role >= common.RoleAdminUser && system_setting.GetTwoFactorSetting().RequireForAdmin &&
+		!model.IsTwoFactorEnabled(userId)
+}
+
+func abortAdminTwoFactorMissing(c *gin.Context) {
+	c.JSON(http.StatusForbidden, gin.H{
+		"success": false,
+		"message": "管理员账户需要先启用两步验证",
+	})
+	c.Abort()
+}
+
+// ScopedAuth 与 authHelper 相同，同时允许使用持有对应权限范围的管理 API 密钥访问。
+// scope 只包含资源名时按请求方法推导，GET 需要 read 权限，其余需要 write 权限
+func ScopedAuth(minRole int, scope string) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		key := strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer ")
+		if !strings.HasPrefix(key, model.AdminApiKeyPrefix) {
+			authHelper(c, minRole, 0)
+			return
+		}
+		requiredScope := scope
+		if !strings.Contains(scope, ":") {
+			if c.Request.Method == http.MethodGet {
+				requiredScope = scope + ":read"
+			} else {
+				requiredScope = scope + ":write"
+			}
+		}
+		adminApiKeyAuth(c, key, minRole, requiredScope)
+	}
+}
+
+func adminApiKeyAuth(c *gin.Context, key string, minRole int, scope string) {
+	apiKey, err := model.ValidateAdminApiKey(key)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		c.Abort()
+		return
+	}
+	// 请求处理完成后记录调用，被拒绝的调用同样记录
+	defer func() {
+		model.RecordAdminApiKeyUse(&model.AdminApiKeyLog{
+			KeyId:      apiKey.Id,
+			UserId:     apiKey.UserId,
+			Method:     c.Request.Method,
+			Path:       c.Request.URL.Path,
+			Ip:         c.ClientIP(),
+			StatusCode: c.Writer.Status(),
+		})
+	}()
+	if !apiKey.IsIpAllowed(c.ClientIP()) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "您的 IP 不在该管理 API 密钥允许访问的列表中",
+		})
+		c.Abort()
+		return
+	}
+	if !apiKey.HasScope(scope) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "无权进行此操作，管理 API 密钥缺少权限 " + scope,
+		})
+		c.Abort()
+		return
+	}
+	// 密钥以创建者的身份访问，创建者被封禁或降级后密钥随之失效
+	user, err := model.GetUserById(apiKey.UserId, false)
+	if err != nil || user.Status != common.UserStatusEnabled || user.Role < minRole {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "无权进行此操作，权限不足",
+		})
+		c.Abort()
+		return
+	}
+	// 创建者未按要求启用两步验证时密钥不可用
+	if isAdminTwoFactorMissing(user.Role, user.Id) {
+		abortAdminTwoFactorMissing(c)
+		return
+	}
+	c.Set("username", user.Username)
+	c.Set("role", user.Role)
+	c.Set("id", user.Id)
+	c.Set("group", user.Group)
+	c.Set("use_access_token", true)
+	c.Set("admin_api_key_id", apiKey.Id)
+	c.Set("admin_api_key", apiKey)
+	c.Next()
+}
+
 func TryUserAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
 		session := sessions.Default(c)
@@ -137,19 +260,66 @@ func TryUserAuth() func(c *gin.Context) {
 
 func UserAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
-		authHelper(c, common.RoleCommonUser)
+		authHelper(c, common.RoleCommonUser, 0)
+	}
+}
+
+// OrgAuth 要求登录用户在组织中至少拥有 minOrgRole 角色
+func OrgAuth(minOrgRole int) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		authHelper(c, common.RoleCommonUser, minOrgRole)
 	}
 }
 
 func AdminAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
-		authHelper(c, common.RoleAdminUser)
+		authHelper(c, common.RoleAdminUser, 0)
+	}
+}
+
+// MetricsAuth 允许携带 METRICS_TOKEN 的采集请求，否则要求管理员登录
+func MetricsAuth() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		authorization := []byte(c.Request.Header.Get("Authorization"))
+		if constant.MetricsToken != "" && subtle.ConstantTimeCompare(authorization, []byte("Bearer "+constant.MetricsToken)) == 1 {
+			c.Next()
+			return
+		}
+		authHelper(c, common.RoleAdminUser, 0)
 	}
 }
 
 func RootAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
-		authHelper(c, common.RoleRootUser)
+		authHelper(c, common.RoleRootUser, 0)
+	}
+}
+
+// RequireRecentTwoFactor 要求启用了两步验证的用户在近期完成过验证，用于生成访问令牌、删除渠道、修改设置等敏感操作，
+// 需放在鉴权中间件之后。access token 和管理 API 密钥不经过登录流程，不要求近期验证，
+// 但要求管理员启用两步验证时，未启用的管理员无论使用何种方式都会被拒绝
+func RequireRecentTwoFactor() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		if isAdminTwoFactorMissing(c.GetInt("role"), c.GetInt("id")) {
+			abortAdminTwoFactorMissing(c)
+			return
+		}
+		if c.GetBool("use_access_token") || !model.IsTwoFactorEnabled(c.GetInt("id")) {
+			c.Next()
+			return
+		}
+		verifiedAt, _ := sessions.Default(c).Get(constant.SessionKeyTwoFactorVerifiedAt).(int64)
+		window := int64(system_setting.GetTwoFactorSetting().RecentVerifyMinutes) * 60
+		if common.GetTimestamp()-verifiedAt > window {
+			c.JSON(http.StatusForbidden, gin.H{
+				"success":     false,
+				"message":     "该操作需要重新进行两步验证",
+				"require_2fa": true,
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
 	}
 }
 
@@ -157,93 +327,134 @@ func WssAuth(c *gin.Context) {
 
 }
 
+// TokenAuth 校验令牌，span 在调用后续处理前结束，只包含校验本身
 func TokenAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
-		// 先检测是否为ws
-		if c.Request.Header.Get("Sec-WebSocket-Protocol") != "" {
-			// Sec-WebSocket-Protocol: realtime, openai-insecure-api-key.sk-xxx, openai-beta.realtime-v1
-			// read sk from Sec-WebSocket-Protocol
-			key := c.Request.Header.Get("Sec-WebSocket-Protocol")
-			parts := strings.Split(key, ",")
-			for _, part := range parts {
-				part = strings.TrimSpace(part)
-				if strings.HasPrefix(part, "openai-insecure-api-key") {
-					key = strings.TrimPrefix(part, "openai-insecure-api-key.")
-					break
-				}
+		_, span := common.StartSpan(c.Request.Context(), "auth")
+		authenticateToken(c)
+		endMiddlewareSpan(c, span)
+		c.Next()
+	}
+}
+
+func authenticateToken(c *gin.Context) {
+	// 先检测是否为ws
+	if c.Request.Header.Get("Sec-WebSocket-Protocol") != "" {
+		// Sec-WebSocket-Protocol: realtime, openai-insecure-api-key.sk-xxx, openai-beta.realtime-v1
+		// read sk from Sec-WebSocket-Protocol
+		key := c.Request.Header.Get("Sec-WebSocket-Protocol")
+		parts := strings.Split(key, ",")
+		for _, part := range parts {
+			part = strings.TrimSpace(part)
+			if strings.HasPrefix(part, "openai-insecure-api-key") {
+				key = strings.TrimPrefix(part, "openai-insecure-api-key.")
+				break
 			}
+		}
+		c.Request.Header.Set("Authorization", "Bearer "+key)
+	}
+	// 检查path包含/v1/messages
+	if strings.Contains(c.Request.URL.Path, "/v1/messages") {
+		// 从x-api-key中获取key
+		key := c.Request.Header.Get("x-api-key")
+		if key != "" {
 			c.Request.Header.Set("Authorization", "Bearer "+key)
 		}
-		// 检查path包含/v1/messages
-		if strings.Contains(c.Request.URL.Path, "/v1/messages") {
-			// 从x-api-key中获取key
-			key := c.Request.Header.Get("x-api-key")
-			if key != "" {
-				c.Request.Header.Set("Authorization", "Bearer "+key)
-			}
+	}
+	// Gemini 原生接口从 x-goog-api-key 或 key 参数中获取key
+	if strings.HasPrefix(c.Request.URL.Path, "/v1beta/models/") {
+		key := c.Request.Header.Get("x-goog-api-key")
+		if key == "" {
+			key = c.Query("key")
 		}
-		key := c.Request.Header.Get("Authorization")
-		parts := make([]string, 0)
+		if key != "" {
+			c.Request.Header.Set("Authorization", "Bearer "+key)
+		}
+	}
+	key := c.Request.Header.Get("Authorization")
+	parts := make([]string, 0)
+	key = strings.TrimPrefix(key, "Bearer ")
+	if key == "" || key == "midjourney-proxy" {
+		key = c.Request.Header.Get("mj-api-secret")
 		key = strings.TrimPrefix(key, "Bearer ")
-		if key == "" || key == "midjourney-proxy" {
-			key = c.Request.Header.Get("mj-api-secret")
-			key = strings.TrimPrefix(key, "Bearer ")
-			key = strings.TrimPrefix(key, "sk-")
-			parts = strings.Split(key, "-")
-			key = parts[0]
-		} else {
-			key = strings.TrimPrefix(key, "sk-")
-			parts = strings.Split(key, "-")
-			key = parts[0]
-		}
-		token, err := model.ValidateUserToken(key)
-		if token != nil {
-			id := c.GetInt("id")
-			if id == 0 {
-				c.Set("id", token.UserId)
-			}
+		key = strings.TrimPrefix(key, "sk-")
+		parts = strings.Split(key, "-")
+		key = parts[0]
+	} else {
+		key = strings.TrimPrefix(key, "sk-")
+		parts = strings.Split(key, "-")
+		key = parts[0]
+	}
+	token, err := model.ValidateUserToken(key)
+	if token != nil {
+		id := c.GetInt("id")
+		if id == 0 {
+			c.Set("id", token.UserId)
 		}
+	}
+	if err != nil {
+		abortWithOpenAiMessage(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+	userCache, err := model.GetUserCache(token.UserId)
+	if err != nil {
+		abortWithOpenAiMessage(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	userEnabled := userCache.Status == common.UserStatusEnabled
+	if !userEnabled {
+		abortWithOpenAiMessage(c, http.StatusForbidden, "用户已被封禁")
+		return
+	}
+
+	err = model.CheckTokenBudget(token)
+	if err != nil {
+		abortWithOpenAiMessage(c, http.StatusTooManyRequests, err.Error())
+		return
+	}
+	if token.OrgId != 0 {
+		err = model.ValidateOrgToken(token.OrgId, token.UserId)
 		if err != nil {
-			abortWithOpenAiMessage(c, http.StatusUnauthorized, err.Error())
+			abortWithOpenAiMessage(c, http.StatusForbidden, err.Error())
 			return
 		}
-		userCache, err := model.GetUserCache(token.UserId)
+	} else {
+		// 组织令牌使用组织额度，不受个人账户暂停影响
+		err = model.CheckCreditAccount(token.UserId)
 		if err != nil {
-			abortWithOpenAiMessage(c, http.StatusInternalServerError, err.Error())
-			return
-		}
-		userEnabled := userCache.Status == common.UserStatusEnabled
-		if !userEnabled {
-			abortWithOpenAiMessage(c, http.StatusForbidden, "用户已被封禁")
+			abortWithOpenAiMessage(c, http.StatusForbidden, err.Error())
 			return
 		}
+	}
 
-		userCache.WriteContext(c)
+	userCache.WriteContext(c)
 
-		c.Set("id", token.UserId)
-		c.Set("token_id", token.Id)
-		c.Set("token_key", token.Key)
-		c.Set("token_name", token.Name)
-		c.Set("token_unlimited_quota", token.UnlimitedQuota)
-		if !token.UnlimitedQuota {
-			c.Set("token_quota", token.RemainQuota)
-		}
-		if token.ModelLimitsEnabled {
-			c.Set("token_model_limit_enabled", true)
-			c.Set("token_model_limit", token.GetModelLimitsMap())
+	c.Set("id", token.UserId)
+	c.Set("token_id", token.Id)
+	c.Set("token_key", token.Key)
+	c.Set("token_name", token.Name)
+	c.Set("token_unlimited_quota", token.UnlimitedQuota)
+	c.Set("token_budget_enabled", token.HasBudget())
+	c.Set("token_org_id", token.OrgId)
+	if !token.UnlimitedQuota {
+		c.Set("token_quota", token.RemainQuota)
+	}
+	if token.ModelLimitsEnabled {
+		c.Set("token_model_limit_enabled", true)
+		c.Set("token_model_limit", token.GetModelLimitsMap())
+	} else {
+		c.Set("token_model_limit_enabled", false)
+	}
+	c.Set("allow_ips", token.GetIpLimitsMap())
+	c.Set("token_model_fallbacks", token.GetModelFallbacks())
+	c.Set("token_response_cache", token.ResponseCache)
+	c.Set("token_group", token.Group)
+	if len(parts) > 1 {
+		if model.IsAdmin(token.UserId) {
+			c.Set("specific_channel_id", parts[1])
 		} else {
-			c.Set("token_model_limit_enabled", false)
-		}
-		c.Set("allow_ips", token.GetIpLimitsMap())
-		c.Set("token_group", token.Group)
-		if len(parts) > 1 {
-			if model.IsAdmin(token.UserId) {
-				c.Set("specific_channel_id", parts[1])
-			} else {
-				abortWithOpenAiMessage(c, http.StatusForbidden, "普通用户不支持指定渠道")
-				return
-			}
+			abortWithOpenAiMessage(c, http.StatusForbidden, "普通用户不支持指定渠道")
+			return
 		}
-		c.Next()
 	}
 }
@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/model"
+	"one-api/setting/system_setting"
+	"strconv"
+	"testing"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func setupAuthTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := setupTestDB(t, &model.User{}, &model.TwoFactor{})
+	oldSetting := *system_setting.GetTwoFactorSetting()
+	system_setting.GetTwoFactorSetting().RequireForAdmin = true
+	t.Cleanup(func() { *system_setting.GetTwoFactorSetting() = oldSetting })
+	return db
+}
+
+func TestAccessTokenRequiresAdminTwoFactor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupAuthTestDB(t)
+	token := func(s string) *string { return &s }
+	users := []*model.User{
+		{Id: 1, Username: "admin", Role: common.RoleAdminUser, Status: common.UserStatusEnabled, AccessToken: token("admin-token"), AffCode: "a1"},
+		{Id: 2, Username: "admin2fa", Role: common.RoleAdminUser, Status: common.UserStatusEnabled, AccessToken: token("admin2fa-token"), AffCode: "a2"},
+		{Id: 3, Username: "user", Role: common.RoleCommonUser, Status: common.UserStatusEnabled, AccessToken: token("user-token"), AffCode: "a3"},
+	}
+	for _, user := range users {
+		if err := db.Create(user).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Create(&model.TwoFactor{UserId: 2, Enabled: true})
+
+	router := gin.New()
+	router.Use(sessions.Sessions("session", cookie.NewStore([]byte("secret"))))
+	ok := func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"success": true}) }
+	router.GET("/admin", AdminAuth(), ok)
+	router.GET("/self/token", UserAuth(), RequireRecentTwoFactor(), ok)
+
+	tests := []struct {
+		name   string
+		path   string
+		userId int
+		token  string
+		status int
+	}{
+		{"admin route rejects admin without 2fa", "/admin", 1, "admin-token", http.StatusForbidden},
+		{"admin route allows admin with 2fa", "/admin", 2, "admin2fa-token", http.StatusOK},
+		{"sensitive user route rejects admin without 2fa", "/self/token", 1, "admin-token", http.StatusForbidden},
+		{"sensitive user route allows admin with 2fa", "/self/token", 2, "admin2fa-token", http.StatusOK},
+		{"common users are not required to enroll", "/self/token", 3, "user-token", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Authorization", tt.token)
+			req.Header.Set("New-Api-User", strconv.Itoa(tt.userId))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			var resp struct {
+				Success bool `json:"success"`
+			}
+			_ = json.Unmarshal(w.Body.Bytes(), &resp)
+			if w.Code != tt.status || resp.Success != (tt.status == http.StatusOK) {
+				t.Errorf("status = %d, body = %s", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestMetricsAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupAuthTestDB(t)
+	adminToken := "admin2fa-token"
+	if err := db.Create(&model.User{Id: 2, Username: "admin2fa", Role: common.RoleAdminUser, Status: common.UserStatusEnabled,
+		AccessToken: &adminToken, AffCode: "a2"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&model.TwoFactor{UserId: 2, Enabled: true})
+	oldToken := constant.MetricsToken
+	t.Cleanup(func() { constant.MetricsToken = oldToken })
+
+	router := gin.New()
+	router.Use(sessions.Sessions("session", cookie.NewStore([]byte("secret"))))
+	router.GET("/metrics", MetricsAuth(), func(c *gin.Context) { c.String(http.StatusOK, "metrics") })
+
+	tests := []struct {
+		name         string
+		metricsToken string
+		auth         string
+		userId       int
+		allowed      bool
+	}{
+		{"metrics token", "scrape-secret", "Bearer scrape-secret", 0, true},
+		{"wrong metrics token", "scrape-secret", "Bearer wrong", 0, false},
+		{"metrics token without bearer prefix", "scrape-secret", "scrape-secret", 0, false},
+		{"empty metrics token is disabled", "", "Bearer ", 0, false},
+		{"no credentials", "scrape-secret", "", 0, false},
+		{"admin access token", "scrape-secret", adminToken, 2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			constant.MetricsToken = tt.metricsToken
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			req.Header.Set("Authorization", tt.auth)
+			if tt.userId != 0 {
+				req.Header.Set("New-Api-User", strconv.Itoa(tt.userId))
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if allowed := w.Body.String() == "metrics"; allowed != tt.allowed {
+				t.Errorf("allowed = %v, status = %d, body = %s", allowed, w.Code, w.Body.String())
+			}
+		})
+	}
+}
@@ -22,101 +22,114 @@ type ModelRequest struct {
 	Model string `json:"model"`
 }
 
+// Distribute 选择渠道，span 在调用后续处理前结束，只包含渠道选择本身
 func Distribute() func(c *gin.Context) {
 	return func(c *gin.Context) {
-		allowIpsMap := c.GetStringMap("allow_ips")
-		if len(allowIpsMap) != 0 {
-			clientIp := c.ClientIP()
-			if _, ok := allowIpsMap[clientIp]; !ok {
-				abortWithOpenAiMessage(c, http.StatusForbidden, "您的 IP 不在令牌允许访问的列表中")
-				return
-			}
+		_, span := common.StartSpan(c.Request.Context(), "distribute")
+		selectChannel(c)
+		endMiddlewareSpan(c, span)
+		c.Next()
+	}
+}
+
+func selectChannel(c *gin.Context) {
+	allowIpsMap := c.GetStringMap("allow_ips")
+	if len(allowIpsMap) != 0 {
+		clientIp := c.ClientIP()
+		if _, ok := allowIpsMap[clientIp]; !ok {
+			abortWithOpenAiMessage(c, http.StatusForbidden, "您的 IP 不在令牌允许访问的列表中")
+			return
+		}
+	}
+	var channel *model.Channel
+	channelId, ok := c.Get("specific_channel_id")
+	modelRequest, shouldSelectChannel, err := getModelRequest(c)
+	if err != nil {
+		abortWithOpenAiMessage(c, http.StatusBadRequest, "Invalid request, "+err.Error())
+		return
+	}
+	userGroup := c.GetString(constant.ContextKeyUserGroup)
+	tokenGroup := c.GetString("token_group")
+	if tokenGroup != "" {
+		// check common.UserUsableGroups[userGroup]
+		if _, ok := setting.GetUserUsableGroups(userGroup)[tokenGroup]; !ok {
+			abortWithOpenAiMessage(c, http.StatusForbidden, fmt.Sprintf("令牌分组 %s 已被禁用", tokenGroup))
+			return
 		}
-		var channel *model.Channel
-		channelId, ok := c.Get("specific_channel_id")
-		modelRequest, shouldSelectChannel, err := getModelRequest(c)
+		// check group in common.GroupRatio
+		if !setting.ContainsGroupRatio(tokenGroup) {
+			abortWithOpenAiMessage(c, http.StatusForbidden, fmt.Sprintf("分组 %s 已被弃用", tokenGroup))
+			return
+		}
+		userGroup = tokenGroup
+	}
+	c.Set("group", userGroup)
+	if ok {
+		id, err := strconv.Atoi(channelId.(string))
 		if err != nil {
-			abortWithOpenAiMessage(c, http.StatusBadRequest, "Invalid request, "+err.Error())
+			abortWithOpenAiMessage(c, http.StatusBadRequest, "无效的渠道 Id")
 			return
 		}
-		userGroup := c.GetString(constant.ContextKeyUserGroup)
-		tokenGroup := c.GetString("token_group")
-		if tokenGroup != "" {
-			// check common.UserUsableGroups[userGroup]
-			if _, ok := setting.GetUserUsableGroups(userGroup)[tokenGroup]; !ok {
-				abortWithOpenAiMessage(c, http.StatusForbidden, fmt.Sprintf("令牌分组 %s 已被禁用", tokenGroup))
-				return
-			}
-			// check group in common.GroupRatio
-			if !setting.ContainsGroupRatio(tokenGroup) {
-				abortWithOpenAiMessage(c, http.StatusForbidden, fmt.Sprintf("分组 %s 已被弃用", tokenGroup))
-				return
-			}
-			userGroup = tokenGroup
+		channel, err = model.GetChannelById(id, true)
+		if err != nil {
+			abortWithOpenAiMessage(c, http.StatusBadRequest, "无效的渠道 Id")
+			return
 		}
-		c.Set("group", userGroup)
-		if ok {
-			id, err := strconv.Atoi(channelId.(string))
-			if err != nil {
-				abortWithOpenAiMessage(c, http.StatusBadRequest, "无效的渠道 Id")
-				return
-			}
-			channel, err = model.GetChannelById(id, true)
-			if err != nil {
-				abortWithOpenAiMessage(c, http.StatusBadRequest, "无效的渠道 Id")
-				return
-			}
-			if channel.Status != common.ChannelStatusEnabled {
-				abortWithOpenAiMessage(c, http.StatusForbidden, "该渠道已被禁用")
-				return
+		if channel.Status != common.ChannelStatusEnabled {
+			abortWithOpenAiMessage(c, http.StatusForbidden, "该渠道已被禁用")
+			return
+		}
+	} else {
+		// Select a channel for the user
+		// check token model mapping
+		modelLimitEnable := c.GetBool("token_model_limit_enabled")
+		if modelLimitEnable {
+			s, ok := c.Get("token_model_limit")
+			var tokenModelLimit map[string]bool
+			if ok {
+				tokenModelLimit = s.(map[string]bool)
+			} else {
+				tokenModelLimit = map[string]bool{}
 			}
-		} else {
-			// Select a channel for the user
-			// check token model mapping
-			modelLimitEnable := c.GetBool("token_model_limit_enabled")
-			if modelLimitEnable {
-				s, ok := c.Get("token_model_limit")
-				var tokenModelLimit map[string]bool
-				if ok {
-					tokenModelLimit = s.(map[string]bool)
-				} else {
-					tokenModelLimit = map[string]bool{}
-				}
-				if tokenModelLimit != nil {
-					if _, ok := tokenModelLimit[modelRequest.Model]; !ok {
-						abortWithOpenAiMessage(c, http.StatusForbidden, "该令牌无权访问模型 "+modelRequest.Model)
-						return
-					}
-				} else {
-					// token model limit is empty, all models are not allowed
-					abortWithOpenAiMessage(c, http.StatusForbidden, "该令牌无权访问任何模型")
+			if tokenModelLimit != nil {
+				if _, ok := tokenModelLimit[modelRequest.Model]; !ok {
+					abortWithOpenAiMessage(c, http.StatusForbidden, "该令牌无权访问模型 "+modelRequest.Model)
 					return
 				}
+			} else {
+				// token model limit is empty, all models are not allowed
+				abortWithOpenAiMessage(c, http.StatusForbidden, "该令牌无权访问任何模型")
+				return
 			}
+		}
 
-			if shouldSelectChannel {
-				channel, err = model.CacheGetRandomSatisfiedChannel(userGroup, modelRequest.Model, 0)
-				if err != nil {
-					message := fmt.Sprintf("当前分组 %s 下对于模型 %s 无可用渠道", userGroup, modelRequest.Model)
-					// 如果错误，但是渠道不为空，说明是数据库一致性问题
-					if channel != nil {
-						common.SysError(fmt.Sprintf("渠道不存在：%d", channel.Id))
-						message = "数据库一致性已被破坏，请联系管理员"
-					}
-					// 如果错误，而且渠道为空，说明是没有可用渠道
-					abortWithOpenAiMessage(c, http.StatusServiceUnavailable, message)
-					return
-				}
-				if channel == nil {
-					abortWithOpenAiMessage(c, http.StatusServiceUnavailable, fmt.Sprintf("当前分组 %s 下对于模型 %s 无可用渠道（数据库一致性已被破坏）", userGroup, modelRequest.Model))
+		if shouldSelectChannel {
+			channel, err = model.CacheGetRandomSatisfiedChannel(userGroup, modelRequest.Model, 0)
+			if err != nil {
+				message := fmt.Sprintf("当前分组 %s 下对于模型 %s 无可用渠道", userGroup, modelRequest.Model)
+				// 如果错误，但是渠道不为空，说明是数据库一致性问题
+				if channel != nil {
+					common.SysError(fmt.Sprintf("渠道不存在：%d", channel.Id))
+					message = "数据库一致性已被破坏，请联系管理员"
+				} else if supportsModelFallback(c) && len(GetFallbackModels(c, modelRequest.Model)) > 0 {
+					// 没有可用渠道但配置了降级链，交给 relay 降级到其他模型
+					c.Set(constant.ContextKeyNoChannelMessage, message)
+					c.Set(constant.ContextKeyRequestStartTime, time.Now())
+					SetupContextForSelectedChannel(c, nil, modelRequest.Model)
 					return
 				}
+				// 如果错误，而且渠道为空，说明是没有可用渠道
+				abortWithOpenAiMessage(c, http.StatusServiceUnavailable, message)
+				return
+			}
+			if channel == nil {
+				abortWithOpenAiMessage(c, http.StatusServiceUnavailable, fmt.Sprintf("当前分组 %s 下对于模型 %s 无可用渠道（数据库一致性已被破坏）", userGroup, modelRequest.Model))
+				return
 			}
 		}
-		c.Set(constant.ContextKeyRequestStartTime, time.Now())
-		SetupContextForSelectedChannel(c, channel, modelRequest.Model)
-		c.Next()
 	}
+	c.Set(constant.ContextKeyRequestStartTime, time.Now())
+	SetupContextForSelectedChannel(c, channel, modelRequest.Model)
 }
 
 func getModelRequest(c *gin.Context) (*ModelRequest, bool, error) {
@@ -162,6 +175,15 @@ func getModelRequest(c *gin.Context) (*ModelRequest, bool, error) {
 		}
 		c.Set("platform", string(constant.TaskPlatformSuno))
 		c.Set("relay_mode", relayMode)
+	} else if strings.HasPrefix(c.Request.URL.Path, "/v1/video/generations") {
+		// 视频生成的平台由选中渠道的类型决定
+		relayMode := relayconstant.Path2RelayVideo(c.Request.Method, c.Request.URL.Path)
+		if relayMode == relayconstant.RelayModeVideoFetchByID {
+			shouldSelectChannel = false
+		} else {
+			err = common.UnmarshalBodyReusable(c, &modelRequest)
+		}
+		c.Set("relay_mode", relayMode)
 	} else if !strings.HasPrefix(c.Request.URL.Path, "/v1/audio/transcriptions") {
 		err = common.UnmarshalBodyReusable(c, &modelRequest)
 	}
@@ -182,9 +204,17 @@ func getModelRequest(c *gin.Context) (*ModelRequest, bool, error) {
 			modelRequest.Model = c.Param("model")
 		}
 	}
+	if strings.HasPrefix(c.Request.URL.Path, "/v1beta/models/") {
+		// /v1beta/models/{model}:generateContent
+		modelRequest.Model, _, _ = strings.Cut(c.Param("model"), ":")
+	}
 	if strings.HasPrefix(c.Request.URL.Path, "/v1/images/generations") {
 		modelRequest.Model = common.GetStringIfEmpty(modelRequest.Model, "dall-e")
 	}
+	if strings.HasPrefix(c.Request.URL.Path, "/v1/images/edits") || strings.HasPrefix(c.Request.URL.Path, "/v1/images/variations") {
+		modelRequest.Model = common.GetStringIfEmpty(modelRequest.Model, c.PostForm("model"))
+		modelRequest.Model = common.GetStringIfEmpty(modelRequest.Model, "dall-e-2")
+	}
 	if strings.HasPrefix(c.Request.URL.Path, "/v1/audio") {
 		relayMode := relayconstant.RelayModeAudioSpeech
 		if strings.HasPrefix(c.Request.URL.Path, "/v1/audio/speech") {
@@ -219,7 +249,10 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 	c.Set("auto_ban", channel.GetAutoBan())
 	c.Set("model_mapping", channel.GetModelMapping())
 	c.Set("status_code_mapping", channel.GetStatusCodeMapping())
-	c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.Key))
+	key := channel.GetNextKey()
+	c.Set("channel_key", key)
+	c.Set("channel_key_index", channel.GetKeyIndex(key))
+	c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", key))
 	c.Set("base_url", channel.GetBaseURL())
 	// TODO: api_version统一
 	switch channel.Type {
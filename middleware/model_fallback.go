@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"one-api/setting/model_setting"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetFallbackModels 返回原始模型的降级链，令牌配置优先于全局配置，跳过令牌无权访问的模型
+func GetFallbackModels(c *gin.Context, originalModel string) []string {
+	if _, ok := c.Get("specific_channel_id"); ok {
+		return nil
+	}
+	var chain []string
+	if tokenFallbacks, ok := c.Get("token_model_fallbacks"); ok {
+		chain = tokenFallbacks.(map[string][]string)[originalModel]
+	}
+	if len(chain) == 0 {
+		chain = model_setting.GetFallbackSettings().GetChain(originalModel)
+	}
+	var tokenModelLimit map[string]bool
+	if c.GetBool("token_model_limit_enabled") {
+		tokenModelLimit = map[string]bool{}
+		if s, ok := c.Get("token_model_limit"); ok {
+			tokenModelLimit = s.(map[string]bool)
+		}
+	}
+	seen := map[string]bool{originalModel: true}
+	models := make([]string, 0, len(chain))
+	for _, modelName := range chain {
+		if modelName == "" || seen[modelName] {
+			continue
+		}
+		if tokenModelLimit != nil && !tokenModelLimit[modelName] {
+			continue
+		}
+		seen[modelName] = true
+		models = append(models, modelName)
+	}
+	return models
+}
+
+// supportsModelFallback 任务类接口（Midjourney、Suno、视频生成）不支持模型降级
+func supportsModelFallback(c *gin.Context) bool {
+	path := c.Request.URL.Path
+	return !strings.Contains(path, "/mj/") && !strings.Contains(path, "/suno/") &&
+		!strings.HasPrefix(path, "/v1/video/generations")
+}
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"one-api/constant"
+	"one-api/model"
+	"one-api/setting/model_setting"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupFallbackSettings(t *testing.T, chains map[string][]string) {
+	t.Helper()
+	settings := model_setting.GetFallbackSettings()
+	old := *settings
+	*settings = model_setting.FallbackSettings{Enabled: chains != nil, Chains: chains}
+	t.Cleanup(func() { *settings = old })
+}
+
+func TestGetFallbackModels(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	setupFallbackSettings(t, map[string][]string{
+		"gpt-4o":  {"gpt-4o-mini", "gpt-4o", "gpt-4o-mini", "", "claude-3-5-sonnet"},
+		"o1":      {"o1-mini"},
+		"unknown": nil,
+	})
+	tests := []struct {
+		name       string
+		model      string
+		fallbacks  map[string][]string
+		modelLimit map[string]bool
+		specific   bool
+		want       []string
+	}{
+		{"model setting, skip original, duplicates and empty", "gpt-4o", nil, nil, false, []string{"gpt-4o-mini", "claude-3-5-sonnet"}},
+		{"token chain takes precedence", "gpt-4o", map[string][]string{"gpt-4o": {"o1"}}, nil, false, []string{"o1"}},
+		{"token chain for other model keeps model setting", "o1", map[string][]string{"gpt-4o": {"o1"}}, nil, false, []string{"o1-mini"}},
+		{"skip models the token cannot access", "gpt-4o", nil, map[string]bool{"gpt-4o": true, "claude-3-5-sonnet": true}, false, []string{"claude-3-5-sonnet"}},
+		{"specific channel disables fallback", "gpt-4o", nil, nil, true, nil},
+		{"no chain", "unknown", nil, nil, false, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			if tt.fallbacks != nil {
+				c.Set("token_model_fallbacks", tt.fallbacks)
+			}
+			if tt.modelLimit != nil {
+				c.Set("token_model_limit_enabled", true)
+				c.Set("token_model_limit", tt.modelLimit)
+			}
+			if tt.specific {
+				c.Set("specific_channel_id", "1")
+			}
+			if got := GetFallbackModels(c, tt.model); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetFallbackModels() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDistributeNoChannelWithFallback(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	setupTestDB(t, &model.Channel{}, &model.Ability{})
+	setupFallbackSettings(t, map[string][]string{"gpt-4o": {"gpt-4o-mini"}})
+
+	var noChannelMessage string
+	router := gin.New()
+	router.POST("/v1/chat/completions", func(c *gin.Context) {
+		c.Set(constant.ContextKeyUserGroup, "default")
+		c.Next()
+	}, Distribute(), func(c *gin.Context) {
+		noChannelMessage = c.GetString(constant.ContextKeyNoChannelMessage)
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		model  string
+		status int
+	}{
+		// 配置了降级链时交给 relay 降级
+		{"gpt-4o", http.StatusOK},
+		{"o1", http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			noChannelMessage = ""
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"`+tt.model+`"}`))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+			}
+			if tt.status == http.StatusOK && !strings.Contains(noChannelMessage, tt.model) {
+				t.Errorf("no channel message = %q", noChannelMessage)
+			}
+		})
+	}
+}
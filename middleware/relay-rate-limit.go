@@ -0,0 +1,299 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/setting"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	rateLimitWindow = time.Minute
+	// rateLimitConcurrencyTTL 并发计数的过期时间，防止进程异常退出后计数无法释放，请求进行期间会定期续期
+	rateLimitConcurrencyTTL = 10 * time.Minute
+)
+
+// tokenBucketScript 令牌桶扣减脚本，返回是否允许和扣减后的余量
+var tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local n = tonumber(ARGV[4])
+local force = ARGV[5] == "1"
+local data = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(data[1])
+local ts = tonumber(data[2])
+if tokens == nil or ts == nil then
+	tokens = capacity
+	ts = now
+end
+tokens = math.min(capacity, tokens + (now - ts) * capacity / window)
+local allowed = 0
+if force or tokens >= 1 then
+	tokens = math.min(capacity, tokens - n)
+	allowed = 1
+end
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "ts", now)
+redis.call("PEXPIRE", KEYS[1], window * 2)
+return {allowed, tostring(tokens)}
+`)
+
+// rateLimitBucket 一个需要检查的令牌桶
+type rateLimitBucket struct {
+	key      string
+	capacity int64
+	tokens   bool
+}
+
+// rateLimitResult 令牌桶扣减后的状态，用于生成 x-ratelimit-* 响应头
+type rateLimitResult struct {
+	limit     int64
+	remaining float64
+}
+
+func (r rateLimitResult) reset() time.Duration {
+	if r.remaining >= float64(r.limit) {
+		return 0
+	}
+	seconds := (float64(r.limit) - r.remaining) / float64(r.limit) * rateLimitWindow.Seconds()
+	return time.Duration(math.Ceil(seconds)) * time.Second
+}
+
+func takeRateLimitTokens(bucket rateLimitBucket, n int64, force bool) (bool, float64, error) {
+	if !common.RedisEnabled {
+		inMemoryRateLimiter.Init(common.RateLimitKeyExpirationDuration)
+		allowed, remaining := inMemoryRateLimiter.TakeTokens(bucket.key, bucket.capacity, rateLimitWindow, n, force)
+		return allowed, remaining, nil
+	}
+	forceArg := "0"
+	if force {
+		forceArg = "1"
+	}
+	result, err := tokenBucketScript.Run(context.Background(), common.RDB, []string{bucket.key},
+		bucket.capacity, rateLimitWindow.Milliseconds(), time.Now().UnixMilli(), n, forceArg).Slice()
+	if err != nil {
+		return false, 0, err
+	}
+	allowed, _ := result[0].(int64)
+	remaining, _ := strconv.ParseFloat(fmt.Sprint(result[1]), 64)
+	return allowed == 1, remaining, nil
+}
+
+func acquireConcurrency(key string, max int) (bool, error) {
+	if !common.RedisEnabled {
+		inMemoryRateLimiter.Init(common.RateLimitKeyExpirationDuration)
+		return inMemoryRateLimiter.Acquire(key, max), nil
+	}
+	ctx := context.Background()
+	count, err := common.RDB.Incr(ctx, key).Result()
+	if err != nil {
+		return false, err
+	}
+	common.RDB.Expire(ctx, key, rateLimitConcurrencyTTL)
+	if count > int64(max) {
+		releaseConcurrency(key)
+		return false, nil
+	}
+	return true, nil
+}
+
+// releaseConcurrencyScript 释放并发计数，计数过期后再释放时不会减为负数
+var releaseConcurrencyScript = redis.NewScript(`
+local count = redis.call("DECR", KEYS[1])
+if count <= 0 then
+	redis.call("DEL", KEYS[1])
+end
+return count
+`)
+
+func releaseConcurrency(key string) {
+	if !common.RedisEnabled {
+		inMemoryRateLimiter.Release(key)
+		return
+	}
+	if err := releaseConcurrencyScript.Run(context.Background(), common.RDB, []string{key}).Err(); err != nil {
+		common.SysError("failed to release concurrency limit: " + err.Error())
+	}
+}
+
+// keepConcurrencyAlive 请求进行期间定期续期并发计数，避免长时间的请求超过过期时间后计数被提前清除，返回停止续期的函数
+func keepConcurrencyAlive(keys []string) func() {
+	if !common.RedisEnabled || len(keys) == 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(rateLimitConcurrencyTTL / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				for _, key := range keys {
+					common.RDB.Expire(context.Background(), key, rateLimitConcurrencyTTL)
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// estimateRequestTokens 按请求体大小粗略估算 token 数，请求结束后再按实际用量校正
+func estimateRequestTokens(c *gin.Context) int64 {
+	if !strings.Contains(c.Request.Header.Get("Content-Type"), "application/json") {
+		return 0
+	}
+	body, err := common.GetRequestBody(c)
+	if err != nil {
+		return 0
+	}
+	return int64(len(body) / 4)
+}
+
+func setRateLimitHeaders(c *gin.Context, kind string, result *rateLimitResult) {
+	if result == nil {
+		return
+	}
+	c.Header("x-ratelimit-limit-"+kind, strconv.FormatInt(result.limit, 10))
+	c.Header("x-ratelimit-remaining-"+kind, strconv.FormatInt(int64(math.Max(0, math.Floor(result.remaining))), 10))
+	c.Header("x-ratelimit-reset-"+kind, result.reset().String())
+}
+
+// RelayRateLimit 按令牌、用户、分组和模型进行令牌桶限流，需要在 Distribute 之后使用以获取模型
+func RelayRateLimit() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		rateLimitSetting := setting.GetRateLimitSetting()
+		if !rateLimitSetting.Enabled {
+			c.Next()
+			return
+		}
+		// 批处理请求由执行器控制并发，不参与并发和请求数限制，但仍计入 token 数，且不会因 token 数不足被拒绝
+		_, isBatch := c.Request.Context().Value(constant.ContextKeyBatchId).(string)
+
+		userId := c.GetInt("id")
+		group := c.GetString("group")
+		modelName := c.GetString("original_model")
+		scopes := map[string]setting.RateLimit{
+			fmt.Sprintf("token:%d", c.GetInt("token_id")): rateLimitSetting.Token,
+			fmt.Sprintf("user:%d", userId):                rateLimitSetting.User,
+		}
+		if limit, ok := rateLimitSetting.Groups[group]; ok {
+			scopes[fmt.Sprintf("group:%s:%d", group, userId)] = limit
+		}
+		if limit, ok := rateLimitSetting.Models[modelName]; ok && modelName != "" {
+			scopes[fmt.Sprintf("model:%s:%d", modelName, userId)] = limit
+		}
+
+		// 1. 并发限制
+		acquired := make([]string, 0, len(scopes))
+		defer func() {
+			for _, key := range acquired {
+				releaseConcurrency(key)
+			}
+		}()
+		for scope, limit := range scopes {
+			if limit.Concurrency <= 0 || isBatch {
+				continue
+			}
+			key := "rateLimit:concurrency:" + scope
+			allowed, err := acquireConcurrency(key, limit.Concurrency)
+			if err != nil {
+				common.SysError("failed to check concurrency limit: " + err.Error())
+				abortWithOpenAiMessage(c, http.StatusInternalServerError, "rate_limit_check_failed")
+				return
+			}
+			if !allowed {
+				abortWithOpenAiMessage(c, http.StatusTooManyRequests, fmt.Sprintf("已达到并发请求数限制：最多同时进行 %d 个请求", limit.Concurrency))
+				return
+			}
+			acquired = append(acquired, key)
+		}
+		stopKeepAlive := keepConcurrencyAlive(acquired)
+		defer stopKeepAlive()
+
+		// 2. 请求数和 token 数限制，任一令牌桶不足时返还已扣除的令牌
+		estimatedTokens := estimateRequestTokens(c)
+		var requestsResult, tokensResult *rateLimitResult
+		type takenBucket struct {
+			bucket rateLimitBucket
+			n      int64
+		}
+		taken := make([]takenBucket, 0, len(scopes)*2)
+		refund := func() {
+			for _, t := range taken {
+				_, _, _ = takeRateLimitTokens(t.bucket, -t.n, true)
+			}
+		}
+		for scope, limit := range scopes {
+			buckets := make([]rateLimitBucket, 0, 2)
+			if limit.RPM > 0 && !isBatch {
+				buckets = append(buckets, rateLimitBucket{key: "rateLimit:rpm:" + scope, capacity: int64(limit.RPM)})
+			}
+			if limit.TPM > 0 {
+				buckets = append(buckets, rateLimitBucket{key: "rateLimit:tpm:" + scope, capacity: int64(limit.TPM), tokens: true})
+			}
+			for _, bucket := range buckets {
+				n := int64(1)
+				if bucket.tokens {
+					n = min(estimatedTokens, bucket.capacity)
+				}
+				allowed, remaining, err := takeRateLimitTokens(bucket, n, isBatch)
+				if err != nil {
+					refund()
+					common.SysError("failed to check rate limit: " + err.Error())
+					abortWithOpenAiMessage(c, http.StatusInternalServerError, "rate_limit_check_failed")
+					return
+				}
+				result := &rateLimitResult{limit: bucket.capacity, remaining: remaining}
+				if !allowed {
+					refund()
+					if bucket.tokens {
+						setRateLimitHeaders(c, "tokens", result)
+						c.Header("Retry-After", strconv.Itoa(int(math.Ceil(result.reset().Seconds()))))
+						abortWithOpenAiMessage(c, http.StatusTooManyRequests, fmt.Sprintf("已达到 token 数限制：每分钟最多 %d tokens", bucket.capacity))
+					} else {
+						setRateLimitHeaders(c, "requests", result)
+						c.Header("Retry-After", strconv.Itoa(int(math.Ceil(result.reset().Seconds()))))
+						abortWithOpenAiMessage(c, http.StatusTooManyRequests, fmt.Sprintf("已达到请求数限制：每分钟最多请求 %d 次", bucket.capacity))
+					}
+					return
+				}
+				taken = append(taken, takenBucket{bucket: bucket, n: n})
+				// 响应头返回余量最少的维度
+				if bucket.tokens {
+					if tokensResult == nil || result.remaining < tokensResult.remaining {
+						tokensResult = result
+					}
+				} else if requestsResult == nil || result.remaining < requestsResult.remaining {
+					requestsResult = result
+				}
+			}
+		}
+		setRateLimitHeaders(c, "requests", requestsResult)
+		setRateLimitHeaders(c, "tokens", tokensResult)
+
+		c.Next()
+
+		// 3. 按实际用量校正 token 数
+		consumedTokens := int64(c.GetInt(constant.ContextKeyConsumedTokens))
+		for _, t := range taken {
+			if !t.bucket.tokens || consumedTokens == t.n {
+				continue
+			}
+			_, _, err := takeRateLimitTokens(t.bucket, consumedTokens-t.n, true)
+			if err != nil {
+				common.SysError("failed to reconcile token rate limit: " + err.Error())
+			}
+		}
+	}
+}
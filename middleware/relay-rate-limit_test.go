@@ -0,0 +1,190 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/setting"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupRelayRateLimitTest(t *testing.T, rateLimitSetting setting.RateLimitSetting) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	current := setting.GetRateLimitSetting()
+	old, oldRedis := *current, common.RedisEnabled
+	*current = rateLimitSetting
+	common.RedisEnabled = false
+	t.Cleanup(func() {
+		*current = old
+		common.RedisEnabled = oldRedis
+	})
+}
+
+// newRateLimitRouter tokenId 用于区分各个测试的令牌桶，handler 中设置实际消耗的 token 数
+func newRateLimitRouter(tokenId int, consumed int, block chan struct{}) *gin.Engine {
+	router := gin.New()
+	router.POST("/v1/chat/completions", func(c *gin.Context) {
+		c.Set("id", 1)
+		c.Set("token_id", tokenId)
+		c.Set("group", "default")
+		c.Set("original_model", "gpt-4o")
+		c.Next()
+	}, RelayRateLimit(), func(c *gin.Context) {
+		if block != nil {
+			<-block
+		}
+		c.Set(constant.ContextKeyConsumedTokens, consumed)
+		c.Status(http.StatusOK)
+	})
+	return router
+}
+
+func doRateLimitRequest(router *gin.Engine, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRelayRateLimitRPM(t *testing.T) {
+	setupRelayRateLimitTest(t, setting.RateLimitSetting{
+		Enabled: true,
+		Token:   setting.RateLimit{RPM: 2},
+	})
+	router := newRateLimitRouter(7001, 0, nil)
+	tests := []struct {
+		status    int
+		remaining string
+	}{
+		{http.StatusOK, "1"},
+		{http.StatusOK, "0"},
+		{http.StatusTooManyRequests, "0"},
+	}
+	for i, tt := range tests {
+		w := doRateLimitRequest(router, `{}`)
+		if w.Code != tt.status {
+			t.Fatalf("request %d status = %d", i, w.Code)
+		}
+		if got := w.Header().Get("x-ratelimit-remaining-requests"); got != tt.remaining {
+			t.Errorf("request %d remaining = %q, want %q", i, got, tt.remaining)
+		}
+		if w.Header().Get("x-ratelimit-limit-requests") != "2" {
+			t.Errorf("request %d limit header = %q", i, w.Header().Get("x-ratelimit-limit-requests"))
+		}
+	}
+	if w := doRateLimitRequest(router, `{}`); w.Header().Get("Retry-After") == "" {
+		t.Error("Retry-After missing on limited request")
+	}
+}
+
+func TestRelayRateLimitRefundsOtherScopes(t *testing.T) {
+	setupRelayRateLimitTest(t, setting.RateLimitSetting{
+		Enabled: true,
+		Token:   setting.RateLimit{RPM: 10},
+		Models:  map[string]setting.RateLimit{"gpt-4o": {RPM: 1}},
+	})
+	router := newRateLimitRouter(7002, 0, nil)
+	doRateLimitRequest(router, `{}`)
+	for i := 0; i < 5; i++ {
+		if w := doRateLimitRequest(router, `{}`); w.Code != http.StatusTooManyRequests {
+			t.Fatalf("request %d status = %d", i, w.Code)
+		}
+	}
+	// 被模型限流拒绝的请求不占用令牌的请求数
+	_, remaining := inMemoryRateLimiter.TakeTokens("rateLimit:rpm:token:7002", 10, rateLimitWindow, 0, true)
+	if remaining < 8.9 || remaining > 9.1 {
+		t.Errorf("token bucket remaining = %.2f, want 9", remaining)
+	}
+}
+
+func TestRelayRateLimitTPMReconcile(t *testing.T) {
+	setupRelayRateLimitTest(t, setting.RateLimitSetting{
+		Enabled: true,
+		Token:   setting.RateLimit{TPM: 1000},
+	})
+	body := `{"messages":"` + strings.Repeat("a", 385) + `"}` // 400 字节，估算为 100 tokens
+	router := newRateLimitRouter(7003, 600, nil)
+	w := doRateLimitRequest(router, body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	if got := w.Header().Get("x-ratelimit-remaining-tokens"); got != "900" {
+		t.Errorf("remaining before reconcile = %q", got)
+	}
+	_, remaining := inMemoryRateLimiter.TakeTokens("rateLimit:tpm:token:7003", 1000, rateLimitWindow, 0, true)
+	if remaining < 399 || remaining > 401 {
+		t.Errorf("remaining after reconcile = %.2f, want 400", remaining)
+	}
+}
+
+func TestRelayRateLimitConcurrency(t *testing.T) {
+	setupRelayRateLimitTest(t, setting.RateLimitSetting{
+		Enabled: true,
+		Groups:  map[string]setting.RateLimit{"default": {Concurrency: 1}},
+	})
+	block := make(chan struct{})
+	router := newRateLimitRouter(7004, 0, block)
+	done := make(chan int)
+	go func() { done <- doRateLimitRequest(router, `{}`).Code }()
+	// 等待第一个请求占用并发名额
+	for inMemoryRateLimiter.Acquire("rateLimit:concurrency:group:default:1", 1) {
+		inMemoryRateLimiter.Release("rateLimit:concurrency:group:default:1")
+		time.Sleep(time.Millisecond)
+	}
+	if w := doRateLimitRequest(router, `{}`); w.Code != http.StatusTooManyRequests {
+		t.Errorf("concurrent request status = %d", w.Code)
+	}
+	close(block)
+	if code := <-done; code != http.StatusOK {
+		t.Errorf("first request status = %d", code)
+	}
+	if w := doRateLimitRequest(router, `{}`); w.Code != http.StatusOK {
+		t.Errorf("request after release status = %d", w.Code)
+	}
+}
+
+func TestRelayRateLimitBatchChargesTPM(t *testing.T) {
+	setupRelayRateLimitTest(t, setting.RateLimitSetting{
+		Enabled: true,
+		Token:   setting.RateLimit{RPM: 1, TPM: 1000, Concurrency: 1},
+	})
+	router := newRateLimitRouter(7005, 600, nil)
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{}`))
+		req = req.WithContext(context.WithValue(req.Context(), constant.ContextKeyBatchId, "batch_1"))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		// 批处理请求不受请求数限制，token 数不足时也不拒绝
+		if w.Code != http.StatusOK {
+			t.Fatalf("batch request %d status = %d", i, w.Code)
+		}
+	}
+	// 批处理消耗的 token 数计入令牌的 TPM，普通请求因此被限流
+	if w := doRateLimitRequest(router, `{}`); w.Code != http.StatusTooManyRequests {
+		t.Errorf("request after batch status = %d", w.Code)
+	}
+}
+
+func TestRelayRateLimitUserSharedAcrossTokens(t *testing.T) {
+	setupRelayRateLimitTest(t, setting.RateLimitSetting{
+		Enabled: true,
+		Token:   setting.RateLimit{RPM: 10},
+		User:    setting.RateLimit{RPM: 1},
+	})
+	if w := doRateLimitRequest(newRateLimitRouter(7006, 0, nil), `{}`); w.Code != http.StatusOK {
+		t.Fatalf("first token status = %d", w.Code)
+	}
+	// 同一用户的其他令牌共享用户的请求数限制
+	if w := doRateLimitRequest(newRateLimitRouter(7007, 0, nil), `{}`); w.Code != http.StatusTooManyRequests {
+		t.Errorf("second token status = %d", w.Code)
+	}
+}
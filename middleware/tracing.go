@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"fmt"
+	"one-api/common"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing 为每个请求创建服务端 span，请求头中的 traceparent 作为父 span
+func Tracing() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		route := c.FullPath()
+		if route == "" {
+			route = c.Request.URL.Path
+		}
+		ctx, span := otel.Tracer(common.TracerName).Start(ctx, c.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", c.Request.Method),
+				attribute.String("http.route", route),
+				attribute.String("request_id", c.GetString(common.RequestIdKey)),
+			))
+		defer span.End()
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if userId := c.GetInt("id"); userId != 0 {
+			span.SetAttributes(attribute.Int("user_id", userId))
+		}
+		if status >= 500 {
+			span.SetStatus(codes.Error, fmt.Sprintf("status code %d", status))
+		}
+	}
+}
+
+// endMiddlewareSpan 结束中间件的 span，中间件中断请求时标记为错误
+func endMiddlewareSpan(c *gin.Context, span trace.Span) {
+	if c.IsAborted() {
+		span.SetStatus(codes.Error, fmt.Sprintf("aborted with status code %d", c.Writer.Status()))
+	}
+	span.End()
+}
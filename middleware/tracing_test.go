@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"one-api/common"
+	"one-api/model"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// setupTestTracer 使用内存记录器替换全局 TracerProvider，结束后恢复
+func setupTestTracer(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	oldProvider := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(oldProvider) })
+	return recorder
+}
+
+func endedSpan(recorder *tracetest.SpanRecorder, name string) sdktrace.ReadOnlySpan {
+	for _, span := range recorder.Ended() {
+		if span.Name() == name {
+			return span
+		}
+	}
+	return nil
+}
+
+func TestTokenAuthEndsSpanBeforeNext(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB(t, &model.User{}, &model.Token{}, &model.CreditAccount{})
+	var recorder *tracetest.SpanRecorder
+	db.Create(&model.User{Id: 1, Username: "user", Status: common.UserStatusEnabled, AffCode: "a1"})
+	db.Create(&model.Token{Id: 1, UserId: 1, Key: "tracingtokenkey", Status: common.TokenStatusEnabled, ExpiredTime: -1, UnlimitedQuota: true})
+
+	router := gin.New()
+	var spanEndedBeforeNext bool
+	var nextCalls int
+	router.GET("/v1/models", TokenAuth(), func(c *gin.Context) {
+		nextCalls++
+		spanEndedBeforeNext = endedSpan(recorder, "auth") != nil
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name   string
+		key    string
+		status int
+	}{
+		{"valid token", "sk-tracingtokenkey", http.StatusOK},
+		{"invalid token", "sk-invalid", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder = setupTestTracer(t)
+			nextCalls, spanEndedBeforeNext = 0, false
+			req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.key)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+			}
+			span := endedSpan(recorder, "auth")
+			if span == nil {
+				t.Fatal("auth span not ended")
+			}
+			if tt.status == http.StatusOK {
+				// 后续处理只执行一次，且执行时 auth span 已经结束
+				if nextCalls != 1 || !spanEndedBeforeNext {
+					t.Errorf("nextCalls = %d, spanEndedBeforeNext = %v", nextCalls, spanEndedBeforeNext)
+				}
+				if span.Status().Code == codes.Error {
+					t.Errorf("auth span status = %v", span.Status())
+				}
+			} else {
+				if nextCalls != 0 {
+					t.Error("next handler called after abort")
+				}
+				if span.Status().Code != codes.Error {
+					t.Errorf("auth span status = %v, want error", span.Status())
+				}
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package model
 import (
 	"errors"
 	"fmt"
+	"math/rand"
 	"one-api/common"
 	"strings"
 
@@ -108,21 +109,35 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 	}
 	channel := Channel{}
 	if len(abilities) > 0 {
-		// Randomly choose one
-		weightSum := uint(0)
+		// 排除熔断中的渠道，全部熔断时仍在所有渠道中选择
+		allowedAbilities := make([]Ability, 0, len(abilities))
 		for _, ability_ := range abilities {
-			weightSum += ability_.Weight + 10
+			if channelAllowed(ability_.ChannelId) {
+				allowedAbilities = append(allowedAbilities, ability_)
+			}
+		}
+		if len(allowedAbilities) > 0 {
+			abilities = allowedAbilities
 		}
 		// Randomly choose one
-		weight := common.GetRandomInt(int(weightSum))
-		for _, ability_ := range abilities {
-			weight -= int(ability_.Weight) + 10
+		weights := make([]float64, len(abilities))
+		weightSum := 0.0
+		for i, ability_ := range abilities {
+			weights[i] = float64(ability_.Weight+10) * channelLatencyFactor(ability_.ChannelId)
+			weightSum += weights[i]
+		}
+		// Randomly choose one
+		weight := rand.Float64() * weightSum
+		channel.Id = abilities[len(abilities)-1].ChannelId
+		for i, ability_ := range abilities {
+			weight -= weights[i]
 			//log.Printf("weight: %d, ability weight: %d", weight, *ability_.Weight)
 			if weight <= 0 {
 				channel.Id = ability_.ChannelId
 				break
 			}
 		}
+		channelSelected(channel.Id)
 	} else {
 		return nil, errors.New("channel not found")
 	}
@@ -0,0 +1,263 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"one-api/common"
+	"strings"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"gorm.io/gorm"
+)
+
+// AdminApiKeyPrefix 管理 API 密钥前缀，用于和用户访问令牌区分
+const AdminApiKeyPrefix = "ak-"
+
+// 管理 API 密钥权限范围，resource:write 同时包含同一资源的 read 和 create 权限
+const (
+	AdminScopeChannelRead      = "channel:read"
+	AdminScopeChannelWrite     = "channel:write"
+	AdminScopeRedemptionRead   = "redemption:read"
+	AdminScopeRedemptionCreate = "redemption:create"
+	AdminScopeRedemptionWrite  = "redemption:write"
+	AdminScopeLogRead          = "log:read"
+	AdminScopeLogWrite         = "log:write"
+	AdminScopeUserRead         = "user:read"
+	AdminScopeUserWrite        = "user:write"
+	AdminScopeOptionRead       = "option:read"
+	AdminScopeOptionWrite      = "option:write"
+	AdminScopeAuditRead        = "audit:read"
+)
+
+var AdminApiKeyScopes = []string{
+	AdminScopeChannelRead,
+	AdminScopeChannelWrite,
+	AdminScopeRedemptionRead,
+	AdminScopeRedemptionCreate,
+	AdminScopeRedemptionWrite,
+	AdminScopeLogRead,
+	AdminScopeLogWrite,
+	AdminScopeUserRead,
+	AdminScopeUserWrite,
+	AdminScopeOptionRead,
+	AdminScopeOptionWrite,
+	AdminScopeAuditRead,
+}
+
+// AdminApiKey 管理员创建的带权限范围的管理 API 密钥，以创建者的身份访问 /api 下允许的接口。
+// 数据库只保存密钥的 SHA-256 摘要和脱敏后的密钥，完整密钥只在创建时返回一次
+type AdminApiKey struct {
+	Id           int            `json:"id"`
+	UserId       int            `json:"user_id" gorm:"index"`
+	Name         string         `json:"name" gorm:"type:varchar(64)"`
+	Key          string         `json:"-" gorm:"type:varchar(64);uniqueIndex"`
+	MaskedKey    string         `json:"key" gorm:"type:varchar(32)"`
+	Scopes       string         `json:"scopes" gorm:"type:text"` // 逗号分隔
+	Status       int            `json:"status" gorm:"default:1"`
+	ExpiredTime  int64          `json:"expired_time" gorm:"bigint;default:-1"` // -1 表示永不过期
+	AllowIps     string         `json:"allow_ips" gorm:"type:text"`            // 换行分隔，为空表示不限制
+	CreatedTime  int64          `json:"created_time" gorm:"bigint"`
+	AccessedTime int64          `json:"accessed_time" gorm:"bigint"`
+	DeletedAt    gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// AdminApiKeyLog 管理 API 密钥的调用记录
+type AdminApiKeyLog struct {
+	Id         int    `json:"id"`
+	KeyId      int    `json:"key_id" gorm:"index"`
+	UserId     int    `json:"user_id" gorm:"index"`
+	Method     string `json:"method" gorm:"type:varchar(16)"`
+	Path       string `json:"path" gorm:"type:varchar(255)"`
+	Ip         string `json:"ip" gorm:"type:varchar(64)"`
+	StatusCode int    `json:"status_code"`
+	CreatedAt  int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+func (key *AdminApiKey) GetScopes() []string {
+	scopes := make([]string, 0)
+	for _, scope := range strings.Split(key.Scopes, ",") {
+		scope = strings.TrimSpace(scope)
+		if scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+func (key *AdminApiKey) HasScope(required string) bool {
+	resource, _, _ := strings.Cut(required, ":")
+	for _, scope := range key.GetScopes() {
+		if scope == required || scope == resource+":write" {
+			return true
+		}
+	}
+	return false
+}
+
+// HashAdminApiKey 返回管理 API 密钥的摘要，密钥本身为高熵随机串，无需加盐
+func HashAdminApiKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func MaskAdminApiKey(key string) string {
+	if len(key) <= 11 {
+		return "****"
+	}
+	return key[:7] + "****" + key[len(key)-4:]
+}
+
+func getAdminApiKeyAllowIps(allowIps string) []string {
+	result := make([]string, 0)
+	for _, allowIp := range strings.Split(allowIps, "\n") {
+		allowIp = strings.TrimSpace(allowIp)
+		if allowIp != "" {
+			result = append(result, allowIp)
+		}
+	}
+	return result
+}
+
+// IsIpAllowed 允许列表的每一行为单个 IP 或 CIDR 网段
+func (key *AdminApiKey) IsIpAllowed(ip string) bool {
+	allowIps := getAdminApiKeyAllowIps(key.AllowIps)
+	if len(allowIps) == 0 {
+		return true
+	}
+	clientIp := net.ParseIP(ip)
+	if clientIp == nil {
+		return false
+	}
+	for _, allowIp := range allowIps {
+		if strings.Contains(allowIp, "/") {
+			_, ipNet, err := net.ParseCIDR(allowIp)
+			if err == nil && ipNet.Contains(clientIp) {
+				return true
+			}
+		} else if clientIp.Equal(net.ParseIP(allowIp)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateAdminApiKeyAllowIps 校验并规范化换行分隔的 IP 允许列表
+func ValidateAdminApiKeyAllowIps(allowIps string) (string, error) {
+	result := getAdminApiKeyAllowIps(allowIps)
+	for _, allowIp := range result {
+		if strings.Contains(allowIp, "/") {
+			if _, _, err := net.ParseCIDR(allowIp); err != nil {
+				return "", errors.New("无效的 CIDR：" + allowIp)
+			}
+		} else if net.ParseIP(allowIp) == nil {
+			return "", errors.New("无效的 IP：" + allowIp)
+		}
+	}
+	return strings.Join(result, "\n"), nil
+}
+
+// ValidateAdminApiKeyScopes 校验并规范化逗号分隔的权限范围
+func ValidateAdminApiKeyScopes(scopes string) (string, error) {
+	key := AdminApiKey{Scopes: scopes}
+	result := key.GetScopes()
+	if len(result) == 0 {
+		return "", errors.New("至少需要一个权限范围")
+	}
+	for _, scope := range result {
+		if !common.StringsContains(AdminApiKeyScopes, scope) {
+			return "", errors.New("无效的权限范围：" + scope)
+		}
+	}
+	return strings.Join(result, ","), nil
+}
+
+func GetUserAdminApiKeys(userId int) (keys []*AdminApiKey, err error) {
+	err = DB.Where("user_id = ?", userId).Order("id desc").Find(&keys).Error
+	return keys, err
+}
+
+func GetAdminApiKeyByIds(id int, userId int) (*AdminApiKey, error) {
+	if id == 0 || userId == 0 {
+		return nil, errors.New("id 或 userId 为空！")
+	}
+	key := AdminApiKey{}
+	err := DB.First(&key, "id = ? and user_id = ?", id, userId).Error
+	return &key, err
+}
+
+// ValidateAdminApiKey 校验管理 API 密钥的状态和有效期
+func ValidateAdminApiKey(key string) (*AdminApiKey, error) {
+	apiKey := AdminApiKey{}
+	err := DB.Where(keyCol+" = ?", HashAdminApiKey(key)).First(&apiKey).Error
+	if err != nil {
+		return nil, errors.New("无效的管理 API 密钥")
+	}
+	if apiKey.Status != common.TokenStatusEnabled {
+		return nil, errors.New("该管理 API 密钥已被禁用")
+	}
+	if apiKey.ExpiredTime != -1 && apiKey.ExpiredTime < common.GetTimestamp() {
+		return nil, errors.New("该管理 API 密钥已过期")
+	}
+	return &apiKey, nil
+}
+
+// hashAdminApiKeys 将旧版本明文保存的密钥替换为摘要，明文密钥以前缀 ak- 开头，摘要不会以此开头
+func hashAdminApiKeys() error {
+	var keys []*AdminApiKey
+	err := DB.Unscoped().Where(keyCol+" like ?", AdminApiKeyPrefix+"%").Find(&keys).Error
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		err = DB.Unscoped().Model(key).Updates(map[string]interface{}{
+			"key":        HashAdminApiKey(key.Key),
+			"masked_key": MaskAdminApiKey(key.Key),
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (key *AdminApiKey) Insert() error {
+	return DB.Create(key).Error
+}
+
+func (key *AdminApiKey) Update() error {
+	return DB.Model(key).Select("name", "scopes", "status", "expired_time", "allow_ips").Updates(key).Error
+}
+
+func DeleteAdminApiKeyById(id int, userId int) error {
+	key, err := GetAdminApiKeyByIds(id, userId)
+	if err != nil {
+		return err
+	}
+	return DB.Delete(key).Error
+}
+
+// RecordAdminApiKeyUse 记录一次管理 API 密钥调用并更新最后访问时间
+func RecordAdminApiKeyUse(log *AdminApiKeyLog) {
+	gopool.Go(func() {
+		log.CreatedAt = common.GetTimestamp()
+		err := DB.Create(log).Error
+		if err == nil {
+			err = DB.Model(&AdminApiKey{}).Where("id = ?", log.KeyId).Update("accessed_time", log.CreatedAt).Error
+		}
+		if err != nil {
+			common.SysError("failed to record admin api key use: " + err.Error())
+		}
+	})
+}
+
+func GetAdminApiKeyLogs(keyId int, startIdx int, num int) (logs []*AdminApiKeyLog, total int64, err error) {
+	tx := DB.Model(&AdminApiKeyLog{}).Where("key_id = ?", keyId)
+	err = tx.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&logs).Error
+	return logs, total, err
+}
@@ -0,0 +1,101 @@
+package model
+
+import (
+	"one-api/common"
+	"testing"
+)
+
+func TestAdminApiKeyIsIpAllowed(t *testing.T) {
+	tests := []struct {
+		name     string
+		allowIps string
+		ip       string
+		want     bool
+	}{
+		{"no limit", "", "1.2.3.4", true},
+		{"exact ip", "1.2.3.4\n5.6.7.8", "5.6.7.8", true},
+		{"ip not listed", "1.2.3.4", "1.2.3.5", false},
+		{"ipv4 cidr", "10.0.0.0/8", "10.20.30.40", true},
+		{"outside cidr", "10.0.0.0/8", "11.0.0.1", false},
+		{"ipv6 cidr", "2001:db8::/32", "2001:db8::1", true},
+		{"ipv6 exact with different notation", "2001:db8:0:0::1", "2001:db8::1", true},
+		{"invalid client ip", "10.0.0.0/8", "unknown", false},
+		{"blank lines ignored", "\n 192.168.1.0/24 \n", "192.168.1.9", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := &AdminApiKey{AllowIps: tt.allowIps}
+			if got := key.IsIpAllowed(tt.ip); got != tt.want {
+				t.Errorf("IsIpAllowed(%q) = %v, want %v", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateAdminApiKeyAllowIps(t *testing.T) {
+	tests := []struct {
+		allowIps string
+		want     string
+		wantErr  bool
+	}{
+		{"", "", false},
+		{" 1.2.3.4 \n\n10.0.0.0/8", "1.2.3.4\n10.0.0.0/8", false},
+		{"1.2.3", "", true},
+		{"10.0.0.0/33", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.allowIps, func(t *testing.T) {
+			got, err := ValidateAdminApiKeyAllowIps(tt.allowIps)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ValidateAdminApiKeyAllowIps() = %q, %v, want %q, error %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAdminApiKeyHasScope(t *testing.T) {
+	key := &AdminApiKey{Scopes: "channel:read,redemption:write"}
+	tests := []struct {
+		scope string
+		want  bool
+	}{
+		{AdminScopeChannelRead, true},
+		{AdminScopeChannelWrite, false},
+		{AdminScopeRedemptionCreate, true},
+		{AdminScopeRedemptionRead, true},
+		{AdminScopeLogRead, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.scope, func(t *testing.T) {
+			if got := key.HasScope(tt.scope); got != tt.want {
+				t.Errorf("HasScope(%s) = %v, want %v", tt.scope, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdminApiKeyStoredAsHash(t *testing.T) {
+	db := setupTestDB(t, &AdminApiKey{})
+
+	plainKey := AdminApiKeyPrefix + "legacyplaintextkey0123456789"
+	legacy := &AdminApiKey{Name: "legacy", Key: plainKey, Status: common.TokenStatusEnabled, ExpiredTime: -1}
+	if err := db.Create(legacy).Error; err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := hashAdminApiKeys(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var stored AdminApiKey
+	db.First(&stored, legacy.Id)
+	if stored.Key != HashAdminApiKey(plainKey) || stored.MaskedKey != MaskAdminApiKey(plainKey) {
+		t.Fatalf("stored key = %q masked %q", stored.Key, stored.MaskedKey)
+	}
+	if _, err := ValidateAdminApiKey(plainKey); err != nil {
+		t.Errorf("plaintext key rejected after migration: %v", err)
+	}
+	if _, err := ValidateAdminApiKey(stored.Key); err == nil {
+		t.Error("stored hash accepted as a key")
+	}
+}
@@ -0,0 +1,253 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"one-api/common"
+	"one-api/setting/operation_setting"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuditLog 管理操作审计记录，记录操作人、来源 IP、操作对象以及变更前后的字段差异
+type AuditLog struct {
+	Id            int    `json:"id"`
+	CreatedAt     int64  `json:"created_at" gorm:"bigint;index"`
+	UserId        int    `json:"user_id" gorm:"index"`
+	Username      string `json:"username" gorm:"index;default:''"`
+	AdminApiKeyId int    `json:"admin_api_key_id" gorm:"default:0"`
+	Ip            string `json:"ip" gorm:"type:varchar(64);default:''"`
+	Method        string `json:"method" gorm:"type:varchar(16)"`
+	Path          string `json:"path" gorm:"type:varchar(255)"`
+	TargetType    string `json:"target_type" gorm:"type:varchar(32);index"`
+	TargetId      string `json:"target_id" gorm:"type:varchar(128);index"`
+	Action        string `json:"action" gorm:"type:varchar(16);index"`
+	// Diff 变更字段，格式为 {"field": {"before": ..., "after": ...}}，嵌套对象字段和数组下标以 . 连接
+	Diff    string `json:"diff" gorm:"type:text"`
+	Success bool   `json:"success"`
+}
+
+const (
+	AuditActionCreate = "create"
+	AuditActionUpdate = "update"
+	AuditActionDelete = "delete"
+)
+
+const (
+	auditContextKeyTargetId = "audit_target_id"
+	auditContextKeyAction   = "audit_action"
+	auditContextKeyDiff     = "audit_diff"
+)
+
+// AuditFieldChange 单个字段的变更
+type AuditFieldChange struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+const auditRedactedValue = "***"
+
+// IsSensitiveField 判断字段或配置项是否为密钥、密码等敏感信息，审计时只记录是否变更，读取设置时不返回
+func IsSensitiveField(field string) bool {
+	if idx := strings.LastIndex(field, "."); idx >= 0 {
+		field = field[idx+1:]
+	}
+	name := strings.ToLower(field)
+	for _, suffix := range []string{"password", "secret", "key", "token"} {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func flattenAuditValue(prefix string, value any, result map[string]any) {
+	if m, ok := value.(map[string]any); ok && len(m) > 0 {
+		for k, v := range m {
+			key := k
+			if prefix != "" {
+				key = prefix + "." + k
+			}
+			flattenAuditValue(key, v, result)
+		}
+		return
+	}
+	// 数组按下标展开，保证数组元素中的敏感字段同样会被脱敏
+	if list, ok := value.([]any); ok && len(list) > 0 {
+		for i, v := range list {
+			key := strconv.Itoa(i)
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			flattenAuditValue(key, v, result)
+		}
+		return
+	}
+	if prefix != "" {
+		result[prefix] = value
+	}
+}
+
+func toAuditMap(v any) map[string]any {
+	result := make(map[string]any)
+	if v == nil {
+		return result
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return result
+	}
+	var value any
+	if err = json.Unmarshal(data, &value); err != nil {
+		return result
+	}
+	flattenAuditValue("", value, result)
+	return result
+}
+
+// ComputeAuditDiff 对比变更前后的对象，返回发生变化的字段
+func ComputeAuditDiff(before any, after any) map[string]AuditFieldChange {
+	beforeMap := toAuditMap(before)
+	afterMap := toAuditMap(after)
+	diff := make(map[string]AuditFieldChange)
+	for key, beforeValue := range beforeMap {
+		afterValue, ok := afterMap[key]
+		if !ok || !reflect.DeepEqual(beforeValue, afterValue) {
+			diff[key] = AuditFieldChange{Before: beforeValue, After: afterValue}
+		}
+	}
+	for key, afterValue := range afterMap {
+		if _, ok := beforeMap[key]; !ok {
+			diff[key] = AuditFieldChange{Before: nil, After: afterValue}
+		}
+	}
+	for key, change := range diff {
+		if IsSensitiveField(key) {
+			if change.Before != nil {
+				change.Before = auditRedactedValue
+			}
+			if change.After != nil {
+				change.After = auditRedactedValue
+			}
+			diff[key] = change
+		}
+	}
+	return diff
+}
+
+// SetAuditDiff 由管理接口在变更完成后调用，记录操作对象和变更前后的状态，
+// 未调用时审计中间件使用请求参数作为变更内容
+func SetAuditDiff(c *gin.Context, targetId any, before any, after any) {
+	c.Set(auditContextKeyTargetId, fmt.Sprintf("%v", targetId))
+	c.Set(auditContextKeyDiff, ComputeAuditDiff(before, after))
+}
+
+// SetAuditPartialDiff 用于部分更新接口，只记录请求中提交的字段的变更，fields 为请求体的顶层字段
+func SetAuditPartialDiff(c *gin.Context, targetId any, before any, after any, fields []string) {
+	diff := ComputeAuditDiff(before, after)
+	for key := range diff {
+		field, _, _ := strings.Cut(key, ".")
+		if !common.StringsContains(fields, field) {
+			delete(diff, key)
+		}
+	}
+	c.Set(auditContextKeyTargetId, fmt.Sprintf("%v", targetId))
+	c.Set(auditContextKeyDiff, diff)
+}
+
+// OptionAuditValues 返回设置项变更前后用于对比的值，JSON 对象格式的设置项（如模型倍率、分组倍率）按子项对比
+func OptionAuditValues(key string, oldValue string, newValue string) (map[string]any, map[string]any) {
+	var before, after any = oldValue, newValue
+	var oldMap, newMap map[string]any
+	if json.Unmarshal([]byte(oldValue), &oldMap) == nil && json.Unmarshal([]byte(newValue), &newMap) == nil {
+		before, after = oldMap, newMap
+	}
+	return map[string]any{key: before}, map[string]any{key: after}
+}
+
+// SetAuditAction 覆盖按请求方法推断的操作类型，用于同一接口包含多种操作的情况
+func SetAuditAction(c *gin.Context, action string) {
+	c.Set(auditContextKeyAction, action)
+}
+
+// GetAuditAction 返回 SetAuditAction 设置的操作类型
+func GetAuditAction(c *gin.Context) string {
+	return c.GetString(auditContextKeyAction)
+}
+
+// GetAuditDiff 返回 SetAuditDiff 记录的操作对象和变更内容
+func GetAuditDiff(c *gin.Context) (string, map[string]AuditFieldChange, bool) {
+	diff, ok := c.Get(auditContextKeyDiff)
+	if !ok {
+		return "", nil, false
+	}
+	return c.GetString(auditContextKeyTargetId), diff.(map[string]AuditFieldChange), true
+}
+
+func RecordAuditLog(c *gin.Context, log *AuditLog, diff map[string]AuditFieldChange) {
+	log.CreatedAt = common.GetTimestamp()
+	log.UserId = c.GetInt("id")
+	log.Username = c.GetString("username")
+	log.AdminApiKeyId = c.GetInt("admin_api_key_id")
+	log.Ip = c.ClientIP()
+	log.Method = c.Request.Method
+	log.Path = c.Request.URL.Path
+	diffBytes, _ := json.Marshal(diff)
+	log.Diff = string(diffBytes)
+	if err := LOG_DB.Create(log).Error; err != nil {
+		common.LogError(c, "failed to record audit log: "+err.Error())
+	}
+}
+
+func GetAuditLogs(startIdx int, num int, username string, targetType string, targetId string, action string,
+	keyword string, startTimestamp int64, endTimestamp int64) (logs []*AuditLog, total int64, err error) {
+	tx := LOG_DB.Model(&AuditLog{})
+	if username != "" {
+		tx = tx.Where("username = ?", username)
+	}
+	if targetType != "" {
+		tx = tx.Where("target_type = ?", targetType)
+	}
+	if targetId != "" {
+		tx = tx.Where("target_id = ?", targetId)
+	}
+	if action != "" {
+		tx = tx.Where("action = ?", action)
+	}
+	if keyword != "" {
+		tx = tx.Where("diff LIKE ?", "%"+keyword+"%")
+	}
+	if startTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", endTimestamp)
+	}
+	err = tx.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&logs).Error
+	return logs, total, err
+}
+
+// CleanExpiredAuditLogs 按保留天数定期清理审计记录，保留天数为 0 时不清理
+func CleanExpiredAuditLogs() {
+	for {
+		retentionDays := operation_setting.GetAuditSetting().RetentionDays
+		if retentionDays > 0 {
+			targetTimestamp := common.GetTimestamp() - int64(retentionDays)*86400
+			result := LOG_DB.Where("created_at < ?", targetTimestamp).Delete(&AuditLog{})
+			if result.Error != nil {
+				common.SysError("failed to clean expired audit logs: " + result.Error.Error())
+			} else if result.RowsAffected > 0 {
+				common.SysLog(fmt.Sprintf("cleaned %d expired audit logs", result.RowsAffected))
+			}
+		}
+		time.Sleep(time.Hour)
+	}
+}
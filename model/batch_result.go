@@ -0,0 +1,34 @@
+package model
+
+// BatchResult 批处理已完成的一行结果，执行过程中按行追加写入，同时作为断点续跑时的完成记录。
+// 批处理结束后合并写入输出文件和错误文件并删除
+type BatchResult struct {
+	Id      int    `json:"id"`
+	TaskId  int64  `json:"task_id" gorm:"uniqueIndex:idx_batch_result_line"`
+	Line    int    `json:"line" gorm:"uniqueIndex:idx_batch_result_line"`
+	IsError bool   `json:"is_error"`
+	Content []byte `json:"-"`
+}
+
+func InsertBatchResults(results []*BatchResult) error {
+	if len(results) == 0 {
+		return nil
+	}
+	return DB.Create(&results).Error
+}
+
+// GetBatchResultStates 返回已完成的行（不包含内容），用于断点续跑时跳过已完成的行并恢复计数
+func GetBatchResultStates(taskId int64) (results []*BatchResult, err error) {
+	err = DB.Omit("content").Where("task_id = ?", taskId).Find(&results).Error
+	return results, err
+}
+
+// GetBatchResults 按行号顺序返回全部结果
+func GetBatchResults(taskId int64) (results []*BatchResult, err error) {
+	err = DB.Where("task_id = ?", taskId).Order("line asc").Find(&results).Error
+	return results, err
+}
+
+func DeleteBatchResults(taskId int64) error {
+	return DB.Where("task_id = ?", taskId).Delete(&BatchResult{}).Error
+}
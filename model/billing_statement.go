@@ -0,0 +1,519 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"one-api/common"
+	"one-api/setting/operation_setting"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const billingStatementPeriodLayout = "2006-01"
+
+const (
+	BillingStatementPaymentUnpaid = "unpaid"
+	BillingStatementPaymentPaid   = "paid"
+)
+
+// BillingStatement 用户月度账单，金额均为额度。账单只统计用户自身额度的变化，组织额度池的消费不计入
+type BillingStatement struct {
+	Id        int    `json:"id"`
+	UserId    int    `json:"user_id" gorm:"uniqueIndex:idx_billing_statement_user_period"`
+	Period    string `json:"period" gorm:"type:varchar(7);uniqueIndex:idx_billing_statement_user_period;index"`
+	InvoiceNo string `json:"invoice_no" gorm:"type:varchar(64);uniqueIndex"`
+	StartTime int64  `json:"start_time" gorm:"bigint"`
+	EndTime   int64  `json:"end_time" gorm:"bigint"`
+	// OpeningBalance 期初余额，取上期账单的期末余额，没有上期账单时按本期变动倒推
+	OpeningBalance  int64 `json:"opening_balance"`
+	TopUpQuota      int64 `json:"top_up_quota"`
+	RedemptionQuota int64 `json:"redemption_quota"`
+	RefundQuota     int64 `json:"refund_quota"`
+	ConsumedQuota   int64 `json:"consumed_quota"`
+	// AdjustmentQuota 管理员调整等其他变动
+	AdjustmentQuota int64 `json:"adjustment_quota"`
+	ClosingBalance  int64 `json:"closing_balance"`
+	// AmountDue 后付费用户的应付金额，为期末欠款中尚未计入之前账单的部分，预付费用户为 0
+	AmountDue int64 `json:"amount_due"`
+	// PaymentStatus 有应付金额时为 unpaid 或 paid，否则为空
+	PaymentStatus string `json:"payment_status" gorm:"type:varchar(16);index"`
+	DueTime       int64  `json:"due_time" gorm:"bigint"`
+	PaidTime      int64  `json:"paid_time" gorm:"bigint"`
+	Detail        string `json:"-" gorm:"type:text"`
+	CreatedTime   int64  `json:"created_time" gorm:"bigint"`
+}
+
+// BillingStatementUsage 按模型和令牌汇总的消费
+type BillingStatementUsage struct {
+	ModelName        string `json:"model_name"`
+	TokenName        string `json:"token_name"`
+	Requests         int64  `json:"requests"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+	Quota            int64  `json:"quota"`
+}
+
+type BillingStatementTopUp struct {
+	Id       int     `json:"id"`
+	TradeNo  string  `json:"trade_no"`
+	Provider string  `json:"provider"`
+	Money    float64 `json:"money"`
+	Currency string  `json:"currency"`
+	Quota    int64   `json:"quota"`
+	Status   string  `json:"status"`
+	Time     int64   `json:"time"`
+}
+
+type BillingStatementRedemption struct {
+	Id    int    `json:"id"`
+	Name  string `json:"name"`
+	Quota int64  `json:"quota"`
+	Time  int64  `json:"time"`
+}
+
+type BillingStatementDetail struct {
+	Username    string                       `json:"username"`
+	DisplayName string                       `json:"display_name"`
+	Email       string                       `json:"email"`
+	Usage       []BillingStatementUsage      `json:"usage"`
+	TopUps      []BillingStatementTopUp      `json:"top_ups"`
+	Redemptions []BillingStatementRedemption `json:"redemptions"`
+}
+
+// billingStatementLock 避免同一节点并发生成同一账单，账单编号由 BillingInvoiceSequence 分配
+var billingStatementLock sync.Mutex
+
+// BillingInvoiceSequence 每个账期已分配的最大账单序号，分配时对该行加锁，多个节点不会分配到相同编号
+type BillingInvoiceSequence struct {
+	Period string `json:"period" gorm:"primaryKey;type:varchar(7)"`
+	LastNo int64  `json:"last_no"`
+}
+
+func (statement *BillingStatement) GetDetail() *BillingStatementDetail {
+	detail := &BillingStatementDetail{}
+	if statement.Detail != "" {
+		_ = json.Unmarshal([]byte(statement.Detail), detail)
+	}
+	return detail
+}
+
+// ParseBillingStatementPeriod 解析 "2006-01" 格式的账期，返回账期的起止时间戳，结束时间不包含在内
+func ParseBillingStatementPeriod(period string) (int64, int64, error) {
+	start, err := time.ParseInLocation(billingStatementPeriodLayout, period, time.Local)
+	if err != nil {
+		return 0, 0, errors.New("账期格式应为 YYYY-MM")
+	}
+	return start.Unix(), start.AddDate(0, 1, 0).Unix(), nil
+}
+
+// PreviousBillingStatementPeriod 上一个自然月的账期
+func PreviousBillingStatementPeriod(now time.Time) string {
+	year, month, _ := now.Date()
+	return time.Date(year, month-1, 1, 0, 0, 0, 0, now.Location()).Format(billingStatementPeriodLayout)
+}
+
+func topUpQuota(amount int64) int64 {
+	return int64((&TopUp{Amount: amount}).Quota())
+}
+
+// billingStatementFlows 统计用户在 [start, end) 内的额度变动
+type billingStatementFlows struct {
+	topUps      []BillingStatementTopUp
+	redemptions []BillingStatementRedemption
+	topUp       int64
+	redemption  int64
+	refund      int64
+	consumed    int64
+}
+
+func getBillingStatementFlows(userId int, start int64, end int64) (*billingStatementFlows, error) {
+	flows := &billingStatementFlows{}
+	var topUps []*TopUp
+	err := DB.Where("user_id = ? AND status IN ?", userId, []string{TopUpStatusSuccess, TopUpStatusRefunded}).
+		Where("((complete_time >= ? AND complete_time < ?) OR (complete_time = 0 AND create_time >= ? AND create_time < ?))", start, end, start, end).
+		Order("id asc").Find(&topUps).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, topUp := range topUps {
+		completeTime := topUp.CompleteTime
+		if completeTime == 0 {
+			completeTime = topUp.CreateTime
+		}
+		quota := topUpQuota(topUp.Amount)
+		flows.topUp += quota
+		flows.topUps = append(flows.topUps, BillingStatementTopUp{
+			Id:       topUp.Id,
+			TradeNo:  topUp.TradeNo,
+			Provider: topUp.Provider,
+			Money:    topUp.Money,
+			Currency: topUp.Currency,
+			Quota:    quota,
+			Status:   topUp.Status,
+			Time:     completeTime,
+		})
+	}
+
+	var refundedAmounts []int64
+	err = DB.Table("top_up_events").Joins("JOIN top_ups ON top_ups.id = top_up_events.top_up_id").
+		Where("top_ups.user_id = ? AND top_up_events.to_status = ?", userId, TopUpStatusRefunded).
+		Where("top_up_events.created_time >= ? AND top_up_events.created_time < ?", start, end).
+		Pluck("top_ups.amount", &refundedAmounts).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, amount := range refundedAmounts {
+		flows.refund += topUpQuota(amount)
+	}
+
+	// 兑换记录中增加余额的部分，分组奖励不计入；兑换记录之前使用的单次兑换码没有记录，按兑换码统计
+	var redemptions []BillingStatementRedemption
+	err = DB.Table("redemption_records").Joins("JOIN redemptions ON redemptions.id = redemption_records.redemption_id").
+		Where("redemption_records.user_id = ? AND redemption_records.quota > 0", userId).
+		Where("redemption_records.created_time >= ? AND redemption_records.created_time < ?", start, end).
+		Select("redemptions.id AS id, redemptions.name AS name, redemption_records.quota AS quota, redemption_records.created_time AS time").
+		Order("redemption_records.id asc").Scan(&redemptions).Error
+	if err != nil {
+		return nil, err
+	}
+	var legacyRedemptions []*Redemption
+	err = DB.Unscoped().Where("used_user_id = ? AND status = ? AND used_count = 0", userId, common.RedemptionCodeStatusUsed).
+		Where("redeemed_time >= ? AND redeemed_time < ?", start, end).Order("redeemed_time asc").Find(&legacyRedemptions).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, redemption := range legacyRedemptions {
+		redemptions = append(redemptions, BillingStatementRedemption{
+			Id:    redemption.Id,
+			Name:  redemption.Name,
+			Quota: int64(redemption.Quota),
+			Time:  redemption.RedeemedTime,
+		})
+	}
+	sort.SliceStable(redemptions, func(i, j int) bool {
+		return redemptions[i].Time < redemptions[j].Time
+	})
+	for _, redemption := range redemptions {
+		flows.redemption += redemption.Quota
+	}
+	flows.redemptions = redemptions
+
+	err = LOG_DB.Model(&Log{}).Where("user_id = ? AND type = ? AND org_id = 0", userId, LogTypeConsume).
+		Where("created_at >= ? AND created_at < ?", start, end).
+		Select("COALESCE(SUM(quota), 0)").Scan(&flows.consumed).Error
+	if err != nil {
+		return nil, err
+	}
+	return flows, nil
+}
+
+func getBillingStatementUsage(userId int, start int64, end int64) ([]BillingStatementUsage, error) {
+	var usage []BillingStatementUsage
+	err := LOG_DB.Model(&Log{}).
+		Select("model_name, token_name, COUNT(*) AS requests, COALESCE(SUM(prompt_tokens), 0) AS prompt_tokens, "+
+			"COALESCE(SUM(completion_tokens), 0) AS completion_tokens, COALESCE(SUM(quota), 0) AS quota").
+		Where("user_id = ? AND type = ? AND org_id = 0", userId, LogTypeConsume).
+		Where("created_at >= ? AND created_at < ?", start, end).
+		Group("model_name, token_name").Scan(&usage).Error
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(usage, func(i, j int) bool {
+		if usage[i].Quota != usage[j].Quota {
+			return usage[i].Quota > usage[j].Quota
+		}
+		return usage[i].ModelName+usage[i].TokenName < usage[j].ModelName+usage[j].TokenName
+	})
+	return usage, nil
+}
+
+// nextBillingStatementInvoiceNo 在事务中分配账期的下一个账单编号，事务回滚时编号不会被占用
+func nextBillingStatementInvoiceNo(tx *gorm.DB, period string) (string, error) {
+	setting := operation_setting.GetBillingStatementSetting()
+	// 账期首次分配时从已有账单数开始，兼容没有序号记录的历史账单
+	var count int64
+	if err := tx.Model(&BillingStatement{}).Where("period = ?", period).Count(&count).Error; err != nil {
+		return "", err
+	}
+	err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&BillingInvoiceSequence{Period: period, LastNo: count}).Error
+	if err != nil {
+		return "", err
+	}
+	// 条件更新对序号行加锁直到事务结束
+	err = tx.Model(&BillingInvoiceSequence{}).Where("period = ?", period).Update("last_no", gorm.Expr("last_no + 1")).Error
+	if err != nil {
+		return "", err
+	}
+	sequence := &BillingInvoiceSequence{}
+	if err = tx.Where("period = ?", period).First(sequence).Error; err != nil {
+		return "", err
+	}
+	digits := setting.InvoiceNumberDigits
+	if digits <= 0 {
+		digits = 1
+	}
+	return fmt.Sprintf("%s%s-%0*d", setting.InvoicePrefix, strings.ReplaceAll(period, "-", ""), digits, sequence.LastNo), nil
+}
+
+// GenerateBillingStatement 生成用户指定账期的账单，账单已存在时直接返回，force 为 true 时重新计算并保留原编号
+func GenerateBillingStatement(userId int, period string, force bool) (*BillingStatement, error) {
+	start, end, err := ParseBillingStatementPeriod(period)
+	if err != nil {
+		return nil, err
+	}
+	if end > common.GetTimestamp() {
+		return nil, errors.New("只能生成已结束账期的账单")
+	}
+	billingStatementLock.Lock()
+	defer billingStatementLock.Unlock()
+
+	statement := &BillingStatement{}
+	err = DB.Where("user_id = ? AND period = ?", userId, period).First(statement).Error
+	if err == nil && !force {
+		return statement, nil
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	user, err := GetUserById(userId, false)
+	if err != nil {
+		return nil, err
+	}
+	flows, err := getBillingStatementFlows(userId, start, end)
+	if err != nil {
+		return nil, err
+	}
+	// 当前余额减去账期结束后的变动即为期末余额
+	after, err := getBillingStatementFlows(userId, end, math.MaxInt64)
+	if err != nil {
+		return nil, err
+	}
+	closing := int64(user.Quota) - after.topUp - after.redemption + after.refund + after.consumed
+	change := flows.topUp + flows.redemption - flows.refund - flows.consumed
+	opening := closing - change
+	previous := &BillingStatement{}
+	if err := DB.Where("user_id = ? AND period = ?", userId, time.Unix(start, 0).AddDate(0, -1, 0).Format(billingStatementPeriodLayout)).
+		First(previous).Error; err == nil {
+		opening = previous.ClosingBalance
+	}
+	usage, err := getBillingStatementUsage(userId, start, end)
+	if err != nil {
+		return nil, err
+	}
+	detail, _ := json.Marshal(&BillingStatementDetail{
+		Username:    user.Username,
+		DisplayName: user.DisplayName,
+		Email:       user.Email,
+		Usage:       usage,
+		TopUps:      flows.topUps,
+		Redemptions: flows.redemptions,
+	})
+
+	statement.UserId = userId
+	statement.Period = period
+	statement.StartTime = start
+	statement.EndTime = end
+	statement.OpeningBalance = opening
+	statement.TopUpQuota = flows.topUp
+	statement.RedemptionQuota = flows.redemption
+	statement.RefundQuota = flows.refund
+	statement.ConsumedQuota = flows.consumed
+	statement.AdjustmentQuota = closing - opening - change
+	statement.ClosingBalance = closing
+	statement.Detail = string(detail)
+	statement.CreatedTime = common.GetTimestamp()
+	if err = setBillingStatementAmountDue(statement); err != nil {
+		return nil, err
+	}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if statement.InvoiceNo == "" {
+			invoiceNo, err := nextBillingStatementInvoiceNo(tx, period)
+			if err != nil {
+				return err
+			}
+			statement.InvoiceNo = invoiceNo
+		}
+		return tx.Save(statement).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return statement, nil
+}
+
+// setBillingStatementAmountDue 计算后付费用户账单的应付金额，已付款的账单保持不变，重新生成时保留原付款期限
+func setBillingStatementAmountDue(statement *BillingStatement) error {
+	if statement.PaymentStatus == BillingStatementPaymentPaid {
+		return nil
+	}
+	account, err := getCreditAccountFromDB(statement.UserId)
+	if err != nil {
+		return err
+	}
+	statement.AmountDue = 0
+	if account.IsPostpaid() && statement.ClosingBalance < 0 {
+		outstanding, err := getCreditOutstanding(statement.UserId, statement.Period)
+		if err != nil {
+			return err
+		}
+		statement.AmountDue = max(0, -statement.ClosingBalance-outstanding)
+	}
+	if statement.AmountDue == 0 {
+		statement.PaymentStatus = ""
+		statement.DueTime = 0
+		return nil
+	}
+	statement.PaymentStatus = BillingStatementPaymentUnpaid
+	if statement.DueTime == 0 {
+		statement.DueTime = statement.CreatedTime + int64(account.GetPaymentTermDays())*24*3600
+	}
+	return nil
+}
+
+// PayBillingStatement 将账单标记为已付款。creditQuota 为 true 时按应付金额为用户增加额度，用于线下收款；
+// 用户已通过在线充值补足欠款时应传 false，避免重复入账
+func PayBillingStatement(id int, creditQuota bool) (*BillingStatement, error) {
+	statement, err := GetBillingStatementById(id)
+	if err != nil {
+		return nil, err
+	}
+	if statement.PaymentStatus != BillingStatementPaymentUnpaid {
+		return nil, errors.New("账单没有待付款的金额")
+	}
+	now := common.GetTimestamp()
+	result := DB.Model(&BillingStatement{}).Where("id = ? AND payment_status = ?", id, BillingStatementPaymentUnpaid).
+		Updates(map[string]interface{}{"payment_status": BillingStatementPaymentPaid, "paid_time": now})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errors.New("账单没有待付款的金额")
+	}
+	statement.PaymentStatus = BillingStatementPaymentPaid
+	statement.PaidTime = now
+	if creditQuota {
+		if err = IncreaseUserQuota(statement.UserId, int(statement.AmountDue), true); err != nil {
+			return nil, err
+		}
+		RecordLog(statement.UserId, LogTypeManage, fmt.Sprintf("账单 %s 已付款，恢复额度 %s", statement.InvoiceNo, common.LogQuota(int(statement.AmountDue))))
+	} else {
+		RecordLog(statement.UserId, LogTypeManage, fmt.Sprintf("账单 %s 已付款", statement.InvoiceNo))
+	}
+	return statement, nil
+}
+
+// getBillingStatementUserIds 账期内有消费、充值、兑换或退款的用户
+func getBillingStatementUserIds(start int64, end int64) ([]int, error) {
+	userIds := make(map[int]bool)
+	collect := func(ids []int, err error) error {
+		for _, id := range ids {
+			userIds[id] = true
+		}
+		return err
+	}
+	var ids []int
+	err := collect(ids, LOG_DB.Model(&Log{}).Where("type = ? AND org_id = 0 AND created_at >= ? AND created_at < ?", LogTypeConsume, start, end).
+		Distinct().Pluck("user_id", &ids).Error)
+	if err == nil {
+		ids = nil
+		err = collect(ids, DB.Model(&TopUp{}).Where("status IN ?", []string{TopUpStatusSuccess, TopUpStatusRefunded}).
+			Where("((complete_time >= ? AND complete_time < ?) OR (complete_time = 0 AND create_time >= ? AND create_time < ?))", start, end, start, end).
+			Distinct().Pluck("user_id", &ids).Error)
+	}
+	if err == nil {
+		ids = nil
+		err = collect(ids, DB.Unscoped().Model(&Redemption{}).Where("status = ? AND used_count = 0 AND redeemed_time >= ? AND redeemed_time < ?", common.RedemptionCodeStatusUsed, start, end).
+			Distinct().Pluck("used_user_id", &ids).Error)
+	}
+	if err == nil {
+		ids = nil
+		err = collect(ids, DB.Model(&RedemptionRecord{}).Where("quota > 0 AND created_time >= ? AND created_time < ?", start, end).
+			Distinct().Pluck("user_id", &ids).Error)
+	}
+	if err == nil {
+		ids = nil
+		err = collect(ids, DB.Table("top_up_events").Joins("JOIN top_ups ON top_ups.id = top_up_events.top_up_id").
+			Where("top_up_events.to_status = ? AND top_up_events.created_time >= ? AND top_up_events.created_time < ?", TopUpStatusRefunded, start, end).
+			Distinct().Pluck("top_ups.user_id", &ids).Error)
+	}
+	if err != nil {
+		return nil, err
+	}
+	result := make([]int, 0, len(userIds))
+	for id := range userIds {
+		result = append(result, id)
+	}
+	sort.Ints(result)
+	return result, nil
+}
+
+// GenerateBillingStatements 为账期内有额度变动的用户生成账单，已存在的账单不会重复生成
+func GenerateBillingStatements(period string) (int, error) {
+	start, end, err := ParseBillingStatementPeriod(period)
+	if err != nil {
+		return 0, err
+	}
+	userIds, err := getBillingStatementUserIds(start, end)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, userId := range userIds {
+		if _, err := GenerateBillingStatement(userId, period, false); err != nil {
+			common.SysError(fmt.Sprintf("failed to generate billing statement for user %d: %s", userId, err.Error()))
+			continue
+		}
+		count++
+	}
+	return count, nil
+}
+
+// AutoGenerateBillingStatements 每小时检查一次，在每月初生成上月账单
+func AutoGenerateBillingStatements() {
+	lastPeriod := ""
+	for {
+		period := PreviousBillingStatementPeriod(time.Now())
+		if operation_setting.GetBillingStatementSetting().Enabled && period != lastPeriod {
+			count, err := GenerateBillingStatements(period)
+			if err != nil {
+				common.SysError("failed to generate billing statements: " + err.Error())
+			} else {
+				lastPeriod = period
+				common.SysLog(fmt.Sprintf("generated %d billing statements for %s", count, period))
+			}
+		}
+		time.Sleep(time.Hour)
+	}
+}
+
+func GetBillingStatementById(id int) (*BillingStatement, error) {
+	statement := &BillingStatement{}
+	err := DB.Where("id = ?", id).First(statement).Error
+	return statement, err
+}
+
+// GetBillingStatements 查询账单，userId 为 0 时查询所有用户，paymentStatus 为空时不限
+func GetBillingStatements(userId int, period string, paymentStatus string, startIdx int, num int) (statements []*BillingStatement, total int64, err error) {
+	tx := DB.Model(&BillingStatement{})
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if paymentStatus != "" {
+		tx = tx.Where("payment_status = ?", paymentStatus)
+	}
+	if period != "" {
+		tx = tx.Where("period = ?", period)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Omit("detail").Order("period desc, id desc").Limit(num).Offset(startIdx).Find(&statements).Error
+	return statements, total, err
+}
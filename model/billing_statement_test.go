@@ -0,0 +1,55 @@
+package model
+
+import (
+	"errors"
+	"one-api/setting/operation_setting"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestNextBillingStatementInvoiceNo(t *testing.T) {
+	db := setupTestDB(t, &BillingStatement{}, &BillingInvoiceSequence{})
+	oldSetting := *operation_setting.GetBillingStatementSetting()
+	operation_setting.GetBillingStatementSetting().InvoicePrefix = "INV"
+	operation_setting.GetBillingStatementSetting().InvoiceNumberDigits = 4
+	t.Cleanup(func() { *operation_setting.GetBillingStatementSetting() = oldSetting })
+	// 升级前已生成的账单没有序号记录
+	db.Create(&BillingStatement{UserId: 1, Period: "2026-01", InvoiceNo: "INV202601-0001"})
+	db.Create(&BillingStatement{UserId: 2, Period: "2026-01", InvoiceNo: "INV202601-0002"})
+
+	errRollback := errors.New("rollback")
+	tests := []struct {
+		name     string
+		period   string
+		rollback bool
+		want     string
+	}{
+		{"continues after existing statements", "2026-01", false, "INV202601-0003"},
+		{"rolled back allocation", "2026-01", true, "INV202601-0004"},
+		{"rolled back number is reused", "2026-01", false, "INV202601-0004"},
+		{"next", "2026-01", false, "INV202601-0005"},
+		{"new period starts at one", "2026-02", false, "INV202602-0001"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			err := DB.Transaction(func(tx *gorm.DB) error {
+				var err error
+				if got, err = nextBillingStatementInvoiceNo(tx, tt.period); err != nil {
+					return err
+				}
+				if tt.rollback {
+					return errRollback
+				}
+				return nil
+			})
+			if err != nil && !errors.Is(err, errRollback) {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("invoice no = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
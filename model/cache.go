@@ -90,6 +90,16 @@ func CacheGetRandomSatisfiedChannel(group string, model string, retry int) (*Cha
 	if len(channels) == 0 {
 		return nil, errors.New("channel not found")
 	}
+	// 排除熔断中的渠道，全部熔断时仍在所有渠道中选择
+	allowedChannels := make([]*Channel, 0, len(channels))
+	for _, channel := range channels {
+		if channelAllowed(channel.Id) {
+			allowedChannels = append(allowedChannels, channel)
+		}
+	}
+	if len(allowedChannels) > 0 {
+		channels = allowedChannels
+	}
 
 	uniquePriorities := make(map[int]bool)
 	for _, channel := range channels {
@@ -116,18 +126,22 @@ func CacheGetRandomSatisfiedChannel(group string, model string, retry int) (*Cha
 
 	// 平滑系数
 	smoothingFactor := 10
+	// 按延迟调整后的有效权重
+	weights := make([]float64, len(targetChannels))
 	// Calculate the total weight of all channels up to endIdx
-	totalWeight := 0
-	for _, channel := range targetChannels {
-		totalWeight += channel.GetWeight() + smoothingFactor
+	totalWeight := 0.0
+	for i, channel := range targetChannels {
+		weights[i] = float64(channel.GetWeight()+smoothingFactor) * channelLatencyFactor(channel.Id)
+		totalWeight += weights[i]
 	}
 	// Generate a random value in the range [0, totalWeight)
-	randomWeight := rand.Intn(totalWeight)
+	randomWeight := rand.Float64() * totalWeight
 
 	// Find a channel based on its weight
-	for _, channel := range targetChannels {
-		randomWeight -= channel.GetWeight() + smoothingFactor
+	for i, channel := range targetChannels {
+		randomWeight -= weights[i]
 		if randomWeight < 0 {
+			channelSelected(channel.Id)
 			return channel, nil
 		}
 	}
@@ -149,6 +163,17 @@ func CacheGetChannel(id int) (*Channel, error) {
 	return c, nil
 }
 
+func CacheUpdateChannelKeyStatus(id int, keyStatus *string) {
+	if !common.MemoryCacheEnabled {
+		return
+	}
+	channelSyncLock.Lock()
+	defer channelSyncLock.Unlock()
+	if channel, ok := channelsIDM[id]; ok {
+		channel.KeyStatus = keyStatus
+	}
+}
+
 func CacheUpdateChannelStatus(id int, status int) {
 	if !common.MemoryCacheEnabled {
 		return
@@ -12,7 +12,7 @@ import (
 type Channel struct {
 	Id                 int     `json:"id"`
 	Type               int     `json:"type" gorm:"default:0"`
-	Key                string  `json:"key" gorm:"not null"`
+	Key                string  `json:"key" gorm:"not null;serializer:secret"`
 	OpenAIOrganization *string `json:"openai_organization"`
 	TestModel          *string `json:"test_model"`
 	Status             int     `json:"status" gorm:"default:1"`
@@ -37,6 +37,10 @@ type Channel struct {
 	Tag               *string `json:"tag" gorm:"index"`
 	Setting           *string `json:"setting" gorm:"type:text"`
 	ParamOverride     *string `json:"param_override" gorm:"type:text"`
+	MultiKeyMode      *string `json:"multi_key_mode" gorm:"type:varchar(16);default:''"`
+	KeyStatus         *string `json:"-" gorm:"type:text"`
+
+	Health *ChannelHealthInfo `json:"health,omitempty" gorm:"-:all"` // only for api response
 }
 
 func (channel *Channel) GetModels() []string {
@@ -113,6 +117,14 @@ func GetChannelsByTag(tag string, idSort bool) ([]*Channel, error) {
 	return channels, err
 }
 
+// channelKeywordCondition 按 id、名称搜索渠道，密钥加密保存时无法按完整密钥匹配，只在未加密时按密钥搜索
+func channelKeywordCondition(keyword string) (string, []interface{}) {
+	if common.SecretEncryptionKey != "" {
+		return "(id = ? OR name LIKE ?)", []interface{}{common.String2Int(keyword), "%" + keyword + "%"}
+	}
+	return "(id = ? OR name LIKE ? OR " + keyCol + " = ?)", []interface{}{common.String2Int(keyword), "%" + keyword + "%", keyword}
+}
+
 func SearchChannels(keyword string, group string, model string, idSort bool) ([]*Channel, error) {
 	var channels []*Channel
 	modelsCol := "`models`"
@@ -142,11 +154,13 @@ func SearchChannels(keyword string, group string, model string, idSort bool) ([]
 			// sqlite, PostgreSQL
 			groupCondition = `(',' || ` + groupCol + ` || ',') LIKE ?`
 		}
-		whereClause = "(id = ? OR name LIKE ? OR " + keyCol + " = ?) AND " + modelsCol + ` LIKE ? AND ` + groupCondition
-		args = append(args, common.String2Int(keyword), "%"+keyword+"%", keyword, "%"+model+"%", "%,"+group+",%")
+		whereClause, args = channelKeywordCondition(keyword)
+		whereClause += " AND " + modelsCol + ` LIKE ? AND ` + groupCondition
+		args = append(args, "%"+model+"%", "%,"+group+",%")
 	} else {
-		whereClause = "(id = ? OR name LIKE ? OR " + keyCol + " = ?) AND " + modelsCol + " LIKE ?"
-		args = append(args, common.String2Int(keyword), "%"+keyword+"%", keyword, "%"+model+"%")
+		whereClause, args = channelKeywordCondition(keyword)
+		whereClause += " AND " + modelsCol + " LIKE ?"
+		args = append(args, "%"+model+"%")
 	}
 
 	// 执行查询
@@ -469,11 +483,13 @@ func SearchTags(keyword string, group string, model string, idSort bool) ([]*str
 			// sqlite, PostgreSQL
 			groupCondition = `(',' || ` + groupCol + ` || ',') LIKE ?`
 		}
-		whereClause = "(id = ? OR name LIKE ? OR " + keyCol + " = ?) AND " + modelsCol + ` LIKE ? AND ` + groupCondition
-		args = append(args, common.String2Int(keyword), "%"+keyword+"%", keyword, "%"+model+"%", "%,"+group+",%")
+		whereClause, args = channelKeywordCondition(keyword)
+		whereClause += " AND " + modelsCol + ` LIKE ? AND ` + groupCondition
+		args = append(args, "%"+model+"%", "%,"+group+",%")
 	} else {
-		whereClause = "(id = ? OR name LIKE ? OR " + keyCol + " = ?) AND " + modelsCol + " LIKE ?"
-		args = append(args, common.String2Int(keyword), "%"+keyword+"%", keyword, "%"+model+"%")
+		whereClause, args = channelKeywordCondition(keyword)
+		whereClause += " AND " + modelsCol + " LIKE ?"
+		args = append(args, "%"+model+"%")
 	}
 
 	subQuery := baseQuery.Where(whereClause, args...).
@@ -0,0 +1,235 @@
+package model
+
+import (
+	"one-api/setting/operation_setting"
+	"sync"
+	"time"
+)
+
+const (
+	CircuitStateClosed   = "closed"
+	CircuitStateOpen     = "open"
+	CircuitStateHalfOpen = "half_open"
+)
+
+// 单个渠道窗口内最多保留的样本数
+const maxChannelHealthSamples = 2000
+
+type channelHealthSample struct {
+	time    time.Time
+	success bool
+	frt     time.Duration
+	latency time.Duration
+}
+
+type channelHealth struct {
+	mu       sync.Mutex
+	samples  []channelHealthSample
+	state    string
+	openedAt time.Time
+	// halfOpenInFlight 半开状态下已放行的探测请求数
+	halfOpenInFlight int
+	// probeAt 最近一次进入半开状态的时间，探测请求长时间没有结果时重新放行
+	probeAt time.Time
+}
+
+// ChannelHealthInfo 管理接口返回的渠道健康度
+type ChannelHealthInfo struct {
+	State        string  `json:"state"`
+	Requests     int     `json:"requests"`
+	Failures     int     `json:"failures"`
+	ErrorRate    float64 `json:"error_rate"`
+	AvgFrtMs     int64   `json:"avg_frt_ms"`
+	AvgLatencyMs int64   `json:"avg_latency_ms"`
+	OpenedAt     int64   `json:"opened_at,omitempty"`
+}
+
+var channelHealthMap sync.Map
+
+func getChannelHealth(channelId int) *channelHealth {
+	value, _ := channelHealthMap.LoadOrStore(channelId, &channelHealth{state: CircuitStateClosed})
+	return value.(*channelHealth)
+}
+
+func (h *channelHealth) prune(now time.Time) {
+	window := time.Duration(operation_setting.GetChannelHealthSetting().WindowSeconds) * time.Second
+	idx := 0
+	for idx < len(h.samples) && now.Sub(h.samples[idx].time) > window {
+		idx++
+	}
+	if len(h.samples)-idx > maxChannelHealthSamples {
+		idx = len(h.samples) - maxChannelHealthSamples
+	}
+	if idx > 0 {
+		h.samples = append(h.samples[:0], h.samples[idx:]...)
+	}
+}
+
+func (h *channelHealth) stats() (requests int, failures int, avgFrt time.Duration, avgLatency time.Duration) {
+	var totalFrt, totalLatency time.Duration
+	frtCount := 0
+	for _, sample := range h.samples {
+		requests++
+		if !sample.success {
+			failures++
+			continue
+		}
+		totalLatency += sample.latency
+		if sample.frt > 0 {
+			totalFrt += sample.frt
+			frtCount++
+		}
+	}
+	if success := requests - failures; success > 0 {
+		avgLatency = totalLatency / time.Duration(success)
+	}
+	if frtCount > 0 {
+		avgFrt = totalFrt / time.Duration(frtCount)
+	}
+	return
+}
+
+// RecordChannelResult 记录一次中继请求的结果，frt 为首字时间，没有时传 0
+func RecordChannelResult(channelId int, success bool, frt time.Duration, latency time.Duration) {
+	setting := operation_setting.GetChannelHealthSetting()
+	h := getChannelHealth(channelId)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	h.samples = append(h.samples, channelHealthSample{
+		time:    now,
+		success: success,
+		frt:     frt,
+		latency: latency,
+	})
+	h.prune(now)
+
+	switch h.state {
+	case CircuitStateHalfOpen:
+		if success {
+			// 探测成功，关闭熔断并只保留本次探测的样本
+			h.state = CircuitStateClosed
+			h.samples = append(h.samples[:0], h.samples[len(h.samples)-1])
+		} else {
+			h.state = CircuitStateOpen
+			h.openedAt = now
+		}
+		h.halfOpenInFlight = 0
+	case CircuitStateClosed:
+		if !setting.CircuitBreakerEnabled || success {
+			return
+		}
+		requests, failures, _, _ := h.stats()
+		if requests >= setting.MinRequests && float64(failures)/float64(requests) >= setting.ErrorRateThreshold {
+			h.state = CircuitStateOpen
+			h.openedAt = now
+		}
+	}
+}
+
+// channelAllowed 判断渠道当前是否允许分配流量，熔断冷却结束后允许有限的探测请求
+func channelAllowed(channelId int) bool {
+	setting := operation_setting.GetChannelHealthSetting()
+	if !setting.CircuitBreakerEnabled {
+		return true
+	}
+	value, ok := channelHealthMap.Load(channelId)
+	if !ok {
+		return true
+	}
+	h := value.(*channelHealth)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	switch h.state {
+	case CircuitStateOpen:
+		return time.Since(h.openedAt) >= time.Duration(setting.CooldownSeconds)*time.Second
+	case CircuitStateHalfOpen:
+		return h.halfOpenInFlight < setting.HalfOpenRequests ||
+			time.Since(h.probeAt) >= time.Duration(setting.CooldownSeconds)*time.Second
+	}
+	return true
+}
+
+// channelSelected 渠道被选中后调用，熔断冷却结束的渠道进入半开状态并占用一个探测名额
+func channelSelected(channelId int) {
+	if !operation_setting.GetChannelHealthSetting().CircuitBreakerEnabled {
+		return
+	}
+	value, ok := channelHealthMap.Load(channelId)
+	if !ok {
+		return
+	}
+	h := value.(*channelHealth)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	cooldown := time.Duration(operation_setting.GetChannelHealthSetting().CooldownSeconds) * time.Second
+	if h.state == CircuitStateOpen || (h.state == CircuitStateHalfOpen && time.Since(h.probeAt) >= cooldown) {
+		h.state = CircuitStateHalfOpen
+		h.halfOpenInFlight = 0
+		h.probeAt = time.Now()
+	}
+	if h.state == CircuitStateHalfOpen {
+		h.halfOpenInFlight++
+	}
+}
+
+// channelLatencyFactor 根据首字时间（没有时使用总耗时）计算权重系数，范围 0.1-1
+func channelLatencyFactor(channelId int) float64 {
+	setting := operation_setting.GetChannelHealthSetting()
+	if !setting.LatencyWeightEnabled || setting.LatencyTargetMs <= 0 {
+		return 1
+	}
+	value, ok := channelHealthMap.Load(channelId)
+	if !ok {
+		return 1
+	}
+	h := value.(*channelHealth)
+	h.mu.Lock()
+	h.prune(time.Now())
+	_, _, avgFrt, avgLatency := h.stats()
+	h.mu.Unlock()
+	latency := avgFrt
+	if latency == 0 {
+		latency = avgLatency
+	}
+	target := time.Duration(setting.LatencyTargetMs) * time.Millisecond
+	if latency <= target {
+		return 1
+	}
+	factor := float64(target) / float64(latency)
+	if factor < 0.1 {
+		factor = 0.1
+	}
+	return factor
+}
+
+// GetChannelHealth 返回渠道在本节点上的健康度统计
+func GetChannelHealth(channelId int) ChannelHealthInfo {
+	info := ChannelHealthInfo{State: CircuitStateClosed}
+	value, ok := channelHealthMap.Load(channelId)
+	if !ok {
+		return info
+	}
+	h := value.(*channelHealth)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.prune(time.Now())
+	requests, failures, avgFrt, avgLatency := h.stats()
+	info.State = h.state
+	info.Requests = requests
+	info.Failures = failures
+	if requests > 0 {
+		info.ErrorRate = float64(failures) / float64(requests)
+	}
+	info.AvgFrtMs = avgFrt.Milliseconds()
+	info.AvgLatencyMs = avgLatency.Milliseconds()
+	if h.state != CircuitStateClosed {
+		info.OpenedAt = h.openedAt.Unix()
+	}
+	return info
+}
+
+// ResetChannelHealth 清除渠道的健康度统计并关闭熔断
+func ResetChannelHealth(channelId int) {
+	channelHealthMap.Delete(channelId)
+}
@@ -0,0 +1,176 @@
+package model
+
+import (
+	"one-api/setting/operation_setting"
+	"testing"
+	"time"
+)
+
+func setupChannelHealthTest(t *testing.T) *operation_setting.ChannelHealthSetting {
+	t.Helper()
+	setting := operation_setting.GetChannelHealthSetting()
+	old := *setting
+	setting.CircuitBreakerEnabled = true
+	setting.WindowSeconds = 60
+	setting.MinRequests = 4
+	setting.ErrorRateThreshold = 0.5
+	setting.CooldownSeconds = 30
+	setting.HalfOpenRequests = 1
+	t.Cleanup(func() {
+		*setting = old
+		channelHealthMap.Range(func(key, _ any) bool {
+			channelHealthMap.Delete(key)
+			return true
+		})
+	})
+	return setting
+}
+
+// expireCooldown 将熔断时间提前到冷却期之前
+func expireCooldown(channelId int) {
+	h := getChannelHealth(channelId)
+	h.mu.Lock()
+	h.openedAt = h.openedAt.Add(-time.Hour)
+	h.probeAt = h.probeAt.Add(-time.Hour)
+	h.mu.Unlock()
+}
+
+func TestChannelCircuitBreaker(t *testing.T) {
+	type step struct {
+		// result 为 nil 表示选择渠道而不是记录结果
+		result  *bool
+		expire  bool
+		allowed bool
+		state   string
+	}
+	ok, fail := true, false
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "stays closed below min requests",
+			steps: []step{
+				{result: &fail, allowed: true, state: CircuitStateClosed},
+				{result: &fail, allowed: true, state: CircuitStateClosed},
+				{result: &fail, allowed: true, state: CircuitStateClosed},
+			},
+		},
+		{
+			name: "stays closed below error rate",
+			steps: []step{
+				{result: &ok, allowed: true, state: CircuitStateClosed},
+				{result: &ok, allowed: true, state: CircuitStateClosed},
+				{result: &ok, allowed: true, state: CircuitStateClosed},
+				{result: &fail, allowed: true, state: CircuitStateClosed},
+			},
+		},
+		{
+			name: "opens at error rate",
+			steps: []step{
+				{result: &ok, allowed: true, state: CircuitStateClosed},
+				{result: &ok, allowed: true, state: CircuitStateClosed},
+				{result: &fail, allowed: true, state: CircuitStateClosed},
+				{result: &fail, allowed: false, state: CircuitStateOpen},
+			},
+		},
+		{
+			name: "half open probe success closes",
+			steps: []step{
+				{result: &fail}, {result: &fail}, {result: &fail},
+				{result: &fail, allowed: false, state: CircuitStateOpen},
+				{expire: true, allowed: true, state: CircuitStateOpen},
+				{allowed: false, state: CircuitStateHalfOpen},
+				{result: &ok, allowed: true, state: CircuitStateClosed},
+			},
+		},
+		{
+			name: "half open probe failure reopens",
+			steps: []step{
+				{result: &fail}, {result: &fail}, {result: &fail},
+				{result: &fail, allowed: false, state: CircuitStateOpen},
+				{expire: true, allowed: true, state: CircuitStateOpen},
+				{allowed: false, state: CircuitStateHalfOpen},
+				{result: &fail, allowed: false, state: CircuitStateOpen},
+			},
+		},
+		{
+			name: "stuck probe is released after cooldown",
+			steps: []step{
+				{result: &fail}, {result: &fail}, {result: &fail},
+				{result: &fail, allowed: false, state: CircuitStateOpen},
+				{expire: true, allowed: true, state: CircuitStateOpen},
+				{allowed: false, state: CircuitStateHalfOpen},
+				{expire: true, allowed: true, state: CircuitStateHalfOpen},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupChannelHealthTest(t)
+			const channelId = 1
+			for i, s := range tt.steps {
+				switch {
+				case s.expire:
+					expireCooldown(channelId)
+				case s.result != nil:
+					RecordChannelResult(channelId, *s.result, 0, time.Second)
+				default:
+					channelSelected(channelId)
+				}
+				if s.state == "" {
+					continue
+				}
+				if allowed := channelAllowed(channelId); allowed != s.allowed {
+					t.Errorf("step %d: allowed = %v, want %v", i, allowed, s.allowed)
+				}
+				if state := GetChannelHealth(channelId).State; state != s.state {
+					t.Errorf("step %d: state = %s, want %s", i, state, s.state)
+				}
+			}
+		})
+	}
+}
+
+func TestChannelCircuitBreakerDisabled(t *testing.T) {
+	setting := setupChannelHealthTest(t)
+	setting.CircuitBreakerEnabled = false
+	for i := 0; i < 10; i++ {
+		RecordChannelResult(1, false, 0, time.Second)
+	}
+	if !channelAllowed(1) || GetChannelHealth(1).State != CircuitStateClosed {
+		t.Error("channel blocked while circuit breaker is disabled")
+	}
+	if info := GetChannelHealth(1); info.Requests != 10 || info.ErrorRate != 1 {
+		t.Errorf("stats = %+v", info)
+	}
+}
+
+func TestChannelLatencyFactor(t *testing.T) {
+	setting := setupChannelHealthTest(t)
+	setting.LatencyWeightEnabled = true
+	setting.LatencyTargetMs = 1000
+	tests := []struct {
+		name    string
+		frt     time.Duration
+		latency time.Duration
+		want    float64
+	}{
+		{"fast", 500 * time.Millisecond, 2 * time.Second, 1},
+		{"slow first token", 2 * time.Second, 3 * time.Second, 0.5},
+		{"no first token uses latency", 0, 4 * time.Second, 0.25},
+		{"floor", 100 * time.Second, 100 * time.Second, 0.1},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channelId := i + 1
+			RecordChannelResult(channelId, true, tt.frt, tt.latency)
+			if got := channelLatencyFactor(channelId); got != tt.want {
+				t.Errorf("factor = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if got := channelLatencyFactor(100); got != 1 {
+		t.Errorf("unknown channel factor = %v", got)
+	}
+}
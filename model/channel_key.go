@@ -0,0 +1,250 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"math/rand"
+	"one-api/common"
+	"strings"
+	"sync"
+)
+
+// ChannelKeyState 多密钥渠道中单个密钥的状态，只记录非启用状态的密钥
+type ChannelKeyState struct {
+	Status int    `json:"status"`
+	Reason string `json:"reason,omitempty"`
+	Time   int64  `json:"time,omitempty"`
+}
+
+// ChannelKeyInfo 管理接口返回的密钥信息，不包含完整密钥
+type ChannelKeyInfo struct {
+	Index  int    `json:"index"`
+	Key    string `json:"key"`
+	Status int    `json:"status"`
+	Reason string `json:"reason"`
+	Time   int64  `json:"time"`
+	Used   int64  `json:"used"`
+}
+
+// channelKeyUsage 记录本节点上每个密钥的轮询位置和使用次数，渠道缓存刷新后仍然保留
+var channelKeyUsage = struct {
+	sync.Mutex
+	next map[int]int
+	used map[string]int64
+}{
+	next: make(map[int]int),
+	used: make(map[string]int64),
+}
+
+func channelKeyFingerprint(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+func MaskChannelKey(key string) string {
+	if len(key) <= 12 {
+		return "****"
+	}
+	return key[:4] + "****" + key[len(key)-4:]
+}
+
+func (channel *Channel) GetMultiKeyMode() string {
+	if channel.MultiKeyMode == nil {
+		return ""
+	}
+	return *channel.MultiKeyMode
+}
+
+func (channel *Channel) IsMultiKey() bool {
+	return channel.GetMultiKeyMode() != ""
+}
+
+func IsValidMultiKeyMode(mode string) bool {
+	switch mode {
+	case "", common.ChannelMultiKeyModeRoundRobin, common.ChannelMultiKeyModeRandom, common.ChannelMultiKeyModeLeastUsed:
+		return true
+	}
+	return false
+}
+
+// GetKeys 多密钥渠道按行拆分密钥，普通渠道返回原始密钥
+func (channel *Channel) GetKeys() []string {
+	if !channel.IsMultiKey() {
+		return []string{channel.Key}
+	}
+	keys := make([]string, 0)
+	for _, key := range strings.Split(channel.Key, "\n") {
+		key = strings.TrimSpace(key)
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (channel *Channel) GetKeyStatus() map[string]*ChannelKeyState {
+	states := make(map[string]*ChannelKeyState)
+	channelSyncLock.RLock()
+	keyStatus := channel.KeyStatus
+	channelSyncLock.RUnlock()
+	if keyStatus != nil && *keyStatus != "" {
+		err := json.Unmarshal([]byte(*keyStatus), &states)
+		if err != nil {
+			common.SysError("failed to unmarshal key status: " + err.Error())
+		}
+	}
+	return states
+}
+
+func (channel *Channel) setKeyStatus(states map[string]*ChannelKeyState) {
+	// 清理已经不在密钥列表中的状态
+	keys := make(map[string]bool)
+	for _, key := range channel.GetKeys() {
+		keys[channelKeyFingerprint(key)] = true
+	}
+	for fingerprint := range states {
+		if !keys[fingerprint] {
+			delete(states, fingerprint)
+		}
+	}
+	statesBytes, err := json.Marshal(states)
+	if err != nil {
+		common.SysError("failed to marshal key status: " + err.Error())
+		return
+	}
+	channel.KeyStatus = common.GetPointer[string](string(statesBytes))
+}
+
+// GetNextKey 按渠道的多密钥策略选择一个启用的密钥，没有启用的密钥时在全部密钥中选择
+func (channel *Channel) GetNextKey() string {
+	if !channel.IsMultiKey() {
+		return channel.Key
+	}
+	keys := channel.GetKeys()
+	if len(keys) == 0 {
+		return ""
+	}
+	states := channel.GetKeyStatus()
+	enabledKeys := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if state, ok := states[channelKeyFingerprint(key)]; ok && state.Status != common.ChannelStatusEnabled {
+			continue
+		}
+		enabledKeys = append(enabledKeys, key)
+	}
+	if len(enabledKeys) == 0 {
+		enabledKeys = keys
+	}
+
+	channelKeyUsage.Lock()
+	defer channelKeyUsage.Unlock()
+	var selected string
+	switch channel.GetMultiKeyMode() {
+	case common.ChannelMultiKeyModeRandom:
+		selected = enabledKeys[rand.Intn(len(enabledKeys))]
+	case common.ChannelMultiKeyModeLeastUsed:
+		selected = enabledKeys[0]
+		for _, key := range enabledKeys[1:] {
+			if channelKeyUsage.used[channelKeyFingerprint(key)] < channelKeyUsage.used[channelKeyFingerprint(selected)] {
+				selected = key
+			}
+		}
+	default:
+		next := channelKeyUsage.next[channel.Id]
+		selected = enabledKeys[next%len(enabledKeys)]
+		channelKeyUsage.next[channel.Id] = next + 1
+	}
+	channelKeyUsage.used[channelKeyFingerprint(selected)]++
+	return selected
+}
+
+// GetKeyIndex 返回密钥在渠道密钥列表中的位置，找不到时返回 -1
+func (channel *Channel) GetKeyIndex(key string) int {
+	for i, k := range channel.GetKeys() {
+		if k == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// GetKeyByIndex 返回指定位置的密钥，用于异步任务查询时使用提交任务时的密钥。
+// 位置无效（例如密钥列表已修改）时按多密钥策略重新选择
+func (channel *Channel) GetKeyByIndex(index int) string {
+	keys := channel.GetKeys()
+	if index >= 0 && index < len(keys) {
+		return keys[index]
+	}
+	return channel.GetNextKey()
+}
+
+// GetKeyInfos 返回所有密钥的状态，密钥经过脱敏处理
+func (channel *Channel) GetKeyInfos() []ChannelKeyInfo {
+	states := channel.GetKeyStatus()
+	keys := channel.GetKeys()
+	infos := make([]ChannelKeyInfo, 0, len(keys))
+	channelKeyUsage.Lock()
+	defer channelKeyUsage.Unlock()
+	for i, key := range keys {
+		fingerprint := channelKeyFingerprint(key)
+		info := ChannelKeyInfo{
+			Index:  i,
+			Key:    MaskChannelKey(key),
+			Status: common.ChannelStatusEnabled,
+			Used:   channelKeyUsage.used[fingerprint],
+		}
+		if state, ok := states[fingerprint]; ok {
+			info.Status = state.Status
+			info.Reason = state.Reason
+			info.Time = state.Time
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// UpdateChannelKeyStatus 更新多密钥渠道中单个密钥的状态，
+// 返回状态是否发生变化，以及更新后是否所有密钥都已被禁用
+func UpdateChannelKeyStatus(id int, key string, status int, reason string) (changed bool, allDisabled bool) {
+	channelStatusLock.Lock()
+	defer channelStatusLock.Unlock()
+
+	channel, err := GetChannelById(id, true)
+	if err != nil || !channel.IsMultiKey() {
+		return false, false
+	}
+	states := channel.GetKeyStatus()
+	fingerprint := channelKeyFingerprint(key)
+	state, ok := states[fingerprint]
+	if status == common.ChannelStatusEnabled {
+		if !ok {
+			return false, false
+		}
+		delete(states, fingerprint)
+	} else {
+		if ok && state.Status == status {
+			return false, false
+		}
+		states[fingerprint] = &ChannelKeyState{
+			Status: status,
+			Reason: reason,
+			Time:   common.GetTimestamp(),
+		}
+	}
+	if !saveChannelKeyStatus(channel, states) {
+		return false, false
+	}
+	return true, len(states) >= len(channel.GetKeys())
+}
+
+func saveChannelKeyStatus(channel *Channel, states map[string]*ChannelKeyState) bool {
+	channel.setKeyStatus(states)
+	err := DB.Model(&Channel{}).Where("id = ?", channel.Id).Update("key_status", channel.KeyStatus).Error
+	if err != nil {
+		common.SysError("failed to update channel key status: " + err.Error())
+		return false
+	}
+	CacheUpdateChannelKeyStatus(channel.Id, channel.KeyStatus)
+	return true
+}
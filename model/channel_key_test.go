@@ -0,0 +1,155 @@
+package model
+
+import (
+	"fmt"
+	"one-api/common"
+	"strings"
+	"testing"
+)
+
+// newTestMultiKeyChannel 密钥带上渠道 id 前缀，不同用例的密钥互不相同
+func newTestMultiKeyChannel(id int, mode string, keyCount int, disabled ...int) *Channel {
+	keys := make([]string, 0, keyCount)
+	for i := 0; i < keyCount; i++ {
+		keys = append(keys, fmt.Sprintf("sk-%d-%d", id, i))
+	}
+	channel := &Channel{Id: id, Key: strings.Join(keys, "\n"), MultiKeyMode: common.GetPointer(mode)}
+	states := make(map[string]*ChannelKeyState)
+	for _, i := range disabled {
+		states[channelKeyFingerprint(keys[i])] = &ChannelKeyState{Status: common.ChannelStatusAutoDisabled}
+	}
+	channel.setKeyStatus(states)
+	return channel
+}
+
+func TestChannelGetNextKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		channel  *Channel
+		warmup   []int // least_used 用例中预先使用的次数，按密钥位置
+		want     []string
+		selected int // 为 0 时检查 want 的顺序，否则检查 selected 次选择均落在 want 中
+	}{
+		{
+			name:    "single key channel returns raw key",
+			channel: &Channel{Id: 1001, Key: "sk-single"},
+			want:    []string{"sk-single", "sk-single"},
+		},
+		{
+			name:    "round robin",
+			channel: newTestMultiKeyChannel(1002, common.ChannelMultiKeyModeRoundRobin, 3),
+			want:    []string{"sk-1002-0", "sk-1002-1", "sk-1002-2", "sk-1002-0"},
+		},
+		{
+			name:    "round robin skips disabled keys",
+			channel: newTestMultiKeyChannel(1003, common.ChannelMultiKeyModeRoundRobin, 3, 1),
+			want:    []string{"sk-1003-0", "sk-1003-2", "sk-1003-0"},
+		},
+		{
+			name:    "all keys disabled falls back to every key",
+			channel: newTestMultiKeyChannel(1004, common.ChannelMultiKeyModeRoundRobin, 2, 0, 1),
+			want:    []string{"sk-1004-0", "sk-1004-1"},
+		},
+		{
+			name:    "least used",
+			channel: newTestMultiKeyChannel(1005, common.ChannelMultiKeyModeLeastUsed, 3),
+			warmup:  []int{2, 0, 1},
+			want:    []string{"sk-1005-1", "sk-1005-1", "sk-1005-2", "sk-1005-0"},
+		},
+		{
+			name:     "random only picks enabled keys",
+			channel:  newTestMultiKeyChannel(1006, common.ChannelMultiKeyModeRandom, 3, 0),
+			want:     []string{"sk-1006-1", "sk-1006-2"},
+			selected: 200,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys := tt.channel.GetKeys()
+			channelKeyUsage.Lock()
+			delete(channelKeyUsage.next, tt.channel.Id)
+			for i, key := range keys {
+				delete(channelKeyUsage.used, channelKeyFingerprint(key))
+				if i < len(tt.warmup) {
+					channelKeyUsage.used[channelKeyFingerprint(key)] = int64(tt.warmup[i])
+				}
+			}
+			channelKeyUsage.Unlock()
+			if tt.selected == 0 {
+				for i, want := range tt.want {
+					if got := tt.channel.GetNextKey(); got != want {
+						t.Errorf("selection %d = %s, want %s", i, got, want)
+					}
+				}
+				return
+			}
+			seen := make(map[string]int)
+			for i := 0; i < tt.selected; i++ {
+				seen[tt.channel.GetNextKey()]++
+			}
+			for _, want := range tt.want {
+				if seen[want] == 0 {
+					t.Errorf("%s never selected: %v", want, seen)
+				}
+			}
+			if len(seen) != len(tt.want) {
+				t.Errorf("selected keys = %v, want only %v", seen, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateChannelKeyStatus(t *testing.T) {
+	db := setupTestDB(t, &Channel{})
+	channel := newTestMultiKeyChannel(2001, common.ChannelMultiKeyModeRoundRobin, 3)
+	channel.Name = "multi"
+	if err := db.Create(channel).Error; err != nil {
+		t.Fatal(err)
+	}
+	keys := channel.GetKeys()
+	tests := []struct {
+		name        string
+		key         string
+		status      int
+		changed     bool
+		allDisabled bool
+		disabled    []string
+	}{
+		{"disable one key", keys[0], common.ChannelStatusAutoDisabled, true, false, []string{keys[0]}},
+		{"disable same key again", keys[0], common.ChannelStatusAutoDisabled, false, false, []string{keys[0]}},
+		{"disable second key", keys[1], common.ChannelStatusAutoDisabled, true, false, []string{keys[0], keys[1]}},
+		{"enable enabled key", keys[2], common.ChannelStatusEnabled, false, false, []string{keys[0], keys[1]}},
+		{"disable last key", keys[2], common.ChannelStatusAutoDisabled, true, true, []string{keys[0], keys[1], keys[2]}},
+		// 测试通过后只重新启用测试时使用的密钥
+		{"enable tested key", keys[1], common.ChannelStatusEnabled, true, false, []string{keys[0], keys[2]}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changed, allDisabled := UpdateChannelKeyStatus(channel.Id, tt.key, tt.status, "test")
+			if changed != tt.changed || allDisabled != tt.allDisabled {
+				t.Errorf("changed, allDisabled = %v, %v, want %v, %v", changed, allDisabled, tt.changed, tt.allDisabled)
+			}
+			stored, err := GetChannelById(channel.Id, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			states := stored.GetKeyStatus()
+			if len(states) != len(tt.disabled) {
+				t.Errorf("disabled keys = %d, want %d", len(states), len(tt.disabled))
+			}
+			for _, key := range tt.disabled {
+				if _, ok := states[channelKeyFingerprint(key)]; !ok {
+					t.Errorf("%s is not disabled", key)
+				}
+			}
+		})
+	}
+
+	single := &Channel{Id: 2002, Name: "single", Key: "sk-single"}
+	if err := db.Create(single).Error; err != nil {
+		t.Fatal(err)
+	}
+	if changed, _ := UpdateChannelKeyStatus(single.Id, "sk-single", common.ChannelStatusAutoDisabled, "test"); changed {
+		t.Error("key status changed on a single key channel")
+	}
+}
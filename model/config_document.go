@@ -0,0 +1,436 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"one-api/common"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// ConfigDocumentVersion 配置文档格式版本，格式不兼容变更时递增
+const ConfigDocumentVersion = 1
+
+// 导出配置时敏感信息的处理方式
+const (
+	ConfigSecretModePlain     = "plain"
+	ConfigSecretModeRedacted  = "redacted"
+	ConfigSecretModeEncrypted = "encrypted"
+)
+
+// ConfigDocument 网关配置文档，包含系统设置（含模型倍率、分组倍率等）和渠道，
+// 渠道的模型能力（abilities）由渠道的模型和分组生成，不单独导出。
+// 加密导出时 Kdf 记录由口令派生密钥的参数和盐值
+type ConfigDocument struct {
+	Version    int                   `json:"version" yaml:"version"`
+	ExportedAt int64                 `json:"exported_at" yaml:"exported_at"`
+	SecretMode string                `json:"secret_mode" yaml:"secret_mode"`
+	Kdf        *common.PassphraseKdf `json:"kdf,omitempty" yaml:"kdf,omitempty"`
+	Options    map[string]string     `json:"options" yaml:"options"`
+	Channels   []ConfigChannel       `json:"channels" yaml:"channels"`
+}
+
+// ConfigChannel 配置文档中的渠道，按名称与已有渠道匹配，不包含余额、用量等运行数据
+type ConfigChannel struct {
+	Name               string `json:"name" yaml:"name"`
+	Type               int    `json:"type" yaml:"type"`
+	Key                string `json:"key" yaml:"key"`
+	Status             int    `json:"status" yaml:"status"`
+	Group              string `json:"group" yaml:"group"`
+	Models             string `json:"models" yaml:"models"`
+	BaseURL            string `json:"base_url,omitempty" yaml:"base_url,omitempty"`
+	Other              string `json:"other,omitempty" yaml:"other,omitempty"`
+	OpenAIOrganization string `json:"openai_organization,omitempty" yaml:"openai_organization,omitempty"`
+	TestModel          string `json:"test_model,omitempty" yaml:"test_model,omitempty"`
+	Weight             uint   `json:"weight" yaml:"weight"`
+	Priority           int64  `json:"priority" yaml:"priority"`
+	AutoBan            int    `json:"auto_ban" yaml:"auto_ban"`
+	Tag                string `json:"tag,omitempty" yaml:"tag,omitempty"`
+	ModelMapping       string `json:"model_mapping,omitempty" yaml:"model_mapping,omitempty"`
+	StatusCodeMapping  string `json:"status_code_mapping,omitempty" yaml:"status_code_mapping,omitempty"`
+	Setting            string `json:"setting,omitempty" yaml:"setting,omitempty"`
+	ParamOverride      string `json:"param_override,omitempty" yaml:"param_override,omitempty"`
+	MultiKeyMode       string `json:"multi_key_mode,omitempty" yaml:"multi_key_mode,omitempty"`
+}
+
+// ConfigChange 导入配置时的单项变更
+type ConfigChange struct {
+	Type   string                      `json:"type"`
+	Key    string                      `json:"key"`
+	Action string                      `json:"action"`
+	Diff   map[string]AuditFieldChange `json:"diff"`
+
+	option  string
+	channel *Channel
+}
+
+const (
+	ConfigChangeTypeOption  = "option"
+	ConfigChangeTypeChannel = "channel"
+)
+
+// MarshalConfigDocument 按 format 序列化配置文档，支持 yaml 和 json
+func MarshalConfigDocument(document *ConfigDocument, format string) ([]byte, error) {
+	switch strings.ToLower(format) {
+	case "json":
+		return json.MarshalIndent(document, "", "  ")
+	case "yaml", "yml", "":
+		return yaml.Marshal(document)
+	}
+	return nil, fmt.Errorf("不支持的配置文档格式 %s", format)
+}
+
+// UnmarshalConfigDocument 解析 YAML 或 JSON 格式的配置文档
+func UnmarshalConfigDocument(data []byte) (*ConfigDocument, error) {
+	document := &ConfigDocument{}
+	if err := yaml.Unmarshal(data, document); err != nil {
+		return nil, fmt.Errorf("配置文档格式错误：%s", err.Error())
+	}
+	return document, nil
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func newConfigChannel(channel *Channel) ConfigChannel {
+	configChannel := ConfigChannel{
+		Name:               channel.Name,
+		Type:               channel.Type,
+		Key:                channel.Key,
+		Status:             channel.Status,
+		Group:              channel.Group,
+		Models:             channel.Models,
+		BaseURL:            derefString(channel.BaseURL),
+		Other:              channel.Other,
+		OpenAIOrganization: derefString(channel.OpenAIOrganization),
+		TestModel:          derefString(channel.TestModel),
+		Weight:             uint(channel.GetWeight()),
+		Priority:           channel.GetPriority(),
+		AutoBan:            1,
+		Tag:                derefString(channel.Tag),
+		ModelMapping:       derefString(channel.ModelMapping),
+		StatusCodeMapping:  derefString(channel.StatusCodeMapping),
+		Setting:            derefString(channel.Setting),
+		ParamOverride:      derefString(channel.ParamOverride),
+		MultiKeyMode:       derefString(channel.MultiKeyMode),
+	}
+	if channel.AutoBan != nil {
+		configChannel.AutoBan = *channel.AutoBan
+	}
+	return configChannel
+}
+
+// apply 将配置写入渠道，已有渠道保留 id 等运行数据
+func (configChannel *ConfigChannel) apply(channel *Channel) {
+	channel.Name = configChannel.Name
+	channel.Type = configChannel.Type
+	channel.Key = configChannel.Key
+	channel.Status = configChannel.Status
+	channel.Group = configChannel.Group
+	channel.Models = configChannel.Models
+	channel.BaseURL = &configChannel.BaseURL
+	channel.Other = configChannel.Other
+	channel.OpenAIOrganization = &configChannel.OpenAIOrganization
+	channel.TestModel = &configChannel.TestModel
+	channel.Weight = &configChannel.Weight
+	channel.Priority = &configChannel.Priority
+	channel.AutoBan = &configChannel.AutoBan
+	channel.Tag = &configChannel.Tag
+	channel.ModelMapping = &configChannel.ModelMapping
+	channel.StatusCodeMapping = &configChannel.StatusCodeMapping
+	channel.Setting = &configChannel.Setting
+	channel.ParamOverride = &configChannel.ParamOverride
+	channel.MultiKeyMode = &configChannel.MultiKeyMode
+}
+
+// configSecretKey 返回加密导出使用的密钥，导出时生成新的派生参数写入文档；
+// 早期导出的文档没有派生参数，使用口令的 SHA-256 作为密钥
+func configSecretKey(document *ConfigDocument, passphrase string, export bool) ([]byte, error) {
+	if document.SecretMode != ConfigSecretModeEncrypted {
+		return nil, nil
+	}
+	if export {
+		kdf, err := common.NewPassphraseKdf()
+		if err != nil {
+			return nil, err
+		}
+		document.Kdf = kdf
+	}
+	if document.Kdf == nil {
+		key := sha256.Sum256([]byte(passphrase))
+		return key[:], nil
+	}
+	return document.Kdf.DeriveKey(passphrase)
+}
+
+func encodeConfigSecret(value string, secretMode string, key []byte) (string, error) {
+	if value == "" {
+		return value, nil
+	}
+	switch secretMode {
+	case ConfigSecretModeRedacted:
+		return "", nil
+	case ConfigSecretModeEncrypted:
+		return common.EncryptWithKey(value, key)
+	}
+	return value, nil
+}
+
+func decodeConfigSecret(value string, secretMode string, key []byte) (string, error) {
+	if value == "" || secretMode != ConfigSecretModeEncrypted {
+		return value, nil
+	}
+	return common.DecryptWithKey(value, key)
+}
+
+func checkConfigSecretMode(secretMode string, passphrase string) error {
+	switch secretMode {
+	case ConfigSecretModePlain, ConfigSecretModeRedacted:
+		return nil
+	case ConfigSecretModeEncrypted:
+		if passphrase == "" {
+			return errors.New("加密导出或导入需要提供密码")
+		}
+		return nil
+	}
+	return fmt.Errorf("无效的敏感信息处理方式 %s", secretMode)
+}
+
+// ExportConfigDocument 导出当前配置，secretMode 决定渠道密钥和敏感设置项的导出方式
+func ExportConfigDocument(secretMode string, passphrase string) (*ConfigDocument, error) {
+	if err := checkConfigSecretMode(secretMode, passphrase); err != nil {
+		return nil, err
+	}
+	document := &ConfigDocument{
+		Version:    ConfigDocumentVersion,
+		ExportedAt: common.GetTimestamp(),
+		SecretMode: secretMode,
+		Options:    make(map[string]string),
+		Channels:   make([]ConfigChannel, 0),
+	}
+	secretKey, err := configSecretKey(document, passphrase, true)
+	if err != nil {
+		return nil, err
+	}
+	common.OptionMapRWMutex.RLock()
+	for key, value := range common.OptionMap {
+		document.Options[key] = value
+	}
+	common.OptionMapRWMutex.RUnlock()
+	for key, value := range document.Options {
+		if !IsSensitiveField(key) {
+			continue
+		}
+		encoded, err := encodeConfigSecret(value, secretMode, secretKey)
+		if err != nil {
+			return nil, err
+		}
+		document.Options[key] = encoded
+	}
+
+	var channels []*Channel
+	if err := DB.Order("id asc").Find(&channels).Error; err != nil {
+		return nil, err
+	}
+	for _, channel := range channels {
+		configChannel := newConfigChannel(channel)
+		key, err := encodeConfigSecret(configChannel.Key, secretMode, secretKey)
+		if err != nil {
+			return nil, err
+		}
+		configChannel.Key = key
+		document.Channels = append(document.Channels, configChannel)
+	}
+	return document, nil
+}
+
+// PlanConfigImport 校验配置文档并与当前配置对比，返回需要执行的变更。
+// 脱敏导出的空密钥表示保留现有值；文档中不存在的渠道和设置项保持不变
+func PlanConfigImport(document *ConfigDocument, passphrase string) ([]*ConfigChange, error) {
+	if document.Version == 0 {
+		return nil, errors.New("配置文档缺少版本号")
+	}
+	if document.Version > ConfigDocumentVersion {
+		return nil, fmt.Errorf("不支持的配置文档版本 %d，当前支持的最高版本为 %d", document.Version, ConfigDocumentVersion)
+	}
+	if document.SecretMode == "" {
+		document.SecretMode = ConfigSecretModePlain
+	}
+	if err := checkConfigSecretMode(document.SecretMode, passphrase); err != nil {
+		return nil, err
+	}
+	secretKey, err := configSecretKey(document, passphrase, false)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]*ConfigChange, 0)
+
+	common.OptionMapRWMutex.RLock()
+	currentOptions := make(map[string]string, len(common.OptionMap))
+	for key, value := range common.OptionMap {
+		currentOptions[key] = value
+	}
+	common.OptionMapRWMutex.RUnlock()
+	optionKeys := make([]string, 0, len(document.Options))
+	for key := range document.Options {
+		optionKeys = append(optionKeys, key)
+	}
+	sort.Strings(optionKeys)
+	for _, key := range optionKeys {
+		currentValue, ok := currentOptions[key]
+		if !ok {
+			return nil, fmt.Errorf("未知的设置项 %s", key)
+		}
+		value := document.Options[key]
+		if IsSensitiveField(key) {
+			if value == "" && document.SecretMode == ConfigSecretModeRedacted {
+				continue
+			}
+			decoded, err := decodeConfigSecret(value, document.SecretMode, secretKey)
+			if err != nil {
+				return nil, fmt.Errorf("设置项 %s 解密失败：%s", key, err.Error())
+			}
+			value = decoded
+		}
+		if value == currentValue {
+			continue
+		}
+		// 倍率等 JSON 格式的设置项需要保持为合法的 JSON
+		if common.IsJsonStr(currentValue) && !json.Valid([]byte(value)) {
+			return nil, fmt.Errorf("设置项 %s 不是合法的 JSON", key)
+		}
+		changes = append(changes, &ConfigChange{
+			Type:   ConfigChangeTypeOption,
+			Key:    key,
+			Action: AuditActionUpdate,
+			Diff:   ComputeAuditDiff(OptionAuditValues(key, currentValue, value)),
+			option: value,
+		})
+	}
+
+	var channels []*Channel
+	if err := DB.Find(&channels).Error; err != nil {
+		return nil, err
+	}
+	channelsByName := make(map[string][]*Channel)
+	for _, channel := range channels {
+		channelsByName[channel.Name] = append(channelsByName[channel.Name], channel)
+	}
+	seen := make(map[string]bool)
+	for i := range document.Channels {
+		configChannel := document.Channels[i]
+		if configChannel.Name == "" {
+			return nil, fmt.Errorf("第 %d 个渠道缺少名称", i+1)
+		}
+		if seen[configChannel.Name] {
+			return nil, fmt.Errorf("渠道名称 %s 重复", configChannel.Name)
+		}
+		seen[configChannel.Name] = true
+		if configChannel.Type <= 0 {
+			return nil, fmt.Errorf("渠道 %s 类型无效", configChannel.Name)
+		}
+		if configChannel.Group == "" || configChannel.Models == "" {
+			return nil, fmt.Errorf("渠道 %s 的分组和模型不能为空", configChannel.Name)
+		}
+		if !IsValidMultiKeyMode(configChannel.MultiKeyMode) {
+			return nil, fmt.Errorf("渠道 %s 的多密钥模式无效", configChannel.Name)
+		}
+		key, err := decodeConfigSecret(configChannel.Key, document.SecretMode, secretKey)
+		if err != nil {
+			return nil, fmt.Errorf("渠道 %s 密钥解密失败：%s", configChannel.Name, err.Error())
+		}
+		configChannel.Key = key
+
+		existing := channelsByName[configChannel.Name]
+		if len(existing) > 1 {
+			return nil, fmt.Errorf("存在多个名为 %s 的渠道，无法匹配", configChannel.Name)
+		}
+		if len(existing) == 0 {
+			if configChannel.Key == "" {
+				return nil, fmt.Errorf("新渠道 %s 缺少密钥", configChannel.Name)
+			}
+			channel := &Channel{CreatedTime: common.GetTimestamp()}
+			configChannel.apply(channel)
+			changes = append(changes, &ConfigChange{
+				Type:    ConfigChangeTypeChannel,
+				Key:     configChannel.Name,
+				Action:  AuditActionCreate,
+				Diff:    ComputeAuditDiff(nil, configChannel),
+				channel: channel,
+			})
+			continue
+		}
+		channel := existing[0]
+		if configChannel.Key == "" {
+			configChannel.Key = channel.Key
+		}
+		currentChannel := newConfigChannel(channel)
+		diff := ComputeAuditDiff(currentChannel, configChannel)
+		if len(diff) == 0 {
+			continue
+		}
+		configChannel.apply(channel)
+		changes = append(changes, &ConfigChange{
+			Type:    ConfigChangeTypeChannel,
+			Key:     configChannel.Name,
+			Action:  AuditActionUpdate,
+			Diff:    diff,
+			channel: channel,
+		})
+	}
+	return changes, nil
+}
+
+// configChannelFields 导入时写入的渠道字段，零值同样写入，余额、用量等运行数据保持不变
+var configChannelFields = []string{"Name", "Type", "Key", "Status", "Group", "Models", "BaseURL", "Other",
+	"OpenAIOrganization", "TestModel", "Weight", "Priority", "AutoBan", "Tag", "ModelMapping",
+	"StatusCodeMapping", "Setting", "ParamOverride", "MultiKeyMode"}
+
+// ApplyConfigChanges 在一个事务中执行 PlanConfigImport 返回的变更，任一变更失败时全部回滚。
+// 设置项在事务提交后才更新到配置管理器
+func ApplyConfigChanges(changes []*ConfigChange) error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		for _, change := range changes {
+			var err error
+			switch change.Type {
+			case ConfigChangeTypeOption:
+				err = saveOption(tx, change.Key, change.option)
+			case ConfigChangeTypeChannel:
+				if change.Action == AuditActionCreate {
+					err = tx.Create(change.channel).Error
+				} else {
+					err = tx.Model(change.channel).Select(configChannelFields).Updates(change.channel).Error
+				}
+				if err == nil {
+					err = change.channel.UpdateAbilities(tx)
+				}
+			}
+			if err != nil {
+				return fmt.Errorf("%s %s 导入失败：%s", change.Type, change.Key, err.Error())
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, change := range changes {
+		if change.Type != ConfigChangeTypeOption {
+			continue
+		}
+		if err = updateOptionMap(change.Key, change.option); err != nil {
+			return fmt.Errorf("%s %s 导入失败：%s", change.Type, change.Key, err.Error())
+		}
+	}
+	return nil
+}
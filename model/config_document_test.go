@@ -0,0 +1,144 @@
+package model
+
+import (
+	"one-api/common"
+	"strings"
+	"testing"
+)
+
+func setupConfigDocumentTest(t *testing.T) {
+	t.Helper()
+	setupTestDB(t, &Option{}, &Channel{}, &Ability{})
+	oldOptionMap := common.OptionMap
+	common.OptionMap = map[string]string{"ServerAddress": "https://old.example.com", "SMTPToken": "smtp-secret"}
+	t.Cleanup(func() { common.OptionMap = oldOptionMap })
+	other := "other"
+	channel := &Channel{Name: "c1", Type: 1, Key: "sk-channel", Group: "default", Models: "gpt-4o", Other: other, Status: common.ChannelStatusEnabled}
+	if err := channel.Insert(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfigDocumentEncryptedExport(t *testing.T) {
+	setupConfigDocumentTest(t)
+	document, err := ExportConfigDocument(ConfigSecretModeEncrypted, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if document.Kdf == nil || document.Kdf.Salt == "" {
+		t.Fatal("encrypted export has no key derivation header")
+	}
+	if document.Channels[0].Key == "sk-channel" || document.Options["SMTPToken"] == "smtp-secret" {
+		t.Fatal("secrets exported in plaintext")
+	}
+	if document.Options["ServerAddress"] != "https://old.example.com" {
+		t.Errorf("non-secret option changed: %q", document.Options["ServerAddress"])
+	}
+	data, err := MarshalConfigDocument(document, "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := UnmarshalConfigDocument(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		passphrase string
+		wantErr    bool
+	}{
+		{"right passphrase", "passphrase", false},
+		{"wrong passphrase", "wrong", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, err := PlanConfigImport(parsed, tt.passphrase)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("PlanConfigImport() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && len(changes) != 0 {
+				t.Errorf("unchanged document produced %d changes", len(changes))
+			}
+		})
+	}
+}
+
+func TestApplyConfigChangesIsIdempotent(t *testing.T) {
+	setupConfigDocumentTest(t)
+	document, err := ExportConfigDocument(ConfigSecretModePlain, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 清空字段和禁用渠道都是零值，同样需要写入
+	document.Channels[0].Other = ""
+	document.Channels[0].Status = 0
+	document.Channels[0].Models = "gpt-4o,gpt-4o-mini"
+	document.Options["ServerAddress"] = "https://new.example.com"
+
+	changes, err := PlanConfigImport(document, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("got %d changes, want 2", len(changes))
+	}
+	if err = ApplyConfigChanges(changes); err != nil {
+		t.Fatal(err)
+	}
+	var channel Channel
+	DB.First(&channel, "name = ?", "c1")
+	if channel.Other != "" || channel.Status != 0 || channel.Key != "sk-channel" {
+		t.Errorf("channel = other %q status %d key %q", channel.Other, channel.Status, channel.Key)
+	}
+	var abilities int64
+	DB.Model(&Ability{}).Where("channel_id = ?", channel.Id).Count(&abilities)
+	if abilities != 2 {
+		t.Errorf("abilities = %d, want 2", abilities)
+	}
+	if common.OptionMap["ServerAddress"] != "https://new.example.com" {
+		t.Errorf("option map not updated: %q", common.OptionMap["ServerAddress"])
+	}
+
+	changes, err = PlanConfigImport(document, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("second import produced %d changes", len(changes))
+	}
+}
+
+func TestApplyConfigChangesRollsBack(t *testing.T) {
+	setupConfigDocumentTest(t)
+	var existing Channel
+	DB.First(&existing)
+	document := &ConfigDocument{
+		Version: ConfigDocumentVersion,
+		Options: map[string]string{"ServerAddress": "https://new.example.com"},
+		Channels: []ConfigChannel{
+			{Name: "c2", Type: 1, Key: "sk-2", Group: "default", Models: "gpt-4o"},
+		},
+	}
+	changes, err := PlanConfigImport(document, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 新渠道与已有渠道 id 冲突，插入失败
+	for _, change := range changes {
+		if change.Type == ConfigChangeTypeChannel {
+			change.channel.Id = existing.Id
+		}
+	}
+	err = ApplyConfigChanges(changes)
+	if err == nil || !strings.Contains(err.Error(), "c2") {
+		t.Fatalf("error = %v, want channel c2 failure", err)
+	}
+	var option Option
+	if DB.First(&option, "key = ?", "ServerAddress").Error == nil {
+		t.Errorf("option saved despite rollback: %q", option.Value)
+	}
+	if common.OptionMap["ServerAddress"] != "https://old.example.com" {
+		t.Errorf("option map updated despite rollback: %q", common.OptionMap["ServerAddress"])
+	}
+}
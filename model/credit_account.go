@@ -0,0 +1,399 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/setting/operation_setting"
+	"sync"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+const (
+	BillingModePrepaid  = "prepaid"
+	BillingModePostpaid = "postpaid"
+)
+
+const (
+	CreditSuspendReasonLimitExceeded = "limit_exceeded"
+	CreditSuspendReasonOverdue       = "invoice_overdue"
+	CreditSuspendReasonManual        = "manual"
+)
+
+var creditSuspendReasonNames = map[string]string{
+	CreditSuspendReasonLimitExceeded: "已超出授信额度",
+	CreditSuspendReasonOverdue:       "存在逾期未付的账单",
+	CreditSuspendReasonManual:        "已被管理员暂停",
+}
+
+// CreditAccount 用户的计费方式，没有记录的用户为预付费。后付费用户的余额可以透支到 -CreditLimit，
+// 消费仍按预付费相同的方式扣减余额，每月账单中新增的欠款即为应付金额
+type CreditAccount struct {
+	Id          int    `json:"id"`
+	UserId      int    `json:"user_id" gorm:"uniqueIndex"`
+	BillingMode string `json:"billing_mode" gorm:"type:varchar(16);default:'prepaid'"`
+	// CreditLimit 授信额度
+	CreditLimit int `json:"credit_limit" gorm:"default:0"`
+	// PaymentTermDays 账单付款期限，为 0 时使用全局设置
+	PaymentTermDays int `json:"payment_term_days" gorm:"default:0"`
+	// NotifiedThreshold 已提醒的最高阈值，透支比例回落后随之降低，再次达到时重新提醒
+	NotifiedThreshold int    `json:"notified_threshold" gorm:"default:0"`
+	Suspended         bool   `json:"suspended" gorm:"default:false"`
+	SuspendReason     string `json:"suspend_reason" gorm:"type:varchar(32)"`
+	SuspendedTime     int64  `json:"suspended_time" gorm:"bigint"`
+	CreatedTime       int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime       int64  `json:"updated_time" gorm:"bigint"`
+}
+
+// CreditAccountChange RefreshCreditAccount 产生的需要通知用户的变化
+type CreditAccountChange struct {
+	// Threshold 新达到的提醒阈值，0 表示没有
+	Threshold int
+	Suspended bool
+	Resumed   bool
+}
+
+func (account *CreditAccount) IsPostpaid() bool {
+	return account.BillingMode == BillingModePostpaid
+}
+
+// OverdraftPercent 透支额度占授信额度的百分比
+func (account *CreditAccount) OverdraftPercent(quota int) int {
+	if quota >= 0 || account.CreditLimit <= 0 {
+		return 0
+	}
+	return int(int64(-quota) * 100 / int64(account.CreditLimit))
+}
+
+// NeedsRefresh 按缓存的账户状态判断余额变为 quota 后提醒阈值或超额暂停状态是否会变化，
+// 消费后只在需要时刷新账户，逾期等其他情况由定期检查处理
+func (account *CreditAccount) NeedsRefresh(quota int) bool {
+	if creditThreshold(account.OverdraftPercent(quota)) != account.NotifiedThreshold {
+		return true
+	}
+	if quota < -account.CreditLimit {
+		return !account.Suspended
+	}
+	return account.Suspended && account.SuspendReason == CreditSuspendReasonLimitExceeded
+}
+
+func (account *CreditAccount) GetPaymentTermDays() int {
+	if account.PaymentTermDays > 0 {
+		return account.PaymentTermDays
+	}
+	return operation_setting.GetCreditSetting().PaymentTermDays
+}
+
+// CreditSuspendReasonName 暂停原因的说明
+func CreditSuspendReasonName(reason string) string {
+	if name, ok := creditSuspendReasonNames[reason]; ok {
+		return name
+	}
+	return reason
+}
+
+func creditAccountCacheKey(userId int) string {
+	return fmt.Sprintf("credit_account:%d", userId)
+}
+
+const creditAccountMemoryCacheSize = 10000
+
+type creditAccountMemoryEntry struct {
+	account  CreditAccount
+	expireAt time.Time
+}
+
+// creditAccountMemoryCache 未启用 Redis 时的本地缓存，按同步频率过期
+var creditAccountMemoryCache = struct {
+	sync.RWMutex
+	entries map[int]creditAccountMemoryEntry
+}{entries: make(map[int]creditAccountMemoryEntry)}
+
+func getCreditAccountMemoryCache(userId int) (*CreditAccount, bool) {
+	creditAccountMemoryCache.RLock()
+	defer creditAccountMemoryCache.RUnlock()
+	entry, ok := creditAccountMemoryCache.entries[userId]
+	if !ok || time.Now().After(entry.expireAt) {
+		return nil, false
+	}
+	account := entry.account
+	return &account, true
+}
+
+func setCreditAccountMemoryCache(account *CreditAccount) {
+	now := time.Now()
+	creditAccountMemoryCache.Lock()
+	defer creditAccountMemoryCache.Unlock()
+	// 缓存条数达到上限时清理已过期的条目
+	if len(creditAccountMemoryCache.entries) >= creditAccountMemoryCacheSize {
+		for userId, entry := range creditAccountMemoryCache.entries {
+			if now.After(entry.expireAt) {
+				delete(creditAccountMemoryCache.entries, userId)
+			}
+		}
+	}
+	creditAccountMemoryCache.entries[account.UserId] = creditAccountMemoryEntry{
+		account:  *account,
+		expireAt: now.Add(time.Duration(common.SyncFrequency) * time.Second),
+	}
+}
+
+func invalidateCreditAccountCache(userId int) {
+	if !common.RedisEnabled {
+		creditAccountMemoryCache.Lock()
+		delete(creditAccountMemoryCache.entries, userId)
+		creditAccountMemoryCache.Unlock()
+		return
+	}
+	if err := common.RedisDel(creditAccountCacheKey(userId)); err != nil {
+		common.SysError("failed to delete credit account cache: " + err.Error())
+	}
+}
+
+func getCreditAccountFromDB(userId int) (*CreditAccount, error) {
+	account := &CreditAccount{}
+	err := DB.Where("user_id = ?", userId).Limit(1).Find(account).Error
+	if err != nil {
+		return nil, err
+	}
+	if account.Id == 0 {
+		account.UserId = userId
+		account.BillingMode = BillingModePrepaid
+	}
+	return account, nil
+}
+
+// GetCreditAccount 获取用户的计费方式，启用 Redis 时缓存在 Redis 中，否则缓存在本地内存，预付费用户也会缓存以减少查询
+func GetCreditAccount(userId int) (*CreditAccount, error) {
+	cacheKey := creditAccountCacheKey(userId)
+	if !common.RedisEnabled {
+		if account, ok := getCreditAccountMemoryCache(userId); ok {
+			return account, nil
+		}
+	} else {
+		if value, err := common.RedisGet(cacheKey); err == nil {
+			account := &CreditAccount{}
+			if json.Unmarshal([]byte(value), account) == nil {
+				return account, nil
+			}
+		}
+	}
+	account, err := getCreditAccountFromDB(userId)
+	if err != nil {
+		return nil, err
+	}
+	if !common.RedisEnabled {
+		setCreditAccountMemoryCache(account)
+	} else {
+		data, _ := json.Marshal(account)
+		err = common.RedisSet(cacheKey, string(data), time.Duration(constant.UserId2QuotaCacheSeconds)*time.Second)
+		if err != nil {
+			common.SysError("failed to set credit account cache: " + err.Error())
+		}
+	}
+	return account, nil
+}
+
+// CheckCreditAccount 检查后付费账户是否已被暂停
+func CheckCreditAccount(userId int) error {
+	account, err := GetCreditAccount(userId)
+	if err != nil {
+		return err
+	}
+	if account.Suspended {
+		return fmt.Errorf("账户已暂停使用：%s", CreditSuspendReasonName(account.SuspendReason))
+	}
+	return nil
+}
+
+// SaveCreditAccount 设置用户的计费方式、授信额度和付款期限，不存在时创建
+func SaveCreditAccount(account *CreditAccount) error {
+	if account.BillingMode != BillingModePrepaid && account.BillingMode != BillingModePostpaid {
+		return errors.New("无效的计费方式")
+	}
+	if account.CreditLimit < 0 || account.PaymentTermDays < 0 {
+		return errors.New("授信额度和付款期限不能为负数")
+	}
+	now := common.GetTimestamp()
+	account.CreatedTime = now
+	account.UpdatedTime = now
+	err := DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"billing_mode", "credit_limit", "payment_term_days", "updated_time"}),
+	}).Create(account).Error
+	invalidateCreditAccountCache(account.UserId)
+	return err
+}
+
+// GetCreditAccounts 查询有计费方式记录的账户，mode 为空时不限
+func GetCreditAccounts(mode string, startIdx int, num int) (accounts []*CreditAccount, total int64, err error) {
+	tx := DB.Model(&CreditAccount{})
+	if mode != "" {
+		tx = tx.Where("billing_mode = ?", mode)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&accounts).Error
+	return accounts, total, err
+}
+
+// setCreditAccountSuspended 以当前状态为条件更新暂停状态，并发刷新时只有一个能生效。reason 为空表示恢复
+func setCreditAccountSuspended(account *CreditAccount, reason string) (bool, error) {
+	updates := map[string]interface{}{
+		"suspended":      reason != "",
+		"suspend_reason": reason,
+		"updated_time":   common.GetTimestamp(),
+	}
+	if reason != "" {
+		updates["suspended_time"] = common.GetTimestamp()
+	}
+	result := DB.Model(&CreditAccount{}).
+		Where("user_id = ? AND suspended = ? AND suspend_reason = ?", account.UserId, account.Suspended, account.SuspendReason).
+		Updates(updates)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+	invalidateCreditAccountCache(account.UserId)
+	if reason != "" {
+		RecordLog(account.UserId, LogTypeManage, fmt.Sprintf("账户已暂停使用：%s", CreditSuspendReasonName(reason)))
+	} else {
+		RecordLog(account.UserId, LogTypeManage, "账户已恢复使用")
+	}
+	return true, nil
+}
+
+// SuspendCreditAccount 管理员手动暂停账户，手动暂停不会被自动恢复
+func SuspendCreditAccount(userId int) error {
+	account, err := getCreditAccountFromDB(userId)
+	if err != nil {
+		return err
+	}
+	if account.Id == 0 {
+		return errors.New("该用户没有设置计费方式")
+	}
+	if account.Suspended && account.SuspendReason == CreditSuspendReasonManual {
+		return nil
+	}
+	ok, err := setCreditAccountSuspended(account, CreditSuspendReasonManual)
+	if err == nil && !ok {
+		err = errors.New("账户状态已变化，请重试")
+	}
+	return err
+}
+
+// ResumeCreditAccount 管理员恢复账户，之后按当前余额和账单重新判断是否需要自动暂停
+func ResumeCreditAccount(userId int) (*CreditAccount, *CreditAccountChange, error) {
+	account, err := getCreditAccountFromDB(userId)
+	if err != nil {
+		return nil, nil, err
+	}
+	if account.Suspended {
+		if _, err = setCreditAccountSuspended(account, ""); err != nil {
+			return nil, nil, err
+		}
+	}
+	return RefreshCreditAccount(userId, true)
+}
+
+// creditThreshold 返回透支比例已达到的最高提醒阈值
+func creditThreshold(percent int) int {
+	threshold := 0
+	for _, value := range operation_setting.GetCreditSetting().NotifyThresholds {
+		if value > 0 && percent >= value && value > threshold {
+			threshold = value
+		}
+	}
+	return threshold
+}
+
+// hasOverdueBillingStatements 用户是否有已过付款期限仍未付款的账单
+func hasOverdueBillingStatements(userId int) (bool, error) {
+	var count int64
+	err := DB.Model(&BillingStatement{}).
+		Where("user_id = ? AND payment_status = ? AND due_time > 0 AND due_time < ?", userId, BillingStatementPaymentUnpaid, common.GetTimestamp()).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// RefreshCreditAccount 根据当前余额更新后付费账户的提醒阈值和暂停状态，checkOverdue 为 true 时同时检查逾期账单，
+// 否则保持已有的逾期暂停。自动暂停的原因消除后自动恢复，手动暂停需要管理员恢复
+func RefreshCreditAccount(userId int, checkOverdue bool) (*CreditAccount, *CreditAccountChange, error) {
+	change := &CreditAccountChange{}
+	account, err := getCreditAccountFromDB(userId)
+	if err != nil || account.Id == 0 {
+		return account, change, err
+	}
+	reason := ""
+	if account.IsPostpaid() {
+		quota, err := GetUserQuota(userId, false)
+		if err != nil {
+			return nil, nil, err
+		}
+		threshold := creditThreshold(account.OverdraftPercent(quota))
+		if threshold != account.NotifiedThreshold {
+			result := DB.Model(&CreditAccount{}).Where("user_id = ? AND notified_threshold = ?", userId, account.NotifiedThreshold).
+				Update("notified_threshold", threshold)
+			if result.Error != nil {
+				return nil, nil, result.Error
+			}
+			if result.RowsAffected > 0 {
+				if threshold > account.NotifiedThreshold {
+					change.Threshold = threshold
+				}
+				account.NotifiedThreshold = threshold
+				invalidateCreditAccountCache(userId)
+			}
+		}
+		if quota < -account.CreditLimit {
+			reason = CreditSuspendReasonLimitExceeded
+		} else if checkOverdue {
+			if operation_setting.GetCreditSetting().SuspendOnOverdue {
+				overdue, err := hasOverdueBillingStatements(userId)
+				if err != nil {
+					return nil, nil, err
+				}
+				if overdue {
+					reason = CreditSuspendReasonOverdue
+				}
+			}
+		} else if account.Suspended && account.SuspendReason == CreditSuspendReasonOverdue {
+			reason = CreditSuspendReasonOverdue
+		}
+	}
+	if account.Suspended && account.SuspendReason == CreditSuspendReasonManual {
+		return account, change, nil
+	}
+	if reason == account.SuspendReason && account.Suspended == (reason != "") {
+		return account, change, nil
+	}
+	ok, err := setCreditAccountSuspended(account, reason)
+	if err != nil || !ok {
+		return account, change, err
+	}
+	change.Suspended = reason != ""
+	change.Resumed = reason == ""
+	account.Suspended = reason != ""
+	account.SuspendReason = reason
+	return account, change, nil
+}
+
+// GetCreditCheckUserIds 需要定期检查的账户：后付费账户和被暂停的账户
+func GetCreditCheckUserIds() ([]int, error) {
+	var userIds []int
+	err := DB.Model(&CreditAccount{}).Where("billing_mode = ? OR suspended = ?", BillingModePostpaid, true).
+		Pluck("user_id", &userIds).Error
+	return userIds, err
+}
+
+// getCreditOutstanding 用户在 period 之前的账单中尚未付款的金额
+func getCreditOutstanding(userId int, period string) (int64, error) {
+	var outstanding int64
+	err := DB.Model(&BillingStatement{}).Where("user_id = ? AND period < ? AND payment_status = ?", userId, period, BillingStatementPaymentUnpaid).
+		Select("COALESCE(SUM(amount_due), 0)").Scan(&outstanding).Error
+	return outstanding, err
+}
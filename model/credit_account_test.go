@@ -0,0 +1,86 @@
+package model
+
+import (
+	"one-api/common"
+	"testing"
+	"time"
+)
+
+func TestCreditAccountNeedsRefresh(t *testing.T) {
+	// 默认提醒阈值为 50%、80%、100%
+	tests := []struct {
+		name    string
+		account CreditAccount
+		quota   int
+		want    bool
+	}{
+		{"positive balance", CreditAccount{CreditLimit: 1000}, 500, false},
+		{"below first threshold", CreditAccount{CreditLimit: 1000}, -400, false},
+		{"reaches first threshold", CreditAccount{CreditLimit: 1000}, -500, true},
+		{"threshold already notified", CreditAccount{CreditLimit: 1000, NotifiedThreshold: 50}, -600, false},
+		{"threshold falls after top-up", CreditAccount{CreditLimit: 1000, NotifiedThreshold: 80}, -100, true},
+		{"exceeds limit", CreditAccount{CreditLimit: 1000, NotifiedThreshold: 100}, -1001, true},
+		{"already suspended over limit", CreditAccount{CreditLimit: 1000, NotifiedThreshold: 100, Suspended: true, SuspendReason: CreditSuspendReasonLimitExceeded}, -1200, false},
+		{"manually suspended over limit", CreditAccount{CreditLimit: 1000, NotifiedThreshold: 100, Suspended: true, SuspendReason: CreditSuspendReasonManual}, -1200, false},
+		{"back under limit", CreditAccount{CreditLimit: 1000, NotifiedThreshold: 100, Suspended: true, SuspendReason: CreditSuspendReasonLimitExceeded}, -1000, true},
+		{"overdue suspension is left to periodic check", CreditAccount{CreditLimit: 1000, Suspended: true, SuspendReason: CreditSuspendReasonOverdue}, -100, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.account.NeedsRefresh(tt.quota); got != tt.want {
+				t.Errorf("NeedsRefresh(%d) = %v, want %v", tt.quota, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetCreditAccountMemoryCache(t *testing.T) {
+	db := setupTestDB(t, &CreditAccount{}, &User{}, &Log{})
+	oldSyncFrequency := common.SyncFrequency
+	common.SyncFrequency = 60
+	t.Cleanup(func() { common.SyncFrequency = oldSyncFrequency })
+	if err := SaveCreditAccount(&CreditAccount{UserId: 1, BillingMode: BillingModePostpaid, CreditLimit: 1000}); err != nil {
+		t.Fatal(err)
+	}
+	account, err := GetCreditAccount(1)
+	if err != nil || !account.IsPostpaid() || account.CreditLimit != 1000 {
+		t.Fatalf("account = %+v, err = %v", account, err)
+	}
+	// 未启用 Redis 时命中本地缓存，不再查询数据库；返回的是副本，修改不影响缓存
+	db.Model(&CreditAccount{}).Where("user_id = ?", 1).Update("credit_limit", 2000)
+	account.CreditLimit = 0
+	if cached, _ := GetCreditAccount(1); cached.CreditLimit != 1000 {
+		t.Errorf("cached credit limit = %d, want 1000", cached.CreditLimit)
+	}
+
+	// 通过 model 修改账户后缓存失效
+	if err := SuspendCreditAccount(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckCreditAccount(1); err == nil {
+		t.Error("suspended account passed the check")
+	}
+	if err := SaveCreditAccount(&CreditAccount{UserId: 1, BillingMode: BillingModePostpaid, CreditLimit: 3000}); err != nil {
+		t.Fatal(err)
+	}
+	if cached, _ := GetCreditAccount(1); cached.CreditLimit != 3000 {
+		t.Errorf("credit limit after save = %d, want 3000", cached.CreditLimit)
+	}
+
+	// 没有记录的用户按预付费缓存，过期后重新查询
+	if account, _ := GetCreditAccount(2); account.IsPostpaid() {
+		t.Errorf("account without record = %+v", account)
+	}
+	db.Create(&CreditAccount{UserId: 2, BillingMode: BillingModePostpaid})
+	if account, _ := GetCreditAccount(2); account.IsPostpaid() {
+		t.Error("cache entry not used before expiry")
+	}
+	creditAccountMemoryCache.Lock()
+	entry := creditAccountMemoryCache.entries[2]
+	entry.expireAt = time.Now().Add(-time.Second)
+	creditAccountMemoryCache.entries[2] = entry
+	creditAccountMemoryCache.Unlock()
+	if account, _ := GetCreditAccount(2); !account.IsPostpaid() {
+		t.Error("expired cache entry still used")
+	}
+}
@@ -0,0 +1,70 @@
+package model
+
+import (
+	"one-api/dto"
+)
+
+// File 通过 /v1/files 上传的文件，内容直接存储在数据库中，归属于上传它的用户和令牌
+type File struct {
+	Id        int    `json:"-"`
+	FileId    string `json:"id" gorm:"type:varchar(64);uniqueIndex"`
+	UserId    int    `json:"user_id" gorm:"index"`
+	TokenId   int    `json:"token_id" gorm:"index"`
+	Purpose   string `json:"purpose" gorm:"type:varchar(32);index"`
+	Filename  string `json:"filename"`
+	Bytes     int64  `json:"bytes"`
+	Status    string `json:"status" gorm:"type:varchar(20)"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint"`
+	Content   []byte `json:"-"`
+}
+
+func (file *File) ToOpenAIFile() dto.OpenAIFile {
+	return dto.OpenAIFile{
+		ID:        file.FileId,
+		Object:    "file",
+		Bytes:     file.Bytes,
+		CreatedAt: file.CreatedAt,
+		Filename:  file.Filename,
+		Purpose:   file.Purpose,
+		Status:    file.Status,
+	}
+}
+
+func (file *File) Insert() error {
+	return DB.Create(file).Error
+}
+
+// UpdateContent 更新文件内容，批处理执行过程中用于保存输出文件的进度
+func (file *File) UpdateContent(content []byte) error {
+	file.Content = content
+	file.Bytes = int64(len(content))
+	return DB.Model(file).Select("content", "bytes", "status").Updates(file).Error
+}
+
+func GetUserFiles(userId int, tokenId int, purpose string, limit int) (files []*File, err error) {
+	query := DB.Omit("content").Where("user_id = ? and token_id = ?", userId, tokenId)
+	if purpose != "" {
+		query = query.Where("purpose = ?", purpose)
+	}
+	err = query.Order("id desc").Limit(limit).Find(&files).Error
+	return files, err
+}
+
+// GetUserFileById 获取文件信息（不包含内容）
+func GetUserFileById(fileId string, userId int, tokenId int) (*File, error) {
+	file := &File{}
+	err := DB.Omit("content").Where("file_id = ? and user_id = ? and token_id = ?", fileId, userId, tokenId).First(file).Error
+	return file, err
+}
+
+// GetUserFileContentById 获取文件信息及内容
+func GetUserFileContentById(fileId string, userId int, tokenId int) (*File, error) {
+	file := &File{}
+	err := DB.Where("file_id = ? and user_id = ? and token_id = ?", fileId, userId, tokenId).First(file).Error
+	return file, err
+}
+
+func DeleteUserFileById(fileId string, userId int, tokenId int) (int64, error) {
+	result := DB.Where("file_id = ? and user_id = ? and token_id = ?", fileId, userId, tokenId).Delete(&File{})
+	return result.RowsAffected, result.Error
+}
@@ -15,8 +15,9 @@ import (
 	"gorm.io/gorm"
 )
 
-var groupCol string
-var keyCol string
+// 默认为 MySQL 和 SQLite 的写法，连接数据库时由 initCol 按数据库类型设置
+var groupCol = "`group`"
+var keyCol = "`key`"
 
 func initCol() {
 	if common.UsingPostgreSQL {
@@ -214,7 +215,7 @@ func migrateDB() error {
 	if err != nil {
 		return err
 	}
-	err = DB.AutoMigrate(&Redemption{})
+	err = DB.AutoMigrate(&Redemption{}, &RedemptionCampaign{}, &RedemptionRecord{})
 	if err != nil {
 		return err
 	}
@@ -226,11 +227,23 @@ func migrateDB() error {
 	if err != nil {
 		return err
 	}
+	err = DB.AutoMigrate(&ModerationLog{})
+	if err != nil {
+		return err
+	}
+	err = DB.AutoMigrate(&TwoFactor{})
+	if err != nil {
+		return err
+	}
+	err = DB.AutoMigrate(&AuditLog{})
+	if err != nil {
+		return err
+	}
 	err = DB.AutoMigrate(&Midjourney{})
 	if err != nil {
 		return err
 	}
-	err = DB.AutoMigrate(&TopUp{})
+	err = DB.AutoMigrate(&TopUp{}, &TopUpEvent{})
 	if err != nil {
 		return err
 	}
@@ -242,6 +255,42 @@ func migrateDB() error {
 	if err != nil {
 		return err
 	}
+	err = DB.AutoMigrate(&File{}, &BatchResult{})
+	if err != nil {
+		return err
+	}
+	err = DB.AutoMigrate(&TaskCallback{})
+	if err != nil {
+		return err
+	}
+	err = DB.AutoMigrate(&TokenBudgetUsage{})
+	if err != nil {
+		return err
+	}
+	err = DB.AutoMigrate(&Organization{}, &OrganizationMember{})
+	if err != nil {
+		return err
+	}
+	err = DB.AutoMigrate(&SecretMigration{})
+	if err != nil {
+		return err
+	}
+	err = DB.AutoMigrate(&AdminApiKey{}, &AdminApiKeyLog{})
+	if err != nil {
+		return err
+	}
+	err = hashAdminApiKeys()
+	if err != nil {
+		return err
+	}
+	err = DB.AutoMigrate(&BillingStatement{}, &BillingInvoiceSequence{})
+	if err != nil {
+		return err
+	}
+	err = DB.AutoMigrate(&CreditAccount{})
+	if err != nil {
+		return err
+	}
 	err = DB.AutoMigrate(&Setup{})
 	common.SysLog("database migrated")
 	//err = createRootAccountIfNeed()
@@ -253,6 +302,12 @@ func migrateLOGDB() error {
 	if err = LOG_DB.AutoMigrate(&Log{}); err != nil {
 		return err
 	}
+	if err = LOG_DB.AutoMigrate(&ModerationLog{}); err != nil {
+		return err
+	}
+	if err = LOG_DB.AutoMigrate(&AuditLog{}); err != nil {
+		return err
+	}
 	return nil
 }
 
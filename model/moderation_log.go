@@ -0,0 +1,79 @@
+package model
+
+import (
+	"one-api/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ModerationLog 内容审核命中记录
+type ModerationLog struct {
+	Id        int    `json:"id"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint;index"`
+	UserId    int    `json:"user_id" gorm:"index"`
+	Username  string `json:"username" gorm:"index;default:''"`
+	TokenId   int    `json:"token_id" gorm:"default:0;index"`
+	TokenName string `json:"token_name" gorm:"default:''"`
+	Group     string `json:"group" gorm:"default:''"`
+	ModelName string `json:"model_name" gorm:"index;default:''"`
+	ChannelId int    `json:"channel" gorm:"default:0"`
+	RequestId string `json:"request_id" gorm:"type:varchar(64);default:''"`
+	// Stage prompt 或 completion
+	Stage    string `json:"stage" gorm:"type:varchar(16);index"`
+	Rule     string `json:"rule" gorm:"default:''"`
+	Provider string `json:"provider" gorm:"type:varchar(16)"`
+	Action   string `json:"action" gorm:"type:varchar(16);index"`
+	// Matches 命中的关键词、正则片段或审核分类，JSON 数组
+	Matches string `json:"matches" gorm:"type:text"`
+	// Content 被审核的内容，超过长度限制时截断
+	Content string `json:"content" gorm:"type:text"`
+}
+
+const moderationLogContentMaxLength = 2000
+
+// RecordModerationLog 记录审核命中，用户和令牌信息从请求上下文获取
+func RecordModerationLog(c *gin.Context, log *ModerationLog) {
+	log.CreatedAt = common.GetTimestamp()
+	log.UserId = c.GetInt("id")
+	log.Username = c.GetString("username")
+	log.TokenId = c.GetInt("token_id")
+	log.TokenName = c.GetString("token_name")
+	log.Group = c.GetString("group")
+	log.ChannelId = c.GetInt("channel_id")
+	log.RequestId = c.GetString(common.RequestIdKey)
+	if runes := []rune(log.Content); len(runes) > moderationLogContentMaxLength {
+		log.Content = string(runes[:moderationLogContentMaxLength])
+	}
+	if err := LOG_DB.Create(log).Error; err != nil {
+		common.LogError(c, "failed to record moderation log: "+err.Error())
+	}
+}
+
+func GetModerationLogs(startIdx int, num int, username string, modelName string, stage string, action string,
+	startTimestamp int64, endTimestamp int64) (logs []*ModerationLog, total int64, err error) {
+	tx := LOG_DB.Model(&ModerationLog{})
+	if username != "" {
+		tx = tx.Where("username = ?", username)
+	}
+	if modelName != "" {
+		tx = tx.Where("model_name = ?", modelName)
+	}
+	if stage != "" {
+		tx = tx.Where("stage = ?", stage)
+	}
+	if action != "" {
+		tx = tx.Where("action = ?", action)
+	}
+	if startTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", endTimestamp)
+	}
+	err = tx.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&logs).Error
+	return logs, total, err
+}
@@ -8,6 +8,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 type Option struct {
@@ -134,7 +136,12 @@ func InitOptionMap() {
 func loadOptionsFromDatabase() {
 	options, _ := AllOption()
 	for _, option := range options {
-		err := updateOptionMap(option.Key, option.Value)
+		value, err := DecryptSecret(option.Value)
+		if err != nil {
+			common.SysError("failed to decrypt option " + option.Key + ": " + err.Error())
+			continue
+		}
+		err = updateOptionMap(option.Key, value)
 		if err != nil {
 			common.SysError("failed to update option map: " + err.Error())
 		}
@@ -151,18 +158,36 @@ func SyncOptions(frequency int) {
 
 func UpdateOption(key string, value string) error {
 	// Save to database first
+	err := saveOption(DB, key, value)
+	if err != nil {
+		return err
+	}
+	// Update OptionMap
+	return updateOptionMap(key, value)
+}
+
+// saveOption 只写入数据库，不更新内存中的设置，敏感设置项加密保存
+func saveOption(tx *gorm.DB, key string, value string) error {
 	option := Option{
 		Key: key,
 	}
 	// https://gorm.io/docs/update.html#Save-All-Fields
-	DB.FirstOrCreate(&option, Option{Key: key})
+	err := tx.FirstOrCreate(&option, Option{Key: key}).Error
+	if err != nil {
+		return err
+	}
 	option.Value = value
+	if IsSensitiveField(key) {
+		encrypted, err := EncryptSecret(value)
+		if err != nil {
+			return err
+		}
+		option.Value = encrypted
+	}
 	// Save is a combination function.
 	// If save value does not contain primary key, it will execute Create,
 	// otherwise it will execute Update (with all fields).
-	DB.Save(&option)
-	// Update OptionMap
-	return updateOptionMap(key, value)
+	return tx.Save(&option).Error
 }
 
 func updateOptionMap(key string, value string) (err error) {
@@ -0,0 +1,233 @@
+package model
+
+import (
+	"errors"
+	"one-api/common"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"gorm.io/gorm"
+)
+
+// Organization 组织，成员可以创建组织令牌，组织令牌的消耗从组织共享额度中扣除
+type Organization struct {
+	Id          int            `json:"id"`
+	Name        string         `json:"name" gorm:"type:varchar(64);index"`
+	Description string         `json:"description" gorm:"type:varchar(255);default:''"`
+	Status      int            `json:"status" gorm:"default:1"`
+	Quota       int            `json:"quota" gorm:"default:0"`
+	UsedQuota   int            `json:"used_quota" gorm:"default:0"`
+	OwnerId     int            `json:"owner_id" gorm:"index"`
+	CreatedTime int64          `json:"created_time" gorm:"bigint"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+type OrganizationMember struct {
+	Id          int   `json:"id"`
+	OrgId       int   `json:"org_id" gorm:"uniqueIndex:idx_org_member"`
+	UserId      int   `json:"user_id" gorm:"uniqueIndex:idx_org_member;index"`
+	Role        int   `json:"role" gorm:"default:1"`
+	CreatedTime int64 `json:"created_time" gorm:"bigint"`
+}
+
+// OrganizationMemberInfo 成员列表返回的成员信息
+type OrganizationMemberInfo struct {
+	OrganizationMember
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+}
+
+// UserOrganization 用户所在的组织及其角色
+type UserOrganization struct {
+	Organization
+	Role int `json:"role"`
+}
+
+func GetAllOrganizations(startIdx int, num int) (orgs []*Organization, total int64, err error) {
+	err = DB.Model(&Organization{}).Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	err = DB.Order("id desc").Limit(num).Offset(startIdx).Find(&orgs).Error
+	return orgs, total, err
+}
+
+func GetOrganizationById(id int) (*Organization, error) {
+	if id == 0 {
+		return nil, errors.New("id 为空！")
+	}
+	org := Organization{}
+	err := DB.First(&org, "id = ?", id).Error
+	return &org, err
+}
+
+func GetUserOrganizations(userId int) (orgs []*UserOrganization, err error) {
+	err = DB.Table("organizations").
+		Select("organizations.*, organization_members.role").
+		Joins("join organization_members on organization_members.org_id = organizations.id").
+		Where("organization_members.user_id = ? and organizations.deleted_at is null", userId).
+		Order("organizations.id desc").
+		Scan(&orgs).Error
+	return orgs, err
+}
+
+// Insert 创建组织并将 OwnerId 对应的用户加入为 owner
+func (org *Organization) Insert() error {
+	org.CreatedTime = common.GetTimestamp()
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(org).Error; err != nil {
+			return err
+		}
+		return tx.Create(&OrganizationMember{
+			OrgId:       org.Id,
+			UserId:      org.OwnerId,
+			Role:        common.OrgRoleOwner,
+			CreatedTime: org.CreatedTime,
+		}).Error
+	})
+}
+
+func (org *Organization) Update() error {
+	err := DB.Model(org).Select("name", "description", "status", "quota").Updates(org).Error
+	invalidateOrgCache(org.Id)
+	return err
+}
+
+// Delete 删除组织及其成员关系，组织令牌随之失效
+func (org *Organization) Delete() error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("org_id = ?", org.Id).Delete(&OrganizationMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(org).Error
+	})
+	invalidateOrgCache(org.Id)
+	return err
+}
+
+func GetOrganizationMembers(orgId int) (members []*OrganizationMemberInfo, err error) {
+	err = DB.Table("organization_members").
+		Select("organization_members.*, users.username, users.display_name").
+		Joins("left join users on users.id = organization_members.user_id").
+		Where("organization_members.org_id = ?", orgId).
+		Order("organization_members.role desc, organization_members.id").
+		Scan(&members).Error
+	return members, err
+}
+
+// GetOrgMemberRole 返回用户在组织中的角色，不是成员时返回错误
+func GetOrgMemberRole(orgId int, userId int) (int, error) {
+	var member OrganizationMember
+	err := DB.Where("org_id = ? and user_id = ?", orgId, userId).First(&member).Error
+	if err != nil {
+		return 0, err
+	}
+	return member.Role, nil
+}
+
+func AddOrganizationMember(orgId int, userId int, role int) error {
+	if _, err := GetOrgMemberRole(orgId, userId); err == nil {
+		return errors.New("该用户已是组织成员")
+	}
+	return DB.Create(&OrganizationMember{
+		OrgId:       orgId,
+		UserId:      userId,
+		Role:        role,
+		CreatedTime: common.GetTimestamp(),
+	}).Error
+}
+
+func UpdateOrganizationMemberRole(orgId int, userId int, role int) error {
+	err := DB.Model(&OrganizationMember{}).Where("org_id = ? and user_id = ?", orgId, userId).Update("role", role).Error
+	invalidateOrgMemberCache(orgId, userId)
+	return err
+}
+
+func RemoveOrganizationMember(orgId int, userId int) error {
+	err := DB.Where("org_id = ? and user_id = ?", orgId, userId).Delete(&OrganizationMember{}).Error
+	invalidateOrgMemberCache(orgId, userId)
+	return err
+}
+
+// ValidateOrgToken 校验组织令牌所属组织可用且令牌所有者仍是组织成员，组织状态和成员关系启用 Redis 时从缓存读取
+func ValidateOrgToken(orgId int, userId int) error {
+	org, err := GetOrganizationCache(orgId)
+	if err != nil {
+		return errors.New("令牌所属组织不存在")
+	}
+	if org.Status != common.OrganizationStatusEnabled {
+		return errors.New("令牌所属组织已被禁用")
+	}
+	if _, err = getOrgMemberRoleCache(orgId, userId); err != nil {
+		return errors.New("令牌所有者已不是组织成员")
+	}
+	return nil
+}
+
+// GetOrgQuota 获取组织余额，与用户余额相同，启用 Redis 时优先读取缓存
+func GetOrgQuota(orgId int, fromDB bool) (quota int, err error) {
+	if !fromDB && common.RedisEnabled {
+		if org, err := GetOrganizationCache(orgId); err == nil {
+			return org.Quota, nil
+		}
+	}
+	err = DB.Model(&Organization{}).Where("id = ?", orgId).Select("quota").Find(&quota).Error
+	return quota, err
+}
+
+// IncreaseOrgQuota 与 IncreaseUserQuota 相同，同步更新缓存，开启批量更新时合并写入数据库
+func IncreaseOrgQuota(orgId int, quota int) error {
+	if quota < 0 {
+		return errors.New("quota 不能为负数！")
+	}
+	return deltaUpdateOrgQuota(orgId, quota)
+}
+
+func DecreaseOrgQuota(orgId int, quota int) error {
+	if quota < 0 {
+		return errors.New("quota 不能为负数！")
+	}
+	return deltaUpdateOrgQuota(orgId, -quota)
+}
+
+func deltaUpdateOrgQuota(orgId int, delta int) error {
+	gopool.Go(func() {
+		if err := cacheIncrOrgQuota(orgId, int64(delta)); err != nil {
+			common.SysError("failed to update organization quota cache: " + err.Error())
+		}
+	})
+	if common.BatchUpdateEnabled {
+		addNewRecord(BatchUpdateTypeOrgQuota, orgId, delta)
+		return nil
+	}
+	return updateOrgQuota(orgId, delta)
+}
+
+// updateOrgQuota 调整组织余额，同时反向调整已用额度，退款时已用额度随之减少
+func updateOrgQuota(orgId int, delta int) error {
+	return DB.Model(&Organization{}).Where("id = ?", orgId).Updates(map[string]interface{}{
+		"quota":      gorm.Expr("quota + ?", delta),
+		"used_quota": gorm.Expr("used_quota - ?", delta),
+	}).Error
+}
+
+// GetBillingQuota 返回请求计费主体的余额，组织令牌使用组织额度
+func GetBillingQuota(userId int, orgId int) (int, error) {
+	if orgId != 0 {
+		return GetOrgQuota(orgId, false)
+	}
+	return GetUserQuota(userId, false)
+}
+
+func DecreaseBillingQuota(userId int, orgId int, quota int) error {
+	if orgId == 0 {
+		return DecreaseUserQuota(userId, quota)
+	}
+	return DecreaseOrgQuota(orgId, quota)
+}
+
+func IncreaseBillingQuota(userId int, orgId int, quota int) error {
+	if orgId == 0 {
+		return IncreaseUserQuota(userId, quota, false)
+	}
+	return IncreaseOrgQuota(orgId, quota)
+}
@@ -0,0 +1,106 @@
+package model
+
+import (
+	"fmt"
+	"one-api/common"
+	"strconv"
+	"time"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// OrganizationBase 组织令牌鉴权和计费使用的组织缓存
+type OrganizationBase struct {
+	Id     int `json:"id"`
+	Status int `json:"status"`
+	Quota  int `json:"quota"`
+}
+
+func getOrgCacheKey(orgId int) string {
+	return fmt.Sprintf("org:%d", orgId)
+}
+
+func getOrgMemberCacheKey(orgId int, userId int) string {
+	return fmt.Sprintf("org_member:%d:%d", orgId, userId)
+}
+
+func invalidateOrgCache(orgId int) {
+	if !common.RedisEnabled {
+		return
+	}
+	if err := common.RedisDel(getOrgCacheKey(orgId)); err != nil {
+		common.SysError("failed to delete organization cache: " + err.Error())
+	}
+}
+
+func invalidateOrgMemberCache(orgId int, userId int) {
+	if !common.RedisEnabled {
+		return
+	}
+	if err := common.RedisDel(getOrgMemberCacheKey(orgId, userId)); err != nil {
+		common.SysError("failed to delete organization member cache: " + err.Error())
+	}
+}
+
+func updateOrgCache(org *Organization) error {
+	if !common.RedisEnabled {
+		return nil
+	}
+	return common.RedisHSetObj(
+		getOrgCacheKey(org.Id),
+		&OrganizationBase{Id: org.Id, Status: org.Status, Quota: org.Quota},
+		time.Duration(common.SyncFrequency)*time.Second,
+	)
+}
+
+// GetOrganizationCache 获取组织状态和余额，启用 Redis 时优先读取缓存
+func GetOrganizationCache(orgId int) (orgCache *OrganizationBase, err error) {
+	if common.RedisEnabled {
+		orgCache = &OrganizationBase{}
+		if err = common.RedisHGetObj(getOrgCacheKey(orgId), orgCache); err == nil {
+			return orgCache, nil
+		}
+	}
+	org, err := GetOrganizationById(orgId)
+	if err != nil {
+		return nil, err
+	}
+	if common.RedisEnabled {
+		gopool.Go(func() {
+			if err := updateOrgCache(org); err != nil {
+				common.SysError("failed to update organization cache: " + err.Error())
+			}
+		})
+	}
+	return &OrganizationBase{Id: org.Id, Status: org.Status, Quota: org.Quota}, nil
+}
+
+// getOrgMemberRoleCache 获取成员角色，启用 Redis 时缓存，不是成员时不缓存
+func getOrgMemberRoleCache(orgId int, userId int) (int, error) {
+	cacheKey := getOrgMemberCacheKey(orgId, userId)
+	if common.RedisEnabled {
+		if value, err := common.RedisGet(cacheKey); err == nil {
+			if role, err := strconv.Atoi(value); err == nil {
+				return role, nil
+			}
+		}
+	}
+	role, err := GetOrgMemberRole(orgId, userId)
+	if err != nil {
+		return 0, err
+	}
+	if common.RedisEnabled {
+		err = common.RedisSet(cacheKey, strconv.Itoa(role), time.Duration(common.SyncFrequency)*time.Second)
+		if err != nil {
+			common.SysError("failed to set organization member cache: " + err.Error())
+		}
+	}
+	return role, nil
+}
+
+func cacheIncrOrgQuota(orgId int, delta int64) error {
+	if !common.RedisEnabled {
+		return nil
+	}
+	return common.RedisHIncrBy(getOrgCacheKey(orgId), "Quota", delta)
+}
@@ -0,0 +1,94 @@
+package model
+
+import (
+	"one-api/common"
+	"testing"
+)
+
+func createTestOrganization(t *testing.T, quota int) *Organization {
+	t.Helper()
+	org := &Organization{Name: "org", Status: common.OrganizationStatusEnabled, Quota: quota, OwnerId: 1}
+	if err := org.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	return org
+}
+
+func TestDecreaseBillingQuotaWithOrg(t *testing.T) {
+	db := setupTestDB(t, &User{}, &Organization{}, &OrganizationMember{})
+	if err := db.Create(&User{Id: 1, Username: "owner", Quota: 1000, AffCode: "owner"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	org := createTestOrganization(t, 500)
+
+	if err := DecreaseBillingQuota(1, org.Id, 200); err != nil {
+		t.Fatal(err)
+	}
+	if err := IncreaseBillingQuota(1, org.Id, 50); err != nil {
+		t.Fatal(err)
+	}
+	if err := DecreaseBillingQuota(1, org.Id, -1); err == nil {
+		t.Error("negative quota accepted")
+	}
+	stored, _ := GetOrganizationById(org.Id)
+	if stored.Quota != 350 || stored.UsedQuota != 150 {
+		t.Errorf("org quota = %d, used = %d, want 350, 150", stored.Quota, stored.UsedQuota)
+	}
+	if quota, _ := GetBillingQuota(1, org.Id); quota != 350 {
+		t.Errorf("billing quota = %d, want 350", quota)
+	}
+	// 组织令牌不扣减个人余额
+	if quota, _ := GetBillingQuota(1, 0); quota != 1000 {
+		t.Errorf("user quota = %d, want 1000", quota)
+	}
+
+	// 开启批量更新时与用户额度相同，先合并再写入数据库
+	common.BatchUpdateEnabled = true
+	if err := DecreaseBillingQuota(1, org.Id, 100); err != nil {
+		t.Fatal(err)
+	}
+	if err := DecreaseBillingQuota(1, org.Id, 30); err != nil {
+		t.Fatal(err)
+	}
+	if quota, _ := GetOrgQuota(org.Id, true); quota != 350 {
+		t.Errorf("quota before batch update = %d, want 350", quota)
+	}
+	batchUpdateLocks[BatchUpdateTypeOrgQuota].Lock()
+	pending := batchUpdateStores[BatchUpdateTypeOrgQuota][org.Id]
+	batchUpdateLocks[BatchUpdateTypeOrgQuota].Unlock()
+	if pending != -130 {
+		t.Errorf("pending delta = %d, want -130", pending)
+	}
+	batchUpdate()
+	stored, _ = GetOrganizationById(org.Id)
+	if stored.Quota != 220 || stored.UsedQuota != 280 {
+		t.Errorf("org quota after batch update = %d, used = %d, want 220, 280", stored.Quota, stored.UsedQuota)
+	}
+}
+
+func TestValidateOrgToken(t *testing.T) {
+	setupTestDB(t, &Organization{}, &OrganizationMember{})
+	org := createTestOrganization(t, 0)
+	if err := AddOrganizationMember(org.Id, 2, common.OrgRoleMember); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateOrgToken(org.Id, 2); err != nil {
+		t.Errorf("member token rejected: %v", err)
+	}
+	if err := ValidateOrgToken(org.Id+1, 2); err == nil {
+		t.Error("token of missing organization accepted")
+	}
+	if err := RemoveOrganizationMember(org.Id, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateOrgToken(org.Id, 2); err == nil {
+		t.Error("removed member's token accepted")
+	}
+	org.Status = common.OrganizationStatusDisabled
+	if err := org.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateOrgToken(org.Id, 1); err == nil {
+		t.Error("disabled organization's token accepted")
+	}
+}
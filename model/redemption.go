@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"one-api/common"
 	"strconv"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -17,9 +18,13 @@ type Redemption struct {
 	Name         string         `json:"name" gorm:"index"`
 	Quota        int            `json:"quota" gorm:"default:100"`
 	CreatedTime  int64          `json:"created_time" gorm:"bigint"`
-	RedeemedTime int64          `json:"redeemed_time" gorm:"bigint"`
-	Count        int            `json:"count" gorm:"-:all"` // only for api request
-	UsedUserId   int            `json:"used_user_id"`
+	RedeemedTime int64          `json:"redeemed_time" gorm:"bigint"`          // 多次使用的兑换码为最近一次兑换时间
+	Count        int            `json:"count" gorm:"-:all"`                   // only for api request
+	UsedUserId   int            `json:"used_user_id"`                         // 多次使用的兑换码为最近一次兑换的用户
+	CampaignId   int            `json:"campaign_id" gorm:"index;default:0"`   // 所属活动，0 表示不属于任何活动，只能兑换额度
+	MaxUses      int            `json:"max_uses" gorm:"default:1"`            // 可兑换的次数，同一用户只能兑换一次
+	UsedCount    int            `json:"used_count" gorm:"default:0"`          // 已兑换的次数
+	ExpiredTime  int64          `json:"expired_time" gorm:"bigint;default:0"` // 过期时间，0 表示永不过期
 	DeletedAt    gorm.DeletedAt `gorm:"index"`
 }
 
@@ -109,43 +114,157 @@ func GetRedemptionById(id int) (*Redemption, error) {
 	return &redemption, err
 }
 
-func Redeem(key string, userId int) (quota int, err error) {
+// Redeem 使用兑换码，独立兑换码和额度奖励增加余额，分组奖励升级用户分组，令牌奖励创建限时令牌并增加对应额度
+func Redeem(key string, userId int) (*RedemptionRecord, error) {
 	if key == "" {
-		return 0, errors.New("未提供兑换码")
+		return nil, errors.New("未提供兑换码")
 	}
 	if userId == 0 {
-		return 0, errors.New("无效的 user id")
+		return nil, errors.New("无效的 user id")
 	}
 	redemption := &Redemption{}
+	campaign := &RedemptionCampaign{}
+	record := &RedemptionRecord{UserId: userId}
+	var token *Token
 
 	keyCol := "`key`"
 	if common.UsingPostgreSQL {
 		keyCol = `"key"`
 	}
 	common.RandomSleep()
-	err = DB.Transaction(func(tx *gorm.DB) error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
 		err := tx.Set("gorm:query_option", "FOR UPDATE").Where(keyCol+" = ?", key).First(redemption).Error
 		if err != nil {
 			return errors.New("无效的兑换码")
 		}
+		if redemption.Status == common.RedemptionCodeStatusDisabled {
+			return errors.New("该兑换码已被禁用")
+		}
 		if redemption.Status != common.RedemptionCodeStatusEnabled {
 			return errors.New("该兑换码已被使用")
 		}
-		err = tx.Model(&User{}).Where("id = ?", userId).Update("quota", gorm.Expr("quota + ?", redemption.Quota)).Error
+		now := common.GetTimestamp()
+		if redemption.ExpiredTime > 0 && redemption.ExpiredTime < now {
+			return errors.New("该兑换码已过期")
+		}
+		if redemption.CampaignId != 0 {
+			if err := tx.Where("id = ?", redemption.CampaignId).First(campaign).Error; err != nil {
+				return errors.New("兑换活动不存在")
+			}
+			if campaign.Status != common.RedemptionCodeStatusEnabled || campaign.isExpired(now) {
+				return errors.New("兑换活动已结束")
+			}
+		} else {
+			campaign.RewardType = RedemptionRewardQuota
+			campaign.Quota = redemption.Quota
+		}
+		var count int64
+		err = tx.Model(&RedemptionRecord{}).Where("redemption_id = ? AND user_id = ?", redemption.Id, userId).Count(&count).Error
 		if err != nil {
 			return err
 		}
-		redemption.RedeemedTime = common.GetTimestamp()
-		redemption.Status = common.RedemptionCodeStatusUsed
-		redemption.UsedUserId = userId
-		err = tx.Save(redemption).Error
-		return err
+		if count > 0 {
+			return errors.New("您已使用过该兑换码")
+		}
+		err = tx.Model(&RedemptionRecord{}).Where("campaign_id = ? AND user_id = ?", redemption.CampaignId, userId).Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if campaign.PerUserLimit > 0 && count >= int64(campaign.PerUserLimit) {
+			return errors.New("您在该活动中的兑换次数已达上限")
+		}
+		// 以剩余次数为条件更新，多人同时兑换同一兑换码时不会超出可兑换次数
+		result := tx.Model(&Redemption{}).Where("id = ? AND status = ? AND used_count < max_uses", redemption.Id, common.RedemptionCodeStatusEnabled).
+			Updates(map[string]interface{}{
+				"used_count":    gorm.Expr("used_count + 1"),
+				"used_user_id":  userId,
+				"redeemed_time": now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("该兑换码已被使用")
+		}
+		err = tx.Model(&Redemption{}).Where("id = ? AND used_count >= max_uses", redemption.Id).
+			Update("status", common.RedemptionCodeStatusUsed).Error
+		if err != nil {
+			return err
+		}
+
+		record.RedemptionId = redemption.Id
+		record.CampaignId = redemption.CampaignId
+		record.UserSeq = int(count) + 1
+		record.RewardType = campaign.RewardType
+		record.CreatedTime = now
+		switch campaign.RewardType {
+		case RedemptionRewardGroup:
+			record.GrantGroup = campaign.GrantGroup
+			// 只升级处于原分组的用户，其他分组的用户兑换失败且不消耗兑换次数
+			result := tx.Model(&User{}).Where("id = ? AND "+groupCol+" = ?", userId, campaign.SourceGroup).
+				Update("group", campaign.GrantGroup)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return fmt.Errorf("该兑换码仅限 %s 分组的用户兑换", campaign.SourceGroup)
+			}
+		case RedemptionRewardToken:
+			var tokenKey string
+			tokenKey, err = common.GenerateKey()
+			if err != nil {
+				return err
+			}
+			record.Quota = campaign.Quota
+			record.ExpiredTime = now + int64(campaign.TokenValidDays)*24*3600
+			token = &Token{
+				UserId:       userId,
+				Name:         campaign.Name,
+				Key:          tokenKey,
+				CreatedTime:  now,
+				AccessedTime: now,
+				ExpiredTime:  record.ExpiredTime,
+				RemainQuota:  campaign.Quota,
+			}
+			if err = tx.Create(token).Error; err != nil {
+				return err
+			}
+			record.TokenId = token.Id
+			err = tx.Model(&User{}).Where("id = ?", userId).Update("quota", gorm.Expr("quota + ?", record.Quota)).Error
+		default:
+			record.Quota = campaign.Quota
+			err = tx.Model(&User{}).Where("id = ?", userId).Update("quota", gorm.Expr("quota + ?", record.Quota)).Error
+		}
+		if err != nil {
+			return err
+		}
+		// 用户在同一活动中的兑换序号唯一，并发兑换时只有一个能成功
+		if err = tx.Create(record).Error; err != nil {
+			return errors.New("请稍后重试")
+		}
+		return nil
 	})
 	if err != nil {
-		return 0, errors.New("兑换失败，" + err.Error())
+		return nil, errors.New("兑换失败，" + err.Error())
+	}
+	if record.Quota > 0 {
+		if err := cacheIncrUserQuota(userId, int64(record.Quota)); err != nil {
+			common.SysError("failed to increase user quota cache: " + err.Error())
+		}
+	}
+	switch record.RewardType {
+	case RedemptionRewardGroup:
+		if err := invalidateUserCache(userId); err != nil {
+			common.SysError("failed to invalidate user cache: " + err.Error())
+		}
+		RecordLog(userId, LogTypeTopup, fmt.Sprintf("通过兑换码升级到分组 %s，兑换码ID %d", record.GrantGroup, redemption.Id))
+	case RedemptionRewardToken:
+		RecordLog(userId, LogTypeTopup, fmt.Sprintf("通过兑换码获得限时令牌 %s，额度 %s，有效期至 %s，兑换码ID %d", token.Name,
+			common.LogQuota(record.Quota), time.Unix(record.ExpiredTime, 0).Format("2006-01-02 15:04:05"), redemption.Id))
+	default:
+		RecordLog(userId, LogTypeTopup, fmt.Sprintf("通过兑换码充值 %s，兑换码ID %d", common.LogQuota(record.Quota), redemption.Id))
 	}
-	RecordLog(userId, LogTypeTopup, fmt.Sprintf("通过兑换码充值 %s，兑换码ID %d", common.LogQuota(redemption.Quota), redemption.Id))
-	return redemption.Quota, nil
+	return record, nil
 }
 
 func (redemption *Redemption) Insert() error {
@@ -0,0 +1,323 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"one-api/common"
+	"one-api/setting"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	RedemptionRewardQuota = "quota"
+	RedemptionRewardGroup = "group"
+	RedemptionRewardToken = "token"
+)
+
+// RedemptionCampaign 兑换码活动，活动下的兑换码共用奖励、过期时间和每人兑换次数限制
+type RedemptionCampaign struct {
+	Id          int    `json:"id"`
+	Name        string `json:"name" gorm:"type:varchar(64);index"`
+	Description string `json:"description" gorm:"type:varchar(255)"`
+	Status      int    `json:"status" gorm:"default:1"`
+	RewardType  string `json:"reward_type" gorm:"type:varchar(16);default:'quota'"`
+	// Quota 额度奖励的额度，或限时令牌的额度
+	Quota int `json:"quota"`
+	// GrantGroup 分组奖励升级到的用户分组
+	GrantGroup string `json:"grant_group" gorm:"type:varchar(64)"`
+	// SourceGroup 分组奖励只对当前处于该分组的用户生效，其他分组的用户无法兑换，避免被降级
+	SourceGroup string `json:"source_group" gorm:"type:varchar(64)"`
+	// TokenValidDays 限时令牌的有效天数，到期后未用完的额度会被收回
+	TokenValidDays int `json:"token_valid_days"`
+	// PerUserLimit 每个用户在本活动中最多兑换的次数，0 表示不限制
+	PerUserLimit int `json:"per_user_limit"`
+	// ExpiredTime 活动结束时间，0 表示不限制
+	ExpiredTime int64 `json:"expired_time" gorm:"bigint"`
+	CreatedBy   int   `json:"created_by"`
+	CreatedTime int64 `json:"created_time" gorm:"bigint"`
+}
+
+// RedemptionRecord 兑换记录，可多次使用的兑换码每次兑换各一条
+type RedemptionRecord struct {
+	Id           int `json:"id"`
+	RedemptionId int `json:"redemption_id" gorm:"index"`
+	CampaignId   int `json:"campaign_id" gorm:"index;uniqueIndex:idx_redemption_record_user_seq"`
+	UserId       int `json:"user_id" gorm:"index;uniqueIndex:idx_redemption_record_user_seq"`
+	// UserSeq 用户在同一活动中的兑换序号，唯一索引保证并发兑换不会超出每人限制
+	UserSeq    int    `json:"user_seq" gorm:"uniqueIndex:idx_redemption_record_user_seq"`
+	RewardType string `json:"reward_type" gorm:"type:varchar(16)"`
+	// Quota 增加到用户余额的额度
+	Quota      int    `json:"quota"`
+	GrantGroup string `json:"grant_group" gorm:"type:varchar(64)"`
+	TokenId    int    `json:"token_id"`
+	// ExpiredTime 限时令牌的到期时间
+	ExpiredTime int64 `json:"expired_time" gorm:"bigint"`
+	// Reclaimed 限时令牌到期后未用完的额度已收回
+	Reclaimed   bool  `json:"reclaimed" gorm:"default:false"`
+	CreatedTime int64 `json:"created_time" gorm:"bigint;index"`
+}
+
+// RedemptionCampaignStats 活动统计
+type RedemptionCampaignStats struct {
+	Codes int64 `json:"codes"`
+	// UnusedCodes 尚未被兑换过且未禁用的兑换码
+	UnusedCodes int64 `json:"unused_codes"`
+	// Capacity 所有兑换码的可兑换次数之和
+	Capacity    int64 `json:"capacity"`
+	Redemptions int64 `json:"redemptions"`
+	Users       int64 `json:"users"`
+	Quota       int64 `json:"quota"`
+}
+
+func (campaign *RedemptionCampaign) Validate() error {
+	if len(campaign.Name) == 0 || len(campaign.Name) > 64 {
+		return errors.New("活动名称长度必须在1-64之间")
+	}
+	if campaign.PerUserLimit < 0 || campaign.Quota < 0 {
+		return errors.New("额度和每人兑换次数不能为负数")
+	}
+	switch campaign.RewardType {
+	case RedemptionRewardQuota:
+		if campaign.Quota <= 0 {
+			return errors.New("额度奖励的额度必须大于0")
+		}
+	case RedemptionRewardGroup:
+		if campaign.GrantGroup == "" || campaign.SourceGroup == "" {
+			return errors.New("分组奖励需要指定原分组和升级到的分组")
+		}
+		if campaign.GrantGroup == campaign.SourceGroup {
+			return errors.New("升级到的分组不能与原分组相同")
+		}
+		for _, group := range []string{campaign.SourceGroup, campaign.GrantGroup} {
+			if !setting.ContainsGroupRatio(group) {
+				return fmt.Errorf("分组 %s 不存在", group)
+			}
+		}
+	case RedemptionRewardToken:
+		if campaign.Quota <= 0 || campaign.TokenValidDays <= 0 {
+			return errors.New("令牌奖励的额度和有效天数必须大于0")
+		}
+	default:
+		return errors.New("无效的奖励类型")
+	}
+	return nil
+}
+
+func (campaign *RedemptionCampaign) isExpired(now int64) bool {
+	return campaign.ExpiredTime > 0 && campaign.ExpiredTime < now
+}
+
+// newCampaignCodes 生成兑换码，maxUses 为每个兑换码可兑换的次数
+func newCampaignCodes(campaign *RedemptionCampaign, count int, maxUses int, expiredTime int64, userId int) []*Redemption {
+	codes := make([]*Redemption, 0, count)
+	for i := 0; i < count; i++ {
+		codes = append(codes, &Redemption{
+			UserId:      userId,
+			CampaignId:  campaign.Id,
+			Name:        campaign.Name,
+			Key:         common.GetUUID(),
+			Quota:       campaign.Quota,
+			MaxUses:     maxUses,
+			ExpiredTime: expiredTime,
+			CreatedTime: common.GetTimestamp(),
+		})
+	}
+	return codes
+}
+
+func redemptionKeys(codes []*Redemption) []string {
+	keys := make([]string, 0, len(codes))
+	for _, code := range codes {
+		keys = append(keys, code.Key)
+	}
+	return keys
+}
+
+// CreateRedemptionCampaign 创建活动并生成 count 个兑换码
+func CreateRedemptionCampaign(campaign *RedemptionCampaign, count int, maxUses int, expiredTime int64) ([]string, error) {
+	campaign.CreatedTime = common.GetTimestamp()
+	var codes []*Redemption
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(campaign).Error; err != nil {
+			return err
+		}
+		codes = newCampaignCodes(campaign, count, maxUses, expiredTime, campaign.CreatedBy)
+		return tx.CreateInBatches(codes, 100).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return redemptionKeys(codes), nil
+}
+
+// AddRedemptionCampaignCodes 为已有活动追加兑换码
+func AddRedemptionCampaignCodes(campaignId int, count int, maxUses int, expiredTime int64, userId int) ([]string, error) {
+	campaign, err := GetRedemptionCampaignById(campaignId)
+	if err != nil {
+		return nil, err
+	}
+	codes := newCampaignCodes(campaign, count, maxUses, expiredTime, userId)
+	if err = DB.CreateInBatches(codes, 100).Error; err != nil {
+		return nil, err
+	}
+	return redemptionKeys(codes), nil
+}
+
+func GetRedemptionCampaignById(id int) (*RedemptionCampaign, error) {
+	campaign := &RedemptionCampaign{}
+	err := DB.Where("id = ?", id).First(campaign).Error
+	return campaign, err
+}
+
+func GetRedemptionCampaigns(keyword string, startIdx int, num int) (campaigns []*RedemptionCampaign, total int64, err error) {
+	tx := DB.Model(&RedemptionCampaign{})
+	if keyword != "" {
+		tx = tx.Where("name LIKE ?", keyword+"%")
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&campaigns).Error
+	return campaigns, total, err
+}
+
+// Update 更新活动，已兑换的记录不受影响
+func (campaign *RedemptionCampaign) Update() error {
+	return DB.Model(campaign).Select("name", "description", "status", "reward_type", "quota", "grant_group",
+		"token_valid_days", "per_user_limit", "expired_time").Updates(campaign).Error
+}
+
+func GetRedemptionCampaignStats(campaignId int) (*RedemptionCampaignStats, error) {
+	stats := &RedemptionCampaignStats{}
+	err := DB.Model(&Redemption{}).Where("campaign_id = ?", campaignId).
+		Select("COUNT(*) AS codes, COALESCE(SUM(max_uses), 0) AS capacity").Scan(stats).Error
+	if err != nil {
+		return nil, err
+	}
+	err = DB.Model(&Redemption{}).Where("campaign_id = ? AND used_count = 0 AND status = ?", campaignId, common.RedemptionCodeStatusEnabled).
+		Count(&stats.UnusedCodes).Error
+	if err != nil {
+		return nil, err
+	}
+	err = DB.Model(&RedemptionRecord{}).Where("campaign_id = ?", campaignId).
+		Select("COUNT(*) AS redemptions, COUNT(DISTINCT user_id) AS users, COALESCE(SUM(quota), 0) AS quota").Scan(stats).Error
+	return stats, err
+}
+
+// GetRedemptionCampaignCodes 查询活动下的兑换码，unusedOnly 为 true 时只返回尚未被兑换过且未禁用、未过期的兑换码
+func GetRedemptionCampaignCodes(campaignId int, unusedOnly bool, startIdx int, num int) (codes []*Redemption, total int64, err error) {
+	tx := DB.Model(&Redemption{}).Where("campaign_id = ?", campaignId)
+	if unusedOnly {
+		tx = tx.Where("used_count = 0 AND status = ? AND (expired_time = 0 OR expired_time > ?)",
+			common.RedemptionCodeStatusEnabled, common.GetTimestamp())
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if num > 0 {
+		tx = tx.Limit(num).Offset(startIdx)
+	}
+	err = tx.Order("id asc").Find(&codes).Error
+	return codes, total, err
+}
+
+func GetRedemptionCampaignRecords(campaignId int, startIdx int, num int) (records []*RedemptionRecord, total int64, err error) {
+	tx := DB.Model(&RedemptionRecord{}).Where("campaign_id = ?", campaignId)
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&records).Error
+	return records, total, err
+}
+
+// reclaimExpiredRedemptionTokens 令牌到期后收回兑换时增加的额度中未通过该令牌使用的部分，并将令牌置为过期
+func reclaimExpiredRedemptionTokens() error {
+	var records []*RedemptionRecord
+	err := DB.Where("reward_type = ? AND reclaimed = ? AND expired_time > 0 AND expired_time < ?",
+		RedemptionRewardToken, false, common.GetTimestamp()).Find(&records).Error
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		token := &Token{}
+		if err := DB.Unscoped().Where("id = ?", record.TokenId).First(token).Error; err != nil {
+			common.SysError(fmt.Sprintf("failed to get redemption token %d: %s", record.TokenId, err.Error()))
+			continue
+		}
+		result := DB.Model(&RedemptionRecord{}).Where("id = ? AND reclaimed = ?", record.Id, false).Update("reclaimed", true)
+		if result.Error != nil || result.RowsAffected == 0 {
+			continue
+		}
+		if token.DeletedAt.Time.IsZero() && token.Status == common.TokenStatusEnabled {
+			err = DB.Model(&Token{}).Where("id = ?", token.Id).
+				Updates(map[string]interface{}{"status": common.TokenStatusExpired, "expired_time": record.ExpiredTime}).Error
+			if err != nil {
+				common.SysError("failed to expire redemption token: " + err.Error())
+			}
+			if common.RedisEnabled {
+				if err := cacheDeleteToken(token.Key); err != nil {
+					common.SysError("failed to delete token cache: " + err.Error())
+				}
+			}
+		}
+		unused := max(0, record.Quota-token.UsedQuota)
+		if unused == 0 {
+			continue
+		}
+		// 兑换的额度可能已通过其他令牌使用，最多收回到余额为 0，不让余额变为负数
+		unused, err = reclaimUserQuota(record.UserId, unused)
+		if err != nil {
+			common.SysError("failed to reclaim redemption token quota: " + err.Error())
+			continue
+		}
+		if unused == 0 {
+			continue
+		}
+		RecordLog(record.UserId, LogTypeManage, fmt.Sprintf("兑换的限时令牌 %s 已到期，收回未使用的额度 %s", token.Name, common.LogQuota(unused)))
+	}
+	return nil
+}
+
+// reclaimUserQuota 从用户余额中扣除最多 quota 的额度，余额不足时只扣到 0，返回实际扣除的额度
+func reclaimUserQuota(userId int, quota int) (int, error) {
+	reclaimed := 0
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		user := &User{}
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").Select("id", "quota").Where("id = ?", userId).First(user).Error; err != nil {
+			return err
+		}
+		reclaimed = min(quota, max(0, user.Quota))
+		if reclaimed == 0 {
+			return nil
+		}
+		// 以余额不小于扣除额度为条件，与并发消费同时发生时不会扣成负数
+		result := tx.Model(&User{}).Where("id = ? AND quota >= ?", userId, reclaimed).
+			Update("quota", gorm.Expr("quota - ?", reclaimed))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			reclaimed = 0
+		}
+		return nil
+	})
+	if err != nil || reclaimed == 0 {
+		return 0, err
+	}
+	if err = cacheDecrUserQuota(userId, int64(reclaimed)); err != nil {
+		common.SysError("failed to decrease user quota cache: " + err.Error())
+	}
+	return reclaimed, nil
+}
+
+// ReclaimExpiredRedemptionTokens 每小时检查一次到期的兑换令牌
+func ReclaimExpiredRedemptionTokens() {
+	for {
+		if err := reclaimExpiredRedemptionTokens(); err != nil {
+			common.SysError("failed to reclaim expired redemption tokens: " + err.Error())
+		}
+		time.Sleep(time.Hour)
+	}
+}
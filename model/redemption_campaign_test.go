@@ -0,0 +1,192 @@
+package model
+
+import (
+	"fmt"
+	"one-api/common"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func setupRedemptionTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	return setupTestDB(t, &User{}, &Token{}, &Log{}, &Redemption{}, &RedemptionCampaign{}, &RedemptionRecord{})
+}
+
+func createRedemptionTestUser(t *testing.T, db *gorm.DB, id int, group string, quota int) {
+	t.Helper()
+	user := &User{Id: id, Username: fmt.Sprintf("user%d", id), Group: group, Quota: quota, AffCode: fmt.Sprintf("aff%d", id)}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func getRedemptionTestUser(t *testing.T, db *gorm.DB, id int) *User {
+	t.Helper()
+	user := &User{}
+	if err := db.First(user, id).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestRedemptionCampaignValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		campaign RedemptionCampaign
+		wantErr  string
+	}{
+		{"quota", RedemptionCampaign{Name: "c", RewardType: RedemptionRewardQuota, Quota: 100}, ""},
+		{"group", RedemptionCampaign{Name: "c", RewardType: RedemptionRewardGroup, SourceGroup: "default", GrantGroup: "vip"}, ""},
+		{"group without source", RedemptionCampaign{Name: "c", RewardType: RedemptionRewardGroup, GrantGroup: "vip"}, "原分组"},
+		{"same group", RedemptionCampaign{Name: "c", RewardType: RedemptionRewardGroup, SourceGroup: "vip", GrantGroup: "vip"}, "不能与原分组相同"},
+		{"unknown grant group", RedemptionCampaign{Name: "c", RewardType: RedemptionRewardGroup, SourceGroup: "default", GrantGroup: "vipp"}, "vipp 不存在"},
+		{"unknown source group", RedemptionCampaign{Name: "c", RewardType: RedemptionRewardGroup, SourceGroup: "free", GrantGroup: "vip"}, "free 不存在"},
+		{"token", RedemptionCampaign{Name: "c", RewardType: RedemptionRewardToken, Quota: 100}, "有效天数"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.campaign.Validate()
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Validate() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRedeemGroupReward(t *testing.T) {
+	db := setupRedemptionTestDB(t)
+	campaign := &RedemptionCampaign{Name: "upgrade", Status: common.RedemptionCodeStatusEnabled, RewardType: RedemptionRewardGroup,
+		SourceGroup: "default", GrantGroup: "vip"}
+	keys, err := CreateRedemptionCampaign(campaign, 1, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	createRedemptionTestUser(t, db, 1, "default", 0)
+	createRedemptionTestUser(t, db, 2, "svip", 0)
+
+	tests := []struct {
+		name      string
+		userId    int
+		wantErr   bool
+		wantGroup string
+	}{
+		{"source group is upgraded", 1, false, "vip"},
+		{"other group is not downgraded", 2, true, "svip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Redeem(keys[0], tt.userId)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Redeem() err = %v", err)
+			}
+			if group := getRedemptionTestUser(t, db, tt.userId).Group; group != tt.wantGroup {
+				t.Errorf("group = %s, want %s", group, tt.wantGroup)
+			}
+		})
+	}
+	var redemption Redemption
+	db.First(&redemption)
+	if redemption.UsedCount != 1 {
+		t.Errorf("used count = %d, rejected redemption consumed a use", redemption.UsedCount)
+	}
+}
+
+func TestRedeemConcurrent(t *testing.T) {
+	db := setupRedemptionTestDB(t)
+	const maxUses = 3
+	const users = 6
+	campaign := &RedemptionCampaign{Name: "quota", Status: common.RedemptionCodeStatusEnabled, RewardType: RedemptionRewardQuota,
+		Quota: 100, PerUserLimit: 1}
+	keys, err := CreateRedemptionCampaign(campaign, 2, maxUses, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= users; i++ {
+		createRedemptionTestUser(t, db, i, "default", 0)
+	}
+	// 每个用户同时兑换两个兑换码，每人限兑一次，每个兑换码限兑 maxUses 次
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	success := 0
+	for i := 1; i <= users; i++ {
+		for _, key := range keys {
+			wg.Add(1)
+			go func(userId int, key string) {
+				defer wg.Done()
+				if _, err := Redeem(key, userId); err == nil {
+					mu.Lock()
+					success++
+					mu.Unlock()
+				}
+			}(i, key)
+		}
+	}
+	wg.Wait()
+	if success != users {
+		t.Errorf("successful redemptions = %d, want %d", success, users)
+	}
+	var total int64
+	db.Model(&User{}).Select("COALESCE(SUM(quota), 0)").Scan(&total)
+	if total != int64(users*100) {
+		t.Errorf("total quota = %d", total)
+	}
+	for i := 1; i <= users; i++ {
+		if quota := getRedemptionTestUser(t, db, i).Quota; quota != 100 {
+			t.Errorf("user %d quota = %d", i, quota)
+		}
+	}
+	var redemptions []Redemption
+	db.Find(&redemptions)
+	for _, redemption := range redemptions {
+		if redemption.UsedCount > maxUses {
+			t.Errorf("redemption %d used %d times", redemption.Id, redemption.UsedCount)
+		}
+	}
+}
+
+func TestReclaimExpiredRedemptionTokens(t *testing.T) {
+	tests := []struct {
+		name      string
+		balance   int
+		tokenUsed int
+		wantQuota int
+	}{
+		{"unused quota is reclaimed", 1000, 0, 900},
+		{"used part is kept", 1000, 30, 930},
+		{"spent elsewhere is clamped at zero", 40, 0, 0},
+		{"negative balance is left unchanged", -20, 0, -20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupRedemptionTestDB(t)
+			createRedemptionTestUser(t, db, 1, "default", tt.balance)
+			expired := time.Now().Add(-time.Hour).Unix()
+			token := &Token{UserId: 1, Name: "gift", Key: "gift-key", Status: common.TokenStatusEnabled, UsedQuota: tt.tokenUsed, ExpiredTime: expired}
+			db.Create(token)
+			db.Create(&RedemptionRecord{CampaignId: 1, UserId: 1, UserSeq: 1, RewardType: RedemptionRewardToken, Quota: 100,
+				TokenId: token.Id, ExpiredTime: expired})
+			if err := reclaimExpiredRedemptionTokens(); err != nil {
+				t.Fatal(err)
+			}
+			if quota := getRedemptionTestUser(t, db, 1).Quota; quota != tt.wantQuota {
+				t.Errorf("quota = %d, want %d", quota, tt.wantQuota)
+			}
+			var record RedemptionRecord
+			db.First(&record)
+			if !record.Reclaimed {
+				t.Error("record not marked reclaimed")
+			}
+			// 再次执行不会重复收回
+			if err := reclaimExpiredRedemptionTokens(); err != nil {
+				t.Fatal(err)
+			}
+			if quota := getRedemptionTestUser(t, db, 1).Quota; quota != tt.wantQuota {
+				t.Errorf("quota after second run = %d, want %d", quota, tt.wantQuota)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"one-api/common"
+	"one-api/constant"
+	"reflect"
+
+	"gorm.io/gorm/schema"
+)
+
+// 渠道密钥、敏感设置项、两步验证密钥和用户 webhook 密钥在配置 SECRET_ENCRYPTION_KEY 后加密保存，
+// 读取时透明解密。未加密的历史数据在启动时由 MigrateSecrets 加密
+
+func init() {
+	schema.RegisterSerializer("secret", SecretSerializer{})
+}
+
+// EncryptSecret 使用主密钥加密敏感数据，未配置主密钥、值为空或已加密时原样返回
+func EncryptSecret(value string) (string, error) {
+	if common.SecretEncryptionKey == "" || value == "" || common.IsEnvelopeEncrypted(value) {
+		return value, nil
+	}
+	return common.EnvelopeEncrypt(value, common.SecretEncryptionKey)
+}
+
+// DecryptSecret 解密 EncryptSecret 的结果，未加密的值原样返回
+func DecryptSecret(value string) (string, error) {
+	if !common.IsEnvelopeEncrypted(value) {
+		return value, nil
+	}
+	if common.SecretEncryptionKey == "" {
+		return "", fmt.Errorf("secret is encrypted but SECRET_ENCRYPTION_KEY is not set")
+	}
+	return common.EnvelopeDecrypt(value, common.SecretEncryptionKey)
+}
+
+// SecretSerializer gorm 序列化器，字段使用 serializer:secret 标签后写入时加密、读取时解密
+type SecretSerializer struct{}
+
+func (SecretSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var value string
+	switch v := dbValue.(type) {
+	case []byte:
+		value = string(v)
+	case string:
+		value = v
+	case nil:
+	default:
+		return fmt.Errorf("unsupported secret value type %T", dbValue)
+	}
+	plaintext, err := DecryptSecret(value)
+	if err != nil {
+		return err
+	}
+	field.ReflectValueOf(ctx, dst).SetString(plaintext)
+	return nil
+}
+
+func (SecretSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	value, _ := fieldValue.(string)
+	return EncryptSecret(value)
+}
+
+// encryptUserSetting 返回加密 webhook 密钥后的设置副本，不修改传入的设置
+func encryptUserSetting(setting map[string]interface{}) map[string]interface{} {
+	secret, ok := setting[constant.UserSettingWebhookSecret].(string)
+	if !ok {
+		return setting
+	}
+	encrypted, err := EncryptSecret(secret)
+	if err != nil {
+		common.SysError("failed to encrypt webhook secret: " + err.Error())
+		return setting
+	}
+	result := make(map[string]interface{}, len(setting))
+	for key, value := range setting {
+		result[key] = value
+	}
+	result[constant.UserSettingWebhookSecret] = encrypted
+	return result
+}
+
+func decryptUserSetting(setting map[string]interface{}) map[string]interface{} {
+	if secret, ok := setting[constant.UserSettingWebhookSecret].(string); ok {
+		plaintext, err := DecryptSecret(secret)
+		if err != nil {
+			common.SysError("failed to decrypt webhook secret: " + err.Error())
+			delete(setting, constant.UserSettingWebhookSecret)
+			return setting
+		}
+		setting[constant.UserSettingWebhookSecret] = plaintext
+	}
+	return setting
+}
+
+// reencryptSecret 使用当前主密钥重新加密，oldKey 用于解密轮换前的密文，返回值是否发生变化
+func reencryptSecret(value string, oldKey string) (string, bool, error) {
+	if value == "" {
+		return value, false, nil
+	}
+	if common.IsEnvelopeEncrypted(value) {
+		if common.EnvelopeKeyId(value) == common.SecretKeyId(common.SecretEncryptionKey) {
+			return value, false, nil
+		}
+		if oldKey == "" {
+			return "", false, fmt.Errorf("secret was encrypted with another master key, set SECRET_ENCRYPTION_OLD_KEY and run --rotate-secret-key")
+		}
+		plaintext, err := common.EnvelopeDecrypt(value, oldKey)
+		if err != nil {
+			return "", false, err
+		}
+		value = plaintext
+	}
+	encrypted, err := common.EnvelopeEncrypt(value, common.SecretEncryptionKey)
+	return encrypted, err == nil, err
+}
+
+// SecretMigration 记录已完成敏感数据加密迁移的主密钥，启动时已迁移的主密钥不再扫描所有数据
+type SecretMigration struct {
+	KeyId      string `json:"key_id" gorm:"primaryKey;type:varchar(16)"`
+	MigratedAt int64  `json:"migrated_at" gorm:"bigint"`
+}
+
+// MigrateSecretsIfNeeded 当前主密钥尚未完成迁移时加密所有未加密的敏感数据
+func MigrateSecretsIfNeeded() (int, error) {
+	keyId := common.SecretKeyId(common.SecretEncryptionKey)
+	var count int64
+	if err := DB.Model(&SecretMigration{}).Where("key_id = ?", keyId).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	if count > 0 {
+		return 0, nil
+	}
+	return MigrateSecrets("")
+}
+
+// MigrateSecrets 使用当前主密钥加密所有未加密的敏感数据，oldKey 不为空时同时重新加密由旧主密钥加密的数据。
+// 直接读写原始列，不经过 SecretSerializer
+func MigrateSecrets(oldKey string) (int, error) {
+	if common.SecretEncryptionKey == "" {
+		return 0, fmt.Errorf("SECRET_ENCRYPTION_KEY is not set")
+	}
+	count := 0
+
+	var channels []struct {
+		Id  int
+		Key string
+	}
+	if err := DB.Table("channels").Select("id", keyCol).Find(&channels).Error; err != nil {
+		return count, err
+	}
+	for _, channel := range channels {
+		value, changed, err := reencryptSecret(channel.Key, oldKey)
+		if err != nil {
+			return count, fmt.Errorf("channel %d: %w", channel.Id, err)
+		}
+		if !changed {
+			continue
+		}
+		if err = DB.Table("channels").Where("id = ?", channel.Id).Update("key", value).Error; err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	var options []*Option
+	if err := DB.Find(&options).Error; err != nil {
+		return count, err
+	}
+	for _, option := range options {
+		if !IsSensitiveField(option.Key) {
+			continue
+		}
+		value, changed, err := reencryptSecret(option.Value, oldKey)
+		if err != nil {
+			return count, fmt.Errorf("option %s: %w", option.Key, err)
+		}
+		if !changed {
+			continue
+		}
+		if err = DB.Model(&Option{}).Where(keyCol+" = ?", option.Key).Update("value", value).Error; err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	var twoFactors []struct {
+		Id     int
+		Secret string
+	}
+	if err := DB.Table("two_factors").Select("id", "secret").Find(&twoFactors).Error; err != nil {
+		return count, err
+	}
+	for _, twoFactor := range twoFactors {
+		value, changed, err := reencryptSecret(twoFactor.Secret, oldKey)
+		if err != nil {
+			return count, fmt.Errorf("two factor %d: %w", twoFactor.Id, err)
+		}
+		if !changed {
+			continue
+		}
+		if err = DB.Table("two_factors").Where("id = ?", twoFactor.Id).Update("secret", value).Error; err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	var users []struct {
+		Id      int
+		Setting string
+	}
+	if err := DB.Table("users").Select("id", "setting").Where("setting LIKE ?", "%"+constant.UserSettingWebhookSecret+"%").Find(&users).Error; err != nil {
+		return count, err
+	}
+	for _, user := range users {
+		setting := common.StrToMap(user.Setting)
+		secret, ok := setting[constant.UserSettingWebhookSecret].(string)
+		if !ok {
+			continue
+		}
+		value, changed, err := reencryptSecret(secret, oldKey)
+		if err != nil {
+			return count, fmt.Errorf("user %d: %w", user.Id, err)
+		}
+		if !changed {
+			continue
+		}
+		setting[constant.UserSettingWebhookSecret] = value
+		if err = DB.Table("users").Where("id = ?", user.Id).Update("setting", common.MapToJsonStr(setting)).Error; err != nil {
+			return count, err
+		}
+		count++
+	}
+	err := DB.Save(&SecretMigration{
+		KeyId:      common.SecretKeyId(common.SecretEncryptionKey),
+		MigratedAt: common.GetTimestamp(),
+	}).Error
+	return count, err
+}
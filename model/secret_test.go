@@ -0,0 +1,107 @@
+package model
+
+import (
+	"one-api/common"
+	"one-api/constant"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func setupSecretTest(t *testing.T, masterKey string) *gorm.DB {
+	t.Helper()
+	db := setupTestDB(t, &Channel{}, &Option{}, &TwoFactor{}, &User{}, &SecretMigration{})
+	oldKey := common.SecretEncryptionKey
+	common.SecretEncryptionKey = masterKey
+	t.Cleanup(func() { common.SecretEncryptionKey = oldKey })
+	return db
+}
+
+func TestEncryptUserSettingCopies(t *testing.T) {
+	setupSecretTest(t, "master-key")
+	setting := map[string]interface{}{
+		constant.UserSettingWebhookSecret: "whsec",
+		"notify_type":                     "webhook",
+	}
+	encrypted := encryptUserSetting(setting)
+	if setting[constant.UserSettingWebhookSecret] != "whsec" {
+		t.Fatalf("caller map modified: %v", setting[constant.UserSettingWebhookSecret])
+	}
+	value, _ := encrypted[constant.UserSettingWebhookSecret].(string)
+	if !common.IsEnvelopeEncrypted(value) || encrypted["notify_type"] != "webhook" {
+		t.Fatalf("encrypted setting = %v", encrypted)
+	}
+	user := &User{}
+	user.SetSetting(setting)
+	if strings.Contains(user.Setting, "whsec") {
+		t.Errorf("webhook secret stored in plaintext: %s", user.Setting)
+	}
+	if got := user.GetSetting()[constant.UserSettingWebhookSecret]; got != "whsec" {
+		t.Errorf("decrypted secret = %v", got)
+	}
+}
+
+func TestMigrateSecretsIfNeeded(t *testing.T) {
+	db := setupSecretTest(t, "")
+	db.Create(&Channel{Name: "legacy", Key: "sk-legacy"})
+	db.Create(&Option{Key: "SMTPToken", Value: "smtp-secret"})
+	common.SecretEncryptionKey = "master-key"
+
+	tests := []struct {
+		name  string
+		count int
+	}{
+		{"first start encrypts existing secrets", 2},
+		{"later starts skip the scan", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			count, err := MigrateSecretsIfNeeded()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != tt.count {
+				t.Errorf("count = %d, want %d", count, tt.count)
+			}
+		})
+	}
+	var raw struct{ Key string }
+	db.Table("channels").Select("key").Where("name = ?", "legacy").Scan(&raw)
+	if !common.IsEnvelopeEncrypted(raw.Key) {
+		t.Errorf("channel key not encrypted: %q", raw.Key)
+	}
+	var channel Channel
+	db.First(&channel, "name = ?", "legacy")
+	if channel.Key != "sk-legacy" {
+		t.Errorf("decrypted key = %q", channel.Key)
+	}
+}
+
+func TestChannelKeywordCondition(t *testing.T) {
+	tests := []struct {
+		name      string
+		masterKey string
+		byKey     bool
+	}{
+		{"plaintext keys are searchable", "", true},
+		{"encrypted keys are not searched", "master-key", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupSecretTest(t, tt.masterKey)
+			db.Create(&Channel{Name: "c1", Key: "sk-find-me", Models: "gpt-4o"})
+			condition, args := channelKeywordCondition("sk-find-me")
+			if strings.Contains(condition, keyCol) != tt.byKey || len(args) != map[bool]int{true: 3, false: 2}[tt.byKey] {
+				t.Fatalf("condition = %s, args = %v", condition, args)
+			}
+			channels, err := SearchChannels("sk-find-me", "", "", false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (len(channels) == 1) != tt.byKey {
+				t.Errorf("found %d channels", len(channels))
+			}
+		})
+	}
+}
@@ -27,7 +27,9 @@ type Task struct {
 	TaskID     string                `json:"task_id" gorm:"type:varchar(50);index"`  // 第三方id，不一定有/ song id\ Task id
 	Platform   constant.TaskPlatform `json:"platform" gorm:"type:varchar(30);index"` // 平台
 	UserId     int                   `json:"user_id" gorm:"index"`
+	TokenId    int                   `json:"token_id" gorm:"index"`
 	ChannelId  int                   `json:"channel_id" gorm:"index"`
+	KeyIndex   int                   `json:"-" gorm:"default:0"` // 提交任务时使用的渠道密钥的位置，多密钥渠道查询任务时使用同一个密钥
 	Quota      int                   `json:"quota"`
 	Action     string                `json:"action" gorm:"type:varchar(40);index"` // 任务类型, song, lyrics, description-mode
 	Status     TaskStatus            `json:"status" gorm:"type:varchar(20);index"` // 任务状态
@@ -53,6 +55,8 @@ func (t *Task) GetData(v any) error {
 
 type Properties struct {
 	Input string `json:"input"`
+	// CallbackUrl 任务完成后回调的地址，提交任务时指定，优先于令牌配置的回调地址
+	CallbackUrl string `json:"callback_url,omitempty"`
 }
 
 func (m *Properties) Scan(val interface{}) error {
@@ -80,6 +84,7 @@ type SyncTaskQueryParams struct {
 func InitTask(platform constant.TaskPlatform, relayInfo *commonRelay.TaskRelayInfo) *Task {
 	t := &Task{
 		UserId:     relayInfo.UserId,
+		TokenId:    relayInfo.TokenId,
 		SubmitTime: time.Now().Unix(),
 		Status:     TaskStatusNotStart,
 		Progress:   "0%",
@@ -170,6 +175,13 @@ func TaskGetAllTasks(startIdx int, num int, queryParams SyncTaskQueryParams) []*
 	return tasks
 }
 
+// CountUnfinishedTasks 统计指定平台未完成的任务数
+func CountUnfinishedTasks(platform constant.TaskPlatform) (int64, error) {
+	var count int64
+	err := DB.Model(&Task{}).Where("platform = ? and progress != ?", platform, "100%").Count(&count).Error
+	return count, err
+}
+
 func GetAllUnFinishSyncTasks(limit int) []*Task {
 	var tasks []*Task
 	var err error
@@ -224,6 +236,38 @@ func GetByTaskIds(userId int, taskIds []any) ([]*Task, error) {
 	return task, nil
 }
 
+// GetTokenTaskByTaskId 获取指定令牌创建的任务
+func GetTokenTaskByTaskId(platform constant.TaskPlatform, userId int, tokenId int, taskId string) (*Task, bool, error) {
+	var task *Task
+	err := DB.Where("platform = ? and user_id = ? and token_id = ? and task_id = ?", platform, userId, tokenId, taskId).
+		First(&task).Error
+	exist, err := RecordExist(err)
+	if err != nil {
+		return nil, false, err
+	}
+	return task, exist, err
+}
+
+// GetTokenTasks 按创建时间倒序获取指定令牌创建的任务，afterId 不为 0 时只返回该任务之前创建的任务
+func GetTokenTasks(platform constant.TaskPlatform, userId int, tokenId int, afterId int64, limit int) ([]*Task, error) {
+	var tasks []*Task
+	query := DB.Where("platform = ? and user_id = ? and token_id = ?", platform, userId, tokenId)
+	if afterId != 0 {
+		query = query.Where("id < ?", afterId)
+	}
+	err := query.Order("id desc").Limit(limit).Find(&tasks).Error
+	if err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+func GetTaskById(id int64) (*Task, error) {
+	var task *Task
+	err := DB.Where("id = ?", id).First(&task).Error
+	return task, err
+}
+
 func TaskUpdateProgress(id int64, progress string) error {
 	return DB.Model(&Task{}).Where("id = ?", id).Update("progress", progress).Error
 }
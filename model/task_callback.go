@@ -0,0 +1,54 @@
+package model
+
+import "one-api/common"
+
+const (
+	TaskCallbackStatusPending = "pending"
+	TaskCallbackStatusSuccess = "success"
+	TaskCallbackStatusFailed  = "failed"
+)
+
+// TaskCallback 异步任务完成回调的投递记录，失败时保留最后一次的状态码和错误信息。
+// 状态码和错误信息只用于排查，不返回给用户，避免通过回调探测内部服务
+type TaskCallback struct {
+	ID            int64  `json:"id" gorm:"primary_key;AUTO_INCREMENT"`
+	CreatedAt     int64  `json:"created_at" gorm:"index"`
+	UpdatedAt     int64  `json:"updated_at"`
+	UserId        int    `json:"user_id" gorm:"index"`
+	TokenId       int    `json:"-" gorm:"default:0"`
+	TaskID        string `json:"task_id" gorm:"type:varchar(50);index"`
+	Url           string `json:"url" gorm:"type:text"`
+	Payload       string `json:"-" gorm:"type:text"`
+	Status        string `json:"status" gorm:"type:varchar(20);index"`
+	Attempts      int    `json:"attempts"`
+	StatusCode    int    `json:"-"`
+	LastError     string `json:"-" gorm:"type:text"`
+	NextAttemptAt int64  `json:"next_attempt_at" gorm:"index"`
+}
+
+func (callback *TaskCallback) Insert() error {
+	return DB.Create(callback).Error
+}
+
+func (callback *TaskCallback) Update() error {
+	callback.UpdatedAt = common.GetTimestamp()
+	return DB.Save(callback).Error
+}
+
+// GetDueTaskCallbacks 获取到达重试时间的待投递回调
+func GetDueTaskCallbacks(now int64, limit int) ([]*TaskCallback, error) {
+	var callbacks []*TaskCallback
+	err := DB.Where("status = ? and next_attempt_at <= ?", TaskCallbackStatusPending, now).
+		Order("id").Limit(limit).Find(&callbacks).Error
+	return callbacks, err
+}
+
+func GetUserTaskCallbacks(userId int, taskId string, startIdx int, num int) ([]*TaskCallback, error) {
+	var callbacks []*TaskCallback
+	query := DB.Where("user_id = ?", userId)
+	if taskId != "" {
+		query = query.Where("task_id = ?", taskId)
+	}
+	err := query.Order("id desc").Limit(num).Offset(startIdx).Find(&callbacks).Error
+	return callbacks, err
+}
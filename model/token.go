@@ -1,6 +1,7 @@
 package model
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"one-api/common"
@@ -24,8 +25,15 @@ type Token struct {
 	ModelLimitsEnabled bool           `json:"model_limits_enabled" gorm:"default:false"`
 	ModelLimits        string         `json:"model_limits" gorm:"type:varchar(1024);default:''"`
 	AllowIps           *string        `json:"allow_ips" gorm:"default:''"`
+	ModelFallbacks     *string        `json:"model_fallbacks" gorm:"type:text"`
+	ResponseCache      bool           `json:"response_cache" gorm:"default:false"`
 	UsedQuota          int            `json:"used_quota" gorm:"default:0"` // used quota
 	Group              string         `json:"group" gorm:"default:''"`
+	CallbackUrl        string         `json:"callback_url" gorm:"type:varchar(512);default:''"` // 异步任务完成回调地址
+	DailyBudget        int            `json:"daily_budget" gorm:"default:0"`                    // 每日预算，0 表示不限制
+	WeeklyBudget       int            `json:"weekly_budget" gorm:"default:0"`                   // 每周预算，0 表示不限制
+	MonthlyBudget      int            `json:"monthly_budget" gorm:"default:0"`                  // 每月预算，0 表示不限制
+	OrgId              int            `json:"org_id" gorm:"index;default:0"`                    // 组织令牌从组织额度中扣费，0 表示个人令牌
 	DeletedAt          gorm.DeletedAt `gorm:"index"`
 }
 
@@ -184,7 +192,8 @@ func (token *Token) Update() (err error) {
 		}
 	}()
 	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota",
-		"model_limits_enabled", "model_limits", "allow_ips", "group").Updates(token).Error
+		"model_limits_enabled", "model_limits", "allow_ips", "model_fallbacks", "response_cache", "group", "callback_url",
+		"daily_budget", "weekly_budget", "monthly_budget").Updates(token).Error
 	return err
 }
 
@@ -238,6 +247,19 @@ func (token *Token) GetModelLimitsMap() map[string]bool {
 	return limitsMap
 }
 
+// GetModelFallbacks 返回令牌自定义的模型降级链，优先于全局配置
+func (token *Token) GetModelFallbacks() map[string][]string {
+	fallbacks := make(map[string][]string)
+	if token.ModelFallbacks == nil || *token.ModelFallbacks == "" {
+		return fallbacks
+	}
+	err := json.Unmarshal([]byte(*token.ModelFallbacks), &fallbacks)
+	if err != nil {
+		common.SysError("failed to unmarshal token model fallbacks: " + err.Error())
+	}
+	return fallbacks
+}
+
 func DisableModelLimits(tokenId int) error {
 	token, err := GetTokenById(tokenId)
 	if err != nil {
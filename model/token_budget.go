@@ -0,0 +1,260 @@
+package model
+
+import (
+	"fmt"
+	"one-api/common"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	TokenBudgetPeriodDaily   = "daily"
+	TokenBudgetPeriodWeekly  = "weekly"
+	TokenBudgetPeriodMonthly = "monthly"
+)
+
+var tokenBudgetPeriods = []string{TokenBudgetPeriodDaily, TokenBudgetPeriodWeekly, TokenBudgetPeriodMonthly}
+
+var tokenBudgetPeriodNames = map[string]string{
+	TokenBudgetPeriodDaily:   "每日",
+	TokenBudgetPeriodWeekly:  "每周",
+	TokenBudgetPeriodMonthly: "每月",
+}
+
+// TokenBudgetUsage 令牌在一个预算周期内的消耗，每个周期单独一条记录，进入新周期后自然从零开始
+type TokenBudgetUsage struct {
+	Id          int    `json:"id"`
+	TokenId     int    `json:"token_id" gorm:"uniqueIndex:idx_token_budget_period"`
+	Period      string `json:"period" gorm:"type:varchar(16);uniqueIndex:idx_token_budget_period"`
+	PeriodStart int64  `json:"period_start" gorm:"uniqueIndex:idx_token_budget_period"`
+	UsedQuota   int    `json:"used_quota" gorm:"default:0"`
+}
+
+// TokenBudgetStatus 令牌当前预算周期的使用情况
+type TokenBudgetStatus struct {
+	Period    string `json:"period"`
+	Budget    int    `json:"budget"`
+	UsedQuota int    `json:"used_quota"`
+	ResetTime int64  `json:"reset_time"`
+}
+
+// getTokenBudgetPeriod 返回 now 所在预算周期的起止时间，周从周一开始，按服务器时区计算
+func getTokenBudgetPeriod(period string, now time.Time) (time.Time, time.Time) {
+	year, month, day := now.Date()
+	switch period {
+	case TokenBudgetPeriodWeekly:
+		offset := (int(now.Weekday()) + 6) % 7
+		start := time.Date(year, month, day-offset, 0, 0, 0, 0, now.Location())
+		return start, start.AddDate(0, 0, 7)
+	case TokenBudgetPeriodMonthly:
+		start := time.Date(year, month, 1, 0, 0, 0, 0, now.Location())
+		return start, start.AddDate(0, 1, 0)
+	default:
+		start := time.Date(year, month, day, 0, 0, 0, 0, now.Location())
+		return start, start.AddDate(0, 0, 1)
+	}
+}
+
+func (token *Token) getBudget(period string) int {
+	switch period {
+	case TokenBudgetPeriodDaily:
+		return token.DailyBudget
+	case TokenBudgetPeriodWeekly:
+		return token.WeeklyBudget
+	case TokenBudgetPeriodMonthly:
+		return token.MonthlyBudget
+	}
+	return 0
+}
+
+func (token *Token) HasBudget() bool {
+	return token.DailyBudget > 0 || token.WeeklyBudget > 0 || token.MonthlyBudget > 0
+}
+
+func tokenBudgetCacheKey(tokenId int, period string, start int64) string {
+	return fmt.Sprintf("token_budget:%d:%s:%d", tokenId, period, start)
+}
+
+// getTokenBudgetUsages 获取令牌在各周期的消耗，key 为周期名称。启用 Redis 时缓存到周期结束，
+// 缓存未命中的周期合并为一次数据库查询
+func getTokenBudgetUsages(tokenId int, periods []string, now time.Time) (map[string]int, error) {
+	usages := make(map[string]int, len(periods))
+	missing := make(map[string]time.Time)
+	starts := make([]int64, 0, len(periods))
+	for _, period := range periods {
+		start, _ := getTokenBudgetPeriod(period, now)
+		if common.RedisEnabled {
+			value, err := common.RedisGet(tokenBudgetCacheKey(tokenId, period, start.Unix()))
+			if err == nil {
+				if used, err := strconv.Atoi(value); err == nil {
+					usages[period] = used
+					continue
+				}
+			}
+		}
+		missing[period] = start
+		starts = append(starts, start.Unix())
+	}
+	if len(missing) == 0 {
+		return usages, nil
+	}
+	var records []TokenBudgetUsage
+	err := DB.Where("token_id = ? and period_start in ?", tokenId, starts).Find(&records).Error
+	if err != nil {
+		return nil, err
+	}
+	for period, start := range missing {
+		used := 0
+		for _, record := range records {
+			if record.Period == period && record.PeriodStart == start.Unix() {
+				used = record.UsedQuota
+				break
+			}
+		}
+		usages[period] = used
+		if common.RedisEnabled {
+			_, end := getTokenBudgetPeriod(period, now)
+			err = common.RedisSet(tokenBudgetCacheKey(tokenId, period, start.Unix()), strconv.Itoa(used), time.Until(end))
+			if err != nil {
+				common.SysError("failed to set token budget cache: " + err.Error())
+			}
+		}
+	}
+	return usages, nil
+}
+
+// GetTokenBudgetStatus 返回令牌已设置预算的各周期的使用情况和下次重置时间
+func GetTokenBudgetStatus(token *Token) ([]TokenBudgetStatus, error) {
+	statuses := make([]TokenBudgetStatus, 0)
+	now := time.Now()
+	periods := make([]string, 0, len(tokenBudgetPeriods))
+	for _, period := range tokenBudgetPeriods {
+		if token.getBudget(period) > 0 {
+			periods = append(periods, period)
+		}
+	}
+	if len(periods) == 0 {
+		return statuses, nil
+	}
+	usages, err := getTokenBudgetUsages(token.Id, periods, now)
+	if err != nil {
+		return nil, err
+	}
+	for _, period := range periods {
+		_, end := getTokenBudgetPeriod(period, now)
+		statuses = append(statuses, TokenBudgetStatus{
+			Period:    period,
+			Budget:    token.getBudget(period),
+			UsedQuota: usages[period],
+			ResetTime: end.Unix(),
+		})
+	}
+	return statuses, nil
+}
+
+// CheckTokenBudget 检查令牌各周期的预算是否已用尽
+func CheckTokenBudget(token *Token) error {
+	if !token.HasBudget() {
+		return nil
+	}
+	statuses, err := GetTokenBudgetStatus(token)
+	if err != nil {
+		return err
+	}
+	for _, status := range statuses {
+		if status.UsedQuota >= status.Budget {
+			return fmt.Errorf("该令牌%s预算已用尽，将于 %s 重置", tokenBudgetPeriodNames[status.Period],
+				time.Unix(status.ResetTime, 0).Format("2006-01-02 15:04:05"))
+		}
+	}
+	return nil
+}
+
+// tokenBudgetPeriodKey 一条预算消耗记录对应的令牌和周期
+type tokenBudgetPeriodKey struct {
+	tokenId     int
+	period      string
+	periodStart int64
+}
+
+// tokenBudgetBatch 批量更新时暂存的预算消耗，按消耗发生时所在的周期累计，避免跨周期刷新时计入新周期
+var tokenBudgetBatch = struct {
+	sync.Mutex
+	store map[tokenBudgetPeriodKey]int
+}{
+	store: make(map[tokenBudgetPeriodKey]int),
+}
+
+// RecordTokenBudgetUsage 记录设置了预算的令牌的消耗，quota 为负数时表示退还
+func RecordTokenBudgetUsage(tokenId int, quota int) {
+	if quota == 0 {
+		return
+	}
+	now := time.Now()
+	if common.RedisEnabled {
+		gopool.Go(func() {
+			for _, period := range tokenBudgetPeriods {
+				start, _ := getTokenBudgetPeriod(period, now)
+				err := common.RedisIncr(tokenBudgetCacheKey(tokenId, period, start.Unix()), int64(quota))
+				if err != nil {
+					common.SysError("failed to increase token budget cache: " + err.Error())
+				}
+			}
+		})
+	}
+	if common.BatchUpdateEnabled {
+		addTokenBudgetBatchRecord(tokenId, quota, now)
+		return
+	}
+	for _, period := range tokenBudgetPeriods {
+		start, _ := getTokenBudgetPeriod(period, now)
+		err := recordTokenBudgetUsage(tokenBudgetPeriodKey{tokenId, period, start.Unix()}, quota)
+		if err != nil {
+			common.SysError("failed to record token budget usage: " + err.Error())
+		}
+	}
+}
+
+func addTokenBudgetBatchRecord(tokenId int, quota int, now time.Time) {
+	tokenBudgetBatch.Lock()
+	defer tokenBudgetBatch.Unlock()
+	for _, period := range tokenBudgetPeriods {
+		start, _ := getTokenBudgetPeriod(period, now)
+		tokenBudgetBatch.store[tokenBudgetPeriodKey{tokenId, period, start.Unix()}] += quota
+	}
+}
+
+func batchUpdateTokenBudgetUsage() {
+	tokenBudgetBatch.Lock()
+	store := tokenBudgetBatch.store
+	tokenBudgetBatch.store = make(map[tokenBudgetPeriodKey]int)
+	tokenBudgetBatch.Unlock()
+	for key, quota := range store {
+		if quota == 0 {
+			continue
+		}
+		err := recordTokenBudgetUsage(key, quota)
+		if err != nil {
+			common.SysError("failed to batch update token budget usage: " + err.Error())
+		}
+	}
+}
+
+func recordTokenBudgetUsage(key tokenBudgetPeriodKey, quota int) error {
+	return DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "token_id"}, {Name: "period"}, {Name: "period_start"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"used_quota": gorm.Expr("used_quota + ?", quota),
+		}),
+	}).Create(&TokenBudgetUsage{
+		TokenId:     key.tokenId,
+		Period:      key.period,
+		PeriodStart: key.periodStart,
+		UsedQuota:   quota,
+	}).Error
+}
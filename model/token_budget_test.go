@@ -0,0 +1,118 @@
+package model
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func setupTokenBudgetTestDB(t *testing.T) {
+	t.Helper()
+	setupTestDB(t, &TokenBudgetUsage{})
+}
+
+func TestGetTokenBudgetPeriod(t *testing.T) {
+	loc := time.UTC
+	tests := []struct {
+		name   string
+		period string
+		now    time.Time
+		start  time.Time
+		end    time.Time
+	}{
+		{"daily", TokenBudgetPeriodDaily, time.Date(2024, 3, 5, 13, 4, 0, 0, loc),
+			time.Date(2024, 3, 5, 0, 0, 0, 0, loc), time.Date(2024, 3, 6, 0, 0, 0, 0, loc)},
+		{"weekly starts on monday", TokenBudgetPeriodWeekly, time.Date(2024, 3, 7, 8, 0, 0, 0, loc),
+			time.Date(2024, 3, 4, 0, 0, 0, 0, loc), time.Date(2024, 3, 11, 0, 0, 0, 0, loc)},
+		{"weekly on sunday", TokenBudgetPeriodWeekly, time.Date(2024, 3, 10, 23, 59, 0, 0, loc),
+			time.Date(2024, 3, 4, 0, 0, 0, 0, loc), time.Date(2024, 3, 11, 0, 0, 0, 0, loc)},
+		{"weekly across month", TokenBudgetPeriodWeekly, time.Date(2024, 3, 1, 0, 0, 0, 0, loc),
+			time.Date(2024, 2, 26, 0, 0, 0, 0, loc), time.Date(2024, 3, 4, 0, 0, 0, 0, loc)},
+		{"monthly leap february", TokenBudgetPeriodMonthly, time.Date(2024, 2, 29, 12, 0, 0, 0, loc),
+			time.Date(2024, 2, 1, 0, 0, 0, 0, loc), time.Date(2024, 3, 1, 0, 0, 0, 0, loc)},
+		{"monthly december", TokenBudgetPeriodMonthly, time.Date(2024, 12, 31, 12, 0, 0, 0, loc),
+			time.Date(2024, 12, 1, 0, 0, 0, 0, loc), time.Date(2025, 1, 1, 0, 0, 0, 0, loc)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := getTokenBudgetPeriod(tt.period, tt.now)
+			if !start.Equal(tt.start) || !end.Equal(tt.end) {
+				t.Errorf("period = [%v, %v), want [%v, %v)", start, end, tt.start, tt.end)
+			}
+		})
+	}
+}
+
+func TestCheckTokenBudget(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   Token
+		usage   int
+		wantErr string
+	}{
+		{"no budget", Token{}, 1000, ""},
+		{"under daily budget", Token{DailyBudget: 100}, 99, ""},
+		{"daily budget used up", Token{DailyBudget: 100}, 100, "每日"},
+		{"weekly budget used up", Token{DailyBudget: 1000, WeeklyBudget: 50}, 60, "每周"},
+		{"refund restores budget", Token{MonthlyBudget: 100}, 100 - 30, ""},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTokenBudgetTestDB(t)
+			tt.token.Id = i + 1
+			RecordTokenBudgetUsage(tt.token.Id, tt.usage)
+			err := CheckTokenBudget(&tt.token)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTokenBudgetUsageIgnoresPreviousPeriod(t *testing.T) {
+	setupTokenBudgetTestDB(t)
+	start, _ := getTokenBudgetPeriod(TokenBudgetPeriodDaily, time.Now())
+	key := tokenBudgetPeriodKey{1, TokenBudgetPeriodDaily, start.AddDate(0, 0, -1).Unix()}
+	if err := recordTokenBudgetUsage(key, 500); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckTokenBudget(&Token{Id: 1, DailyBudget: 100}); err != nil {
+		t.Fatalf("usage from yesterday counted: %v", err)
+	}
+}
+
+func TestBatchTokenBudgetUsageKeepsPeriod(t *testing.T) {
+	setupTokenBudgetTestDB(t)
+	now := time.Now()
+	yesterday := now.AddDate(0, 0, -1)
+	addTokenBudgetBatchRecord(1, 40, yesterday)
+	addTokenBudgetBatchRecord(1, 10, now)
+	addTokenBudgetBatchRecord(1, -10, now)
+	batchUpdateTokenBudgetUsage()
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want int
+	}{
+		{"usage stays in the period it happened", yesterday, 40},
+		{"refund cancels usage", now, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usages, err := getTokenBudgetUsages(1, []string{TokenBudgetPeriodDaily}, tt.at)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if usages[TokenBudgetPeriodDaily] != tt.want {
+				t.Errorf("daily usage = %d, want %d", usages[TokenBudgetPeriodDaily], tt.want)
+			}
+		})
+	}
+	if len(tokenBudgetBatch.store) != 0 {
+		t.Error("batch store not flushed")
+	}
+}
@@ -1,5 +1,27 @@
 package model
 
+import (
+	"errors"
+	"fmt"
+	"one-api/common"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+const (
+	TopUpStatusPending  = "pending"
+	TopUpStatusSuccess  = "success"
+	TopUpStatusFailed   = "failed"
+	TopUpStatusRefunded = "refunded"
+)
+
+// topUpTransitions 充值订单允许的状态变更
+var topUpTransitions = map[string][]string{
+	TopUpStatusPending: {TopUpStatusSuccess, TopUpStatusFailed},
+	TopUpStatusSuccess: {TopUpStatusRefunded},
+}
+
 type TopUp struct {
 	Id         int     `json:"id"`
 	UserId     int     `json:"user_id" gorm:"index"`
@@ -8,6 +30,23 @@ type TopUp struct {
 	TradeNo    string  `json:"trade_no"`
 	CreateTime int64   `json:"create_time"`
 	Status     string  `json:"status"`
+	// Provider 支付渠道，历史订单均为易支付
+	Provider string `json:"provider" gorm:"type:varchar(32);default:'epay'"`
+	Currency string `json:"currency" gorm:"type:varchar(16)"`
+	// ProviderTradeNo 支付渠道侧的订单号，退款时使用
+	ProviderTradeNo string `json:"provider_trade_no" gorm:"type:varchar(255);index"`
+	CompleteTime    int64  `json:"complete_time" gorm:"bigint"`
+}
+
+// TopUpEvent 充值订单状态变更记录，同一支付渠道的事件 ID 唯一，用于回调去重
+type TopUpEvent struct {
+	Id          int    `json:"id"`
+	TopUpId     int    `json:"top_up_id" gorm:"index"`
+	Provider    string `json:"provider" gorm:"type:varchar(32);uniqueIndex:idx_top_up_event"`
+	EventId     string `json:"event_id" gorm:"type:varchar(191);uniqueIndex:idx_top_up_event"`
+	FromStatus  string `json:"from_status" gorm:"type:varchar(16)"`
+	ToStatus    string `json:"to_status" gorm:"type:varchar(16)"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
 }
 
 func (topUp *TopUp) Insert() error {
@@ -22,6 +61,13 @@ func (topUp *TopUp) Update() error {
 	return err
 }
 
+// Quota 订单对应的额度
+func (topUp *TopUp) Quota() int {
+	dAmount := decimal.NewFromInt(topUp.Amount)
+	dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
+	return int(dAmount.Mul(dQuotaPerUnit).IntPart())
+}
+
 func GetTopUpById(id int) *TopUp {
 	var topUp *TopUp
 	var err error
@@ -41,3 +87,128 @@ func GetTopUpByTradeNo(tradeNo string) *TopUp {
 	}
 	return topUp
 }
+
+func GetTopUpEvents(topUpId int) ([]*TopUpEvent, error) {
+	var events []*TopUpEvent
+	err := DB.Where("top_up_id = ?", topUpId).Order("id asc").Find(&events).Error
+	return events, err
+}
+
+func canTransitTopUp(from string, to string) bool {
+	for _, status := range topUpTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// TopUpTransition 一次充值订单状态变更，TradeNo 为空时按 ProviderTradeNo 查找订单
+type TopUpTransition struct {
+	TradeNo         string
+	ProviderTradeNo string
+	Provider        string
+	EventId         string
+	Status          string
+}
+
+// TransitTopUp 变更充值订单状态并同步增减用户额度。重复的事件或订单已不处于可变更的状态时
+// 不做任何修改并返回 false，因此支付回调可以安全地重复处理
+func TransitTopUp(transition *TopUpTransition) (*TopUp, bool, error) {
+	topUp := &TopUp{}
+	var from string
+	changed := false
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		query := tx.Where("provider = ?", transition.Provider)
+		if transition.TradeNo != "" {
+			query = query.Where("trade_no = ?", transition.TradeNo)
+		} else if transition.ProviderTradeNo != "" {
+			query = query.Where("provider_trade_no = ?", transition.ProviderTradeNo)
+		} else {
+			return errors.New("未提供订单号")
+		}
+		if err := query.First(topUp).Error; err != nil {
+			return err
+		}
+		if transition.EventId != "" {
+			var count int64
+			tx.Model(&TopUpEvent{}).Where("provider = ? AND event_id = ?", transition.Provider, transition.EventId).Count(&count)
+			if count > 0 {
+				return nil
+			}
+		}
+		from = topUp.Status
+		if !canTransitTopUp(from, transition.Status) {
+			return nil
+		}
+		updates := map[string]interface{}{
+			"status": transition.Status,
+		}
+		if transition.Status == TopUpStatusSuccess {
+			updates["complete_time"] = common.GetTimestamp()
+			if transition.ProviderTradeNo != "" {
+				updates["provider_trade_no"] = transition.ProviderTradeNo
+			}
+		}
+		// 条件更新保证并发回调只有一个能完成状态变更
+		result := tx.Model(&TopUp{}).Where("id = ? AND status = ?", topUp.Id, from).Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		eventId := transition.EventId
+		if eventId == "" {
+			eventId = fmt.Sprintf("%s:%s", transition.Status, topUp.TradeNo)
+		}
+		err := tx.Create(&TopUpEvent{
+			TopUpId:     topUp.Id,
+			Provider:    transition.Provider,
+			EventId:     eventId,
+			FromStatus:  from,
+			ToStatus:    transition.Status,
+			CreatedTime: common.GetTimestamp(),
+		}).Error
+		if err != nil {
+			return err
+		}
+		switch transition.Status {
+		case TopUpStatusSuccess:
+			err = tx.Model(&User{}).Where("id = ?", topUp.UserId).Update("quota", gorm.Expr("quota + ?", topUp.Quota())).Error
+		case TopUpStatusRefunded:
+			err = tx.Model(&User{}).Where("id = ?", topUp.UserId).Update("quota", gorm.Expr("quota - ?", topUp.Quota())).Error
+		}
+		if err != nil {
+			return err
+		}
+		changed = true
+		return nil
+	})
+	if err != nil || !changed {
+		return topUp, false, err
+	}
+	topUp.Status = transition.Status
+	switch transition.Status {
+	case TopUpStatusSuccess:
+		if err := cacheIncrUserQuota(topUp.UserId, int64(topUp.Quota())); err != nil {
+			common.SysError("failed to increase user quota cache: " + err.Error())
+		}
+		RecordLog(topUp.UserId, LogTypeTopup, fmt.Sprintf("使用在线充值成功，充值金额: %v，支付金额：%.2f %s", common.LogQuota(topUp.Quota()), topUp.Money, topUp.Currency))
+	case TopUpStatusRefunded:
+		if err := cacheDecrUserQuota(topUp.UserId, int64(topUp.Quota())); err != nil {
+			common.SysError("failed to decrease user quota cache: " + err.Error())
+		}
+		RecordLog(topUp.UserId, LogTypeManage, fmt.Sprintf("在线充值订单 %s 已退款，扣除额度: %v", topUp.TradeNo, common.LogQuota(topUp.Quota())))
+	}
+	return topUp, true, nil
+}
+
+func GetUserTopUps(userId int, startIdx int, num int) (topUps []*TopUp, total int64, err error) {
+	tx := DB.Model(&TopUp{}).Where("user_id = ?", userId)
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&topUps).Error
+	return topUps, total, err
+}
@@ -0,0 +1,201 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"one-api/common"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const twoFactorRecoveryCodeCount = 10
+
+const (
+	// 连续验证失败达到该次数后锁定
+	twoFactorMaxFailedAttempts = 5
+	// 锁定时长，单位秒
+	twoFactorLockoutSeconds = 15 * 60
+)
+
+// TwoFactor 用户的 TOTP 两步验证配置，密钥按静态加密配置加密保存，恢复码只保存哈希
+type TwoFactor struct {
+	Id     int    `json:"id"`
+	UserId int    `json:"user_id" gorm:"uniqueIndex"`
+	Secret string `json:"-" gorm:"type:text;serializer:secret"`
+	// Enabled 为 false 表示已生成密钥但尚未验证启用
+	Enabled bool `json:"enabled"`
+	// RecoveryCodes 未使用的恢复码哈希，JSON 数组
+	RecoveryCodes string `json:"-" gorm:"type:text"`
+	// LastUsedStep 最近一次通过验证的 TOTP 时间步，防止验证码重放
+	LastUsedStep int64 `json:"-" gorm:"bigint;default:0"`
+	// FailedAttempts 连续验证失败次数，验证通过或锁定后清零
+	FailedAttempts int `json:"-" gorm:"default:0"`
+	// LockedUntil 锁定截止时间，锁定期内拒绝所有验证
+	LockedUntil int64 `json:"-" gorm:"bigint;default:0"`
+	CreatedTime int64 `json:"created_time" gorm:"bigint"`
+}
+
+func GetTwoFactorByUserId(userId int) (*TwoFactor, error) {
+	twoFactor := &TwoFactor{}
+	err := DB.Where("user_id = ?", userId).First(twoFactor).Error
+	return twoFactor, err
+}
+
+// IsTwoFactorEnabled 用户是否已启用两步验证
+func IsTwoFactorEnabled(userId int) bool {
+	var count int64
+	DB.Model(&TwoFactor{}).Where("user_id = ? AND enabled = ?", userId, true).Count(&count)
+	return count > 0
+}
+
+// SetupTwoFactor 为用户生成新的 TOTP 密钥，验证通过前不生效；已启用时需先关闭
+func SetupTwoFactor(userId int) (*TwoFactor, error) {
+	twoFactor, err := GetTwoFactorByUserId(userId)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if err == nil && twoFactor.Enabled {
+		return nil, errors.New("两步验证已启用")
+	}
+	secret, err := common.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	twoFactor.UserId = userId
+	twoFactor.Secret = secret
+	twoFactor.Enabled = false
+	twoFactor.RecoveryCodes = ""
+	twoFactor.LastUsedStep = 0
+	twoFactor.CreatedTime = common.GetTimestamp()
+	return twoFactor, DB.Save(twoFactor).Error
+}
+
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+func (twoFactor *TwoFactor) getRecoveryCodeHashes() []string {
+	var hashes []string
+	if twoFactor.RecoveryCodes != "" {
+		_ = json.Unmarshal([]byte(twoFactor.RecoveryCodes), &hashes)
+	}
+	return hashes
+}
+
+// RecoveryCodesRemaining 剩余可用的恢复码数量
+func (twoFactor *TwoFactor) RecoveryCodesRemaining() int {
+	return len(twoFactor.getRecoveryCodeHashes())
+}
+
+// GenerateRecoveryCodes 生成新的一次性恢复码并替换旧的恢复码，明文只在此时返回
+func (twoFactor *TwoFactor) GenerateRecoveryCodes() ([]string, error) {
+	codes := make([]string, 0, twoFactorRecoveryCodeCount)
+	hashes := make([]string, 0, twoFactorRecoveryCodeCount)
+	for i := 0; i < twoFactorRecoveryCodeCount; i++ {
+		code, err := common.GenerateRandomCharsKey(10)
+		if err != nil {
+			return nil, err
+		}
+		code = strings.ToLower(code[:5] + "-" + code[5:])
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	data, _ := json.Marshal(hashes)
+	twoFactor.RecoveryCodes = string(data)
+	return codes, DB.Model(twoFactor).Update("recovery_codes", twoFactor.RecoveryCodes).Error
+}
+
+// LockedSeconds 剩余锁定秒数，未锁定时为 0
+func (twoFactor *TwoFactor) LockedSeconds() int64 {
+	remaining := twoFactor.LockedUntil - common.GetTimestamp()
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// recordFailure 记录一次验证失败，连续失败达到上限后锁定。计数保存在数据库中，多个节点共享
+func (twoFactor *TwoFactor) recordFailure() {
+	err := DB.Model(&TwoFactor{}).Where("id = ?", twoFactor.Id).
+		Update("failed_attempts", gorm.Expr("failed_attempts + 1")).Error
+	if err != nil {
+		common.SysError("failed to record two factor failure: " + err.Error())
+		return
+	}
+	// 只有一个并发请求能把计数清零并写入锁定时间
+	lockedUntil := common.GetTimestamp() + twoFactorLockoutSeconds
+	result := DB.Model(&TwoFactor{}).Where("id = ? AND failed_attempts >= ?", twoFactor.Id, twoFactorMaxFailedAttempts).
+		Updates(map[string]interface{}{"failed_attempts": 0, "locked_until": lockedUntil})
+	if result.Error == nil && result.RowsAffected > 0 {
+		twoFactor.LockedUntil = lockedUntil
+	}
+}
+
+func (twoFactor *TwoFactor) resetFailures() {
+	DB.Model(&TwoFactor{}).Where("id = ? AND failed_attempts > ?", twoFactor.Id, 0).Update("failed_attempts", 0)
+	twoFactor.FailedAttempts = 0
+}
+
+// Verify 校验 TOTP 验证码或恢复码，恢复码使用后失效。锁定期内始终返回 false
+func (twoFactor *TwoFactor) Verify(code string) bool {
+	if twoFactor.LockedSeconds() > 0 {
+		return false
+	}
+	if twoFactor.verify(code) {
+		twoFactor.resetFailures()
+		return true
+	}
+	twoFactor.recordFailure()
+	return false
+}
+
+func (twoFactor *TwoFactor) verify(code string) bool {
+	code = strings.TrimSpace(code)
+	if step, ok := common.ValidateTOTP(twoFactor.Secret, code, time.Now()); ok {
+		// 条件更新保证同一验证码在并发请求中也只能使用一次
+		result := DB.Model(&TwoFactor{}).Where("id = ? AND last_used_step < ?", twoFactor.Id, step).
+			Update("last_used_step", step)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return false
+		}
+		twoFactor.LastUsedStep = step
+		return true
+	}
+	if !twoFactor.Enabled {
+		return false
+	}
+	hash := hashRecoveryCode(code)
+	hashes := twoFactor.getRecoveryCodeHashes()
+	for i, h := range hashes {
+		if h != hash {
+			continue
+		}
+		hashes = append(hashes[:i], hashes[i+1:]...)
+		data, _ := json.Marshal(hashes)
+		result := DB.Model(&TwoFactor{}).Where("id = ? AND recovery_codes = ?", twoFactor.Id, twoFactor.RecoveryCodes).
+			Update("recovery_codes", string(data))
+		if result.Error != nil || result.RowsAffected == 0 {
+			return false
+		}
+		twoFactor.RecoveryCodes = string(data)
+		return true
+	}
+	return false
+}
+
+// Enable 启用两步验证
+func (twoFactor *TwoFactor) Enable() error {
+	twoFactor.Enabled = true
+	return DB.Model(twoFactor).Update("enabled", true).Error
+}
+
+// DisableTwoFactor 关闭用户的两步验证
+func DisableTwoFactor(userId int) error {
+	return DB.Where("user_id = ?", userId).Delete(&TwoFactor{}).Error
+}
@@ -0,0 +1,93 @@
+package model
+
+import (
+	"one-api/common"
+	"testing"
+)
+
+func setupTwoFactorTest(t *testing.T) *TwoFactor {
+	t.Helper()
+	setupTestDB(t, &TwoFactor{})
+	twoFactor, err := SetupTwoFactor(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = twoFactor.Enable(); err != nil {
+		t.Fatal(err)
+	}
+	return twoFactor
+}
+
+func TestTwoFactorRecoveryCodes(t *testing.T) {
+	twoFactor := setupTwoFactorTest(t)
+	codes, err := twoFactor.GenerateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != twoFactorRecoveryCodeCount {
+		t.Fatalf("got %d recovery codes", len(codes))
+	}
+	tests := []struct {
+		name string
+		code string
+		want bool
+	}{
+		{"recovery code", codes[0], true},
+		{"recovery code is single use", codes[0], false},
+		{"formatting is ignored", " " + codes[1][:5] + codes[1][6:] + " ", true},
+		{"unknown code", "aaaaa-bbbbb", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := twoFactor.Verify(tt.code); got != tt.want {
+				t.Errorf("Verify(%q) = %v, want %v", tt.code, got, tt.want)
+			}
+		})
+	}
+	if remaining := twoFactor.RecoveryCodesRemaining(); remaining != twoFactorRecoveryCodeCount-2 {
+		t.Errorf("remaining = %d", remaining)
+	}
+}
+
+func TestTwoFactorLockout(t *testing.T) {
+	twoFactor := setupTwoFactorTest(t)
+	codes, err := twoFactor.GenerateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < twoFactorMaxFailedAttempts-1; i++ {
+		twoFactor.Verify("000000")
+	}
+	// 每次请求重新读取，模拟清除 cookie 后重新登录
+	reload := func() *TwoFactor {
+		fresh, err := GetTwoFactorByUserId(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fresh
+	}
+	if fresh := reload(); fresh.FailedAttempts != twoFactorMaxFailedAttempts-1 || fresh.LockedSeconds() != 0 {
+		t.Fatalf("attempts = %d, locked = %d", fresh.FailedAttempts, fresh.LockedSeconds())
+	}
+	reload().Verify("000000")
+	fresh := reload()
+	if fresh.LockedSeconds() == 0 {
+		t.Fatal("not locked after max failures")
+	}
+	if fresh.Verify(codes[0]) {
+		t.Error("valid code accepted while locked")
+	}
+	if fresh.RecoveryCodesRemaining() != twoFactorRecoveryCodeCount {
+		t.Error("recovery code consumed while locked")
+	}
+
+	DB.Model(&TwoFactor{}).Where("id = ?", fresh.Id).Update("locked_until", common.GetTimestamp()-1)
+	fresh = reload()
+	fresh.Verify("000000")
+	if !fresh.Verify(codes[0]) {
+		t.Fatal("valid code rejected after lockout expired")
+	}
+	if attempts := reload().FailedAttempts; attempts != 0 {
+		t.Errorf("failed attempts not reset: %d", attempts)
+	}
+}
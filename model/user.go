@@ -70,11 +70,11 @@ func (user *User) GetSetting() map[string]interface{} {
 	if user.Setting == "" {
 		return nil
 	}
-	return common.StrToMap(user.Setting)
+	return decryptUserSetting(common.StrToMap(user.Setting))
 }
 
 func (user *User) SetSetting(setting map[string]interface{}) {
-	settingBytes, err := json.Marshal(setting)
+	settingBytes, err := json.Marshal(encryptUserSetting(setting))
 	if err != nil {
 		common.SysError("failed to marshal setting: " + err.Error())
 		return
@@ -648,7 +648,7 @@ func GetUserSetting(id int, fromDB bool) (settingMap map[string]interface{}, err
 		return map[string]interface{}{}, err
 	}
 
-	return common.StrToMap(setting), nil
+	return decryptUserSetting(common.StrToMap(setting)), nil
 }
 
 func IncreaseUserQuota(id int, quota int, db bool) (err error) {
@@ -795,6 +795,11 @@ func GetUsernameById(id int, fromDB bool) (username string, err error) {
 	return username, nil
 }
 
+func GetUserIdByUsername(username string) (id int, err error) {
+	err = DB.Model(&User{}).Where("username = ?", username).Select("id").First(&id).Error
+	return id, err
+}
+
 func IsLinuxDOIdAlreadyTaken(linuxDOId string) bool {
 	var user User
 	err := DB.Unscoped().Where("linux_do_id = ?", linuxDOId).First(&user).Error
@@ -35,11 +35,11 @@ func (user *UserBase) GetSetting() map[string]interface{} {
 	if user.Setting == "" {
 		return nil
 	}
-	return common.StrToMap(user.Setting)
+	return decryptUserSetting(common.StrToMap(user.Setting))
 }
 
 func (user *UserBase) SetSetting(setting map[string]interface{}) {
-	settingBytes, err := json.Marshal(setting)
+	settingBytes, err := json.Marshal(encryptUserSetting(setting))
 	if err != nil {
 		common.SysError("failed to marshal setting: " + err.Error())
 		return
@@ -15,6 +15,7 @@ const (
 	BatchUpdateTypeUsedQuota
 	BatchUpdateTypeChannelUsedQuota
 	BatchUpdateTypeRequestCount
+	BatchUpdateTypeOrgQuota
 	BatchUpdateTypeCount // if you add a new type, you need to add a new map and a new lock
 )
 
@@ -47,6 +48,20 @@ func addNewRecord(type_ int, id int, value int) {
 	}
 }
 
+// BatchUpdateTypeNames 各批量更新类型的名称，用于监控指标
+var BatchUpdateTypeNames = []string{"user_quota", "token_quota", "used_quota", "channel_used_quota", "request_count", "org_quota"}
+
+// GetBatchUpdatePendingCounts 返回各类型等待批量写入数据库的记录数，下标为批量更新类型
+func GetBatchUpdatePendingCounts() []int {
+	counts := make([]int, BatchUpdateTypeCount)
+	for i := 0; i < BatchUpdateTypeCount; i++ {
+		batchUpdateLocks[i].Lock()
+		counts[i] = len(batchUpdateStores[i])
+		batchUpdateLocks[i].Unlock()
+	}
+	return counts
+}
+
 func batchUpdate() {
 	common.SysLog("batch update started")
 	for i := 0; i < BatchUpdateTypeCount; i++ {
@@ -73,9 +88,14 @@ func batchUpdate() {
 				updateUserRequestCount(key, value)
 			case BatchUpdateTypeChannelUsedQuota:
 				updateChannelUsedQuota(key, value)
+			case BatchUpdateTypeOrgQuota:
+				if err := updateOrgQuota(key, value); err != nil {
+					common.SysError("failed to batch update organization quota: " + err.Error())
+				}
 			}
 		}
 	}
+	batchUpdateTokenBudgetUsage()
 	common.SysLog("batch update finished")
 }
 
@@ -1,6 +1,7 @@
 package channel
 
 import (
+	"errors"
 	"github.com/gin-gonic/gin"
 	"io"
 	"net/http"
@@ -25,6 +26,20 @@ type Adaptor interface {
 	ConvertClaudeRequest(c *gin.Context, info *relaycommon.RelayInfo, request *dto.ClaudeRequest) (any, error)
 }
 
+// ResponsesAdaptor 由上游原生支持 Responses API 的适配器实现，其余适配器通过 ConvertOpenAIRequest 转换
+type ResponsesAdaptor interface {
+	ConvertOpenAIResponsesRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.OpenAIResponsesRequest) (any, error)
+}
+
+// ErrUnsupportedImageOperation 渠道不支持请求的图片编辑操作或参数，返回 400
+var ErrUnsupportedImageOperation = errors.New("unsupported image operation")
+
+// ImageEditAdaptor 由支持图片编辑和变体的适配器实现，返回的请求体可以是 multipart 表单。
+// 目前实现的有 OpenAI（含 Azure 及兼容渠道）、阿里通义万相和 Gemini 图片生成模型
+type ImageEditAdaptor interface {
+	ConvertImageEditRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.ImageEditRequest) (io.Reader, error)
+}
+
 type TaskAdaptor interface {
 	Init(info *relaycommon.TaskRelayInfo)
 
@@ -40,6 +55,18 @@ type TaskAdaptor interface {
 	GetModelList() []string
 	GetChannelName() string
 
-	// FetchTask
+	// FetchTask 查询上游任务，body 中的 task_id 和 action 为要查询的任务
 	FetchTask(baseUrl, key string, body map[string]any) (*http.Response, error)
+	// ParseTaskResult 解析 FetchTask 的响应
+	ParseTaskResult(respBody []byte) ([]*dto.TaskInfo, error)
+}
+
+// TaskPriceAdaptor 由按生成时长等参数计价的任务适配器实现，返回模型固定价格的倍率
+type TaskPriceAdaptor interface {
+	GetPriceMultiplier(c *gin.Context, info *relaycommon.TaskRelayInfo) float64
+}
+
+// TaskBatchFetcher 支持一次查询多个任务的任务适配器，轮询时按渠道和密钥批量查询
+type TaskBatchFetcher interface {
+	FetchTasks(baseUrl, key string, taskIds []string) (*http.Response, error)
 }
@@ -1,6 +1,8 @@
 package ali
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
@@ -32,6 +34,8 @@ func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
 		fullRequestURL = fmt.Sprintf("%s/api/v1/services/embeddings/text-embedding/text-embedding", info.BaseUrl)
 	case constant.RelayModeImagesGenerations:
 		fullRequestURL = fmt.Sprintf("%s/api/v1/services/aigc/text2image/image-synthesis", info.BaseUrl)
+	case constant.RelayModeImagesEdits:
+		fullRequestURL = fmt.Sprintf("%s/api/v1/services/aigc/image2image/image-synthesis", info.BaseUrl)
 	default:
 		fullRequestURL = fmt.Sprintf("%s/compatible-mode/v1/chat/completions", info.BaseUrl)
 	}
@@ -44,6 +48,11 @@ func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Header, info *rel
 	if info.IsStream {
 		req.Set("X-DashScope-SSE", "enable")
 	}
+	if info.RelayMode == constant.RelayModeImagesEdits {
+		// 图像编辑只支持异步调用，请求体为 JSON
+		req.Set("Content-Type", "application/json")
+		req.Set("X-DashScope-Async", "enable")
+	}
 	if c.GetString("plugin") != "" {
 		req.Set("X-DashScope-Plugin", c.GetString("plugin"))
 	}
@@ -66,6 +75,21 @@ func (a *Adaptor) ConvertImageRequest(c *gin.Context, info *relaycommon.RelayInf
 	return aliRequest, nil
 }
 
+func (a *Adaptor) ConvertImageEditRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.ImageEditRequest) (io.Reader, error) {
+	if info.RelayMode != constant.RelayModeImagesEdits {
+		return nil, fmt.Errorf("%w: ali channel only supports image edits", channel.ErrUnsupportedImageOperation)
+	}
+	aliRequest, err := oaiImageEdit2Ali(c, request)
+	if err != nil {
+		return nil, err
+	}
+	jsonData, err := json.Marshal(aliRequest)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(jsonData), nil
+}
+
 func (a *Adaptor) ConvertRerankRequest(c *gin.Context, relayMode int, request dto.RerankRequest) (any, error) {
 	return nil, errors.New("not implemented")
 }
@@ -85,7 +109,7 @@ func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, request
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage any, err *dto.OpenAIErrorWithStatusCode) {
 	switch info.RelayMode {
-	case constant.RelayModeImagesGenerations:
+	case constant.RelayModeImagesGenerations, constant.RelayModeImagesEdits:
 		err, usage = aliImageHandler(c, resp, info)
 	case constant.RelayModeEmbeddings:
 		err, usage = aliEmbeddingHandler(c, resp)
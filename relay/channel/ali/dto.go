@@ -83,6 +83,20 @@ type AliResponse struct {
 	AliError
 }
 
+// AliImageEditRequest 通用图像编辑请求，图片以 base64 data URL 传递
+type AliImageEditRequest struct {
+	Model string `json:"model"`
+	Input struct {
+		Function     string `json:"function"`
+		Prompt       string `json:"prompt"`
+		BaseImageUrl string `json:"base_image_url"`
+		MaskImageUrl string `json:"mask_image_url,omitempty"`
+	} `json:"input"`
+	Parameters struct {
+		N int `json:"n,omitempty"`
+	} `json:"parameters,omitempty"`
+}
+
 type AliImageRequest struct {
 	Model string `json:"model"`
 	Input struct {
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"one-api/common"
 	"one-api/dto"
@@ -26,6 +27,40 @@ func oaiImage2Ali(request dto.ImageRequest) *AliImageRequest {
 	return &imageRequest
 }
 
+// oaiImageEdit2Ali 有 mask 时使用局部重绘，否则按指令编辑，可以通过表单字段 function 指定其他编辑功能
+func oaiImageEdit2Ali(c *gin.Context, request dto.ImageEditRequest) (*AliImageEditRequest, error) {
+	var imageRequest AliImageEditRequest
+	imageRequest.Model = request.Model
+	imageRequest.Input.Prompt = request.Prompt
+	imageRequest.Parameters.N = request.N
+	baseImage, err := fileHeaderToDataUrl(request.Images[0])
+	if err != nil {
+		return nil, err
+	}
+	imageRequest.Input.BaseImageUrl = baseImage
+	imageRequest.Input.Function = "description_edit"
+	if request.Mask != nil {
+		maskImage, err := fileHeaderToDataUrl(request.Mask)
+		if err != nil {
+			return nil, err
+		}
+		imageRequest.Input.MaskImageUrl = maskImage
+		imageRequest.Input.Function = "description_edit_with_mask"
+	}
+	if function := c.PostForm("function"); function != "" {
+		imageRequest.Input.Function = function
+	}
+	return &imageRequest, nil
+}
+
+func fileHeaderToDataUrl(header *multipart.FileHeader) (string, error) {
+	mimeType, data, err := service.EncodeImageFileBase64(header)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("data:%s;base64,%s", mimeType, data), nil
+}
+
 func updateTask(info *relaycommon.RelayInfo, taskID string) (*AliResponse, error, []byte) {
 	url := fmt.Sprintf("%s/api/v1/tasks/%s", info.BaseUrl, taskID)
 
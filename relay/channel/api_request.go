@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
 	"io"
 	"net/http"
 	common2 "one-api/common"
@@ -14,7 +17,8 @@ import (
 )
 
 func SetupApiRequestHeader(info *common.RelayInfo, c *gin.Context, req *http.Header) {
-	if info.RelayMode == constant.RelayModeAudioTranscription || info.RelayMode == constant.RelayModeAudioTranslation {
+	if info.RelayMode == constant.RelayModeAudioTranscription || info.RelayMode == constant.RelayModeAudioTranslation ||
+		info.RelayMode == constant.RelayModeImagesEdits || info.RelayMode == constant.RelayModeImagesVariations {
 		// multipart/form-data
 	} else if info.RelayMode == constant.RelayModeRealtime {
 		// websocket
@@ -51,6 +55,11 @@ func DoApiRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, requestBody
 }
 
 func DoFormRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, requestBody io.Reader) (*http.Response, error) {
+	return DoMultipartRequest(a, c, info, requestBody, c.Request.Header.Get("Content-Type"))
+}
+
+// DoMultipartRequest 使用适配器重新构造的 multipart 表单的 Content-Type 发送请求，不修改客户端的请求头
+func DoMultipartRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, requestBody io.Reader, contentType string) (*http.Response, error) {
 	fullRequestURL, err := a.GetRequestURL(info)
 	if err != nil {
 		return nil, fmt.Errorf("get request url failed: %w", err)
@@ -60,7 +69,7 @@ func DoFormRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, requestBod
 		return nil, fmt.Errorf("new request failed: %w", err)
 	}
 	// set form data
-	req.Header.Set("Content-Type", c.Request.Header.Get("Content-Type"))
+	req.Header.Set("Content-Type", contentType)
 
 	err = a.SetupRequestHeader(c, &req.Header, info)
 	if err != nil {
@@ -105,13 +114,24 @@ func doRequest(c *gin.Context, req *http.Request, info *common.RelayInfo) (*http
 	} else {
 		client = service.GetHttpClient()
 	}
+	// span 只覆盖到收到上游响应头为止，流式响应的读取计入外层的 relay.attempt
+	ctx, span := common2.StartSpan(c.Request.Context(), "upstream.request",
+		attribute.String("http.request.method", req.Method),
+		attribute.String("server.address", req.URL.Host),
+	)
+	// 向上游传递 traceparent，便于与上游的链路关联
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
 	resp, err := client.Do(req)
 	if err != nil {
+		common2.EndSpan(span, err)
 		return nil, err
 	}
 	if resp == nil {
+		common2.EndSpan(span, errors.New("resp is nil"))
 		return nil, errors.New("resp is nil")
 	}
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	span.End()
 	_ = req.Body.Close()
 	_ = c.Request.Body.Close()
 	return resp, nil
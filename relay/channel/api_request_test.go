@@ -0,0 +1,59 @@
+package channel
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"one-api/relay/common"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestDoRequestInjectsTraceparent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	oldProvider, oldPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider())
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(oldProvider)
+		otel.SetTextMapPropagator(oldPropagator)
+	})
+
+	var traceparent string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "relay")
+	defer parent.End()
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader("{}")).WithContext(ctx)
+	req, err := http.NewRequest(http.MethodPost, upstream.URL, strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := doRequest(c, req, &common.RelayInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+
+	// traceparent 格式为 version-traceid-spanid-flags，trace id 与入站请求一致，span id 为 upstream.request
+	fields := strings.Split(traceparent, "-")
+	if len(fields) != 4 {
+		t.Fatalf("traceparent = %q", traceparent)
+	}
+	if fields[1] != parent.SpanContext().TraceID().String() {
+		t.Errorf("trace id = %s, want %s", fields[1], parent.SpanContext().TraceID())
+	}
+	if fields[2] == parent.SpanContext().SpanID().String() {
+		t.Error("traceparent should carry the upstream.request span, not the parent span")
+	}
+}
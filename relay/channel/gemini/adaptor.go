@@ -1,6 +1,7 @@
 package gemini
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,6 +11,7 @@ import (
 	"one-api/dto"
 	"one-api/relay/channel"
 	relaycommon "one-api/relay/common"
+	"one-api/relay/constant"
 	"one-api/service"
 	"one-api/setting/model_setting"
 
@@ -65,6 +67,45 @@ func (a *Adaptor) ConvertImageRequest(c *gin.Context, info *relaycommon.RelayInf
 	return geminiRequest, nil
 }
 
+// ConvertImageEditRequest 图片编辑使用支持图片输出的 Gemini 模型，将图片和提示词作为 generateContent 的输入，
+// 不支持变体、mask 和一次生成多张
+func (a *Adaptor) ConvertImageEditRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.ImageEditRequest) (io.Reader, error) {
+	if info.RelayMode != constant.RelayModeImagesEdits {
+		return nil, fmt.Errorf("%w: gemini channel only supports image edits", channel.ErrUnsupportedImageOperation)
+	}
+	if !isGeminiImageOutputModel(info.UpstreamModelName) {
+		return nil, fmt.Errorf("%w: model %s does not support image edits", channel.ErrUnsupportedImageOperation, info.UpstreamModelName)
+	}
+	if request.Mask != nil || request.N > 1 {
+		return nil, fmt.Errorf("%w: gemini image edits do not support mask or n > 1", channel.ErrUnsupportedImageOperation)
+	}
+	content := GeminiChatContent{Role: "user"}
+	for _, header := range request.Images {
+		mimeType, data, err := service.EncodeImageFileBase64(header)
+		if err != nil {
+			return nil, err
+		}
+		content.Parts = append(content.Parts, GeminiPart{InlineData: &GeminiInlineData{MimeType: mimeType, Data: data}})
+	}
+	content.Parts = append(content.Parts, GeminiPart{Text: request.Prompt})
+	geminiRequest := GeminiChatRequest{
+		Contents: []GeminiChatContent{content},
+		GenerationConfig: GeminiChatGenerationConfig{
+			ResponseModalities: []string{"TEXT", "IMAGE"},
+		},
+	}
+	jsonData, err := json.Marshal(geminiRequest)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(jsonData), nil
+}
+
+// isGeminiImageOutputModel 判断是否为可以输出图片的 Gemini 模型，例如 gemini-2.0-flash-exp-image-generation
+func isGeminiImageOutputModel(modelName string) bool {
+	return strings.HasPrefix(modelName, "gemini") && strings.Contains(modelName, "image")
+}
+
 func (a *Adaptor) Init(info *relaycommon.RelayInfo) {
 
 }
@@ -91,6 +132,10 @@ func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
 
 func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Header, info *relaycommon.RelayInfo) error {
 	channel.SetupApiRequestHeader(info, c, req)
+	if info.RelayMode == constant.RelayModeImagesEdits {
+		// 客户端上传的是 multipart 表单，转发给上游的是 JSON
+		req.Set("Content-Type", "application/json")
+	}
 	req.Set("x-goog-api-key", info.ApiKey)
 	return nil
 }
@@ -152,6 +197,9 @@ func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycom
 	if strings.HasPrefix(info.UpstreamModelName, "imagen") {
 		return GeminiImageHandler(c, resp, info)
 	}
+	if info.RelayMode == constant.RelayModeImagesEdits {
+		return GeminiImageEditHandler(c, resp, info)
+	}
 
 	// check if the model is an embedding model
 	if strings.HasPrefix(info.UpstreamModelName, "text-embedding") ||
@@ -160,6 +208,15 @@ func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycom
 		return GeminiEmbeddingHandler(c, resp, info)
 	}
 
+	if info.RelayFormat == relaycommon.RelayFormatGemini {
+		if info.IsStream {
+			err, usage = GeminiNativeStreamHandler(c, resp, info)
+		} else {
+			err, usage = GeminiNativeHandler(c, resp, info)
+		}
+		return
+	}
+
 	if info.IsStream {
 		err, usage = GeminiChatStreamHandler(c, resp, info)
 	} else {
@@ -222,6 +279,52 @@ func GeminiImageHandler(c *gin.Context, resp *http.Response, info *relaycommon.R
 	return usage, nil
 }
 
+// GeminiImageEditHandler 将 generateContent 返回的图片转换为 OpenAI 图片响应，文本内容作为 revised_prompt
+func GeminiImageEditHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage any, err *dto.OpenAIErrorWithStatusCode) {
+	responseBody, readErr := io.ReadAll(resp.Body)
+	if readErr != nil {
+		return nil, service.OpenAIErrorWrapper(readErr, "read_response_body_failed", http.StatusInternalServerError)
+	}
+	_ = resp.Body.Close()
+
+	var geminiResponse GeminiChatResponse
+	if jsonErr := json.Unmarshal(responseBody, &geminiResponse); jsonErr != nil {
+		return nil, service.OpenAIErrorWrapper(jsonErr, "unmarshal_response_body_failed", http.StatusInternalServerError)
+	}
+
+	openAIResponse := dto.ImageResponse{
+		Created: common.GetTimestamp(),
+	}
+	var revisedPrompt strings.Builder
+	for _, candidate := range geminiResponse.Candidates {
+		for _, part := range candidate.Content.Parts {
+			if part.InlineData != nil && strings.HasPrefix(part.InlineData.MimeType, "image/") {
+				openAIResponse.Data = append(openAIResponse.Data, dto.ImageData{B64Json: part.InlineData.Data})
+			} else if part.Text != "" {
+				revisedPrompt.WriteString(part.Text)
+			}
+		}
+	}
+	if len(openAIResponse.Data) == 0 {
+		return nil, service.OpenAIErrorWrapper(errors.New("no images generated"), "no_images", http.StatusBadRequest)
+	}
+	openAIResponse.Data[0].RevisedPrompt = revisedPrompt.String()
+
+	jsonResponse, jsonErr := json.Marshal(openAIResponse)
+	if jsonErr != nil {
+		return nil, service.OpenAIErrorWrapper(jsonErr, "marshal_response_failed", http.StatusInternalServerError)
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, _ = c.Writer.Write(jsonResponse)
+
+	return &dto.Usage{
+		PromptTokens:     geminiResponse.UsageMetadata.PromptTokenCount,
+		CompletionTokens: geminiResponse.UsageMetadata.CandidatesTokenCount,
+		TotalTokens:      geminiResponse.UsageMetadata.TotalTokenCount,
+	}, nil
+}
+
 func (a *Adaptor) GetModelList() []string {
 	return ModelList
 }
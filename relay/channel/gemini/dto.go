@@ -23,9 +23,10 @@ type GeminiFunctionResponseContent struct {
 	Content any    `json:"content"`
 }
 
+// FunctionResponse Response 为任意 JSON 对象，转换 OpenAI 请求时使用 GeminiFunctionResponseContent
 type FunctionResponse struct {
-	Name     string                        `json:"name"`
-	Response GeminiFunctionResponseContent `json:"response"`
+	Name     string `json:"name"`
+	Response any    `json:"response"`
 }
 
 type GeminiPartExecutableCode struct {
@@ -80,6 +81,8 @@ type GeminiChatGenerationConfig struct {
 	ResponseMimeType string   `json:"responseMimeType,omitempty"`
 	ResponseSchema   any      `json:"responseSchema,omitempty"`
 	Seed             int64    `json:"seed,omitempty"`
+	// ResponseModalities 图片生成模型需要同时指定 TEXT 和 IMAGE
+	ResponseModalities []string `json:"responseModalities,omitempty"`
 }
 
 type GeminiChatCandidate struct {
@@ -0,0 +1,103 @@
+package gemini
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"one-api/dto"
+	"one-api/relay/channel"
+	relaycommon "one-api/relay/common"
+	"one-api/relay/constant"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestImageHeader(t *testing.T) *multipart.FileHeader {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, _ := writer.CreateFormFile("image", "a.png")
+	_, _ = part.Write([]byte("\x89PNG\r\n\x1a\nfake"))
+	_ = writer.Close()
+	form, err := multipart.NewReader(&body, writer.Boundary()).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return form.File["image"][0]
+}
+
+func TestConvertImageEditRequest(t *testing.T) {
+	image := newTestImageHeader(t)
+	tests := []struct {
+		name        string
+		relayMode   int
+		model       string
+		request     dto.ImageEditRequest
+		unsupported bool
+	}{
+		{name: "edit", relayMode: constant.RelayModeImagesEdits, model: "gemini-2.0-flash-exp-image-generation",
+			request: dto.ImageEditRequest{Prompt: "add a hat", N: 1, Images: []*multipart.FileHeader{image}}},
+		{name: "variation", relayMode: constant.RelayModeImagesVariations, model: "gemini-2.0-flash-exp-image-generation",
+			request: dto.ImageEditRequest{N: 1, Images: []*multipart.FileHeader{image}}, unsupported: true},
+		{name: "text model", relayMode: constant.RelayModeImagesEdits, model: "gemini-2.0-flash",
+			request: dto.ImageEditRequest{Prompt: "add a hat", N: 1, Images: []*multipart.FileHeader{image}}, unsupported: true},
+		{name: "mask", relayMode: constant.RelayModeImagesEdits, model: "gemini-2.0-flash-exp-image-generation",
+			request: dto.ImageEditRequest{Prompt: "add a hat", N: 1, Images: []*multipart.FileHeader{image}, Mask: image}, unsupported: true},
+		{name: "multiple outputs", relayMode: constant.RelayModeImagesEdits, model: "gemini-2.0-flash-exp-image-generation",
+			request: dto.ImageEditRequest{Prompt: "add a hat", N: 2, Images: []*multipart.FileHeader{image}}, unsupported: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := &relaycommon.RelayInfo{RelayMode: tt.relayMode, UpstreamModelName: tt.model}
+			body, err := (&Adaptor{}).ConvertImageEditRequest(nil, info, tt.request)
+			if tt.unsupported {
+				if !errors.Is(err, channel.ErrUnsupportedImageOperation) {
+					t.Fatalf("err = %v, want unsupported operation", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var request GeminiChatRequest
+			data, _ := io.ReadAll(body)
+			if err = json.Unmarshal(data, &request); err != nil {
+				t.Fatal(err)
+			}
+			parts := request.Contents[0].Parts
+			if len(parts) != 2 || parts[0].InlineData == nil || parts[0].InlineData.MimeType != "image/png" || parts[1].Text != "add a hat" {
+				t.Errorf("unexpected parts: %s", data)
+			}
+		})
+	}
+}
+
+func TestGeminiImageEditHandler(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Body: io.NopCloser(bytes.NewBufferString(`{"candidates":[{"content":{"parts":[
+			{"text":"here you go"},{"inlineData":{"mimeType":"image/png","data":"aGVsbG8="}}]}}],
+			"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":1290,"totalTokenCount":1300}}`)),
+	}
+	usage, err := GeminiImageEditHandler(c, resp, &relaycommon.RelayInfo{})
+	if err != nil {
+		t.Fatal(err.Error)
+	}
+	var response dto.ImageResponse
+	if jsonErr := json.Unmarshal(recorder.Body.Bytes(), &response); jsonErr != nil {
+		t.Fatal(jsonErr)
+	}
+	if len(response.Data) != 1 || response.Data[0].B64Json != "aGVsbG8=" || response.Data[0].RevisedPrompt != "here you go" {
+		t.Errorf("unexpected response: %s", recorder.Body.String())
+	}
+	if usage.(*dto.Usage).TotalTokens != 1300 {
+		t.Errorf("usage = %+v", usage)
+	}
+}
@@ -0,0 +1,451 @@
+package gemini
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/dto"
+	relaycommon "one-api/relay/common"
+	"one-api/relay/helper"
+	"one-api/service"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UnmarshalJSON 兼容官方 SDK 使用的驼峰字段名
+func (r *GeminiChatRequest) UnmarshalJSON(data []byte) error {
+	type geminiChatRequest GeminiChatRequest
+	var request struct {
+		geminiChatRequest
+		SafetySettingsCamel    []GeminiChatSafetySettings  `json:"safetySettings"`
+		GenerationConfigCamel  *GeminiChatGenerationConfig `json:"generationConfig"`
+		SystemInstructionCamel *GeminiChatContent          `json:"systemInstruction"`
+	}
+	if err := json.Unmarshal(data, &request); err != nil {
+		return err
+	}
+	*r = GeminiChatRequest(request.geminiChatRequest)
+	if request.SafetySettingsCamel != nil {
+		r.SafetySettings = request.SafetySettingsCamel
+	}
+	if request.GenerationConfigCamel != nil {
+		r.GenerationConfig = *request.GenerationConfigCamel
+	}
+	if request.SystemInstructionCamel != nil {
+		r.SystemInstructions = request.SystemInstructionCamel
+	}
+	return nil
+}
+
+// GeminiRequest2OpenAI 将 Gemini 原生请求转换为 OpenAI 请求，是 CovertGemini2OpenAI 的逆向映射
+func GeminiRequest2OpenAI(request *GeminiChatRequest, modelName string, stream bool) (*dto.GeneralOpenAIRequest, error) {
+	textRequest := &dto.GeneralOpenAIRequest{
+		Model:       modelName,
+		Stream:      stream,
+		Temperature: request.GenerationConfig.Temperature,
+		TopP:        request.GenerationConfig.TopP,
+		TopK:        int(request.GenerationConfig.TopK),
+		MaxTokens:   request.GenerationConfig.MaxOutputTokens,
+		N:           request.GenerationConfig.CandidateCount,
+		Seed:        float64(request.GenerationConfig.Seed),
+	}
+	if len(request.GenerationConfig.StopSequences) > 0 {
+		textRequest.Stop = request.GenerationConfig.StopSequences
+	}
+	if request.GenerationConfig.ResponseMimeType == "application/json" {
+		if request.GenerationConfig.ResponseSchema != nil {
+			textRequest.ResponseFormat = &dto.ResponseFormat{
+				Type: "json_schema",
+				JsonSchema: &dto.FormatJsonSchema{
+					Name:   "response",
+					Schema: request.GenerationConfig.ResponseSchema,
+				},
+			}
+		} else {
+			textRequest.ResponseFormat = &dto.ResponseFormat{Type: "json_object"}
+		}
+	}
+
+	for _, tool := range request.Tools {
+		// googleSearch、codeExecution 以同名函数传递，与 CovertGemini2OpenAI 对应
+		if tool.GoogleSearch != nil || tool.GoogleSearchRetrieval != nil {
+			textRequest.Tools = append(textRequest.Tools, dto.ToolCallRequest{
+				Type:     "function",
+				Function: dto.FunctionRequest{Name: "googleSearch"},
+			})
+		}
+		if tool.CodeExecution != nil {
+			textRequest.Tools = append(textRequest.Tools, dto.ToolCallRequest{
+				Type:     "function",
+				Function: dto.FunctionRequest{Name: "codeExecution"},
+			})
+		}
+		if tool.FunctionDeclarations != nil {
+			declarations, err := json.Marshal(tool.FunctionDeclarations)
+			if err != nil {
+				return nil, err
+			}
+			var functions []dto.FunctionRequest
+			if err := json.Unmarshal(declarations, &functions); err != nil {
+				return nil, fmt.Errorf("invalid function declarations: %s", err.Error())
+			}
+			for _, function := range functions {
+				textRequest.Tools = append(textRequest.Tools, dto.ToolCallRequest{
+					Type:     "function",
+					Function: function,
+				})
+			}
+		}
+	}
+
+	if request.SystemInstructions != nil {
+		var texts []string
+		for _, part := range request.SystemInstructions.Parts {
+			if part.Text != "" {
+				texts = append(texts, part.Text)
+			}
+		}
+		if len(texts) > 0 {
+			message := dto.Message{Role: "system"}
+			message.SetStringContent(strings.Join(texts, "\n"))
+			textRequest.Messages = append(textRequest.Messages, message)
+		}
+	}
+
+	// Gemini 的函数调用没有 id，按函数名依次对应调用和结果
+	toolCallIds := make(map[string][]string)
+	for _, content := range request.Contents {
+		role := "user"
+		if content.Role == "model" {
+			role = "assistant"
+		}
+		var mediaContents []dto.MediaContent
+		var toolCalls []dto.ToolCallRequest
+		for _, part := range content.Parts {
+			switch {
+			case part.FunctionCall != nil:
+				args, err := json.Marshal(part.FunctionCall.Arguments)
+				if err != nil {
+					return nil, err
+				}
+				id := fmt.Sprintf("call_%s", common.GetUUID())
+				toolCallIds[part.FunctionCall.FunctionName] = append(toolCallIds[part.FunctionCall.FunctionName], id)
+				toolCalls = append(toolCalls, dto.ToolCallRequest{
+					ID:   id,
+					Type: "function",
+					Function: dto.FunctionRequest{
+						Name:      part.FunctionCall.FunctionName,
+						Arguments: string(args),
+					},
+				})
+			case part.FunctionResponse != nil:
+				name := part.FunctionResponse.Name
+				id := ""
+				if ids := toolCallIds[name]; len(ids) > 0 {
+					id, toolCallIds[name] = ids[0], ids[1:]
+				}
+				result, err := json.Marshal(part.FunctionResponse.Response)
+				if err != nil {
+					return nil, err
+				}
+				message := dto.Message{Role: "tool", Name: &name, ToolCallId: id}
+				message.SetStringContent(string(result))
+				textRequest.Messages = append(textRequest.Messages, message)
+			case part.InlineData != nil:
+				mediaContents = append(mediaContents, inlineData2MediaContent(part.InlineData))
+			case part.FileData != nil:
+				mediaContents = append(mediaContents, dto.MediaContent{
+					Type:     dto.ContentTypeImageURL,
+					ImageUrl: &dto.MessageImageUrl{Url: part.FileData.FileUri, Detail: "auto"},
+				})
+			case part.ExecutableCode != nil:
+				mediaContents = append(mediaContents, dto.MediaContent{
+					Type: dto.ContentTypeText,
+					Text: "```" + part.ExecutableCode.Language + "\n" + part.ExecutableCode.Code + "\n```",
+				})
+			case part.CodeExecutionResult != nil:
+				mediaContents = append(mediaContents, dto.MediaContent{
+					Type: dto.ContentTypeText,
+					Text: "```output\n" + part.CodeExecutionResult.Output + "\n```",
+				})
+			case part.Text != "":
+				mediaContents = append(mediaContents, dto.MediaContent{Type: dto.ContentTypeText, Text: part.Text})
+			}
+		}
+		if len(mediaContents) == 0 && len(toolCalls) == 0 {
+			continue
+		}
+		message := dto.Message{Role: role}
+		if len(mediaContents) == 1 && mediaContents[0].Type == dto.ContentTypeText {
+			message.SetStringContent(mediaContents[0].Text)
+		} else if len(mediaContents) > 0 {
+			message.SetMediaContent(mediaContents)
+		}
+		if len(toolCalls) > 0 {
+			message.SetToolCalls(toolCalls)
+		}
+		textRequest.Messages = append(textRequest.Messages, message)
+	}
+	if len(textRequest.Messages) == 0 {
+		return nil, fmt.Errorf("field contents is required")
+	}
+	return textRequest, nil
+}
+
+// inlineData2MediaContent 图片转换为 image_url，音频转换为 input_audio，其余作为文件
+func inlineData2MediaContent(data *GeminiInlineData) dto.MediaContent {
+	dataUrl := fmt.Sprintf("data:%s;base64,%s", data.MimeType, data.Data)
+	switch {
+	case strings.HasPrefix(data.MimeType, "image/"):
+		return dto.MediaContent{
+			Type:     dto.ContentTypeImageURL,
+			ImageUrl: &dto.MessageImageUrl{Url: dataUrl, Detail: "auto"},
+		}
+	case strings.HasPrefix(data.MimeType, "audio/"):
+		format := strings.TrimPrefix(data.MimeType, "audio/")
+		if format == "mpeg" {
+			format = "mp3"
+		}
+		return dto.MediaContent{
+			Type:       dto.ContentTypeInputAudio,
+			InputAudio: &dto.MessageInputAudio{Data: data.Data, Format: format},
+		}
+	default:
+		return dto.MediaContent{
+			Type: dto.ContentTypeFile,
+			File: &dto.MessageFile{FileData: dataUrl},
+		}
+	}
+}
+
+func finishReasonOpenAI2Gemini(reason string) string {
+	switch reason {
+	case constant.FinishReasonLength:
+		return "MAX_TOKENS"
+	case constant.FinishReasonContentFilter:
+		return "SAFETY"
+	default:
+		return "STOP"
+	}
+}
+
+func usageOpenAI2Gemini(usage *dto.Usage) GeminiUsageMetadata {
+	if usage == nil {
+		return GeminiUsageMetadata{}
+	}
+	return GeminiUsageMetadata{
+		PromptTokenCount:     usage.PromptTokens,
+		CandidatesTokenCount: usage.CompletionTokens,
+		TotalTokenCount:      usage.PromptTokens + usage.CompletionTokens,
+	}
+}
+
+// toolCall2GeminiPart 参数不是合法 JSON 时原样传递
+func toolCall2GeminiPart(name string, arguments string) GeminiPart {
+	var args any = map[string]any{}
+	if arguments != "" {
+		if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+			args = arguments
+		}
+	}
+	return GeminiPart{
+		FunctionCall: &FunctionCall{
+			FunctionName: name,
+			Arguments:    args,
+		},
+	}
+}
+
+// ResponseOpenAI2Gemini 将 OpenAI 非流式响应转换为 Gemini 响应，usage 为空时使用响应中的用量
+func ResponseOpenAI2Gemini(response *dto.OpenAITextResponse, usage *dto.Usage) *GeminiChatResponse {
+	if usage == nil {
+		usage = &response.Usage
+	}
+	geminiResponse := &GeminiChatResponse{
+		Candidates:    make([]GeminiChatCandidate, 0, len(response.Choices)),
+		UsageMetadata: usageOpenAI2Gemini(usage),
+	}
+	for _, choice := range response.Choices {
+		candidate := GeminiChatCandidate{
+			Index: int64(choice.Index),
+			Content: GeminiChatContent{
+				Role:  "model",
+				Parts: make([]GeminiPart, 0),
+			},
+		}
+		if text := choice.Message.StringContent(); text != "" {
+			candidate.Content.Parts = append(candidate.Content.Parts, GeminiPart{Text: text})
+		}
+		for _, call := range choice.Message.ParseToolCalls() {
+			candidate.Content.Parts = append(candidate.Content.Parts, toolCall2GeminiPart(call.Function.Name, call.Function.Arguments))
+		}
+		finishReason := finishReasonOpenAI2Gemini(choice.FinishReason)
+		candidate.FinishReason = &finishReason
+		geminiResponse.Candidates = append(geminiResponse.Candidates, candidate)
+	}
+	return geminiResponse
+}
+
+type geminiStreamToolCall struct {
+	name      string
+	arguments strings.Builder
+}
+
+// GeminiStreamConverter 将 OpenAI 流式响应逐个转换为 Gemini 流式响应，
+// 函数调用的参数分段返回，累积到结束时一次输出
+type GeminiStreamConverter struct {
+	toolCalls     map[int][]*geminiStreamToolCall
+	finishReasons map[int]string
+}
+
+func NewGeminiStreamConverter() *GeminiStreamConverter {
+	return &GeminiStreamConverter{
+		toolCalls:     make(map[int][]*geminiStreamToolCall),
+		finishReasons: make(map[int]string),
+	}
+}
+
+// Convert 没有需要输出的文本时返回 nil
+func (s *GeminiStreamConverter) Convert(chunk *dto.ChatCompletionsStreamResponse) *GeminiChatResponse {
+	var candidates []GeminiChatCandidate
+	for _, choice := range chunk.Choices {
+		for _, call := range choice.Delta.ToolCalls {
+			idx := 0
+			if call.Index != nil {
+				idx = *call.Index
+			}
+			calls := s.toolCalls[choice.Index]
+			for len(calls) <= idx {
+				calls = append(calls, &geminiStreamToolCall{})
+			}
+			if call.Function.Name != "" {
+				calls[idx].name = call.Function.Name
+			}
+			calls[idx].arguments.WriteString(call.Function.Arguments)
+			s.toolCalls[choice.Index] = calls
+		}
+		if choice.FinishReason != nil {
+			s.finishReasons[choice.Index] = finishReasonOpenAI2Gemini(*choice.FinishReason)
+		}
+		if text := choice.Delta.GetContentString(); text != "" {
+			candidates = append(candidates, GeminiChatCandidate{
+				Index: int64(choice.Index),
+				Content: GeminiChatContent{
+					Role:  "model",
+					Parts: []GeminiPart{{Text: text}},
+				},
+			})
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	return &GeminiChatResponse{Candidates: candidates}
+}
+
+// Finish 输出累积的函数调用、结束原因和用量
+func (s *GeminiStreamConverter) Finish(usage *dto.Usage) *GeminiChatResponse {
+	indexes := make(map[int]bool)
+	for idx := range s.toolCalls {
+		indexes[idx] = true
+	}
+	for idx := range s.finishReasons {
+		indexes[idx] = true
+	}
+	if len(indexes) == 0 {
+		indexes[0] = true
+	}
+	sorted := make([]int, 0, len(indexes))
+	for idx := range indexes {
+		sorted = append(sorted, idx)
+	}
+	sort.Ints(sorted)
+
+	response := &GeminiChatResponse{
+		Candidates:    make([]GeminiChatCandidate, 0, len(sorted)),
+		UsageMetadata: usageOpenAI2Gemini(usage),
+	}
+	for _, idx := range sorted {
+		parts := make([]GeminiPart, 0, len(s.toolCalls[idx]))
+		for _, call := range s.toolCalls[idx] {
+			parts = append(parts, toolCall2GeminiPart(call.name, call.arguments.String()))
+		}
+		finishReason, ok := s.finishReasons[idx]
+		if !ok {
+			finishReason = "STOP"
+		}
+		response.Candidates = append(response.Candidates, GeminiChatCandidate{
+			Index: int64(idx),
+			Content: GeminiChatContent{
+				Role:  "model",
+				Parts: parts,
+			},
+			FinishReason: &finishReason,
+		})
+	}
+	return response
+}
+
+func geminiUsage(metadata GeminiUsageMetadata) *dto.Usage {
+	usage := &dto.Usage{
+		PromptTokens:     metadata.PromptTokenCount,
+		CompletionTokens: metadata.CandidatesTokenCount,
+		TotalTokens:      metadata.TotalTokenCount,
+	}
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	usage.PromptTokensDetails.TextTokens = usage.PromptTokens
+	usage.CompletionTokenDetails.TextTokens = usage.CompletionTokens
+	return usage
+}
+
+// GeminiNativeHandler 原样返回 Gemini 原生格式请求的响应，只解析用量
+func GeminiNativeHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	_ = resp.Body.Close()
+	var geminiResponse GeminiChatResponse
+	if err := json.Unmarshal(responseBody, &geminiResponse); err != nil {
+		return service.OpenAIErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	usage := geminiUsage(geminiResponse.UsageMetadata)
+	if usage.TotalTokens == 0 {
+		usage.PromptTokens = info.PromptTokens
+		usage.TotalTokens = info.PromptTokens
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, _ = c.Writer.Write(responseBody)
+	return nil, usage
+}
+
+// GeminiNativeStreamHandler 原样转发 Gemini 原生格式请求的流式响应，用量取最后一次返回的 usageMetadata
+func GeminiNativeStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	var metadata GeminiUsageMetadata
+	helper.StreamScannerHandler(c, resp, info, func(data string) bool {
+		var geminiResponse GeminiChatResponse
+		if err := json.Unmarshal([]byte(data), &geminiResponse); err != nil {
+			common.LogError(c, "error unmarshalling stream response: "+err.Error())
+		} else if geminiResponse.UsageMetadata.TotalTokenCount != 0 {
+			metadata = geminiResponse.UsageMetadata
+		}
+		if err := helper.StringData(c, data); err != nil {
+			common.LogError(c, err.Error())
+		}
+		return true
+	})
+	usage := geminiUsage(metadata)
+	if usage.TotalTokens == 0 {
+		usage.PromptTokens = info.PromptTokens
+		usage.TotalTokens = info.PromptTokens
+	}
+	return nil, usage
+}
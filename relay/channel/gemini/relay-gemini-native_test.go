@@ -0,0 +1,188 @@
+package gemini
+
+import (
+	"encoding/json"
+	"one-api/dto"
+	"strings"
+	"testing"
+)
+
+func TestGeminiChatRequestUnmarshalCamelCase(t *testing.T) {
+	var request GeminiChatRequest
+	err := json.Unmarshal([]byte(`{
+		"contents": [{"role": "user", "parts": [{"text": "hi"}]}],
+		"systemInstruction": {"parts": [{"text": "be brief"}]},
+		"generationConfig": {"maxOutputTokens": 64},
+		"safetySettings": [{"category": "HARM_CATEGORY_HARASSMENT", "threshold": "BLOCK_NONE"}]
+	}`), &request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.SystemInstructions == nil || request.SystemInstructions.Parts[0].Text != "be brief" {
+		t.Errorf("system instruction = %+v", request.SystemInstructions)
+	}
+	if request.GenerationConfig.MaxOutputTokens != 64 || len(request.SafetySettings) != 1 {
+		t.Errorf("generation config = %+v, safety settings = %+v", request.GenerationConfig, request.SafetySettings)
+	}
+	if len(request.Contents) != 1 || request.Contents[0].Parts[0].Text != "hi" {
+		t.Errorf("contents = %+v", request.Contents)
+	}
+}
+
+func TestGeminiRequest2OpenAI(t *testing.T) {
+	var request GeminiChatRequest
+	err := json.Unmarshal([]byte(`{
+		"systemInstruction": {"parts": [{"text": "be brief"}]},
+		"contents": [
+			{"role": "user", "parts": [
+				{"text": "what is this?"},
+				{"inlineData": {"mimeType": "image/png", "data": "AAAA"}}
+			]},
+			{"role": "model", "parts": [
+				{"functionCall": {"name": "lookup", "args": {"q": "a"}}},
+				{"functionCall": {"name": "lookup", "args": {"q": "b"}}}
+			]},
+			{"role": "user", "parts": [
+				{"functionResponse": {"name": "lookup", "response": {"r": 1}}},
+				{"functionResponse": {"name": "lookup", "response": {"r": 2}}}
+			]}
+		],
+		"tools": [{"functionDeclarations": [{"name": "lookup", "description": "search"}]}, {"googleSearch": {}}],
+		"generationConfig": {"maxOutputTokens": 64, "responseMimeType": "application/json", "stopSequences": ["END"]}
+	}`), &request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	textRequest, err := GeminiRequest2OpenAI(&request, "gemini-2.0-flash", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if textRequest.Model != "gemini-2.0-flash" || !textRequest.Stream || textRequest.MaxTokens != 64 {
+		t.Errorf("request = %+v", textRequest)
+	}
+	if textRequest.ResponseFormat == nil || textRequest.ResponseFormat.Type != "json_object" {
+		t.Errorf("response_format = %+v", textRequest.ResponseFormat)
+	}
+	if len(textRequest.Tools) != 2 || textRequest.Tools[0].Function.Name != "lookup" || textRequest.Tools[1].Function.Name != "googleSearch" {
+		t.Errorf("tools = %+v", textRequest.Tools)
+	}
+
+	messages := textRequest.Messages
+	roles := make([]string, 0, len(messages))
+	for _, message := range messages {
+		roles = append(roles, message.Role)
+	}
+	if got := strings.Join(roles, ","); got != "system,user,assistant,tool,tool" {
+		t.Fatalf("roles = %s", got)
+	}
+	contents := messages[1].ParseContent()
+	if len(contents) != 2 || contents[1].GetImageMedia().Url != "data:image/png;base64,AAAA" {
+		t.Errorf("user contents = %+v", contents)
+	}
+	// 函数结果按函数名依次对应调用的 id
+	toolCalls := messages[2].ParseToolCalls()
+	if len(toolCalls) != 2 || toolCalls[0].Function.Arguments != `{"q":"a"}` {
+		t.Fatalf("tool calls = %+v", toolCalls)
+	}
+	if messages[3].ToolCallId != toolCalls[0].ID || messages[4].ToolCallId != toolCalls[1].ID {
+		t.Errorf("tool call ids = %s, %s, want %s, %s", messages[3].ToolCallId, messages[4].ToolCallId, toolCalls[0].ID, toolCalls[1].ID)
+	}
+	if messages[4].StringContent() != `{"r":2}` {
+		t.Errorf("tool result = %s", messages[4].StringContent())
+	}
+}
+
+func TestGeminiRequest2OpenAIEmpty(t *testing.T) {
+	if _, err := GeminiRequest2OpenAI(&GeminiChatRequest{}, "gemini-2.0-flash", false); err == nil {
+		t.Error("expected error for empty contents")
+	}
+}
+
+func TestInlineData2MediaContent(t *testing.T) {
+	tests := []struct {
+		mimeType    string
+		contentType string
+	}{
+		{"image/jpeg", dto.ContentTypeImageURL},
+		{"audio/mpeg", dto.ContentTypeInputAudio},
+		{"application/pdf", dto.ContentTypeFile},
+	}
+	for _, tt := range tests {
+		content := inlineData2MediaContent(&GeminiInlineData{MimeType: tt.mimeType, Data: "AAAA"})
+		if content.Type != tt.contentType {
+			t.Errorf("%s type = %s, want %s", tt.mimeType, content.Type, tt.contentType)
+		}
+	}
+	audio, ok := inlineData2MediaContent(&GeminiInlineData{MimeType: "audio/mpeg", Data: "AAAA"}).InputAudio.(*dto.MessageInputAudio)
+	if !ok || audio.Format != "mp3" {
+		t.Errorf("input audio = %+v", audio)
+	}
+}
+
+func TestResponseOpenAI2Gemini(t *testing.T) {
+	var response dto.OpenAITextResponse
+	err := json.Unmarshal([]byte(`{
+		"choices": [{
+			"message": {
+				"role": "assistant",
+				"content": "hello",
+				"tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "lookup", "arguments": "{\"q\":\"a\"}"}}]
+			},
+			"finish_reason": "length"
+		}],
+		"usage": {"prompt_tokens": 3, "completion_tokens": 4}
+	}`), &response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	geminiResponse := ResponseOpenAI2Gemini(&response, nil)
+	if len(geminiResponse.Candidates) != 1 {
+		t.Fatalf("candidates = %+v", geminiResponse.Candidates)
+	}
+	candidate := geminiResponse.Candidates[0]
+	if *candidate.FinishReason != "MAX_TOKENS" || len(candidate.Content.Parts) != 2 || candidate.Content.Parts[0].Text != "hello" {
+		t.Errorf("candidate = %+v", candidate)
+	}
+	args, _ := json.Marshal(candidate.Content.Parts[1].FunctionCall.Arguments)
+	if string(args) != `{"q":"a"}` {
+		t.Errorf("function call args = %s", args)
+	}
+	if geminiResponse.UsageMetadata.TotalTokenCount != 7 {
+		t.Errorf("usage = %+v", geminiResponse.UsageMetadata)
+	}
+}
+
+func TestGeminiStreamConverter(t *testing.T) {
+	converter := NewGeminiStreamConverter()
+	text := "hi"
+	index := 0
+	finishReason := "tool_calls"
+	chunks := []*dto.ChatCompletionsStreamResponse{
+		{Choices: []dto.ChatCompletionsStreamResponseChoice{{Delta: dto.ChatCompletionsStreamResponseChoiceDelta{Content: &text}}}},
+		{Choices: []dto.ChatCompletionsStreamResponseChoice{{Delta: dto.ChatCompletionsStreamResponseChoiceDelta{ToolCalls: []dto.ToolCallResponse{
+			{Index: &index, Function: dto.FunctionResponse{Name: "lookup", Arguments: `{"q":`}},
+		}}}}},
+		{Choices: []dto.ChatCompletionsStreamResponseChoice{{Delta: dto.ChatCompletionsStreamResponseChoiceDelta{ToolCalls: []dto.ToolCallResponse{
+			{Index: &index, Function: dto.FunctionResponse{Arguments: `"a"}`}},
+		}}, FinishReason: &finishReason}}},
+	}
+	wantText := []bool{true, false, false}
+	for i, chunk := range chunks {
+		response := converter.Convert(chunk)
+		if (response != nil) != wantText[i] {
+			t.Errorf("chunk %d response = %+v", i, response)
+		}
+	}
+	final := converter.Finish(&dto.Usage{PromptTokens: 1, CompletionTokens: 2})
+	if len(final.Candidates) != 1 || len(final.Candidates[0].Content.Parts) != 1 {
+		t.Fatalf("final = %+v", final)
+	}
+	call := final.Candidates[0].Content.Parts[0].FunctionCall
+	args, _ := json.Marshal(call.Arguments)
+	if call.FunctionName != "lookup" || string(args) != `{"q":"a"}` {
+		t.Errorf("function call = %s %s", call.FunctionName, args)
+	}
+	if *final.Candidates[0].FinishReason != "STOP" || final.UsageMetadata.TotalTokenCount != 3 {
+		t.Errorf("finish reason = %s, usage = %+v", *final.Candidates[0].FinishReason, final.UsageMetadata)
+	}
+}
@@ -30,6 +30,8 @@ import (
 type Adaptor struct {
 	ChannelType    int
 	ResponseFormat string
+	// formContentType ConvertImageEditRequest 重新构造的表单的 Content-Type
+	formContentType string
 }
 
 func (a *Adaptor) ConvertClaudeRequest(c *gin.Context, info *relaycommon.RelayInfo, request *dto.ClaudeRequest) (any, error) {
@@ -93,6 +95,9 @@ func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
 		if info.RelayMode == constant.RelayModeRealtime {
 			requestURL = fmt.Sprintf("/openai/realtime?deployment=%s&api-version=%s", model_, apiVersion)
 		}
+		if info.RelayMode == constant.RelayModeResponses {
+			requestURL = fmt.Sprintf("/openai/responses?api-version=%s", apiVersion)
+		}
 		return relaycommon.GetFullRequestURL(info.BaseUrl, requestURL, info.ChannelType), nil
 	case common.ChannelTypeMiniMax:
 		return minimax.GetRequestURL(info)
@@ -178,6 +183,29 @@ func (a *Adaptor) ConvertOpenAIRequest(c *gin.Context, info *relaycommon.RelayIn
 	return request, nil
 }
 
+func (a *Adaptor) ConvertOpenAIResponsesRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.OpenAIResponsesRequest) (any, error) {
+	if strings.HasPrefix(request.Model, "o1") || strings.HasPrefix(request.Model, "o3") || strings.HasPrefix(request.Model, "o4") {
+		effort := ""
+		if strings.HasSuffix(request.Model, "-high") {
+			effort = "high"
+		} else if strings.HasSuffix(request.Model, "-low") {
+			effort = "low"
+		} else if strings.HasSuffix(request.Model, "-medium") {
+			effort = "medium"
+		}
+		if effort != "" {
+			request.Model = strings.TrimSuffix(request.Model, "-"+effort)
+			if request.Reasoning == nil {
+				request.Reasoning = &dto.ResponsesReason{}
+			}
+			request.Reasoning.Effort = effort
+			info.ReasoningEffort = effort
+			info.UpstreamModelName = request.Model
+		}
+	}
+	return request, nil
+}
+
 func (a *Adaptor) ConvertRerankRequest(c *gin.Context, relayMode int, request dto.RerankRequest) (any, error) {
 	return request, nil
 }
@@ -239,9 +267,51 @@ func (a *Adaptor) ConvertImageRequest(c *gin.Context, info *relaycommon.RelayInf
 	return request, nil
 }
 
+// ConvertImageEditRequest 重新构造 multipart 表单，model 使用映射后的模型，其余字段和文件原样转发
+func (a *Adaptor) ConvertImageEditRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.ImageEditRequest) (io.Reader, error) {
+	var requestBody bytes.Buffer
+	writer := multipart.NewWriter(&requestBody)
+
+	writer.WriteField("model", request.Model)
+	for key, values := range c.Request.MultipartForm.Value {
+		if key == "model" {
+			continue
+		}
+		for _, value := range values {
+			writer.WriteField(key, value)
+		}
+	}
+	// 文件使用原始的 part 头，保留字段名、文件名和类型
+	for _, headers := range c.Request.MultipartForm.File {
+		for _, header := range headers {
+			file, err := header.Open()
+			if err != nil {
+				return nil, fmt.Errorf("open file %s failed: %w", header.Filename, err)
+			}
+			part, err := writer.CreatePart(header.Header)
+			if err != nil {
+				file.Close()
+				return nil, errors.New("create form file failed")
+			}
+			_, err = io.Copy(part, file)
+			file.Close()
+			if err != nil {
+				return nil, errors.New("copy file failed")
+			}
+		}
+	}
+
+	// 关闭 multipart 编写器以设置分界线
+	writer.Close()
+	a.formContentType = writer.FormDataContentType()
+	return &requestBody, nil
+}
+
 func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (any, error) {
 	if info.RelayMode == constant.RelayModeAudioTranscription || info.RelayMode == constant.RelayModeAudioTranslation {
 		return channel.DoFormRequest(a, c, info, requestBody)
+	} else if info.RelayMode == constant.RelayModeImagesEdits || info.RelayMode == constant.RelayModeImagesVariations {
+		return channel.DoMultipartRequest(a, c, info, requestBody, a.formContentType)
 	} else if info.RelayMode == constant.RelayModeRealtime {
 		return channel.DoWssRequest(a, c, info, requestBody)
 	} else {
@@ -259,10 +329,16 @@ func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycom
 		fallthrough
 	case constant.RelayModeAudioTranscription:
 		err, usage = OpenaiSTTHandler(c, resp, info, a.ResponseFormat)
-	case constant.RelayModeImagesGenerations:
+	case constant.RelayModeImagesGenerations, constant.RelayModeImagesEdits, constant.RelayModeImagesVariations:
 		err, usage = OpenaiTTSHandler(c, resp, info)
 	case constant.RelayModeRerank:
 		err, usage = common_handler.RerankHandler(c, info, resp)
+	case constant.RelayModeResponses:
+		if info.IsStream {
+			err, usage = OaiResponsesStreamHandler(c, resp, info)
+		} else {
+			err, usage = OaiResponsesHandler(c, resp, info)
+		}
 	default:
 		if info.IsStream {
 			err, usage = OaiStreamHandler(c, resp, info)
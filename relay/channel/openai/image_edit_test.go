@@ -0,0 +1,53 @@
+package openai
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"one-api/dto"
+	relaycommon "one-api/relay/common"
+	"one-api/relay/constant"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestConvertImageEditRequestKeepsClientHeader(t *testing.T) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	_ = writer.WriteField("model", "gpt-image-1")
+	_ = writer.WriteField("prompt", "add a hat")
+	part, _ := writer.CreateFormFile("image", "a.png")
+	_, _ = part.Write([]byte("png"))
+	_ = writer.Close()
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/images/edits", &body)
+	clientContentType := writer.FormDataContentType()
+	c.Request.Header.Set("Content-Type", clientContentType)
+	if err := c.Request.ParseMultipartForm(1 << 20); err != nil {
+		t.Fatal(err)
+	}
+
+	adaptor := &Adaptor{}
+	info := &relaycommon.RelayInfo{RelayMode: constant.RelayModeImagesEdits}
+	reader, err := adaptor.ConvertImageEditRequest(c, info, dto.ImageEditRequest{Model: "mapped-model"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Request.Header.Get("Content-Type"); got != clientContentType {
+		t.Errorf("client Content-Type changed to %s", got)
+	}
+	if !strings.HasPrefix(adaptor.formContentType, "multipart/form-data; boundary=") || adaptor.formContentType == clientContentType {
+		t.Errorf("formContentType = %s", adaptor.formContentType)
+	}
+	form, err := multipart.NewReader(reader, strings.TrimPrefix(adaptor.formContentType, "multipart/form-data; boundary=")).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if form.Value["model"][0] != "mapped-model" || form.Value["prompt"][0] != "add a hat" || len(form.File["image"]) != 1 {
+		t.Errorf("unexpected form: %+v", form.Value)
+	}
+}
@@ -0,0 +1,94 @@
+package openai
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"one-api/common"
+	"one-api/dto"
+	relaycommon "one-api/relay/common"
+	"one-api/relay/helper"
+	"one-api/service"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+func OaiResponsesHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	var responsesResponse dto.OpenAIResponsesResponse
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = common.DecodeJson(responseBody, &responsesResponse)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if responsesResponse.Error != nil && responsesResponse.Error.Type != "" {
+		return &dto.OpenAIErrorWithStatusCode{
+			Error:      *responsesResponse.Error,
+			StatusCode: resp.StatusCode,
+		}, nil
+	}
+
+	for k, v := range resp.Header {
+		c.Writer.Header().Set(k, v[0])
+	}
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, err = io.Copy(c.Writer, bytes.NewBuffer(responseBody))
+	if err != nil {
+		common.SysError("error copying response body: " + err.Error())
+	}
+
+	if responsesResponse.Usage != nil && responsesResponse.Usage.TotalTokens != 0 {
+		return nil, responsesResponse.Usage.ToUsage()
+	}
+	var responseTextBuilder strings.Builder
+	for _, output := range responsesResponse.Output {
+		for _, content := range output.Content {
+			responseTextBuilder.WriteString(content.Text)
+		}
+		responseTextBuilder.WriteString(output.Name)
+		responseTextBuilder.WriteString(output.Arguments)
+	}
+	usage, _ := service.ResponseText2Usage(responseTextBuilder.String(), info.UpstreamModelName, info.PromptTokens)
+	return nil, usage
+}
+
+func OaiResponsesStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	if resp == nil || resp.Body == nil {
+		common.LogError(c, "invalid response or response body")
+		return service.OpenAIErrorWrapper(fmt.Errorf("invalid response"), "invalid_response", http.StatusInternalServerError), nil
+	}
+
+	var usage *dto.Usage
+	var responseTextBuilder strings.Builder
+
+	helper.StreamScannerHandler(c, resp, info, func(data string) bool {
+		var streamResponse dto.ResponsesStreamResponse
+		if err := common.DecodeJsonStr(data, &streamResponse); err != nil {
+			common.SysError("error unmarshalling stream response: " + err.Error())
+			return true
+		}
+		helper.ResponseChunkData(c, streamResponse, data)
+		switch streamResponse.Type {
+		case dto.ResponsesEventOutputTextDelta, dto.ResponsesEventFunctionArgsDelta:
+			responseTextBuilder.WriteString(streamResponse.Delta)
+		case dto.ResponsesEventCompleted, dto.ResponsesEventIncomplete, dto.ResponsesEventFailed:
+			if streamResponse.Response != nil && streamResponse.Response.Usage != nil {
+				usage = streamResponse.Response.Usage.ToUsage()
+			}
+		}
+		return true
+	})
+
+	if !service.ValidUsage(usage) {
+		usage, _ = service.ResponseText2Usage(responseTextBuilder.String(), info.UpstreamModelName, info.PromptTokens)
+	}
+	return nil, usage
+}
@@ -0,0 +1,196 @@
+package kling
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"one-api/constant"
+	"one-api/dto"
+	"one-api/model"
+	"one-api/relay/channel"
+	"one-api/relay/channel/task"
+	relaycommon "one-api/relay/common"
+	"one-api/service"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+)
+
+type TaskAdaptor struct {
+	ChannelType int
+}
+
+func (a *TaskAdaptor) Init(info *relaycommon.TaskRelayInfo) {
+	a.ChannelType = info.ChannelType
+}
+
+func (a *TaskAdaptor) ValidateRequestAndSetAction(c *gin.Context, info *relaycommon.TaskRelayInfo) *dto.TaskError {
+	return task.ValidateVideoRequestAndSetAction(c, info)
+}
+
+// GetPriceMultiplier 按视频时长计价，可灵默认生成 5 秒视频
+func (a *TaskAdaptor) GetPriceMultiplier(c *gin.Context, info *relaycommon.TaskRelayInfo) float64 {
+	return task.VideoPriceMultiplier(c, 5)
+}
+
+func (a *TaskAdaptor) BuildRequestURL(info *relaycommon.TaskRelayInfo) (string, error) {
+	return fmt.Sprintf("%s/v1/videos/%s", info.BaseUrl, actionPath(info.Action)), nil
+}
+
+func (a *TaskAdaptor) BuildRequestHeader(c *gin.Context, req *http.Request, info *relaycommon.TaskRelayInfo) error {
+	token, err := getToken(info.ApiKey)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+func (a *TaskAdaptor) BuildRequestBody(c *gin.Context, info *relaycommon.TaskRelayInfo) (io.Reader, error) {
+	request, err := task.GetVideoRequest(c)
+	if err != nil {
+		return nil, err
+	}
+	klingRequest := Request{
+		ModelName:      info.UpstreamModelName,
+		Prompt:         request.Prompt,
+		NegativePrompt: request.NegativePrompt,
+		AspectRatio:    request.AspectRatio,
+	}
+	if request.Duration > 0 {
+		klingRequest.Duration = strconv.Itoa(request.Duration)
+	}
+	if request.Image != "" {
+		// 可灵的 base64 图片不能带 data URL 前缀
+		if strings.HasPrefix(request.Image, "data:") {
+			_, klingRequest.Image, _ = strings.Cut(request.Image, ",")
+		} else {
+			klingRequest.Image = request.Image
+		}
+	}
+	data, err := task.MarshalWithMetadata(klingRequest, request.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+func (a *TaskAdaptor) DoRequest(c *gin.Context, info *relaycommon.TaskRelayInfo, requestBody io.Reader) (*http.Response, error) {
+	return channel.DoTaskApiRequest(a, c, info, requestBody)
+}
+
+func (a *TaskAdaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.TaskRelayInfo) (taskID string, taskData []byte, taskErr *dto.TaskError) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		taskErr = service.TaskErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+		return
+	}
+	var klingResponse Response
+	err = json.Unmarshal(responseBody, &klingResponse)
+	if err != nil {
+		taskErr = service.TaskErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)
+		return
+	}
+	if klingResponse.Code != 0 || klingResponse.Data.TaskId == "" {
+		taskErr = service.TaskErrorWrapper(errors.New(klingResponse.Message), strconv.Itoa(klingResponse.Code), http.StatusInternalServerError)
+		return
+	}
+	task.WriteVideoTaskResponse(c, klingResponse.Data.TaskId, info)
+	return klingResponse.Data.TaskId, nil, nil
+}
+
+func (a *TaskAdaptor) GetModelList() []string {
+	return ModelList
+}
+
+func (a *TaskAdaptor) GetChannelName() string {
+	return ChannelName
+}
+
+func (a *TaskAdaptor) FetchTask(baseUrl, key string, body map[string]any) (*http.Response, error) {
+	taskID, action, err := task.GetFetchTaskParams(body)
+	if err != nil {
+		return nil, err
+	}
+	token, err := getToken(key)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/v1/videos/%s/%s", baseUrl, actionPath(action), taskID), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return task.DoFetchRequest(req)
+}
+
+func (a *TaskAdaptor) ParseTaskResult(respBody []byte) ([]*dto.TaskInfo, error) {
+	var klingResponse Response
+	err := json.Unmarshal(respBody, &klingResponse)
+	if err != nil {
+		return nil, err
+	}
+	if klingResponse.Code != 0 {
+		return nil, fmt.Errorf("kling fetch task failed: %s", klingResponse.Message)
+	}
+	data := klingResponse.Data
+	taskInfo := &dto.TaskInfo{
+		TaskID:     data.TaskId,
+		SubmitTime: data.CreatedAt / 1000,
+	}
+	switch data.TaskStatus {
+	case "submitted":
+		taskInfo.Status = model.TaskStatusSubmitted
+	case "processing":
+		taskInfo.Status = model.TaskStatusInProgress
+		taskInfo.StartTime = data.UpdatedAt / 1000
+	case "succeed":
+		taskInfo.Status = model.TaskStatusSuccess
+		taskInfo.FinishTime = data.UpdatedAt / 1000
+		videoData := dto.VideoTaskData{}
+		for _, video := range data.TaskResult.Videos {
+			videoData.Urls = append(videoData.Urls, video.Url)
+		}
+		if len(videoData.Urls) > 0 {
+			videoData.Url = videoData.Urls[0]
+		}
+		taskInfo.Data, _ = json.Marshal(videoData)
+	case "failed":
+		taskInfo.Status = model.TaskStatusFailure
+		taskInfo.FinishTime = data.UpdatedAt / 1000
+		taskInfo.FailReason = data.TaskStatusMsg
+	default:
+		taskInfo.Status = model.TaskStatusUnknown
+	}
+	return []*dto.TaskInfo{taskInfo}, nil
+}
+
+func actionPath(action string) string {
+	if action == constant.VideoActionImage2Video {
+		return "image2video"
+	}
+	return "text2video"
+}
+
+// getToken 可灵使用 AccessKey 和 SecretKey 签发的 JWT 鉴权，密钥格式为 AccessKey|SecretKey，
+// 不含分隔符时视为已签发的令牌直接使用
+func getToken(key string) (string, error) {
+	accessKey, secretKey, found := strings.Cut(key, "|")
+	if !found {
+		return key, nil
+	}
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss": accessKey,
+		"exp": now.Add(30 * time.Minute).Unix(),
+		"nbf": now.Add(-5 * time.Second).Unix(),
+	})
+	return token.SignedString([]byte(secretKey))
+}
@@ -0,0 +1,33 @@
+package kling
+
+type Request struct {
+	ModelName      string `json:"model_name"`
+	Prompt         string `json:"prompt,omitempty"`
+	NegativePrompt string `json:"negative_prompt,omitempty"`
+	Image          string `json:"image,omitempty"`
+	Duration       string `json:"duration,omitempty"`
+	AspectRatio    string `json:"aspect_ratio,omitempty"`
+	Mode           string `json:"mode,omitempty"`
+}
+
+type Response struct {
+	Code      int          `json:"code"`
+	Message   string       `json:"message"`
+	RequestId string       `json:"request_id"`
+	Data      ResponseData `json:"data"`
+}
+
+type ResponseData struct {
+	TaskId        string `json:"task_id"`
+	TaskStatus    string `json:"task_status"`
+	TaskStatusMsg string `json:"task_status_msg"`
+	CreatedAt     int64  `json:"created_at"`
+	UpdatedAt     int64  `json:"updated_at"`
+	TaskResult    struct {
+		Videos []struct {
+			Id       string `json:"id"`
+			Url      string `json:"url"`
+			Duration string `json:"duration"`
+		} `json:"videos"`
+	} `json:"task_result"`
+}
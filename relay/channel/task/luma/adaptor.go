@@ -0,0 +1,153 @@
+package luma
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"one-api/dto"
+	"one-api/model"
+	"one-api/relay/channel"
+	"one-api/relay/channel/task"
+	relaycommon "one-api/relay/common"
+	"one-api/service"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TaskAdaptor struct {
+	ChannelType int
+}
+
+func (a *TaskAdaptor) Init(info *relaycommon.TaskRelayInfo) {
+	a.ChannelType = info.ChannelType
+}
+
+func (a *TaskAdaptor) ValidateRequestAndSetAction(c *gin.Context, info *relaycommon.TaskRelayInfo) *dto.TaskError {
+	return task.ValidateVideoRequestAndSetAction(c, info)
+}
+
+// GetPriceMultiplier 按视频时长计价，Luma 默认生成 5 秒视频
+func (a *TaskAdaptor) GetPriceMultiplier(c *gin.Context, info *relaycommon.TaskRelayInfo) float64 {
+	return task.VideoPriceMultiplier(c, 5)
+}
+
+func (a *TaskAdaptor) BuildRequestURL(info *relaycommon.TaskRelayInfo) (string, error) {
+	return fmt.Sprintf("%s/dream-machine/v1/generations", info.BaseUrl), nil
+}
+
+func (a *TaskAdaptor) BuildRequestHeader(c *gin.Context, req *http.Request, info *relaycommon.TaskRelayInfo) error {
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+info.ApiKey)
+	return nil
+}
+
+func (a *TaskAdaptor) BuildRequestBody(c *gin.Context, info *relaycommon.TaskRelayInfo) (io.Reader, error) {
+	request, err := task.GetVideoRequest(c)
+	if err != nil {
+		return nil, err
+	}
+	lumaRequest := Request{
+		Model:       info.UpstreamModelName,
+		Prompt:      request.Prompt,
+		AspectRatio: request.AspectRatio,
+		Resolution:  request.Resolution,
+	}
+	if request.Duration > 0 {
+		lumaRequest.Duration = fmt.Sprintf("%ds", request.Duration)
+	}
+	if request.Image != "" {
+		lumaRequest.Keyframes = map[string]Keyframe{
+			"frame0": {Type: "image", Url: request.Image},
+		}
+	}
+	data, err := task.MarshalWithMetadata(lumaRequest, request.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+func (a *TaskAdaptor) DoRequest(c *gin.Context, info *relaycommon.TaskRelayInfo, requestBody io.Reader) (*http.Response, error) {
+	return channel.DoTaskApiRequest(a, c, info, requestBody)
+}
+
+func (a *TaskAdaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.TaskRelayInfo) (taskID string, taskData []byte, taskErr *dto.TaskError) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		taskErr = service.TaskErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+		return
+	}
+	var generation Generation
+	err = json.Unmarshal(responseBody, &generation)
+	if err != nil {
+		taskErr = service.TaskErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)
+		return
+	}
+	if generation.Id == "" {
+		taskErr = service.TaskErrorWrapper(fmt.Errorf("luma generation id is empty: %s", string(responseBody)), "invalid_response", http.StatusInternalServerError)
+		return
+	}
+	task.WriteVideoTaskResponse(c, generation.Id, info)
+	return generation.Id, nil, nil
+}
+
+func (a *TaskAdaptor) GetModelList() []string {
+	return ModelList
+}
+
+func (a *TaskAdaptor) GetChannelName() string {
+	return ChannelName
+}
+
+func (a *TaskAdaptor) FetchTask(baseUrl, key string, body map[string]any) (*http.Response, error) {
+	taskID, _, err := task.GetFetchTaskParams(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/dream-machine/v1/generations/%s", baseUrl, taskID), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+key)
+	return task.DoFetchRequest(req)
+}
+
+func (a *TaskAdaptor) ParseTaskResult(respBody []byte) ([]*dto.TaskInfo, error) {
+	var generation Generation
+	err := json.Unmarshal(respBody, &generation)
+	if err != nil {
+		return nil, err
+	}
+	if generation.Id == "" {
+		return nil, fmt.Errorf("luma fetch task failed: %s", string(respBody))
+	}
+	taskInfo := &dto.TaskInfo{
+		TaskID:     generation.Id,
+		SubmitTime: task.ParseTime(generation.CreatedAt),
+	}
+	switch generation.State {
+	case "queued":
+		taskInfo.Status = model.TaskStatusQueued
+	case "dreaming":
+		taskInfo.Status = model.TaskStatusInProgress
+	case "completed":
+		taskInfo.Status = model.TaskStatusSuccess
+		taskInfo.FinishTime = time.Now().Unix()
+		taskInfo.Data, _ = json.Marshal(dto.VideoTaskData{
+			Url:      generation.Assets.Video,
+			CoverUrl: generation.Assets.Image,
+		})
+	case "failed":
+		taskInfo.Status = model.TaskStatusFailure
+		taskInfo.FinishTime = time.Now().Unix()
+		taskInfo.FailReason = generation.FailureReason
+	default:
+		taskInfo.Status = model.TaskStatusUnknown
+	}
+	return []*dto.TaskInfo{taskInfo}, nil
+}
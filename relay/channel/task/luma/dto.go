@@ -0,0 +1,27 @@
+package luma
+
+type Keyframe struct {
+	Type string `json:"type"`
+	Url  string `json:"url"`
+}
+
+type Request struct {
+	Model       string              `json:"model"`
+	Prompt      string              `json:"prompt,omitempty"`
+	AspectRatio string              `json:"aspect_ratio,omitempty"`
+	Duration    string              `json:"duration,omitempty"`
+	Resolution  string              `json:"resolution,omitempty"`
+	Keyframes   map[string]Keyframe `json:"keyframes,omitempty"`
+}
+
+type Generation struct {
+	Id            string `json:"id"`
+	State         string `json:"state"`
+	FailureReason string `json:"failure_reason"`
+	CreatedAt     string `json:"created_at"`
+	Assets        struct {
+		Video string `json:"video"`
+		Image string `json:"image"`
+	} `json:"assets"`
+	Detail any `json:"detail"`
+}
@@ -0,0 +1,7 @@
+package luma
+
+var ModelList = []string{
+	"ray-2", "ray-flash-2", "ray-1-6",
+}
+
+var ChannelName = "luma"
@@ -0,0 +1,185 @@
+package runway
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"one-api/constant"
+	"one-api/dto"
+	"one-api/model"
+	"one-api/relay/channel"
+	"one-api/relay/channel/task"
+	relaycommon "one-api/relay/common"
+	"one-api/service"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const apiVersion = "2024-11-06"
+
+// aspectRatios 通用宽高比对应的 Runway 分辨率
+var aspectRatios = map[string]string{
+	"16:9": "1280:720",
+	"9:16": "720:1280",
+	"4:3":  "1104:832",
+	"3:4":  "832:1104",
+	"1:1":  "960:960",
+	"21:9": "1584:672",
+}
+
+// gen3aAspectRatios gen3a_turbo 只支持两种分辨率
+var gen3aAspectRatios = map[string]string{
+	"16:9": "1280:768",
+	"9:16": "768:1280",
+}
+
+type TaskAdaptor struct {
+	ChannelType int
+}
+
+func (a *TaskAdaptor) Init(info *relaycommon.TaskRelayInfo) {
+	a.ChannelType = info.ChannelType
+}
+
+func (a *TaskAdaptor) ValidateRequestAndSetAction(c *gin.Context, info *relaycommon.TaskRelayInfo) *dto.TaskError {
+	taskErr := task.ValidateVideoRequestAndSetAction(c, info)
+	if taskErr != nil {
+		return taskErr
+	}
+	if info.Action != constant.VideoActionImage2Video {
+		return service.TaskErrorWrapperLocal(errors.New("runway only supports image to video, image is required"), "invalid_request", http.StatusBadRequest)
+	}
+	return nil
+}
+
+// GetPriceMultiplier 按视频时长计价，Runway 默认生成 10 秒视频
+func (a *TaskAdaptor) GetPriceMultiplier(c *gin.Context, info *relaycommon.TaskRelayInfo) float64 {
+	return task.VideoPriceMultiplier(c, 10)
+}
+
+func (a *TaskAdaptor) BuildRequestURL(info *relaycommon.TaskRelayInfo) (string, error) {
+	return fmt.Sprintf("%s/v1/image_to_video", info.BaseUrl), nil
+}
+
+func (a *TaskAdaptor) BuildRequestHeader(c *gin.Context, req *http.Request, info *relaycommon.TaskRelayInfo) error {
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+info.ApiKey)
+	req.Header.Set("X-Runway-Version", apiVersion)
+	return nil
+}
+
+func (a *TaskAdaptor) BuildRequestBody(c *gin.Context, info *relaycommon.TaskRelayInfo) (io.Reader, error) {
+	request, err := task.GetVideoRequest(c)
+	if err != nil {
+		return nil, err
+	}
+	runwayRequest := Request{
+		Model:       info.UpstreamModelName,
+		PromptImage: request.Image,
+		PromptText:  request.Prompt,
+		Duration:    request.Duration,
+		Ratio:       request.AspectRatio,
+		Seed:        request.Seed,
+	}
+	ratios := aspectRatios
+	if info.UpstreamModelName == "gen3a_turbo" {
+		ratios = gen3aAspectRatios
+	}
+	if ratio, ok := ratios[request.AspectRatio]; ok {
+		runwayRequest.Ratio = ratio
+	}
+	data, err := task.MarshalWithMetadata(runwayRequest, request.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+func (a *TaskAdaptor) DoRequest(c *gin.Context, info *relaycommon.TaskRelayInfo, requestBody io.Reader) (*http.Response, error) {
+	return channel.DoTaskApiRequest(a, c, info, requestBody)
+}
+
+func (a *TaskAdaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.TaskRelayInfo) (taskID string, taskData []byte, taskErr *dto.TaskError) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		taskErr = service.TaskErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+		return
+	}
+	var runwayResponse TaskResponse
+	err = json.Unmarshal(responseBody, &runwayResponse)
+	if err != nil {
+		taskErr = service.TaskErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)
+		return
+	}
+	if runwayResponse.Id == "" {
+		taskErr = service.TaskErrorWrapper(fmt.Errorf("runway task id is empty: %s", runwayResponse.Error), "invalid_response", http.StatusInternalServerError)
+		return
+	}
+	task.WriteVideoTaskResponse(c, runwayResponse.Id, info)
+	return runwayResponse.Id, nil, nil
+}
+
+func (a *TaskAdaptor) GetModelList() []string {
+	return ModelList
+}
+
+func (a *TaskAdaptor) GetChannelName() string {
+	return ChannelName
+}
+
+func (a *TaskAdaptor) FetchTask(baseUrl, key string, body map[string]any) (*http.Response, error) {
+	taskID, _, err := task.GetFetchTaskParams(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/v1/tasks/%s", baseUrl, taskID), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+key)
+	req.Header.Set("X-Runway-Version", apiVersion)
+	return task.DoFetchRequest(req)
+}
+
+func (a *TaskAdaptor) ParseTaskResult(respBody []byte) ([]*dto.TaskInfo, error) {
+	var runwayResponse TaskResponse
+	err := json.Unmarshal(respBody, &runwayResponse)
+	if err != nil {
+		return nil, err
+	}
+	if runwayResponse.Id == "" {
+		return nil, fmt.Errorf("runway fetch task failed: %s", runwayResponse.Error)
+	}
+	taskInfo := &dto.TaskInfo{
+		TaskID:     runwayResponse.Id,
+		SubmitTime: task.ParseTime(runwayResponse.CreatedAt),
+	}
+	if runwayResponse.Progress != nil {
+		taskInfo.Progress = fmt.Sprintf("%.0f%%", *runwayResponse.Progress*100)
+	}
+	switch runwayResponse.Status {
+	case "PENDING", "THROTTLED":
+		taskInfo.Status = model.TaskStatusQueued
+	case "RUNNING":
+		taskInfo.Status = model.TaskStatusInProgress
+	case "SUCCEEDED":
+		taskInfo.Status = model.TaskStatusSuccess
+		taskInfo.FinishTime = time.Now().Unix()
+		videoData := dto.VideoTaskData{Urls: runwayResponse.Output}
+		if len(runwayResponse.Output) > 0 {
+			videoData.Url = runwayResponse.Output[0]
+		}
+		taskInfo.Data, _ = json.Marshal(videoData)
+	case "FAILED", "CANCELLED":
+		taskInfo.Status = model.TaskStatusFailure
+		taskInfo.FinishTime = time.Now().Unix()
+		taskInfo.FailReason = runwayResponse.Failure
+	default:
+		taskInfo.Status = model.TaskStatusUnknown
+	}
+	return []*dto.TaskInfo{taskInfo}, nil
+}
@@ -0,0 +1,20 @@
+package runway
+
+type Request struct {
+	Model       string `json:"model"`
+	PromptImage string `json:"promptImage"`
+	PromptText  string `json:"promptText,omitempty"`
+	Duration    int    `json:"duration,omitempty"`
+	Ratio       string `json:"ratio,omitempty"`
+	Seed        *int   `json:"seed,omitempty"`
+}
+
+type TaskResponse struct {
+	Id        string   `json:"id"`
+	Status    string   `json:"status"`
+	CreatedAt string   `json:"createdAt"`
+	Progress  *float64 `json:"progress"`
+	Failure   string   `json:"failure"`
+	Output    []string `json:"output"`
+	Error     string   `json:"error"`
+}
@@ -0,0 +1,7 @@
+package runway
+
+var ModelList = []string{
+	"gen3a_turbo", "gen4_turbo",
+}
+
+var ChannelName = "runway"
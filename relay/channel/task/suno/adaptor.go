@@ -2,7 +2,6 @@ package suno
 
 import (
 	"bytes"
-	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/gin-gonic/gin"
@@ -12,10 +11,10 @@ import (
 	"one-api/constant"
 	"one-api/dto"
 	"one-api/relay/channel"
+	"one-api/relay/channel/task"
 	relaycommon "one-api/relay/common"
 	"one-api/service"
 	"strings"
-	"time"
 )
 
 type TaskAdaptor struct {
@@ -127,6 +126,9 @@ func (a *TaskAdaptor) GetChannelName() string {
 }
 
 func (a *TaskAdaptor) FetchTask(baseUrl, key string, body map[string]any) (*http.Response, error) {
+	if taskID, ok := body["task_id"].(string); ok {
+		return a.FetchTasks(baseUrl, key, []string{taskID})
+	}
 	requestUrl := fmt.Sprintf("%s/suno/fetch", baseUrl)
 	byteBody, err := json.Marshal(body)
 	if err != nil {
@@ -138,20 +140,39 @@ func (a *TaskAdaptor) FetchTask(baseUrl, key string, body map[string]any) (*http
 		common.SysError(fmt.Sprintf("Get Task error: %v", err))
 		return nil, err
 	}
-	defer req.Body.Close()
-	// 设置超时时间
-	timeout := time.Second * 15
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
-	// 使用带有超时的 context 创建新的请求
-	req = req.WithContext(ctx)
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+key)
-	resp, err := service.GetHttpClient().Do(req)
+	return task.DoFetchRequest(req)
+}
+
+func (a *TaskAdaptor) FetchTasks(baseUrl, key string, taskIds []string) (*http.Response, error) {
+	return a.FetchTask(baseUrl, key, map[string]any{
+		"ids": taskIds,
+	})
+}
+
+func (a *TaskAdaptor) ParseTaskResult(respBody []byte) ([]*dto.TaskInfo, error) {
+	var responseItems dto.TaskResponse[[]dto.SunoDataResponse]
+	err := json.Unmarshal(respBody, &responseItems)
 	if err != nil {
 		return nil, err
 	}
-	return resp, nil
+	if !responseItems.IsSuccess() {
+		return nil, fmt.Errorf("suno fetch task failed: %s", responseItems.Message)
+	}
+	taskInfos := make([]*dto.TaskInfo, 0, len(responseItems.Data))
+	for _, item := range responseItems.Data {
+		taskInfos = append(taskInfos, &dto.TaskInfo{
+			TaskID:     item.TaskID,
+			Status:     item.Status,
+			FailReason: item.FailReason,
+			SubmitTime: item.SubmitTime,
+			StartTime:  item.StartTime,
+			FinishTime: item.FinishTime,
+			Data:       item.Data,
+		})
+	}
+	return taskInfos, nil
 }
 
 func actionValidate(c *gin.Context, sunoRequest *dto.SunoSubmitReq, action string) (err error) {
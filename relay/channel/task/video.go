@@ -0,0 +1,162 @@
+package task
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/dto"
+	"one-api/model"
+	relaycommon "one-api/relay/common"
+	"one-api/service"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const fetchTaskTimeout = 15 * time.Second
+
+// videoPriceUnitSeconds 视频模型的固定价格对应的视频时长
+const videoPriceUnitSeconds = 5
+
+// ValidateVideoRequestAndSetAction 解析统一的视频生成请求，带首帧图片时为图生视频
+func ValidateVideoRequestAndSetAction(c *gin.Context, info *relaycommon.TaskRelayInfo) *dto.TaskError {
+	var request dto.VideoGenerationRequest
+	err := common.UnmarshalBodyReusable(c, &request)
+	if err != nil {
+		return service.TaskErrorWrapperLocal(err, "invalid_request", http.StatusBadRequest)
+	}
+	if request.Prompt == "" && request.Image == "" {
+		return service.TaskErrorWrapperLocal(errors.New("prompt or image is required"), "invalid_request", http.StatusBadRequest)
+	}
+	if request.Duration < 0 {
+		return service.TaskErrorWrapperLocal(errors.New("duration must be positive"), "invalid_request", http.StatusBadRequest)
+	}
+	if request.Image != "" {
+		info.Action = constant.VideoActionImage2Video
+	} else {
+		info.Action = constant.VideoActionText2Video
+	}
+	c.Set("task_request", &request)
+	return nil
+}
+
+func GetVideoRequest(c *gin.Context) (*dto.VideoGenerationRequest, error) {
+	request, ok := c.Get("task_request")
+	if !ok {
+		return nil, errors.New("video request not found")
+	}
+	videoRequest, ok := request.(*dto.VideoGenerationRequest)
+	if !ok {
+		return nil, errors.New("invalid video request")
+	}
+	return videoRequest, nil
+}
+
+// VideoPriceMultiplier 按生成的视频时长计价，模型固定价格为 5 秒视频的价格。
+// metadata 中的 duration 会覆盖请求参数传给上游，同样以它为准；都未指定时使用平台的默认时长
+func VideoPriceMultiplier(c *gin.Context, defaultDuration int) float64 {
+	request, err := GetVideoRequest(c)
+	if err != nil {
+		return 1
+	}
+	duration := float64(request.Duration)
+	if value, ok := request.Metadata["duration"]; ok {
+		if d := parseDurationSeconds(value); d > 0 {
+			duration = d
+		}
+	}
+	if duration <= 0 {
+		duration = float64(defaultDuration)
+	}
+	return duration / videoPriceUnitSeconds
+}
+
+// parseDurationSeconds 解析数字或 "10"、"10s" 格式的时长
+func parseDurationSeconds(value any) float64 {
+	switch v := value.(type) {
+	case float64:
+		return v
+	case string:
+		d, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(v), "s"), 64)
+		if err == nil {
+			return d
+		}
+	}
+	return 0
+}
+
+// WriteVideoTaskResponse 向客户端返回统一格式的提交结果
+func WriteVideoTaskResponse(c *gin.Context, taskID string, info *relaycommon.TaskRelayInfo) {
+	c.JSON(http.StatusOK, dto.VideoTaskResponse{
+		TaskID:     taskID,
+		Object:     "video.generation",
+		Action:     info.Action,
+		Status:     model.TaskStatusSubmitted,
+		Progress:   "0%",
+		SubmitTime: time.Now().Unix(),
+	})
+}
+
+// DoFetchRequest 发起任务查询请求并读取完整响应，避免超时 context 取消后响应体无法读取
+func DoFetchRequest(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTaskTimeout)
+	defer cancel()
+	resp, err := service.GetHttpClient().Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read fetch response failed: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// GetFetchTaskParams 读取轮询器传入的任务 ID 和任务类型
+func GetFetchTaskParams(body map[string]any) (taskID string, action string, err error) {
+	taskID, _ = body["task_id"].(string)
+	action, _ = body["action"].(string)
+	if taskID == "" {
+		return "", "", errors.New("task_id is required")
+	}
+	return taskID, action, nil
+}
+
+// ParseTime 解析上游返回的 RFC3339 时间，失败时返回 0
+func ParseTime(value string) int64 {
+	if value == "" {
+		return 0
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0
+	}
+	return t.Unix()
+}
+
+// MarshalWithMetadata 序列化上游请求，并把请求中的 metadata 合并到请求体顶层
+func MarshalWithMetadata(request any, metadata map[string]any) ([]byte, error) {
+	data, err := json.Marshal(request)
+	if err != nil || len(metadata) == 0 {
+		return data, err
+	}
+	body := make(map[string]any)
+	err = json.Unmarshal(data, &body)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range metadata {
+		body[key] = value
+	}
+	return json.Marshal(body)
+}
@@ -0,0 +1,36 @@
+package task
+
+import (
+	"net/http/httptest"
+	"one-api/dto"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestVideoPriceMultiplier(t *testing.T) {
+	tests := []struct {
+		name            string
+		request         *dto.VideoGenerationRequest
+		defaultDuration int
+		want            float64
+	}{
+		{"no request", nil, 5, 1},
+		{"default duration", &dto.VideoGenerationRequest{}, 10, 2},
+		{"request duration", &dto.VideoGenerationRequest{Duration: 10}, 5, 2},
+		{"metadata number overrides", &dto.VideoGenerationRequest{Duration: 5, Metadata: map[string]any{"duration": float64(15)}}, 5, 3},
+		{"metadata string with unit", &dto.VideoGenerationRequest{Metadata: map[string]any{"duration": "10s"}}, 5, 2},
+		{"invalid metadata ignored", &dto.VideoGenerationRequest{Duration: 10, Metadata: map[string]any{"duration": "long"}}, 5, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			if tt.request != nil {
+				c.Set("task_request", tt.request)
+			}
+			if got := VideoPriceMultiplier(c, tt.defaultDuration); got != tt.want {
+				t.Errorf("VideoPriceMultiplier() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -169,6 +169,14 @@ func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, request
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage any, err *dto.OpenAIErrorWithStatusCode) {
+	if a.RequestMode == RequestModeGemini && info.RelayFormat == relaycommon.RelayFormatGemini {
+		if info.IsStream {
+			err, usage = gemini.GeminiNativeStreamHandler(c, resp, info)
+		} else {
+			err, usage = gemini.GeminiNativeHandler(c, resp, info)
+		}
+		return
+	}
 	if info.IsStream {
 		switch a.RequestMode {
 		case RequestModeClaude:
@@ -36,6 +36,7 @@ type ClaudeConvertInfo struct {
 const (
 	RelayFormatOpenAI = "openai"
 	RelayFormatClaude = "claude"
+	RelayFormatGemini = "gemini"
 )
 
 type RerankerInfo struct {
@@ -44,13 +45,17 @@ type RerankerInfo struct {
 }
 
 type RelayInfo struct {
-	ChannelType       int
-	ChannelId         int
-	TokenId           int
-	TokenKey          string
-	UserId            int
-	Group             string
-	TokenUnlimited    bool
+	ChannelType    int
+	ChannelId      int
+	TokenId        int
+	TokenKey       string
+	UserId         int
+	Group          string
+	TokenUnlimited bool
+	// TokenBudgetEnabled 令牌设置了周期预算，消耗需要计入预算
+	TokenBudgetEnabled bool
+	// OrgId 组织令牌所属组织，非 0 时从组织额度中扣费
+	OrgId             int
 	StartTime         time.Time
 	FirstResponseTime time.Time
 	isFirstResponse   bool
@@ -70,6 +75,7 @@ type RelayInfo struct {
 	Organization         string
 	BaseUrl              string
 	SupportStreamOptions bool
+	SupportResponses     bool
 	ShouldIncludeUsage   bool
 	IsModelMapped        bool
 	ClientWs             *websocket.Conn
@@ -105,6 +111,12 @@ var streamSupportedChannels = map[int]bool{
 	common.ChannelTypeXai:        true,
 }
 
+// 原生支持 Responses API 的通道类型，其余通道会转换为 chat completions 请求
+var responsesSupportedChannels = map[int]bool{
+	common.ChannelTypeOpenAI: true,
+	common.ChannelTypeAzure:  true,
+}
+
 func GenRelayInfoWs(c *gin.Context, ws *websocket.Conn) *RelayInfo {
 	info := GenRelayInfo(c)
 	info.ClientWs = ws
@@ -124,6 +136,16 @@ func GenRelayInfoClaude(c *gin.Context) *RelayInfo {
 	return info
 }
 
+// GenRelayInfoGemini Gemini 原生格式请求，isStream 由路径中的 streamGenerateContent 决定
+func GenRelayInfoGemini(c *gin.Context, isStream bool) *RelayInfo {
+	info := GenRelayInfo(c)
+	info.RelayFormat = RelayFormatGemini
+	info.RelayMode = relayconstant.RelayModeChatCompletions
+	info.IsStream = isStream
+	info.ShouldIncludeUsage = false
+	return info
+}
+
 func GenRelayInfoRerank(c *gin.Context, req *dto.RerankRequest) *RelayInfo {
 	info := GenRelayInfo(c)
 	info.RelayMode = relayconstant.RelayModeRerank
@@ -151,24 +173,26 @@ func GenRelayInfo(c *gin.Context) *RelayInfo {
 	apiType, _ := relayconstant.ChannelType2APIType(channelType)
 
 	info := &RelayInfo{
-		UserQuota:         c.GetInt(constant.ContextKeyUserQuota),
-		UserSetting:       c.GetStringMap(constant.ContextKeyUserSetting),
-		UserEmail:         c.GetString(constant.ContextKeyUserEmail),
-		isFirstResponse:   true,
-		RelayMode:         relayconstant.Path2RelayMode(c.Request.URL.Path),
-		BaseUrl:           c.GetString("base_url"),
-		RequestURLPath:    c.Request.URL.String(),
-		ChannelType:       channelType,
-		ChannelId:         channelId,
-		TokenId:           tokenId,
-		TokenKey:          tokenKey,
-		UserId:            userId,
-		Group:             group,
-		TokenUnlimited:    tokenUnlimited,
-		StartTime:         startTime,
-		FirstResponseTime: startTime.Add(-time.Second),
-		OriginModelName:   c.GetString("original_model"),
-		UpstreamModelName: c.GetString("original_model"),
+		UserQuota:          c.GetInt(constant.ContextKeyUserQuota),
+		UserSetting:        c.GetStringMap(constant.ContextKeyUserSetting),
+		UserEmail:          c.GetString(constant.ContextKeyUserEmail),
+		isFirstResponse:    true,
+		RelayMode:          relayconstant.Path2RelayMode(c.Request.URL.Path),
+		BaseUrl:            c.GetString("base_url"),
+		RequestURLPath:     c.Request.URL.String(),
+		ChannelType:        channelType,
+		ChannelId:          channelId,
+		TokenId:            tokenId,
+		TokenKey:           tokenKey,
+		UserId:             userId,
+		Group:              group,
+		TokenUnlimited:     tokenUnlimited,
+		TokenBudgetEnabled: c.GetBool("token_budget_enabled"),
+		OrgId:              c.GetInt("token_org_id"),
+		StartTime:          startTime,
+		FirstResponseTime:  startTime.Add(-time.Second),
+		OriginModelName:    c.GetString("original_model"),
+		UpstreamModelName:  c.GetString("original_model"),
 		//RecodeModelName:   c.GetString("original_model"),
 		IsModelMapped:  false,
 		ApiType:        apiType,
@@ -200,6 +224,9 @@ func GenRelayInfo(c *gin.Context) *RelayInfo {
 	if streamSupportedChannels[info.ChannelType] {
 		info.SupportStreamOptions = true
 	}
+	if responsesSupportedChannels[info.ChannelType] {
+		info.SupportResponses = true
+	}
 	return info
 }
 
@@ -40,6 +40,14 @@ const (
 	RelayModeRerank
 
 	RelayModeRealtime
+
+	RelayModeResponses
+
+	RelayModeImagesEdits
+	RelayModeImagesVariations
+
+	RelayModeVideoSubmit
+	RelayModeVideoFetchByID
 )
 
 func Path2RelayMode(path string) int {
@@ -56,6 +64,10 @@ func Path2RelayMode(path string) int {
 		relayMode = RelayModeModerations
 	} else if strings.HasPrefix(path, "/v1/images/generations") {
 		relayMode = RelayModeImagesGenerations
+	} else if strings.HasPrefix(path, "/v1/images/edits") {
+		relayMode = RelayModeImagesEdits
+	} else if strings.HasPrefix(path, "/v1/images/variations") {
+		relayMode = RelayModeImagesVariations
 	} else if strings.HasPrefix(path, "/v1/edits") {
 		relayMode = RelayModeEdits
 	} else if strings.HasPrefix(path, "/v1/audio/speech") {
@@ -68,6 +80,8 @@ func Path2RelayMode(path string) int {
 		relayMode = RelayModeRerank
 	} else if strings.HasPrefix(path, "/v1/realtime") {
 		relayMode = RelayModeRealtime
+	} else if strings.HasPrefix(path, "/v1/responses") {
+		relayMode = RelayModeResponses
 	}
 	return relayMode
 }
@@ -111,6 +125,16 @@ func Path2RelayModeMidjourney(path string) int {
 	return relayMode
 }
 
+func Path2RelayVideo(method, path string) int {
+	relayMode := RelayModeUnknown
+	if method == http.MethodPost && strings.HasSuffix(path, "/video/generations") {
+		relayMode = RelayModeVideoSubmit
+	} else if method == http.MethodGet && strings.Contains(path, "/video/generations/") {
+		relayMode = RelayModeVideoFetchByID
+	}
+	return relayMode
+}
+
 func Path2RelaySuno(method, path string) int {
 	relayMode := RelayModeUnknown
 	if method == http.MethodPost && strings.HasSuffix(path, "/fetch") {
@@ -0,0 +1,286 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/dto"
+	"one-api/relay/channel/gemini"
+	relaycommon "one-api/relay/common"
+	relayconstant "one-api/relay/constant"
+	"one-api/relay/helper"
+	"one-api/service"
+	"one-api/setting"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	GeminiActionGenerateContent       = "generateContent"
+	GeminiActionStreamGenerateContent = "streamGenerateContent"
+)
+
+func getAndValidateGeminiRequest(c *gin.Context) (*gemini.GeminiChatRequest, error) {
+	request := &gemini.GeminiChatRequest{}
+	err := common.UnmarshalBodyReusable(c, request)
+	if err != nil {
+		return nil, err
+	}
+	if len(request.Contents) == 0 {
+		return nil, fmt.Errorf("field contents is required")
+	}
+	return request, nil
+}
+
+// GeminiHelper 处理 Gemini 原生格式请求，Gemini 和 Vertex 渠道直接透传，
+// 其余渠道转换为 chat completions 请求，响应再转换回 Gemini 格式。流式响应统一使用 SSE
+func GeminiHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode) {
+	_, action, _ := strings.Cut(c.Param("model"), ":")
+	relayInfo := relaycommon.GenRelayInfoGemini(c, action == GeminiActionStreamGenerateContent)
+
+	request, err := getAndValidateGeminiRequest(c)
+	if err != nil {
+		common.LogError(c, fmt.Sprintf("getAndValidateGeminiRequest failed: %s", err.Error()))
+		return service.OpenAIErrorWrapperLocal(err, "invalid_gemini_request", http.StatusBadRequest)
+	}
+
+	err = helper.ModelMappedHelper(c, relayInfo)
+	if err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "model_mapped_error", http.StatusInternalServerError)
+	}
+
+	// 转换后的请求用于计算 promptTokens 和非 Gemini 渠道的请求
+	textRequest, err := gemini.GeminiRequest2OpenAI(request, relayInfo.UpstreamModelName, relayInfo.IsStream)
+	if err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "invalid_gemini_request", http.StatusBadRequest)
+	}
+
+	if setting.ShouldCheckPromptSensitive() {
+		words, err := service.CheckSensitiveMessages(textRequest.Messages)
+		if err != nil {
+			common.LogWarn(c, fmt.Sprintf("user sensitive words detected: %s", strings.Join(words, ", ")))
+			return service.OpenAIErrorWrapperLocal(err, "sensitive_words_detected", http.StatusBadRequest)
+		}
+	}
+
+	var promptTokens int
+	if value, exists := c.Get("prompt_tokens"); exists {
+		promptTokens = value.(int)
+		relayInfo.PromptTokens = promptTokens
+	} else {
+		promptTokens, err = service.CountTokenChatRequest(relayInfo, *textRequest)
+		if err != nil {
+			return service.OpenAIErrorWrapper(err, "count_token_messages_failed", http.StatusInternalServerError)
+		}
+		relayInfo.PromptTokens = promptTokens
+		c.Set("prompt_tokens", promptTokens)
+	}
+
+	priceData, err := helper.ModelPriceHelper(c, relayInfo, promptTokens, int(request.GenerationConfig.MaxOutputTokens))
+	if err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "model_price_error", http.StatusInternalServerError)
+	}
+
+	// pre-consume quota 预消耗配额
+	preConsumedQuota, userQuota, openaiErr := preConsumeQuota(c, priceData.ShouldPreConsumedQuota, relayInfo)
+	if openaiErr != nil {
+		return openaiErr
+	}
+	defer func() {
+		if openaiErr != nil {
+			returnPreConsumedQuota(c, relayInfo, userQuota, preConsumedQuota)
+		}
+	}()
+
+	adaptor := GetAdaptor(relayInfo.ApiType)
+	if adaptor == nil {
+		return service.OpenAIErrorWrapperLocal(fmt.Errorf("invalid api type: %d", relayInfo.ApiType), "invalid_api_type", http.StatusBadRequest)
+	}
+	adaptor.Init(relayInfo)
+
+	native := relayInfo.ApiType == relayconstant.APITypeGemini ||
+		(relayInfo.ApiType == relayconstant.APITypeVertexAi && strings.HasPrefix(relayInfo.UpstreamModelName, "gemini"))
+	var jsonData []byte
+	if native {
+		jsonData, err = common.GetRequestBody(c)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "get_request_body_failed", http.StatusInternalServerError)
+		}
+	} else {
+		relayInfo.RelayFormat = relaycommon.RelayFormatOpenAI
+		relayInfo.RequestURLPath = "/v1/chat/completions"
+		if textRequest.Stream && relayInfo.SupportStreamOptions {
+			textRequest.StreamOptions = &dto.StreamOptions{
+				IncludeUsage: true,
+			}
+		}
+		convertedRequest, err := adaptor.ConvertOpenAIRequest(c, relayInfo, textRequest)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "convert_request_failed", http.StatusInternalServerError)
+		}
+		jsonData, err = json.Marshal(convertedRequest)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "json_marshal_failed", http.StatusInternalServerError)
+		}
+	}
+
+	// apply param override
+	if len(relayInfo.ParamOverride) > 0 {
+		reqMap := make(map[string]interface{})
+		err = json.Unmarshal(jsonData, &reqMap)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "param_override_unmarshal_failed", http.StatusInternalServerError)
+		}
+		for key, value := range relayInfo.ParamOverride {
+			reqMap[key] = value
+		}
+		jsonData, err = json.Marshal(reqMap)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "param_override_marshal_failed", http.StatusInternalServerError)
+		}
+	}
+
+	if common.DebugEnabled {
+		println("requestBody: ", string(jsonData))
+	}
+
+	var httpResp *http.Response
+	resp, err := adaptor.DoRequest(c, relayInfo, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+
+	statusCodeMappingStr := c.GetString("status_code_mapping")
+	if resp != nil {
+		httpResp = resp.(*http.Response)
+		relayInfo.IsStream = relayInfo.IsStream || strings.HasPrefix(httpResp.Header.Get("Content-Type"), "text/event-stream")
+		if httpResp.StatusCode != http.StatusOK {
+			openaiErr = service.RelayErrorHandler(httpResp, false)
+			// reset status code 重置状态码
+			service.ResetStatusCode(openaiErr, statusCodeMappingStr)
+			return openaiErr
+		}
+	}
+
+	var usage any
+	if native {
+		usage, openaiErr = adaptor.DoResponse(c, httpResp, relayInfo)
+	} else {
+		writer := newGeminiConvertWriter(c.Writer)
+		c.Writer = writer
+		usage, openaiErr = adaptor.DoResponse(c, httpResp, relayInfo)
+		c.Writer = writer.ResponseWriter
+		if openaiErr == nil {
+			writer.finish(usage.(*dto.Usage))
+		}
+	}
+	if openaiErr != nil {
+		// reset status code 重置状态码
+		service.ResetStatusCode(openaiErr, statusCodeMappingStr)
+		return openaiErr
+	}
+
+	postConsumeQuota(c, relayInfo, usage.(*dto.Usage), preConsumedQuota, userQuota, priceData, "")
+	return nil
+}
+
+// geminiConvertWriter 拦截适配器写出的 chat completions 响应，并转换为 Gemini 格式
+type geminiConvertWriter struct {
+	gin.ResponseWriter
+	converter  *gemini.GeminiStreamConverter
+	buffer     bytes.Buffer
+	statusCode int
+}
+
+func newGeminiConvertWriter(writer gin.ResponseWriter) *geminiConvertWriter {
+	return &geminiConvertWriter{
+		ResponseWriter: writer,
+		converter:      gemini.NewGeminiStreamConverter(),
+		statusCode:     http.StatusOK,
+	}
+}
+
+func (w *geminiConvertWriter) isStream() bool {
+	return strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream")
+}
+
+func (w *geminiConvertWriter) WriteHeader(code int) {
+	w.statusCode = code
+}
+
+func (w *geminiConvertWriter) WriteHeaderNow() {
+}
+
+func (w *geminiConvertWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *geminiConvertWriter) Write(data []byte) (int, error) {
+	w.buffer.Write(data)
+	if !w.isStream() {
+		return len(data), nil
+	}
+	for {
+		line, err := w.buffer.ReadString('\n')
+		if err != nil {
+			// 不完整的行放回缓冲区，等待后续数据
+			w.buffer.Reset()
+			w.buffer.WriteString(line)
+			break
+		}
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		payload := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if payload == "" || strings.HasPrefix(payload, "[DONE]") {
+			continue
+		}
+		var chunk dto.ChatCompletionsStreamResponse
+		if err := common.DecodeJsonStr(payload, &chunk); err != nil {
+			common.SysError("error unmarshalling stream response: " + err.Error())
+			continue
+		}
+		if response := w.converter.Convert(&chunk); response != nil {
+			w.writeEvent(response)
+		}
+	}
+	return len(data), nil
+}
+
+func (w *geminiConvertWriter) Flush() {
+	if w.isStream() {
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *geminiConvertWriter) writeEvent(response *gemini.GeminiChatResponse) {
+	data, err := json.Marshal(response)
+	if err != nil {
+		common.SysError("error marshalling stream response: " + err.Error())
+		return
+	}
+	_, _ = fmt.Fprintf(w.ResponseWriter, "data: %s\n\n", data)
+	w.ResponseWriter.Flush()
+}
+
+func (w *geminiConvertWriter) finish(usage *dto.Usage) {
+	if w.isStream() {
+		w.writeEvent(w.converter.Finish(usage))
+		return
+	}
+	body := w.buffer.Bytes()
+	var textResponse dto.OpenAITextResponse
+	if err := common.DecodeJson(body, &textResponse); err == nil {
+		if data, err := json.Marshal(gemini.ResponseOpenAI2Gemini(&textResponse, usage)); err == nil {
+			body = data
+		}
+	}
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Type", "application/json")
+	w.ResponseWriter.WriteHeader(w.statusCode)
+	_, _ = w.ResponseWriter.Write(body)
+}
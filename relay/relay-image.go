@@ -10,11 +10,11 @@ import (
 	"net/http"
 	"one-api/common"
 	"one-api/dto"
-	"one-api/model"
 	relaycommon "one-api/relay/common"
 	"one-api/relay/helper"
 	"one-api/service"
 	"one-api/setting"
+	"one-api/setting/operation_setting"
 	"strings"
 )
 
@@ -96,30 +96,9 @@ func ImageHelper(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
 		priceData.ModelPrice = 0.0025 * priceData.ModelRatio
 	}
 
-	userQuota, err := model.GetUserQuota(relayInfo.UserId, false)
+	userQuota, err := service.GetAvailableQuota(relayInfo.UserId, relayInfo.OrgId)
 
-	sizeRatio := 1.0
-	// Size
-	if imageRequest.Size == "256x256" {
-		sizeRatio = 0.4
-	} else if imageRequest.Size == "512x512" {
-		sizeRatio = 0.45
-	} else if imageRequest.Size == "1024x1024" {
-		sizeRatio = 1
-	} else if imageRequest.Size == "1024x1792" || imageRequest.Size == "1792x1024" {
-		sizeRatio = 2
-	}
-
-	qualityRatio := 1.0
-	if imageRequest.Model == "dall-e-3" && imageRequest.Quality == "hd" {
-		qualityRatio = 2.0
-		if imageRequest.Size == "1024x1792" || imageRequest.Size == "1792x1024" {
-			qualityRatio = 1.5
-		}
-	}
-
-	priceData.ModelPrice *= sizeRatio * qualityRatio * float64(imageRequest.N)
-	quota := int(priceData.ModelPrice * priceData.GroupRatio * common.QuotaPerUnit)
+	quota := applyImagePrice(&priceData, imageRequest.Model, imageRequest.Size, imageRequest.Quality, imageRequest.N)
 
 	if userQuota-quota < 0 {
 		return service.OpenAIErrorWrapperLocal(fmt.Errorf("image pre-consumed quota failed, user quota: %s, need quota: %s", common.FormatQuota(userQuota), common.FormatQuota(quota)), "insufficient_user_quota", http.StatusForbidden)
@@ -183,3 +162,19 @@ func ImageHelper(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
 	postConsumeQuota(c, relayInfo, usage, 0, userQuota, priceData, logContent)
 	return nil
 }
+
+// applyImagePrice 按尺寸、品质和张数计算图片价格，返回需要扣除的额度
+func applyImagePrice(priceData *helper.PriceData, model string, size string, quality string, n int) int {
+	sizeRatio := operation_setting.GetImageSetting().GetSizeRatio(model, size)
+
+	qualityRatio := 1.0
+	if model == "dall-e-3" && quality == "hd" {
+		qualityRatio = 2.0
+		if size == "1024x1792" || size == "1792x1024" {
+			qualityRatio = 1.5
+		}
+	}
+
+	priceData.ModelPrice *= sizeRatio * qualityRatio * float64(n)
+	return int(priceData.ModelPrice * priceData.GroupRatio * common.QuotaPerUnit)
+}
@@ -114,6 +114,11 @@ func TextHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode) {
 		return service.OpenAIErrorWrapperLocal(err, "model_price_error", http.StatusInternalServerError)
 	}
 
+	cache := getResponseCache(c, relayInfo, isTextRequestCacheable(relayInfo, textRequest))
+	if hit, openaiErr := cache.serve(c, relayInfo, priceData); hit || openaiErr != nil {
+		return openaiErr
+	}
+
 	// pre-consume quota 预消耗配额
 	preConsumedQuota, userQuota, openaiErr := preConsumeQuota(c, priceData.ShouldPreConsumedQuota, relayInfo)
 	if openaiErr != nil {
@@ -210,7 +215,11 @@ func TextHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode) {
 		}
 	}
 
+	cache.capture(c)
+	moderation := newModerationWriter(c, relayInfo)
 	usage, openaiErr := adaptor.DoResponse(c, httpResp, relayInfo)
+	moderation.finish()
+	cache.save(c, relayInfo, usage, openaiErr == nil && (moderation == nil || !moderation.blocked))
 	if openaiErr != nil {
 		// reset status code 重置状态码
 		service.ResetStatusCode(openaiErr, statusCodeMappingStr)
@@ -225,6 +234,17 @@ func TextHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode) {
 	return nil
 }
 
+// isTextRequestCacheable 只有 temperature 为 0 且只生成一个结果的对话和补全请求可以缓存
+func isTextRequestCacheable(info *relaycommon.RelayInfo, textRequest *dto.GeneralOpenAIRequest) bool {
+	if info.RelayMode != relayconstant.RelayModeChatCompletions && info.RelayMode != relayconstant.RelayModeCompletions {
+		return false
+	}
+	if strings.HasPrefix(info.OriginModelName, "gpt-4o-audio") {
+		return false
+	}
+	return textRequest.Temperature != nil && *textRequest.Temperature == 0 && textRequest.N <= 1
+}
+
 func getPromptTokens(textRequest *dto.GeneralOpenAIRequest, info *relaycommon.RelayInfo) (int, error) {
 	var promptTokens int
 	var err error
@@ -263,7 +283,7 @@ func checkRequestSensitive(textRequest *dto.GeneralOpenAIRequest, info *relaycom
 
 // 预扣费并返回用户剩余配额
 func preConsumeQuota(c *gin.Context, preConsumedQuota int, relayInfo *relaycommon.RelayInfo) (int, int, *dto.OpenAIErrorWithStatusCode) {
-	userQuota, err := model.GetUserQuota(relayInfo.UserId, false)
+	userQuota, err := service.GetAvailableQuota(relayInfo.UserId, relayInfo.OrgId)
 	if err != nil {
 		return 0, 0, service.OpenAIErrorWrapperLocal(err, "get_user_quota_failed", http.StatusInternalServerError)
 	}
@@ -297,7 +317,7 @@ func preConsumeQuota(c *gin.Context, preConsumedQuota int, relayInfo *relaycommo
 		if err != nil {
 			return 0, 0, service.OpenAIErrorWrapperLocal(err, "pre_consume_token_quota_failed", http.StatusForbidden)
 		}
-		err = model.DecreaseUserQuota(relayInfo.UserId, preConsumedQuota)
+		err = model.DecreaseBillingQuota(relayInfo.UserId, relayInfo.OrgId, preConsumedQuota)
 		if err != nil {
 			return 0, 0, service.OpenAIErrorWrapperLocal(err, "decrease_user_quota_failed", http.StatusInternalServerError)
 		}
@@ -318,8 +338,44 @@ func returnPreConsumedQuota(c *gin.Context, relayInfo *relaycommon.RelayInfo, us
 	}
 }
 
+// calculateTextQuota 根据用量和价格数据计算文本请求消耗的额度
+func calculateTextQuota(usage *dto.Usage, priceData helper.PriceData) int {
+	// Convert values to decimal for precise calculation
+	dPromptTokens := decimal.NewFromInt(int64(usage.PromptTokens))
+	dCacheTokens := decimal.NewFromInt(int64(usage.PromptTokensDetails.CachedTokens))
+	dCompletionTokens := decimal.NewFromInt(int64(usage.CompletionTokens))
+	dCompletionRatio := decimal.NewFromFloat(priceData.CompletionRatio)
+	dCacheRatio := decimal.NewFromFloat(priceData.CacheRatio)
+	dModelRatio := decimal.NewFromFloat(priceData.ModelRatio)
+	dGroupRatio := decimal.NewFromFloat(priceData.GroupRatio)
+	dModelPrice := decimal.NewFromFloat(priceData.ModelPrice)
+	dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
+
+	ratio := dModelRatio.Mul(dGroupRatio)
+
+	var quotaCalculateDecimal decimal.Decimal
+	if !priceData.UsePrice {
+		nonCachedTokens := dPromptTokens.Sub(dCacheTokens)
+		cachedTokensWithRatio := dCacheTokens.Mul(dCacheRatio)
+		promptQuota := nonCachedTokens.Add(cachedTokensWithRatio)
+		completionQuota := dCompletionTokens.Mul(dCompletionRatio)
+
+		quotaCalculateDecimal = promptQuota.Add(completionQuota).Mul(ratio)
+
+		if !ratio.IsZero() && quotaCalculateDecimal.LessThanOrEqual(decimal.Zero) {
+			quotaCalculateDecimal = decimal.NewFromInt(1)
+		}
+	} else {
+		quotaCalculateDecimal = dModelPrice.Mul(dQuotaPerUnit).Mul(dGroupRatio)
+	}
+
+	return int(quotaCalculateDecimal.Round(0).IntPart())
+}
+
 func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 	usage *dto.Usage, preConsumedQuota int, userQuota int, priceData helper.PriceData, extraContent string) {
+	_, span := common.StartSpan(ctx.Request.Context(), "billing")
+	defer span.End()
 	if usage == nil {
 		usage = &dto.Usage{
 			PromptTokens:     relayInfo.PromptTokens,
@@ -341,36 +397,7 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 	groupRatio := priceData.GroupRatio
 	modelPrice := priceData.ModelPrice
 
-	// Convert values to decimal for precise calculation
-	dPromptTokens := decimal.NewFromInt(int64(promptTokens))
-	dCacheTokens := decimal.NewFromInt(int64(cacheTokens))
-	dCompletionTokens := decimal.NewFromInt(int64(completionTokens))
-	dCompletionRatio := decimal.NewFromFloat(completionRatio)
-	dCacheRatio := decimal.NewFromFloat(cacheRatio)
-	dModelRatio := decimal.NewFromFloat(modelRatio)
-	dGroupRatio := decimal.NewFromFloat(groupRatio)
-	dModelPrice := decimal.NewFromFloat(modelPrice)
-	dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
-
-	ratio := dModelRatio.Mul(dGroupRatio)
-
-	var quotaCalculateDecimal decimal.Decimal
-	if !priceData.UsePrice {
-		nonCachedTokens := dPromptTokens.Sub(dCacheTokens)
-		cachedTokensWithRatio := dCacheTokens.Mul(dCacheRatio)
-		promptQuota := nonCachedTokens.Add(cachedTokensWithRatio)
-		completionQuota := dCompletionTokens.Mul(dCompletionRatio)
-
-		quotaCalculateDecimal = promptQuota.Add(completionQuota).Mul(ratio)
-
-		if !ratio.IsZero() && quotaCalculateDecimal.LessThanOrEqual(decimal.Zero) {
-			quotaCalculateDecimal = decimal.NewFromInt(1)
-		}
-	} else {
-		quotaCalculateDecimal = dModelPrice.Mul(dQuotaPerUnit).Mul(dGroupRatio)
-	}
-
-	quota := int(quotaCalculateDecimal.Round(0).IntPart())
+	quota := calculateTextQuota(usage, priceData)
 	totalTokens := promptTokens + completionTokens
 
 	var logContent string
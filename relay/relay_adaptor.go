@@ -1,6 +1,7 @@
 package relay
 
 import (
+	"one-api/common"
 	commonconstant "one-api/constant"
 	"one-api/relay/channel"
 	"one-api/relay/channel/ali"
@@ -21,6 +22,9 @@ import (
 	"one-api/relay/channel/palm"
 	"one-api/relay/channel/perplexity"
 	"one-api/relay/channel/siliconflow"
+	"one-api/relay/channel/task/kling"
+	"one-api/relay/channel/task/luma"
+	"one-api/relay/channel/task/runway"
 	"one-api/relay/channel/task/suno"
 	"one-api/relay/channel/tencent"
 	"one-api/relay/channel/vertex"
@@ -92,12 +96,31 @@ func GetAdaptor(apiType int) channel.Adaptor {
 	return nil
 }
 
+// taskAdaptors 异步任务平台适配器注册表，新增平台只需在此注册并在 taskChannelPlatforms 中关联渠道类型
+var taskAdaptors = map[commonconstant.TaskPlatform]func() channel.TaskAdaptor{
+	commonconstant.TaskPlatformSuno:   func() channel.TaskAdaptor { return &suno.TaskAdaptor{} },
+	commonconstant.TaskPlatformKling:  func() channel.TaskAdaptor { return &kling.TaskAdaptor{} },
+	commonconstant.TaskPlatformRunway: func() channel.TaskAdaptor { return &runway.TaskAdaptor{} },
+	commonconstant.TaskPlatformLuma:   func() channel.TaskAdaptor { return &luma.TaskAdaptor{} },
+}
+
+// taskChannelPlatforms 渠道类型对应的异步任务平台
+var taskChannelPlatforms = map[int]commonconstant.TaskPlatform{
+	common.ChannelTypeSunoAPI: commonconstant.TaskPlatformSuno,
+	common.ChannelTypeKling:   commonconstant.TaskPlatformKling,
+	common.ChannelTypeRunway:  commonconstant.TaskPlatformRunway,
+	common.ChannelTypeLuma:    commonconstant.TaskPlatformLuma,
+}
+
 func GetTaskAdaptor(platform commonconstant.TaskPlatform) channel.TaskAdaptor {
-	switch platform {
-	//case constant.APITypeAIProxyLibrary:
-	//	return &aiproxy.Adaptor{}
-	case commonconstant.TaskPlatformSuno:
-		return &suno.TaskAdaptor{}
+	newAdaptor, ok := taskAdaptors[platform]
+	if !ok {
+		return nil
 	}
-	return nil
+	return newAdaptor()
+}
+
+// GetTaskPlatform 返回渠道类型对应的异步任务平台，非异步任务渠道返回空字符串
+func GetTaskPlatform(channelType int) commonconstant.TaskPlatform {
+	return taskChannelPlatforms[channelType]
 }
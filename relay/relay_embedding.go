@@ -61,6 +61,10 @@ func EmbeddingHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode)
 	if err != nil {
 		return service.OpenAIErrorWrapperLocal(err, "model_price_error", http.StatusInternalServerError)
 	}
+	cache := getResponseCache(c, relayInfo, true)
+	if hit, openaiErr := cache.serve(c, relayInfo, priceData); hit || openaiErr != nil {
+		return openaiErr
+	}
 	// pre-consume quota 预消耗配额
 	preConsumedQuota, userQuota, openaiErr := preConsumeQuota(c, priceData.ShouldPreConsumedQuota, relayInfo)
 	if openaiErr != nil {
@@ -105,7 +109,9 @@ func EmbeddingHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode)
 		}
 	}
 
+	cache.capture(c)
 	usage, openaiErr := adaptor.DoResponse(c, httpResp, relayInfo)
+	cache.save(c, relayInfo, usage, openaiErr == nil)
 	if openaiErr != nil {
 		// reset status code 重置状态码
 		service.ResetStatusCode(openaiErr, statusCodeMappingStr)
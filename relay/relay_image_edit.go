@@ -0,0 +1,223 @@
+package relay
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/dto"
+	"one-api/relay/channel"
+	relaycommon "one-api/relay/common"
+	relayconstant "one-api/relay/constant"
+	"one-api/relay/helper"
+	"one-api/service"
+	"one-api/setting"
+	"one-api/setting/operation_setting"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const dalle2MaxUploadSize = 4 * 1024 * 1024
+
+func getAndValidImageEditRequest(c *gin.Context, info *relaycommon.RelayInfo) (*dto.ImageEditRequest, error) {
+	if !strings.HasPrefix(c.Request.Header.Get("Content-Type"), "multipart/form-data") {
+		return nil, errors.New("content type must be multipart/form-data")
+	}
+	form, err := c.MultipartForm()
+	if err != nil {
+		return nil, err
+	}
+	request := &dto.ImageEditRequest{
+		Model:          c.PostForm("model"),
+		Prompt:         c.PostForm("prompt"),
+		Size:           c.PostForm("size"),
+		Quality:        c.PostForm("quality"),
+		ResponseFormat: c.PostForm("response_format"),
+		User:           c.PostForm("user"),
+		Images:         append(form.File["image"], form.File["image[]"]...),
+	}
+	if masks := form.File["mask"]; len(masks) > 0 {
+		request.Mask = masks[0]
+	}
+	if n := c.PostForm("n"); n != "" {
+		request.N, err = strconv.Atoi(n)
+		if err != nil || request.N < 1 {
+			return nil, errors.New("n must be a positive integer")
+		}
+	}
+	if request.N == 0 {
+		request.N = 1
+	}
+	if request.Size == "" {
+		request.Size = "1024x1024"
+	}
+	if request.Model == "" {
+		request.Model = "dall-e-2"
+	}
+	if strings.Contains(request.Size, "×") {
+		return nil, errors.New("size an unexpected error occurred in the parameter, please use 'x' instead of the multiplication sign '×'")
+	}
+
+	if len(request.Images) == 0 {
+		return nil, errors.New("image is required")
+	}
+	if info.RelayMode == relayconstant.RelayModeImagesVariations {
+		if len(request.Images) > 1 {
+			return nil, errors.New("only one image is supported for variations")
+		}
+		if request.Mask != nil {
+			return nil, errors.New("mask is not supported for variations")
+		}
+	} else if request.Prompt == "" {
+		return nil, errors.New("prompt is required")
+	}
+
+	dalle2 := request.Model == "dall-e-2" || request.Model == "dall-e"
+	maxSize := int64(operation_setting.GetImageSetting().MaxUploadSizeMB) * 1024 * 1024
+	if dalle2 {
+		if len(request.Images) > 1 {
+			return nil, errors.New("dall-e-2 only supports one image")
+		}
+		if request.Size != "256x256" && request.Size != "512x512" && request.Size != "1024x1024" {
+			return nil, errors.New("size must be one of 256x256, 512x512, or 1024x1024")
+		}
+		maxSize = dalle2MaxUploadSize
+	}
+
+	var width, height int
+	for i, header := range request.Images {
+		config, format, err := service.DecodeImageFileConfig(header, maxSize)
+		if err != nil {
+			return nil, err
+		}
+		if dalle2 {
+			if format != "png" {
+				return nil, errors.New("dall-e-2 only supports png images")
+			}
+			if config.Width != config.Height {
+				return nil, errors.New("image must be square")
+			}
+		} else if format != "png" && format != "jpeg" && format != "webp" {
+			return nil, fmt.Errorf("unsupported image format %s, must be png, jpeg or webp", format)
+		}
+		if i == 0 {
+			width, height = config.Width, config.Height
+		}
+	}
+	if request.Mask != nil {
+		config, format, err := service.DecodeImageFileConfig(request.Mask, maxSize)
+		if err != nil {
+			return nil, err
+		}
+		if format != "png" {
+			return nil, errors.New("mask must be a png image")
+		}
+		if config.Width != width || config.Height != height {
+			return nil, errors.New("mask must have the same dimensions as the image")
+		}
+	}
+
+	if setting.ShouldCheckPromptSensitive() && request.Prompt != "" {
+		words, err := service.CheckSensitiveInput(request.Prompt)
+		if err != nil {
+			common.LogWarn(c, fmt.Sprintf("user sensitive words detected: %s", strings.Join(words, ",")))
+			return nil, err
+		}
+	}
+	return request, nil
+}
+
+// ImageEditHelper 处理 /v1/images/edits 和 /v1/images/variations，按张数和尺寸计费
+func ImageEditHelper(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
+	relayInfo := relaycommon.GenRelayInfo(c)
+
+	request, err := getAndValidImageEditRequest(c, relayInfo)
+	if err != nil {
+		common.LogError(c, fmt.Sprintf("getAndValidImageEditRequest failed: %s", err.Error()))
+		return service.OpenAIErrorWrapper(err, "invalid_image_request", http.StatusBadRequest)
+	}
+
+	err = helper.ModelMappedHelper(c, relayInfo)
+	if err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "model_mapped_error", http.StatusInternalServerError)
+	}
+
+	request.Model = relayInfo.UpstreamModelName
+
+	priceData, err := helper.ModelPriceHelper(c, relayInfo, 0, 0)
+	if err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "model_price_error", http.StatusInternalServerError)
+	}
+	if !priceData.UsePrice {
+		// modelRatio 16 = modelPrice $0.04
+		// per 1 modelRatio = $0.04 / 16
+		priceData.ModelPrice = 0.0025 * priceData.ModelRatio
+	}
+
+	userQuota, err := service.GetAvailableQuota(relayInfo.UserId, relayInfo.OrgId)
+	if err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "get_user_quota_failed", http.StatusInternalServerError)
+	}
+
+	quota := applyImagePrice(&priceData, request.Model, request.Size, request.Quality, request.N)
+	if userQuota-quota < 0 {
+		return service.OpenAIErrorWrapperLocal(fmt.Errorf("image pre-consumed quota failed, user quota: %s, need quota: %s", common.FormatQuota(userQuota), common.FormatQuota(quota)), "insufficient_user_quota", http.StatusForbidden)
+	}
+
+	adaptor := GetAdaptor(relayInfo.ApiType)
+	if adaptor == nil {
+		return service.OpenAIErrorWrapperLocal(fmt.Errorf("invalid api type: %d", relayInfo.ApiType), "invalid_api_type", http.StatusBadRequest)
+	}
+	adaptor.Init(relayInfo)
+
+	editAdaptor, ok := adaptor.(channel.ImageEditAdaptor)
+	if !ok {
+		return service.OpenAIErrorWrapperLocal(fmt.Errorf("channel %s does not support image edits and variations", adaptor.GetChannelName()), "image_edit_not_supported", http.StatusBadRequest)
+	}
+	requestBody, err := editAdaptor.ConvertImageEditRequest(c, relayInfo, *request)
+	if errors.Is(err, channel.ErrUnsupportedImageOperation) {
+		return service.OpenAIErrorWrapperLocal(err, "unsupported_operation", http.StatusBadRequest)
+	}
+	if err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "convert_request_failed", http.StatusInternalServerError)
+	}
+
+	statusCodeMappingStr := c.GetString("status_code_mapping")
+
+	resp, err := adaptor.DoRequest(c, relayInfo, requestBody)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	var httpResp *http.Response
+	if resp != nil {
+		httpResp = resp.(*http.Response)
+		if httpResp.StatusCode != http.StatusOK {
+			openaiErr := service.RelayErrorHandler(httpResp, false)
+			// reset status code 重置状态码
+			service.ResetStatusCode(openaiErr, statusCodeMappingStr)
+			return openaiErr
+		}
+	}
+
+	_, openaiErr := adaptor.DoResponse(c, httpResp, relayInfo)
+	if openaiErr != nil {
+		// reset status code 重置状态码
+		service.ResetStatusCode(openaiErr, statusCodeMappingStr)
+		return openaiErr
+	}
+
+	usage := &dto.Usage{
+		PromptTokens: request.N,
+		TotalTokens:  request.N,
+	}
+
+	quality := request.Quality
+	if quality == "" {
+		quality = "standard"
+	}
+	logContent := fmt.Sprintf("大小 %s, 品质 %s, 图片 %d 张", request.Size, quality, request.N)
+	postConsumeQuota(c, relayInfo, usage, 0, userQuota, priceData, logContent)
+	return nil
+}
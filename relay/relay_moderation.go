@@ -0,0 +1,562 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"one-api/common"
+	"one-api/dto"
+	relaycommon "one-api/relay/common"
+	relayconstant "one-api/relay/constant"
+	"one-api/service"
+	"one-api/setting"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// moderationText 一段待审核的文本及其写回请求的方法
+type moderationText struct {
+	value string
+	set   func(string)
+}
+
+// moderationCollector 从解析后的请求中收集待审核的文本和图片
+type moderationCollector func(request map[string]any, input *service.ModerationInput) []*moderationText
+
+// ModerateRequest 在选择渠道前审核请求内容，所有入站接口共用，避免切换接口绕过审核规则。
+// 覆盖 OpenAI 格式的文本、向量、审核、Responses、图片、语音合成和转写、重排序接口，以及视频、Suno 和 Midjourney 任务提交；
+// Realtime WebSocket 暂不审核。redact 时改写缓存的请求体，重试和透传都使用改写后的内容，
+// multipart 请求无法改写，命中 redact 规则时按拦截处理
+func ModerateRequest(c *gin.Context, relayMode int) error {
+	return moderateRequestBody(c, func(request map[string]any, input *service.ModerationInput) []*moderationText {
+		return collectOpenAIModerationTexts(relayMode, request, input)
+	})
+}
+
+// ModerateClaudeRequest 审核 Claude Messages 格式的请求
+func ModerateClaudeRequest(c *gin.Context) error {
+	return moderateRequestBody(c, func(request map[string]any, input *service.ModerationInput) []*moderationText {
+		texts := moderationFieldTexts(request, "system", "text")
+		for _, message := range moderationList(request["messages"]) {
+			texts = append(texts, moderationFieldTexts(message, "content", "text")...)
+		}
+		return texts
+	})
+}
+
+// ModerateGeminiRequest 审核 Gemini 原生格式的请求
+func ModerateGeminiRequest(c *gin.Context) error {
+	return moderateRequestBody(c, func(request map[string]any, input *service.ModerationInput) []*moderationText {
+		var texts []*moderationText
+		contents := moderationList(request["contents"])
+		for _, key := range []string{"systemInstruction", "system_instruction"} {
+			if instruction, ok := request[key].(map[string]any); ok {
+				contents = append(contents, instruction)
+			}
+		}
+		for _, content := range contents {
+			for _, part := range moderationList(content["parts"]) {
+				texts = append(texts, moderationFieldTexts(part, "text", "")...)
+			}
+		}
+		return texts
+	})
+}
+
+func collectOpenAIModerationTexts(relayMode int, request map[string]any, input *service.ModerationInput) []*moderationText {
+	var texts []*moderationText
+	switch relayMode {
+	case relayconstant.RelayModeChatCompletions:
+		for _, message := range moderationList(request["messages"]) {
+			texts = append(texts, moderationFieldTexts(message, "content", "text")...)
+			for _, part := range moderationList(message["content"]) {
+				if part["type"] == dto.ContentTypeImageURL {
+					input.ImageUrls = appendModerationImage(input.ImageUrls, part["image_url"])
+				}
+			}
+		}
+	case relayconstant.RelayModeResponses:
+		texts = append(texts, moderationFieldTexts(request, "instructions", "")...)
+		texts = append(texts, moderationFieldTexts(request, "input", "")...)
+		for _, item := range moderationList(request["input"]) {
+			texts = append(texts, moderationFieldTexts(item, "content", "text")...)
+			for _, part := range moderationList(item["content"]) {
+				if part["type"] == "input_image" {
+					input.ImageUrls = appendModerationImage(input.ImageUrls, part["image_url"])
+				}
+			}
+		}
+	case relayconstant.RelayModeCompletions, relayconstant.RelayModeImagesGenerations, relayconstant.RelayModeImagesEdits,
+		relayconstant.RelayModeAudioTranscription, relayconstant.RelayModeAudioTranslation, relayconstant.RelayModeVideoSubmit,
+		relayconstant.RelayModeMidjourneyImagine, relayconstant.RelayModeMidjourneyShorten:
+		texts = moderationFieldTexts(request, "prompt", "")
+	case relayconstant.RelayModeSunoSubmit:
+		for _, key := range []string{"prompt", "gpt_description_prompt", "title", "tags"} {
+			texts = append(texts, moderationFieldTexts(request, key, "")...)
+		}
+	case relayconstant.RelayModeEmbeddings, relayconstant.RelayModeModerations, relayconstant.RelayModeAudioSpeech:
+		texts = moderationFieldTexts(request, "input", "")
+	case relayconstant.RelayModeRerank:
+		texts = append(moderationFieldTexts(request, "query", ""), moderationFieldTexts(request, "documents", "")...)
+	case relayconstant.RelayModeEdits:
+		texts = append(moderationFieldTexts(request, "input", ""), moderationFieldTexts(request, "instruction", "")...)
+	}
+	return texts
+}
+
+// moderationFieldTexts 收集字符串或字符串数组类型的字段，partKey 不为空时同时收集对象数组中 type 为 text 类元素的 partKey 字段
+func moderationFieldTexts(holder map[string]any, key string, partKey string) []*moderationText {
+	switch value := holder[key].(type) {
+	case string:
+		return []*moderationText{{value: value, set: func(s string) { holder[key] = s }}}
+	case []any:
+		var texts []*moderationText
+		for i, item := range value {
+			switch v := item.(type) {
+			case string:
+				texts = append(texts, &moderationText{value: v, set: func(s string) { value[i] = s }})
+			case map[string]any:
+				if partKey == "" {
+					continue
+				}
+				if partType, _ := v["type"].(string); partType == "" || strings.HasSuffix(partType, "text") {
+					texts = append(texts, moderationFieldTexts(v, partKey, "")...)
+				}
+			}
+		}
+		return texts
+	}
+	return nil
+}
+
+// moderationList 返回对象数组字段中的对象
+func moderationList(value any) []map[string]any {
+	list, _ := value.([]any)
+	items := make([]map[string]any, 0, len(list))
+	for _, item := range list {
+		if m, ok := item.(map[string]any); ok {
+			items = append(items, m)
+		}
+	}
+	return items
+}
+
+func appendModerationImage(urls []string, image any) []string {
+	switch v := image.(type) {
+	case string:
+		if v != "" {
+			urls = append(urls, v)
+		}
+	case map[string]any:
+		if url, ok := v["url"].(string); ok && url != "" {
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
+
+func moderateRequestBody(c *gin.Context, collect moderationCollector) error {
+	if c.GetBool("prompt_moderated") {
+		return nil
+	}
+	if len(setting.GetModerationRules(setting.ModerationStagePrompt, c.GetString("group"), c.GetString("original_model"))) == 0 {
+		return nil
+	}
+	body, err := common.GetRequestBody(c)
+	if err != nil {
+		return nil
+	}
+	multipartForm := strings.HasPrefix(c.Request.Header.Get("Content-Type"), "multipart/form-data")
+	var request map[string]any
+	if multipartForm {
+		request = parseMultipartModerationFields(c.Request.Header.Get("Content-Type"), body)
+	} else {
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		// 请求格式错误时交给后续处理返回参数错误
+		if decoder.Decode(&request) != nil {
+			return nil
+		}
+	}
+	input := &service.ModerationInput{}
+	texts := collect(request, input)
+	values := make([]string, len(texts))
+	for i, text := range texts {
+		values[i] = text.value
+		input.Texts = append(input.Texts, &values[i])
+	}
+	if err = service.Moderate(c, setting.ModerationStagePrompt, c.GetString("original_model"), input); err != nil {
+		return err
+	}
+	c.Set("prompt_moderated", true)
+
+	changed := false
+	for i, text := range texts {
+		if values[i] != text.value {
+			text.set(values[i])
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	if multipartForm {
+		return fmt.Errorf("%w: multipart 请求内容无法改写", service.ErrModerationBlocked)
+	}
+	if body, err = json.Marshal(request); err != nil {
+		return err
+	}
+	c.Set(common.KeyRequestBody, body)
+	return nil
+}
+
+// parseMultipartModerationFields 读取 multipart 请求中的文本字段，文件字段跳过
+func parseMultipartModerationFields(contentType string, body []byte) map[string]any {
+	fields := make(map[string]any)
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil || params["boundary"] == "" {
+		return fields
+	}
+	reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			break
+		}
+		if part.FileName() == "" {
+			if value, err := io.ReadAll(part); err == nil {
+				fields[part.FormName()] = string(value)
+			}
+		}
+		_ = part.Close()
+	}
+	return fields
+}
+
+// moderationStreamEvent 一个待审核的 SSE 事件，text 为第一个 choice 的内容
+type moderationStreamEvent struct {
+	raw    []byte
+	data   map[string]any
+	choice map[string]any
+	field  string
+	text   string
+}
+
+// moderationWriter 审核返回给客户端的内容：流式响应按 StreamCheckChars 分段审核后再输出，
+// 非流式响应保存完整响应体，在 finish 时审核后输出
+type moderationWriter struct {
+	gin.ResponseWriter
+	c            *gin.Context
+	modelName    string
+	buffer       bytes.Buffer
+	pending      []*moderationStreamEvent
+	pendingChars int
+	// overlap 和 tail 为上一段已输出内容的末尾，与下一段一起审核，避免命中内容跨段
+	overlap  int
+	tail     string
+	lastData map[string]any
+	blocked  bool
+}
+
+// newModerationWriter 没有对 completion 生效的审核规则时返回 nil
+func newModerationWriter(c *gin.Context, info *relaycommon.RelayInfo) *moderationWriter {
+	if info.RelayMode != relayconstant.RelayModeChatCompletions && info.RelayMode != relayconstant.RelayModeCompletions {
+		return nil
+	}
+	if len(setting.GetModerationRules(setting.ModerationStageCompletion, info.Group, info.OriginModelName)) == 0 {
+		return nil
+	}
+	writer := &moderationWriter{
+		ResponseWriter: c.Writer,
+		c:              c,
+		modelName:      info.OriginModelName,
+		overlap:        service.ModerationOverlapChars(setting.ModerationStageCompletion, info.Group, info.OriginModelName),
+	}
+	c.Writer = writer
+	return writer
+}
+
+func (w *moderationWriter) isStream() bool {
+	return strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream")
+}
+
+func (w *moderationWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *moderationWriter) Write(data []byte) (int, error) {
+	// 被拦截后丢弃剩余内容，上游响应仍会读取完毕以便正常计费
+	if w.blocked {
+		return len(data), nil
+	}
+	w.buffer.Write(data)
+	if !w.isStream() {
+		return len(data), nil
+	}
+	for {
+		idx := bytes.Index(w.buffer.Bytes(), []byte("\n\n"))
+		if idx < 0 {
+			break
+		}
+		raw := make([]byte, idx+2)
+		copy(raw, w.buffer.Next(idx+2))
+		w.handleEvent(raw)
+		if w.blocked {
+			w.buffer.Reset()
+			break
+		}
+	}
+	return len(data), nil
+}
+
+func (w *moderationWriter) handleEvent(raw []byte) {
+	payload := strings.TrimSpace(string(raw))
+	if !strings.HasPrefix(payload, "data:") {
+		w.pending = append(w.pending, &moderationStreamEvent{raw: raw})
+		return
+	}
+	payload = strings.TrimSpace(strings.TrimPrefix(payload, "data:"))
+	if payload == "[DONE]" {
+		w.flushPending()
+		if !w.blocked {
+			w.writeRaw(raw)
+		}
+		return
+	}
+	event := &moderationStreamEvent{raw: raw}
+	if err := json.Unmarshal([]byte(payload), &event.data); err == nil {
+		w.lastData = event.data
+		finished := false
+		if choices, ok := event.data["choices"].([]any); ok && len(choices) > 0 {
+			if choice, ok := choices[0].(map[string]any); ok {
+				event.choice = choice
+				if delta, ok := choice["delta"].(map[string]any); ok {
+					if content, ok := delta["content"].(string); ok {
+						event.field, event.text = "content", content
+					}
+				} else if text, ok := choice["text"].(string); ok {
+					event.field, event.text = "text", text
+				}
+				finished = choice["finish_reason"] != nil
+			}
+		}
+		w.pendingChars += utf8.RuneCountInString(event.text)
+		w.pending = append(w.pending, event)
+		if finished || w.pendingChars >= setting.GetModerationSetting().StreamCheckChars {
+			w.flushPending()
+		}
+		return
+	}
+	w.pending = append(w.pending, event)
+}
+
+// flushPending 审核暂存的事件，通过后输出给客户端
+func (w *moderationWriter) flushPending() {
+	if len(w.pending) == 0 {
+		return
+	}
+	var builder strings.Builder
+	builder.WriteString(w.tail)
+	for _, event := range w.pending {
+		builder.WriteString(event.text)
+	}
+	original := builder.String()
+	checked := original
+	err := service.Moderate(w.c, setting.ModerationStageCompletion, w.modelName, &service.ModerationInput{Texts: []*string{&checked}})
+	if errors.Is(err, service.ErrModerationBlocked) {
+		w.block()
+		return
+	}
+	text := original[len(w.tail):]
+	if checked != original {
+		// tail 已经输出，替换只作用于本段；命中内容跨段时从第一处变化开始输出替换后的内容
+		if strings.HasPrefix(checked, w.tail) {
+			text = checked[len(w.tail):]
+		} else {
+			text = checked[commonPrefixLength(original, checked):]
+		}
+	}
+	w.tail = lastRunes(w.tail+text, w.overlap)
+	if checked != original {
+		// 替换后的内容放到第一个有内容的事件中，其余事件清空内容
+		for _, event := range w.pending {
+			if event.field == "" {
+				continue
+			}
+			w.setEventText(event, text)
+			text = ""
+		}
+	}
+	for _, event := range w.pending {
+		w.writeRaw(event.raw)
+	}
+	w.pending = w.pending[:0]
+	w.pendingChars = 0
+	w.ResponseWriter.Flush()
+}
+
+// commonPrefixLength 返回两个字符串相同前缀的字节数，不会截断多字节字符
+func commonPrefixLength(a string, b string) int {
+	n := 0
+	for n < len(a) && n < len(b) {
+		r, size := utf8.DecodeRuneInString(a[n:])
+		if rb, sizeB := utf8.DecodeRuneInString(b[n:]); r != rb || size != sizeB {
+			break
+		}
+		n += size
+	}
+	return n
+}
+
+// lastRunes 返回 s 末尾的 n 个字符
+func lastRunes(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[len(runes)-n:])
+}
+
+func (w *moderationWriter) setEventText(event *moderationStreamEvent, text string) {
+	if event.field == "content" {
+		event.choice["delta"].(map[string]any)["content"] = text
+	} else {
+		event.choice["text"] = text
+	}
+	jsonData, err := json.Marshal(event.data)
+	if err != nil {
+		common.SysError("error marshalling moderated stream response: " + err.Error())
+		return
+	}
+	event.raw = []byte("data: " + string(jsonData) + "\n\n")
+}
+
+// block 丢弃暂存的事件，以 content_filter 结束生成
+func (w *moderationWriter) block() {
+	w.blocked = true
+	w.pending = nil
+	response := map[string]any{
+		"choices": []any{map[string]any{
+			"index":         0,
+			"delta":         map[string]any{},
+			"finish_reason": "content_filter",
+		}},
+	}
+	for _, key := range []string{"id", "object", "created", "model"} {
+		if value, ok := w.lastData[key]; ok {
+			response[key] = value
+		}
+	}
+	jsonData, _ := json.Marshal(response)
+	w.writeRaw([]byte("data: " + string(jsonData) + "\n\n"))
+	w.writeRaw([]byte("data: [DONE]\n\n"))
+	w.ResponseWriter.Flush()
+}
+
+func (w *moderationWriter) writeRaw(data []byte) {
+	if _, err := w.ResponseWriter.Write(data); err != nil {
+		common.LogError(w.c, "error writing moderated response: "+err.Error())
+	}
+}
+
+// finish 输出剩余内容并恢复原始 writer，需要在 DoResponse 之后调用
+func (w *moderationWriter) finish() {
+	if w == nil {
+		return
+	}
+	w.c.Writer = w.ResponseWriter
+	if w.blocked {
+		return
+	}
+	if w.isStream() {
+		if w.buffer.Len() > 0 {
+			w.pending = append(w.pending, &moderationStreamEvent{raw: w.buffer.Bytes()})
+		}
+		w.flushPending()
+		return
+	}
+	body := w.buffer.Bytes()
+	if moderated, ok := w.moderateResponseBody(body); ok {
+		body = moderated
+	}
+	if len(body) > 0 {
+		w.Header().Del("Content-Length")
+		w.writeRaw(body)
+	}
+}
+
+// moderateResponseBody 审核非流式响应中每个 choice 的内容，内容有变化时返回新的响应体
+func (w *moderationWriter) moderateResponseBody(body []byte) ([]byte, bool) {
+	if w.Status() != http.StatusOK {
+		return nil, false
+	}
+	var response map[string]any
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, false
+	}
+	choices, _ := response["choices"].([]any)
+	input := &service.ModerationInput{}
+	type choiceText struct {
+		choice  map[string]any
+		holder  map[string]any
+		field   string
+		text    *string
+		initial string
+	}
+	var items []choiceText
+	for _, c := range choices {
+		choice, ok := c.(map[string]any)
+		if !ok {
+			continue
+		}
+		item := choiceText{choice: choice}
+		if message, ok := choice["message"].(map[string]any); ok {
+			if content, ok := message["content"].(string); ok {
+				item.holder, item.field, item.text = message, "content", &content
+			}
+		} else if text, ok := choice["text"].(string); ok {
+			item.holder, item.field, item.text = choice, "text", &text
+		}
+		if item.text == nil {
+			continue
+		}
+		item.initial = *item.text
+		input.Texts = append(input.Texts, item.text)
+		items = append(items, item)
+	}
+	if len(items) == 0 {
+		return nil, false
+	}
+	err := service.Moderate(w.c, setting.ModerationStageCompletion, w.modelName, input)
+	if errors.Is(err, service.ErrModerationBlocked) {
+		w.blocked = true
+	}
+	changed := w.blocked
+	for _, item := range items {
+		if w.blocked {
+			item.holder[item.field] = ""
+			item.choice["finish_reason"] = "content_filter"
+		} else if *item.text != item.initial {
+			item.holder[item.field] = *item.text
+			changed = true
+		}
+	}
+	if !changed {
+		return nil, false
+	}
+	moderated, err := json.Marshal(response)
+	if err != nil {
+		return nil, false
+	}
+	return moderated, true
+}
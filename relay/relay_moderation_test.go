@@ -0,0 +1,256 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"one-api/common"
+	"one-api/model"
+	relaycommon "one-api/relay/common"
+	relayconstant "one-api/relay/constant"
+	"one-api/service"
+	"one-api/setting"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCollectOpenAIModerationTexts(t *testing.T) {
+	tests := []struct {
+		name      string
+		relayMode int
+		body      string
+		texts     []string
+		images    []string
+	}{
+		{
+			name:      "chat string and parts",
+			relayMode: relayconstant.RelayModeChatCompletions,
+			body: `{"messages":[{"role":"system","content":"sys"},{"role":"user","content":[
+				{"type":"text","text":"hello"},{"type":"image_url","image_url":{"url":"https://a/b.png"}}]}]}`,
+			texts:  []string{"sys", "hello"},
+			images: []string{"https://a/b.png"},
+		},
+		{
+			name:      "responses input items",
+			relayMode: relayconstant.RelayModeResponses,
+			body: `{"instructions":"be nice","input":[{"role":"user","content":[
+				{"type":"input_text","text":"hi"},{"type":"input_image","image_url":"https://a/c.png"}]}]}`,
+			texts:  []string{"be nice", "hi"},
+			images: []string{"https://a/c.png"},
+		},
+		{
+			name:      "responses string input",
+			relayMode: relayconstant.RelayModeResponses,
+			body:      `{"input":"hi"}`,
+			texts:     []string{"hi"},
+		},
+		{
+			name:      "embeddings array",
+			relayMode: relayconstant.RelayModeEmbeddings,
+			body:      `{"input":["a","b"]}`,
+			texts:     []string{"a", "b"},
+		},
+		{
+			name:      "image generation",
+			relayMode: relayconstant.RelayModeImagesGenerations,
+			body:      `{"prompt":"a cat"}`,
+			texts:     []string{"a cat"},
+		},
+		{
+			name:      "video submit",
+			relayMode: relayconstant.RelayModeVideoSubmit,
+			body:      `{"model":"kling-v1","prompt":"a dog"}`,
+			texts:     []string{"a dog"},
+		},
+		{
+			name:      "rerank",
+			relayMode: relayconstant.RelayModeRerank,
+			body:      `{"query":"q","documents":["d1","d2"]}`,
+			texts:     []string{"q", "d1", "d2"},
+		},
+		{
+			name:      "fetch has nothing",
+			relayMode: relayconstant.RelayModeVideoFetchByID,
+			body:      `{"prompt":"ignored"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var request map[string]any
+			if err := json.Unmarshal([]byte(tt.body), &request); err != nil {
+				t.Fatal(err)
+			}
+			input := &service.ModerationInput{}
+			var texts []string
+			for _, text := range collectOpenAIModerationTexts(tt.relayMode, request, input) {
+				texts = append(texts, text.value)
+			}
+			if !reflect.DeepEqual(texts, tt.texts) {
+				t.Errorf("texts = %v, want %v", texts, tt.texts)
+			}
+			if !reflect.DeepEqual(input.ImageUrls, tt.images) {
+				t.Errorf("images = %v, want %v", input.ImageUrls, tt.images)
+			}
+		})
+	}
+}
+
+func setupModerationTest(t *testing.T, action string) {
+	t.Helper()
+	setupTestDB(t, &model.ModerationLog{})
+	oldSetting := *setting.GetModerationSetting()
+	moderationSetting := setting.GetModerationSetting()
+	moderationSetting.Enabled = true
+	moderationSetting.Rules = []setting.ModerationRule{{
+		Name:     "test",
+		Provider: setting.ModerationProviderKeyword,
+		Action:   action,
+		Words:    []string{"secret"},
+	}}
+	t.Cleanup(func() { *setting.GetModerationSetting() = oldSetting })
+}
+
+func newModerationContext(body []byte, contentType string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	c.Request.Header.Set("Content-Type", contentType)
+	return c
+}
+
+func TestModerateRequest(t *testing.T) {
+	t.Run("block on any endpoint", func(t *testing.T) {
+		setupModerationTest(t, setting.ModerationActionBlock)
+		c := newModerationContext([]byte(`{"prompt":"my secret"}`), "application/json")
+		err := ModerateRequest(c, relayconstant.RelayModeImagesGenerations)
+		if !errors.Is(err, service.ErrModerationBlocked) {
+			t.Fatalf("err = %v, want blocked", err)
+		}
+	})
+
+	t.Run("block gemini native", func(t *testing.T) {
+		setupModerationTest(t, setting.ModerationActionBlock)
+		c := newModerationContext([]byte(`{"contents":[{"parts":[{"text":"a secret"}]}]}`), "application/json")
+		if err := ModerateGeminiRequest(c); !errors.Is(err, service.ErrModerationBlocked) {
+			t.Fatalf("err = %v, want blocked", err)
+		}
+	})
+
+	t.Run("redact rewrites body", func(t *testing.T) {
+		setupModerationTest(t, setting.ModerationActionRedact)
+		c := newModerationContext([]byte(`{"model":"m","seed":9007199254740993,"messages":[{"role":"user","content":"my secret"}]}`), "application/json")
+		if err := ModerateRequest(c, relayconstant.RelayModeChatCompletions); err != nil {
+			t.Fatal(err)
+		}
+		body, _ := common.GetRequestBody(c)
+		if bytes.Contains(body, []byte("secret")) {
+			t.Errorf("body not redacted: %s", body)
+		}
+		if !bytes.Contains(body, []byte("9007199254740993")) {
+			t.Errorf("number precision lost: %s", body)
+		}
+	})
+
+	t.Run("redact multipart is blocked", func(t *testing.T) {
+		setupModerationTest(t, setting.ModerationActionRedact)
+		var buf bytes.Buffer
+		writer := multipart.NewWriter(&buf)
+		_ = writer.WriteField("prompt", "my secret")
+		part, _ := writer.CreateFormFile("image", "a.png")
+		_, _ = part.Write([]byte("secret"))
+		_ = writer.Close()
+		c := newModerationContext(buf.Bytes(), writer.FormDataContentType())
+		if err := ModerateRequest(c, relayconstant.RelayModeImagesEdits); !errors.Is(err, service.ErrModerationBlocked) {
+			t.Fatalf("err = %v, want blocked", err)
+		}
+	})
+
+	t.Run("clean request passes", func(t *testing.T) {
+		setupModerationTest(t, setting.ModerationActionBlock)
+		c := newModerationContext([]byte(`{"input":"hello"}`), "application/json")
+		if err := ModerateRequest(c, relayconstant.RelayModeEmbeddings); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func streamDelta(content string) string {
+	data, _ := json.Marshal(map[string]any{"choices": []any{map[string]any{"index": 0, "delta": map[string]any{"content": content}}}})
+	return "data: " + string(data) + "\n\n"
+}
+
+// streamContent 拼接客户端收到的流式内容，被拦截时返回 content_filter
+func streamContent(t *testing.T, body string) (string, string) {
+	t.Helper()
+	var builder strings.Builder
+	finishReason := ""
+	for _, event := range strings.Split(body, "\n\n") {
+		payload := strings.TrimPrefix(strings.TrimSpace(event), "data: ")
+		if payload == "" || payload == "[DONE]" {
+			continue
+		}
+		var response struct {
+			Choices []struct {
+				Delta        map[string]any `json:"delta"`
+				FinishReason *string        `json:"finish_reason"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal([]byte(payload), &response); err != nil {
+			t.Fatalf("invalid event %q: %v", payload, err)
+		}
+		if content, ok := response.Choices[0].Delta["content"].(string); ok {
+			builder.WriteString(content)
+		}
+		if response.Choices[0].FinishReason != nil {
+			finishReason = *response.Choices[0].FinishReason
+		}
+	}
+	return builder.String(), finishReason
+}
+
+func TestModerationWriterStreamOverlap(t *testing.T) {
+	tests := []struct {
+		name         string
+		action       string
+		chunks       []string
+		content      string
+		finishReason string
+	}{
+		{"clean stream", setting.ModerationActionBlock, []string{"hello ", "world, ", "nothing here"}, "hello world, nothing here", ""},
+		{"block word split across segments", setting.ModerationActionBlock, []string{"tell me the se", "cret now"}, "tell me the se", "content_filter"},
+		{"redact word inside segment", setting.ModerationActionRedact, []string{"a secret and", " more text"}, "a **###** and more text", ""},
+		{"redact word split across segments", setting.ModerationActionRedact, []string{"xx sec", "ret yy"}, "xx sec**###** yy", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupModerationTest(t, tt.action)
+			moderationSetting := setting.GetModerationSetting()
+			moderationSetting.StreamCheckChars = 5
+			moderationSetting.Rules[0].Stages = []string{setting.ModerationStageCompletion}
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+			writer := newModerationWriter(c, &relaycommon.RelayInfo{RelayMode: relayconstant.RelayModeChatCompletions, Group: "default", OriginModelName: "gpt-4o"})
+			if writer == nil {
+				t.Fatal("moderation writer not created")
+			}
+			c.Header("Content-Type", "text/event-stream")
+			for _, chunk := range tt.chunks {
+				_, _ = c.Writer.WriteString(streamDelta(chunk))
+			}
+			_, _ = c.Writer.WriteString("data: [DONE]\n\n")
+			writer.finish()
+
+			content, finishReason := streamContent(t, w.Body.String())
+			if content != tt.content || finishReason != tt.finishReason {
+				t.Errorf("content = %q, finish reason = %q, want %q, %q", content, finishReason, tt.content, tt.finishReason)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package relay
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/dto"
+	"one-api/model"
+	relaycommon "one-api/relay/common"
+	"one-api/relay/helper"
+	"one-api/service"
+	"one-api/setting/operation_setting"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+// responseCacheWriter 在向客户端写出响应的同时保存一份副本，超过大小限制后停止保存
+type responseCacheWriter struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+func (w *responseCacheWriter) Write(data []byte) (int, error) {
+	w.capture(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseCacheWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *responseCacheWriter) capture(data []byte) {
+	if w.overflow {
+		return
+	}
+	if w.body.Len()+len(data) > w.limit {
+		w.overflow = true
+		w.body.Reset()
+		return
+	}
+	w.body.Write(data)
+}
+
+// responseCache 单次请求的缓存上下文，为 nil 表示该请求不使用缓存
+type responseCache struct {
+	key    string
+	ttl    time.Duration
+	writer *responseCacheWriter
+}
+
+// getResponseCache 判断请求是否可以缓存并生成缓存键，cacheable 由调用方根据请求参数判断
+func getResponseCache(c *gin.Context, info *relaycommon.RelayInfo, cacheable bool) *responseCache {
+	if !cacheable {
+		return nil
+	}
+	ttl := operation_setting.GetResponseCacheSetting().GetTTLSeconds(info.OriginModelName, c.GetBool("token_response_cache"))
+	if ttl <= 0 {
+		return nil
+	}
+	body, err := common.GetRequestBody(c)
+	if err != nil {
+		return nil
+	}
+	key, err := service.GenerateResponseCacheKey(info.Group, info.OriginModelName, info.RelayMode, body)
+	if err != nil {
+		return nil
+	}
+	return &responseCache{
+		key: key,
+		ttl: time.Duration(ttl) * time.Second,
+	}
+}
+
+// serve 命中缓存时直接返回缓存的响应并按缓存倍率计费，请求头 Cache-Control: no-cache 时跳过查询；
+// 写出响应前按缓存计费的额度完整预扣，额度或预算不足时返回错误
+func (rc *responseCache) serve(c *gin.Context, info *relaycommon.RelayInfo, priceData helper.PriceData) (bool, *dto.OpenAIErrorWithStatusCode) {
+	if rc == nil || c.GetHeader("Cache-Control") == "no-cache" {
+		return false, nil
+	}
+	entry, ok := service.GetResponseCache(rc.key)
+	if !ok || entry.IsStream != info.IsStream {
+		return false, nil
+	}
+	originalQuota, quota := responseCacheQuota(&entry.Usage, priceData)
+	userQuota, openaiErr := preConsumeResponseCacheQuota(info, quota)
+	if openaiErr != nil {
+		return false, openaiErr
+	}
+	c.Set("response_cache_hit", true)
+	c.Header("X-Response-Cache", "hit")
+	if entry.IsStream {
+		helper.SetEventStreamHeaders(c)
+		c.Status(http.StatusOK)
+		for _, event := range bytes.SplitAfter(entry.Body, []byte("\n\n")) {
+			if len(event) == 0 {
+				continue
+			}
+			if _, err := c.Writer.Write(event); err != nil {
+				break
+			}
+			c.Writer.Flush()
+		}
+	} else {
+		c.Data(http.StatusOK, entry.ContentType, entry.Body)
+	}
+	postResponseCacheQuota(c, info, &entry.Usage, userQuota, originalQuota, quota, priceData)
+	return true, nil
+}
+
+// responseCacheQuota 返回按原价计算的额度和按缓存倍率计算的实际额度
+func responseCacheQuota(usage *dto.Usage, priceData helper.PriceData) (int, int) {
+	billingRatio := operation_setting.GetResponseCacheSetting().BillingRatio
+	originalQuota := calculateTextQuota(usage, priceData)
+	quota := int(decimal.NewFromInt(int64(originalQuota)).Mul(decimal.NewFromFloat(billingRatio)).Round(0).IntPart())
+	return originalQuota, quota
+}
+
+// preConsumeResponseCacheQuota 命中缓存时的额度已知，与 preConsumeQuota 不同，不信任额度充足的用户和令牌，
+// 始终检查令牌剩余额度和周期预算并完整预扣，之后无需再结算差额
+func preConsumeResponseCacheQuota(info *relaycommon.RelayInfo, quota int) (int, *dto.OpenAIErrorWithStatusCode) {
+	userQuota, err := service.GetAvailableQuota(info.UserId, info.OrgId)
+	if err != nil {
+		return 0, service.OpenAIErrorWrapperLocal(err, "get_user_quota_failed", http.StatusInternalServerError)
+	}
+	if userQuota <= 0 || userQuota < quota {
+		return 0, service.OpenAIErrorWrapperLocal(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
+	}
+	info.UserQuota = userQuota
+	if quota == 0 {
+		return userQuota, nil
+	}
+	if err = service.PreConsumeTokenQuota(info, quota); err != nil {
+		return 0, service.OpenAIErrorWrapperLocal(err, "pre_consume_token_quota_failed", http.StatusForbidden)
+	}
+	if err = model.DecreaseBillingQuota(info.UserId, info.OrgId, quota); err != nil {
+		return 0, service.OpenAIErrorWrapperLocal(err, "decrease_user_quota_failed", http.StatusInternalServerError)
+	}
+	return userQuota, nil
+}
+
+// capture 替换 c.Writer 以保存本次响应，需要在请求上游之前调用
+func (rc *responseCache) capture(c *gin.Context) {
+	if rc == nil {
+		return
+	}
+	rc.writer = &responseCacheWriter{
+		ResponseWriter: c.Writer,
+		limit:          operation_setting.GetResponseCacheSetting().MaxEntrySizeKB << 10,
+	}
+	c.Writer = rc.writer
+}
+
+// save 恢复原始 writer，请求成功且响应未超过大小限制时写入缓存
+func (rc *responseCache) save(c *gin.Context, info *relaycommon.RelayInfo, usageData any, success bool) {
+	if rc == nil || rc.writer == nil {
+		return
+	}
+	c.Writer = rc.writer.ResponseWriter
+	usage, ok := usageData.(*dto.Usage)
+	if !success || !ok || usage == nil || rc.writer.overflow || rc.writer.body.Len() == 0 || c.Writer.Status() != http.StatusOK {
+		return
+	}
+	service.SetResponseCache(rc.key, &service.ResponseCacheEntry{
+		IsStream:    info.IsStream,
+		ContentType: c.Writer.Header().Get("Content-Type"),
+		Body:        rc.writer.body.Bytes(),
+		Usage:       *usage,
+		CreatedAt:   common.GetTimestamp(),
+	}, rc.ttl)
+}
+
+// postResponseCacheQuota 额度已在写出响应前预扣，这里只记录用量和日志
+func postResponseCacheQuota(c *gin.Context, info *relaycommon.RelayInfo, usage *dto.Usage, userQuota int, originalQuota int, quota int, priceData helper.PriceData) {
+	_, span := common.StartSpan(c.Request.Context(), "billing")
+	defer span.End()
+	billingRatio := operation_setting.GetResponseCacheSetting().BillingRatio
+	model.UpdateUserUsedQuotaAndRequestCount(info.UserId, quota)
+
+	logContent := fmt.Sprintf("命中响应缓存，缓存计费倍率 %.2f，原始额度 %d", billingRatio, originalQuota)
+	other := service.GenerateTextOtherInfo(c, info, priceData.ModelRatio, priceData.GroupRatio, priceData.CompletionRatio,
+		usage.PromptTokensDetails.CachedTokens, priceData.CacheRatio, priceData.ModelPrice)
+	other["response_cache"] = true
+	other["response_cache_ratio"] = billingRatio
+	other["original_quota"] = originalQuota
+	useTimeSeconds := time.Now().Unix() - info.StartTime.Unix()
+	// 命中缓存时没有请求上游，渠道记为 0
+	model.RecordConsumeLog(c, info.UserId, 0, usage.PromptTokens, usage.CompletionTokens, info.OriginModelName,
+		c.GetString("token_name"), quota, logContent, info.TokenId, userQuota, int(useTimeSeconds), info.IsStream, info.Group, other)
+}
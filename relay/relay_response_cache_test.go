@@ -0,0 +1,192 @@
+package relay
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"one-api/dto"
+	"one-api/model"
+	relaycommon "one-api/relay/common"
+	relayconstant "one-api/relay/constant"
+	"one-api/relay/helper"
+	"one-api/service"
+	"one-api/setting/operation_setting"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func setupResponseCacheTest(t *testing.T) *gorm.DB {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB(t, &model.User{}, &model.Token{}, &model.Log{}, &model.CreditAccount{}, &model.TokenBudgetUsage{})
+	cacheSetting := operation_setting.GetResponseCacheSetting()
+	oldSetting := *cacheSetting
+	cacheSetting.Enabled = true
+	cacheSetting.DefaultTTLSeconds = 30
+	cacheSetting.ModelTTLSeconds = map[string]int{"cached-model": 60, "uncached-model": 0}
+	cacheSetting.MaxEntrySizeKB = 1
+	cacheSetting.MaxMemoryEntries = 100
+	cacheSetting.BillingRatio = 0.5
+	t.Cleanup(func() { *cacheSetting = oldSetting })
+	return db
+}
+
+func newResponseCacheContext(body string) (*gin.Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	return c, w
+}
+
+func TestGetResponseCacheTTL(t *testing.T) {
+	setupResponseCacheTest(t)
+	tests := []struct {
+		name         string
+		model        string
+		tokenEnabled bool
+		cacheable    bool
+		ttl          time.Duration
+	}{
+		{"model setting", "cached-model", false, true, time.Minute},
+		{"model disabled overrides token", "uncached-model", true, true, 0},
+		{"token default", "other-model", true, true, 30 * time.Second},
+		{"not enabled for token", "other-model", false, true, 0},
+		{"not cacheable request", "cached-model", true, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newResponseCacheContext(`{"model":"m"}`)
+			c.Set("token_response_cache", tt.tokenEnabled)
+			info := &relaycommon.RelayInfo{OriginModelName: tt.model, Group: "default", RelayMode: relayconstant.RelayModeChatCompletions}
+			cache := getResponseCache(c, info, tt.cacheable)
+			if tt.ttl == 0 {
+				if cache != nil {
+					t.Errorf("cache = %+v, want nil", cache)
+				}
+				return
+			}
+			if cache == nil || cache.ttl != tt.ttl {
+				t.Errorf("cache = %+v, want ttl %s", cache, tt.ttl)
+			}
+		})
+	}
+}
+
+func TestResponseCacheWriterSizeLimit(t *testing.T) {
+	setupResponseCacheTest(t)
+	c, w := newResponseCacheContext(`{}`)
+	cache := &responseCache{key: "response_cache:size-limit", ttl: time.Minute}
+	cache.capture(c)
+	chunk := strings.Repeat("a", 600)
+	_, _ = c.Writer.WriteString(chunk)
+	_, _ = c.Writer.WriteString(chunk)
+	cache.save(c, &relaycommon.RelayInfo{}, &dto.Usage{TotalTokens: 1}, true)
+	if w.Body.Len() != 1200 {
+		t.Errorf("client received %d bytes, want 1200", w.Body.Len())
+	}
+	if _, ok := service.GetResponseCache(cache.key); ok {
+		t.Error("response larger than max_entry_size_kb was cached")
+	}
+}
+
+func TestResponseCacheServe(t *testing.T) {
+	db := setupResponseCacheTest(t)
+	priceData := helper.PriceData{ModelRatio: 1, GroupRatio: 1, CompletionRatio: 1, CacheRatio: 1}
+	// 原价 200，按缓存倍率 0.5 计费 100
+	usage := dto.Usage{PromptTokens: 100, CompletionTokens: 100, TotalTokens: 200}
+	streamBody := "data: {\"id\":\"1\"}\n\ndata: {\"id\":\"2\"}\n\ndata: [DONE]\n\n"
+	service.SetResponseCache("response_cache:json", &service.ResponseCacheEntry{
+		ContentType: "application/json", Body: []byte(`{"id":"cached"}`), Usage: usage}, time.Minute)
+	service.SetResponseCache("response_cache:stream", &service.ResponseCacheEntry{
+		IsStream: true, Body: []byte(streamBody), Usage: usage}, time.Minute)
+
+	tests := []struct {
+		name        string
+		key         string
+		isStream    bool
+		noCache     bool
+		userQuota   int
+		tokenQuota  int
+		unlimited   bool
+		budgetUsed  int
+		hit         bool
+		errCode     string
+		body        string
+		contentType string
+	}{
+		{name: "json hit", key: "response_cache:json", userQuota: 1000, tokenQuota: 1000, hit: true,
+			body: `{"id":"cached"}`, contentType: "application/json"},
+		{name: "stream hit replays events", key: "response_cache:stream", isStream: true, userQuota: 1000, tokenQuota: 1000, hit: true,
+			body: streamBody, contentType: "text/event-stream"},
+		{name: "unlimited token", key: "response_cache:json", userQuota: 1000, unlimited: true, hit: true,
+			body: `{"id":"cached"}`, contentType: "application/json"},
+		{name: "stream mismatch", key: "response_cache:json", isStream: true, userQuota: 1000, tokenQuota: 1000},
+		{name: "no-cache header", key: "response_cache:json", noCache: true, userQuota: 1000, tokenQuota: 1000},
+		{name: "miss", key: "response_cache:missing", userQuota: 1000, tokenQuota: 1000},
+		{name: "user quota below cache quota", key: "response_cache:json", userQuota: 50, tokenQuota: 1000, errCode: "insufficient_user_quota"},
+		{name: "token remain quota below cache quota", key: "response_cache:json", userQuota: 1000, tokenQuota: 50, errCode: "pre_consume_token_quota_failed"},
+		{name: "token budget used up", key: "response_cache:json", userQuota: 1000, tokenQuota: 1000, budgetUsed: 100, errCode: "pre_consume_token_quota_failed"},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userId := i + 1
+			user := &model.User{Id: userId, Username: "cache" + tt.name, Quota: tt.userQuota, AffCode: tt.name, Status: 1}
+			if err := db.Create(user).Error; err != nil {
+				t.Fatal(err)
+			}
+			token := &model.Token{UserId: userId, Key: "cachekey" + string(rune('a'+i)), Name: "t", RemainQuota: tt.tokenQuota,
+				UnlimitedQuota: tt.unlimited, DailyBudget: 100}
+			if err := db.Create(token).Error; err != nil {
+				t.Fatal(err)
+			}
+			model.RecordTokenBudgetUsage(token.Id, tt.budgetUsed)
+
+			c, w := newResponseCacheContext(`{}`)
+			if tt.noCache {
+				c.Request.Header.Set("Cache-Control", "no-cache")
+			}
+			info := &relaycommon.RelayInfo{UserId: userId, TokenId: token.Id, TokenKey: token.Key, TokenUnlimited: tt.unlimited,
+				TokenBudgetEnabled: true, IsStream: tt.isStream, StartTime: time.Now(), Group: "default", OriginModelName: "cached-model"}
+			cache := &responseCache{key: tt.key, ttl: time.Minute}
+			hit, openaiErr := cache.serve(c, info, priceData)
+			if hit != tt.hit {
+				t.Fatalf("hit = %v, want %v", hit, tt.hit)
+			}
+			wantUserQuota, wantTokenQuota := tt.userQuota, tt.tokenQuota
+			if tt.errCode != "" {
+				if openaiErr == nil || openaiErr.Error.Code != tt.errCode {
+					t.Fatalf("error = %+v, want %s", openaiErr, tt.errCode)
+				}
+				if w.Body.Len() != 0 {
+					t.Errorf("response written on error: %s", w.Body.String())
+				}
+			} else if openaiErr != nil {
+				t.Fatalf("unexpected error %+v", openaiErr)
+			}
+			if tt.hit {
+				if w.Body.String() != tt.body || !strings.HasPrefix(w.Header().Get("Content-Type"), tt.contentType) {
+					t.Errorf("body = %q, content type = %q", w.Body.String(), w.Header().Get("Content-Type"))
+				}
+				if w.Header().Get("X-Response-Cache") != "hit" {
+					t.Error("X-Response-Cache header missing")
+				}
+				wantUserQuota -= 100
+				wantTokenQuota -= 100
+			}
+			var stored model.User
+			db.First(&stored, userId)
+			if stored.Quota != wantUserQuota {
+				t.Errorf("user quota = %d, want %d", stored.Quota, wantUserQuota)
+			}
+			var storedToken model.Token
+			db.First(&storedToken, token.Id)
+			if storedToken.RemainQuota != wantTokenQuota {
+				t.Errorf("token remain quota = %d, want %d", storedToken.RemainQuota, wantTokenQuota)
+			}
+		})
+	}
+}
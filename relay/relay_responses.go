@@ -0,0 +1,286 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/dto"
+	"one-api/relay/channel"
+	relaycommon "one-api/relay/common"
+	relayconstant "one-api/relay/constant"
+	"one-api/relay/helper"
+	"one-api/service"
+	"one-api/setting"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+func getAndValidateResponsesRequest(c *gin.Context) (*dto.OpenAIResponsesRequest, error) {
+	request := &dto.OpenAIResponsesRequest{}
+	err := common.UnmarshalBodyReusable(c, request)
+	if err != nil {
+		return nil, err
+	}
+	if request.Model == "" {
+		return nil, errors.New("model is required")
+	}
+	if len(request.Input) == 0 {
+		return nil, errors.New("field input is required")
+	}
+	return request, nil
+}
+
+func ResponsesHelper(c *gin.Context) (openaiErr *dto.OpenAIErrorWithStatusCode) {
+	relayInfo := relaycommon.GenRelayInfo(c)
+
+	request, err := getAndValidateResponsesRequest(c)
+	if err != nil {
+		common.LogError(c, fmt.Sprintf("getAndValidateResponsesRequest failed: %s", err.Error()))
+		return service.OpenAIErrorWrapperLocal(err, "invalid_responses_request", http.StatusBadRequest)
+	}
+	relayInfo.IsStream = request.Stream
+
+	inputTexts := service.GetResponsesRequestTexts(request)
+	if setting.ShouldCheckPromptSensitive() {
+		words, err := service.CheckSensitiveInput(inputTexts)
+		if err != nil {
+			common.LogWarn(c, fmt.Sprintf("user sensitive words detected: %s", strings.Join(words, ", ")))
+			return service.OpenAIErrorWrapperLocal(err, "sensitive_words_detected", http.StatusBadRequest)
+		}
+	}
+
+	err = helper.ModelMappedHelper(c, relayInfo)
+	if err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "model_mapped_error", http.StatusInternalServerError)
+	}
+	request.Model = relayInfo.UpstreamModelName
+
+	var promptTokens int
+	if value, exists := c.Get("prompt_tokens"); exists {
+		promptTokens = value.(int)
+		relayInfo.PromptTokens = promptTokens
+	} else {
+		promptTokens, err = service.CountTokenInput(strings.Join(inputTexts, "\n")+string(request.Tools), request.Model)
+		if err != nil {
+			return service.OpenAIErrorWrapper(err, "count_token_messages_failed", http.StatusInternalServerError)
+		}
+		relayInfo.PromptTokens = promptTokens
+		c.Set("prompt_tokens", promptTokens)
+	}
+
+	priceData, err := helper.ModelPriceHelper(c, relayInfo, promptTokens, int(request.MaxOutputTokens))
+	if err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "model_price_error", http.StatusInternalServerError)
+	}
+
+	// pre-consume quota 预消耗配额
+	preConsumedQuota, userQuota, openaiErr := preConsumeQuota(c, priceData.ShouldPreConsumedQuota, relayInfo)
+	if openaiErr != nil {
+		return openaiErr
+	}
+	defer func() {
+		if openaiErr != nil {
+			returnPreConsumedQuota(c, relayInfo, userQuota, preConsumedQuota)
+		}
+	}()
+
+	adaptor := GetAdaptor(relayInfo.ApiType)
+	if adaptor == nil {
+		return service.OpenAIErrorWrapperLocal(fmt.Errorf("invalid api type: %d", relayInfo.ApiType), "invalid_api_type", http.StatusBadRequest)
+	}
+	adaptor.Init(relayInfo)
+
+	var convertedRequest any
+	responsesAdaptor, native := adaptor.(channel.ResponsesAdaptor)
+	if native && relayInfo.SupportResponses {
+		convertedRequest, err = responsesAdaptor.ConvertOpenAIResponsesRequest(c, relayInfo, *request)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "convert_request_failed", http.StatusInternalServerError)
+		}
+	} else {
+		// 上游不支持 Responses API，转换为 chat completions 请求
+		native = false
+		textRequest, err := service.ResponsesToOpenAIRequest(*request)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "convert_request_failed", http.StatusBadRequest)
+		}
+		relayInfo.RelayMode = relayconstant.RelayModeChatCompletions
+		relayInfo.RequestURLPath = "/v1/chat/completions"
+		if textRequest.Stream && relayInfo.SupportStreamOptions {
+			textRequest.StreamOptions = &dto.StreamOptions{
+				IncludeUsage: true,
+			}
+		}
+		convertedRequest, err = adaptor.ConvertOpenAIRequest(c, relayInfo, textRequest)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "convert_request_failed", http.StatusInternalServerError)
+		}
+	}
+	jsonData, err := json.Marshal(convertedRequest)
+	if err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "json_marshal_failed", http.StatusInternalServerError)
+	}
+
+	// apply param override
+	if len(relayInfo.ParamOverride) > 0 {
+		reqMap := make(map[string]interface{})
+		err = json.Unmarshal(jsonData, &reqMap)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "param_override_unmarshal_failed", http.StatusInternalServerError)
+		}
+		for key, value := range relayInfo.ParamOverride {
+			reqMap[key] = value
+		}
+		jsonData, err = json.Marshal(reqMap)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "param_override_marshal_failed", http.StatusInternalServerError)
+		}
+	}
+
+	if common.DebugEnabled {
+		println("requestBody: ", string(jsonData))
+	}
+
+	var httpResp *http.Response
+	resp, err := adaptor.DoRequest(c, relayInfo, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+
+	statusCodeMappingStr := c.GetString("status_code_mapping")
+	if resp != nil {
+		httpResp = resp.(*http.Response)
+		relayInfo.IsStream = relayInfo.IsStream || strings.HasPrefix(httpResp.Header.Get("Content-Type"), "text/event-stream")
+		if httpResp.StatusCode != http.StatusOK {
+			openaiErr = service.RelayErrorHandler(httpResp, false)
+			// reset status code 重置状态码
+			service.ResetStatusCode(openaiErr, statusCodeMappingStr)
+			return openaiErr
+		}
+	}
+
+	var usage any
+	if native {
+		usage, openaiErr = adaptor.DoResponse(c, httpResp, relayInfo)
+	} else {
+		writer := newResponsesConvertWriter(c.Writer, request)
+		c.Writer = writer
+		usage, openaiErr = adaptor.DoResponse(c, httpResp, relayInfo)
+		c.Writer = writer.ResponseWriter
+		if openaiErr == nil {
+			writer.finish(usage.(*dto.Usage))
+		}
+	}
+	if openaiErr != nil {
+		// reset status code 重置状态码
+		service.ResetStatusCode(openaiErr, statusCodeMappingStr)
+		return openaiErr
+	}
+
+	postConsumeQuota(c, relayInfo, usage.(*dto.Usage), preConsumedQuota, userQuota, priceData, "")
+	return nil
+}
+
+// responsesConvertWriter 拦截适配器写出的 chat completions 响应，并转换为 Responses API 格式
+type responsesConvertWriter struct {
+	gin.ResponseWriter
+	request    *dto.OpenAIResponsesRequest
+	converter  *service.ResponsesStreamConverter
+	buffer     bytes.Buffer
+	statusCode int
+}
+
+func newResponsesConvertWriter(writer gin.ResponseWriter, request *dto.OpenAIResponsesRequest) *responsesConvertWriter {
+	return &responsesConvertWriter{
+		ResponseWriter: writer,
+		request:        request,
+		converter:      service.NewResponsesStreamConverter(request),
+		statusCode:     http.StatusOK,
+	}
+}
+
+func (w *responsesConvertWriter) isStream() bool {
+	return strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream")
+}
+
+func (w *responsesConvertWriter) WriteHeader(code int) {
+	w.statusCode = code
+}
+
+func (w *responsesConvertWriter) WriteHeaderNow() {
+}
+
+func (w *responsesConvertWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *responsesConvertWriter) Write(data []byte) (int, error) {
+	w.buffer.Write(data)
+	if !w.isStream() {
+		return len(data), nil
+	}
+	for {
+		line, err := w.buffer.ReadString('\n')
+		if err != nil {
+			// 不完整的行放回缓冲区，等待后续数据
+			w.buffer.Reset()
+			w.buffer.WriteString(line)
+			break
+		}
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		payload := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if payload == "" || strings.HasPrefix(payload, "[DONE]") {
+			continue
+		}
+		var chunk dto.ChatCompletionsStreamResponse
+		if err := common.DecodeJsonStr(payload, &chunk); err != nil {
+			common.SysError("error unmarshalling stream response: " + err.Error())
+			continue
+		}
+		w.writeEvents(w.converter.Convert(&chunk))
+	}
+	return len(data), nil
+}
+
+func (w *responsesConvertWriter) Flush() {
+	if w.isStream() {
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *responsesConvertWriter) writeEvents(events []dto.ResponsesStreamResponse) {
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			common.SysError("error marshalling stream response: " + err.Error())
+			continue
+		}
+		_, _ = fmt.Fprintf(w.ResponseWriter, "event: %s\ndata: %s\n\n", event.Type, data)
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *responsesConvertWriter) finish(usage *dto.Usage) {
+	if w.isStream() {
+		w.writeEvents(w.converter.Finish(usage))
+		return
+	}
+	body := w.buffer.Bytes()
+	var textResponse dto.OpenAITextResponse
+	if err := common.DecodeJson(body, &textResponse); err == nil {
+		if data, err := json.Marshal(service.ResponseOpenAI2Responses(&textResponse, w.request, usage)); err == nil {
+			body = data
+		}
+	}
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Type", "application/json")
+	w.ResponseWriter.WriteHeader(w.statusCode)
+	_, _ = w.ResponseWriter.Write(body)
+}
@@ -12,8 +12,10 @@ import (
 	"one-api/constant"
 	"one-api/dto"
 	"one-api/model"
+	relaychannel "one-api/relay/channel"
 	relaycommon "one-api/relay/common"
 	relayconstant "one-api/relay/constant"
+	"one-api/relay/helper"
 	"one-api/service"
 	"one-api/setting"
 	"one-api/setting/operation_setting"
@@ -23,8 +25,11 @@ import (
 Task 任务通过平台、Action 区分任务
 */
 func RelayTaskSubmit(c *gin.Context, relayMode int) (taskErr *dto.TaskError) {
-	platform := constant.TaskPlatform(c.GetString("platform"))
 	relayInfo := relaycommon.GenTaskRelayInfo(c)
+	platform := constant.TaskPlatform(c.GetString("platform"))
+	if platform == "" {
+		platform = GetTaskPlatform(relayInfo.ChannelType)
+	}
 
 	adaptor := GetTaskAdaptor(platform)
 	if adaptor == nil {
@@ -37,7 +42,24 @@ func RelayTaskSubmit(c *gin.Context, relayMode int) (taskErr *dto.TaskError) {
 		return
 	}
 
-	modelName := service.CoverTaskActionToModelName(platform, relayInfo.Action)
+	var callbackRequest struct {
+		CallbackUrl string `json:"callback_url"`
+	}
+	_ = common.UnmarshalBodyReusable(c, &callbackRequest)
+	if err := service.ValidateCallbackUrl(callbackRequest.CallbackUrl); err != nil {
+		return service.TaskErrorWrapperLocal(err, "invalid_callback_url", http.StatusBadRequest)
+	}
+
+	err := helper.ModelMappedHelper(c, relayInfo.RelayInfo)
+	if err != nil {
+		return service.TaskErrorWrapperLocal(err, "model_mapped_error", http.StatusInternalServerError)
+	}
+
+	// Suno 按操作计价，其余平台按请求的模型计价
+	modelName := relayInfo.OriginModelName
+	if platform == constant.TaskPlatformSuno {
+		modelName = service.CoverTaskActionToModelName(platform, relayInfo.Action)
+	}
 	modelPrice, success := operation_setting.GetModelPrice(modelName, true)
 	if !success {
 		defaultPrice, ok := operation_setting.GetDefaultModelRatioMap()[modelName]
@@ -48,10 +70,16 @@ func RelayTaskSubmit(c *gin.Context, relayMode int) (taskErr *dto.TaskError) {
 		}
 	}
 
+	// 视频等按时长计价的平台，固定价格再乘以时长倍率
+	durationRatio := 1.0
+	if priceAdaptor, ok := adaptor.(relaychannel.TaskPriceAdaptor); ok {
+		durationRatio = priceAdaptor.GetPriceMultiplier(c, relayInfo)
+	}
+
 	// 预扣
 	groupRatio := setting.GetGroupRatio(relayInfo.Group)
-	ratio := modelPrice * groupRatio
-	userQuota, err := model.GetUserQuota(relayInfo.UserId, false)
+	ratio := modelPrice * groupRatio * durationRatio
+	userQuota, err := service.GetAvailableQuota(relayInfo.UserId, relayInfo.OrgId)
 	if err != nil {
 		taskErr = service.TaskErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
 		return
@@ -81,12 +109,15 @@ func RelayTaskSubmit(c *gin.Context, relayMode int) (taskErr *dto.TaskError) {
 			if channel.Status != common.ChannelStatusEnabled {
 				return service.TaskErrorWrapperLocal(errors.New("该任务所属渠道已被禁用"), "task_channel_disable", http.StatusBadRequest)
 			}
+			key := channel.GetKeyByIndex(originTask.KeyIndex)
 			c.Set("base_url", channel.GetBaseURL())
 			c.Set("channel_id", originTask.ChannelId)
-			c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.Key))
+			c.Set("channel_key_index", channel.GetKeyIndex(key))
+			c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", key))
 
 			relayInfo.BaseUrl = channel.GetBaseURL()
 			relayInfo.ChannelId = originTask.ChannelId
+			relayInfo.ApiKey = key
 		}
 	}
 
@@ -103,9 +134,9 @@ func RelayTaskSubmit(c *gin.Context, relayMode int) (taskErr *dto.TaskError) {
 		return
 	}
 	// handle response
-	if resp != nil && resp.StatusCode != http.StatusOK {
+	if resp != nil && (resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices) {
 		responseBody, _ := io.ReadAll(resp.Body)
-		taskErr = service.TaskErrorWrapper(fmt.Errorf(string(responseBody)), "fail_to_fetch_task", resp.StatusCode)
+		taskErr = service.TaskErrorWrapper(errors.New(string(responseBody)), "fail_to_fetch_task", resp.StatusCode)
 		return
 	}
 
@@ -123,6 +154,10 @@ func RelayTaskSubmit(c *gin.Context, relayMode int) (taskErr *dto.TaskError) {
 				other := make(map[string]interface{})
 				other["model_price"] = modelPrice
 				other["group_ratio"] = groupRatio
+				if durationRatio != 1 {
+					logContent = fmt.Sprintf("模型固定价格 %.2f，分组倍率 %.2f，时长倍率 %.2f，操作 %s", modelPrice, groupRatio, durationRatio, relayInfo.Action)
+					other["duration_ratio"] = durationRatio
+				}
 				model.RecordConsumeLog(c, relayInfo.UserId, relayInfo.ChannelId, 0, 0,
 					modelName, tokenName, quota, logContent, relayInfo.TokenId, userQuota, 0, false, relayInfo.Group, other)
 				model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, quota)
@@ -137,9 +172,12 @@ func RelayTaskSubmit(c *gin.Context, relayMode int) (taskErr *dto.TaskError) {
 	}
 	relayInfo.ConsumeQuota = true
 	// insert task
-	task := model.InitTask(constant.TaskPlatformSuno, relayInfo)
+	task := model.InitTask(platform, relayInfo)
 	task.TaskID = taskID
+	task.Action = relayInfo.Action
+	task.Properties.CallbackUrl = callbackRequest.CallbackUrl
 	task.Quota = quota
+	task.KeyIndex = c.GetInt("channel_key_index")
 	task.Data = taskData
 	err = task.Insert()
 	if err != nil {
@@ -150,8 +188,9 @@ func RelayTaskSubmit(c *gin.Context, relayMode int) (taskErr *dto.TaskError) {
 }
 
 var fetchRespBuilders = map[int]func(c *gin.Context) (respBody []byte, taskResp *dto.TaskError){
-	relayconstant.RelayModeSunoFetchByID: sunoFetchByIDRespBodyBuilder,
-	relayconstant.RelayModeSunoFetch:     sunoFetchRespBodyBuilder,
+	relayconstant.RelayModeSunoFetchByID:  sunoFetchByIDRespBodyBuilder,
+	relayconstant.RelayModeSunoFetch:      sunoFetchRespBodyBuilder,
+	relayconstant.RelayModeVideoFetchByID: videoFetchByIDRespBodyBuilder,
 }
 
 func RelayTaskFetch(c *gin.Context, relayMode int) (taskResp *dto.TaskError) {
@@ -226,6 +265,44 @@ func sunoFetchByIDRespBodyBuilder(c *gin.Context) (respBody []byte, taskResp *dt
 	return
 }
 
+func videoFetchByIDRespBodyBuilder(c *gin.Context) (respBody []byte, taskResp *dto.TaskError) {
+	taskId := c.Param("task_id")
+	userId := c.GetInt("id")
+
+	originTask, exist, err := model.GetByTaskId(userId, taskId)
+	if err != nil {
+		taskResp = service.TaskErrorWrapper(err, "get_task_failed", http.StatusInternalServerError)
+		return
+	}
+	if !exist {
+		taskResp = service.TaskErrorWrapperLocal(errors.New("task_not_exist"), "task_not_exist", http.StatusNotFound)
+		return
+	}
+
+	respBody, err = json.Marshal(TaskModel2VideoDto(originTask))
+	return
+}
+
+func TaskModel2VideoDto(task *model.Task) *dto.VideoTaskResponse {
+	response := &dto.VideoTaskResponse{
+		TaskID:     task.TaskID,
+		Object:     "video.generation",
+		Action:     task.Action,
+		Status:     string(task.Status),
+		Progress:   task.Progress,
+		FailReason: task.FailReason,
+		SubmitTime: task.SubmitTime,
+		FinishTime: task.FinishTime,
+	}
+	if task.Status == model.TaskStatusSuccess {
+		var data dto.VideoTaskData
+		if err := task.GetData(&data); err == nil {
+			response.Url = data.Url
+		}
+	}
+	return response
+}
+
 func TaskModel2Dto(task *model.Task) *dto.TaskDto {
 	return &dto.TaskDto{
 		TaskID:     task.TaskID,
@@ -1,8 +1,10 @@
 package router
 
 import (
+	"one-api/common"
 	"one-api/controller"
 	"one-api/middleware"
+	"one-api/model"
 
 	"github.com/gin-contrib/gzip"
 	"github.com/gin-gonic/gin"
@@ -40,6 +42,7 @@ func SetApiRouter(router *gin.Engine) {
 		{
 			userRoute.POST("/register", middleware.CriticalRateLimit(), middleware.TurnstileCheck(), controller.Register)
 			userRoute.POST("/login", middleware.CriticalRateLimit(), middleware.TurnstileCheck(), controller.Login)
+			userRoute.POST("/login/2fa", middleware.CriticalRateLimit(), controller.LoginTwoFactor)
 			//userRoute.POST("/tokenlog", middleware.CriticalRateLimit(), controller.TokenLog)
 			userRoute.GET("/logout", controller.Logout)
 			userRoute.GET("/epay/notify", controller.EpayNotify)
@@ -53,17 +56,29 @@ func SetApiRouter(router *gin.Engine) {
 				selfRoute.GET("/models", controller.GetUserModels)
 				selfRoute.PUT("/self", controller.UpdateSelf)
 				selfRoute.DELETE("/self", controller.DeleteSelf)
-				selfRoute.GET("/token", controller.GenerateAccessToken)
+				selfRoute.GET("/token", middleware.RequireRecentTwoFactor(), controller.GenerateAccessToken)
 				selfRoute.GET("/aff", controller.GetAffCode)
 				selfRoute.POST("/topup", controller.TopUp)
-				selfRoute.POST("/pay", controller.RequestEpay)
+				selfRoute.POST("/pay", controller.RequestPayment)
 				selfRoute.POST("/amount", controller.RequestAmount)
+				selfRoute.GET("/topups", controller.GetSelfTopUps)
+				selfRoute.GET("/topups/:id/receipt", controller.DownloadSelfTopUpReceipt)
+				selfRoute.GET("/statements", controller.GetSelfBillingStatements)
+				selfRoute.GET("/statements/:id", controller.GetSelfBillingStatement)
+				selfRoute.GET("/statements/:id/download", controller.DownloadSelfBillingStatement)
+				selfRoute.GET("/credit", controller.GetSelfCreditAccount)
 				selfRoute.POST("/aff_transfer", controller.TransferAffQuota)
 				selfRoute.PUT("/setting", controller.UpdateUserSetting)
+				selfRoute.GET("/2fa", controller.GetTwoFactorStatus)
+				selfRoute.POST("/2fa/setup", controller.SetupTwoFactor)
+				selfRoute.POST("/2fa/enable", middleware.CriticalRateLimit(), controller.EnableTwoFactor)
+				selfRoute.POST("/2fa/disable", middleware.CriticalRateLimit(), controller.DisableTwoFactor)
+				selfRoute.POST("/2fa/recovery_codes", middleware.CriticalRateLimit(), controller.RegenerateTwoFactorRecoveryCodes)
+				selfRoute.POST("/2fa/verify", middleware.CriticalRateLimit(), controller.VerifyTwoFactor)
 			}
 
 			adminRoute := userRoute.Group("/")
-			adminRoute.Use(middleware.AdminAuth())
+			adminRoute.Use(middleware.ScopedAuth(common.RoleAdminUser, "user"), middleware.Audit("user"))
 			{
 				adminRoute.GET("/", controller.GetAllUsers)
 				adminRoute.GET("/search", controller.SearchUsers)
@@ -75,36 +90,69 @@ func SetApiRouter(router *gin.Engine) {
 			}
 		}
 		optionRoute := apiRouter.Group("/option")
-		optionRoute.Use(middleware.RootAuth())
+		optionRoute.Use(middleware.ScopedAuth(common.RoleRootUser, "option"), middleware.Audit("option"))
 		{
 			optionRoute.GET("/", controller.GetOptions)
-			optionRoute.PUT("/", controller.UpdateOption)
-			optionRoute.POST("/rest_model_ratio", controller.ResetModelRatio)
+			optionRoute.PUT("/", middleware.RequireRecentTwoFactor(), controller.UpdateOption)
+			optionRoute.POST("/rest_model_ratio", middleware.RequireRecentTwoFactor(), controller.ResetModelRatio)
+		}
+		apiRouter.GET("/payment/:provider/webhook", controller.PaymentWebhook)
+		apiRouter.POST("/payment/:provider/webhook", controller.PaymentWebhook)
+		topUpRoute := apiRouter.Group("/topup")
+		topUpRoute.Use(middleware.RootAuth())
+		{
+			topUpRoute.GET("/:id/events", controller.GetTopUpEvents)
+			topUpRoute.POST("/:id/refund", middleware.Audit("topup"), middleware.RequireRecentTwoFactor(), controller.RefundTopUp)
+		}
+		statementRoute := apiRouter.Group("/statement")
+		statementRoute.Use(middleware.AdminAuth())
+		{
+			statementRoute.GET("/", controller.GetAllBillingStatements)
+			statementRoute.GET("/:id/download", controller.DownloadBillingStatement)
+			statementRoute.POST("/generate", middleware.AuditOperation("statement", "generate"), controller.GenerateBillingStatements)
+			statementRoute.POST("/:id/pay", middleware.Audit("statement"), controller.PayBillingStatement)
+		}
+		creditRoute := apiRouter.Group("/credit")
+		creditRoute.Use(middleware.AdminAuth())
+		{
+			creditRoute.GET("/", controller.GetCreditAccounts)
+			creditRoute.GET("/:user_id", controller.GetCreditAccount)
+			creditRoute.PUT("/:user_id", middleware.Audit("credit_account"), middleware.RequireRecentTwoFactor(), controller.UpdateCreditAccount)
+			creditRoute.POST("/:user_id/suspend", middleware.Audit("credit_account"), controller.SuspendCreditAccount)
+			creditRoute.POST("/:user_id/resume", middleware.Audit("credit_account"), controller.ResumeCreditAccount)
+		}
+		configRoute := apiRouter.Group("/config")
+		configRoute.Use(middleware.RootAuth(), middleware.RequireRecentTwoFactor())
+		{
+			configRoute.GET("/export", controller.ExportConfig)
+			configRoute.POST("/import", middleware.Audit("config"), controller.ImportConfig)
 		}
 		channelRoute := apiRouter.Group("/channel")
-		channelRoute.Use(middleware.AdminAuth())
 		{
-			channelRoute.GET("/", controller.GetAllChannels)
-			channelRoute.GET("/search", controller.SearchChannels)
-			channelRoute.GET("/models", controller.ChannelListModels)
-			channelRoute.GET("/models_enabled", controller.EnabledListModels)
-			channelRoute.GET("/:id", controller.GetChannel)
-			channelRoute.GET("/test", controller.TestAllChannels)
-			channelRoute.GET("/test/:id", controller.TestChannel)
-			channelRoute.GET("/update_balance", controller.UpdateAllChannelsBalance)
-			channelRoute.GET("/update_balance/:id", controller.UpdateChannelBalance)
-			channelRoute.POST("/", controller.AddChannel)
-			channelRoute.PUT("/", controller.UpdateChannel)
-			channelRoute.DELETE("/disabled", controller.DeleteDisabledChannel)
-			channelRoute.POST("/tag/disabled", controller.DisableTagChannels)
-			channelRoute.POST("/tag/enabled", controller.EnableTagChannels)
-			channelRoute.PUT("/tag", controller.EditTagChannels)
-			channelRoute.DELETE("/:id", controller.DeleteChannel)
-			channelRoute.POST("/batch", controller.DeleteChannelBatch)
-			channelRoute.POST("/fix", controller.FixChannelsAbilities)
-			channelRoute.GET("/fetch_models/:id", controller.FetchUpstreamModels)
-			channelRoute.POST("/fetch_models", controller.FetchModels)
-			channelRoute.POST("/batch/tag", controller.BatchSetChannelTag)
+			channelRoute.GET("/", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeChannelRead), controller.GetAllChannels)
+			channelRoute.GET("/search", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeChannelRead), controller.SearchChannels)
+			channelRoute.GET("/models", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeChannelRead), controller.ChannelListModels)
+			channelRoute.GET("/models_enabled", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeChannelRead), controller.EnabledListModels)
+			channelRoute.GET("/:id", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeChannelRead), controller.GetChannel)
+			channelRoute.GET("/:id/keys", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeChannelWrite), controller.GetChannelKeys)
+			channelRoute.PUT("/:id/keys", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeChannelWrite), middleware.Audit("channel"), controller.UpdateChannelKeyStatus)
+			channelRoute.DELETE("/:id/health", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeChannelWrite), middleware.Audit("channel"), controller.ResetChannelHealth)
+			channelRoute.GET("/test", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeChannelWrite), middleware.AuditOperation("channel", "test"), controller.TestAllChannels)
+			channelRoute.GET("/test/:id", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeChannelWrite), middleware.AuditOperation("channel", "test"), controller.TestChannel)
+			channelRoute.GET("/update_balance", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeChannelWrite), middleware.AuditOperation("channel", "update_balance"), controller.UpdateAllChannelsBalance)
+			channelRoute.GET("/update_balance/:id", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeChannelWrite), middleware.AuditOperation("channel", "update_balance"), controller.UpdateChannelBalance)
+			channelRoute.POST("/", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeChannelWrite), middleware.Audit("channel"), controller.AddChannel)
+			channelRoute.PUT("/", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeChannelWrite), middleware.Audit("channel"), controller.UpdateChannel)
+			channelRoute.DELETE("/disabled", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeChannelWrite), middleware.Audit("channel"), middleware.RequireRecentTwoFactor(), controller.DeleteDisabledChannel)
+			channelRoute.POST("/tag/disabled", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeChannelWrite), middleware.Audit("channel"), controller.DisableTagChannels)
+			channelRoute.POST("/tag/enabled", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeChannelWrite), middleware.Audit("channel"), controller.EnableTagChannels)
+			channelRoute.PUT("/tag", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeChannelWrite), middleware.Audit("channel"), controller.EditTagChannels)
+			channelRoute.DELETE("/:id", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeChannelWrite), middleware.Audit("channel"), middleware.RequireRecentTwoFactor(), controller.DeleteChannel)
+			channelRoute.POST("/batch", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeChannelWrite), middleware.Audit("channel"), middleware.RequireRecentTwoFactor(), controller.DeleteChannelBatch)
+			channelRoute.POST("/fix", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeChannelWrite), middleware.Audit("channel"), controller.FixChannelsAbilities)
+			channelRoute.GET("/fetch_models/:id", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeChannelWrite), middleware.AuditOperation("channel", "fetch_models"), controller.FetchUpstreamModels)
+			channelRoute.POST("/fetch_models", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeChannelWrite), middleware.AuditOperation("channel", "fetch_models"), controller.FetchModels)
+			channelRoute.POST("/batch/tag", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeChannelWrite), middleware.Audit("channel"), controller.BatchSetChannelTag)
 		}
 		tokenRoute := apiRouter.Group("/token")
 		tokenRoute.Use(middleware.UserAuth())
@@ -117,26 +165,61 @@ func SetApiRouter(router *gin.Engine) {
 			tokenRoute.DELETE("/:id", controller.DeleteToken)
 		}
 		redemptionRoute := apiRouter.Group("/redemption")
-		redemptionRoute.Use(middleware.AdminAuth())
 		{
-			redemptionRoute.GET("/", controller.GetAllRedemptions)
-			redemptionRoute.GET("/search", controller.SearchRedemptions)
-			redemptionRoute.GET("/:id", controller.GetRedemption)
-			redemptionRoute.POST("/", controller.AddRedemption)
-			redemptionRoute.PUT("/", controller.UpdateRedemption)
-			redemptionRoute.DELETE("/:id", controller.DeleteRedemption)
+			redemptionRoute.GET("/", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeRedemptionRead), controller.GetAllRedemptions)
+			redemptionRoute.GET("/search", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeRedemptionRead), controller.SearchRedemptions)
+			redemptionRoute.GET("/:id", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeRedemptionRead), controller.GetRedemption)
+			redemptionRoute.GET("/campaign", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeRedemptionRead), controller.GetRedemptionCampaigns)
+			redemptionRoute.GET("/campaign/:id", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeRedemptionRead), controller.GetRedemptionCampaign)
+			redemptionRoute.GET("/campaign/:id/codes", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeRedemptionRead), controller.GetRedemptionCampaignCodes)
+			redemptionRoute.GET("/campaign/:id/records", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeRedemptionRead), controller.GetRedemptionCampaignRecords)
+			redemptionRoute.GET("/campaign/:id/export", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeRedemptionRead), controller.ExportRedemptionCampaignCodes)
+			redemptionRoute.POST("/campaign", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeRedemptionCreate), middleware.Audit("redemption_campaign"), controller.AddRedemptionCampaign)
+			redemptionRoute.POST("/campaign/:id/codes", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeRedemptionCreate), middleware.Audit("redemption_campaign"), controller.AddRedemptionCampaignCodes)
+			redemptionRoute.PUT("/campaign", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeRedemptionWrite), middleware.Audit("redemption_campaign"), controller.UpdateRedemptionCampaign)
+			redemptionRoute.POST("/", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeRedemptionCreate), middleware.Audit("redemption"), controller.AddRedemption)
+			redemptionRoute.PUT("/", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeRedemptionWrite), middleware.Audit("redemption"), controller.UpdateRedemption)
+			redemptionRoute.DELETE("/:id", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeRedemptionWrite), middleware.Audit("redemption"), controller.DeleteRedemption)
+		}
+		adminApiKeyRoute := apiRouter.Group("/admin_key")
+		adminApiKeyRoute.Use(middleware.AdminAuth(), middleware.Audit("admin_api_key"))
+		{
+			adminApiKeyRoute.GET("/", controller.GetAdminApiKeys)
+			adminApiKeyRoute.GET("/scopes", controller.GetAdminApiKeyScopes)
+			adminApiKeyRoute.GET("/:id/log", controller.GetAdminApiKeyLogs)
+			adminApiKeyRoute.POST("/", middleware.RequireRecentTwoFactor(), controller.AddAdminApiKey)
+			adminApiKeyRoute.PUT("/", controller.UpdateAdminApiKey)
+			adminApiKeyRoute.DELETE("/:id", controller.DeleteAdminApiKey)
+		}
+		organizationRoute := apiRouter.Group("/organization")
+		{
+			organizationRoute.GET("/self", middleware.UserAuth(), controller.GetUserOrganizations)
+			organizationRoute.GET("/", middleware.AdminAuth(), controller.GetAllOrganizations)
+			organizationRoute.POST("/", middleware.AdminAuth(), middleware.Audit("organization"), controller.AddOrganization)
+			organizationRoute.PUT("/", middleware.AdminAuth(), middleware.Audit("organization"), controller.UpdateOrganization)
+			organizationRoute.DELETE("/:id", middleware.AdminAuth(), middleware.Audit("organization"), controller.DeleteOrganization)
+			organizationRoute.GET("/:id", middleware.OrgAuth(common.OrgRoleMember), controller.GetOrganization)
+			organizationRoute.GET("/:id/members", middleware.OrgAuth(common.OrgRoleMember), controller.GetOrganizationMembers)
+			organizationRoute.POST("/:id/members", middleware.OrgAuth(common.OrgRoleAdmin), middleware.Audit("organization_member"), controller.AddOrganizationMember)
+			organizationRoute.PUT("/:id/members", middleware.OrgAuth(common.OrgRoleAdmin), middleware.Audit("organization_member"), controller.UpdateOrganizationMember)
+			organizationRoute.DELETE("/:id/members/:user_id", middleware.OrgAuth(common.OrgRoleAdmin), middleware.Audit("organization_member"), controller.RemoveOrganizationMember)
+			organizationRoute.GET("/:id/log", middleware.OrgAuth(common.OrgRoleAdmin), controller.GetOrganizationLogs)
+			organizationRoute.GET("/:id/data", middleware.OrgAuth(common.OrgRoleAdmin), controller.GetOrganizationQuotaDates)
 		}
 		logRoute := apiRouter.Group("/log")
-		logRoute.GET("/", middleware.AdminAuth(), controller.GetAllLogs)
-		logRoute.DELETE("/", middleware.AdminAuth(), controller.DeleteHistoryLogs)
-		logRoute.GET("/stat", middleware.AdminAuth(), controller.GetLogsStat)
+		logRoute.GET("/", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeLogRead), controller.GetAllLogs)
+		logRoute.DELETE("/", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeLogWrite), middleware.Audit("log"), controller.DeleteHistoryLogs)
+		logRoute.GET("/stat", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeLogRead), controller.GetLogsStat)
 		logRoute.GET("/self/stat", middleware.UserAuth(), controller.GetLogsSelfStat)
-		logRoute.GET("/search", middleware.AdminAuth(), controller.SearchAllLogs)
+		logRoute.GET("/search", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeLogRead), controller.SearchAllLogs)
 		logRoute.GET("/self", middleware.UserAuth(), controller.GetUserLogs)
 		logRoute.GET("/self/search", middleware.UserAuth(), controller.SearchUserLogs)
+		logRoute.GET("/moderation", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeLogRead), controller.GetModerationLogs)
+
+		apiRouter.GET("/audit", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeAuditRead), controller.GetAuditLogs)
 
 		dataRoute := apiRouter.Group("/data")
-		dataRoute.GET("/", middleware.AdminAuth(), controller.GetAllQuotaDates)
+		dataRoute.GET("/", middleware.ScopedAuth(common.RoleAdminUser, model.AdminScopeLogRead), controller.GetAllQuotaDates)
 		dataRoute.GET("/self", middleware.UserAuth(), controller.GetUserQuotaDates)
 
 		logRoute.Use(middleware.CORS())
@@ -156,6 +239,7 @@ func SetApiRouter(router *gin.Engine) {
 		taskRoute := apiRouter.Group("/task")
 		{
 			taskRoute.GET("/self", middleware.UserAuth(), controller.GetUserTask)
+			taskRoute.GET("/self/callbacks", middleware.UserAuth(), controller.GetUserTaskCallbacks)
 			taskRoute.GET("/", middleware.AdminAuth(), controller.GetAllTask)
 		}
 	}
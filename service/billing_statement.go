@@ -0,0 +1,332 @@
+package service
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"one-api/common"
+	"one-api/model"
+	"one-api/setting/operation_setting"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// formatStatementQuota 按额度展示方式格式化金额，开启货币展示时换算为美元
+func formatStatementQuota(quota int64, precision int) string {
+	if common.DisplayInCurrencyEnabled {
+		if quota < 0 {
+			return fmt.Sprintf("-$%.*f", precision, float64(-quota)/common.QuotaPerUnit)
+		}
+		return fmt.Sprintf("$%.*f", precision, float64(quota)/common.QuotaPerUnit)
+	}
+	return strconv.FormatInt(quota, 10)
+}
+
+func formatStatementTime(timestamp int64) string {
+	return time.Unix(timestamp, 0).Format("2006-01-02 15:04")
+}
+
+func formatStatementDate(timestamp int64) string {
+	return time.Unix(timestamp, 0).Format("2006-01-02")
+}
+
+func billingStatementSummary(statement *model.BillingStatement) [][2]string {
+	return [][2]string{
+		{"Opening balance", formatStatementQuota(statement.OpeningBalance, 2)},
+		{"Top-ups", formatStatementQuota(statement.TopUpQuota, 2)},
+		{"Redemptions", formatStatementQuota(statement.RedemptionQuota, 2)},
+		{"Refunds", formatStatementQuota(-statement.RefundQuota, 2)},
+		{"Usage", formatStatementQuota(-statement.ConsumedQuota, 2)},
+		{"Other adjustments", formatStatementQuota(statement.AdjustmentQuota, 2)},
+		{"Closing balance", formatStatementQuota(statement.ClosingBalance, 2)},
+	}
+}
+
+// billingStatementPayment 后付费账单的付款信息，没有应付金额时返回 nil
+func billingStatementPayment(statement *model.BillingStatement) [][2]string {
+	if statement.PaymentStatus == "" {
+		return nil
+	}
+	status := "Unpaid"
+	if statement.PaymentStatus == model.BillingStatementPaymentPaid {
+		status = "Paid " + formatStatementDate(statement.PaidTime)
+	}
+	return [][2]string{
+		{"Amount due", formatStatementQuota(statement.AmountDue, 2)},
+		{"Due date", formatStatementDate(statement.DueTime)},
+		{"Payment status", status},
+	}
+}
+
+// csvText 转义用户可控的文本，以 = + - @ 等开头的单元格会被表格软件当作公式执行，前面加 ' 使其按文本显示
+func csvText(text string) string {
+	if text != "" && strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
+
+// RenderBillingStatementCSV 导出账单为 CSV，带 BOM 以便表格软件正确识别 UTF-8
+func RenderBillingStatementCSV(statement *model.BillingStatement) ([]byte, error) {
+	setting := operation_setting.GetBillingStatementSetting()
+	detail := statement.GetDetail()
+	var buf bytes.Buffer
+	buf.WriteString("\xEF\xBB\xBF")
+	w := csv.NewWriter(&buf)
+	rows := [][]string{
+		{"Invoice No", csvText(statement.InvoiceNo)},
+		{"Period", statement.Period},
+		{"Period start", formatStatementDate(statement.StartTime)},
+		{"Period end", formatStatementDate(statement.EndTime - 1)},
+		{"Issued", formatStatementDate(statement.CreatedTime)},
+		{"Company", csvText(setting.CompanyName)},
+		{"Company address", csvText(setting.CompanyAddress)},
+		{"Company tax ID", csvText(setting.CompanyTaxId)},
+		{"Company email", csvText(setting.CompanyEmail)},
+		{"Customer", csvText(detail.Username)},
+		{"Customer ID", strconv.Itoa(statement.UserId)},
+		{"Customer email", csvText(detail.Email)},
+		{},
+		{"Summary", "Amount"},
+	}
+	for _, item := range billingStatementSummary(statement) {
+		rows = append(rows, []string{item[0], item[1]})
+	}
+	for _, item := range billingStatementPayment(statement) {
+		rows = append(rows, []string{item[0], item[1]})
+	}
+	rows = append(rows, []string{}, []string{"Usage", "Model", "Token", "Requests", "Prompt tokens", "Completion tokens", "Quota", "Amount"})
+	for _, usage := range detail.Usage {
+		rows = append(rows, []string{"", csvText(usage.ModelName), csvText(usage.TokenName), strconv.FormatInt(usage.Requests, 10),
+			strconv.FormatInt(usage.PromptTokens, 10), strconv.FormatInt(usage.CompletionTokens, 10),
+			strconv.FormatInt(usage.Quota, 10), formatStatementQuota(usage.Quota, 6)})
+	}
+	rows = append(rows, []string{}, []string{"Top-ups", "Time", "Trade No", "Provider", "Paid", "Currency", "Quota", "Status"})
+	for _, topUp := range detail.TopUps {
+		rows = append(rows, []string{"", formatStatementTime(topUp.Time), csvText(topUp.TradeNo), csvText(topUp.Provider),
+			strconv.FormatFloat(topUp.Money, 'f', 2, 64), csvText(topUp.Currency), strconv.FormatInt(topUp.Quota, 10), csvText(topUp.Status)})
+	}
+	rows = append(rows, []string{}, []string{"Redemptions", "Time", "Name", "Quota"})
+	for _, redemption := range detail.Redemptions {
+		rows = append(rows, []string{"", formatStatementTime(redemption.Time), csvText(redemption.Name), strconv.FormatInt(redemption.Quota, 10)})
+	}
+	if setting.Footer != "" {
+		rows = append(rows, []string{}, []string{csvText(setting.Footer)})
+	}
+	if err := w.WriteAll(rows); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// pdfWriter 按行向下排版，超出页面时自动换页
+type pdfWriter struct {
+	doc *common.PDFDocument
+	y   float64
+}
+
+const (
+	pdfMarginLeft   = 50.0
+	pdfMarginRight  = common.PDFPageWidth - 50.0
+	pdfMarginBottom = common.PDFPageHeight - 60.0
+)
+
+func newPDFWriter() *pdfWriter {
+	w := &pdfWriter{doc: common.NewPDFDocument()}
+	w.doc.AddPage()
+	w.y = 60
+	return w
+}
+
+func (w *pdfWriter) ensure(height float64) {
+	if w.y+height > pdfMarginBottom {
+		w.doc.AddPage()
+		w.y = 60
+	}
+}
+
+func (w *pdfWriter) line(size float64, bold bool, text string) {
+	w.ensure(size + 4)
+	w.y += size + 4
+	w.doc.Text(pdfMarginLeft, w.y, size, bold, text)
+}
+
+func (w *pdfWriter) gap(height float64) {
+	w.y += height
+}
+
+func (w *pdfWriter) rule() {
+	w.gap(6)
+	w.doc.Line(pdfMarginLeft, w.y, pdfMarginRight, w.y)
+}
+
+// table 输出表格，columns 为各列的左边界，数值列 rightAligned 时以下一列左边界右对齐
+func (w *pdfWriter) table(columns []float64, rightAligned []bool, header []string, rows [][]string) {
+	write := func(cells []string, bold bool) {
+		w.ensure(14)
+		w.y += 14
+		for i, cell := range cells {
+			right := pdfMarginRight
+			if i+1 < len(columns) {
+				right = columns[i+1] - 6
+			}
+			if rightAligned[i] {
+				w.doc.TextRight(right, w.y, 9, bold, cell)
+				continue
+			}
+			// 截断超出列宽的文本
+			w.doc.Text(columns[i], w.y, 9, bold, common.PDFTruncate(cell, 9, right-columns[i]))
+		}
+	}
+	write(header, true)
+	w.doc.Line(pdfMarginLeft, w.y+4, pdfMarginRight, w.y+4)
+	w.gap(4)
+	for _, row := range rows {
+		write(row, false)
+	}
+	if len(rows) == 0 {
+		w.line(9, false, "None")
+	}
+}
+
+func (w *pdfWriter) header(title string, fields [][2]string) {
+	setting := operation_setting.GetBillingStatementSetting()
+	companyName := setting.CompanyName
+	if companyName == "" {
+		companyName = common.SystemName
+	}
+	top := w.y
+	w.line(16, true, companyName)
+	for _, text := range []string{setting.CompanyAddress, setting.CompanyEmail} {
+		if text != "" {
+			w.line(9, false, text)
+		}
+	}
+	if setting.CompanyTaxId != "" {
+		w.line(9, false, "Tax ID: "+setting.CompanyTaxId)
+	}
+	companyBottom := w.y
+	y := top + 20
+	w.doc.TextRight(pdfMarginRight, y, 16, true, title)
+	for _, field := range fields {
+		y += 13
+		w.doc.TextRight(pdfMarginRight, y, 9, false, field[0]+": "+field[1])
+	}
+	w.y = max(companyBottom, y)
+	w.rule()
+}
+
+func (w *pdfWriter) footer() {
+	if footer := operation_setting.GetBillingStatementSetting().Footer; footer != "" {
+		w.gap(10)
+		w.line(8, false, footer)
+	}
+}
+
+// RenderBillingStatementPDF 导出账单为 PDF，中文等字符使用阅读器提供的字体显示，不嵌入字体文件
+func RenderBillingStatementPDF(statement *model.BillingStatement) []byte {
+	detail := statement.GetDetail()
+	w := newPDFWriter()
+	w.header("STATEMENT", [][2]string{
+		{"Invoice No", statement.InvoiceNo},
+		{"Period", formatStatementDate(statement.StartTime) + " - " + formatStatementDate(statement.EndTime-1)},
+		{"Issued", formatStatementDate(statement.CreatedTime)},
+	})
+
+	w.gap(8)
+	w.line(10, true, "Bill to")
+	customer := detail.Username
+	if detail.DisplayName != "" && detail.DisplayName != detail.Username {
+		customer += " (" + detail.DisplayName + ")"
+	}
+	w.line(9, false, fmt.Sprintf("%s, user ID %d", customer, statement.UserId))
+	if detail.Email != "" {
+		w.line(9, false, detail.Email)
+	}
+
+	w.gap(12)
+	w.line(11, true, "Summary")
+	for i, item := range billingStatementSummary(statement) {
+		bold := i == 0 || i == 6
+		w.ensure(14)
+		w.y += 14
+		w.doc.Text(pdfMarginLeft, w.y, 9, bold, item[0])
+		w.doc.TextRight(300, w.y, 9, bold, item[1])
+	}
+	if payment := billingStatementPayment(statement); payment != nil {
+		w.gap(12)
+		w.line(11, true, "Payment")
+		for i, item := range payment {
+			w.ensure(14)
+			w.y += 14
+			w.doc.Text(pdfMarginLeft, w.y, 9, i == 0, item[0])
+			w.doc.TextRight(300, w.y, 9, i == 0, item[1])
+		}
+	}
+
+	usageRows := make([][]string, 0, len(detail.Usage))
+	for _, usage := range detail.Usage {
+		usageRows = append(usageRows, []string{usage.ModelName, usage.TokenName, strconv.FormatInt(usage.Requests, 10),
+			strconv.FormatInt(usage.PromptTokens, 10), strconv.FormatInt(usage.CompletionTokens, 10), formatStatementQuota(usage.Quota, 4)})
+	}
+	w.gap(12)
+	w.line(11, true, "Usage by model and token")
+	w.table([]float64{50, 205, 320, 375, 440, 505}, []bool{false, false, true, true, true, true},
+		[]string{"Model", "Token", "Requests", "Prompt", "Completion", "Amount"}, usageRows)
+
+	topUpRows := make([][]string, 0, len(detail.TopUps))
+	for _, topUp := range detail.TopUps {
+		topUpRows = append(topUpRows, []string{formatStatementTime(topUp.Time), csvText(topUp.TradeNo), csvText(topUp.Provider),
+			fmt.Sprintf("%.2f %s", topUp.Money, topUp.Currency), formatStatementQuota(topUp.Quota, 2), topUp.Status})
+	}
+	w.gap(12)
+	w.line(11, true, "Top-ups")
+	w.table([]float64{50, 135, 285, 335, 420, 495}, []bool{false, false, false, true, true, false},
+		[]string{"Time", "Trade No", "Provider", "Paid", "Amount", "Status"}, topUpRows)
+
+	redemptionRows := make([][]string, 0, len(detail.Redemptions))
+	for _, redemption := range detail.Redemptions {
+		redemptionRows = append(redemptionRows, []string{formatStatementTime(redemption.Time), redemption.Name, formatStatementQuota(redemption.Quota, 2)})
+	}
+	w.gap(12)
+	w.line(11, true, "Redemptions")
+	w.table([]float64{50, 135, 420}, []bool{false, false, true},
+		[]string{"Time", "Name", "Amount"}, redemptionRows)
+
+	w.footer()
+	return w.doc.Bytes()
+}
+
+// RenderTopUpReceiptPDF 生成在线充值收据
+func RenderTopUpReceiptPDF(topUp *model.TopUp, user *model.User) []byte {
+	completeTime := topUp.CompleteTime
+	if completeTime == 0 {
+		completeTime = topUp.CreateTime
+	}
+	currency := topUp.Currency
+	if currency == "" {
+		currency = "CNY"
+	}
+	w := newPDFWriter()
+	w.header("RECEIPT", [][2]string{
+		{"Receipt No", topUp.TradeNo},
+		{"Date", formatStatementDate(completeTime)},
+	})
+	w.gap(8)
+	w.line(10, true, "Received from")
+	w.line(9, false, fmt.Sprintf("%s, user ID %d", user.Username, user.Id))
+	if user.Email != "" {
+		w.line(9, false, user.Email)
+	}
+	w.gap(12)
+	w.table([]float64{50, 300, 420}, []bool{false, true, true},
+		[]string{"Description", "Quota", "Amount paid"},
+		[][]string{{"Account top-up via " + topUp.Provider, formatStatementQuota(int64(topUp.Quota()), 2), fmt.Sprintf("%.2f %s", topUp.Money, currency)}})
+	if topUp.Status == model.TopUpStatusRefunded {
+		w.gap(8)
+		w.line(10, true, "This payment has been refunded.")
+	}
+	w.footer()
+	return w.doc.Bytes()
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"one-api/common"
+	"one-api/model"
+	"testing"
+)
+
+func TestRenderBillingStatementCSVEscapesFormulas(t *testing.T) {
+	oldDisplay := common.DisplayInCurrencyEnabled
+	common.DisplayInCurrencyEnabled = false
+	t.Cleanup(func() { common.DisplayInCurrencyEnabled = oldDisplay })
+	detail, _ := json.Marshal(&model.BillingStatementDetail{
+		Username: "=HYPERLINK(\"http://evil\")",
+		Email:    "user@example.com",
+		Usage: []model.BillingStatementUsage{
+			{ModelName: "+gpt", TokenName: "@token", Requests: 1, Quota: 100},
+			{ModelName: "gpt-4o", TokenName: "-1+1", Requests: 1, Quota: 100},
+		},
+		Redemptions: []model.BillingStatementRedemption{{Name: "\tcmd", Quota: 10}},
+	})
+	statement := &model.BillingStatement{
+		InvoiceNo:     "INV202601-0001",
+		Period:        "2026-01",
+		ConsumedQuota: 200,
+		Detail:        string(detail),
+	}
+	data, err := RenderBillingStatementCSV(statement)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xEF\xBB\xBF"))))
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cells := make(map[string]bool)
+	for _, row := range rows {
+		for _, cell := range row {
+			cells[cell] = true
+		}
+	}
+	tests := []struct {
+		cell string
+		want bool
+	}{
+		{"'=HYPERLINK(\"http://evil\")", true},
+		{"=HYPERLINK(\"http://evil\")", false},
+		{"'+gpt", true},
+		{"'@token", true},
+		{"'-1+1", true},
+		{"'\tcmd", true},
+		{"gpt-4o", true},
+		{"user@example.com", true},
+		// 程序生成的负数金额不转义
+		{"-200", true},
+	}
+	for _, tt := range tests {
+		if cells[tt.cell] != tt.want {
+			t.Errorf("cell %q present = %v, want %v", tt.cell, cells[tt.cell], tt.want)
+		}
+	}
+}
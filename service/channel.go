@@ -7,6 +7,7 @@ import (
 	"one-api/dto"
 	"one-api/model"
 	"one-api/setting/operation_setting"
+	"strconv"
 	"strings"
 )
 
@@ -15,16 +16,37 @@ func formatNotifyType(channelId int, status int) string {
 }
 
 // disable & notify
-func DisableChannel(channelId int, channelName string, reason string) {
+// 多密钥渠道传入出错的密钥时只禁用该密钥，所有密钥都被禁用后才禁用整个渠道
+func DisableChannel(channelId int, channelName string, usingKey string, reason string) {
+	if usingKey != "" {
+		channel, err := model.CacheGetChannel(channelId)
+		if err == nil && channel.IsMultiKey() {
+			changed, allDisabled := model.UpdateChannelKeyStatus(channelId, usingKey, common.ChannelStatusAutoDisabled, reason)
+			if changed {
+				common.ChannelAutoDisabledTotal.WithLabelValues(strconv.Itoa(channelId), "key").Inc()
+				subject := fmt.Sprintf("通道「%s」（#%d）的密钥已被禁用", channelName, channelId)
+				content := fmt.Sprintf("通道「%s」（#%d）的密钥 %s 已被禁用，原因：%s", channelName, channelId, model.MaskChannelKey(usingKey), reason)
+				NotifyRootUser(formatNotifyType(channelId, common.ChannelStatusAutoDisabled), subject, content)
+			}
+			if !allDisabled {
+				return
+			}
+		}
+	}
 	success := model.UpdateChannelStatusById(channelId, common.ChannelStatusAutoDisabled, reason)
 	if success {
+		common.ChannelAutoDisabledTotal.WithLabelValues(strconv.Itoa(channelId), "channel").Inc()
 		subject := fmt.Sprintf("通道「%s」（#%d）已被禁用", channelName, channelId)
 		content := fmt.Sprintf("通道「%s」（#%d）已被禁用，原因：%s", channelName, channelId, reason)
 		NotifyRootUser(formatNotifyType(channelId, common.ChannelStatusAutoDisabled), subject, content)
 	}
 }
 
-func EnableChannel(channelId int, channelName string) {
+// EnableChannel 多密钥渠道只重新启用测试通过的密钥 usingKey，其余被自动禁用的密钥保持禁用
+func EnableChannel(channelId int, channelName string, usingKey string) {
+	if usingKey != "" {
+		model.UpdateChannelKeyStatus(channelId, usingKey, common.ChannelStatusEnabled, "")
+	}
 	success := model.UpdateChannelStatusById(channelId, common.ChannelStatusEnabled, "")
 	if success {
 		subject := fmt.Sprintf("通道「%s」（#%d）已被启用", channelName, channelId)
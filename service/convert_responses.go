@@ -0,0 +1,561 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"one-api/common"
+	"one-api/dto"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ResponsesToOpenAIRequest 将 Responses API 请求转换为 chat completions 请求，用于不支持 Responses API 的渠道
+func ResponsesToOpenAIRequest(request dto.OpenAIResponsesRequest) (*dto.GeneralOpenAIRequest, error) {
+	if request.PreviousResponseID != "" {
+		return nil, errors.New("previous_response_id is not supported by this channel")
+	}
+	openAIRequest := dto.GeneralOpenAIRequest{
+		Model:       request.Model,
+		Stream:      request.Stream,
+		MaxTokens:   request.MaxOutputTokens,
+		Temperature: request.Temperature,
+		User:        request.User,
+	}
+	if request.TopP != nil {
+		openAIRequest.TopP = *request.TopP
+	}
+	if request.Reasoning != nil {
+		openAIRequest.ReasoningEffort = request.Reasoning.Effort
+	}
+
+	messages := make([]dto.Message, 0)
+	if request.Instructions != "" {
+		message := dto.Message{Role: "system"}
+		message.SetStringContent(request.Instructions)
+		messages = append(messages, message)
+	}
+	if request.IsStringInput() {
+		message := dto.Message{Role: "user"}
+		message.SetStringContent(request.GetStringInput())
+		messages = append(messages, message)
+	} else {
+		for _, item := range request.ParseInput() {
+			switch item.Type {
+			case "", "message":
+				messages = append(messages, responsesInputMessage2OpenAI(item))
+			case dto.ResponsesOutputTypeFunctionCall:
+				toolCall := dto.ToolCallRequest{
+					ID:   item.CallId,
+					Type: "function",
+					Function: dto.FunctionRequest{
+						Name:      item.Name,
+						Arguments: item.Arguments,
+					},
+				}
+				// 连续的函数调用合并到同一条 assistant 消息中
+				if len(messages) > 0 && messages[len(messages)-1].Role == "assistant" && messages[len(messages)-1].ToolCalls != nil {
+					last := &messages[len(messages)-1]
+					last.SetToolCalls(append(last.ParseToolCalls(), toolCall))
+				} else {
+					message := dto.Message{Role: "assistant"}
+					message.SetToolCalls([]dto.ToolCallRequest{toolCall})
+					messages = append(messages, message)
+				}
+			case "function_call_output":
+				message := dto.Message{
+					Role:       "tool",
+					ToolCallId: item.CallId,
+				}
+				message.SetStringContent(item.Output)
+				messages = append(messages, message)
+			case dto.ResponsesOutputTypeReasoning:
+				// 推理内容无需回传给上游
+				continue
+			default:
+				return nil, fmt.Errorf("input item type %s is not supported by this channel", item.Type)
+			}
+		}
+	}
+	openAIRequest.Messages = messages
+
+	tools := request.ParseTools()
+	if len(tools) > 0 {
+		openAITools := make([]dto.ToolCallRequest, 0, len(tools))
+		for _, tool := range tools {
+			if tool.Type != "function" {
+				return nil, fmt.Errorf("tool type %s is not supported by this channel", tool.Type)
+			}
+			openAITools = append(openAITools, dto.ToolCallRequest{
+				Type: "function",
+				Function: dto.FunctionRequest{
+					Name:        tool.Name,
+					Description: tool.Description,
+					Parameters:  tool.Parameters,
+				},
+			})
+		}
+		openAIRequest.Tools = openAITools
+	}
+
+	if len(request.ToolChoice) > 0 {
+		var choice string
+		if err := json.Unmarshal(request.ToolChoice, &choice); err == nil {
+			openAIRequest.ToolChoice = choice
+		} else {
+			var tool dto.ResponsesTool
+			if err := json.Unmarshal(request.ToolChoice, &tool); err == nil && tool.Type == "function" {
+				openAIRequest.ToolChoice = map[string]any{
+					"type": "function",
+					"function": map[string]any{
+						"name": tool.Name,
+					},
+				}
+			}
+		}
+	}
+
+	if len(request.Text) > 0 {
+		var text struct {
+			Format *struct {
+				Type        string `json:"type"`
+				Name        string `json:"name"`
+				Description string `json:"description"`
+				Schema      any    `json:"schema"`
+				Strict      any    `json:"strict"`
+			} `json:"format"`
+		}
+		if err := json.Unmarshal(request.Text, &text); err == nil && text.Format != nil && text.Format.Type != "text" {
+			openAIRequest.ResponseFormat = &dto.ResponseFormat{Type: text.Format.Type}
+			if text.Format.Type == "json_schema" {
+				openAIRequest.ResponseFormat.JsonSchema = &dto.FormatJsonSchema{
+					Name:        text.Format.Name,
+					Description: text.Format.Description,
+					Schema:      text.Format.Schema,
+					Strict:      text.Format.Strict,
+				}
+			}
+		}
+	}
+	return &openAIRequest, nil
+}
+
+func responsesInputMessage2OpenAI(item dto.ResponsesInputItem) dto.Message {
+	role := item.Role
+	if role == "developer" {
+		role = "system"
+	}
+	message := dto.Message{Role: role}
+	if item.IsStringContent() {
+		message.SetStringContent(item.GetStringContent())
+		return message
+	}
+	contents := item.ParseContent()
+	mediaContents := make([]dto.MediaContent, 0, len(contents))
+	onlyText := true
+	var textBuilder strings.Builder
+	for _, content := range contents {
+		switch content.Type {
+		case dto.ResponsesContentTypeInputText, dto.ResponsesContentTypeOutputText:
+			textBuilder.WriteString(content.Text)
+			mediaContents = append(mediaContents, dto.MediaContent{
+				Type: dto.ContentTypeText,
+				Text: content.Text,
+			})
+		case dto.ResponsesContentTypeInputImage:
+			onlyText = false
+			detail := content.Detail
+			if detail == "" {
+				detail = "auto"
+			}
+			mediaContents = append(mediaContents, dto.MediaContent{
+				Type: dto.ContentTypeImageURL,
+				ImageUrl: &dto.MessageImageUrl{
+					Url:    content.ImageUrl,
+					Detail: detail,
+				},
+			})
+		case dto.ResponsesContentTypeInputFile:
+			onlyText = false
+			mediaContents = append(mediaContents, dto.MediaContent{
+				Type: dto.ContentTypeFile,
+				File: &dto.MessageFile{
+					FileName: content.Filename,
+					FileData: content.FileData,
+					FileId:   content.FileId,
+				},
+			})
+		}
+	}
+	if onlyText {
+		message.SetStringContent(textBuilder.String())
+	} else {
+		message.SetMediaContent(mediaContents)
+	}
+	return message
+}
+
+// GetResponsesRequestTexts 提取请求中的全部文本，用于计算 token 与敏感词检测
+func GetResponsesRequestTexts(request *dto.OpenAIResponsesRequest) []string {
+	texts := make([]string, 0)
+	if request.Instructions != "" {
+		texts = append(texts, request.Instructions)
+	}
+	if request.IsStringInput() {
+		return append(texts, request.GetStringInput())
+	}
+	for _, item := range request.ParseInput() {
+		switch item.Type {
+		case "", "message":
+			if item.IsStringContent() {
+				texts = append(texts, item.GetStringContent())
+				continue
+			}
+			for _, content := range item.ParseContent() {
+				if content.Text != "" {
+					texts = append(texts, content.Text)
+				}
+			}
+		case dto.ResponsesOutputTypeFunctionCall:
+			texts = append(texts, item.Name+item.Arguments)
+		case "function_call_output":
+			texts = append(texts, item.Output)
+		}
+	}
+	return texts
+}
+
+func responsesFinishStatus(finishReason string) (string, *dto.ResponsesIncompleteDetails) {
+	switch finishReason {
+	case "length":
+		return dto.ResponsesStatusIncomplete, &dto.ResponsesIncompleteDetails{Reason: "max_output_tokens"}
+	case "content_filter":
+		return dto.ResponsesStatusIncomplete, &dto.ResponsesIncompleteDetails{Reason: "content_filter"}
+	default:
+		return dto.ResponsesStatusCompleted, nil
+	}
+}
+
+func newResponsesResponse(id string, createdAt int64, model string, request *dto.OpenAIResponsesRequest) *dto.OpenAIResponsesResponse {
+	if id == "" {
+		id = common.GetUUID()
+	}
+	response := &dto.OpenAIResponsesResponse{
+		ID:        "resp_" + strings.TrimPrefix(id, "chatcmpl-"),
+		Object:    "response",
+		CreatedAt: createdAt,
+		Status:    dto.ResponsesStatusInProgress,
+		Model:     model,
+		Output:    make([]dto.ResponsesOutput, 0),
+	}
+	if response.CreatedAt == 0 {
+		response.CreatedAt = time.Now().Unix()
+	}
+	if request != nil {
+		response.Instructions = request.Instructions
+		response.MaxOutputTokens = request.MaxOutputTokens
+		response.ParallelToolCalls = request.ParallelToolCalls == nil || *request.ParallelToolCalls
+		response.Reasoning = request.Reasoning
+		response.Temperature = request.Temperature
+		response.ToolChoice = request.ToolChoice
+		response.Tools = request.Tools
+		response.TopP = request.TopP
+		response.User = request.User
+		response.Metadata = request.Metadata
+	}
+	return response
+}
+
+// ResponseOpenAI2Responses 将 chat completions 非流式响应转换为 Responses API 响应
+func ResponseOpenAI2Responses(openAIResponse *dto.OpenAITextResponse, request *dto.OpenAIResponsesRequest, usage *dto.Usage) *dto.OpenAIResponsesResponse {
+	response := newResponsesResponse(openAIResponse.Id, openAIResponse.Created, openAIResponse.Model, request)
+	finishReason := ""
+	for _, choice := range openAIResponse.Choices {
+		finishReason = choice.FinishReason
+		reasoning := choice.Message.ReasoningContent
+		if reasoning == "" {
+			reasoning = choice.Message.Reasoning
+		}
+		if reasoning != "" {
+			response.Output = append(response.Output, dto.ResponsesOutput{
+				Type: dto.ResponsesOutputTypeReasoning,
+				ID:   fmt.Sprintf("rs_%s", common.GetUUID()),
+				Summary: []dto.ResponsesOutputContent{
+					{Type: dto.ResponsesContentTypeSummary, Text: reasoning},
+				},
+			})
+		}
+		if text := choice.Message.StringContent(); text != "" {
+			response.Output = append(response.Output, dto.ResponsesOutput{
+				Type:   dto.ResponsesOutputTypeMessage,
+				ID:     fmt.Sprintf("msg_%s", common.GetUUID()),
+				Status: dto.ResponsesStatusCompleted,
+				Role:   "assistant",
+				Content: []dto.ResponsesOutputContent{
+					{Type: dto.ResponsesContentTypeOutputText, Text: text, Annotations: make([]any, 0)},
+				},
+			})
+		}
+		for _, toolCall := range choice.Message.ParseToolCalls() {
+			response.Output = append(response.Output, dto.ResponsesOutput{
+				Type:      dto.ResponsesOutputTypeFunctionCall,
+				ID:        fmt.Sprintf("fc_%s", common.GetUUID()),
+				Status:    dto.ResponsesStatusCompleted,
+				CallId:    toolCall.ID,
+				Name:      toolCall.Function.Name,
+				Arguments: toolCall.Function.Arguments,
+			})
+		}
+	}
+	response.Status, response.IncompleteDetails = responsesFinishStatus(finishReason)
+	if usage != nil {
+		response.Usage = dto.NewResponsesUsage(usage)
+	}
+	return response
+}
+
+type responsesToolCallState struct {
+	outputIndex int
+	item        dto.ResponsesOutput
+	arguments   strings.Builder
+}
+
+// ResponsesStreamConverter 将 chat completions 流式响应逐块转换为 Responses API 事件
+type ResponsesStreamConverter struct {
+	request  *dto.OpenAIResponsesRequest
+	response *dto.OpenAIResponsesResponse
+	started  bool
+
+	nextOutputIndex int
+	finishReason    string
+
+	reasoningIndex int
+	reasoningItem  *dto.ResponsesOutput
+	reasoningText  strings.Builder
+
+	messageIndex int
+	messageItem  *dto.ResponsesOutput
+	messageText  strings.Builder
+
+	toolCalls map[int]*responsesToolCallState
+}
+
+func NewResponsesStreamConverter(request *dto.OpenAIResponsesRequest) *ResponsesStreamConverter {
+	return &ResponsesStreamConverter{
+		request:   request,
+		toolCalls: make(map[int]*responsesToolCallState),
+	}
+}
+
+func (s *ResponsesStreamConverter) start(chunk *dto.ChatCompletionsStreamResponse) []dto.ResponsesStreamResponse {
+	s.started = true
+	s.response = newResponsesResponse(chunk.Id, chunk.Created, chunk.Model, s.request)
+	return []dto.ResponsesStreamResponse{
+		{Type: dto.ResponsesEventCreated, Response: s.snapshot()},
+		{Type: dto.ResponsesEventInProgress, Response: s.snapshot()},
+	}
+}
+
+func (s *ResponsesStreamConverter) snapshot() *dto.OpenAIResponsesResponse {
+	response := *s.response
+	response.Output = append(make([]dto.ResponsesOutput, 0, len(s.response.Output)), s.response.Output...)
+	return &response
+}
+
+// Convert 处理一个 chat completions 流式块，返回需要发送给客户端的事件
+func (s *ResponsesStreamConverter) Convert(chunk *dto.ChatCompletionsStreamResponse) []dto.ResponsesStreamResponse {
+	var events []dto.ResponsesStreamResponse
+	if !s.started {
+		events = append(events, s.start(chunk)...)
+	}
+	for _, choice := range chunk.Choices {
+		if reasoning := choice.Delta.GetReasoningContent(); reasoning != "" {
+			if s.reasoningItem == nil {
+				s.reasoningIndex = s.nextOutputIndex
+				s.nextOutputIndex++
+				s.reasoningItem = &dto.ResponsesOutput{
+					Type:    dto.ResponsesOutputTypeReasoning,
+					ID:      fmt.Sprintf("rs_%s", common.GetUUID()),
+					Summary: make([]dto.ResponsesOutputContent, 0),
+				}
+				events = append(events, dto.ResponsesStreamResponse{
+					Type:        dto.ResponsesEventOutputItemAdded,
+					OutputIndex: common.GetPointer(s.reasoningIndex),
+					Item:        s.reasoningItem,
+				})
+			}
+			s.reasoningText.WriteString(reasoning)
+			events = append(events, dto.ResponsesStreamResponse{
+				Type:         dto.ResponsesEventReasoningSummaryDelta,
+				ItemID:       s.reasoningItem.ID,
+				OutputIndex:  common.GetPointer(s.reasoningIndex),
+				SummaryIndex: common.GetPointer(0),
+				Delta:        reasoning,
+			})
+		}
+		if text := choice.Delta.GetContentString(); text != "" {
+			if s.messageItem == nil {
+				s.messageIndex = s.nextOutputIndex
+				s.nextOutputIndex++
+				s.messageItem = &dto.ResponsesOutput{
+					Type:    dto.ResponsesOutputTypeMessage,
+					ID:      fmt.Sprintf("msg_%s", common.GetUUID()),
+					Status:  dto.ResponsesStatusInProgress,
+					Role:    "assistant",
+					Content: make([]dto.ResponsesOutputContent, 0),
+				}
+				events = append(events, dto.ResponsesStreamResponse{
+					Type:        dto.ResponsesEventOutputItemAdded,
+					OutputIndex: common.GetPointer(s.messageIndex),
+					Item:        s.messageItem,
+				}, dto.ResponsesStreamResponse{
+					Type:         dto.ResponsesEventContentPartAdded,
+					ItemID:       s.messageItem.ID,
+					OutputIndex:  common.GetPointer(s.messageIndex),
+					ContentIndex: common.GetPointer(0),
+					Part:         &dto.ResponsesOutputContent{Type: dto.ResponsesContentTypeOutputText, Annotations: make([]any, 0)},
+				})
+			}
+			s.messageText.WriteString(text)
+			events = append(events, dto.ResponsesStreamResponse{
+				Type:         dto.ResponsesEventOutputTextDelta,
+				ItemID:       s.messageItem.ID,
+				OutputIndex:  common.GetPointer(s.messageIndex),
+				ContentIndex: common.GetPointer(0),
+				Delta:        text,
+			})
+		}
+		for i, toolCall := range choice.Delta.ToolCalls {
+			index := i
+			if toolCall.Index != nil {
+				index = *toolCall.Index
+			}
+			state, ok := s.toolCalls[index]
+			if !ok {
+				state = &responsesToolCallState{
+					outputIndex: s.nextOutputIndex,
+					item: dto.ResponsesOutput{
+						Type:   dto.ResponsesOutputTypeFunctionCall,
+						ID:     fmt.Sprintf("fc_%s", common.GetUUID()),
+						Status: dto.ResponsesStatusInProgress,
+						CallId: toolCall.ID,
+						Name:   toolCall.Function.Name,
+					},
+				}
+				s.nextOutputIndex++
+				s.toolCalls[index] = state
+				item := state.item
+				events = append(events, dto.ResponsesStreamResponse{
+					Type:        dto.ResponsesEventOutputItemAdded,
+					OutputIndex: common.GetPointer(state.outputIndex),
+					Item:        &item,
+				})
+			}
+			if toolCall.Function.Arguments != "" {
+				state.arguments.WriteString(toolCall.Function.Arguments)
+				events = append(events, dto.ResponsesStreamResponse{
+					Type:        dto.ResponsesEventFunctionArgsDelta,
+					ItemID:      state.item.ID,
+					OutputIndex: common.GetPointer(state.outputIndex),
+					Delta:       toolCall.Function.Arguments,
+				})
+			}
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			s.finishReason = *choice.FinishReason
+		}
+	}
+	return events
+}
+
+// Finish 在上游流结束后调用，补齐各输出项的结束事件并发送最终响应
+func (s *ResponsesStreamConverter) Finish(usage *dto.Usage) []dto.ResponsesStreamResponse {
+	var events []dto.ResponsesStreamResponse
+	if !s.started {
+		events = append(events, s.start(&dto.ChatCompletionsStreamResponse{})...)
+	}
+	outputs := make(map[int]dto.ResponsesOutput)
+	if s.reasoningItem != nil {
+		text := s.reasoningText.String()
+		item := *s.reasoningItem
+		item.Summary = []dto.ResponsesOutputContent{{Type: dto.ResponsesContentTypeSummary, Text: text}}
+		outputs[s.reasoningIndex] = item
+		events = append(events, dto.ResponsesStreamResponse{
+			Type:         dto.ResponsesEventReasoningSummaryDone,
+			ItemID:       item.ID,
+			OutputIndex:  common.GetPointer(s.reasoningIndex),
+			SummaryIndex: common.GetPointer(0),
+			Text:         text,
+		}, dto.ResponsesStreamResponse{
+			Type:        dto.ResponsesEventOutputItemDone,
+			OutputIndex: common.GetPointer(s.reasoningIndex),
+			Item:        &item,
+		})
+	}
+	if s.messageItem != nil {
+		text := s.messageText.String()
+		part := dto.ResponsesOutputContent{Type: dto.ResponsesContentTypeOutputText, Text: text, Annotations: make([]any, 0)}
+		item := *s.messageItem
+		item.Status = dto.ResponsesStatusCompleted
+		item.Content = []dto.ResponsesOutputContent{part}
+		outputs[s.messageIndex] = item
+		events = append(events, dto.ResponsesStreamResponse{
+			Type:         dto.ResponsesEventOutputTextDone,
+			ItemID:       item.ID,
+			OutputIndex:  common.GetPointer(s.messageIndex),
+			ContentIndex: common.GetPointer(0),
+			Text:         text,
+		}, dto.ResponsesStreamResponse{
+			Type:         dto.ResponsesEventContentPartDone,
+			ItemID:       item.ID,
+			OutputIndex:  common.GetPointer(s.messageIndex),
+			ContentIndex: common.GetPointer(0),
+			Part:         &part,
+		}, dto.ResponsesStreamResponse{
+			Type:        dto.ResponsesEventOutputItemDone,
+			OutputIndex: common.GetPointer(s.messageIndex),
+			Item:        &item,
+		})
+	}
+	toolIndexes := make([]int, 0, len(s.toolCalls))
+	for index := range s.toolCalls {
+		toolIndexes = append(toolIndexes, index)
+	}
+	sort.Ints(toolIndexes)
+	for _, index := range toolIndexes {
+		state := s.toolCalls[index]
+		item := state.item
+		item.Status = dto.ResponsesStatusCompleted
+		item.Arguments = state.arguments.String()
+		outputs[state.outputIndex] = item
+		events = append(events, dto.ResponsesStreamResponse{
+			Type:        dto.ResponsesEventFunctionArgsDone,
+			ItemID:      item.ID,
+			OutputIndex: common.GetPointer(state.outputIndex),
+			Arguments:   item.Arguments,
+		}, dto.ResponsesStreamResponse{
+			Type:        dto.ResponsesEventOutputItemDone,
+			OutputIndex: common.GetPointer(state.outputIndex),
+			Item:        &item,
+		})
+	}
+	for i := 0; i < s.nextOutputIndex; i++ {
+		if output, ok := outputs[i]; ok {
+			s.response.Output = append(s.response.Output, output)
+		}
+	}
+	s.response.Status, s.response.IncompleteDetails = responsesFinishStatus(s.finishReason)
+	if usage != nil {
+		s.response.Usage = dto.NewResponsesUsage(usage)
+	}
+	eventType := dto.ResponsesEventCompleted
+	if s.response.Status == dto.ResponsesStatusIncomplete {
+		eventType = dto.ResponsesEventIncomplete
+	}
+	events = append(events, dto.ResponsesStreamResponse{
+		Type:     eventType,
+		Response: s.snapshot(),
+	})
+	return events
+}
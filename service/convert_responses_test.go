@@ -0,0 +1,217 @@
+package service
+
+import (
+	"encoding/json"
+	"one-api/dto"
+	"strings"
+	"testing"
+)
+
+func parseResponsesRequest(t *testing.T, body string) dto.OpenAIResponsesRequest {
+	t.Helper()
+	var request dto.OpenAIResponsesRequest
+	if err := json.Unmarshal([]byte(body), &request); err != nil {
+		t.Fatal(err)
+	}
+	return request
+}
+
+func TestResponsesToOpenAIRequest(t *testing.T) {
+	request := parseResponsesRequest(t, `{
+		"model": "gpt-4o",
+		"instructions": "be brief",
+		"max_output_tokens": 100,
+		"input": [
+			{"role": "developer", "content": "rules"},
+			{"role": "user", "content": [
+				{"type": "input_text", "text": "what is this?"},
+				{"type": "input_image", "image_url": "https://example.com/a.png"}
+			]},
+			{"type": "reasoning", "summary": []},
+			{"type": "function_call", "call_id": "call_1", "name": "get_weather", "arguments": "{\"city\":\"a\"}"},
+			{"type": "function_call", "call_id": "call_2", "name": "get_weather", "arguments": "{\"city\":\"b\"}"},
+			{"type": "function_call_output", "call_id": "call_1", "output": "sunny"}
+		],
+		"tools": [{"type": "function", "name": "get_weather", "parameters": {"type": "object"}}],
+		"tool_choice": {"type": "function", "name": "get_weather"},
+		"text": {"format": {"type": "json_schema", "name": "answer", "schema": {"type": "object"}}}
+	}`)
+	openAIRequest, err := ResponsesToOpenAIRequest(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if openAIRequest.Model != "gpt-4o" || openAIRequest.MaxTokens != 100 {
+		t.Errorf("model = %s, max_tokens = %d", openAIRequest.Model, openAIRequest.MaxTokens)
+	}
+	messages := openAIRequest.Messages
+	roles := make([]string, 0, len(messages))
+	for _, message := range messages {
+		roles = append(roles, message.Role)
+	}
+	if got := strings.Join(roles, ","); got != "system,system,user,assistant,tool" {
+		t.Fatalf("roles = %s", got)
+	}
+	if messages[0].StringContent() != "be brief" || messages[1].StringContent() != "rules" {
+		t.Errorf("system messages = %q, %q", messages[0].StringContent(), messages[1].StringContent())
+	}
+	contents := messages[2].ParseContent()
+	if len(contents) != 2 || contents[0].Text != "what is this?" || contents[1].GetImageMedia().Url != "https://example.com/a.png" {
+		t.Errorf("user contents = %+v", contents)
+	}
+	// 连续的函数调用合并到同一条 assistant 消息
+	toolCalls := messages[3].ParseToolCalls()
+	if len(toolCalls) != 2 || toolCalls[0].ID != "call_1" || toolCalls[1].Function.Arguments != `{"city":"b"}` {
+		t.Errorf("tool calls = %+v", toolCalls)
+	}
+	if messages[4].ToolCallId != "call_1" || messages[4].StringContent() != "sunny" {
+		t.Errorf("tool message = %+v", messages[4])
+	}
+	if len(openAIRequest.Tools) != 1 || openAIRequest.Tools[0].Function.Name != "get_weather" {
+		t.Errorf("tools = %+v", openAIRequest.Tools)
+	}
+	toolChoice, _ := json.Marshal(openAIRequest.ToolChoice)
+	if string(toolChoice) != `{"function":{"name":"get_weather"},"type":"function"}` {
+		t.Errorf("tool_choice = %s", toolChoice)
+	}
+	if openAIRequest.ResponseFormat == nil || openAIRequest.ResponseFormat.JsonSchema == nil || openAIRequest.ResponseFormat.JsonSchema.Name != "answer" {
+		t.Errorf("response_format = %+v", openAIRequest.ResponseFormat)
+	}
+}
+
+func TestResponsesToOpenAIRequestUnsupported(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"previous response", `{"model":"m","input":"hi","previous_response_id":"resp_1"}`},
+		{"builtin tool", `{"model":"m","input":"hi","tools":[{"type":"web_search_preview"}]}`},
+		{"unknown item", `{"model":"m","input":[{"type":"computer_call"}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ResponsesToOpenAIRequest(parseResponsesRequest(t, tt.body)); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestResponseOpenAI2Responses(t *testing.T) {
+	var openAIResponse dto.OpenAITextResponse
+	err := json.Unmarshal([]byte(`{
+		"id": "chatcmpl-abc",
+		"model": "gpt-4o",
+		"created": 100,
+		"choices": [{
+			"message": {
+				"role": "assistant",
+				"content": "hello",
+				"reasoning_content": "thinking",
+				"tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "f", "arguments": "{}"}}]
+			},
+			"finish_reason": "length"
+		}]
+	}`), &openAIResponse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := parseResponsesRequest(t, `{"model":"gpt-4o","input":"hi","instructions":"be brief"}`)
+	usage := &dto.Usage{PromptTokens: 10, CompletionTokens: 5}
+	response := ResponseOpenAI2Responses(&openAIResponse, &request, usage)
+	if response.ID != "resp_abc" || response.Instructions != "be brief" {
+		t.Errorf("id = %s, instructions = %s", response.ID, response.Instructions)
+	}
+	if response.Status != dto.ResponsesStatusIncomplete || response.IncompleteDetails == nil || response.IncompleteDetails.Reason != "max_output_tokens" {
+		t.Errorf("status = %s, details = %+v", response.Status, response.IncompleteDetails)
+	}
+	types := make([]string, 0, len(response.Output))
+	for _, output := range response.Output {
+		types = append(types, output.Type)
+	}
+	if got := strings.Join(types, ","); got != "reasoning,message,function_call" {
+		t.Fatalf("output types = %s", got)
+	}
+	if response.Output[1].Content[0].Text != "hello" || response.Output[2].CallId != "call_1" {
+		t.Errorf("output = %+v", response.Output)
+	}
+	if response.Usage == nil || response.Usage.TotalTokens != 15 {
+		t.Errorf("usage = %+v", response.Usage)
+	}
+}
+
+func streamChunk(delta dto.ChatCompletionsStreamResponseChoiceDelta, finishReason string) *dto.ChatCompletionsStreamResponse {
+	choice := dto.ChatCompletionsStreamResponseChoice{Delta: delta}
+	if finishReason != "" {
+		choice.FinishReason = &finishReason
+	}
+	return &dto.ChatCompletionsStreamResponse{Id: "chatcmpl-abc", Model: "gpt-4o", Choices: []dto.ChatCompletionsStreamResponseChoice{choice}}
+}
+
+func TestResponsesStreamConverter(t *testing.T) {
+	request := parseResponsesRequest(t, `{"model":"gpt-4o","input":"hi","stream":true}`)
+	converter := NewResponsesStreamConverter(&request)
+	text := func(s string) *string { return &s }
+	index := func(i int) *int { return &i }
+
+	var events []dto.ResponsesStreamResponse
+	events = append(events, converter.Convert(streamChunk(dto.ChatCompletionsStreamResponseChoiceDelta{Content: text("hel")}, ""))...)
+	events = append(events, converter.Convert(streamChunk(dto.ChatCompletionsStreamResponseChoiceDelta{Content: text("lo")}, ""))...)
+	events = append(events, converter.Convert(streamChunk(dto.ChatCompletionsStreamResponseChoiceDelta{ToolCalls: []dto.ToolCallResponse{
+		{Index: index(0), ID: "call_1", Function: dto.FunctionResponse{Name: "f", Arguments: `{"a":`}},
+	}}, ""))...)
+	events = append(events, converter.Convert(streamChunk(dto.ChatCompletionsStreamResponseChoiceDelta{ToolCalls: []dto.ToolCallResponse{
+		{Index: index(0), Function: dto.FunctionResponse{Arguments: `1}`}},
+	}}, "tool_calls"))...)
+	events = append(events, converter.Finish(&dto.Usage{PromptTokens: 3, CompletionTokens: 4})...)
+
+	wantTypes := []string{
+		dto.ResponsesEventCreated,
+		dto.ResponsesEventInProgress,
+		dto.ResponsesEventOutputItemAdded,
+		dto.ResponsesEventContentPartAdded,
+		dto.ResponsesEventOutputTextDelta,
+		dto.ResponsesEventOutputTextDelta,
+		dto.ResponsesEventOutputItemAdded,
+		dto.ResponsesEventFunctionArgsDelta,
+		dto.ResponsesEventFunctionArgsDelta,
+		dto.ResponsesEventOutputTextDone,
+		dto.ResponsesEventContentPartDone,
+		dto.ResponsesEventOutputItemDone,
+		dto.ResponsesEventFunctionArgsDone,
+		dto.ResponsesEventOutputItemDone,
+		dto.ResponsesEventCompleted,
+	}
+	if len(events) != len(wantTypes) {
+		t.Fatalf("got %d events, want %d", len(events), len(wantTypes))
+	}
+	for i, event := range events {
+		if event.Type != wantTypes[i] {
+			t.Errorf("event %d type = %s, want %s", i, event.Type, wantTypes[i])
+		}
+	}
+	if events[9].Text != "hello" || events[12].Arguments != `{"a":1}` {
+		t.Errorf("done text = %q, arguments = %q", events[9].Text, events[12].Arguments)
+	}
+	if *events[6].OutputIndex != 1 {
+		t.Errorf("function call output index = %d", *events[6].OutputIndex)
+	}
+	final := events[len(events)-1].Response
+	if final.Status != dto.ResponsesStatusCompleted || len(final.Output) != 2 || final.Usage.TotalTokens != 7 {
+		t.Errorf("final response = %+v", final)
+	}
+	// 事件中的响应为快照，不随后续处理变化
+	if len(events[0].Response.Output) != 0 {
+		t.Errorf("created event output = %+v", events[0].Response.Output)
+	}
+}
+
+func TestResponsesStreamConverterIncomplete(t *testing.T) {
+	converter := NewResponsesStreamConverter(nil)
+	content := "partial"
+	converter.Convert(streamChunk(dto.ChatCompletionsStreamResponseChoiceDelta{Content: &content}, "length"))
+	events := converter.Finish(nil)
+	last := events[len(events)-1]
+	if last.Type != dto.ResponsesEventIncomplete || last.Response.IncompleteDetails.Reason != "max_output_tokens" {
+		t.Errorf("last event = %s, response = %+v", last.Type, last.Response)
+	}
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"fmt"
+	"one-api/common"
+	"one-api/dto"
+	"one-api/model"
+	"time"
+)
+
+// CheckCreditAccount 刷新后付费账户的提醒阈值和暂停状态，新达到提醒阈值或被自动暂停时通知用户。
+// 消费后只检查余额，checkOverdue 为 true 时同时检查逾期账单
+func CheckCreditAccount(userId int, checkOverdue bool) {
+	account, change, err := model.RefreshCreditAccount(userId, checkOverdue)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to refresh credit account of user %d: %s", userId, err.Error()))
+		return
+	}
+	if change.Threshold == 0 && !change.Suspended {
+		return
+	}
+	user, err := model.GetUserCache(userId)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to get user %d: %s", userId, err.Error()))
+		return
+	}
+	quota, _ := model.GetUserQuota(userId, false)
+	var notify dto.Notify
+	if change.Suspended {
+		prompt := "您的账户已暂停使用"
+		content := "{{value}}，原因：{{value}}。当前余额为 {{value}}，授信额度为 {{value}}，请尽快付款，付款后账户将自动恢复。"
+		notify = dto.NewNotify(dto.NotifyTypeCreditSuspend, prompt, content, []interface{}{prompt,
+			model.CreditSuspendReasonName(account.SuspendReason), common.FormatQuota(quota), common.FormatQuota(account.CreditLimit)})
+	} else {
+		prompt := fmt.Sprintf("您的授信额度已使用 %d%%", change.Threshold)
+		content := "{{value}}，当前余额为 {{value}}，授信额度为 {{value}}，超出授信额度后账户将暂停使用。"
+		notify = dto.NewNotify(dto.NotifyTypeCreditLimit, prompt, content, []interface{}{prompt,
+			common.FormatQuota(quota), common.FormatQuota(account.CreditLimit)})
+	}
+	if err := NotifyUser(userId, user.Email, user.GetSetting(), notify); err != nil {
+		common.SysError(fmt.Sprintf("failed to send credit notify to user %d: %s", userId, err.Error()))
+	}
+}
+
+// AutoCheckCreditAccounts 定期检查后付费账户，账单逾期时自动暂停，付款后自动恢复
+func AutoCheckCreditAccounts() {
+	for {
+		userIds, err := model.GetCreditCheckUserIds()
+		if err != nil {
+			common.SysError("failed to get credit accounts: " + err.Error())
+		}
+		for _, userId := range userIds {
+			CheckCreditAccount(userId, true)
+		}
+		time.Sleep(10 * time.Minute)
+	}
+}
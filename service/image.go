@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"image"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"one-api/common"
 	"one-api/constant"
@@ -152,6 +153,48 @@ func DecodeUrlImageData(imageUrl string) (image.Config, string, error) {
 	return image.Config{}, "", err // 返回最后一个错误
 }
 
+// DecodeImageFileConfig 读取上传图片的尺寸和格式，超过 maxSize 字节时返回错误
+func DecodeImageFileConfig(header *multipart.FileHeader, maxSize int64) (image.Config, string, error) {
+	if maxSize > 0 && header.Size > maxSize {
+		return image.Config{}, "", fmt.Errorf("image %s size %d exceeds maximum allowed size of %d bytes", header.Filename, header.Size, maxSize)
+	}
+	file, err := header.Open()
+	if err != nil {
+		return image.Config{}, "", err
+	}
+	defer file.Close()
+	// 只读取图片头部解析尺寸，不把整个文件读入内存
+	config, format, err := image.DecodeConfig(file)
+	if err != nil {
+		if _, err = file.Seek(0, io.SeekStart); err == nil {
+			config, err = webp.DecodeConfig(file)
+			format = "webp"
+		}
+	}
+	if err != nil {
+		return image.Config{}, "", fmt.Errorf("image %s is not a valid png, jpeg, gif or webp file", header.Filename)
+	}
+	return config, format, nil
+}
+
+// EncodeImageFileBase64 读取上传的图片，返回 MIME 类型和 base64 编码的内容
+func EncodeImageFileBase64(header *multipart.FileHeader) (string, string, error) {
+	file, err := header.Open()
+	if err != nil {
+		return "", "", err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return "", "", err
+	}
+	mimeType := header.Header.Get("Content-Type")
+	if !strings.HasPrefix(mimeType, "image/") {
+		mimeType = http.DetectContentType(data)
+	}
+	return mimeType, base64.StdEncoding.EncodeToString(data), nil
+}
+
 func getImageConfig(reader io.Reader) (image.Config, string, error) {
 	// 读取图片的头部信息来获取图片尺寸
 	config, format, err := image.DecodeConfig(reader)
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"mime/multipart"
+	"testing"
+)
+
+func newTestFileHeader(t *testing.T, filename string, data []byte) *multipart.FileHeader {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("image", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = part.Write(data)
+	_ = writer.Close()
+	form, err := multipart.NewReader(&body, writer.Boundary()).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return form.File["image"][0]
+}
+
+func TestDecodeImageFileConfig(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 32, 16))
+	var pngData, jpegData bytes.Buffer
+	_ = png.Encode(&pngData, img)
+	_ = jpeg.Encode(&jpegData, img, nil)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		maxSize int64
+		format  string
+		wantErr bool
+	}{
+		{name: "png", data: pngData.Bytes(), format: "png"},
+		{name: "jpeg", data: jpegData.Bytes(), format: "jpeg"},
+		{name: "too large", data: pngData.Bytes(), maxSize: 10, wantErr: true},
+		{name: "not an image", data: []byte("hello world"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, format, err := DecodeImageFileConfig(newTestFileHeader(t, "a.img", tt.data), tt.maxSize)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if format != tt.format || config.Width != 32 || config.Height != 16 {
+				t.Errorf("got %s %dx%d, want %s 32x16", format, config.Width, config.Height, tt.format)
+			}
+		})
+	}
+}
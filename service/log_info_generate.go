@@ -1,8 +1,12 @@
 package service
 
 import (
+	"one-api/common"
+	"one-api/constant"
 	"one-api/dto"
 	relaycommon "one-api/relay/common"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -17,6 +21,10 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 	other["cache_ratio"] = cacheRatio
 	other["model_price"] = modelPrice
 	other["frt"] = float64(relayInfo.FirstResponseTime.UnixMilli() - relayInfo.StartTime.UnixMilli())
+	if relayInfo.IsStream && relayInfo.FirstResponseTime.After(relayInfo.StartTime) {
+		common.RelayFirstResponseDuration.WithLabelValues(relayInfo.OriginModelName, strconv.Itoa(relayInfo.ChannelId), relayInfo.Group).
+			Observe(relayInfo.FirstResponseTime.Sub(relayInfo.StartTime).Seconds())
+	}
 	if relayInfo.ReasoningEffort != "" {
 		other["reasoning_effort"] = relayInfo.ReasoningEffort
 	}
@@ -24,6 +32,13 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 		other["is_model_mapped"] = true
 		other["upstream_model_name"] = relayInfo.UpstreamModelName
 	}
+	if fallbackPath := ctx.GetStringSlice(constant.ContextKeyFallbackPath); len(fallbackPath) > 1 {
+		other["fallback_from"] = fallbackPath[0]
+		other["fallback_path"] = strings.Join(fallbackPath, "->")
+	}
+	if batchId, ok := ctx.Request.Context().Value(constant.ContextKeyBatchId).(string); ok {
+		other["batch_id"] = batchId
+	}
 	adminInfo := make(map[string]interface{})
 	adminInfo["use_channel"] = ctx.GetStringSlice("use_channel")
 	other["admin_info"] = adminInfo
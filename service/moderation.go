@@ -0,0 +1,391 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+	"one-api/setting"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+const moderationRedactText = "**###**"
+
+var ErrModerationBlocked = errors.New("content blocked by moderation")
+
+// ModerationInput 待审核的内容，redact 时 Texts 指向的文本会被原地替换
+type ModerationInput struct {
+	Texts     []*string
+	ImageUrls []string
+}
+
+func (i *ModerationInput) IsEmpty() bool {
+	for _, text := range i.Texts {
+		if *text != "" {
+			return false
+		}
+	}
+	return len(i.ImageUrls) == 0
+}
+
+// ModerationResult 审核结果，Flagged 为命中的文本下标
+type ModerationResult struct {
+	Matches []string
+	Flagged []int
+}
+
+// ModerationProvider 审核方式，通过 RegisterModerationProvider 注册
+type ModerationProvider interface {
+	// Check 检查内容，未命中时返回 nil
+	Check(c *gin.Context, rule *setting.ModerationRule, input *ModerationInput) (*ModerationResult, error)
+	// Redact 替换文本中命中的内容
+	Redact(rule *setting.ModerationRule, text string) string
+}
+
+var moderationProviders = map[string]ModerationProvider{
+	setting.ModerationProviderKeyword: keywordModerationProvider{},
+	setting.ModerationProviderRegex:   regexModerationProvider{},
+	setting.ModerationProviderOpenAI:  openAIModerationProvider{},
+}
+
+func RegisterModerationProvider(name string, provider ModerationProvider) {
+	moderationProviders[name] = provider
+}
+
+// Moderate 按顺序执行对当前分组和模型生效的规则，所有命中都写入审核日志；
+// 命中 block 规则时返回 ErrModerationBlocked，redact 规则原地替换命中的文本
+func Moderate(c *gin.Context, stage string, modelName string, input *ModerationInput) error {
+	rules := setting.GetModerationRules(stage, c.GetString("group"), modelName)
+	if len(rules) == 0 || input.IsEmpty() {
+		return nil
+	}
+	for _, rule := range rules {
+		provider, ok := moderationProviders[rule.Provider]
+		if !ok {
+			common.LogWarn(c, "unknown moderation provider: "+rule.Provider)
+			continue
+		}
+		content := input.content()
+		result, err := provider.Check(c, rule, input)
+		if err != nil {
+			// 审核服务异常时放行请求，避免影响正常调用
+			common.LogError(c, fmt.Sprintf("moderation rule %s failed: %s", rule.Name, err.Error()))
+			continue
+		}
+		if result == nil {
+			continue
+		}
+		matches, _ := json.Marshal(result.Matches)
+		model.RecordModerationLog(c, &model.ModerationLog{
+			ModelName: modelName,
+			Stage:     stage,
+			Rule:      rule.Name,
+			Provider:  rule.Provider,
+			Action:    rule.Action,
+			Matches:   string(matches),
+			Content:   content,
+		})
+		common.LogWarn(c, fmt.Sprintf("moderation rule %s hit on %s: %s", rule.Name, stage, strings.Join(result.Matches, ", ")))
+		switch rule.Action {
+		case setting.ModerationActionBlock:
+			return fmt.Errorf("%w: %s", ErrModerationBlocked, rule.Name)
+		case setting.ModerationActionRedact:
+			for _, idx := range result.Flagged {
+				*input.Texts[idx] = provider.Redact(rule, *input.Texts[idx])
+			}
+		}
+	}
+	return nil
+}
+
+// ModerationOverlapChars 返回生效的 keyword 和 regex 规则中最长的关键词或表达式的字符数，
+// 流式响应分段审核时保留这么多字符与下一段一起审核，避免命中内容被分段截断
+func ModerationOverlapChars(stage string, group string, modelName string) int {
+	overlap := 0
+	for _, rule := range setting.GetModerationRules(stage, group, modelName) {
+		var patterns []string
+		switch rule.Provider {
+		case setting.ModerationProviderKeyword:
+			patterns = rule.Words
+			if len(patterns) == 0 {
+				patterns = setting.SensitiveWords
+			}
+		case setting.ModerationProviderRegex:
+			patterns = rule.Patterns
+		}
+		for _, pattern := range patterns {
+			overlap = max(overlap, utf8.RuneCountInString(pattern))
+		}
+	}
+	return overlap
+}
+
+func (i *ModerationInput) content() string {
+	texts := make([]string, 0, len(i.Texts))
+	for _, text := range i.Texts {
+		if *text != "" {
+			texts = append(texts, *text)
+		}
+	}
+	if len(i.ImageUrls) > 0 {
+		texts = append(texts, fmt.Sprintf("[%d images]", len(i.ImageUrls)))
+	}
+	return strings.Join(texts, "\n")
+}
+
+// moderationRegexCache 缓存编译后的正则，键为表达式
+var moderationRegexCache sync.Map
+
+func getModerationRegex(expr string) (*regexp.Regexp, error) {
+	if re, ok := moderationRegexCache.Load(expr); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	moderationRegexCache.Store(expr, re)
+	return re, nil
+}
+
+// checkModerationRegex 使用正则逐条检查文本，返回去重后的命中片段
+func checkModerationRegex(exprs []string, input *ModerationInput) (*ModerationResult, error) {
+	var result *ModerationResult
+	flagged := make(map[int]bool)
+	matched := make(map[string]bool)
+	for _, expr := range exprs {
+		re, err := getModerationRegex(expr)
+		if err != nil {
+			return nil, err
+		}
+		for idx, text := range input.Texts {
+			found := re.FindAllString(*text, -1)
+			if len(found) == 0 {
+				continue
+			}
+			if result == nil {
+				result = &ModerationResult{}
+			}
+			if !flagged[idx] {
+				flagged[idx] = true
+				result.Flagged = append(result.Flagged, idx)
+			}
+			for _, match := range found {
+				if !matched[match] {
+					matched[match] = true
+					result.Matches = append(result.Matches, match)
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+func redactModerationRegex(exprs []string, text string) string {
+	for _, expr := range exprs {
+		if re, err := getModerationRegex(expr); err == nil {
+			text = re.ReplaceAllLiteralString(text, moderationRedactText)
+		}
+	}
+	return text
+}
+
+// keywordModerationProvider 不区分大小写的关键词匹配，未配置关键词时使用敏感词列表
+type keywordModerationProvider struct{}
+
+func keywordModerationRegex(rule *setting.ModerationRule) []string {
+	words := rule.Words
+	if len(words) == 0 {
+		words = setting.SensitiveWords
+	}
+	quoted := make([]string, 0, len(words))
+	for _, word := range words {
+		if word != "" {
+			quoted = append(quoted, regexp.QuoteMeta(word))
+		}
+	}
+	if len(quoted) == 0 {
+		return nil
+	}
+	// 长的关键词优先匹配
+	sort.Slice(quoted, func(i, j int) bool { return len(quoted[i]) > len(quoted[j]) })
+	return []string{"(?i)" + strings.Join(quoted, "|")}
+}
+
+func (keywordModerationProvider) Check(c *gin.Context, rule *setting.ModerationRule, input *ModerationInput) (*ModerationResult, error) {
+	return checkModerationRegex(keywordModerationRegex(rule), input)
+}
+
+func (keywordModerationProvider) Redact(rule *setting.ModerationRule, text string) string {
+	return redactModerationRegex(keywordModerationRegex(rule), text)
+}
+
+// regexModerationProvider 正则匹配
+type regexModerationProvider struct{}
+
+func (regexModerationProvider) Check(c *gin.Context, rule *setting.ModerationRule, input *ModerationInput) (*ModerationResult, error) {
+	return checkModerationRegex(rule.Patterns, input)
+}
+
+func (regexModerationProvider) Redact(rule *setting.ModerationRule, text string) string {
+	return redactModerationRegex(rule.Patterns, text)
+}
+
+// openAIModerationProvider 调用 OpenAI 类型渠道的 /v1/moderations 接口，不计入用户额度
+type openAIModerationProvider struct{}
+
+type openAIModerationResponse struct {
+	Results []struct {
+		Flagged        bool               `json:"flagged"`
+		Categories     map[string]bool    `json:"categories"`
+		CategoryScores map[string]float64 `json:"category_scores"`
+	} `json:"results"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func getModerationChannel(c *gin.Context, rule *setting.ModerationRule) (*model.Channel, error) {
+	if rule.ChannelId != 0 {
+		return model.CacheGetChannel(rule.ChannelId)
+	}
+	return model.CacheGetRandomSatisfiedChannel(c.GetString("group"), rule.Model, 0)
+}
+
+func (openAIModerationProvider) Check(c *gin.Context, rule *setting.ModerationRule, input *ModerationInput) (*ModerationResult, error) {
+	channel, err := getModerationChannel(c, rule)
+	if err != nil {
+		return nil, err
+	}
+	if channel == nil {
+		return nil, fmt.Errorf("no available channel for moderation model %s", rule.Model)
+	}
+	// 其他类型渠道的审核接口地址和鉴权方式不同，只支持 OpenAI 类型渠道
+	if channel.Type != common.ChannelTypeOpenAI {
+		return nil, fmt.Errorf("moderation channel #%d is not an OpenAI channel", channel.Id)
+	}
+	baseURL := channel.GetBaseURL()
+	if baseURL == "" {
+		baseURL = common.ChannelBaseURLs[channel.Type]
+	}
+
+	// 纯文本时每段文本对应一个结果，包含图片时整体返回一个结果
+	texts := make([]string, 0, len(input.Texts))
+	for _, text := range input.Texts {
+		texts = append(texts, *text)
+	}
+	var moderationInput any = texts
+	if len(input.ImageUrls) > 0 {
+		parts := make([]map[string]any, 0, len(texts)+len(input.ImageUrls))
+		for _, text := range texts {
+			if text != "" {
+				parts = append(parts, map[string]any{"type": "text", "text": text})
+			}
+		}
+		for _, url := range input.ImageUrls {
+			parts = append(parts, map[string]any{"type": "image_url", "image_url": map[string]any{"url": url}})
+		}
+		moderationInput = parts
+	}
+	body, err := json.Marshal(map[string]any{
+		"model": rule.Model,
+		"input": moderationInput,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(baseURL, "/")+"/v1/moderations", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+channel.GetNextKey())
+	client := GetHttpClient()
+	if proxyURL, ok := channel.GetSetting()["proxy"].(string); ok && proxyURL != "" {
+		client, err = NewProxyHttpClient(proxyURL)
+		if err != nil {
+			return nil, err
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var moderationResp openAIModerationResponse
+	if err := json.Unmarshal(respBody, &moderationResp); err != nil {
+		return nil, fmt.Errorf("unmarshal moderation response failed: %w", err)
+	}
+	if moderationResp.Error != nil {
+		return nil, errors.New(moderationResp.Error.Message)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("moderation request failed with status code %d", resp.StatusCode)
+	}
+
+	var result *ModerationResult
+	seen := make(map[string]bool)
+	for idx, r := range moderationResp.Results {
+		var categories []string
+		if rule.Threshold > 0 {
+			for category, score := range r.CategoryScores {
+				if score >= rule.Threshold {
+					categories = append(categories, category)
+				}
+			}
+		} else if r.Flagged {
+			for category, flagged := range r.Categories {
+				if flagged {
+					categories = append(categories, category)
+				}
+			}
+		}
+		if len(categories) == 0 {
+			continue
+		}
+		if result == nil {
+			result = &ModerationResult{}
+		}
+		if len(input.ImageUrls) > 0 {
+			for i := range input.Texts {
+				result.Flagged = append(result.Flagged, i)
+			}
+		} else if idx < len(input.Texts) {
+			result.Flagged = append(result.Flagged, idx)
+		}
+		for _, category := range categories {
+			if !seen[category] {
+				seen[category] = true
+				result.Matches = append(result.Matches, category)
+			}
+		}
+	}
+	if result != nil {
+		sort.Strings(result.Matches)
+	}
+	return result, nil
+}
+
+// Redact 审核接口无法定位具体片段，替换整段文本
+func (openAIModerationProvider) Redact(rule *setting.ModerationRule, text string) string {
+	return moderationRedactText
+}
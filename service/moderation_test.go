@@ -0,0 +1,80 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"one-api/common"
+	"one-api/model"
+	"one-api/setting"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestModerationOverlapChars(t *testing.T) {
+	moderationSetting := setting.GetModerationSetting()
+	oldSetting := *moderationSetting
+	t.Cleanup(func() { *moderationSetting = oldSetting })
+	moderationSetting.Enabled = true
+	moderationSetting.Rules = []setting.ModerationRule{
+		{Name: "keyword", Provider: setting.ModerationProviderKeyword, Words: []string{"secret", "机密文件"}, Stages: []string{setting.ModerationStageCompletion}},
+		{Name: "regex", Provider: setting.ModerationProviderRegex, Patterns: []string{`sk-[a-z]{4}`}, Stages: []string{setting.ModerationStageCompletion}},
+		{Name: "prompt only", Provider: setting.ModerationProviderKeyword, Words: []string{strings.Repeat("a", 50)}},
+		{Name: "openai", Provider: setting.ModerationProviderOpenAI, Model: "omni-moderation-latest", Stages: []string{setting.ModerationStageCompletion}},
+	}
+	if got := ModerationOverlapChars(setting.ModerationStageCompletion, "default", "gpt-4o"); got != 11 {
+		t.Errorf("completion overlap = %d, want 11", got)
+	}
+	if got := ModerationOverlapChars(setting.ModerationStagePrompt, "default", "gpt-4o"); got != 50 {
+		t.Errorf("prompt overlap = %d, want 50", got)
+	}
+	moderationSetting.Enabled = false
+	if got := ModerationOverlapChars(setting.ModerationStageCompletion, "default", "gpt-4o"); got != 0 {
+		t.Errorf("overlap when disabled = %d, want 0", got)
+	}
+}
+
+func TestOpenAIModerationProviderChannelType(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB(t, &model.Channel{})
+	oldMemoryCache := common.MemoryCacheEnabled
+	common.MemoryCacheEnabled = false
+	t.Cleanup(func() { common.MemoryCacheEnabled = oldMemoryCache })
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.URL.Path != "/v1/moderations" || r.Header.Get("Authorization") != "Bearer sk-test" {
+			t.Errorf("request %s with %q", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		_, _ = w.Write([]byte(`{"results":[{"flagged":true,"categories":{"violence":true}}]}`))
+	}))
+	defer server.Close()
+
+	channels := []*model.Channel{
+		{Id: 1, Type: common.ChannelTypeOpenAI, Key: "sk-test", BaseURL: &server.URL},
+		{Id: 2, Type: common.ChannelTypeAnthropic, Key: "sk-test", BaseURL: &server.URL},
+	}
+	for _, channel := range channels {
+		if err := db.Create(channel).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+	text := "hit"
+	input := &ModerationInput{Texts: []*string{&text}}
+
+	result, err := openAIModerationProvider{}.Check(c, &setting.ModerationRule{Model: "omni-moderation-latest", ChannelId: 1}, input)
+	if err != nil || result == nil || result.Matches[0] != "violence" {
+		t.Errorf("openai channel result = %+v, err = %v", result, err)
+	}
+	if _, err := (openAIModerationProvider{}).Check(c, &setting.ModerationRule{Model: "omni-moderation-latest", ChannelId: 2}, input); err == nil {
+		t.Error("non-OpenAI channel accepted")
+	}
+	if requests.Load() != 1 {
+		t.Errorf("requests = %d, want 1", requests.Load())
+	}
+}
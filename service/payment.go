@@ -0,0 +1,142 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"one-api/model"
+	"sort"
+)
+
+const (
+	PaymentProviderEpay   = "epay"
+	PaymentProviderStripe = "stripe"
+	PaymentProviderFake   = "fake"
+)
+
+const (
+	PaymentEventPaid     = "paid"
+	PaymentEventFailed   = "failed"
+	PaymentEventRefunded = "refunded"
+)
+
+var ErrPaymentRefundNotSupported = errors.New("当前支付渠道不支持退款")
+
+// PaymentOrder 创建支付时的订单信息
+type PaymentOrder struct {
+	TradeNo string
+	Title   string
+	Money   float64
+	// PaymentMethod 支付方式，如易支付的 alipay、wxpay
+	PaymentMethod string
+	NotifyUrl     string
+	ReturnUrl     string
+}
+
+// PaymentCheckout 支付跳转信息，Params 不为空时需要以表单 POST 提交到 Url
+type PaymentCheckout struct {
+	Url             string
+	Params          map[string]string
+	ProviderTradeNo string
+}
+
+// PaymentEvent 支付回调事件，TradeNo 为空时按 ProviderTradeNo 查找订单
+type PaymentEvent struct {
+	Id              string
+	Type            string
+	TradeNo         string
+	ProviderTradeNo string
+}
+
+// PaymentProvider 在线支付渠道，通过 RegisterPaymentProvider 注册
+type PaymentProvider interface {
+	// Enabled 是否已配置可用
+	Enabled() bool
+	// Currency 支付货币
+	Currency() string
+	// UnitPrice 每单位额度的支付价格
+	UnitPrice() float64
+	// CreateCheckout 创建支付订单
+	CreateCheckout(order *PaymentOrder) (*PaymentCheckout, error)
+	// VerifyWebhook 校验回调签名并解析事件，无需处理的事件返回 nil
+	VerifyWebhook(req *http.Request, body []byte) (*PaymentEvent, error)
+	// WebhookResponse 回调处理结果对应的响应状态码和内容
+	WebhookResponse(ok bool) (int, string)
+	// Refund 对已支付的订单发起全额退款
+	Refund(topUp *model.TopUp) error
+}
+
+var paymentProviders = map[string]PaymentProvider{
+	PaymentProviderEpay:   epayPaymentProvider{},
+	PaymentProviderStripe: stripePaymentProvider{},
+	PaymentProviderFake:   &FakePaymentProvider{},
+}
+
+func RegisterPaymentProvider(name string, provider PaymentProvider) {
+	paymentProviders[name] = provider
+}
+
+// GetPaymentProvider 获取已启用的支付渠道
+func GetPaymentProvider(name string) (PaymentProvider, error) {
+	provider, ok := paymentProviders[name]
+	if !ok {
+		return nil, fmt.Errorf("未知的支付渠道: %s", name)
+	}
+	if !provider.Enabled() {
+		return nil, errors.New("当前管理员未配置支付信息")
+	}
+	return provider, nil
+}
+
+// GetEnabledPaymentProviders 返回已启用的支付渠道名称
+func GetEnabledPaymentProviders() []string {
+	names := make([]string, 0, len(paymentProviders))
+	for name, provider := range paymentProviders {
+		if provider.Enabled() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// HandlePaymentEvent 按回调事件变更订单状态，重复的回调不会重复增减额度
+func HandlePaymentEvent(providerName string, event *PaymentEvent) (*model.TopUp, bool, error) {
+	transition := &model.TopUpTransition{
+		TradeNo:         event.TradeNo,
+		ProviderTradeNo: event.ProviderTradeNo,
+		Provider:        providerName,
+		EventId:         event.Id,
+	}
+	switch event.Type {
+	case PaymentEventPaid:
+		transition.Status = model.TopUpStatusSuccess
+	case PaymentEventFailed:
+		transition.Status = model.TopUpStatusFailed
+	case PaymentEventRefunded:
+		transition.Status = model.TopUpStatusRefunded
+	default:
+		return nil, false, fmt.Errorf("unknown payment event type: %s", event.Type)
+	}
+	return model.TransitTopUp(transition)
+}
+
+// RefundTopUp 通过支付渠道退款并扣除对应额度
+func RefundTopUp(topUp *model.TopUp) (*model.TopUp, error) {
+	if topUp.Status != model.TopUpStatusSuccess {
+		return nil, errors.New("只能退款已支付的订单")
+	}
+	provider, ok := paymentProviders[topUp.Provider]
+	if !ok {
+		return nil, fmt.Errorf("未知的支付渠道: %s", topUp.Provider)
+	}
+	if err := provider.Refund(topUp); err != nil {
+		return nil, err
+	}
+	refunded, _, err := model.TransitTopUp(&model.TopUpTransition{
+		TradeNo:  topUp.TradeNo,
+		Provider: topUp.Provider,
+		Status:   model.TopUpStatusRefunded,
+	})
+	return refunded, err
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"one-api/model"
+	"one-api/setting"
+	"strconv"
+
+	"github.com/Calcium-Ion/go-epay/epay"
+)
+
+type epayPaymentProvider struct{}
+
+func GetEpayClient() *epay.Client {
+	if setting.PayAddress == "" || setting.EpayId == "" || setting.EpayKey == "" {
+		return nil
+	}
+	withUrl, err := epay.NewClient(&epay.Config{
+		PartnerID: setting.EpayId,
+		Key:       setting.EpayKey,
+	}, setting.PayAddress)
+	if err != nil {
+		return nil
+	}
+	return withUrl
+}
+
+func (epayPaymentProvider) Enabled() bool {
+	return setting.PayAddress != "" && setting.EpayId != "" && setting.EpayKey != ""
+}
+
+func (epayPaymentProvider) Currency() string {
+	return "CNY"
+}
+
+func (epayPaymentProvider) UnitPrice() float64 {
+	return setting.Price
+}
+
+func (epayPaymentProvider) CreateCheckout(order *PaymentOrder) (*PaymentCheckout, error) {
+	client := GetEpayClient()
+	if client == nil {
+		return nil, errors.New("当前管理员未配置支付信息")
+	}
+	payType := "wxpay"
+	if order.PaymentMethod == "zfb" || order.PaymentMethod == "alipay" {
+		payType = "alipay"
+	}
+	notifyUrl, err := url.Parse(order.NotifyUrl)
+	if err != nil {
+		return nil, err
+	}
+	returnUrl, err := url.Parse(order.ReturnUrl)
+	if err != nil {
+		return nil, err
+	}
+	uri, params, err := client.Purchase(&epay.PurchaseArgs{
+		Type:           payType,
+		ServiceTradeNo: order.TradeNo,
+		Name:           order.Title,
+		Money:          strconv.FormatFloat(order.Money, 'f', 2, 64),
+		Device:         epay.PC,
+		NotifyUrl:      notifyUrl,
+		ReturnUrl:      returnUrl,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &PaymentCheckout{
+		Url:    uri,
+		Params: params,
+	}, nil
+}
+
+// VerifyWebhook 易支付通过 GET 请求的查询参数回调
+func (epayPaymentProvider) VerifyWebhook(req *http.Request, body []byte) (*PaymentEvent, error) {
+	client := GetEpayClient()
+	if client == nil {
+		return nil, errors.New("易支付未配置")
+	}
+	query := req.URL.Query()
+	params := make(map[string]string, len(query))
+	for key := range query {
+		params[key] = query.Get(key)
+	}
+	verifyInfo, err := client.Verify(params)
+	if err != nil {
+		return nil, err
+	}
+	if !verifyInfo.VerifyStatus {
+		return nil, errors.New("易支付回调签名验证失败")
+	}
+	if verifyInfo.TradeStatus != epay.StatusTradeSuccess {
+		return nil, nil
+	}
+	return &PaymentEvent{
+		Id:              verifyInfo.TradeNo,
+		Type:            PaymentEventPaid,
+		TradeNo:         verifyInfo.ServiceTradeNo,
+		ProviderTradeNo: verifyInfo.TradeNo,
+	}, nil
+}
+
+func (epayPaymentProvider) WebhookResponse(ok bool) (int, string) {
+	if ok {
+		return http.StatusOK, "success"
+	}
+	return http.StatusOK, "fail"
+}
+
+func (epayPaymentProvider) Refund(topUp *model.TopUp) error {
+	return ErrPaymentRefundNotSupported
+}
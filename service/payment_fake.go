@@ -0,0 +1,88 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"one-api/constant"
+	"one-api/model"
+	"sync"
+)
+
+// FakePaymentProvider 本地模拟支付渠道，设置 FAKE_PAYMENT_SECRET 后启用，用于开发和测试。
+// 回调请求体为 FakePaymentEvent，签名为请求体的 HMAC-SHA256，放在 X-Fake-Signature 头中
+type FakePaymentProvider struct {
+	mu      sync.Mutex
+	Refunds []string
+}
+
+type FakePaymentEvent struct {
+	Id      string `json:"id"`
+	Type    string `json:"type"`
+	TradeNo string `json:"trade_no"`
+}
+
+// SignFakePaymentEvent 生成模拟回调的签名
+func SignFakePaymentEvent(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(constant.FakePaymentSecret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (p *FakePaymentProvider) Enabled() bool {
+	return constant.FakePaymentSecret != ""
+}
+
+func (p *FakePaymentProvider) Currency() string {
+	return "USD"
+}
+
+func (p *FakePaymentProvider) UnitPrice() float64 {
+	return 1
+}
+
+func (p *FakePaymentProvider) CreateCheckout(order *PaymentOrder) (*PaymentCheckout, error) {
+	return &PaymentCheckout{
+		Url:             order.ReturnUrl,
+		ProviderTradeNo: "fake_" + order.TradeNo,
+	}, nil
+}
+
+func (p *FakePaymentProvider) VerifyWebhook(req *http.Request, body []byte) (*PaymentEvent, error) {
+	signature, err := hex.DecodeString(req.Header.Get("X-Fake-Signature"))
+	if err != nil || constant.FakePaymentSecret == "" {
+		return nil, errors.New("fake payment: invalid signature")
+	}
+	expected, _ := hex.DecodeString(SignFakePaymentEvent(body))
+	if !hmac.Equal(signature, expected) {
+		return nil, errors.New("fake payment: signature mismatch")
+	}
+	var event FakePaymentEvent
+	if err = json.Unmarshal(body, &event); err != nil {
+		return nil, err
+	}
+	return &PaymentEvent{
+		Id:              event.Id,
+		Type:            event.Type,
+		TradeNo:         event.TradeNo,
+		ProviderTradeNo: "fake_" + event.TradeNo,
+	}, nil
+}
+
+func (p *FakePaymentProvider) WebhookResponse(ok bool) (int, string) {
+	if ok {
+		return http.StatusOK, "ok"
+	}
+	return http.StatusBadRequest, "fail"
+}
+
+// Refund 只记录退款的订单号
+func (p *FakePaymentProvider) Refund(topUp *model.TopUp) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Refunds = append(p.Refunds, topUp.TradeNo)
+	return nil
+}
@@ -0,0 +1,249 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"one-api/model"
+	"one-api/setting/operation_setting"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// stripeWebhookTolerance 回调签名时间戳允许的最大偏差
+const stripeWebhookTolerance = 5 * time.Minute
+
+// stripeZeroDecimalCurrencies 没有小数单位的货币，金额无需乘以 100
+var stripeZeroDecimalCurrencies = map[string]bool{
+	"bif": true, "clp": true, "djf": true, "gnf": true, "jpy": true, "kmf": true, "krw": true, "mga": true,
+	"pyg": true, "rwf": true, "ugx": true, "vnd": true, "vuv": true, "xaf": true, "xof": true, "xpf": true,
+}
+
+type stripePaymentProvider struct{}
+
+type stripeError struct {
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type stripeCheckoutSession struct {
+	Id                string            `json:"id"`
+	Url               string            `json:"url"`
+	ClientReferenceId string            `json:"client_reference_id"`
+	PaymentIntent     string            `json:"payment_intent"`
+	PaymentStatus     string            `json:"payment_status"`
+	Metadata          map[string]string `json:"metadata"`
+}
+
+type stripeCharge struct {
+	PaymentIntent string `json:"payment_intent"`
+	Refunded      bool   `json:"refunded"`
+}
+
+type stripeEvent struct {
+	Id   string `json:"id"`
+	Type string `json:"type"`
+	Data struct {
+		Object json.RawMessage `json:"object"`
+	} `json:"data"`
+}
+
+func (stripePaymentProvider) Enabled() bool {
+	stripeSetting := operation_setting.GetStripeSetting()
+	return stripeSetting.Enabled && stripeSetting.SecretKey != "" && stripeSetting.WebhookSecret != ""
+}
+
+func (stripePaymentProvider) Currency() string {
+	return strings.ToUpper(operation_setting.GetStripeSetting().Currency)
+}
+
+func (stripePaymentProvider) UnitPrice() float64 {
+	return operation_setting.GetStripeSetting().UnitPrice
+}
+
+// stripeUnitAmount 将金额转换为货币的最小单位
+func stripeUnitAmount(money float64, currency string) int64 {
+	amount := decimal.NewFromFloat(money)
+	if !stripeZeroDecimalCurrencies[strings.ToLower(currency)] {
+		amount = amount.Mul(decimal.NewFromInt(100))
+	}
+	return amount.Round(0).IntPart()
+}
+
+// stripeRequest 以表单格式调用 Stripe API，idempotencyKey 保证重试不会重复创建
+func stripeRequest(path string, form url.Values, idempotencyKey string, v any) error {
+	stripeSetting := operation_setting.GetStripeSetting()
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(stripeSetting.ApiBase, "/")+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+stripeSetting.SecretKey)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+	resp, err := GetHttpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var stripeErr stripeError
+		if json.Unmarshal(body, &stripeErr) == nil && stripeErr.Error.Message != "" {
+			return fmt.Errorf("stripe: %s", stripeErr.Error.Message)
+		}
+		return fmt.Errorf("stripe: unexpected status code %d", resp.StatusCode)
+	}
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(body, v)
+}
+
+func (p stripePaymentProvider) CreateCheckout(order *PaymentOrder) (*PaymentCheckout, error) {
+	currency := strings.ToLower(p.Currency())
+	form := url.Values{}
+	form.Set("mode", "payment")
+	form.Set("success_url", order.ReturnUrl)
+	form.Set("cancel_url", order.ReturnUrl)
+	form.Set("client_reference_id", order.TradeNo)
+	form.Set("metadata[trade_no]", order.TradeNo)
+	form.Set("line_items[0][quantity]", "1")
+	form.Set("line_items[0][price_data][currency]", currency)
+	form.Set("line_items[0][price_data][unit_amount]", strconv.FormatInt(stripeUnitAmount(order.Money, currency), 10))
+	form.Set("line_items[0][price_data][product_data][name]", order.Title)
+	var session stripeCheckoutSession
+	if err := stripeRequest("/v1/checkout/sessions", form, order.TradeNo, &session); err != nil {
+		return nil, err
+	}
+	if session.Url == "" {
+		return nil, errors.New("stripe: checkout session has no url")
+	}
+	return &PaymentCheckout{
+		Url:             session.Url,
+		ProviderTradeNo: session.Id,
+	}, nil
+}
+
+// verifyStripeSignature 校验 Stripe-Signature 头，签名内容为 "时间戳.请求体"
+func verifyStripeSignature(header string, body []byte, secret string, now time.Time) error {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	if timestamp == "" || len(signatures) == 0 {
+		return errors.New("stripe: invalid signature header")
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("stripe: invalid signature timestamp")
+	}
+	if diff := now.Sub(time.Unix(ts, 0)); diff > stripeWebhookTolerance || diff < -stripeWebhookTolerance {
+		return errors.New("stripe: signature timestamp outside tolerance")
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	expected := mac.Sum(nil)
+	for _, signature := range signatures {
+		sig, err := hex.DecodeString(signature)
+		if err == nil && hmac.Equal(sig, expected) {
+			return nil
+		}
+	}
+	return errors.New("stripe: signature mismatch")
+}
+
+func (stripePaymentProvider) VerifyWebhook(req *http.Request, body []byte) (*PaymentEvent, error) {
+	err := verifyStripeSignature(req.Header.Get("Stripe-Signature"), body, operation_setting.GetStripeSetting().WebhookSecret, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	var event stripeEvent
+	if err = json.Unmarshal(body, &event); err != nil {
+		return nil, err
+	}
+	switch event.Type {
+	case "checkout.session.completed", "checkout.session.async_payment_succeeded",
+		"checkout.session.async_payment_failed", "checkout.session.expired":
+		var session stripeCheckoutSession
+		if err = json.Unmarshal(event.Data.Object, &session); err != nil {
+			return nil, err
+		}
+		tradeNo := session.ClientReferenceId
+		if tradeNo == "" {
+			tradeNo = session.Metadata["trade_no"]
+		}
+		paymentEvent := &PaymentEvent{
+			Id:              event.Id,
+			Type:            PaymentEventFailed,
+			TradeNo:         tradeNo,
+			ProviderTradeNo: session.PaymentIntent,
+		}
+		if event.Type == "checkout.session.completed" || event.Type == "checkout.session.async_payment_succeeded" {
+			// 银行转账等异步支付方式在 completed 时尚未到账，需等待 async_payment_succeeded
+			if session.PaymentStatus != "paid" {
+				return nil, nil
+			}
+			paymentEvent.Type = PaymentEventPaid
+		}
+		return paymentEvent, nil
+	case "charge.refunded":
+		var charge stripeCharge
+		if err = json.Unmarshal(event.Data.Object, &charge); err != nil {
+			return nil, err
+		}
+		// 部分退款不改变订单状态
+		if !charge.Refunded || charge.PaymentIntent == "" {
+			return nil, nil
+		}
+		return &PaymentEvent{
+			Id:              event.Id,
+			Type:            PaymentEventRefunded,
+			ProviderTradeNo: charge.PaymentIntent,
+		}, nil
+	}
+	return nil, nil
+}
+
+func (stripePaymentProvider) WebhookResponse(ok bool) (int, string) {
+	if ok {
+		return http.StatusOK, ""
+	}
+	return http.StatusBadRequest, ""
+}
+
+func (stripePaymentProvider) Refund(topUp *model.TopUp) error {
+	// 支付完成前 ProviderTradeNo 为 Checkout Session ID，完成后为 PaymentIntent ID
+	if topUp.ProviderTradeNo == "" || strings.HasPrefix(topUp.ProviderTradeNo, "cs_") {
+		return errors.New("订单缺少 Stripe 支付信息，无法退款")
+	}
+	form := url.Values{}
+	form.Set("payment_intent", topUp.ProviderTradeNo)
+	form.Set("metadata[trade_no]", topUp.TradeNo)
+	return stripeRequest("/v1/refunds", form, "refund-"+topUp.TradeNo, nil)
+}
@@ -0,0 +1,226 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/model"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func setupPaymentTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := setupTestDB(t, &model.User{}, &model.TopUp{}, &model.TopUpEvent{}, &model.Log{})
+	oldSecret := constant.FakePaymentSecret
+	constant.FakePaymentSecret = "fake-secret"
+	t.Cleanup(func() { constant.FakePaymentSecret = oldSecret })
+	db.Create(&model.User{Id: 1, Username: "user", AffCode: "aff1"})
+	return db
+}
+
+func createTestTopUp(t *testing.T, db *gorm.DB, tradeNo string) *model.TopUp {
+	t.Helper()
+	topUp := &model.TopUp{
+		UserId:   1,
+		Amount:   10,
+		Money:    10,
+		TradeNo:  tradeNo,
+		Status:   model.TopUpStatusPending,
+		Provider: PaymentProviderFake,
+	}
+	if err := db.Create(topUp).Error; err != nil {
+		t.Fatal(err)
+	}
+	return topUp
+}
+
+// deliverFakeWebhook 模拟支付渠道回调，返回订单状态是否发生变化
+func deliverFakeWebhook(t *testing.T, provider PaymentProvider, event FakePaymentEvent) bool {
+	t.Helper()
+	body, _ := json.Marshal(event)
+	req := httptest.NewRequest("POST", "/api/payment/fake/webhook", bytes.NewReader(body))
+	req.Header.Set("X-Fake-Signature", SignFakePaymentEvent(body))
+	paymentEvent, err := provider.VerifyWebhook(req, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, changed, err := HandlePaymentEvent(PaymentProviderFake, paymentEvent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return changed
+}
+
+func getTestUserQuota(t *testing.T, db *gorm.DB) int {
+	t.Helper()
+	var user model.User
+	if err := db.First(&user, 1).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user.Quota
+}
+
+func TestHandlePaymentEvent(t *testing.T) {
+	quota := int(10 * common.QuotaPerUnit)
+	tests := []struct {
+		name        string
+		events      []FakePaymentEvent
+		wantChanged []bool
+		wantStatus  string
+		wantQuota   int
+	}{
+		{
+			name:        "paid",
+			events:      []FakePaymentEvent{{Id: "evt_1", Type: PaymentEventPaid}},
+			wantChanged: []bool{true},
+			wantStatus:  model.TopUpStatusSuccess,
+			wantQuota:   quota,
+		},
+		{
+			name:        "duplicate event is applied once",
+			events:      []FakePaymentEvent{{Id: "evt_1", Type: PaymentEventPaid}, {Id: "evt_1", Type: PaymentEventPaid}},
+			wantChanged: []bool{true, false},
+			wantStatus:  model.TopUpStatusSuccess,
+			wantQuota:   quota,
+		},
+		{
+			name:        "retried paid event with new id is applied once",
+			events:      []FakePaymentEvent{{Id: "evt_1", Type: PaymentEventPaid}, {Id: "evt_2", Type: PaymentEventPaid}},
+			wantChanged: []bool{true, false},
+			wantStatus:  model.TopUpStatusSuccess,
+			wantQuota:   quota,
+		},
+		{
+			name:        "failure after payment is ignored",
+			events:      []FakePaymentEvent{{Id: "evt_1", Type: PaymentEventPaid}, {Id: "evt_2", Type: PaymentEventFailed}},
+			wantChanged: []bool{true, false},
+			wantStatus:  model.TopUpStatusSuccess,
+			wantQuota:   quota,
+		},
+		{
+			name:        "refund before payment is ignored",
+			events:      []FakePaymentEvent{{Id: "evt_1", Type: PaymentEventRefunded}, {Id: "evt_2", Type: PaymentEventPaid}},
+			wantChanged: []bool{false, true},
+			wantStatus:  model.TopUpStatusSuccess,
+			wantQuota:   quota,
+		},
+		{
+			name:        "refund deducts quota",
+			events:      []FakePaymentEvent{{Id: "evt_1", Type: PaymentEventPaid}, {Id: "evt_2", Type: PaymentEventRefunded}, {Id: "evt_3", Type: PaymentEventRefunded}},
+			wantChanged: []bool{true, true, false},
+			wantStatus:  model.TopUpStatusRefunded,
+			wantQuota:   0,
+		},
+		{
+			name:        "payment after failure is ignored",
+			events:      []FakePaymentEvent{{Id: "evt_1", Type: PaymentEventFailed}, {Id: "evt_2", Type: PaymentEventPaid}},
+			wantChanged: []bool{true, false},
+			wantStatus:  model.TopUpStatusFailed,
+			wantQuota:   0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupPaymentTestDB(t)
+			topUp := createTestTopUp(t, db, "T1")
+			provider := &FakePaymentProvider{}
+			for i, event := range tt.events {
+				event.TradeNo = topUp.TradeNo
+				if changed := deliverFakeWebhook(t, provider, event); changed != tt.wantChanged[i] {
+					t.Errorf("event %d (%s) changed = %v, want %v", i, event.Type, changed, tt.wantChanged[i])
+				}
+			}
+			if got := model.GetTopUpById(topUp.Id).Status; got != tt.wantStatus {
+				t.Errorf("status = %s, want %s", got, tt.wantStatus)
+			}
+			if got := getTestUserQuota(t, db); got != tt.wantQuota {
+				t.Errorf("quota = %d, want %d", got, tt.wantQuota)
+			}
+		})
+	}
+}
+
+func TestFakePaymentWebhookSignature(t *testing.T) {
+	setupPaymentTestDB(t)
+	body := []byte(`{"id":"evt_1","type":"paid","trade_no":"T1"}`)
+	req := httptest.NewRequest("POST", "/api/payment/fake/webhook", bytes.NewReader(body))
+	req.Header.Set("X-Fake-Signature", SignFakePaymentEvent([]byte(`{"id":"evt_1","type":"paid","trade_no":"T2"}`)))
+	if _, err := (&FakePaymentProvider{}).VerifyWebhook(req, body); err == nil {
+		t.Error("tampered body accepted")
+	}
+}
+
+func TestRefundTopUp(t *testing.T) {
+	db := setupPaymentTestDB(t)
+	topUp := createTestTopUp(t, db, "T1")
+	provider := &FakePaymentProvider{}
+	oldProvider := paymentProviders[PaymentProviderFake]
+	RegisterPaymentProvider(PaymentProviderFake, provider)
+	t.Cleanup(func() { RegisterPaymentProvider(PaymentProviderFake, oldProvider) })
+
+	if _, err := RefundTopUp(topUp); err == nil {
+		t.Fatal("pending top up refunded")
+	}
+	deliverFakeWebhook(t, provider, FakePaymentEvent{Id: "evt_1", Type: PaymentEventPaid, TradeNo: "T1"})
+	refunded, err := RefundTopUp(model.GetTopUpById(topUp.Id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refunded.Status != model.TopUpStatusRefunded || len(provider.Refunds) != 1 || provider.Refunds[0] != "T1" {
+		t.Errorf("status = %s, refunds = %v", refunded.Status, provider.Refunds)
+	}
+	if quota := getTestUserQuota(t, db); quota != 0 {
+		t.Errorf("quota = %d after refund", quota)
+	}
+	// 渠道退款回调晚于主动退款到达时不会重复扣除
+	if deliverFakeWebhook(t, provider, FakePaymentEvent{Id: "evt_2", Type: PaymentEventRefunded, TradeNo: "T1"}) {
+		t.Error("refund webhook applied twice")
+	}
+}
+
+func signStripe(body []byte, secret string, timestamp int64) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(fmt.Sprintf("%d.", timestamp)))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyStripeSignature(t *testing.T) {
+	body := []byte(`{"id":"evt_1"}`)
+	secret := "whsec_test"
+	now := time.Unix(1700000000, 0)
+	ts := now.Unix()
+	valid := signStripe(body, secret, ts)
+	tests := []struct {
+		name    string
+		header  string
+		wantErr bool
+	}{
+		{"valid", fmt.Sprintf("t=%d,v1=%s", ts, valid), false},
+		{"one of several signatures valid", fmt.Sprintf("t=%d,v1=%s,v1=%s", ts, signStripe(body, "old", ts), valid), false},
+		{"wrong secret", fmt.Sprintf("t=%d,v1=%s", ts, signStripe(body, "other", ts)), true},
+		{"signature from other timestamp", fmt.Sprintf("t=%d,v1=%s", ts+1, valid), true},
+		{"timestamp too old", fmt.Sprintf("t=%d,v1=%s", ts-600, signStripe(body, secret, ts-600)), true},
+		{"timestamp in future", fmt.Sprintf("t=%d,v1=%s", ts+600, signStripe(body, secret, ts+600)), true},
+		{"missing timestamp", "v1=" + valid, true},
+		{"missing signature", fmt.Sprintf("t=%d", ts), true},
+		{"invalid hex", fmt.Sprintf("t=%d,v1=zz", ts), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyStripeSignature(tt.header, body, secret, now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
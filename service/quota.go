@@ -74,11 +74,28 @@ func calculateAudioQuota(info QuotaInfo) int {
 	return int(quota.Round(0).IntPart())
 }
 
+// GetAvailableQuota 返回计费主体可用于扣费的额度。预付费和后付费使用相同的余额扣减方式，
+// 后付费用户的余额可以透支到授信额度，因此可用额度为余额加授信额度
+func GetAvailableQuota(userId int, orgId int) (int, error) {
+	quota, err := model.GetBillingQuota(userId, orgId)
+	if err != nil || orgId != 0 {
+		return quota, err
+	}
+	account, err := model.GetCreditAccount(userId)
+	if err != nil {
+		return 0, err
+	}
+	if account.IsPostpaid() {
+		quota += account.CreditLimit
+	}
+	return quota, nil
+}
+
 func PreWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage *dto.RealtimeUsage) error {
 	if relayInfo.UsePrice {
 		return nil
 	}
-	userQuota, err := model.GetUserQuota(relayInfo.UserId, false)
+	userQuota, err := GetAvailableQuota(relayInfo.UserId, relayInfo.OrgId)
 	if err != nil {
 		return err
 	}
@@ -132,6 +149,8 @@ func PreWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usag
 func PostWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, modelName string,
 	usage *dto.RealtimeUsage, preConsumedQuota int, userQuota int, modelRatio float64, groupRatio float64,
 	modelPrice float64, usePrice bool, extraContent string) {
+	_, span := common.StartSpan(ctx.Request.Context(), "billing")
+	defer span.End()
 
 	useTimeSeconds := time.Now().Unix() - relayInfo.StartTime.Unix()
 	textInputTokens := usage.InputTokenDetails.TextTokens
@@ -196,6 +215,8 @@ func PostWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, mod
 
 func PostClaudeConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 	usage *dto.Usage, preConsumedQuota int, userQuota int, priceData helper.PriceData, extraContent string) {
+	_, span := common.StartSpan(ctx.Request.Context(), "billing")
+	defer span.End()
 
 	useTimeSeconds := time.Now().Unix() - relayInfo.StartTime.Unix()
 	promptTokens := usage.PromptTokens
@@ -263,6 +284,8 @@ func PostClaudeConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 
 func PostAudioConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 	usage *dto.Usage, preConsumedQuota int, userQuota int, priceData helper.PriceData, extraContent string) {
+	_, span := common.StartSpan(ctx.Request.Context(), "billing")
+	defer span.End()
 
 	useTimeSeconds := time.Now().Unix() - relayInfo.StartTime.Unix()
 	textInputTokens := usage.PromptTokensDetails.TextTokens
@@ -355,19 +378,28 @@ func PreConsumeTokenQuota(relayInfo *relaycommon.RelayInfo, quota int) error {
 	if !relayInfo.TokenUnlimited && token.RemainQuota < quota {
 		return fmt.Errorf("token quota is not enough, token remain quota: %s, need quota: %s", common.FormatQuota(token.RemainQuota), common.FormatQuota(quota))
 	}
+	// 鉴权后预算可能已被同一令牌的其他请求用尽
+	if relayInfo.TokenBudgetEnabled {
+		if err = model.CheckTokenBudget(token); err != nil {
+			return err
+		}
+	}
 	err = model.DecreaseTokenQuota(relayInfo.TokenId, relayInfo.TokenKey, quota)
 	if err != nil {
 		return err
 	}
+	if relayInfo.TokenBudgetEnabled {
+		model.RecordTokenBudgetUsage(relayInfo.TokenId, quota)
+	}
 	return nil
 }
 
 func PostConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQuota int, sendEmail bool) (err error) {
 
 	if quota > 0 {
-		err = model.DecreaseUserQuota(relayInfo.UserId, quota)
+		err = model.DecreaseBillingQuota(relayInfo.UserId, relayInfo.OrgId, quota)
 	} else {
-		err = model.IncreaseUserQuota(relayInfo.UserId, -quota, false)
+		err = model.IncreaseBillingQuota(relayInfo.UserId, relayInfo.OrgId, -quota)
 	}
 	if err != nil {
 		return err
@@ -382,9 +414,13 @@ func PostConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQu
 		if err != nil {
 			return err
 		}
+		if relayInfo.TokenBudgetEnabled {
+			model.RecordTokenBudgetUsage(relayInfo.TokenId, quota)
+		}
 	}
 
-	if sendEmail {
+	// 组织令牌消耗的是组织额度，不向个人发送余额提醒
+	if sendEmail && relayInfo.OrgId == 0 {
 		if (quota + preConsumedQuota) != 0 {
 			checkAndSendQuotaNotify(relayInfo, quota, preConsumedQuota)
 		}
@@ -395,6 +431,13 @@ func PostConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQu
 
 func checkAndSendQuotaNotify(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQuota int) {
 	gopool.Go(func() {
+		// 后付费用户按授信额度的使用比例提醒，账户信息来自缓存，阈值或暂停状态可能变化时才刷新
+		if account, err := model.GetCreditAccount(relayInfo.UserId); err == nil && account.IsPostpaid() {
+			if account.NeedsRefresh(relayInfo.UserQuota - quota - preConsumedQuota) {
+				CheckCreditAccount(relayInfo.UserId, false)
+			}
+			return
+		}
 		userSetting := relayInfo.UserSetting
 		threshold := common.QuotaRemindThreshold
 		if userCustomThreshold, ok := userSetting[constant2.UserSettingQuotaWarningThreshold]; ok {
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"one-api/common"
+	"one-api/dto"
+	"one-api/setting/operation_setting"
+	"sync"
+	"time"
+)
+
+const responseCacheKeyPrefix = "response_cache:"
+
+// ResponseCacheEntry 缓存的响应内容，流式响应保存原始的 SSE 数据
+type ResponseCacheEntry struct {
+	IsStream    bool      `json:"is_stream"`
+	ContentType string    `json:"content_type"`
+	Body        []byte    `json:"body"`
+	Usage       dto.Usage `json:"usage"`
+	CreatedAt   int64     `json:"created_at"`
+}
+
+type memoryCacheItem struct {
+	key       string
+	entry     *ResponseCacheEntry
+	expiresAt time.Time
+}
+
+// responseMemoryCache 未启用 Redis 时使用的 LRU 缓存
+var responseMemoryCache = struct {
+	sync.Mutex
+	items map[string]*list.Element
+	order *list.List
+}{
+	items: make(map[string]*list.Element),
+	order: list.New(),
+}
+
+// GenerateResponseCacheKey 根据分组、模型、请求类型和规范化后的请求体生成缓存键
+func GenerateResponseCacheKey(group string, model string, relayMode int, body []byte) (string, error) {
+	var request any
+	if err := json.Unmarshal(body, &request); err != nil {
+		return "", err
+	}
+	// 重新序列化以消除字段顺序和空白字符的差异
+	normalized, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	hash.Write([]byte(fmt.Sprintf("%s\n%s\n%d\n", group, model, relayMode)))
+	hash.Write(normalized)
+	return responseCacheKeyPrefix + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func GetResponseCache(key string) (*ResponseCacheEntry, bool) {
+	if common.RedisEnabled {
+		value, err := common.RedisGet(key)
+		if err != nil {
+			return nil, false
+		}
+		entry := &ResponseCacheEntry{}
+		if err := json.Unmarshal([]byte(value), entry); err != nil {
+			common.SysError("failed to unmarshal response cache: " + err.Error())
+			return nil, false
+		}
+		return entry, true
+	}
+	responseMemoryCache.Lock()
+	defer responseMemoryCache.Unlock()
+	element, ok := responseMemoryCache.items[key]
+	if !ok {
+		return nil, false
+	}
+	item := element.Value.(*memoryCacheItem)
+	if time.Now().After(item.expiresAt) {
+		responseMemoryCache.order.Remove(element)
+		delete(responseMemoryCache.items, key)
+		return nil, false
+	}
+	responseMemoryCache.order.MoveToFront(element)
+	return item.entry, true
+}
+
+func SetResponseCache(key string, entry *ResponseCacheEntry, ttl time.Duration) {
+	if common.RedisEnabled {
+		value, err := json.Marshal(entry)
+		if err != nil {
+			common.SysError("failed to marshal response cache: " + err.Error())
+			return
+		}
+		if err := common.RedisSet(key, string(value), ttl); err != nil {
+			common.SysError("failed to set response cache: " + err.Error())
+		}
+		return
+	}
+	maxEntries := operation_setting.GetResponseCacheSetting().MaxMemoryEntries
+	if maxEntries <= 0 {
+		return
+	}
+	responseMemoryCache.Lock()
+	defer responseMemoryCache.Unlock()
+	item := &memoryCacheItem{
+		key:       key,
+		entry:     entry,
+		expiresAt: time.Now().Add(ttl),
+	}
+	if element, ok := responseMemoryCache.items[key]; ok {
+		element.Value = item
+		responseMemoryCache.order.MoveToFront(element)
+	} else {
+		responseMemoryCache.items[key] = responseMemoryCache.order.PushFront(item)
+	}
+	for responseMemoryCache.order.Len() > maxEntries {
+		oldest := responseMemoryCache.order.Back()
+		responseMemoryCache.order.Remove(oldest)
+		delete(responseMemoryCache.items, oldest.Value.(*memoryCacheItem).key)
+	}
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"one-api/common"
+	"one-api/setting/operation_setting"
+	"testing"
+	"time"
+)
+
+func TestGenerateResponseCacheKey(t *testing.T) {
+	base, err := GenerateResponseCacheKey("default", "gpt-4o", 1, []byte(`{"model":"gpt-4o","temperature":0,"messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		group     string
+		model     string
+		relayMode int
+		body      string
+		same      bool
+	}{
+		{"field order and whitespace", "default", "gpt-4o", 1, `{ "messages": [ {"content":"hi", "role":"user"} ], "temperature": 0, "model": "gpt-4o" }`, true},
+		{"different group", "vip", "gpt-4o", 1, `{"model":"gpt-4o","temperature":0,"messages":[{"role":"user","content":"hi"}]}`, false},
+		{"different model", "default", "gpt-4o-mini", 1, `{"model":"gpt-4o","temperature":0,"messages":[{"role":"user","content":"hi"}]}`, false},
+		{"different relay mode", "default", "gpt-4o", 2, `{"model":"gpt-4o","temperature":0,"messages":[{"role":"user","content":"hi"}]}`, false},
+		{"different content", "default", "gpt-4o", 1, `{"model":"gpt-4o","temperature":0,"messages":[{"role":"user","content":"hello"}]}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := GenerateResponseCacheKey(tt.group, tt.model, tt.relayMode, []byte(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (key == base) != tt.same {
+				t.Errorf("key == base is %v, want %v", key == base, tt.same)
+			}
+		})
+	}
+	if _, err = GenerateResponseCacheKey("default", "gpt-4o", 1, []byte(`{`)); err == nil {
+		t.Error("invalid body produced a key")
+	}
+}
+
+func TestResponseMemoryCache(t *testing.T) {
+	cacheSetting := operation_setting.GetResponseCacheSetting()
+	oldMaxEntries, oldRedis := cacheSetting.MaxMemoryEntries, common.RedisEnabled
+	cacheSetting.MaxMemoryEntries, common.RedisEnabled = 2, false
+	t.Cleanup(func() { cacheSetting.MaxMemoryEntries, common.RedisEnabled = oldMaxEntries, oldRedis })
+
+	SetResponseCache("test:expired", &ResponseCacheEntry{Body: []byte("expired")}, -time.Second)
+	if _, ok := GetResponseCache("test:expired"); ok {
+		t.Error("expired entry returned")
+	}
+
+	SetResponseCache("test:a", &ResponseCacheEntry{Body: []byte("a")}, time.Minute)
+	SetResponseCache("test:b", &ResponseCacheEntry{Body: []byte("b")}, time.Minute)
+	// 读取 a 使 b 成为最久未使用的条目
+	if entry, ok := GetResponseCache("test:a"); !ok || string(entry.Body) != "a" {
+		t.Fatalf("entry a = %+v, %v", entry, ok)
+	}
+	SetResponseCache("test:c", &ResponseCacheEntry{Body: []byte("c")}, time.Minute)
+	tests := []struct {
+		key string
+		ok  bool
+	}{
+		{"test:a", true},
+		{"test:b", false},
+		{"test:c", true},
+	}
+	for _, tt := range tests {
+		if _, ok := GetResponseCache(tt.key); ok != tt.ok {
+			t.Errorf("GetResponseCache(%s) ok = %v, want %v", tt.key, ok, tt.ok)
+		}
+	}
+
+	cacheSetting.MaxMemoryEntries = 0
+	SetResponseCache("test:disabled", &ResponseCacheEntry{Body: []byte("d")}, time.Minute)
+	if _, ok := GetResponseCache("test:disabled"); ok {
+		t.Error("entry stored with max_memory_entries = 0")
+	}
+}
@@ -17,7 +17,7 @@ func CheckSensitiveMessages(messages []dto.Message) ([]string, error) {
 		arrayContent := message.ParseContent()
 		for _, m := range arrayContent {
 			if m.Type == "image_url" {
-				// TODO: check image url
+				// 敏感词只检查文本，图片由内容审核管道的 openai 规则检查
 				continue
 			}
 			// 检查 text 是否为空
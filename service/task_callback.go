@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/model"
+	"syscall"
+	"time"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	taskCallbackMaxAttempts   = 6
+	taskCallbackRetryInterval = 30 * time.Second
+	taskCallbackBatchSize     = 100
+	taskCallbackTimeout       = 5 * time.Second
+)
+
+// callbackBlockedNets IsPrivate 等方法未覆盖的保留网段
+var callbackBlockedNets = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range []string{"0.0.0.0/8", "100.64.0.0/10", "192.0.0.0/24", "198.18.0.0/15", "240.0.0.0/4"} {
+		_, ipNet, _ := net.ParseCIDR(cidr)
+		nets = append(nets, ipNet)
+	}
+	return nets
+}()
+
+// callbackHttpClient 投递任务回调的客户端，不使用代理，并在建立连接时再次检查目标地址，防止 DNS 重绑定和重定向绕过校验
+var callbackHttpClient = &http.Client{
+	Timeout: taskCallbackTimeout,
+	Transport: &http.Transport{
+		Proxy: nil,
+		DialContext: (&net.Dialer{
+			Timeout: taskCallbackTimeout,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if !isPublicCallbackIP(net.ParseIP(host)) {
+					return fmt.Errorf("callback address %s is not allowed", host)
+				}
+				return nil
+			},
+		}).DialContext,
+	},
+}
+
+// isPublicCallbackIP 回调只允许投递到公网地址，拒绝回环、内网、链路本地（包括云厂商元数据地址 169.254.169.254）等地址
+func isPublicCallbackIP(ip net.IP) bool {
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	for _, ipNet := range callbackBlockedNets {
+		if ipNet.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// TaskCallbackPayload 异步任务完成回调的负载，使用用户的 webhook 密钥签名，未设置时使用提交任务的令牌（sk- 开头的完整密钥）签名
+type TaskCallbackPayload struct {
+	Type       string          `json:"type"`
+	TaskID     string          `json:"task_id"`
+	Platform   string          `json:"platform"`
+	Action     string          `json:"action"`
+	Status     string          `json:"status"`
+	FailReason string          `json:"fail_reason,omitempty"`
+	SubmitTime int64           `json:"submit_time"`
+	FinishTime int64           `json:"finish_time"`
+	Data       json.RawMessage `json:"data,omitempty"`
+	Timestamp  int64           `json:"timestamp"`
+}
+
+// ValidateCallbackUrl 回调地址只允许 http 和 https，且解析出的地址都必须是公网地址
+func ValidateCallbackUrl(callbackUrl string) error {
+	if callbackUrl == "" {
+		return nil
+	}
+	u, err := url.ParseRequestURI(callbackUrl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return errors.New("无效的回调地址")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), taskCallbackTimeout)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", u.Hostname())
+	if err != nil || len(ips) == 0 {
+		return errors.New("无法解析回调地址")
+	}
+	for _, ip := range ips {
+		if !isPublicCallbackIP(ip) {
+			return errors.New("回调地址不能指向内网地址")
+		}
+	}
+	return nil
+}
+
+// NotifyTaskFinished 任务成功或失败后投递回调，回调地址优先取任务提交时指定的地址，其次为令牌配置的地址
+func NotifyTaskFinished(task *model.Task) {
+	if task.Status != model.TaskStatusSuccess && task.Status != model.TaskStatusFailure {
+		return
+	}
+	callbackUrl := task.Properties.CallbackUrl
+	if callbackUrl == "" && task.TokenId != 0 {
+		token, err := model.GetTokenById(task.TokenId)
+		if err == nil {
+			callbackUrl = token.CallbackUrl
+		}
+	}
+	if callbackUrl == "" {
+		return
+	}
+
+	eventType := "task.succeeded"
+	if task.Status == model.TaskStatusFailure {
+		eventType = "task.failed"
+	}
+	payload, err := json.Marshal(TaskCallbackPayload{
+		Type:       eventType,
+		TaskID:     task.TaskID,
+		Platform:   string(task.Platform),
+		Action:     task.Action,
+		Status:     string(task.Status),
+		FailReason: task.FailReason,
+		SubmitTime: task.SubmitTime,
+		FinishTime: task.FinishTime,
+		Data:       task.Data,
+		Timestamp:  time.Now().Unix(),
+	})
+	if err != nil {
+		common.SysError("failed to marshal task callback payload: " + err.Error())
+		return
+	}
+	now := common.GetTimestamp()
+	callback := &model.TaskCallback{
+		CreatedAt: now,
+		UpdatedAt: now,
+		UserId:    task.UserId,
+		TokenId:   task.TokenId,
+		TaskID:    task.TaskID,
+		Url:       callbackUrl,
+		Payload:   string(payload),
+		Status:    model.TaskCallbackStatusPending,
+		// 首次投递立即进行，推迟重试时间避免重试协程同时投递
+		NextAttemptAt: now + int64(taskCallbackRetryInterval.Seconds()),
+	}
+	err = callback.Insert()
+	if err != nil {
+		common.SysError("failed to insert task callback: " + err.Error())
+		return
+	}
+	gopool.Go(func() {
+		deliverTaskCallback(callback)
+	})
+}
+
+func deliverTaskCallback(callback *model.TaskCallback) {
+	var secret string
+	userSetting, err := model.GetUserSetting(callback.UserId, false)
+	if err == nil {
+		if value, ok := userSetting[constant.UserSettingWebhookSecret]; ok {
+			secret, _ = value.(string)
+		}
+	}
+
+	if secret == "" && callback.TokenId != 0 {
+		token, err := model.GetTokenById(callback.TokenId)
+		if err == nil {
+			secret = "sk-" + token.Key
+		}
+	}
+
+	statusCode, err := postWebhook(callbackHttpClient, callback.Url, secret, []byte(callback.Payload))
+	callback.Attempts++
+	callback.StatusCode = statusCode
+	if err == nil {
+		callback.Status = model.TaskCallbackStatusSuccess
+		callback.LastError = ""
+	} else {
+		callback.LastError = err.Error()
+		if callback.Attempts >= taskCallbackMaxAttempts {
+			callback.Status = model.TaskCallbackStatusFailed
+		} else {
+			// 指数退避：30s、60s、120s...
+			delay := taskCallbackRetryInterval << (callback.Attempts - 1)
+			callback.NextAttemptAt = common.GetTimestamp() + int64(delay.Seconds())
+		}
+	}
+	err = callback.Update()
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to update task callback %d: %s", callback.ID, err.Error()))
+	}
+}
+
+// RetryTaskCallbacks 定期重试投递失败的任务回调
+func RetryTaskCallbacks() {
+	for {
+		time.Sleep(taskCallbackRetryInterval)
+		callbacks, err := model.GetDueTaskCallbacks(common.GetTimestamp(), taskCallbackBatchSize)
+		if err != nil {
+			common.SysError("failed to get task callbacks: " + err.Error())
+			continue
+		}
+		for _, callback := range callbacks {
+			deliverTaskCallback(callback)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"one-api/model"
+	"testing"
+)
+
+func TestIsPublicCallbackIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"8.8.8.8", true},
+		{"2606:4700::1111", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"0.0.0.0", false},
+		{"100.64.0.1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:169.254.169.254", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := isPublicCallbackIP(net.ParseIP(tt.ip)); got != tt.want {
+				t.Errorf("isPublicCallbackIP(%s) = %v, want %v", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateCallbackUrl(t *testing.T) {
+	tests := []struct {
+		url     string
+		wantErr bool
+	}{
+		{"", false},
+		{"https://8.8.8.8/callback", false},
+		{"http://8.8.8.8:8080/callback?a=1", false},
+		{"ftp://8.8.8.8/callback", true},
+		{"not a url", true},
+		{"http://127.0.0.1/callback", true},
+		{"http://169.254.169.254/latest/meta-data", true},
+		{"http://[::1]:3000/callback", true},
+		{"http://10.0.0.1/callback", true},
+		{"http://localhost/callback", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := ValidateCallbackUrl(tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateCallbackUrl(%q) error = %v, wantErr %v", tt.url, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCallbackClientRefusesPrivateAddressAtDial(t *testing.T) {
+	hit := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit = true
+	}))
+	defer server.Close()
+
+	// 模拟校验通过后域名被重新解析到内网地址
+	_, err := postWebhook(callbackHttpClient, server.URL, "", []byte(`{}`))
+	if err == nil || hit {
+		t.Fatalf("callback to %s was delivered, err = %v", server.URL, err)
+	}
+}
+
+func TestDeliverTaskCallbackSignsWithTokenKey(t *testing.T) {
+	db := setupTestDB(t, &model.User{}, &model.Token{}, &model.TaskCallback{})
+	oldClient := callbackHttpClient
+	defer func() { callbackHttpClient = oldClient }()
+
+	user := &model.User{Username: "callback-user", Password: "password"}
+	db.Create(user)
+	token := &model.Token{UserId: user.Id, Key: "callback-token-key", Name: "t"}
+	db.Create(token)
+
+	var signature string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signature = r.Header.Get("X-Webhook-Signature")
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+	callbackHttpClient = server.Client()
+
+	callback := &model.TaskCallback{UserId: user.Id, TokenId: token.Id, TaskID: "task", Url: server.URL,
+		Payload: `{"task_id":"task"}`, Status: model.TaskCallbackStatusPending}
+	db.Create(callback)
+	deliverTaskCallback(callback)
+
+	if callback.Status != model.TaskCallbackStatusSuccess {
+		t.Fatalf("status = %s, error = %s", callback.Status, callback.LastError)
+	}
+	if want := generateSignature("sk-"+token.Key, body); signature != want {
+		t.Errorf("signature = %q, want %q", signature, want)
+	}
+}
@@ -0,0 +1,37 @@
+package model_setting
+
+import (
+	"one-api/setting/config"
+)
+
+// FallbackSettings 定义模型降级链，某个模型的所有渠道都失败后按顺序尝试链上的模型
+type FallbackSettings struct {
+	Enabled bool                `json:"enabled"`
+	Chains  map[string][]string `json:"chains"`
+}
+
+// 默认配置
+var defaultFallbackSettings = FallbackSettings{
+	Enabled: false,
+	Chains:  map[string][]string{},
+}
+
+// 全局实例
+var fallbackSettings = defaultFallbackSettings
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("model_fallback", &fallbackSettings)
+}
+
+func GetFallbackSettings() *FallbackSettings {
+	return &fallbackSettings
+}
+
+// GetChain 返回模型的降级链，未启用或未配置时返回 nil
+func (s *FallbackSettings) GetChain(model string) []string {
+	if !s.Enabled || s.Chains == nil {
+		return nil
+	}
+	return s.Chains[model]
+}
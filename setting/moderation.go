@@ -0,0 +1,113 @@
+package setting
+
+import (
+	"one-api/setting/config"
+	"slices"
+	"strings"
+)
+
+const (
+	ModerationProviderKeyword = "keyword"
+	ModerationProviderRegex   = "regex"
+	ModerationProviderOpenAI  = "openai"
+)
+
+const (
+	// ModerationActionBlock 拒绝请求，流式响应中以 content_filter 结束生成
+	ModerationActionBlock = "block"
+	// ModerationActionRedact 将命中的内容替换为 **###**
+	ModerationActionRedact = "redact"
+	// ModerationActionLog 仅记录审核日志
+	ModerationActionLog = "log"
+)
+
+const (
+	ModerationStagePrompt     = "prompt"
+	ModerationStageCompletion = "completion"
+)
+
+// ModerationRule 一条审核规则，按顺序执行
+type ModerationRule struct {
+	Name string `json:"name"`
+	// Provider 审核方式：keyword、regex 或 openai
+	Provider string `json:"provider"`
+	// Action 命中后的处理方式：block、redact 或 log
+	Action string `json:"action"`
+	// Words keyword 规则的关键词，为空时使用敏感词列表
+	Words []string `json:"words,omitempty"`
+	// Patterns regex 规则的正则表达式
+	Patterns []string `json:"patterns,omitempty"`
+	// Model openai 规则调用的审核模型，例如 omni-moderation-latest
+	Model string `json:"model,omitempty"`
+	// ChannelId openai 规则使用的渠道，为 0 时按请求分组选择支持该模型的渠道，只支持 OpenAI 类型渠道
+	ChannelId int `json:"channel_id,omitempty"`
+	// Threshold openai 规则的分类分数阈值，为 0 时使用接口返回的 flagged
+	Threshold float64 `json:"threshold,omitempty"`
+	// Stages 检查的阶段：prompt、completion，为空时只检查 prompt
+	Stages []string `json:"stages,omitempty"`
+	// Groups 生效的分组，为空时对所有分组生效
+	Groups []string `json:"groups,omitempty"`
+	// Models 生效的模型，支持 * 结尾的前缀匹配，为空时对所有模型生效
+	Models []string `json:"models,omitempty"`
+}
+
+// Match 判断规则是否对指定阶段、分组和模型生效
+func (r *ModerationRule) Match(stage string, group string, modelName string) bool {
+	stages := r.Stages
+	if len(stages) == 0 {
+		stages = []string{ModerationStagePrompt}
+	}
+	if !slices.Contains(stages, stage) {
+		return false
+	}
+	if len(r.Groups) > 0 && !slices.Contains(r.Groups, group) {
+		return false
+	}
+	if len(r.Models) == 0 {
+		return true
+	}
+	for _, m := range r.Models {
+		if m == modelName || (strings.HasSuffix(m, "*") && strings.HasPrefix(modelName, strings.TrimSuffix(m, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// ModerationSetting 内容审核管道配置，与敏感词检查相互独立
+type ModerationSetting struct {
+	Enabled bool `json:"enabled"`
+	// StreamCheckChars 流式响应每累计多少字符审核一次，审核前的内容暂不返回给客户端
+	StreamCheckChars int              `json:"stream_check_chars"`
+	Rules            []ModerationRule `json:"rules"`
+}
+
+// 默认配置
+var moderationSetting = ModerationSetting{
+	Enabled:          false,
+	StreamCheckChars: 100,
+	Rules:            []ModerationRule{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("moderation", &moderationSetting)
+}
+
+func GetModerationSetting() *ModerationSetting {
+	return &moderationSetting
+}
+
+// GetModerationRules 返回对指定阶段、分组和模型生效的规则
+func GetModerationRules(stage string, group string, modelName string) []*ModerationRule {
+	if !moderationSetting.Enabled {
+		return nil
+	}
+	var rules []*ModerationRule
+	for i := range moderationSetting.Rules {
+		if moderationSetting.Rules[i].Match(stage, group, modelName) {
+			rules = append(rules, &moderationSetting.Rules[i])
+		}
+	}
+	return rules
+}
@@ -0,0 +1,23 @@
+package operation_setting
+
+import "one-api/setting/config"
+
+// AuditSetting 管理操作审计记录配置
+type AuditSetting struct {
+	// RetentionDays 审计记录保留天数，0 表示永久保留
+	RetentionDays int `json:"retention_days"`
+}
+
+// 默认配置
+var auditSetting = AuditSetting{
+	RetentionDays: 365,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("audit", &auditSetting)
+}
+
+func GetAuditSetting() *AuditSetting {
+	return &auditSetting
+}
@@ -0,0 +1,35 @@
+package operation_setting
+
+import "one-api/setting/config"
+
+// BillingStatementSetting 月度账单配置
+type BillingStatementSetting struct {
+	// Enabled 每月初自动为上月有消费或充值的用户生成账单
+	Enabled bool `json:"enabled"`
+	// InvoicePrefix 账单编号前缀，编号格式为 前缀 + 年月 + "-" + 当月序号
+	InvoicePrefix string `json:"invoice_prefix"`
+	// InvoiceNumberDigits 当月序号的位数，不足时补零
+	InvoiceNumberDigits int    `json:"invoice_number_digits"`
+	CompanyName         string `json:"company_name"`
+	CompanyAddress      string `json:"company_address"`
+	CompanyTaxId        string `json:"company_tax_id"`
+	CompanyEmail        string `json:"company_email"`
+	// Footer 显示在账单底部的说明
+	Footer string `json:"footer"`
+}
+
+// 默认配置
+var billingStatementSetting = BillingStatementSetting{
+	Enabled:             true,
+	InvoicePrefix:       "INV-",
+	InvoiceNumberDigits: 6,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("billing_statement", &billingStatementSetting)
+}
+
+func GetBillingStatementSetting() *BillingStatementSetting {
+	return &billingStatementSetting
+}
@@ -0,0 +1,44 @@
+package operation_setting
+
+import "one-api/setting/config"
+
+// ChannelHealthSetting 渠道健康度统计与熔断配置，统计数据保存在各节点内存中
+type ChannelHealthSetting struct {
+	// CircuitBreakerEnabled 错误率超过阈值时熔断渠道，熔断期间不再分配流量
+	CircuitBreakerEnabled bool `json:"circuit_breaker_enabled"`
+	// WindowSeconds 滑动窗口长度
+	WindowSeconds int `json:"window_seconds"`
+	// MinRequests 窗口内请求数达到该值才会计算错误率
+	MinRequests int `json:"min_requests"`
+	// ErrorRateThreshold 触发熔断的错误率，0-1
+	ErrorRateThreshold float64 `json:"error_rate_threshold"`
+	// CooldownSeconds 熔断后等待多久进入半开状态
+	CooldownSeconds int `json:"cooldown_seconds"`
+	// HalfOpenRequests 半开状态下允许通过的探测请求数
+	HalfOpenRequests int `json:"half_open_requests"`
+	// LatencyWeightEnabled 根据首字时间降低慢渠道的有效权重
+	LatencyWeightEnabled bool `json:"latency_weight_enabled"`
+	// LatencyTargetMs 首字时间超过该值的渠道按比例降低权重
+	LatencyTargetMs int `json:"latency_target_ms"`
+}
+
+// 默认配置
+var channelHealthSetting = ChannelHealthSetting{
+	CircuitBreakerEnabled: false,
+	WindowSeconds:         60,
+	MinRequests:           10,
+	ErrorRateThreshold:    0.5,
+	CooldownSeconds:       30,
+	HalfOpenRequests:      1,
+	LatencyWeightEnabled:  false,
+	LatencyTargetMs:       5000,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("channel_health", &channelHealthSetting)
+}
+
+func GetChannelHealthSetting() *ChannelHealthSetting {
+	return &channelHealthSetting
+}
@@ -0,0 +1,29 @@
+package operation_setting
+
+import "one-api/setting/config"
+
+// CreditSetting 后付费授信账户配置
+type CreditSetting struct {
+	// NotifyThresholds 透支额度达到授信额度的这些百分比时提醒用户，每个阈值只提醒一次，还款后重新计算
+	NotifyThresholds []int `json:"notify_thresholds"`
+	// PaymentTermDays 账单生成后的付款期限，账户未单独设置时使用
+	PaymentTermDays int `json:"payment_term_days"`
+	// SuspendOnOverdue 账单逾期未付时自动暂停账户
+	SuspendOnOverdue bool `json:"suspend_on_overdue"`
+}
+
+// 默认配置
+var creditSetting = CreditSetting{
+	NotifyThresholds: []int{50, 80, 100},
+	PaymentTermDays:  15,
+	SuspendOnOverdue: true,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("credit", &creditSetting)
+}
+
+func GetCreditSetting() *CreditSetting {
+	return &creditSetting
+}
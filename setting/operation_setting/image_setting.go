@@ -0,0 +1,48 @@
+package operation_setting
+
+import "one-api/setting/config"
+
+// ImageSetting 图片生成、编辑和变体接口的按尺寸计费和上传限制
+type ImageSetting struct {
+	// SizeRatios 各尺寸相对 1024x1024 的价格倍率，未配置的尺寸按 1 计费
+	SizeRatios map[string]float64 `json:"size_ratios"`
+	// ModelSizeRatios 指定模型的尺寸倍率，优先于 SizeRatios
+	ModelSizeRatios map[string]map[string]float64 `json:"model_size_ratios"`
+	// MaxUploadSizeMB 编辑和变体接口上传的单张图片大小上限，dall-e-2 固定为 4MB
+	MaxUploadSizeMB int `json:"max_upload_size_mb"`
+}
+
+// 默认配置
+var imageSetting = ImageSetting{
+	SizeRatios: map[string]float64{
+		"256x256":   0.4,
+		"512x512":   0.45,
+		"1024x1024": 1,
+		"1024x1792": 2,
+		"1792x1024": 2,
+	},
+	ModelSizeRatios: map[string]map[string]float64{},
+	MaxUploadSizeMB: 25,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("image", &imageSetting)
+}
+
+func GetImageSetting() *ImageSetting {
+	return &imageSetting
+}
+
+// GetSizeRatio 返回模型指定尺寸的价格倍率
+func (s *ImageSetting) GetSizeRatio(model string, size string) float64 {
+	if ratios, ok := s.ModelSizeRatios[model]; ok {
+		if ratio, ok := ratios[size]; ok {
+			return ratio
+		}
+	}
+	if ratio, ok := s.SizeRatios[size]; ok {
+		return ratio
+	}
+	return 1
+}
@@ -213,6 +213,15 @@ var defaultModelRatio = map[string]float64{
 var defaultModelPrice = map[string]float64{
 	"suno_music":              0.1,
 	"suno_lyrics":             0.01,
+	"kling-v1":                0.14,
+	"kling-v1-5":              0.28,
+	"kling-v1-6":              0.28,
+	"kling-v2-master":         1,
+	"gen3a_turbo":             0.25,
+	"gen4_turbo":              0.25,
+	"ray-2":                   0.5,
+	"ray-flash-2":             0.2,
+	"ray-1-6":                 0.35,
 	"dall-e-3":                0.04,
 	"imagen-3.0-generate-002": 0.03,
 	"gpt-4-gizmo-*":           0.1,
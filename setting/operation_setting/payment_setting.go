@@ -0,0 +1,31 @@
+package operation_setting
+
+import "one-api/setting/config"
+
+// StripeSetting Stripe Checkout 支付配置，ApiBase 可指向兼容 Stripe 接口的服务
+type StripeSetting struct {
+	Enabled       bool   `json:"enabled"`
+	SecretKey     string `json:"secret_key"`
+	WebhookSecret string `json:"webhook_secret"`
+	// Currency 结算货币，ISO 4217 代码
+	Currency string `json:"currency"`
+	// UnitPrice 每单位额度（即 1 美元额度）的价格，按 Currency 计价
+	UnitPrice float64 `json:"unit_price"`
+	ApiBase   string  `json:"api_base"`
+}
+
+// 默认配置
+var stripeSetting = StripeSetting{
+	Currency:  "usd",
+	UnitPrice: 1,
+	ApiBase:   "https://api.stripe.com",
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("stripe", &stripeSetting)
+}
+
+func GetStripeSetting() *StripeSetting {
+	return &stripeSetting
+}
@@ -0,0 +1,51 @@
+package operation_setting
+
+import "one-api/setting/config"
+
+// ResponseCacheSetting 精确匹配的响应缓存配置，只缓存 temperature 为 0 的对话请求和向量请求
+type ResponseCacheSetting struct {
+	Enabled bool `json:"enabled"`
+	// DefaultTTLSeconds 开启缓存的令牌使用的缓存时间
+	DefaultTTLSeconds int `json:"default_ttl_seconds"`
+	// ModelTTLSeconds 对所有令牌开启缓存的模型及其缓存时间，设置为 0 表示该模型不缓存
+	ModelTTLSeconds map[string]int `json:"model_ttl_seconds"`
+	// MaxEntrySizeKB 单条缓存的最大响应大小，超过时不缓存
+	MaxEntrySizeKB int `json:"max_entry_size_kb"`
+	// MaxMemoryEntries 未启用 Redis 时内存中最多保留的缓存条数
+	MaxMemoryEntries int `json:"max_memory_entries"`
+	// BillingRatio 命中缓存时按原始额度的该比例计费
+	BillingRatio float64 `json:"billing_ratio"`
+}
+
+// 默认配置
+var responseCacheSetting = ResponseCacheSetting{
+	Enabled:           false,
+	DefaultTTLSeconds: 3600,
+	ModelTTLSeconds:   map[string]int{},
+	MaxEntrySizeKB:    1024,
+	MaxMemoryEntries:  1000,
+	BillingRatio:      0.1,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("response_cache", &responseCacheSetting)
+}
+
+func GetResponseCacheSetting() *ResponseCacheSetting {
+	return &responseCacheSetting
+}
+
+// GetTTLSeconds 返回模型的缓存时间，0 表示不缓存；模型配置优先于令牌配置
+func (s *ResponseCacheSetting) GetTTLSeconds(model string, tokenEnabled bool) int {
+	if !s.Enabled {
+		return 0
+	}
+	if ttl, ok := s.ModelTTLSeconds[model]; ok {
+		return ttl
+	}
+	if tokenEnabled {
+		return s.DefaultTTLSeconds
+	}
+	return 0
+}
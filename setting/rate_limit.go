@@ -1,6 +1,51 @@
 package setting
 
+import "one-api/setting/config"
+
 var ModelRequestRateLimitEnabled = false
 var ModelRequestRateLimitDurationMinutes = 1
 var ModelRequestRateLimitCount = 0
 var ModelRequestRateLimitSuccessCount = 1000
+
+// RateLimit 单个维度的限流配置，0 表示不限制
+type RateLimit struct {
+	// RPM 每分钟请求数
+	RPM int `json:"rpm"`
+	// TPM 每分钟 token 数，请求结束后按实际用量校正
+	TPM int `json:"tpm"`
+	// Concurrency 同时进行的请求数
+	Concurrency int `json:"concurrency"`
+}
+
+func (l RateLimit) IsEmpty() bool {
+	return l.RPM <= 0 && l.TPM <= 0 && l.Concurrency <= 0
+}
+
+// RateLimitSetting 令牌桶限流配置，与 ModelRequestRateLimit 相互独立
+type RateLimitSetting struct {
+	Enabled bool `json:"enabled"`
+	// Token 每个令牌的限流
+	Token RateLimit `json:"token"`
+	// User 每个用户的限流，同一用户的所有令牌共享
+	User RateLimit `json:"user"`
+	// Groups 按分组设置的每个用户的限流
+	Groups map[string]RateLimit `json:"groups"`
+	// Models 按模型设置的每个用户的限流
+	Models map[string]RateLimit `json:"models"`
+}
+
+// 默认配置
+var rateLimitSetting = RateLimitSetting{
+	Enabled: false,
+	Groups:  map[string]RateLimit{},
+	Models:  map[string]RateLimit{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("rate_limit", &rateLimitSetting)
+}
+
+func GetRateLimitSetting() *RateLimitSetting {
+	return &rateLimitSetting
+}
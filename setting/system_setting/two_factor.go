@@ -0,0 +1,26 @@
+package system_setting
+
+import "one-api/setting/config"
+
+// TwoFactorSetting 两步验证策略
+type TwoFactorSetting struct {
+	// RequireForAdmin 管理员和超级管理员需要启用两步验证后才能使用管理接口
+	RequireForAdmin bool `json:"require_for_admin"`
+	// RecentVerifyMinutes 敏感操作要求在此时间内完成过两步验证
+	RecentVerifyMinutes int `json:"recent_verify_minutes"`
+}
+
+// 默认配置
+var twoFactorSetting = TwoFactorSetting{
+	RequireForAdmin:     false,
+	RecentVerifyMinutes: 10,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("two_factor", &twoFactorSetting)
+}
+
+func GetTwoFactorSetting() *TwoFactorSetting {
+	return &twoFactorSetting
+}
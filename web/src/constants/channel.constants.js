@@ -119,5 +119,20 @@ export const CHANNEL_OPTIONS = [
     value: 48,
     color: 'blue',
     label: 'xAI'
+  },
+  {
+    value: 49,
+    color: 'orange',
+    label: '可灵 Kling'
+  },
+  {
+    value: 50,
+    color: 'purple',
+    label: 'Runway'
+  },
+  {
+    value: 51,
+    color: 'indigo',
+    label: 'Luma'
   }
 ];
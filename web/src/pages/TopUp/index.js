@@ -37,6 +37,8 @@ const TopUp = () => {
   const [isSubmitting, setIsSubmitting] = useState(false);
   const [open, setOpen] = useState(false);
   const [payWay, setPayWay] = useState('');
+  const [paymentProviders, setPaymentProviders] = useState([]);
+  const [currency, setCurrency] = useState('CNY');
 
   const topUp = async () => {
     if (redemptionCode === '') {
@@ -53,7 +55,7 @@ const TopUp = () => {
         showSuccess(t('兑换成功！'));
         Modal.success({
           title: t('兑换成功！'),
-          content: t('成功兑换额度：') + renderQuota(data),
+          content: message || t('成功兑换额度：') + renderQuota(data),
           centered: true,
         });
         setUserQuota((quota) => {
@@ -78,12 +80,22 @@ const TopUp = () => {
     window.open(topUpLink, '_blank');
   };
 
+  const getPaymentProvider = (payment) => {
+    if (payment === 'stripe') {
+      return 'stripe';
+    }
+    if (payment === undefined && !paymentProviders.includes('epay')) {
+      return paymentProviders[0];
+    }
+    return 'epay';
+  };
+
   const preTopUp = async (payment) => {
     if (!enableOnlineTopUp) {
       showError(t('管理员未开启在线充值！'));
       return;
     }
-    await getAmount();
+    await getAmount(undefined, getPaymentProvider(payment));
     if (topUpCount < minTopUp) {
       showError(t('充值数量不能小于') + minTopUp);
       return;
@@ -94,7 +106,7 @@ const TopUp = () => {
 
   const onlineTopUp = async () => {
     if (amount === 0) {
-      await getAmount();
+      await getAmount(undefined, getPaymentProvider(payWay));
     }
     if (topUpCount < minTopUp) {
       showError('充值数量不能小于' + minTopUp);
@@ -106,6 +118,7 @@ const TopUp = () => {
         amount: parseInt(topUpCount),
         top_up_code: topUpCode,
         payment_method: payWay,
+        provider: getPaymentProvider(payWay),
       });
       if (res !== undefined) {
         const { message, data } = res.data;
@@ -113,6 +126,10 @@ const TopUp = () => {
         if (message === 'success') {
           let params = data;
           let url = res.data.url;
+          if (!params) {
+            window.location.href = url;
+            return;
+          }
           let form = document.createElement('form');
           form.action = url;
           form.method = 'POST';
@@ -170,29 +187,40 @@ const TopUp = () => {
       if (status.enable_online_topup) {
         setEnableOnlineTopUp(status.enable_online_topup);
       }
+      if (status.payment_providers) {
+        setPaymentProviders(status.payment_providers);
+      }
     }
     getUserQuota().then();
   }, []);
 
   const renderAmount = () => {
     // console.log(amount);
+    if (currency !== 'CNY') {
+      return amount + ' ' + currency;
+    }
     return amount + ' ' + t('元');
   };
 
-  const getAmount = async (value) => {
+  const getAmount = async (value, provider) => {
     if (value === undefined) {
       value = topUpCount;
     }
+    if (provider === undefined) {
+      provider = getPaymentProvider();
+    }
     try {
       const res = await API.post('/api/user/amount', {
         amount: parseFloat(value),
         top_up_code: topUpCode,
+        provider: provider,
       });
       if (res !== undefined) {
         const { message, data } = res.data;
         // showInfo(message);
         if (message === 'success') {
           setAmount(parseFloat(data));
+          setCurrency(res.data.currency || 'CNY');
         } else {
           setAmount(0);
           Toast.error({ content: '错误：' + data, id: 'getAmount' });
@@ -293,27 +321,43 @@ const TopUp = () => {
                     }}
                   />
                   <Space>
-                    <Button
-                      type={'primary'}
-                      theme={'solid'}
-                      onClick={async () => {
-                        preTopUp('zfb');
-                      }}
-                    >
-                      {t('支付宝')}
-                    </Button>
-                    <Button
-                      style={{
-                        backgroundColor: 'rgba(var(--semi-green-5), 1)',
-                      }}
-                      type={'primary'}
-                      theme={'solid'}
-                      onClick={async () => {
-                        preTopUp('wx');
-                      }}
-                    >
-                      {t('微信')}
-                    </Button>
+                    {(paymentProviders.length === 0 ||
+                      paymentProviders.includes('epay')) && (
+                      <>
+                        <Button
+                          type={'primary'}
+                          theme={'solid'}
+                          onClick={async () => {
+                            preTopUp('zfb');
+                          }}
+                        >
+                          {t('支付宝')}
+                        </Button>
+                        <Button
+                          style={{
+                            backgroundColor: 'rgba(var(--semi-green-5), 1)',
+                          }}
+                          type={'primary'}
+                          theme={'solid'}
+                          onClick={async () => {
+                            preTopUp('wx');
+                          }}
+                        >
+                          {t('微信')}
+                        </Button>
+                      </>
+                    )}
+                    {paymentProviders.includes('stripe') && (
+                      <Button
+                        type={'primary'}
+                        theme={'solid'}
+                        onClick={async () => {
+                          preTopUp('stripe');
+                        }}
+                      >
+                        {t('银行卡')}
+                      </Button>
+                    )}
                   </Space>
                 </Form>
               </div>